@@ -19,6 +19,7 @@
 #include <WiFi.h>
 #include <HTTPClient.h>
 #include <ArduinoJson.h>
+#include "mbedtls/md.h"
 
 // WiFi credentials
 const char* ssid = "YOUR_WIFI_SSID";
@@ -28,6 +29,10 @@ const char* password = "YOUR_WIFI_PASSWORD";
 const char* recognizeApiUrl = "http://facerecognition-attendance-w1hldw-e52aca-46-62-229-91.traefik.me/api/attendance";
 const char* pythonApiUrl = "http://facerecognition-w1hldw-e52aca-46-62-229-91.traefik.me/recognize";
 
+// Secret shared with the API (ATTENDANCE_SIGNING_SECRET). When set, access is
+// only granted by responses signed with it that echo this request's nonce.
+const char* signingSecret = "";
+
 // GPIO pins
 #define BUTTON_PIN 13
 #define LED_PIN 4
@@ -241,14 +246,23 @@ bool sendImageToAPI(uint8_t* imageBuffer, size_t imageSize) {
   http.begin(recognizeApiUrl);
   http.addHeader("Content-Type", "multipart/form-data; boundary=----WebKitFormBoundary7MA4YWxkTrZu0gW");
   
+  // A fresh nonce per request, echoed in the signed response, so a recorded
+  // response cannot be replayed
+  char nonce[17];
+  snprintf(nonce, sizeof(nonce), "%08x%08x", esp_random(), esp_random());
+  
+  const char* headerKeys[] = {"X-Signature"};
+  http.collectHeaders(headerKeys, 1);
+  
   // Build multipart form data
   String boundaryStart = "------WebKitFormBoundary7MA4YWxkTrZu0gW\r\n";
+  String noncePart = boundaryStart + "Content-Disposition: form-data; name=\"nonce\"\r\n\r\n" + nonce + "\r\n";
   String contentDisposition = "Content-Disposition: form-data; name=\"image\"; filename=\"capture.jpg\"\r\n";
   String contentType = "Content-Type: image/jpeg\r\n\r\n";
   String boundaryEnd = "\r\n------WebKitFormBoundary7MA4YWxkTrZu0gW--\r\n";
   
   // Calculate total size
-  size_t totalSize = boundaryStart.length() + contentDisposition.length() + 
+  size_t totalSize = noncePart.length() + boundaryStart.length() + contentDisposition.length() + 
                      contentType.length() + imageSize + boundaryEnd.length();
   
   // Allocate buffer for complete request
@@ -261,6 +275,8 @@ bool sendImageToAPI(uint8_t* imageBuffer, size_t imageSize) {
   
   // Build the POST data
   size_t offset = 0;
+  memcpy(postData + offset, noncePart.c_str(), noncePart.length());
+  offset += noncePart.length();
   memcpy(postData + offset, boundaryStart.c_str(), boundaryStart.length());
   offset += boundaryStart.length();
   memcpy(postData + offset, contentDisposition.c_str(), contentDisposition.length());
@@ -288,7 +304,9 @@ bool sendImageToAPI(uint8_t* imageBuffer, size_t imageSize) {
     DynamicJsonDocument doc(2048);
     DeserializationError error = deserializeJson(doc, response);
     
-    if (!error) {
+    if (signingSecret[0] != '\0' && !verifyResponse(response, http.header("X-Signature"), doc, nonce)) {
+      Serial.println("❌ Response signature or nonce invalid, ignoring it");
+    } else if (!error) {
       bool apiSuccess = doc["success"] | false;
       
       if (apiSuccess) {
@@ -321,6 +339,39 @@ bool sendImageToAPI(uint8_t* imageBuffer, size_t imageSize) {
   return success;
 }
 
+// verifyResponse checks that the body was signed with signingSecret and
+// answers the request that carried nonce
+bool verifyResponse(const String& body, const String& signature, JsonDocument& doc, const char* nonce) {
+  unsigned char mac[32];
+  mbedtls_md_context_t ctx;
+  mbedtls_md_init(&ctx);
+  mbedtls_md_setup(&ctx, mbedtls_md_info_from_type(MBEDTLS_MD_SHA256), 1);
+  mbedtls_md_hmac_starts(&ctx, (const unsigned char*)signingSecret, strlen(signingSecret));
+  mbedtls_md_hmac_update(&ctx, (const unsigned char*)body.c_str(), body.length());
+  mbedtls_md_hmac_finish(&ctx, mac);
+  mbedtls_md_free(&ctx);
+  
+  char expected[7 + 64 + 1] = "sha256=";
+  for (int i = 0; i < 32; i++) {
+    sprintf(expected + 7 + 2 * i, "%02x", mac[i]);
+  }
+  if (signature.length() != strlen(expected)) {
+    return false;
+  }
+  
+  // Compare in constant time
+  uint8_t diff = 0;
+  for (size_t i = 0; i < signature.length(); i++) {
+    diff |= signature[i] ^ expected[i];
+  }
+  if (diff != 0) {
+    return false;
+  }
+  
+  const char* echoed = doc["nonce"] | "";
+  return strcmp(echoed, nonce) == 0;
+}
+
 void grantAccess() {
   // Visual feedback
   for (int i = 0; i < 3; i++) {
@@ -0,0 +1,16 @@
+// Package api holds the OpenAPI description of the attendance API and the
+// page that renders it with Swagger UI
+package api
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI 3 specification in YAML. It is maintained by hand
+// next to the handlers, so update it together with them.
+//
+//go:embed openapi.yaml
+var OpenAPI []byte
+
+// DocsPage is the Swagger UI page served at /docs
+//
+//go:embed docs.html
+var DocsPage []byte
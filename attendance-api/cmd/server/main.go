@@ -2,58 +2,621 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata" // ATTENDANCE_TIMEZONE works without the zoneinfo of the host
 
 	"attendance-api/internal/client"
 	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
 	"attendance-api/internal/handler"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/middleware"
+	"attendance-api/internal/pb/attendancev1"
+	"attendance-api/internal/reporting"
 	"attendance-api/internal/service"
+	"attendance-api/internal/tracing"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 func main() {
-	cfg, err := config.Load()
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, config.ErrHelp) {
+		os.Exit(0)
+	}
+	var invalid *config.InvalidError
+	if errors.As(err, &invalid) {
+		for _, problem := range invalid.Problems {
+			slog.Error("Invalid configuration", "problem", problem)
+		}
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal("Failed to load config", err)
+	}
+
+	logger := logging.Setup(cfg.Log)
+
+	if err := reporting.Setup(cfg.Errors); err != nil {
+		fatal("Failed to set up error reporting", err)
+	}
+	slog.SetDefault(slog.New(reporting.Handler(logger.Handler())))
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("Failed to set up tracing", err)
+	}
+
+	// The write and read pools cannot share an SQLite in-memory database,
+	// so ":memory:" is a database in a directory removed at shutdown
+	if cfg.Attendance.DBPath == ":memory:" {
+		dir, err := os.MkdirTemp("", "attendance-api-")
+		if err != nil {
+			fatal("Failed to create database directory", err)
+		}
+		defer os.RemoveAll(dir)
+		cfg.Attendance.DBPath = filepath.Join(dir, "attendance.db")
+		slog.Warn("Using a throwaway database, nothing is kept after shutdown", "path", cfg.Attendance.DBPath)
+	}
+
+	db, err := service.OpenDatabase(cfg.Attendance.DBPath, cfg.Attendance.Timezone, cfg.Database)
+	if err != nil {
+		fatal("Failed to open database", err)
+	}
+
+	reads, err := service.OpenReadPool(cfg.Attendance.DBPath, cfg.Attendance.Timezone, cfg.Database)
+	if err != nil {
+		fatal("Failed to open read pool", err)
+	}
+	defer reads.Close()
+	defer db.Close()
+
+	faceLimiter := client.NewConcurrencyLimiter(cfg.FaceAPI.MaxConcurrent, cfg.FaceAPI.MaxQueued, cfg.FaceAPI.QueueTimeout)
+	currentClient, err := newRecognizer(cfg.FaceAPI, faceLimiter)
+	if err != nil {
+		fatal("Failed to initialize face recognition client", err)
+	}
+
+	nextClient, err := secondaryRecognizer(cfg.Switchover.FaceAPI, cfg.FaceAPI)
+	if err != nil {
+		fatal("Failed to initialize next face recognition client", err)
+	}
+	nextName := ""
+	if nextClient != nil {
+		nextName = faceServiceName(cfg.Switchover.FaceAPI)
+		slog.Info("Writing enrollments to the next face service as well", "component", "switchover", "face_service", nextName)
+	}
+	faceClient := client.NewSwitchingRecognizer(currentClient, faceServiceName(cfg.FaceAPI), nextClient, nextName)
+
+	switchoverService, err := service.NewSwitchoverService(faceClient, db)
+	if err != nil {
+		fatal("Failed to initialize face service switchover", err)
+	}
+
+	warmupService, err := service.NewWarmupService(faceClient, cfg.Warmup)
+	if err != nil {
+		fatal("Failed to initialize warm-up", err)
+	}
+	warmupService.Start()
+	defer warmupService.Close()
+
+	dataDirs := []string{filepath.Dir(cfg.Attendance.DBPath)}
+	if cfg.Snapshots.Storage == "disk" {
+		dataDirs = append(dataDirs, cfg.Snapshots.Dir)
+	}
+	healthService := service.NewHealthService(db, faceClient, warmupService, dataDirs, cfg.Health)
+
+	calendarService, err := service.NewCalendarService(db, cfg.Calendar)
+	if err != nil {
+		fatal("Failed to initialize calendar", err)
+	}
+
+	snapshotStore, err := service.NewSnapshotStore(cfg.Snapshots)
+	if err != nil {
+		fatal("Failed to initialize snapshot storage", err)
+	}
+
+	unknownService, err := service.NewUnknownService(faceClient, db, reads, snapshotStore)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		fatal("Failed to initialize unknown review queue", err)
 	}
 
-	faceClient := client.NewFaceRecognitionClient(cfg.FaceAPI.URL, cfg.FaceAPI.Timeout)
-	attendanceService, err := service.NewAttendanceService(faceClient, cfg.Attendance.DBPath)
+	snapshotService, err := service.NewSnapshotService(db, reads, snapshotStore, unknownService, cfg.Snapshots)
 	if err != nil {
-		log.Fatalf("Failed to initialize attendance service: %v", err)
+		fatal("Failed to initialize snapshot capture", err)
+	}
+
+	candidateClient, err := secondaryRecognizer(cfg.Experiment.FaceAPI, cfg.FaceAPI)
+	if err != nil {
+		fatal("Failed to initialize experiment face recognition client", err)
+	}
+
+	experimentService, err := service.NewExperimentService(candidateClient, db, reads, cfg.Experiment, cfg.Attendance.MinConfidence)
+	if err != nil {
+		fatal("Failed to initialize experiment", err)
+	}
+	defer experimentService.Close()
+
+	siemExporter, err := service.NewSIEMExporter(cfg.SIEM)
+	if err != nil {
+		fatal("Failed to initialize SIEM export", err)
+	}
+	defer siemExporter.Close()
+
+	webhookService, err := service.NewWebhookService(db, reads, cfg.Webhooks)
+	if err != nil {
+		fatal("Failed to initialize webhooks", err)
+	}
+	defer webhookService.Close()
+
+	buildingBridge, err := service.NewBuildingBridge(reads, cfg.Attendance.Timezone, cfg.Building)
+	if err != nil {
+		fatal("Failed to initialize building bridge", err)
+	}
+	defer buildingBridge.Close()
+
+	eventBus, err := service.NewEventBus(cfg.EventBus)
+	if err != nil {
+		fatal("Failed to initialize event bus", err)
+	}
+	defer eventBus.Close()
+
+	streamBridge, err := service.NewStreamBridge(cfg.Bridge)
+	if err != nil {
+		fatal("Failed to initialize stream bridge", err)
+	}
+	defer streamBridge.Close()
+
+	attendanceService, err := service.NewAttendanceService(faceClient, db, reads, calendarService, snapshotService, experimentService, siemExporter, webhookService, buildingBridge, eventBus, streamBridge, cfg.Attendance)
+	if err != nil {
+		fatal("Failed to initialize attendance service", err)
 	}
 	defer attendanceService.Close()
+	buildingBridge.Start()
 
-	h := handler.NewHandler(faceClient, attendanceService, cfg)
+	widgetService := service.NewWidgetService(reads, snapshotService, warmupService, cfg.Attendance.Timezone, cfg.Widgets)
+	statusService := service.NewStatusService(reads, faceClient, attendanceService, cfg.Attendance.DBPath, cfg.Health)
+
+	apiKeyService, err := service.NewAPIKeyService(db)
+	if err != nil {
+		fatal("Failed to initialize API key service", err)
+	}
+
+	deviceService, err := service.NewDeviceService(db, cfg.Devices)
+	if err != nil {
+		fatal("Failed to initialize device registry", err)
+	}
+	defer deviceService.Close()
+
+	userService, err := service.NewUserService(db, cfg.Auth)
+	if err != nil {
+		fatal("Failed to initialize user accounts", err)
+	}
+
+	webAuthnService, err := service.NewWebAuthnService(db, cfg.WebAuthn)
+	if err != nil {
+		fatal("Failed to initialize WebAuthn", err)
+	}
+
+	if cfg.Ingest.Enabled {
+		watcher, err := service.NewFolderWatcher(attendanceService, cfg.Ingest)
+		if err != nil {
+			fatal("Failed to initialize folder watcher", err)
+		}
+
+		watchCtx, stopWatcher := context.WithCancel(context.Background())
+		defer stopWatcher()
+		go watcher.Run(watchCtx)
+	}
+
+	jobManager, err := service.NewJobManager(db, cfg.Jobs)
+	if err != nil {
+		fatal("Failed to initialize job manager", err)
+	}
+	defer jobManager.Close()
+
+	// Asynchronous attendance requests have workers of their own, so long
+	// imports do not hold up the doors. Their jobs share the table, which
+	// jobManager prunes.
+	recognitionJobs, err := service.NewJobManager(db, config.JobsConfig{
+		Workers:   cfg.Jobs.RecognitionWorkers,
+		QueueSize: cfg.Jobs.RecognitionQueueSize,
+	})
+	if err != nil {
+		fatal("Failed to initialize recognition jobs", err)
+	}
+	recognitionJobs.OnFinish(attendanceService.RecognitionCompleted)
+	defer recognitionJobs.Close()
+
+	auditService, err := service.NewAuditService(db, reads)
+	if err != nil {
+		fatal("Failed to initialize audit log", err)
+	}
+
+	clockService, err := service.NewClockService(db, reads, cfg.Clock)
+	if err != nil {
+		fatal("Failed to initialize device clocks", err)
+	}
+
+	changeFeed, err := service.NewChangeFeed(db, reads, cfg.Changes)
+	if err != nil {
+		fatal("Failed to initialize attendance change feed", err)
+	}
+	defer changeFeed.Close()
+
+	usageService, err := service.NewUsageService(db, reads, cfg.Attendance.Timezone, cfg.Usage)
+	if err != nil {
+		fatal("Failed to initialize usage statistics", err)
+	}
+	defer usageService.Close()
+
+	enrollmentService := service.NewEnrollmentService(faceClient)
+	analyticsService := service.NewAnalyticsService(reads, calendarService, cfg.Attendance.Timezone, cfg.Analytics)
+
+	replicationService, err := service.NewReplicationService(db, reads, cfg.Replication)
+	if err != nil {
+		fatal("Failed to initialize replication", err)
+	}
+	// Webhooks replicated while in standby are only sent once promoted
+	replicationService.OnPromote(func() {
+		if err := webhookService.Reload(); err != nil {
+			logger.Error("Failed to reload webhooks after promotion", "error", err)
+		}
+	})
+	replicationService.Start()
+	defer replicationService.Close()
+	deviceService.Start(attendanceService.DeviceStatusChanged, attendanceService.DeviceConfigChanged, replicationService.IsStandby)
+
+	integrityChecker := service.NewIntegrityChecker(db, cfg.Ingest)
+	if cfg.Integrity.OnBoot {
+		checkIntegrity(integrityChecker, cfg.Integrity.AutoRepair)
+	}
+
+	h := handler.NewHandler(faceClient, attendanceService, enrollmentService, jobManager, recognitionJobs, auditService, clockService, cfg)
+	keys := handler.NewAPIKeyHandler(apiKeyService, auditService)
+	devices := handler.NewDeviceHandler(deviceService, auditService)
+	users := handler.NewUserHandler(userService, auditService)
+	webAuthn := handler.NewWebAuthnHandler(webAuthnService, userService)
+	analytics := handler.NewAnalyticsHandler(analyticsService, cfg.Attendance.Timezone)
+	calendar := handler.NewCalendarHandler(calendarService, auditService, cfg.Attendance.Timezone)
+	database := handler.NewDatabaseHandler(db, reads)
+	status := handler.NewStatusHandler(statusService)
+	faceService := handler.NewFaceServiceHandler(faceLimiter)
+	switchover := handler.NewSwitchoverHandler(switchoverService, auditService)
+	experiments := handler.NewExperimentHandler(experimentService, cfg.Attendance.Timezone)
+	integrity := handler.NewIntegrityHandler(integrityChecker)
+	replication := handler.NewReplicationHandler(replicationService)
+	audit := handler.NewAuditHandler(auditService, cfg.Attendance.Timezone)
+	clock := handler.NewClockHandler(clockService)
+	changes := handler.NewChangeHandler(changeFeed)
+	usage := handler.NewUsageHandler(usageService, cfg.Attendance.Timezone)
+	webhooks := handler.NewWebhookHandler(webhookService, auditService)
+	building := handler.NewBuildingHandler(buildingBridge)
+	unknowns := handler.NewUnknownHandler(unknownService, attendanceService, auditService)
+	snapshots := handler.NewSnapshotHandler(snapshotService, auditService, cfg.Attendance.Timezone)
+	widgets := handler.NewWidgetHandler(widgetService)
+	auth := middleware.NewAuth(apiKeyService, userService, deviceService, webAuthnService, cfg.Auth)
+	cors, err := middleware.NewCORS(cfg.Server.CORS)
+	if err != nil {
+		fatal("Invalid CORS configuration", err)
+	}
+	slog.Info("CORS configured", "cors", cors.String())
+	limiter := middleware.NewRateLimiter(cfg.RateLimit)
+	if limiter.Enabled() {
+		slog.Info("Rate limiting per API key, user or client IP", "limit", limiter.String())
+	}
+	allowlist, err := middleware.NewIPAllowlist(cfg.Allowlist)
+	if err != nil {
+		fatal("Invalid IP allowlist", err)
+	}
+	defer allowlist.Close()
+	if allowlist.Enabled() {
+		slog.Info("IP allowlist configured", "allowlist", allowlist.String())
+	}
+	compat := middleware.NewCompat(cfg.Server)
+	if len(cfg.Server.LegacyUserAgents) > 0 {
+		slog.Info("Serving 1.0 responses to legacy clients", "user_agents", cfg.Server.LegacyUserAgents)
+	}
+	jobs := handler.NewJobHandler(jobManager, auth.Permits, cfg.Attendance.SigningSecret)
+	graphQL, err := handler.NewGraphQLHandler(attendanceService, auditService, auth.Permits)
+	if err != nil {
+		fatal("Failed to set up GraphQL", err)
+	}
+	docs, err := handler.NewDocsHandler()
+	if err != nil {
+		fatal("Failed to load API documentation", err)
+	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/api/faces", h.ListFaces)
-	mux.HandleFunc("/api/faces/upload", h.UploadFaces)
-	mux.HandleFunc("/api/attendance", h.RecordAttendance)
-	mux.HandleFunc("/api/attendance/stream", h.AttendanceStream)
-	mux.HandleFunc("/api/attendance/recent", h.GetRecentAttendance)
-	mux.HandleFunc("/api/attendance/stats", h.GetAttendanceStats)
+	mux.HandleFunc("/api/v1/faces", auth.Require(domain.ScopeReportsRead, h.ListFaces))
+	mux.HandleFunc("/api/v1/faces/upload", auth.Require(domain.ScopeFacesAdmin, h.UploadFaces))
+	mux.HandleFunc("/api/v1/faces/{name}", auth.RequireStepUp(domain.ScopeFacesAdmin, h.DeleteFace))
+	mux.HandleFunc("GET /api/v1/faces/{name}/images", auth.Require(domain.ScopeReportsRead, h.ListFaceImages))
+	mux.HandleFunc("/api/v1/attendance", auth.Require(domain.ScopeAttendanceWrite, h.RecordAttendance))
+	mux.HandleFunc("/api/v1/attendance/stream", auth.RequireOrSelf(domain.ScopeRecordsRead, h.AttendanceStream))
+	mux.HandleFunc("/api/v1/attendance/recent", auth.Require(domain.ScopeRecordsRead, h.GetRecentAttendance))
+	mux.HandleFunc("/api/v1/attendance/by-external/{id}", auth.Require(domain.ScopeRecordsRead, h.GetAttendanceByExternalID))
+	mux.HandleFunc("/api/v1/attendance/changes", auth.Require(domain.ScopeRecordsRead, changes.Changes))
+	mux.HandleFunc("/api/v1/attendance/stats", auth.Require(domain.ScopeReportsRead, h.GetAttendanceStats))
+	mux.HandleFunc("/api/v1/attendance/hours", auth.Require(domain.ScopeReportsRead, h.GetWorkedHours))
+	mux.HandleFunc("/api/v1/attendance/tags", auth.Require(domain.ScopeReportsRead, h.GetTagCounts))
+	mux.HandleFunc("/api/v1/attendance/export.xlsx", auth.Require(domain.ScopeReportsRead, h.ExportMonthXLSX))
+	mux.HandleFunc("/api/v1/attendance/import", auth.Require(domain.ScopeAttendanceAdmin, h.ImportAttendance))
+	mux.HandleFunc("/api/v1/assignments", auth.Require(domain.ScopeFacesAdmin, h.LocationAssignments))
+	mux.HandleFunc("/api/v1/assignments/{name}", auth.Require(domain.ScopeFacesAdmin, h.LocationAssignment))
+	mux.HandleFunc("/api/v1/doors", auth.Require(domain.ScopeFacesAdmin, h.Doors))
+	mux.HandleFunc("/api/v1/doors/{id}", auth.Require(domain.ScopeFacesAdmin, h.Door))
+	mux.HandleFunc("/api/v1/doors/{id}/open", auth.Require(domain.ScopeAttendanceAdmin, h.OpenDoor))
+	mux.HandleFunc("/api/v1/doors/{id}/close", auth.Require(domain.ScopeAttendanceAdmin, h.CloseDoor))
+	mux.HandleFunc("/api/v1/zones", auth.Require(domain.ScopeFacesAdmin, h.Zones))
+	mux.HandleFunc("/api/v1/zones/{name}", auth.Require(domain.ScopeFacesAdmin, h.Zone))
+	mux.HandleFunc("/api/v1/schedules", auth.Require(domain.ScopeFacesAdmin, h.DoorSchedules))
+	mux.HandleFunc("/api/v1/schedules/{id}", auth.Require(domain.ScopeFacesAdmin, h.DoorSchedule))
+	mux.HandleFunc("/api/v1/people", auth.Require(domain.ScopeReportsRead, h.People))
+	mux.HandleFunc("POST /api/v1/people", auth.Require(domain.ScopeFacesAdmin, h.People))
+	mux.HandleFunc("/api/v1/people/{id}", auth.Require(domain.ScopeReportsRead, h.Person))
+	mux.HandleFunc("PATCH /api/v1/people/{id}", auth.Require(domain.ScopeFacesAdmin, h.Person))
+	mux.HandleFunc("DELETE /api/v1/people/{id}", auth.RequireStepUp(domain.ScopeFacesAdmin, h.Person))
+	mux.HandleFunc("POST /api/v1/people/merge", auth.Require(domain.ScopeFacesAdmin, h.MergePeople))
+	mux.HandleFunc("GET /api/v1/people/by-external/{id}", auth.Require(domain.ScopeReportsRead, h.PersonByReference))
+	mux.HandleFunc("POST /api/v1/people/{id}/merge", auth.Require(domain.ScopeFacesAdmin, h.MergePerson))
+	mux.HandleFunc("POST /api/v1/people/{id}/split", auth.Require(domain.ScopeFacesAdmin, h.SplitPerson))
+	mux.HandleFunc("GET /api/v1/people/changes", auth.Require(domain.ScopeFacesAdmin, h.IdentityChanges))
+	mux.HandleFunc("POST /api/v1/people/changes/{id}/revert", auth.Require(domain.ScopeFacesAdmin, h.RevertIdentityChange))
+	// Method-specific so the patterns do not overlap with by-external
+	mux.HandleFunc("PUT /api/v1/people/{name}/membership", auth.Require(domain.ScopeFacesAdmin, h.Membership))
+	mux.HandleFunc("DELETE /api/v1/people/{name}/membership", auth.Require(domain.ScopeFacesAdmin, h.Membership))
+	mux.HandleFunc("GET /api/v1/people/by-name/{name}", auth.Require(domain.ScopeReportsRead, h.Profile))
+	mux.HandleFunc("/api/v1/groups", auth.Require(domain.ScopeReportsRead, h.Groups))
+	mux.HandleFunc("/api/v1/unknowns", auth.Require(domain.ScopeFacesAdmin, unknowns.ListUnknowns))
+	mux.HandleFunc("/api/v1/unknowns/{id}", auth.Require(domain.ScopeFacesAdmin, unknowns.Unknown))
+	mux.HandleFunc("/api/v1/unknowns/{id}/image", auth.Require(domain.ScopeSnapshotsRead, unknowns.Image))
+	mux.HandleFunc("/api/v1/unknowns/{id}/crop", auth.Require(domain.ScopeSnapshotsRead, unknowns.Crop))
+	mux.HandleFunc("/api/v1/unknowns/{id}/enroll", auth.Require(domain.ScopeFacesAdmin, unknowns.Enroll))
+	mux.HandleFunc("/api/v1/snapshots", auth.Require(domain.ScopeSnapshotsRead, snapshots.ListSnapshots))
+	mux.HandleFunc("/api/v1/snapshots/{id}", auth.Require(domain.ScopeSnapshotsRead, snapshots.Snapshot))
+	mux.HandleFunc("/api/v1/snapshots/{id}/image", auth.Require(domain.ScopeSnapshotsRead, snapshots.Image))
+	mux.HandleFunc("/api/v1/snapshots/{id}/crop", auth.Require(domain.ScopeSnapshotsRead, snapshots.Crop))
+	mux.HandleFunc("/api/v1/shifts", auth.Require(domain.ScopeAttendanceAdmin, h.Shifts))
+	mux.HandleFunc("/api/v1/shifts/{id}", auth.Require(domain.ScopeAttendanceAdmin, h.Shift))
+	mux.HandleFunc("/api/v1/reports/security", auth.Require(domain.ScopeReportsRead, h.GetSecurityReport))
+	mux.HandleFunc("/api/v1/reports/pdf", auth.Require(domain.ScopeReportsRead, h.GetPDFReport))
+	mux.HandleFunc("/api/v1/reports/privacy", auth.Require(domain.ScopeReportsRead, snapshots.PrivacyReport))
+	mux.HandleFunc("/api/v1/reports/absent", auth.Require(domain.ScopeReportsRead, h.GetAbsenceReport))
+	mux.HandleFunc("/api/v1/analytics/rolling", auth.Require(domain.ScopeReportsRead, analytics.GetRolling))
+	mux.HandleFunc("/api/v1/calendar", auth.Require(domain.ScopeReportsRead, calendar.GetCalendar))
+	mux.HandleFunc("/api/v1/calendar/holidays", auth.Require(domain.ScopeAttendanceAdmin, calendar.Holidays))
+	mux.HandleFunc("/api/v1/calendar/holidays/{date}", auth.Require(domain.ScopeAttendanceAdmin, calendar.Holiday))
+	mux.HandleFunc("/api/v1/widgets/present", auth.RequireUnless(allowlist.OpensWidgets, domain.ScopeReportsRead, widgets.Present))
+	mux.HandleFunc("/api/v1/widgets/arrivals", auth.RequireUnless(allowlist.OpensWidgets, domain.ScopeReportsRead, widgets.Arrivals))
+	mux.HandleFunc("/api/v1/widgets/arrivals/{id}/thumbnail", auth.RequireUnless(allowlist.OpensWidgets, domain.ScopeSnapshotsRead, widgets.Thumbnail))
+	mux.HandleFunc("/api/v1/widgets/alerts", auth.RequireUnless(allowlist.OpensWidgets, domain.ScopeReportsRead, widgets.Alerts))
+	mux.HandleFunc("/api/v1/webhooks", auth.Require(domain.ScopeKeysAdmin, webhooks.Webhooks))
+	mux.HandleFunc("/api/v1/webhooks/{id}", auth.Require(domain.ScopeKeysAdmin, webhooks.Webhook))
+	mux.HandleFunc("/api/v1/jobs", auth.Require(domain.ScopeReportsRead, jobs.ListJobs))
+	mux.HandleFunc("/api/v1/jobs/{id}", auth.RequireAny([]string{domain.ScopeReportsRead, domain.ScopeRecordsRead, domain.ScopeAttendanceWrite}, jobs.GetJob))
+	mux.HandleFunc("/api/v1/admin/database", auth.Require(domain.ScopeKeysAdmin, database.GetStats))
+	mux.HandleFunc("/api/v1/admin/status", auth.Require(domain.ScopeKeysAdmin, status.GetStatus))
+	mux.HandleFunc("/api/v1/admin/config", auth.Require(domain.ScopeKeysAdmin, h.GetConfig))
+	mux.HandleFunc("/api/v1/admin/streams", auth.Require(domain.ScopeKeysAdmin, h.GetStreamStats))
+	mux.HandleFunc("/api/v1/admin/metrics", auth.Require(domain.ScopeKeysAdmin, h.RecognitionMetrics))
+	mux.HandleFunc("/metrics", auth.Require(domain.ScopeReportsRead, h.Metrics))
+	mux.HandleFunc("/api/v1/admin/face-service", auth.Require(domain.ScopeKeysAdmin, faceService.GetStats))
+	mux.HandleFunc("/api/v1/admin/face-service/switchover", auth.Require(domain.ScopeKeysAdmin, switchover.Status))
+	mux.HandleFunc("/api/v1/admin/face-service/switchover/cutover", auth.RequireStepUp(domain.ScopeKeysAdmin, switchover.Cutover))
+	mux.HandleFunc("/api/v1/admin/experiments", auth.Require(domain.ScopeKeysAdmin, experiments.Report))
+	mux.HandleFunc("/api/v1/admin/integrity", auth.Require(domain.ScopeKeysAdmin, integrity.Check))
+	mux.HandleFunc("/api/v1/admin/replication", auth.Require(domain.ScopeKeysAdmin, replication.Status))
+	mux.HandleFunc("/api/v1/admin/replication/promote", auth.RequireStepUp(domain.ScopeKeysAdmin, replication.Promote))
+	mux.HandleFunc("/api/v1/replication/stream", auth.Require(domain.ScopeReplication, replication.Stream))
+	mux.HandleFunc("/api/v1/admin/apikeys", auth.Require(domain.ScopeKeysAdmin, keys.APIKeys))
+	mux.HandleFunc("/api/v1/admin/apikeys/{id}", auth.Require(domain.ScopeKeysAdmin, keys.APIKey))
+	mux.HandleFunc("/api/v1/devices", auth.Require(domain.ScopeKeysAdmin, devices.Devices))
+	mux.HandleFunc("/api/v1/devices/{id}", auth.Require(domain.ScopeKeysAdmin, devices.Device))
+	mux.HandleFunc("/api/v1/devices/{id}/token", auth.Require(domain.ScopeKeysAdmin, devices.RotateToken))
+	mux.HandleFunc("/api/v1/devices/{id}/heartbeat", auth.Require(domain.ScopeAttendanceWrite, devices.Heartbeat))
+	mux.HandleFunc("GET /api/v1/devices/{id}/config", auth.Require(domain.ScopeAttendanceWrite, devices.Config))
+	mux.HandleFunc("PUT /api/v1/devices/{id}/config", auth.Require(domain.ScopeKeysAdmin, devices.SetConfig))
+	mux.HandleFunc("/api/v1/devices/{id}/commands", auth.Require(domain.ScopeKeysAdmin, devices.Commands))
+	mux.HandleFunc("/api/v1/devices/{id}/commands/{command}", auth.Require(domain.ScopeKeysAdmin, devices.Command))
+	mux.HandleFunc("/api/v1/devices/{id}/commands/poll", auth.Require(domain.ScopeAttendanceWrite, devices.PollCommands))
+	mux.HandleFunc("/api/v1/devices/{id}/commands/{command}/ack", auth.Require(domain.ScopeAttendanceWrite, devices.AckCommand))
+	mux.HandleFunc("/api/v1/admin/users", auth.Require(domain.ScopeKeysAdmin, users.Users))
+	mux.HandleFunc("/api/v1/admin/users/{id}", auth.Require(domain.ScopeKeysAdmin, users.User))
+	mux.HandleFunc("DELETE /api/v1/admin/users/{id}", auth.RequireStepUp(domain.ScopeKeysAdmin, users.User))
+	mux.HandleFunc("/api/v1/admin/roles", auth.Require(domain.ScopeKeysAdmin, users.Roles))
+	mux.HandleFunc("/api/v1/admin/audit", auth.Require(domain.ScopeKeysAdmin, audit.List))
+	mux.HandleFunc("/api/v1/admin/devices/clocks", auth.Require(domain.ScopeKeysAdmin, clock.Devices))
+	mux.HandleFunc("/api/v1/admin/usage/clients", auth.Require(domain.ScopeKeysAdmin, usage.Clients))
+	mux.HandleFunc("/api/v1/admin/webhooks/{id}/test", auth.Require(domain.ScopeKeysAdmin, webhooks.Test))
+	mux.HandleFunc("/api/v1/admin/webhooks/{id}/deliveries", auth.Require(domain.ScopeKeysAdmin, webhooks.Deliveries))
+	mux.HandleFunc("/api/v1/admin/building", auth.Require(domain.ScopeKeysAdmin, building.Status))
+	mux.HandleFunc("/api/v1/admin/lockdown", auth.Require(domain.ScopeAttendanceAdmin, h.Lockdown))
+	mux.HandleFunc("/api/v1/admin/unlock-all", auth.Require(domain.ScopeAttendanceAdmin, h.UnlockAll))
+	mux.HandleFunc("/api/v1/admin/emergency", auth.Require(domain.ScopeAttendanceAdmin, h.Emergency))
+	mux.HandleFunc("/api/v1/time", auth.Require(domain.ScopeAttendanceWrite, clock.Time))
+	mux.HandleFunc("/api/v1/auth/login", users.Login)
+	mux.HandleFunc("/api/v1/auth/refresh", users.Refresh)
+	mux.HandleFunc("/api/v1/auth/logout", users.Logout)
+	mux.HandleFunc("/api/v1/auth/webauthn/register/begin", webAuthn.BeginRegistration)
+	mux.HandleFunc("/api/v1/auth/webauthn/register/finish", webAuthn.FinishRegistration)
+	mux.HandleFunc("/api/v1/auth/webauthn/credentials", webAuthn.Credentials)
+	mux.HandleFunc("/api/v1/auth/webauthn/credentials/{id}", webAuthn.Credential)
+	mux.HandleFunc("/api/v1/auth/webauthn/step-up/begin", webAuthn.BeginStepUp)
+	mux.HandleFunc("/api/v1/auth/webauthn/step-up/finish", webAuthn.FinishStepUp)
+	mux.HandleFunc("/api/v1/graphql", auth.Require(domain.ScopeReportsRead, graphQL.Query))
+	mux.HandleFunc("/api/v1/openapi.json", docs.OpenAPI)
+	mux.HandleFunc("/docs", docs.Docs)
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		healthCheck(w, r, attendanceService)
+		healthCheck(w, r, attendanceService, replicationService)
 	})
+	mux.HandleFunc("/health/ready", func(w http.ResponseWriter, r *http.Request) {
+		readinessCheck(w, r, warmupService)
+	})
+	mux.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) {
+		probe(w, healthService.Live())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		probe(w, healthService.Ready(r.Context()))
+	})
+
+	for route := range cfg.Server.RouteTimeouts {
+		if !hasRoute(mux, route) {
+			fatal("Invalid SERVER_ROUTE_TIMEOUTS", fmt.Errorf("no route %s", route))
+		}
+	}
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port),
-		Handler:      loggingMiddleware(corsMiddleware(mux)),
+		Handler:      traced(middleware.RequestID(auth.Identify(usageTracking(usageService, loggingMiddleware(recoverPanics(cors.Handle(limiter.Limit(legacyRoutes(cfg.Server, compat.Translate(securityEvents(siemExporter, allowlist.Restrict(standbyGuard(replicationService, routeTimeouts(cfg.Server.RouteTimeouts, mux, routeSpans(mux))))))))))))))),
 		ReadTimeout:  25 * time.Second,
 		WriteTimeout: 0, // Disable write timeout for SSE streaming
 		IdleTimeout:  120 * time.Second,
 	}
 
+	// Replication and change streams never go idle on their own
+	server.RegisterOnShutdown(replicationService.Close)
+	server.RegisterOnShutdown(changeFeed.Close)
+
+	var redirectServer *http.Server
+	if cfg.Server.TLS.Enabled() {
+		tlsConfig, redirect, err := serverTLS(cfg.Server)
+		if err != nil {
+			fatal("Failed to set up TLS", err)
+		}
+		server.TLSConfig = tlsConfig
+
+		if cfg.Server.TLS.HTTPPort != "" {
+			redirectServer = &http.Server{
+				Addr:         fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.TLS.HTTPPort),
+				Handler:      redirect,
+				ReadTimeout:  10 * time.Second,
+				WriteTimeout: 10 * time.Second,
+			}
+			go func() {
+				slog.Info("Redirecting HTTP to HTTPS", "addr", redirectServer.Addr)
+				if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					fatal("HTTP redirect server failed", err)
+				}
+			}()
+		}
+	}
+
 	go func() {
-		log.Printf("Starting server on %s", server.Addr)
+		if server.TLSConfig != nil {
+			slog.Info("Starting HTTPS server", "addr", server.Addr)
+			if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				fatal("Server failed", err)
+			}
+			return
+		}
+		slog.Info("Starting server", "addr", server.Addr)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed: %v", err)
+			fatal("Server failed", err)
+		}
+	}()
+
+	var grpcServer *grpc.Server
+	var grpcService *handler.GRPCServer
+	if cfg.Server.GRPCPort != "" {
+		options := []grpc.ServerOption{
+			grpc.StatsHandler(otelgrpc.NewServerHandler()),
+			grpc.ChainUnaryInterceptor(middleware.UnaryRequestID(), securityUnaryInterceptor(siemExporter), allowlist.UnaryRestrict(attendancev1.Attendance_RecordAttendance_FullMethodName),
+				auth.UnaryScopes(handler.GRPCScopes), limiter.UnaryLimit(), loggingUnaryInterceptor, recoverUnaryInterceptor),
+			grpc.ChainStreamInterceptor(middleware.StreamRequestID(), securityStreamInterceptor(siemExporter), auth.StreamScopes(handler.GRPCScopes), loggingStreamInterceptor, recoverStreamInterceptor),
+			// Room for the image plus the other request fields
+			grpc.MaxRecvMsgSize(int(cfg.Upload.MaxUploadSize) + 64<<10),
+		}
+		if server.TLSConfig != nil {
+			options = append(options, grpc.Creds(credentials.NewTLS(server.TLSConfig)))
+		}
+		grpcServer = grpc.NewServer(options...)
+		grpcService = handler.NewGRPCServer(faceClient, attendanceService, replicationService, cfg)
+		attendancev1.RegisterAttendanceServer(grpcServer, grpcService)
+
+		listener, err := net.Listen("tcp", fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.GRPCPort))
+		if err != nil {
+			fatal("Failed to listen for gRPC", err)
+		}
+		go func() {
+			slog.Info("Starting gRPC server", "addr", listener.Addr().String())
+			if err := grpcServer.Serve(listener); err != nil {
+				fatal("gRPC server failed", err)
+			}
+		}()
+	}
+
+	// Thresholds, CORS origins, retention and the face service URL follow
+	// the config files, on SIGHUP or as soon as one is written
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	if err := config.Watch(func() {
+		select {
+		case reloads <- syscall.SIGHUP:
+		default: // a reload is already pending
+		}
+	}); err != nil {
+		slog.Warn("Config files are not watched, reload with SIGHUP", "error", err)
+	}
+	go func() {
+		applied := cfg
+		for range reloads {
+			next, err := config.Reload()
+			if err != nil {
+				slog.Error("Failed to reload config, keeping the current one", "error", err)
+				continue
+			}
+
+			attendanceService.Reconfigure(next.Attendance)
+			changeFeed.Reconfigure(next.Changes)
+			jobManager.Reconfigure(next.Jobs)
+			usageService.Reconfigure(next.Usage)
+			webhookService.Reconfigure(next.Webhooks)
+			if err := cors.Reconfigure(next.Server.CORS); err != nil {
+				slog.Error("Failed to reload CORS origins, keeping the current ones", "error", err)
+				next.Server.CORS = applied.Server.CORS
+			} else if !slices.Equal(next.Server.CORS.AllowedOrigins, applied.Server.CORS.AllowedOrigins) {
+				slog.Info("CORS origins changed", "cors", cors.String())
+			}
+			if next.Attendance.Timezone.String() != applied.Attendance.Timezone.String() {
+				slog.Warn("Changing the timezone needs a restart")
+			}
+			switch {
+			case next.FaceAPI.Transport != applied.FaceAPI.Transport || next.FaceAPI.GRPCAddr != applied.FaceAPI.GRPCAddr:
+				slog.Warn("Changing the face service transport or gRPC address needs a restart")
+			case next.FaceAPI.URL != applied.FaceAPI.URL:
+				currentClient.Reconfigure(next.FaceAPI)
+				slog.Info("Face service URL changed", "url", next.FaceAPI.URL)
+			}
+
+			slog.Info("Reloaded config")
+			applied = next
 		}
 	}()
 
@@ -61,36 +624,257 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if grpcServer != nil {
+		grpcService.Close()
+		stopGRPC(ctx, grpcServer)
+	}
+
+	if redirectServer != nil {
+		redirectServer.Shutdown(ctx)
+	}
+
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		fatal("Server forced to shutdown", err)
 	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("Failed to flush traces", "error", err)
+	}
+	reporting.Flush(5 * time.Second)
 
-	log.Println("Server exited")
+	slog.Info("Server exited")
 }
 
-func healthCheck(w http.ResponseWriter, r *http.Request, as *service.AttendanceService) {
+// serverTLS returns the TLS configuration of the API and the handler of its
+// plain HTTP port, which answers ACME HTTP-01 challenges when certificates
+// come from an ACME CA and redirects everything else to HTTPS
+func serverTLS(cfg config.ServerConfig) (*tls.Config, http.Handler, error) {
+	tlsConfig, redirect, err := serverCertificates(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.TLS.ClientCAFile == "" {
+		return tlsConfig, redirect, nil
+	}
+
+	// Only recording attendance insists on a certificate, so browsers and
+	// integrations keep connecting without one
+	bundle, err := os.ReadFile(cfg.TLS.ClientCAFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, nil, fmt.Errorf("no certificates found in %s", cfg.TLS.ClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	slog.Info("Requiring client certificates to record attendance", "ca_file", cfg.TLS.ClientCAFile)
+	return tlsConfig, redirect, nil
+}
+
+// serverCertificates returns the TLS configuration serving the API's own
+// certificate, from disk or from an ACME CA
+func serverCertificates(cfg config.ServerConfig) (*tls.Config, http.Handler, error) {
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if cfg.Port != "443" {
+			host = net.JoinHostPort(host, cfg.Port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+
+	if !cfg.TLS.ACME() {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load certificate: %w", err)
+		}
+		slog.Info("Serving TLS", "cert_file", cfg.TLS.CertFile)
+		return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, redirect, nil
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.TLS.ACMEDomains...),
+		Cache:      autocert.DirCache(cfg.TLS.ACMECacheDir),
+		Email:      cfg.TLS.ACMEEmail,
+	}
+	if cfg.TLS.ACMEDirectory != "" {
+		manager.Client = &acme.Client{DirectoryURL: cfg.TLS.ACMEDirectory}
+	}
+	slog.Info("Serving TLS with ACME certificates", "domains", cfg.TLS.ACMEDomains, "cache_dir", cfg.TLS.ACMECacheDir)
+
+	tlsConfig := manager.TLSConfig()
+	tlsConfig.MinVersion = tls.VersionTLS12
+	return tlsConfig, manager.HTTPHandler(redirect), nil
+}
+
+func newRecognizer(cfg config.FaceAPIConfig, limiter *client.ConcurrencyLimiter) (*client.CachingRecognizer, error) {
+	var recognizer client.Recognizer
+
+	switch cfg.Transport {
+	case "", "http":
+		recognizer = client.NewFaceRecognitionClient(cfg.URL, cfg.Timeout, limiter)
+	case "grpc":
+		slog.Info("Using gRPC face recognition backend", "addr", cfg.GRPCAddr)
+		grpcClient, err := client.NewGRPCFaceClient(cfg.GRPCAddr, cfg.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		recognizer = grpcClient
+	case "fake":
+		slog.Warn("Using the fake face recognizer, for development only")
+		recognizer = client.NewFakeRecognizer()
+	default:
+		return nil, fmt.Errorf("unknown face API transport %q", cfg.Transport)
+	}
+
+	return client.NewCachingRecognizer(recognizer, cfg.ListCacheTTL), nil
+}
+
+// secondaryRecognizer connects to another face service, the candidate of a
+// canary experiment or the target of a switchover, with a concurrency limit
+// of its own so its calls never hold up those to the stable one. It returns
+// nil when cfg has no address.
+func secondaryRecognizer(cfg, stable config.FaceAPIConfig) (client.Recognizer, error) {
+	switch cfg.Transport {
+	case "", "http":
+		if cfg.URL == "" {
+			return nil, nil
+		}
+	case "grpc":
+		if cfg.GRPCAddr == "" {
+			return nil, nil
+		}
+	}
+
+	limiter := client.NewConcurrencyLimiter(stable.MaxConcurrent, stable.MaxQueued, stable.QueueTimeout)
+	recognizer, err := newRecognizer(cfg, limiter)
+	if err != nil {
+		return nil, err
+	}
+	return recognizer, nil
+}
+
+// faceServiceName names a face service by its address
+func faceServiceName(cfg config.FaceAPIConfig) string {
+	if cfg.Transport == "grpc" {
+		return "grpc://" + cfg.GRPCAddr
+	}
+	return strings.TrimSuffix(cfg.URL, "/")
+}
+
+// checkIntegrity runs the startup integrity pass and logs what it found.
+// Problems are logged rather than fatal so the API stays available to fix them.
+func checkIntegrity(checker *service.IntegrityChecker, repair bool) {
+	logger := logging.Component("integrity")
+
+	report, err := checker.Run(context.Background(), repair)
+	if err != nil {
+		logger.Error("Integrity check failed", "error", err)
+		return
+	}
+
+	if len(report.Findings) == 0 {
+		logger.Info("No integrity problems found", "duration", report.Duration)
+		return
+	}
+
+	for _, finding := range report.Findings {
+		logger.Warn(finding.Message, "check", finding.Check, "severity", finding.Severity, "repaired", finding.Repaired)
+	}
+	logger.Warn("Integrity problems found", "problems", len(report.Findings), "repaired", report.Repaired)
+}
+
+func healthCheck(w http.ResponseWriter, r *http.Request, as *service.AttendanceService, rs *service.ReplicationService) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
 	sseStats := as.GetSSEStats()
 
-	fmt.Fprintf(w, `{"status":"ok","service":"Attendance API","sse_clients":%d}`,
-		sseStats["active_clients"])
+	fmt.Fprintf(w, `{"status":"ok","service":"Attendance API","sse_clients":%d,"role":"%s"}`,
+		sseStats.Clients, rs.Role())
+}
+
+// readinessCheck answers 503 until the recognition path has been warmed up,
+// so load balancers hold traffic back from a node whose model is still
+// loading
+func readinessCheck(w http.ResponseWriter, r *http.Request, ws *service.WarmupService) {
+	status := ws.Status()
+
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status.State,
+		"warmup": status,
+	})
+}
+
+// probe answers a liveness or readiness probe with the outcome of each
+// check, and 503 when one failed
+func probe(w http.ResponseWriter, result domain.ProbeResult) {
+	code := http.StatusOK
+	if result.Status != domain.CheckOK {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(result)
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
+// legacyRoutes serves the unversioned /api/... paths of earlier releases
+// as aliases of /api/v1/..., with headers announcing the deprecation and
+// the successor route. Without it they answer 404.
+func legacyRoutes(cfg config.ServerConfig, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		rest, ok := strings.CutPrefix(r.URL.Path, "/api/")
+		if !ok || !cfg.LegacyRoutes || rest == "v1" || strings.HasPrefix(rest, "v1/") {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+		versioned := new(http.Request)
+		*versioned = *r
+		versioned.URL = new(url.URL)
+		*versioned.URL = *r.URL
+		versioned.URL.Path = "/api/v1/" + rest
+		if r.URL.RawPath != "" {
+			versioned.URL.RawPath = "/api/v1" + strings.TrimPrefix(r.URL.RawPath, "/api")
+		}
+
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", versioned.URL.EscapedPath()))
+		if !cfg.LegacySunset.IsZero() {
+			w.Header().Set("Sunset", cfg.LegacySunset.Format(http.TimeFormat))
+		}
+
+		next.ServeHTTP(w, versioned)
+	})
+}
+
+// standbyGuard rejects writes on a standby so devices that were given both
+// endpoints keep using the active node. Reads and promotion stay available.
+func standbyGuard(rs *service.ReplicationService, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+		if !readOnly && rs.IsStandby() && r.URL.Path != "/api/v1/admin/replication/promote" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"success":false,"error":"This node is a standby, send writes to the active node"}`)
 			return
 		}
 
@@ -98,10 +882,341 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// securityEvents reports refused API keys and successful changes made
+// through the API to the SIEM. Recording attendance is not an admin action;
+// its security events come from the attendance service.
+func securityEvents(siem *service.SIEMExporter, next http.Handler) http.Handler {
+	if siem == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		event := domain.SecurityEvent{
+			Actor:    domain.ActorFromContext(r.Context()).String(),
+			SourceIP: remoteIP(r.RemoteAddr),
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Status:   rec.status,
+		}
+
+		switch {
+		case rec.status == http.StatusUnauthorized || rec.status == http.StatusForbidden:
+			event.Type, event.Severity = domain.SecurityAuthFailure, 6
+			event.Message = fmt.Sprintf("%s %s refused", r.Method, r.URL.Path)
+		case middleware.IsAdminAction(r) && rec.status < http.StatusBadRequest:
+			event.Type, event.Severity = domain.SecurityAdminAction, 3
+			event.Message = fmt.Sprintf("%s %s", r.Method, r.URL.Path)
+		default:
+			return
+		}
+
+		siem.Emit(event)
+	})
+}
+
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// statusRecorder remembers the status code a handler wrote, how much it
+// wrote and when the response started
+type statusRecorder struct {
+	http.ResponseWriter
+	status  int
+	bytes   int64
+	started time.Time
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.start()
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	r.start()
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *statusRecorder) start() {
+	if r.started.IsZero() {
+		r.started = time.Now()
+	}
+}
+
+// Flush keeps the event streams working through the recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// FlushError is Flush reporting whether the write reached the client, for
+// http.ResponseController
+func (r *statusRecorder) FlushError() error {
+	return http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController set write deadlines on the stream
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// usageTracking counts the requests of each client for the usage
+// statistics. Latency is the time to the first byte of the response, so
+// event streams count as quick as they start.
+func usageTracking(usage *service.UsageService, next http.Handler) http.Handler {
+	if !usage.Enabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if rec.started.IsZero() {
+			rec.started = time.Now()
+		}
+		usage.Record(domain.ActorFromContext(r.Context()), remoteIP(r.RemoteAddr), rec.status, rec.started.Sub(start))
+	})
+}
+
+// traced starts a span for every request, joining the trace of the device
+// when it sent one. Event and replication streams stay open for hours and
+// are left out, as are the probes and scrapes polled every few seconds.
+func traced(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "HTTP request", otelhttp.WithFilter(func(r *http.Request) bool {
+		switch r.URL.Path {
+		case "/livez", "/readyz", "/metrics":
+			return false
+		}
+		return !strings.HasSuffix(r.URL.Path, "/stream")
+	}))
+}
+
+// routeSpans names the span of a request after the route it matched rather
+// than its path, which may hold names and IDs
+func routeSpans(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			name := pattern
+			if !strings.Contains(pattern, " ") {
+				name = r.Method + " " + pattern
+			}
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(name)
+			span.SetAttributes(semconv.HTTPRoute(pattern))
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// routeTimeouts gives the routes of timeouts a deadline, past which their
+// context is cancelled and the client is answered 503. The response is held
+// back until the handler returns, so routes that stream must not be listed.
+func routeTimeouts(timeouts map[string]time.Duration, mux *http.ServeMux, next http.Handler) http.Handler {
+	if len(timeouts) == 0 {
+		return next
+	}
+
+	handlers := make(map[string]http.Handler, len(timeouts))
+	for route, timeout := range timeouts {
+		handlers[route] = http.TimeoutHandler(next, timeout, `{"success":false,"error":"Request timed out"}`)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		handler, ok := handlers[routePath(pattern)]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// For the timeout answer; handlers that finish set their own
+		w.Header().Set("Content-Type", "application/json")
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// routePath is the path of a mux pattern, without its method
+func routePath(pattern string) string {
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		return path
+	}
+	return pattern
+}
+
+// hasRoute reports whether mux serves route for any method
+func hasRoute(mux *http.ServeMux, route string) bool {
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		if _, pattern := mux.Handler(&http.Request{Method: method, URL: &url.URL{Path: route}}); routePath(pattern) == route {
+			return true
+		}
+	}
+	return false
+}
+
+// requestFields are the fields of the log lines of a request or call: its ID,
+// the caller and, when traced, the trace ID
+func requestFields(ctx context.Context) []any {
+	fields := []any{"request_id", domain.RequestIDFromContext(ctx), "actor", domain.ActorFromContext(ctx).String()}
+	if traceID := tracing.TraceID(ctx); traceID != "" {
+		fields = append(fields, "trace_id", traceID)
+	}
+	return fields
+}
+
+// loggingMiddleware gives every request a logger carrying its ID and the
+// caller, so the lines a request causes can be found together, and writes
+// the access log: a line per request once it has been answered, with its
+// status and response size. Event streams stay open for hours, so they get
+// a line when they open as well.
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		ctx := logging.With(r.Context(), requestFields(r.Context())...)
+		logger := logging.From(ctx).With("method", r.Method, "path", r.URL.Path, "remote_ip", remoteIP(r.RemoteAddr))
+
+		stream := strings.HasSuffix(r.URL.Path, "/stream")
+		if stream {
+			logger.Info("Event stream opened")
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		msg := "HTTP request"
+		if stream {
+			msg = "Event stream closed"
+		}
+		logger.Info(msg, "status", rec.status, "bytes", rec.bytes, "duration", time.Since(start))
+	})
+}
+
+func loggingUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	ctx = logging.With(ctx, requestFields(ctx)...)
+	resp, err := handler(ctx, req)
+	logging.From(ctx).Info("gRPC call", "method", info.FullMethod, "code", status.Code(err).String(), "duration", time.Since(start))
+	return resp, err
+}
+
+func loggingStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	slog.Info("gRPC stream", "method", info.FullMethod, "code", status.Code(err).String(), "actor", domain.ActorFromContext(ss.Context()).String(),
+		"duration", time.Since(start))
+	return err
+}
+
+// recoverPanics answers 500 when a handler panics and logs the panic with
+// the fields of its request, which reports it
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if v := recover(); v != nil {
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				logPanic(r.Context(), v, "method", r.Method, "uri", r.RequestURI)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, `{"success":false,"error":"Internal server error"}`)
+			}
+		}()
 		next.ServeHTTP(w, r)
-		log.Printf("%s %s %s", r.Method, r.RequestURI, time.Since(start))
 	})
 }
+
+func recoverUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			logPanic(ctx, v, "method", info.FullMethod)
+			err = status.Error(codes.Internal, "Internal server error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func recoverStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			logPanic(logging.With(ss.Context(), requestFields(ss.Context())...), v, "method", info.FullMethod)
+			err = status.Error(codes.Internal, "Internal server error")
+		}
+	}()
+	return handler(srv, ss)
+}
+
+func logPanic(ctx context.Context, v any, args ...any) {
+	args = append(args, "error", fmt.Errorf("panic: %v", v), "stack", string(debug.Stack()))
+	logging.From(ctx).Error("Handler panicked", args...)
+}
+
+// fatal logs why the server cannot run and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	reporting.Flush(5 * time.Second)
+	os.Exit(1)
+}
+
+// securityUnaryInterceptor reports calls refused for their API key to the
+// SIEM. It runs before the calls are identified, so the event names no actor.
+func securityUnaryInterceptor(siem *service.SIEMExporter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		reportGRPCAuthFailure(siem, ctx, info.FullMethod, err)
+		return resp, err
+	}
+}
+
+func securityStreamInterceptor(siem *service.SIEMExporter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		reportGRPCAuthFailure(siem, ss.Context(), info.FullMethod, err)
+		return err
+	}
+}
+
+func reportGRPCAuthFailure(siem *service.SIEMExporter, ctx context.Context, method string, err error) {
+	code := status.Code(err)
+	if code != codes.Unauthenticated && code != codes.PermissionDenied {
+		return
+	}
+
+	event := domain.SecurityEvent{
+		Type:     domain.SecurityAuthFailure,
+		Severity: 6,
+		Message:  fmt.Sprintf("%s refused: %s", method, code),
+		Path:     method,
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		event.SourceIP = remoteIP(p.Addr.String())
+	}
+	siem.Emit(event)
+}
+
+// stopGRPC lets calls in flight finish, cutting them off once ctx expires
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		server.Stop()
+	}
+}
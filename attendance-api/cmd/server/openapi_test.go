@@ -0,0 +1,275 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"attendance-api/api"
+
+	"gopkg.in/yaml.v3"
+)
+
+// specMethods are the operations of an OpenAPI path item
+var specMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+var pathParam = regexp.MustCompile(`\{[^}]*\}`)
+
+// The hand-written specification describes every route registered on the
+// mux, with each method its handler accepts, and nothing else
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]yaml.Node `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(api.OpenAPI, &spec); err != nil {
+		t.Fatal(err)
+	}
+	documented := map[string][]string{}
+	for path, item := range spec.Paths {
+		path = pathParam.ReplaceAllString(path, "{}")
+		for method := range item {
+			if method = strings.ToUpper(method); slices.Contains(specMethods, method) {
+				documented[path] = append(documented[path], method)
+			}
+		}
+	}
+
+	routes := registeredRoutes(t)
+	if len(routes) == 0 {
+		t.Fatal("no routes found in main.go")
+	}
+
+	for path, methods := range routes {
+		if documented[path] == nil {
+			t.Errorf("%s is not in api/openapi.yaml", path)
+			continue
+		}
+		// A handler without method checks serves whatever is documented
+		for _, method := range methods {
+			if !slices.Contains(documented[path], method) {
+				t.Errorf("%s %s is not in api/openapi.yaml", method, path)
+			}
+		}
+	}
+	for path, methods := range documented {
+		if _, ok := routes[path]; !ok {
+			t.Errorf("api/openapi.yaml describes %s, which has no route", path)
+			continue
+		}
+		for _, method := range methods {
+			if accepted := routes[path]; accepted != nil && !slices.Contains(accepted, method) {
+				t.Errorf("api/openapi.yaml describes %s %s, which its handler does not accept", method, path)
+			}
+		}
+	}
+}
+
+// registeredRoutes reads the mux.HandleFunc calls of main.go and returns the
+// methods of every path, with path parameters as {}. Patterns without a
+// method get the methods their handler compares r.Method with; a path is
+// nil when its handler accepts any method.
+func registeredRoutes(t *testing.T) map[string][]string {
+	t.Helper()
+
+	fset := token.NewFileSet()
+	main, err := parser.ParseFile(fset, "main.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers := parseHandlers(t, fset)
+
+	// Variables holding handlers, by the type their constructor returns
+	types := map[string]string{}
+	ast.Inspect(main, func(n ast.Node) bool {
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok || len(assign.Rhs) != 1 {
+			return true
+		}
+		call, ok := assign.Rhs[0].(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if pkg, name := selector(call.Fun); pkg == "handler" {
+			if typ, ok := handlers.constructors[name]; ok {
+				types[assign.Lhs[0].(*ast.Ident).Name] = typ
+			}
+		}
+		return true
+	})
+
+	routes := map[string][]string{}
+	ast.Inspect(main, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 2 {
+			return true
+		}
+		if recv, name := selector(call.Fun); recv != "mux" || (name != "HandleFunc" && name != "Handle") {
+			return true
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok {
+			t.Errorf("%s: route pattern is not a literal", fset.Position(call.Pos()))
+			return true
+		}
+		pattern, _ := strconv.Unquote(lit.Value)
+
+		method, path, ok := strings.Cut(pattern, " ")
+		if !ok {
+			method, path = "", pattern
+		}
+		path = pathParam.ReplaceAllString(path, "{}")
+
+		var methods []string
+		if method != "" {
+			methods = []string{method}
+		} else {
+			methods = handlers.methods(types, call.Args[1])
+		}
+		if current, seen := routes[path]; seen && current == nil {
+			return true
+		}
+		if methods == nil {
+			routes[path] = nil
+			return true
+		}
+		for _, method := range methods {
+			if !slices.Contains(routes[path], method) {
+				routes[path] = append(routes[path], method)
+			}
+		}
+		return true
+	})
+	return routes
+}
+
+type handlerSource struct {
+	constructors map[string]string                   // constructor name to the type it returns
+	funcs        map[string]map[string]*ast.FuncDecl // methods by receiver type and name
+}
+
+func parseHandlers(t *testing.T, fset *token.FileSet) *handlerSource {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join("..", "..", "internal", "handler", "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &handlerSource{constructors: map[string]string{}, funcs: map[string]map[string]*ast.FuncDecl{}}
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			if fn.Recv == nil {
+				if fn.Type.Results != nil && len(fn.Type.Results.List) > 0 {
+					if star, ok := fn.Type.Results.List[0].Type.(*ast.StarExpr); ok {
+						if ident, ok := star.X.(*ast.Ident); ok {
+							src.constructors[fn.Name.Name] = ident.Name
+						}
+					}
+				}
+				continue
+			}
+			recv := fn.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			typ := recv.(*ast.Ident).Name
+			if src.funcs[typ] == nil {
+				src.funcs[typ] = map[string]*ast.FuncDecl{}
+			}
+			src.funcs[typ][fn.Name.Name] = fn
+		}
+	}
+	return src
+}
+
+// methods returns the methods the handler of a route accepts, looking
+// through the auth wrappers to the handler method, or nil when it does not
+// check the method
+func (s *handlerSource) methods(types map[string]string, expr ast.Expr) []string {
+	for {
+		call, ok := expr.(*ast.CallExpr)
+		if !ok {
+			break
+		}
+		expr = call.Args[len(call.Args)-1]
+	}
+	recv, name := selector(expr)
+	typ, ok := types[recv]
+	if !ok {
+		return nil
+	}
+
+	var (
+		methods []string
+		visit   func(fn *ast.FuncDecl)
+		visited = map[string]bool{}
+	)
+	add := func(expr ast.Expr) {
+		if pkg, name := selector(expr); pkg == "http" && strings.HasPrefix(name, "Method") {
+			method := strings.ToUpper(strings.TrimPrefix(name, "Method"))
+			if slices.Contains(specMethods, method) && !slices.Contains(methods, method) {
+				methods = append(methods, method)
+			}
+		}
+	}
+	visit = func(fn *ast.FuncDecl) {
+		if fn == nil || visited[fn.Name.Name] {
+			return
+		}
+		visited[fn.Name.Name] = true
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SwitchStmt:
+				if _, field := selector(n.Tag); field == "Method" {
+					for _, clause := range n.Body.List {
+						for _, value := range clause.(*ast.CaseClause).List {
+							add(value)
+						}
+					}
+				}
+			case *ast.BinaryExpr:
+				if n.Op == token.EQL || n.Op == token.NEQ {
+					if _, field := selector(n.X); field == "Method" {
+						add(n.Y)
+					}
+				}
+			case *ast.CallExpr:
+				// Handlers handing a method to another one of theirs
+				if recv, name := selector(n.Fun); recv == fn.Recv.List[0].Names[0].Name {
+					visit(s.funcs[typ][name])
+				}
+			}
+			return true
+		})
+	}
+	visit(s.funcs[typ][name])
+	return methods
+}
+
+// selector splits x.name, or returns empty strings for other expressions
+func selector(expr ast.Expr) (string, string) {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return "", ""
+	}
+	if ident, ok := sel.X.(*ast.Ident); ok {
+		return ident.Name, sel.Sel.Name
+	}
+	return "", sel.Sel.Name
+}
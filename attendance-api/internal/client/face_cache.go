@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+)
+
+// CachingRecognizer keeps the list of enrolled people for a short time so
+// paging through a large list does not fetch it from the face service for
+// every page. Enrolling or reloading faces drops the cached list.
+type CachingRecognizer struct {
+	Recognizer
+
+	ttl time.Duration
+
+	mu      sync.RWMutex
+	faces   []domain.Face
+	expires time.Time
+}
+
+func NewCachingRecognizer(next Recognizer, ttl time.Duration) *CachingRecognizer {
+	return &CachingRecognizer{
+		Recognizer: next,
+		ttl:        ttl,
+	}
+}
+
+func (c *CachingRecognizer) GetFaces(ctx context.Context) ([]domain.Face, error) {
+	if faces, ok := c.cached(); ok {
+		return faces, nil
+	}
+
+	faces := []domain.Face{}
+	err := c.StreamFaces(ctx, func(face domain.Face) error {
+		faces = append(faces, face)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return faces, nil
+}
+
+// StreamFaces replays the cached list when it is fresh. Otherwise it streams
+// from the face service, passing each person on as it arrives, and caches
+// the list once it has been read completely.
+func (c *CachingRecognizer) StreamFaces(ctx context.Context, fn func(domain.Face) error) error {
+	if faces, ok := c.cached(); ok {
+		for _, face := range faces {
+			if err := fn(face); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var faces []domain.Face
+	err := c.Recognizer.StreamFaces(ctx, func(face domain.Face) error {
+		if c.ttl > 0 {
+			faces = append(faces, face)
+		}
+		return fn(face)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.store(faces)
+	return nil
+}
+
+func (c *CachingRecognizer) AddFace(ctx context.Context, name string, images [][]byte, filenames []string) (*domain.EnrollmentResult, error) {
+	defer c.Invalidate()
+	return c.Recognizer.AddFace(ctx, name, images, filenames)
+}
+
+func (c *CachingRecognizer) RemoveFace(ctx context.Context, name string) (int, error) {
+	defer c.Invalidate()
+	return c.Recognizer.RemoveFace(ctx, name)
+}
+
+func (c *CachingRecognizer) MergeFaces(ctx context.Context, source, target string, files []string) ([]domain.ImageMove, error) {
+	defer c.Invalidate()
+	return c.Recognizer.MergeFaces(ctx, source, target, files)
+}
+
+func (c *CachingRecognizer) ReloadFaces(ctx context.Context) error {
+	defer c.Invalidate()
+	return c.Recognizer.ReloadFaces(ctx)
+}
+
+// Reconfigure passes cfg on to the client behind the cache, when it can
+// change its settings, and drops the cached list, which may be that of
+// another face service
+func (c *CachingRecognizer) Reconfigure(cfg config.FaceAPIConfig) {
+	if next, ok := c.Recognizer.(interface{ Reconfigure(config.FaceAPIConfig) }); ok {
+		next.Reconfigure(cfg)
+	}
+	c.Invalidate()
+}
+
+// Invalidate drops the cached list
+func (c *CachingRecognizer) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.faces = nil
+	c.expires = time.Time{}
+}
+
+func (c *CachingRecognizer) cached() ([]domain.Face, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.faces == nil || time.Now().After(c.expires) {
+		return nil, false
+	}
+	return c.faces, true
+}
+
+func (c *CachingRecognizer) store(faces []domain.Face) {
+	if c.ttl <= 0 {
+		return
+	}
+	if faces == nil {
+		faces = []domain.Face{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.faces = faces
+	c.expires = time.Now().Add(c.ttl)
+}
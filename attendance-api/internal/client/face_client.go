@@ -1,7 +1,9 @@
 package client
 
 import (
+	"attendance-api/internal/config"
 	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -9,53 +11,151 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/url"
+	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 type FaceRecognitionClient struct {
-	baseURL    string
+	baseURL    atomic.Pointer[string] // changed by Reconfigure
 	httpClient *http.Client
+	limiter    *ConcurrencyLimiter
 }
 
-func NewFaceRecognitionClient(baseURL string, timeout time.Duration) *FaceRecognitionClient {
-	return &FaceRecognitionClient{
-		baseURL: baseURL,
+// NewFaceRecognitionClient returns a client for the face service at baseURL.
+// A nil limiter does not bound concurrent calls.
+func NewFaceRecognitionClient(baseURL string, timeout time.Duration, limiter *ConcurrencyLimiter) *FaceRecognitionClient {
+	c := &FaceRecognitionClient{
 		httpClient: &http.Client{
 			Timeout: timeout,
+			// Spans each call and passes the trace on to the face service
+			Transport: otelhttp.NewTransport(http.DefaultTransport,
+				otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+					return "face " + r.Method + " " + r.URL.Path
+				})),
 		},
+		limiter: limiter,
+	}
+	c.baseURL.Store(&baseURL)
+	return c
+}
+
+// Reconfigure sends the calls still to come to the face service URL of cfg
+func (c *FaceRecognitionClient) Reconfigure(cfg config.FaceAPIConfig) {
+	c.baseURL.Store(&cfg.URL)
+}
+
+// endpoint is the URL of path at the face service
+func (c *FaceRecognitionClient) endpoint(path string) string {
+	return *c.baseURL.Load() + path
+}
+
+// do sends a request once the limiter has a free slot, with the ID of the
+// request it serves. The slot is held until the response body is closed.
+func (c *FaceRecognitionClient) do(req *http.Request) (*http.Response, error) {
+	if id := domain.RequestIDFromContext(req.Context()); id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+
+	release, err := c.limiter.Acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		release()
+		return nil, err
 	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
 }
 
 func (c *FaceRecognitionClient) GetFaces(ctx context.Context) ([]domain.Face, error) {
-	url := c.baseURL + "/faces"
-	fmt.Printf("DEBUG: Calling face API at: %s\n", url)
+	faces := []domain.Face{}
+	err := c.StreamFaces(ctx, func(face domain.Face) error {
+		faces = append(faces, face)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return faces, nil
+}
+
+// StreamFaces walks the "people" array of the GET /faces response one
+// element at a time instead of decoding the whole document
+func (c *FaceRecognitionClient) StreamFaces(ctx context.Context, fn func(domain.Face) error) error {
+	url := c.endpoint("/faces")
+	logging.From(ctx).Debug("Calling face API", "url", url)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get faces: %w", err)
+		return fmt.Errorf("failed to get faces: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
 	}
 
-	var result struct {
-		Success bool          `json:"success"`
-		People  []domain.Face `json:"people"`
+	dec := json.NewDecoder(resp.Body)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+
+		if key, _ := token.(string); key != "people" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("failed to decode response: %w", err)
+			}
+			continue
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return err
+		}
+		for dec.More() {
+			var face domain.Face
+			if err := dec.Decode(&face); err != nil {
+				return fmt.Errorf("failed to decode face: %w", err)
+			}
+			if err := fn(face); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return err
+		}
 	}
 
-	return result.People, nil
+	return nil
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("failed to decode response: expected %q, got %v", want, token)
+	}
+	return nil
 }
 
 func (c *FaceRecognitionClient) RecognizeFace(ctx context.Context, imageData []byte, filename string) (*domain.RecognitionResult, error) {
@@ -75,13 +175,13 @@ func (c *FaceRecognitionClient) RecognizeFace(ctx context.Context, imageData []b
 		return nil, fmt.Errorf("failed to close writer: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/recognize", body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint("/recognize"), body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to recognize face: %w", err)
 	}
@@ -97,65 +197,231 @@ func (c *FaceRecognitionClient) RecognizeFace(ctx context.Context, imageData []b
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	// DEBUG: Log what we received
-	fmt.Printf("DEBUG: Recognition result - Success: %v, Faces: %d\n", result.Success, result.FacesDetected)
+	logger := logging.From(ctx)
+	logger.Debug("Recognition result", "success", result.Success, "faces", result.FacesDetected)
 	if len(result.Faces) > 0 {
-		fmt.Printf("DEBUG: First face - Name: %s, Confidence: %.2f\n", result.Faces[0].Name, result.Faces[0].Confidence)
+		logger.Debug("First face", "person", result.Faces[0].Name, "confidence", result.Faces[0].Confidence)
 	}
 
 	return &result, nil
 }
 
-func (c *FaceRecognitionClient) AddFace(ctx context.Context, name string, images [][]byte, filenames []string) error {
+// addFaceResponse is the body of /faces/add. Older face services only list
+// the stored file name of added images, without the submitted one.
+type addFaceResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Files   []struct {
+		File     string `json:"file"`
+		Filename string `json:"filename"`
+	} `json:"files"`
+	Errors []struct {
+		File  string `json:"file"`
+		Error string `json:"error"`
+	} `json:"errors"`
+}
+
+func (c *FaceRecognitionClient) AddFace(ctx context.Context, name string, images [][]byte, filenames []string) (*domain.EnrollmentResult, error) {
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 
 	if err := writer.WriteField("name", name); err != nil {
-		return fmt.Errorf("failed to write name field: %w", err)
+		return nil, fmt.Errorf("failed to write name field: %w", err)
 	}
 
 	for i, imageData := range images {
 		part, err := writer.CreateFormFile("images", filenames[i])
 		if err != nil {
-			return fmt.Errorf("failed to create form file: %w", err)
+			return nil, fmt.Errorf("failed to create form file: %w", err)
 		}
 
 		if _, err := part.Write(imageData); err != nil {
-			return fmt.Errorf("failed to write image data: %w", err)
+			return nil, fmt.Errorf("failed to write image data: %w", err)
 		}
 	}
 
 	if err := writer.Close(); err != nil {
-		return fmt.Errorf("failed to close writer: %w", err)
+		return nil, fmt.Errorf("failed to close writer: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/faces/add", body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint("/faces/add"), body)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return fmt.Errorf("failed to add face: %w", err)
+		return nil, fmt.Errorf("failed to add face: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var parsed addFaceResponse
+	parseErr := json.Unmarshal(bodyBytes, &parsed)
+
+	// A 400 listing per-image errors means every image was rejected; any
+	// other failure says nothing about the individual images
+	rejected := resp.StatusCode == http.StatusBadRequest && parseErr == nil && len(parsed.Errors) > 0
+	if resp.StatusCode != http.StatusCreated && !rejected {
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+	if parseErr != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", parseErr)
+	}
+
+	return enrollmentResult(name, filenames, &parsed, resp.StatusCode == http.StatusCreated), nil
+}
+
+// enrollmentResult matches the images listed by the face service to the
+// submitted ones by file name, in order, so repeated names are matched one
+// by one. Images it does not mention share the outcome of the request.
+func enrollmentResult(name string, filenames []string, resp *addFaceResponse, created bool) *domain.EnrollmentResult {
+	result := &domain.EnrollmentResult{Name: name, Images: make([]domain.EnrollmentImage, len(filenames))}
+	matched := make([]bool, len(filenames))
+
+	match := func(file string) int {
+		for i, filename := range filenames {
+			if !matched[i] && filename == file {
+				matched[i] = true
+				return i
+			}
+		}
+		return -1
+	}
+
+	for _, e := range resp.Errors {
+		if i := match(e.File); i >= 0 {
+			result.Images[i] = domain.EnrollmentImage{Filename: filenames[i], Error: e.Error}
+		}
+	}
+	for _, f := range resp.Files {
+		if i := match(f.File); i >= 0 {
+			result.Images[i] = domain.EnrollmentImage{Filename: filenames[i], Added: true, StoredAs: f.Filename}
+		}
+	}
+
+	for i, filename := range filenames {
+		if matched[i] {
+			continue
+		}
+		result.Images[i] = domain.EnrollmentImage{Filename: filename, Added: created}
+		if !created {
+			result.Images[i].Error = resp.Message
+		}
+	}
+
+	result.Tally()
+	return result
+}
+
+func (c *FaceRecognitionClient) RemoveFace(ctx context.Context, name string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.endpoint("/faces/"+url.PathEscape(name)), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove face: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, ErrFaceNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(bodyBytes))
+		return 0, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(bodyBytes))
 	}
 
-	return nil
+	var result struct {
+		ImagesRemoved int `json:"images_removed"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result.ImagesRemoved, nil
+}
+
+func (c *FaceRecognitionClient) MergeFaces(ctx context.Context, source, target string, files []string) ([]domain.ImageMove, error) {
+	body, err := json.Marshal(map[string]interface{}{"source": source, "target": target, "files": files})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint("/faces/merge"), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge faces: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrFaceNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var result struct {
+		Files []domain.ImageMove `json:"files"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result.Files, nil
+}
+
+func (c *FaceRecognitionClient) ListFaceImages(ctx context.Context, name string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint("/faces/"+url.PathEscape(name)+"/images"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list face images: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrFaceNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var result struct {
+		Files []string `json:"files"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result.Files, nil
 }
 
 func (c *FaceRecognitionClient) ReloadFaces(ctx context.Context) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/faces/reload", nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint("/faces/reload"), nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("failed to reload faces: %w", err)
 	}
@@ -168,3 +434,30 @@ func (c *FaceRecognitionClient) ReloadFaces(ctx context.Context) error {
 
 	return nil
 }
+
+// Health calls /health directly rather than through the limiter, so a busy
+// face service is not mistaken for a dead one
+func (c *FaceRecognitionClient) Health(ctx context.Context) (*domain.FaceServiceHealth, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint("/health"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check health: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var health domain.FaceServiceHealth
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &health, nil
+}
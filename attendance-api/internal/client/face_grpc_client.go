@@ -0,0 +1,233 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/pb/facev1"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCFaceClient talks to a recognizer exposing the face.v1.FaceRecognizer
+// service (see api/proto/face/v1/recognizer.proto)
+type GRPCFaceClient struct {
+	conn    *grpc.ClientConn
+	client  facev1.FaceRecognizerClient
+	timeout time.Duration
+}
+
+func NewGRPCFaceClient(addr string, timeout time.Duration) (*GRPCFaceClient, error) {
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		grpc.WithUnaryInterceptor(sendRequestID),
+		grpc.WithStreamInterceptor(streamRequestID),
+		grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(64<<20), grpc.MaxCallRecvMsgSize(64<<20)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create grpc connection: %w", err)
+	}
+
+	return &GRPCFaceClient{
+		conn:    conn,
+		client:  facev1.NewFaceRecognizerClient(conn),
+		timeout: timeout,
+	}, nil
+}
+
+// sendRequestID passes the ID of the request a call serves on to the
+// recognizer as x-request-id metadata
+func sendRequestID(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(withRequestID(ctx), method, req, reply, cc, opts...)
+}
+
+// streamRequestID is sendRequestID for streaming calls
+func streamRequestID(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(withRequestID(ctx), desc, cc, method, opts...)
+}
+
+func withRequestID(ctx context.Context) context.Context {
+	if id := domain.RequestIDFromContext(ctx); id != "" {
+		return metadata.AppendToOutgoingContext(ctx, "x-request-id", id)
+	}
+	return ctx
+}
+
+func (c *GRPCFaceClient) Close() error {
+	return c.conn.Close()
+}
+
+func (c *GRPCFaceClient) GetFaces(ctx context.Context) ([]domain.Face, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	resp, err := c.client.ListFaces(ctx, &facev1.ListFacesRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get faces: %w", err)
+	}
+
+	faces := make([]domain.Face, 0, len(resp.GetPeople()))
+	for _, p := range resp.GetPeople() {
+		faces = append(faces, domain.Face{
+			Name:   p.GetName(),
+			Images: int(p.GetImages()),
+		})
+	}
+
+	return faces, nil
+}
+
+// StreamFaces uses the streaming RPC and falls back to ListFaces for
+// recognizers that do not implement it
+func (c *GRPCFaceClient) StreamFaces(ctx context.Context, fn func(domain.Face) error) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	stream, err := c.client.StreamFaces(ctx, &facev1.ListFacesRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to stream faces: %w", err)
+	}
+
+	first := true
+	for {
+		p, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if first && status.Code(err) == codes.Unimplemented {
+			return c.listFaces(ctx, fn)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to stream faces: %w", err)
+		}
+		first = false
+
+		if err := fn(domain.Face{Name: p.GetName(), Images: int(p.GetImages())}); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *GRPCFaceClient) listFaces(ctx context.Context, fn func(domain.Face) error) error {
+	faces, err := c.GetFaces(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, face := range faces {
+		if err := fn(face); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *GRPCFaceClient) RecognizeFace(ctx context.Context, imageData []byte, filename string) (*domain.RecognitionResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	resp, err := c.client.Recognize(ctx, &facev1.RecognizeRequest{
+		Image:    imageData,
+		Filename: filename,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to recognize face: %w", err)
+	}
+
+	result := &domain.RecognitionResult{
+		Success:       resp.GetSuccess(),
+		FacesDetected: int(resp.GetFacesDetected()),
+		Faces:         make([]domain.RecognizedFace, 0, len(resp.GetFaces())),
+	}
+	for _, f := range resp.GetFaces() {
+		loc := f.GetLocation()
+		result.Faces = append(result.Faces, domain.RecognizedFace{
+			Name:       f.GetName(),
+			Confidence: f.GetConfidence(),
+			Location: domain.FaceLocation{
+				Top:    int(loc.GetTop()),
+				Right:  int(loc.GetRight()),
+				Bottom: int(loc.GetBottom()),
+				Left:   int(loc.GetLeft()),
+			},
+		})
+	}
+
+	return result, nil
+}
+
+// AddFace enrolls images of a person. The gRPC service only reports on the
+// enrollment as a whole, so all images share its outcome.
+func (c *GRPCFaceClient) AddFace(ctx context.Context, name string, images [][]byte, filenames []string) (*domain.EnrollmentResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req := &facev1.AddFaceRequest{Name: name}
+	for i, data := range images {
+		req.Images = append(req.Images, &facev1.Image{
+			Filename: filenames[i],
+			Data:     data,
+		})
+	}
+
+	resp, err := c.client.AddFace(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add face: %w", err)
+	}
+
+	result := &domain.EnrollmentResult{Name: name, Images: make([]domain.EnrollmentImage, len(filenames))}
+	for i, filename := range filenames {
+		result.Images[i] = domain.EnrollmentImage{Filename: filename, Added: resp.GetSuccess()}
+		if !resp.GetSuccess() {
+			result.Images[i].Error = resp.GetMessage()
+		}
+	}
+	result.Tally()
+
+	return result, nil
+}
+
+// RemoveFace is not part of the face.v1 service
+func (c *GRPCFaceClient) RemoveFace(ctx context.Context, name string) (int, error) {
+	return 0, ErrUnsupported
+}
+
+// MergeFaces is not part of the face.v1 service
+func (c *GRPCFaceClient) MergeFaces(ctx context.Context, source, target string, files []string) ([]domain.ImageMove, error) {
+	return nil, ErrUnsupported
+}
+
+// ListFaceImages is not part of the face.v1 service
+func (c *GRPCFaceClient) ListFaceImages(ctx context.Context, name string) ([]string, error) {
+	return nil, ErrUnsupported
+}
+
+// Health is not part of the face.v1 service
+func (c *GRPCFaceClient) Health(ctx context.Context) (*domain.FaceServiceHealth, error) {
+	return nil, ErrUnsupported
+}
+
+func (c *GRPCFaceClient) ReloadFaces(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	resp, err := c.client.ReloadFaces(ctx, &facev1.ReloadFacesRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to reload faces: %w", err)
+	}
+	if !resp.GetSuccess() {
+		return fmt.Errorf("face service failed to reload faces")
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"attendance-api/internal/domain"
+)
+
+// FakeRecognizer stands in for the face service in development. It keeps
+// enrolled images in memory and recognizes a person only in a byte-for-byte
+// copy of one of their images, so any photo enrolled can be used to record
+// attendance. Nothing survives a restart.
+type FakeRecognizer struct {
+	mu        sync.Mutex
+	people    map[string][]fakeImage
+	startedAt time.Time
+}
+
+type fakeImage struct {
+	file string
+	sum  [sha256.Size]byte
+}
+
+func NewFakeRecognizer() *FakeRecognizer {
+	return &FakeRecognizer{people: make(map[string][]fakeImage), startedAt: time.Now()}
+}
+
+func (f *FakeRecognizer) GetFaces(ctx context.Context) ([]domain.Face, error) {
+	var faces []domain.Face
+	err := f.StreamFaces(ctx, func(face domain.Face) error {
+		faces = append(faces, face)
+		return nil
+	})
+	return faces, err
+}
+
+func (f *FakeRecognizer) StreamFaces(ctx context.Context, fn func(domain.Face) error) error {
+	f.mu.Lock()
+	faces := make([]domain.Face, 0, len(f.people))
+	for name, images := range f.people {
+		faces = append(faces, domain.Face{Name: name, Images: len(images)})
+	}
+	f.mu.Unlock()
+
+	slices.SortFunc(faces, func(a, b domain.Face) int { return strings.Compare(a.Name, b.Name) })
+	for _, face := range faces {
+		if err := fn(face); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FakeRecognizer) RecognizeFace(ctx context.Context, imageData []byte, filename string) (*domain.RecognitionResult, error) {
+	if len(imageData) == 0 {
+		return &domain.RecognitionResult{Success: true}, nil
+	}
+
+	sum := sha256.Sum256(imageData)
+	face := domain.RecognizedFace{Name: "Unknown", Location: domain.FaceLocation{Right: 100, Bottom: 100}}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for name, images := range f.people {
+		if slices.ContainsFunc(images, func(image fakeImage) bool { return image.sum == sum }) {
+			face.Name = name
+			face.Confidence = 100
+			break
+		}
+	}
+	return &domain.RecognitionResult{Success: true, FacesDetected: 1, Faces: []domain.RecognizedFace{face}}, nil
+}
+
+func (f *FakeRecognizer) AddFace(ctx context.Context, name string, images [][]byte, filenames []string) (*domain.EnrollmentResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := &domain.EnrollmentResult{Name: name, Images: make([]domain.EnrollmentImage, len(images))}
+	for i, data := range images {
+		file := f.storedName(name, filenames[i])
+		f.people[name] = append(f.people[name], fakeImage{file: file, sum: sha256.Sum256(data)})
+		result.Images[i] = domain.EnrollmentImage{Filename: filenames[i], Added: true, StoredAs: file}
+	}
+	result.Tally()
+	return result, nil
+}
+
+// storedName names an image of name the way the face service does, after
+// the person and numbered so that it is unique
+func (f *FakeRecognizer) storedName(name, filename string) string {
+	ext := filepath.Ext(filename)
+	if ext == "" {
+		ext = ".jpg"
+	}
+	for n := len(f.people[name]) + 1; ; n++ {
+		file := fmt.Sprintf("%s_%d%s", name, n, ext)
+		if !slices.ContainsFunc(f.people[name], func(image fakeImage) bool { return image.file == file }) {
+			return file
+		}
+	}
+}
+
+func (f *FakeRecognizer) RemoveFace(ctx context.Context, name string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	images, ok := f.people[name]
+	if !ok {
+		return 0, ErrFaceNotFound
+	}
+	delete(f.people, name)
+	return len(images), nil
+}
+
+func (f *FakeRecognizer) MergeFaces(ctx context.Context, source, target string, files []string) ([]domain.ImageMove, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	images, ok := f.people[source]
+	if !ok {
+		return nil, ErrFaceNotFound
+	}
+
+	var moves []domain.ImageMove
+	var kept []fakeImage
+	for _, image := range images {
+		if len(files) > 0 && !slices.Contains(files, image.file) {
+			kept = append(kept, image)
+			continue
+		}
+		moved := fakeImage{file: f.storedName(target, image.file), sum: image.sum}
+		f.people[target] = append(f.people[target], moved)
+		moves = append(moves, domain.ImageMove{From: image.file, To: moved.file})
+	}
+	if len(kept) == 0 {
+		delete(f.people, source)
+	} else {
+		f.people[source] = kept
+	}
+	return moves, nil
+}
+
+func (f *FakeRecognizer) ListFaceImages(ctx context.Context, name string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	images, ok := f.people[name]
+	if !ok {
+		return nil, ErrFaceNotFound
+	}
+	files := make([]string, len(images))
+	for i, image := range images {
+		files[i] = image.file
+	}
+	return files, nil
+}
+
+func (f *FakeRecognizer) ReloadFaces(ctx context.Context) error {
+	return nil
+}
+
+func (f *FakeRecognizer) Health(ctx context.Context) (*domain.FaceServiceHealth, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return &domain.FaceServiceHealth{Status: "healthy", KnownFaces: len(f.people), StartedAt: f.startedAt}, nil
+}
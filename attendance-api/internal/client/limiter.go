@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"attendance-api/internal/domain"
+)
+
+// ErrFaceServiceBusy is returned when a call waited too long for a free
+// slot, or found the queue full
+var ErrFaceServiceBusy = errors.New("face service busy")
+
+// ConcurrencyLimiter bounds the calls in flight to the face service, which
+// falls over when it gets too many at once. Calls beyond the limit wait in
+// a queue of bounded length for at most the queue timeout.
+type ConcurrencyLimiter struct {
+	slots        chan struct{}
+	maxQueued    int
+	queueTimeout time.Duration
+
+	mu        sync.Mutex
+	queued    int
+	peakQueue int
+	acquired  int64
+	rejected  int64
+	timedOut  int64
+	waitTotal time.Duration
+	waitMax   time.Duration
+}
+
+// NewConcurrencyLimiter returns a limiter for limit concurrent calls, or nil
+// (no limit) when limit is not positive. maxQueued of zero queues without
+// bound.
+func NewConcurrencyLimiter(limit, maxQueued int, queueTimeout time.Duration) *ConcurrencyLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &ConcurrencyLimiter{
+		slots:        make(chan struct{}, limit),
+		maxQueued:    maxQueued,
+		queueTimeout: queueTimeout,
+	}
+}
+
+// Acquire waits for a slot and returns the function that frees it
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		l.record(0)
+		return l.release, nil
+	default:
+	}
+
+	l.mu.Lock()
+	if l.maxQueued > 0 && l.queued >= l.maxQueued {
+		l.rejected++
+		l.mu.Unlock()
+		return nil, ErrFaceServiceBusy
+	}
+	l.queued++
+	l.peakQueue = max(l.peakQueue, l.queued)
+	l.mu.Unlock()
+
+	start := time.Now()
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		l.dequeue()
+		l.record(time.Since(start))
+		return l.release, nil
+	case <-timeout:
+		l.dequeue()
+		l.mu.Lock()
+		l.timedOut++
+		l.mu.Unlock()
+		return nil, ErrFaceServiceBusy
+	case <-ctx.Done():
+		l.dequeue()
+		return nil, ctx.Err()
+	}
+}
+
+func (l *ConcurrencyLimiter) release() {
+	<-l.slots
+}
+
+func (l *ConcurrencyLimiter) dequeue() {
+	l.mu.Lock()
+	l.queued--
+	l.mu.Unlock()
+}
+
+func (l *ConcurrencyLimiter) record(wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.acquired++
+	l.waitTotal += wait
+	l.waitMax = max(l.waitMax, wait)
+}
+
+// Stats reports the current queue depth and the waits so far; nil reports
+// an unlimited client
+func (l *ConcurrencyLimiter) Stats() domain.LimiterStats {
+	if l == nil {
+		return domain.LimiterStats{}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := domain.LimiterStats{
+		Enabled:      true,
+		Limit:        cap(l.slots),
+		InFlight:     len(l.slots),
+		Queued:       l.queued,
+		MaxQueued:    l.maxQueued,
+		PeakQueued:   l.peakQueue,
+		Acquired:     l.acquired,
+		Rejected:     l.rejected,
+		TimedOut:     l.timedOut,
+		WaitTotalMs:  l.waitTotal.Milliseconds(),
+		WaitMaxMs:    l.waitMax.Milliseconds(),
+		QueueTimeout: l.queueTimeout.String(),
+	}
+	if l.acquired > 0 {
+		stats.WaitAverageMs = float64(l.waitTotal.Microseconds()) / float64(l.acquired) / 1000
+	}
+	return stats
+}
+
+// releasingBody frees the limiter slot of a call once its response body is
+// closed, so a streamed response keeps the slot while it is read
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+	"errors"
+
+	"attendance-api/internal/domain"
+)
+
+var (
+	ErrFaceNotFound = errors.New("face not found")
+	ErrUnsupported  = errors.New("not supported by the face backend")
+)
+
+// Recognizer is the face recognition backend used by the attendance API.
+// FaceRecognitionClient talks to it over HTTP multipart, GRPCFaceClient over
+// gRPC.
+type Recognizer interface {
+	GetFaces(ctx context.Context) ([]domain.Face, error)
+	// StreamFaces calls fn for every enrolled person as they are read, so
+	// very large lists never have to be held in memory at once. Returning an
+	// error from fn stops the stream with that error.
+	StreamFaces(ctx context.Context, fn func(domain.Face) error) error
+	RecognizeFace(ctx context.Context, imageData []byte, filename string) (*domain.RecognitionResult, error)
+	// AddFace enrolls images of a person. Images the face service rejects
+	// are reported in the result; an error means the request as a whole
+	// failed and nothing is known about the individual images.
+	AddFace(ctx context.Context, name string, images [][]byte, filenames []string) (*domain.EnrollmentResult, error)
+	// RemoveFace deletes every image of a person and returns how many were
+	// removed, or ErrFaceNotFound when the person has none
+	RemoveFace(ctx context.Context, name string) (int, error)
+	// MergeFaces moves the images of source listed in files, or every image
+	// when files is empty, to target and returns where each one went. It
+	// returns ErrFaceNotFound when source has no images.
+	MergeFaces(ctx context.Context, source, target string, files []string) ([]domain.ImageMove, error)
+	// ListFaceImages returns the stored image files of a person, or
+	// ErrFaceNotFound when there are none
+	ListFaceImages(ctx context.Context, name string) ([]string, error)
+	ReloadFaces(ctx context.Context) error
+	// Health asks the face service how it is doing, without waiting behind
+	// queued recognitions
+	Health(ctx context.Context) (*domain.FaceServiceHealth, error)
+}
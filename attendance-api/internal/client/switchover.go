@@ -0,0 +1,193 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"attendance-api/internal/domain"
+)
+
+// SwitchingRecognizer migrates to another face service without losing the
+// enrollments made meanwhile. Recognitions and reads go to the active face
+// service; enrollments, removals, merges and reloads are also written to the
+// standby one. Switch swaps the two, so the old face service keeps receiving
+// writes and switching back stays possible until the migration is finished.
+type SwitchingRecognizer struct {
+	mu          sync.RWMutex
+	active      Recognizer
+	standby     Recognizer // nil without a migration
+	activeName  string
+	standbyName string
+
+	statsMu   sync.Mutex
+	mirrored  int64
+	failures  int64
+	lastError string
+}
+
+func NewSwitchingRecognizer(active Recognizer, activeName string, standby Recognizer, standbyName string) *SwitchingRecognizer {
+	return &SwitchingRecognizer{
+		active:      active,
+		standby:     standby,
+		activeName:  activeName,
+		standbyName: standbyName,
+	}
+}
+
+// Targets returns the face services in use and their names; standby is nil
+// without a migration
+func (s *SwitchingRecognizer) Targets() (active Recognizer, activeName string, standby Recognizer, standbyName string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.active, s.activeName, s.standby, s.standbyName
+}
+
+// Switch makes the standby face service the active one. Calls in flight
+// finish with the face service they started with.
+func (s *SwitchingRecognizer) Switch() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.standby == nil {
+		return errors.New("no face service to switch to")
+	}
+	s.active, s.standby = s.standby, s.active
+	s.activeName, s.standbyName = s.standbyName, s.activeName
+	return nil
+}
+
+// MirrorStats returns how many writes were copied to the standby face
+// service, how many of those failed and the last failure
+func (s *SwitchingRecognizer) MirrorStats() (mirrored, failures int64, lastError string) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	return s.mirrored, s.failures, s.lastError
+}
+
+func (s *SwitchingRecognizer) current() Recognizer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.active
+}
+
+func (s *SwitchingRecognizer) both() (Recognizer, Recognizer, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.active, s.standby, s.standbyName
+}
+
+// record records the outcome of a write copied to the standby. Failures
+// never fail the request: the active face service has the write, and the
+// standby's divergence shows when the enrollments are compared.
+func (s *SwitchingRecognizer) record(name, operation string, err error) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	s.mirrored++
+	if err == nil {
+		return
+	}
+	s.failures++
+	s.lastError = fmt.Sprintf("%s: %v", operation, err)
+	slog.Warn("Failed to mirror to the other face service", "component", "switchover", "operation", operation, "face_service", name, "error", err)
+}
+
+func (s *SwitchingRecognizer) GetFaces(ctx context.Context) ([]domain.Face, error) {
+	return s.current().GetFaces(ctx)
+}
+
+func (s *SwitchingRecognizer) StreamFaces(ctx context.Context, fn func(domain.Face) error) error {
+	return s.current().StreamFaces(ctx, fn)
+}
+
+func (s *SwitchingRecognizer) RecognizeFace(ctx context.Context, imageData []byte, filename string) (*domain.RecognitionResult, error) {
+	return s.current().RecognizeFace(ctx, imageData, filename)
+}
+
+func (s *SwitchingRecognizer) ListFaceImages(ctx context.Context, name string) ([]string, error) {
+	return s.current().ListFaceImages(ctx, name)
+}
+
+func (s *SwitchingRecognizer) Health(ctx context.Context) (*domain.FaceServiceHealth, error) {
+	return s.current().Health(ctx)
+}
+
+// AddFace enrolls on the active face service, then copies the images it
+// accepted to the standby
+func (s *SwitchingRecognizer) AddFace(ctx context.Context, name string, images [][]byte, filenames []string) (*domain.EnrollmentResult, error) {
+	active, standby, standbyName := s.both()
+
+	result, err := active.AddFace(ctx, name, images, filenames)
+	if err != nil || standby == nil {
+		return result, err
+	}
+
+	var accepted [][]byte
+	var acceptedNames []string
+	for i, image := range result.Images {
+		if image.Added && i < len(images) {
+			accepted = append(accepted, images[i])
+			acceptedNames = append(acceptedNames, filenames[i])
+		}
+	}
+	if len(accepted) == 0 {
+		return result, nil
+	}
+
+	mirror, err := standby.AddFace(ctx, name, accepted, acceptedNames)
+	if err == nil && mirror.Failed > 0 {
+		err = fmt.Errorf("%d of %d images of %s rejected", mirror.Failed, len(accepted), name)
+	}
+	s.record(standbyName, "enrollment", err)
+	return result, nil
+}
+
+// RemoveFace removes from both face services; people the standby never
+// had are fine
+func (s *SwitchingRecognizer) RemoveFace(ctx context.Context, name string) (int, error) {
+	active, standby, standbyName := s.both()
+
+	removed, err := active.RemoveFace(ctx, name)
+	if err != nil || standby == nil {
+		return removed, err
+	}
+
+	if _, err := standby.RemoveFace(ctx, name); !errors.Is(err, ErrFaceNotFound) {
+		s.record(standbyName, "removal", err)
+	}
+	return removed, nil
+}
+
+// MergeFaces merges on both face services. Image file names differ between
+// face services, so merging listed images cannot be copied and is reported
+// as a failed mirror; the people then differ until they are re-enrolled.
+func (s *SwitchingRecognizer) MergeFaces(ctx context.Context, source, target string, files []string) ([]domain.ImageMove, error) {
+	active, standby, standbyName := s.both()
+
+	moves, err := active.MergeFaces(ctx, source, target, files)
+	if err != nil || standby == nil {
+		return moves, err
+	}
+
+	if len(files) > 0 {
+		s.record(standbyName, "merge", fmt.Errorf("images of %s moved to %s one by one", source, target))
+		return moves, nil
+	}
+	if _, err := standby.MergeFaces(ctx, source, target, nil); !errors.Is(err, ErrFaceNotFound) {
+		s.record(standbyName, "merge", err)
+	}
+	return moves, nil
+}
+
+func (s *SwitchingRecognizer) ReloadFaces(ctx context.Context) error {
+	active, standby, standbyName := s.both()
+
+	if err := active.ReloadFaces(ctx); err != nil || standby == nil {
+		return err
+	}
+	s.record(standbyName, "reload", standby.ReloadFaces(ctx))
+	return nil
+}
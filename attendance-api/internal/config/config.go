@@ -1,97 +1,1585 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/joho/godotenv"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server     ServerConfig
-	FaceAPI    FaceAPIConfig
-	Upload     UploadConfig
-	Attendance AttendanceConfig
+	Server      ServerConfig
+	FaceAPI     FaceAPIConfig
+	Upload      UploadConfig
+	Attendance  AttendanceConfig
+	Ingest      IngestConfig
+	Auth        AuthConfig
+	Jobs        JobsConfig
+	Analytics   AnalyticsConfig
+	Calendar    CalendarConfig
+	Database    DatabaseConfig
+	Integrity   IntegrityConfig
+	Warmup      WarmupConfig
+	Experiment  ExperimentConfig
+	Switchover  SwitchoverConfig
+	SIEM        SIEMConfig
+	Replication ReplicationConfig
+	Snapshots   SnapshotConfig
+	RateLimit   RateLimitConfig
+	WebAuthn    WebAuthnConfig
+	Clock       ClockConfig
+	Devices     DeviceConfig
+	Changes     ChangesConfig
+	Allowlist   AllowlistConfig
+	Usage       UsageConfig
+	Webhooks    WebhookConfig
+	Building    BuildingConfig
+	EventBus    EventBusConfig
+	Bridge      StreamBridgeConfig
+	Widgets     WidgetsConfig
+	Log         LogConfig
+	Tracing     TracingConfig
+	Health      HealthConfig
+	Errors      ErrorReportingConfig
+	Vault       VaultConfig
 }
 
 type ServerConfig struct {
 	Port string
 	Host string
+
+	// GRPCPort serves the attendance.v1 gRPC service on its own port;
+	// empty disables it
+	GRPCPort string
+
+	// LegacyRoutes keeps serving the unversioned /api/... paths as aliases
+	// of /api/v1/..., marked deprecated, so existing kiosks keep working.
+	// LegacySunset, when set, is announced as the date they go away.
+	LegacyRoutes bool
+	LegacySunset time.Time
+
+	// LegacyUserAgents are User-Agent prefixes of kiosk firmware that is
+	// served the response shapes of the first release, as if it had sent
+	// X-API-Version: 1.0
+	LegacyUserAgents []string
+
+	// SSEHeartbeat is how often idle event streams get a comment, so proxies
+	// do not close them and clients that are gone are noticed. Zero
+	// disables it.
+	SSEHeartbeat time.Duration
+
+	// RouteTimeouts are deadlines of routes, by their pattern, e.g.
+	// "/api/v1/attendance". Routes not listed, event streams among them,
+	// have none.
+	RouteTimeouts map[string]time.Duration
+
+	CORS CORSConfig
+
+	TLS TLSConfig
+}
+
+// TLSConfig serves HTTPS (and TLS on the gRPC port) directly, either with a
+// certificate and key from disk or with certificates obtained from an ACME
+// CA such as Let's Encrypt for ACMEDomains. Without either the API serves
+// plain HTTP.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+
+	ACMEEmail     string
+	ACMEDomains   []string
+	ACMECacheDir  string
+	ACMEDirectory string // empty for Let's Encrypt
+
+	// HTTPPort redirects plain HTTP to HTTPS, and answers ACME HTTP-01
+	// challenges; empty disables it
+	HTTPPort string
+
+	// ClientCAFile is a PEM bundle of the CAs that issue door controller
+	// certificates. When set, recording attendance requires a client
+	// certificate signed by one of them; other endpoints do not.
+	ClientCAFile string
+}
+
+// Enabled reports whether the API serves TLS
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.ACME()
+}
+
+// ACME reports whether certificates are obtained from an ACME CA
+func (c TLSConfig) ACME() bool {
+	return len(c.ACMEDomains) > 0
+}
+
+// CORSConfig decides which browser origins may call the API. Origins are
+// exact ("https://app.example.com"), wildcard subdomains
+// ("https://*.example.com") or "*" for any origin, which cannot be combined
+// with credentials.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowCredentials bool
 }
 
 type FaceAPIConfig struct {
-	URL     string
-	Timeout time.Duration
+	Transport string // "http" (default) or "grpc"
+	URL       string
+	GRPCAddr  string
+	Timeout   time.Duration
+
+	// ListCacheTTL keeps the list of enrolled people so paging through it
+	// does not hit the face service for every page. Zero disables it.
+	ListCacheTTL time.Duration
+
+	// MaxConcurrent bounds the HTTP calls in flight to the face service;
+	// zero disables the limit. Further calls wait in a queue of at most
+	// MaxQueued (zero is unbounded) for up to QueueTimeout.
+	MaxConcurrent int
+	MaxQueued     int
+	QueueTimeout  time.Duration
 }
 
+// UploadConfig constrains the images sent to the API before they reach the
+// face service: their size, their type (sniffed from the content, e.g.
+// "image/jpeg"), their width and height in pixels and how many images one
+// enrollment request may hold
 type UploadConfig struct {
 	MaxUploadSize int64
 	MaxMemory     int64
+	AllowedTypes  []string
+	MaxWidth      int
+	MaxHeight     int
+	MaxFiles      int
+
+	// MinQuality holds back enrollment photos scoring below it (0-100)
+	// instead of adding them to the face service; 0 only reports the scores
+	MinQuality int
 }
 
 type AttendanceConfig struct {
 	DBPath string
+
+	// Timezone is the zone of the site: days begin and end, and timestamps
+	// are shown, in it. Timestamps are stored in UTC whatever the zone. It
+	// is the server's local zone when not set.
+	Timezone *time.Location
+
+	// SessionMode decides how check-outs are detected: "toggle" alternates
+	// check-in/check-out on every recognition, "gap" keeps one session per
+	// day whose check-out is the latest recognition.
+	SessionMode string
+	// SessionMinGap ignores recognitions this close to the previous session
+	// event, so standing in front of the camera does not check out.
+	SessionMinGap time.Duration
+
+	// Cooldown suppresses repeated recognitions of the same person: within
+	// the window the door still opens but nothing is recorded or broadcast.
+	// Zero disables it.
+	Cooldown time.Duration
+
+	// Doors group cameras that watch the same entrance, as
+	// "door=device|device" entries. A person recognized by several devices
+	// of one door within DoorWindow is recorded once, with every device
+	// listed as a source.
+	Doors      []string
+	DoorWindow time.Duration
+
+	// TagRules tag records when they are saved, as "tag:condition;condition"
+	// entries. Without entries the built-in rules apply; "none" disables
+	// tagging.
+	TagRules []string
+
+	// MisplacedPolicy decides what happens when a person is recognized at a
+	// location they are not assigned to: "allow" opens the door and flags
+	// the record, "deny" keeps it closed.
+	MisplacedPolicy string
+
+	// ObserveDevices run in soft-launch mode: recognitions are recorded as
+	// usual but the response always carries ObserveAction instead of a door
+	// command, so accuracy can be checked before the site relies on it.
+	ObserveDevices []string
+	ObserveAction  string
+
+	// IDFormat is the format of new record, session and person IDs: "uuid"
+	// (random) or "uuidv7" (ordered by creation time)
+	IDFormat string
+
+	// MinConfidence treats matches of the face service below this
+	// confidence (0-100) as unknown faces. Zero accepts every match.
+	MinConfidence float64
+
+	// StreamReplay is how many of the latest events are kept for event
+	// stream clients that reconnect with Last-Event-ID, so a brief network
+	// drop does not lose events. Zero disables the replay.
+	StreamReplay int
+
+	// StreamStatsInterval is how often the attendance stats are sent to
+	// event stream clients as stats_updated, when they changed. Zero
+	// disables the event.
+	StreamStatsInterval time.Duration
+
+	// StreamClientBuffer is how many events wait for each event stream
+	// client. When a slow client's buffer is full, StreamSlowClient decides
+	// what happens: "drop_newest" drops the new event, "drop_oldest" the
+	// oldest waiting one and "disconnect" closes the stream, so the client
+	// reconnects and catches up from the replay buffer.
+	StreamClientBuffer int
+	StreamSlowClient   string
+
+	// StreamMaxClients caps the concurrent event stream clients; further
+	// clients are turned away until one leaves. Zero allows any number.
+	StreamMaxClients int
+
+	// SigningSecret is shared with the door controllers: responses to
+	// recognition requests carry an HMAC-SHA256 of their body under it, so
+	// a controller only opens for responses that came from this server.
+	// Empty disables signing.
+	SigningSecret string
+}
+
+// IngestConfig controls the folder watcher used by cameras that can only
+// drop snapshots onto a filesystem (FTP/SFTP upload directories).
+type IngestConfig struct {
+	Enabled      bool
+	Dir          string
+	ProcessedDir string
+	FailedDir    string
+	PollInterval time.Duration
+	SettleTime   time.Duration
+}
+
+// DatabaseConfig sizes the SQLite connection pools. Writes go through a
+// small (by default single) connection pool so they are serialized, while
+// report and query endpoints use a separate read-only pool and never block
+// attendance inserts.
+type DatabaseConfig struct {
+	WritePoolSize int
+	ReadPoolSize  int
+	BusyTimeout   time.Duration
+}
+
+// IntegrityConfig controls the data integrity pass. OnBoot runs it at
+// startup; AutoRepair lets that run fix the findings that are safe to fix.
+type IntegrityConfig struct {
+	OnBoot     bool
+	AutoRepair bool
+}
+
+// WarmupConfig controls the synthetic recognition sent at startup so the
+// face service loads its model before real traffic arrives. Failed warm-ups
+// are retried every RetryInterval. With MonitorInterval set, the face
+// service is polled and warmed up again after it restarts.
+type WarmupConfig struct {
+	Enabled         bool
+	RetryInterval   time.Duration
+	MonitorInterval time.Duration
+}
+
+// HealthConfig bounds how long /readyz waits for each dependency
+type HealthConfig struct {
+	CheckTimeout time.Duration
+}
+
+// SwitchoverConfig names the face service to migrate to. While FaceAPI has
+// an address, enrollments are written to both face services, and an admin
+// cutover makes it the one recognitions go to.
+type SwitchoverConfig struct {
+	FaceAPI FaceAPIConfig
+}
+
+// ExperimentConfig runs a canary experiment on Percent of submissions: their
+// faces are also judged with MinConfidence, by the face service of FaceAPI
+// when it has an address, and both outcomes are logged and compared. The
+// stable configuration still makes every decision.
+type ExperimentConfig struct {
+	Name          string
+	Percent       float64 // 0 disables the experiment
+	MinConfidence float64 // defaults to the stable threshold
+	FaceAPI       FaceAPIConfig
+}
+
+// SIEMConfig forwards security events to a SIEM at Target: a syslog
+// collector as udp://, tcp:// or tls://host:port, or an HTTPS collector URL
+// that each event is POSTed to. Events are formatted as "cef" or "json",
+// limited to Events when set. FieldMap renames event fields, e.g.
+// "name=suser,device_id=dvchost"; mapping a field to "-" drops it.
+type SIEMConfig struct {
+	Target        string // empty disables the export
+	Format        string
+	Events        []string
+	FieldMap      []string
+	Authorization string // Authorization header for an HTTPS collector
+	QueueSize     int
+}
+
+// WebhookConfig controls the delivery of events to registered webhooks. A
+// failed delivery is retried up to MaxAttempts times in all, waiting
+// RetryBackoff after the first attempt and twice as long after each next
+// one. The delivery log is kept for Retention.
+type WebhookConfig struct {
+	Timeout      time.Duration
+	MaxAttempts  int
+	RetryBackoff time.Duration
+	QueueSize    int
+	Retention    time.Duration
+}
+
+// BuildingConfig bridges door events and occupancy to a building management
+// system at Target, a Modbus TCP device as modbus://host:502 or a BACnet/IP
+// device as bacnet://host:47808. Points map signals to registers or objects,
+// e.g. "occupancy=holding:10,door_open@door-1=coil:3" for Modbus or
+// "occupancy=analog-value:1,door_denied=binary-value:2" for BACnet. Door
+// signals are set for Pulse after each event; occupancy is written when it
+// changes and again every SyncInterval, so the BMS catches up after a restart
+// on either side.
+type BuildingConfig struct {
+	Target       string // empty disables the bridge
+	Points       []string
+	UnitID       int // Modbus unit identifier
+	Priority     int // BACnet write priority (1-16), 0 writes without one
+	Pulse        time.Duration
+	SyncInterval time.Duration
+	Timeout      time.Duration
+}
+
+// EventBusConfig publishes attendance events to a message broker at Target,
+// NATS as nats://[user:pass@]host:4222 or Kafka as
+// kafka://[user:pass@]host:9092 with more brokers separated by commas and
+// the sasl and tls query parameters for secured listeners. NATS subjects
+// are Topic followed by the event type, e.g. "attendance.misplaced"; Kafka
+// messages all go to the Topic topic, keyed by person. Events limits the types published.
+type EventBusConfig struct {
+	Target    string // empty disables publishing
+	Topic     string
+	Events    []string
+	QueueSize int
+	Timeout   time.Duration
+}
+
+// StreamBridgeConfig links the event streams of API instances behind a load
+// balancer. Each instance publishes its events on Channel at URL and relays
+// those of the other instances to its own stream clients. URL is Redis as
+// redis://[:password@]host:6379 (rediss:// for TLS) or NATS as
+// nats://[user:pass@]host:4222.
+type StreamBridgeConfig struct {
+	URL     string // empty keeps events on the instance
+	Channel string
+	Timeout time.Duration
+}
+
+// WidgetsConfig shapes the widget payloads for lobby displays: how many
+// arrivals are listed, how far back alerts reach and the size of arrival
+// thumbnails. Refresh is the refresh hint of the count and arrival widgets;
+// alerts ask to be refreshed twice as often.
+type WidgetsConfig struct {
+	Arrivals      int
+	AlertWindow   time.Duration
+	ThumbnailSize int // pixels along the longer side
+	Refresh       time.Duration
+}
+
+// LogConfig sets the least severe level logged ("debug", "info", "warn" or
+// "error") and whether lines are written as text or JSON
+type LogConfig struct {
+	Level  string
+	Format string // "text" or "json"
+}
+
+// TracingConfig exports OpenTelemetry spans over OTLP/HTTP to Endpoint, e.g.
+// http://otel-collector:4318, off when empty. SampleRatio is the share of
+// requests traced that did not arrive with a sampling decision.
+type TracingConfig struct {
+	Endpoint    string
+	ServiceName string
+	SampleRatio float64
+}
+
+// ErrorReportingConfig sends logged errors and handler panics to the Sentry
+// project of DSN, off when empty. SampleRate is the share of them sent.
+type ErrorReportingConfig struct {
+	DSN         string
+	Environment string
+	SampleRate  float64
+}
+
+// VaultConfig points at a HashiCorp Vault secret holding the secrets
+// settings, keyed by their environment variable, e.g. JWT_SECRET. Path is
+// that of the API below /v1, e.g. "secret/data/attendance-api" for a KV
+// version 2 engine mounted at secret/. Off when Addr is empty.
+type VaultConfig struct {
+	Addr    string
+	Token   string
+	Path    string
+	Timeout time.Duration
+}
+
+// ReplicationConfig sets up an active/standby pair. A standby follows the
+// replication stream of the active node at PrimaryURL, authenticating with
+// APIKey, and rejects writes until it is promoted.
+type ReplicationConfig struct {
+	Role       string // "standalone", "active" or "standby"
+	PrimaryURL string
+	APIKey     string
+	Interval   time.Duration // how often the active node looks for changes
+	Heartbeat  time.Duration
+}
+
+// SnapshotConfig selects where captured images are kept: "disk" below Dir,
+// or "s3" in a bucket, and which recognitions are captured. Policy applies
+// unless overridden with "tenant=policy" or "location=policy" entries.
+type SnapshotConfig struct {
+	Storage string
+	Dir     string
+	S3      S3Config
+
+	Policy           string
+	TenantPolicies   []string
+	LocationPolicies []string
+	LowConfidence    float64 // below it a match is captured by low_confidence
+}
+
+// S3Config addresses an S3 bucket. Endpoint is only needed for
+// S3-compatible services such as MinIO.
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+}
+
+// AuthConfig controls API key authentication. AdminKey is a bootstrap key
+// with every scope, used to provision the first real keys.
+type AuthConfig struct {
+	Enabled  bool
+	AdminKey string
+
+	// JWTSecret signs user access tokens; a random one is used when unset
+	JWTSecret       string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// Roles redefines the scopes of the viewer and device roles or adds
+	// roles, as "role=scope|scope" entries; the admin role has every scope
+	Roles []string
+
+	// RequireDeviceToken only accepts attendance from registered devices
+	// presenting their own token, not from API keys or users
+	RequireDeviceToken bool
+}
+
+// WebAuthnConfig enables step-up authentication with security keys and
+// passkeys for the destructive actions of signed-in users. RPID is the
+// domain the dashboard is served from; empty disables WebAuthn. Origins
+// default to https://RPID. A step-up is valid for StepUpTTL.
+type WebAuthnConfig struct {
+	RPID      string
+	RPName    string
+	Origins   []string
+	StepUpTTL time.Duration
+}
+
+// RateLimitConfig throttles API requests with a token bucket per API key or
+// signed-in user, and per client IP for requests without either: RPS
+// requests a second on average, with bursts of up to Burst. Zero RPS
+// disables it.
+type RateLimitConfig struct {
+	RPS   float64
+	Burst int
+}
+
+// AllowlistConfig restricts door-control and admin routes to clients in
+// CIDR ranges, e.g. the camera VLAN for doors. An empty list leaves its
+// routes open. Widgets works the other way round: clients in its ranges,
+// such as the lobby displays, read the widgets without an API key. File,
+// when set, holds the lists instead and is reread whenever it changes.
+type AllowlistConfig struct {
+	Door    []string
+	Admin   []string
+	Widgets []string
+	File    string
+}
+
+// ClockConfig controls the clock skew tracking of devices: a device whose
+// clock is off by more than MaxSkew is reported out of sync
+type ClockConfig struct {
+	MaxSkew time.Duration
+}
+
+// DeviceConfig controls the offline monitoring of registered devices: a
+// device not heard from within OfflineAfter is reported offline, checked
+// every CheckInterval. Zero OfflineAfter disables the monitor.
+//
+// Commands queued for a device expire after CommandTTL; one delivered but
+// not acknowledged within CommandRetry is delivered again.
+type DeviceConfig struct {
+	OfflineAfter  time.Duration
+	CheckInterval time.Duration
+	CommandTTL    time.Duration
+	CommandRetry  time.Duration
+}
+
+// ChangesConfig controls the attendance change feed. Changes older than
+// Retention are pruned; zero keeps them forever.
+type ChangesConfig struct {
+	Retention time.Duration
+}
+
+// UsageConfig controls the per-client API usage statistics. Requests are
+// counted in memory and added to the daily rollups every FlushInterval
+// (zero disables tracking); rollups older than Retention are pruned.
+type UsageConfig struct {
+	FlushInterval time.Duration
+	Retention     time.Duration
+}
+
+// AnalyticsConfig controls the dashboard analytics endpoints
+type AnalyticsConfig struct {
+	CacheTTL time.Duration
+}
+
+// CalendarConfig defines the work week; holidays are managed via the API
+type CalendarConfig struct {
+	Weekend []string // weekday names, e.g. "friday,saturday"
+}
+
+// JobsConfig sizes the background job worker pool. Jobs finished longer
+// than Retention ago are pruned; zero keeps them forever.
+type JobsConfig struct {
+	Workers   int
+	QueueSize int
+	Retention time.Duration
+
+	// RecognitionWorkers and RecognitionQueueSize size the pool of its own
+	// that asynchronous attendance requests wait for, so a burst of them
+	// queues up instead of reaching the face service at once
+	RecognitionWorkers   int
+	RecognitionQueueSize int
+}
+
+// flags override the environment and the config file, for quick local runs
+// and containers
+var flags = []struct {
+	name  string
+	key   string
+	usage string
+}{
+	{"port", "server.port", "API server port (SERVER_PORT)"},
+	{"db-path", "attendance.dbpath", "SQLite database file (ATTENDANCE_DB_PATH)"},
+	{"face-api-url", "faceapi.url", "Face recognition API URL (FACE_API_URL)"},
+	{"log-level", "log.level", "Least severe lines logged: debug, info, warn or error (LOG_LEVEL)"},
+	{"env", "app.env", "Profile whose config.<env>.yaml is read over config.yaml (APP_ENV)"},
 }
 
-func Load() (*Config, error) {
+// configPaths are the directories searched for config.yaml and the profiles
+var configPaths = []string{".", "./configs"}
+
+// InvalidError lists every problem found in the configuration
+type InvalidError struct {
+	Problems []string
+}
+
+func (e *InvalidError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+var (
+	// envNames maps settings to the environment variables they are read
+	// from, to name them in errors
+	envNames = make(map[string]string)
+
+	// knownKeys are the settings there are, against which the config file
+	// is checked
+	knownKeys map[string]bool
+
+	flagSet *pflag.FlagSet
+)
+
+func bindEnv(v *viper.Viper, key, env string) {
+	v.BindEnv(key, env)
+	envNames[key] = env
+}
+
+// ErrHelp is returned by Load after it printed the usage for --help
+var ErrHelp = pflag.ErrHelp
+
+// Load reads the configuration from args, the command-line flags, the
+// environment, the config file and the defaults, each overriding those
+// after it
+func Load(args []string) (*Config, error) {
 	// Try to load .env file (ignore error if not exists)
 	_ = godotenv.Load()
 
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("./configs")
+	flagSet = pflag.NewFlagSet("attendance-api", pflag.ContinueOnError)
+	for _, flag := range flags {
+		flagSet.String(flag.name, "", flag.usage)
+	}
+	if err := flagSet.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// Every setting has a default or an environment variable by now, so
+	// anything else the config file sets is a typo
+	knownKeys = make(map[string]bool)
+	for _, key := range newViper().AllKeys() {
+		knownKeys[key] = true
+	}
+
+	return read()
+}
+
+// newViper returns a viper that reads the settings from the flags, the
+// environment, the config file and the defaults. Every read gets its own,
+// so a reload never shares one with another goroutine.
+func newViper() *viper.Viper {
+	v := viper.New()
+	v.SetConfigName("config")
+	v.SetConfigType("yaml")
+	for _, path := range configPaths {
+		v.AddConfigPath(path)
+	}
 
 	// Bind environment variables
-	viper.AutomaticEnv()
-	viper.BindEnv("server.port", "SERVER_PORT")
-	viper.BindEnv("server.host", "SERVER_HOST")
-	viper.BindEnv("faceapi.url", "FACE_API_URL")
-	viper.BindEnv("faceapi.timeout", "FACE_API_TIMEOUT")
-	viper.BindEnv("upload.maxuploadsize", "MAX_UPLOAD_SIZE")
-	viper.BindEnv("upload.maxmemory", "MAX_MEMORY")
-	viper.BindEnv("attendance.dbpath", "ATTENDANCE_DB_PATH")
+	v.AutomaticEnv()
+	bindEnv(v, "app.env", "APP_ENV")
+	bindEnv(v, "server.port", "SERVER_PORT")
+	bindEnv(v, "server.host", "SERVER_HOST")
+	bindEnv(v, "server.grpcport", "GRPC_PORT")
+	bindEnv(v, "server.legacyroutes", "API_LEGACY_ROUTES")
+	bindEnv(v, "server.legacysunset", "API_LEGACY_SUNSET")
+	bindEnv(v, "server.legacyuseragents", "API_LEGACY_USER_AGENTS")
+	bindEnv(v, "server.sseheartbeat", "SSE_HEARTBEAT_INTERVAL")
+	bindEnv(v, "server.routetimeouts", "SERVER_ROUTE_TIMEOUTS")
+	bindEnv(v, "server.cors.allowedorigins", "CORS_ALLOWED_ORIGINS")
+	bindEnv(v, "server.cors.allowedmethods", "CORS_ALLOWED_METHODS")
+	bindEnv(v, "server.cors.allowedheaders", "CORS_ALLOWED_HEADERS")
+	bindEnv(v, "server.cors.allowcredentials", "CORS_ALLOW_CREDENTIALS")
+	bindEnv(v, "server.tls.certfile", "TLS_CERT_FILE")
+	bindEnv(v, "server.tls.keyfile", "TLS_KEY_FILE")
+	bindEnv(v, "server.tls.acmeemail", "TLS_ACME_EMAIL")
+	bindEnv(v, "server.tls.acmedomains", "TLS_ACME_DOMAINS")
+	bindEnv(v, "server.tls.acmecachedir", "TLS_ACME_CACHE_DIR")
+	bindEnv(v, "server.tls.acmedirectory", "TLS_ACME_DIRECTORY")
+	bindEnv(v, "server.tls.httpport", "TLS_HTTP_PORT")
+	bindEnv(v, "server.tls.clientcafile", "TLS_CLIENT_CA_FILE")
+	bindEnv(v, "faceapi.url", "FACE_API_URL")
+	bindEnv(v, "faceapi.timeout", "FACE_API_TIMEOUT")
+	bindEnv(v, "faceapi.transport", "FACE_API_TRANSPORT")
+	bindEnv(v, "faceapi.grpcaddr", "FACE_API_GRPC_ADDR")
+	bindEnv(v, "faceapi.listcachettl", "FACE_API_LIST_CACHE_TTL")
+	bindEnv(v, "faceapi.maxconcurrent", "FACE_API_MAX_CONCURRENT")
+	bindEnv(v, "faceapi.maxqueued", "FACE_API_MAX_QUEUED")
+	bindEnv(v, "faceapi.queuetimeout", "FACE_API_QUEUE_TIMEOUT")
+	bindEnv(v, "upload.maxuploadsize", "MAX_UPLOAD_SIZE")
+	bindEnv(v, "upload.maxmemory", "MAX_MEMORY")
+	bindEnv(v, "upload.allowedtypes", "UPLOAD_ALLOWED_TYPES")
+	bindEnv(v, "upload.maxwidth", "UPLOAD_MAX_WIDTH")
+	bindEnv(v, "upload.maxheight", "UPLOAD_MAX_HEIGHT")
+	bindEnv(v, "upload.maxfiles", "UPLOAD_MAX_FILES")
+	bindEnv(v, "upload.minquality", "ENROLLMENT_MIN_QUALITY")
+	bindEnv(v, "attendance.dbpath", "ATTENDANCE_DB_PATH")
+	bindEnv(v, "attendance.timezone", "ATTENDANCE_TIMEZONE")
+	bindEnv(v, "attendance.sessionmode", "ATTENDANCE_SESSION_MODE")
+	bindEnv(v, "attendance.sessionmingap", "ATTENDANCE_SESSION_MIN_GAP")
+	bindEnv(v, "attendance.cooldown", "ATTENDANCE_COOLDOWN")
+	bindEnv(v, "attendance.doors", "ATTENDANCE_DOORS")
+	bindEnv(v, "attendance.doorwindow", "ATTENDANCE_DOOR_WINDOW")
+	bindEnv(v, "attendance.tagrules", "ATTENDANCE_TAG_RULES")
+	bindEnv(v, "attendance.misplacedpolicy", "ATTENDANCE_MISPLACED_POLICY")
+	bindEnv(v, "attendance.observedevices", "ATTENDANCE_OBSERVE_DEVICES")
+	bindEnv(v, "attendance.observeaction", "ATTENDANCE_OBSERVE_ACTION")
+	bindEnv(v, "attendance.captureunknowns", "ATTENDANCE_CAPTURE_UNKNOWNS")
+	bindEnv(v, "attendance.idformat", "ATTENDANCE_ID_FORMAT")
+	bindEnv(v, "attendance.minconfidence", "ATTENDANCE_MIN_CONFIDENCE")
+	bindEnv(v, "attendance.signingsecret", "ATTENDANCE_SIGNING_SECRET")
+	bindEnv(v, "attendance.streamreplay", "SSE_REPLAY_BUFFER")
+	bindEnv(v, "attendance.streamstatsinterval", "SSE_STATS_INTERVAL")
+	bindEnv(v, "attendance.streamclientbuffer", "SSE_CLIENT_BUFFER")
+	bindEnv(v, "attendance.streamslowclient", "SSE_SLOW_CLIENT_POLICY")
+	bindEnv(v, "attendance.streammaxclients", "SSE_MAX_CLIENTS")
+	bindEnv(v, "ingest.enabled", "INGEST_ENABLED")
+	bindEnv(v, "ingest.dir", "INGEST_DIR")
+	bindEnv(v, "ingest.processeddir", "INGEST_PROCESSED_DIR")
+	bindEnv(v, "ingest.faileddir", "INGEST_FAILED_DIR")
+	bindEnv(v, "ingest.pollinterval", "INGEST_POLL_INTERVAL")
+	bindEnv(v, "ingest.settletime", "INGEST_SETTLE_TIME")
+	bindEnv(v, "auth.enabled", "AUTH_ENABLED")
+	bindEnv(v, "auth.adminkey", "ADMIN_API_KEY")
+	bindEnv(v, "auth.jwtsecret", "JWT_SECRET")
+	bindEnv(v, "auth.accesstokenttl", "JWT_ACCESS_TTL")
+	bindEnv(v, "auth.refreshtokenttl", "JWT_REFRESH_TTL")
+	bindEnv(v, "auth.roles", "AUTH_ROLES")
+	bindEnv(v, "auth.requiredevicetoken", "AUTH_REQUIRE_DEVICE_TOKEN")
+	bindEnv(v, "webauthn.rpid", "WEBAUTHN_RP_ID")
+	bindEnv(v, "webauthn.rpname", "WEBAUTHN_RP_NAME")
+	bindEnv(v, "webauthn.origins", "WEBAUTHN_ORIGINS")
+	bindEnv(v, "webauthn.stepupttl", "WEBAUTHN_STEP_UP_TTL")
+	bindEnv(v, "ratelimit.rps", "RATE_LIMIT_RPS")
+	bindEnv(v, "ratelimit.burst", "RATE_LIMIT_BURST")
+	bindEnv(v, "allowlist.door", "IP_ALLOWLIST_DOOR")
+	bindEnv(v, "allowlist.admin", "IP_ALLOWLIST_ADMIN")
+	bindEnv(v, "allowlist.widgets", "IP_ALLOWLIST_WIDGETS")
+	bindEnv(v, "allowlist.file", "IP_ALLOWLIST_FILE")
+	bindEnv(v, "clock.maxskew", "DEVICE_CLOCK_MAX_SKEW")
+	bindEnv(v, "devices.offlineafter", "DEVICE_OFFLINE_AFTER")
+	bindEnv(v, "devices.checkinterval", "DEVICE_CHECK_INTERVAL")
+	bindEnv(v, "devices.commandttl", "DEVICE_COMMAND_TTL")
+	bindEnv(v, "devices.commandretry", "DEVICE_COMMAND_RETRY")
+	bindEnv(v, "changes.retention", "ATTENDANCE_CHANGES_RETENTION")
+	bindEnv(v, "usage.flushinterval", "USAGE_FLUSH_INTERVAL")
+	bindEnv(v, "usage.retention", "USAGE_RETENTION")
+	bindEnv(v, "jobs.workers", "JOB_WORKERS")
+	bindEnv(v, "jobs.queuesize", "JOB_QUEUE_SIZE")
+	bindEnv(v, "jobs.retention", "JOB_RETENTION")
+	bindEnv(v, "jobs.recognitionworkers", "JOB_RECOGNITION_WORKERS")
+	bindEnv(v, "jobs.recognitionqueuesize", "JOB_RECOGNITION_QUEUE_SIZE")
+	bindEnv(v, "analytics.cachettl", "ANALYTICS_CACHE_TTL")
+	bindEnv(v, "calendar.weekend", "CALENDAR_WEEKEND")
+	bindEnv(v, "database.writepoolsize", "DB_WRITE_POOL_SIZE")
+	bindEnv(v, "database.readpoolsize", "DB_READ_POOL_SIZE")
+	bindEnv(v, "database.busytimeout", "DB_BUSY_TIMEOUT")
+	bindEnv(v, "integrity.onboot", "INTEGRITY_CHECK_ON_BOOT")
+	bindEnv(v, "integrity.autorepair", "INTEGRITY_AUTO_REPAIR")
+	bindEnv(v, "warmup.enabled", "WARMUP_ENABLED")
+	bindEnv(v, "warmup.retryinterval", "WARMUP_RETRY_INTERVAL")
+	bindEnv(v, "warmup.monitorinterval", "WARMUP_MONITOR_INTERVAL")
+	bindEnv(v, "health.checktimeout", "HEALTH_CHECK_TIMEOUT")
+	bindEnv(v, "experiment.name", "EXPERIMENT_NAME")
+	bindEnv(v, "experiment.percent", "EXPERIMENT_PERCENT")
+	bindEnv(v, "experiment.minconfidence", "EXPERIMENT_MIN_CONFIDENCE")
+	bindEnv(v, "experiment.faceapi.transport", "EXPERIMENT_FACE_API_TRANSPORT")
+	bindEnv(v, "experiment.faceapi.url", "EXPERIMENT_FACE_API_URL")
+	bindEnv(v, "experiment.faceapi.grpcaddr", "EXPERIMENT_FACE_API_GRPC_ADDR")
+	bindEnv(v, "switchover.faceapi.transport", "FACE_API_NEXT_TRANSPORT")
+	bindEnv(v, "switchover.faceapi.url", "FACE_API_NEXT_URL")
+	bindEnv(v, "switchover.faceapi.grpcaddr", "FACE_API_NEXT_GRPC_ADDR")
+	bindEnv(v, "siem.target", "SIEM_TARGET")
+	bindEnv(v, "siem.format", "SIEM_FORMAT")
+	bindEnv(v, "siem.events", "SIEM_EVENTS")
+	bindEnv(v, "siem.fieldmap", "SIEM_FIELD_MAP")
+	bindEnv(v, "siem.authorization", "SIEM_AUTHORIZATION")
+	bindEnv(v, "siem.queuesize", "SIEM_QUEUE_SIZE")
+	bindEnv(v, "webhooks.timeout", "WEBHOOK_TIMEOUT")
+	bindEnv(v, "webhooks.maxattempts", "WEBHOOK_MAX_ATTEMPTS")
+	bindEnv(v, "webhooks.retrybackoff", "WEBHOOK_RETRY_BACKOFF")
+	bindEnv(v, "webhooks.queuesize", "WEBHOOK_QUEUE_SIZE")
+	bindEnv(v, "webhooks.retention", "WEBHOOK_LOG_RETENTION")
+	bindEnv(v, "building.target", "BUILDING_TARGET")
+	bindEnv(v, "building.points", "BUILDING_POINTS")
+	bindEnv(v, "building.unitid", "BUILDING_MODBUS_UNIT_ID")
+	bindEnv(v, "building.priority", "BUILDING_BACNET_PRIORITY")
+	bindEnv(v, "building.pulse", "BUILDING_PULSE")
+	bindEnv(v, "building.syncinterval", "BUILDING_SYNC_INTERVAL")
+	bindEnv(v, "building.timeout", "BUILDING_TIMEOUT")
+	bindEnv(v, "eventbus.target", "EVENT_BUS_TARGET")
+	bindEnv(v, "eventbus.topic", "EVENT_BUS_TOPIC")
+	bindEnv(v, "eventbus.events", "EVENT_BUS_EVENTS")
+	bindEnv(v, "eventbus.queuesize", "EVENT_BUS_QUEUE_SIZE")
+	bindEnv(v, "eventbus.timeout", "EVENT_BUS_TIMEOUT")
+	bindEnv(v, "bridge.url", "SSE_BRIDGE_URL")
+	bindEnv(v, "bridge.channel", "SSE_BRIDGE_CHANNEL")
+	bindEnv(v, "bridge.timeout", "SSE_BRIDGE_TIMEOUT")
+	bindEnv(v, "widgets.arrivals", "WIDGETS_ARRIVALS")
+	bindEnv(v, "widgets.alertwindow", "WIDGETS_ALERT_WINDOW")
+	bindEnv(v, "widgets.thumbnailsize", "WIDGETS_THUMBNAIL_SIZE")
+	bindEnv(v, "widgets.refresh", "WIDGETS_REFRESH")
+	bindEnv(v, "log.level", "LOG_LEVEL")
+	bindEnv(v, "log.format", "LOG_FORMAT")
+	bindEnv(v, "tracing.endpoint", "TRACING_ENDPOINT")
+	bindEnv(v, "tracing.servicename", "TRACING_SERVICE_NAME")
+	bindEnv(v, "tracing.sampleratio", "TRACING_SAMPLE_RATIO")
+	bindEnv(v, "errors.dsn", "SENTRY_DSN")
+	bindEnv(v, "errors.environment", "SENTRY_ENVIRONMENT")
+	bindEnv(v, "errors.samplerate", "SENTRY_SAMPLE_RATE")
+	bindEnv(v, "replication.role", "REPLICATION_ROLE")
+	bindEnv(v, "replication.primaryurl", "REPLICATION_PRIMARY_URL")
+	bindEnv(v, "replication.apikey", "REPLICATION_API_KEY")
+	bindEnv(v, "replication.interval", "REPLICATION_INTERVAL")
+	bindEnv(v, "replication.heartbeat", "REPLICATION_HEARTBEAT")
+	bindEnv(v, "snapshots.storage", "SNAPSHOT_STORAGE")
+	bindEnv(v, "snapshots.dir", "SNAPSHOT_DIR")
+	bindEnv(v, "snapshots.s3.endpoint", "SNAPSHOT_S3_ENDPOINT")
+	bindEnv(v, "snapshots.s3.region", "SNAPSHOT_S3_REGION")
+	bindEnv(v, "snapshots.s3.bucket", "SNAPSHOT_S3_BUCKET")
+	bindEnv(v, "snapshots.s3.prefix", "SNAPSHOT_S3_PREFIX")
+	bindEnv(v, "snapshots.s3.accesskey", "SNAPSHOT_S3_ACCESS_KEY")
+	bindEnv(v, "snapshots.s3.secretkey", "SNAPSHOT_S3_SECRET_KEY")
+	bindEnv(v, "snapshots.policy", "SNAPSHOT_POLICY")
+	bindEnv(v, "snapshots.tenantpolicies", "SNAPSHOT_TENANT_POLICIES")
+	bindEnv(v, "snapshots.locationpolicies", "SNAPSHOT_LOCATION_POLICIES")
+	bindEnv(v, "snapshots.lowconfidence", "SNAPSHOT_LOW_CONFIDENCE")
+	bindEnv(v, "vault.addr", "VAULT_ADDR")
+	bindEnv(v, "vault.token", "VAULT_TOKEN")
+	bindEnv(v, "vault.path", "VAULT_SECRET_PATH")
+	bindEnv(v, "vault.timeout", "VAULT_TIMEOUT")
 
 	// Set defaults
-	viper.SetDefault("server.port", "8080")
-	viper.SetDefault("server.host", "0.0.0.0")
-	viper.SetDefault("faceapi.url", "http://localhost:5001")
-	viper.SetDefault("faceapi.timeout", "30s")
-	viper.SetDefault("upload.maxuploadsize", 5242880) // 5MB
-	viper.SetDefault("upload.maxmemory", 10485760)    // 10MB
-	viper.SetDefault("attendance.dbpath", "./data/attendance.db")
+	v.SetDefault("server.port", "8080")
+	v.SetDefault("server.host", "0.0.0.0")
+	v.SetDefault("server.legacyroutes", true)
+	v.SetDefault("server.sseheartbeat", "15s")
+	v.SetDefault("server.routetimeouts", "/api/v1/attendance=10s")
+	v.SetDefault("server.cors.allowedorigins", []string{"*"})
+	v.SetDefault("server.cors.allowedmethods", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"})
+	v.SetDefault("server.cors.allowedheaders", []string{"Content-Type", "Authorization", "X-API-Key", "X-Device-ID", "X-Step-Up", "X-Request-ID"})
+	v.SetDefault("server.cors.allowcredentials", false)
+	v.SetDefault("server.tls.acmecachedir", "./data/acme")
+	v.SetDefault("faceapi.url", "http://localhost:5001")
+	v.SetDefault("faceapi.timeout", "30s")
+	v.SetDefault("faceapi.transport", "http")
+	v.SetDefault("faceapi.grpcaddr", "localhost:50051")
+	v.SetDefault("faceapi.listcachettl", "30s")
+	v.SetDefault("faceapi.maxconcurrent", 8)
+	v.SetDefault("faceapi.maxqueued", 64)
+	v.SetDefault("faceapi.queuetimeout", "10s")
+	v.SetDefault("upload.maxuploadsize", 5242880) // 5MB
+	v.SetDefault("upload.maxmemory", 10485760)    // 10MB
+	v.SetDefault("upload.allowedtypes", "image/jpeg,image/png,image/webp")
+	v.SetDefault("upload.maxwidth", 8192)
+	v.SetDefault("upload.maxheight", 8192)
+	v.SetDefault("upload.maxfiles", 10)
+	v.SetDefault("attendance.dbpath", "./data/attendance.db")
+	v.SetDefault("attendance.sessionmode", "toggle")
+	v.SetDefault("attendance.sessionmingap", "1m")
+	v.SetDefault("attendance.cooldown", "0s")
+	v.SetDefault("attendance.doorwindow", "10s")
+	v.SetDefault("attendance.misplacedpolicy", "allow")
+	v.SetDefault("attendance.observeaction", "none")
+	v.SetDefault("attendance.streamreplay", 256)
+	v.SetDefault("attendance.streamclientbuffer", 10)
+	v.SetDefault("attendance.streamslowclient", "drop_newest")
+	v.SetDefault("attendance.captureunknowns", true)
+	v.SetDefault("attendance.idformat", "uuid")
+	v.SetDefault("attendance.minconfidence", 0)
+	v.SetDefault("ingest.enabled", false)
+	v.SetDefault("ingest.dir", "./data/incoming")
+	v.SetDefault("ingest.processeddir", "./data/processed")
+	v.SetDefault("ingest.faileddir", "./data/failed")
+	v.SetDefault("ingest.pollinterval", "5s")
+	v.SetDefault("ingest.settletime", "2s")
+	v.SetDefault("auth.enabled", false)
+	v.SetDefault("auth.accesstokenttl", "15m")
+	v.SetDefault("auth.refreshtokenttl", "720h")
+	v.SetDefault("webauthn.rpname", "Attendance API")
+	v.SetDefault("webauthn.stepupttl", "5m")
+	v.SetDefault("ratelimit.rps", 0)
+	v.SetDefault("ratelimit.burst", 20)
+	v.SetDefault("jobs.workers", 2)
+	v.SetDefault("jobs.queuesize", 100)
+	v.SetDefault("jobs.recognitionworkers", 4)
+	v.SetDefault("jobs.recognitionqueuesize", 200)
+	v.SetDefault("analytics.cachettl", "5m")
+	v.SetDefault("calendar.weekend", "friday,saturday")
+	v.SetDefault("database.writepoolsize", 1)
+	v.SetDefault("database.readpoolsize", 4)
+	v.SetDefault("database.busytimeout", "5s")
+	v.SetDefault("integrity.onboot", true)
+	v.SetDefault("integrity.autorepair", false)
+	v.SetDefault("warmup.enabled", true)
+	v.SetDefault("warmup.retryinterval", "5s")
+	v.SetDefault("warmup.monitorinterval", "30s")
+	v.SetDefault("health.checktimeout", "2s")
+	v.SetDefault("experiment.name", "canary")
+	v.SetDefault("experiment.percent", 0)
+	v.SetDefault("experiment.faceapi.transport", "http")
+	v.SetDefault("switchover.faceapi.transport", "http")
+	v.SetDefault("siem.format", "cef")
+	v.SetDefault("siem.queuesize", 1000)
+	v.SetDefault("webhooks.maxattempts", 8)
+	v.SetDefault("webhooks.queuesize", 1000)
+	v.SetDefault("building.unitid", 1)
+	v.SetDefault("eventbus.topic", "attendance")
+	v.SetDefault("eventbus.queuesize", 1000)
+	v.SetDefault("bridge.channel", "attendance-stream")
+	v.SetDefault("widgets.arrivals", 5)
+	v.SetDefault("widgets.thumbnailsize", 96)
+	v.SetDefault("log.level", "info")
+	v.SetDefault("log.format", "text")
+	v.SetDefault("tracing.servicename", "attendance-api")
+	v.SetDefault("tracing.sampleratio", 1.0)
+	v.SetDefault("errors.environment", "production")
+	v.SetDefault("errors.samplerate", 1.0)
+	v.SetDefault("replication.role", "standalone")
+	v.SetDefault("replication.interval", "1s")
+	v.SetDefault("replication.heartbeat", "10s")
+	v.SetDefault("snapshots.storage", "disk")
+	v.SetDefault("snapshots.dir", "./data/snapshots")
+	v.SetDefault("snapshots.lowconfidence", 70)
+	v.SetDefault("vault.timeout", "5s")
+
+	if flagSet != nil {
+		for _, flag := range flags {
+			v.BindPFlag(flag.key, flagSet.Lookup(flag.name))
+		}
+	}
+	return v
+}
+
+// Reload reads the config files again and returns the configuration with
+// their changes. Environment variables keep the values they had at startup,
+// and still override the files. Reloads must not run at the same time.
+func Reload() (*Config, error) {
+	return read()
+}
+
+// Watch calls onChange whenever config.yaml or the profile the last load
+// read is written. It does not read them itself: that is left to Reload,
+// so that only one goroutine reads the config. It does nothing when there
+// is no config file.
+func Watch(onChange func()) error {
+	files := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, file := range Effective().Files {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return fmt.Errorf("failed to watch config file: %w", err)
+		}
+		files[path] = true
+		dirs[filepath.Dir(path)] = true
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	// Watch the directories rather than the files, which editors and
+	// config maps replace instead of writing them
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch config file: %w", err)
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch config file: %w", err)
+		}
+	}
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if files[filepath.Clean(event.Name)] && event.Has(fsnotify.Write|fsnotify.Create) {
+					onChange()
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func read() (*Config, error) {
+	v := newViper()
 
 	// Read config file (optional)
-	if err := viper.ReadInConfig(); err != nil {
+	var files []string
+	if err := v.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
 			return nil, fmt.Errorf("failed to read config file: %w", err)
 		}
+	} else {
+		files = append(files, v.ConfigFileUsed())
 	}
 
-	// Parse timeout
-	timeout, err := time.ParseDuration(viper.GetString("faceapi.timeout"))
-	if err != nil {
-		timeout = 30 * time.Second
+	// The profile overrides config.yaml, and is overridden by flags and the
+	// environment like it
+	var profileKeys map[string]bool
+	if profile := v.GetString("app.env"); profile != "" {
+		file, keys, err := mergeProfile(v, profile)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+		profileKeys = keys
+	}
+
+	r := &reader{v: v, malformed: make(map[string]bool), secrets: make(map[string]secretSource)}
+	for _, key := range v.AllKeys() {
+		if !knownKeys[key] {
+			r.addf("unknown setting %q in %s", key, strings.Join(files, " or "))
+		}
+	}
+
+	vault := VaultConfig{
+		Addr:    v.GetString("vault.addr"),
+		Token:   r.secret("vault.token"),
+		Path:    v.GetString("vault.path"),
+		Timeout: r.duration("vault.timeout", 5*time.Second),
+	}
+	if vault.Addr != "" {
+		secrets, err := readVault(vault)
+		if err != nil {
+			r.addf("%v", err)
+		}
+		r.vault = secrets
+	}
+
+	var legacySunset time.Time
+	if value := v.GetString("server.legacysunset"); value != "" {
+		sunset, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			r.addf("invalid API_LEGACY_SUNSET %q, expected YYYY-MM-DD", value)
+		}
+		legacySunset = sunset
+	}
+
+	serverTLS := TLSConfig{
+		CertFile:      v.GetString("server.tls.certfile"),
+		KeyFile:       v.GetString("server.tls.keyfile"),
+		ACMEEmail:     v.GetString("server.tls.acmeemail"),
+		ACMEDomains:   r.list("server.tls.acmedomains"),
+		ACMECacheDir:  v.GetString("server.tls.acmecachedir"),
+		ACMEDirectory: v.GetString("server.tls.acmedirectory"),
+		HTTPPort:      v.GetString("server.tls.httpport"),
+		ClientCAFile:  v.GetString("server.tls.clientcafile"),
+	}
+	if (serverTLS.CertFile == "") != (serverTLS.KeyFile == "") {
+		r.addf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if serverTLS.CertFile != "" && serverTLS.ACME() {
+		r.addf("set either TLS_CERT_FILE and TLS_KEY_FILE or TLS_ACME_DOMAINS, not both")
+	}
+	if serverTLS.ACMEEmail != "" && !serverTLS.ACME() {
+		r.addf("TLS_ACME_EMAIL needs TLS_ACME_DOMAINS")
+	}
+	if serverTLS.HTTPPort != "" && !serverTLS.Enabled() {
+		r.addf("TLS_HTTP_PORT needs TLS to be configured")
+	}
+	if serverTLS.ClientCAFile != "" && !serverTLS.Enabled() {
+		r.addf("TLS_CLIENT_CA_FILE needs TLS to be configured")
+	}
+
+	experimentMinConfidence := r.float("attendance.minconfidence")
+	if v.GetString("experiment.minconfidence") != "" {
+		experimentMinConfidence = r.float("experiment.minconfidence")
+	}
+
+	routeTimeouts := make(map[string]time.Duration)
+	for _, entry := range r.list("server.routetimeouts") {
+		route, value, _ := strings.Cut(entry, "=")
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 || !strings.HasPrefix(route, "/") {
+			r.addf("invalid SERVER_ROUTE_TIMEOUTS entry %q, expected route=duration such as /api/v1/attendance=10s", entry)
+			continue
+		}
+		routeTimeouts[route] = timeout
 	}
 
+	logConfig := LogConfig{
+		Level:  strings.ToLower(v.GetString("log.level")),
+		Format: strings.ToLower(v.GetString("log.format")),
+	}
+	switch logConfig.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		r.addf("invalid LOG_LEVEL %q, expected debug, info, warn or error", logConfig.Level)
+	}
+	if logConfig.Format != "text" && logConfig.Format != "json" {
+		r.addf("invalid LOG_FORMAT %q, expected text or json", logConfig.Format)
+	}
+
+	sampleRatio := r.float("tracing.sampleratio")
+	if sampleRatio < 0 || sampleRatio > 1 {
+		r.addf("invalid TRACING_SAMPLE_RATIO %g, expected 0 to 1", sampleRatio)
+	}
+
+	errorSampleRate := r.float("errors.samplerate")
+	if errorSampleRate < 0 || errorSampleRate > 1 {
+		r.addf("invalid SENTRY_SAMPLE_RATE %g, expected 0 to 1", errorSampleRate)
+	}
+
+	// ATTENDANCE_CAPTURE_UNKNOWNS=false predates the capture policy and
+	// still turns capturing off when no policy is set
+	snapshotPolicy := v.GetString("snapshots.policy")
+	if snapshotPolicy == "" {
+		snapshotPolicy = "unknown"
+		if !v.GetBool("attendance.captureunknowns") {
+			snapshotPolicy = "never"
+		}
+	}
+
+	timeout := r.duration("faceapi.timeout", 30*time.Second)
+
 	config := &Config{
 		Server: ServerConfig{
-			Port: viper.GetString("server.port"),
-			Host: viper.GetString("server.host"),
+			Port: v.GetString("server.port"),
+			Host: v.GetString("server.host"),
+
+			GRPCPort: v.GetString("server.grpcport"),
+
+			LegacyRoutes: v.GetBool("server.legacyroutes"),
+			LegacySunset: legacySunset,
+
+			LegacyUserAgents: r.list("server.legacyuseragents"),
+
+			SSEHeartbeat: r.duration("server.sseheartbeat", 15*time.Second),
+
+			RouteTimeouts: routeTimeouts,
+
+			CORS: CORSConfig{
+				AllowedOrigins:   r.list("server.cors.allowedorigins"),
+				AllowedMethods:   r.list("server.cors.allowedmethods"),
+				AllowedHeaders:   r.list("server.cors.allowedheaders"),
+				AllowCredentials: v.GetBool("server.cors.allowcredentials"),
+			},
+
+			TLS: serverTLS,
 		},
 		FaceAPI: FaceAPIConfig{
-			URL:     viper.GetString("faceapi.url"),
-			Timeout: timeout,
+			Transport: v.GetString("faceapi.transport"),
+			URL:       v.GetString("faceapi.url"),
+			GRPCAddr:  v.GetString("faceapi.grpcaddr"),
+			Timeout:   timeout,
+
+			ListCacheTTL: r.duration("faceapi.listcachettl", 30*time.Second),
+
+			MaxConcurrent: r.int("faceapi.maxconcurrent"),
+			MaxQueued:     r.int("faceapi.maxqueued"),
+			QueueTimeout:  r.duration("faceapi.queuetimeout", 10*time.Second),
 		},
 		Upload: UploadConfig{
-			MaxUploadSize: viper.GetInt64("upload.maxuploadsize"),
-			MaxMemory:     viper.GetInt64("upload.maxmemory"),
+			MaxUploadSize: r.int64("upload.maxuploadsize"),
+			MaxMemory:     r.int64("upload.maxmemory"),
+			AllowedTypes:  r.list("upload.allowedtypes"),
+			MaxWidth:      r.int("upload.maxwidth"),
+			MaxHeight:     r.int("upload.maxheight"),
+			MaxFiles:      r.int("upload.maxfiles"),
+			MinQuality:    r.int("upload.minquality"),
 		},
 		Attendance: AttendanceConfig{
-			DBPath: viper.GetString("attendance.dbpath"),
+			DBPath:        v.GetString("attendance.dbpath"),
+			Timezone:      r.location("attendance.timezone"),
+			SessionMode:   v.GetString("attendance.sessionmode"),
+			SessionMinGap: r.duration("attendance.sessionmingap", time.Minute),
+			Cooldown:      r.duration("attendance.cooldown", 0),
+			Doors:         r.list("attendance.doors"),
+			DoorWindow:    r.duration("attendance.doorwindow", 10*time.Second),
+			TagRules:      r.list("attendance.tagrules"),
+
+			MisplacedPolicy:     v.GetString("attendance.misplacedpolicy"),
+			ObserveDevices:      r.list("attendance.observedevices"),
+			ObserveAction:       v.GetString("attendance.observeaction"),
+			IDFormat:            v.GetString("attendance.idformat"),
+			MinConfidence:       r.float("attendance.minconfidence"),
+			SigningSecret:       r.secret("attendance.signingsecret"),
+			StreamReplay:        r.int("attendance.streamreplay"),
+			StreamStatsInterval: r.duration("attendance.streamstatsinterval", 2*time.Second),
+			StreamClientBuffer:  r.int("attendance.streamclientbuffer"),
+			StreamSlowClient:    v.GetString("attendance.streamslowclient"),
+			StreamMaxClients:    r.int("attendance.streammaxclients"),
+		},
+		Ingest: IngestConfig{
+			Enabled:      v.GetBool("ingest.enabled"),
+			Dir:          v.GetString("ingest.dir"),
+			ProcessedDir: v.GetString("ingest.processeddir"),
+			FailedDir:    v.GetString("ingest.faileddir"),
+			PollInterval: r.duration("ingest.pollinterval", 5*time.Second),
+			SettleTime:   r.duration("ingest.settletime", 2*time.Second),
+		},
+		Auth: AuthConfig{
+			Enabled:  v.GetBool("auth.enabled"),
+			AdminKey: r.secret("auth.adminkey"),
+
+			JWTSecret:       r.secret("auth.jwtsecret"),
+			AccessTokenTTL:  r.duration("auth.accesstokenttl", 15*time.Minute),
+			RefreshTokenTTL: r.duration("auth.refreshtokenttl", 720*time.Hour),
+			Roles:           r.list("auth.roles"),
+
+			RequireDeviceToken: v.GetBool("auth.requiredevicetoken"),
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID:      v.GetString("webauthn.rpid"),
+			RPName:    v.GetString("webauthn.rpname"),
+			Origins:   r.list("webauthn.origins"),
+			StepUpTTL: r.duration("webauthn.stepupttl", 5*time.Minute),
+		},
+		RateLimit: RateLimitConfig{
+			RPS:   r.float("ratelimit.rps"),
+			Burst: r.int("ratelimit.burst"),
+		},
+		Allowlist: AllowlistConfig{
+			Door:    r.list("allowlist.door"),
+			Admin:   r.list("allowlist.admin"),
+			Widgets: r.list("allowlist.widgets"),
+			File:    v.GetString("allowlist.file"),
+		},
+		Clock: ClockConfig{
+			MaxSkew: r.duration("clock.maxskew", 5*time.Second),
+		},
+		Devices: DeviceConfig{
+			OfflineAfter:  r.duration("devices.offlineafter", 5*time.Minute),
+			CheckInterval: r.duration("devices.checkinterval", 30*time.Second),
+			CommandTTL:    r.duration("devices.commandttl", 10*time.Minute),
+			CommandRetry:  r.duration("devices.commandretry", 30*time.Second),
+		},
+		Changes: ChangesConfig{
+			Retention: r.duration("changes.retention", 30*24*time.Hour),
+		},
+		Usage: UsageConfig{
+			FlushInterval: r.duration("usage.flushinterval", time.Minute),
+			Retention:     r.duration("usage.retention", 90*24*time.Hour),
+		},
+		Jobs: JobsConfig{
+			Workers:   r.int("jobs.workers"),
+			QueueSize: r.int("jobs.queuesize"),
+			Retention: r.duration("jobs.retention", 7*24*time.Hour),
+
+			RecognitionWorkers:   r.int("jobs.recognitionworkers"),
+			RecognitionQueueSize: r.int("jobs.recognitionqueuesize"),
+		},
+		Analytics: AnalyticsConfig{
+			CacheTTL: r.duration("analytics.cachettl", 5*time.Minute),
+		},
+		Calendar: CalendarConfig{
+			Weekend: r.list("calendar.weekend"),
+		},
+		Database: DatabaseConfig{
+			WritePoolSize: r.int("database.writepoolsize"),
+			ReadPoolSize:  r.int("database.readpoolsize"),
+			BusyTimeout:   r.duration("database.busytimeout", 5*time.Second),
+		},
+		Integrity: IntegrityConfig{
+			OnBoot:     v.GetBool("integrity.onboot"),
+			AutoRepair: v.GetBool("integrity.autorepair"),
+		},
+		Warmup: WarmupConfig{
+			Enabled:         v.GetBool("warmup.enabled"),
+			RetryInterval:   r.duration("warmup.retryinterval", 5*time.Second),
+			MonitorInterval: r.duration("warmup.monitorinterval", 30*time.Second),
+		},
+		Health: HealthConfig{
+			CheckTimeout: r.duration("health.checktimeout", 2*time.Second),
+		},
+		Experiment: ExperimentConfig{
+			Name:          v.GetString("experiment.name"),
+			Percent:       r.float("experiment.percent"),
+			MinConfidence: experimentMinConfidence,
+			FaceAPI: FaceAPIConfig{
+				Transport: v.GetString("experiment.faceapi.transport"),
+				URL:       v.GetString("experiment.faceapi.url"),
+				GRPCAddr:  v.GetString("experiment.faceapi.grpcaddr"),
+				Timeout:   timeout,
+			},
+		},
+		Switchover: SwitchoverConfig{
+			FaceAPI: FaceAPIConfig{
+				Transport:    v.GetString("switchover.faceapi.transport"),
+				URL:          v.GetString("switchover.faceapi.url"),
+				GRPCAddr:     v.GetString("switchover.faceapi.grpcaddr"),
+				Timeout:      timeout,
+				ListCacheTTL: r.duration("faceapi.listcachettl", 30*time.Second),
+			},
+		},
+		SIEM: SIEMConfig{
+			Target:        v.GetString("siem.target"),
+			Format:        v.GetString("siem.format"),
+			Events:        r.list("siem.events"),
+			FieldMap:      r.list("siem.fieldmap"),
+			Authorization: r.secret("siem.authorization"),
+			QueueSize:     r.int("siem.queuesize"),
+		},
+		Webhooks: WebhookConfig{
+			Timeout:      r.duration("webhooks.timeout", 10*time.Second),
+			MaxAttempts:  r.int("webhooks.maxattempts"),
+			RetryBackoff: r.duration("webhooks.retrybackoff", 30*time.Second),
+			QueueSize:    r.int("webhooks.queuesize"),
+			Retention:    r.duration("webhooks.retention", 7*24*time.Hour),
+		},
+		Building: BuildingConfig{
+			Target:       v.GetString("building.target"),
+			Points:       r.list("building.points"),
+			UnitID:       r.int("building.unitid"),
+			Priority:     r.int("building.priority"),
+			Pulse:        r.duration("building.pulse", 2*time.Second),
+			SyncInterval: r.duration("building.syncinterval", time.Minute),
+			Timeout:      r.duration("building.timeout", 3*time.Second),
+		},
+		EventBus: EventBusConfig{
+			Target:    v.GetString("eventbus.target"),
+			Topic:     v.GetString("eventbus.topic"),
+			Events:    r.list("eventbus.events"),
+			QueueSize: r.int("eventbus.queuesize"),
+			Timeout:   r.duration("eventbus.timeout", 5*time.Second),
+		},
+		Bridge: StreamBridgeConfig{
+			URL:     v.GetString("bridge.url"),
+			Channel: v.GetString("bridge.channel"),
+			Timeout: r.duration("bridge.timeout", 5*time.Second),
+		},
+		Widgets: WidgetsConfig{
+			Arrivals:      r.int("widgets.arrivals"),
+			AlertWindow:   r.duration("widgets.alertwindow", 15*time.Minute),
+			ThumbnailSize: r.int("widgets.thumbnailsize"),
+			Refresh:       r.duration("widgets.refresh", 30*time.Second),
+		},
+		Log: logConfig,
+		Tracing: TracingConfig{
+			Endpoint:    v.GetString("tracing.endpoint"),
+			ServiceName: v.GetString("tracing.servicename"),
+			SampleRatio: sampleRatio,
+		},
+		Errors: ErrorReportingConfig{
+			DSN:         r.secret("errors.dsn"),
+			Environment: v.GetString("errors.environment"),
+			SampleRate:  errorSampleRate,
+		},
+		Vault: vault,
+		Replication: ReplicationConfig{
+			Role:       v.GetString("replication.role"),
+			PrimaryURL: v.GetString("replication.primaryurl"),
+			APIKey:     r.secret("replication.apikey"),
+			Interval:   r.duration("replication.interval", time.Second),
+			Heartbeat:  r.duration("replication.heartbeat", 10*time.Second),
+		},
+		Snapshots: SnapshotConfig{
+			Storage: v.GetString("snapshots.storage"),
+			Dir:     v.GetString("snapshots.dir"),
+			S3: S3Config{
+				Endpoint:  v.GetString("snapshots.s3.endpoint"),
+				Region:    v.GetString("snapshots.s3.region"),
+				Bucket:    v.GetString("snapshots.s3.bucket"),
+				Prefix:    v.GetString("snapshots.s3.prefix"),
+				AccessKey: r.secret("snapshots.s3.accesskey"),
+				SecretKey: r.secret("snapshots.s3.secretkey"),
+			},
+			Policy:           snapshotPolicy,
+			TenantPolicies:   r.list("snapshots.tenantpolicies"),
+			LocationPolicies: r.list("snapshots.locationpolicies"),
+			LowConfidence:    r.float("snapshots.lowconfidence"),
 		},
 	}
 
+	r.validate(config)
+	if len(r.problems) > 0 {
+		return nil, &InvalidError{Problems: r.problems}
+	}
+	effective.Store(r.effective(files, profileKeys))
 	return config, nil
 }
+
+// mergeProfile reads config.<profile>.yaml over the configuration read so
+// far and returns its path and the keys it sets
+func mergeProfile(v *viper.Viper, profile string) (string, map[string]bool, error) {
+	name := "config." + profile + ".yaml"
+	for _, dir := range configPaths {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read config profile: %w", err)
+		}
+
+		overlay := viper.New()
+		overlay.SetConfigType("yaml")
+		if err := overlay.ReadConfig(bytes.NewReader(data)); err != nil {
+			return "", nil, fmt.Errorf("failed to read config profile %s: %w", path, err)
+		}
+		if err := v.MergeConfigMap(overlay.AllSettings()); err != nil {
+			return "", nil, fmt.Errorf("failed to read config profile %s: %w", path, err)
+		}
+		keys := make(map[string]bool)
+		for _, key := range overlay.AllKeys() {
+			keys[key] = true
+		}
+		return path, keys, nil
+	}
+	return "", nil, fmt.Errorf("no %s for APP_ENV %q in %s", name, profile, strings.Join(configPaths, " or "))
+}
+
+// reader reads settings and collects every problem with them, so a broken
+// configuration is fixed in one go rather than one restart per mistake
+type reader struct {
+	v         *viper.Viper
+	problems  []string
+	malformed map[string]bool
+	vault     map[string]string
+
+	// secrets are where the secrets were read from, by key
+	secrets map[string]secretSource
+}
+
+func (r *reader) addf(format string, args ...interface{}) {
+	r.problems = append(r.problems, fmt.Sprintf(format, args...))
+}
+
+// invalid notes that key does not hold what it should, e.g. "a duration
+// such as 30s"
+func (r *reader) invalid(key, expected string) {
+	r.malformed[key] = true
+	r.addf("invalid %s %q, expected %s", settingName(key), r.v.GetString(key), expected)
+}
+
+// duration reads a duration setting, falling back when it is not set
+func (r *reader) duration(key string, fallback time.Duration) time.Duration {
+	value := r.v.GetString(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		r.invalid(key, "a duration such as 30s")
+		return fallback
+	}
+	return d
+}
+
+func (r *reader) int(key string) int {
+	return int(r.int64(key))
+}
+
+func (r *reader) int64(key string) int64 {
+	value := r.v.GetString(key)
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		r.invalid(key, "a whole number")
+	}
+	return n
+}
+
+func (r *reader) float(key string) float64 {
+	value := r.v.GetString(key)
+	if value == "" {
+		return 0
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		r.invalid(key, "a number")
+	}
+	return f
+}
+
+// location reads an IANA timezone name such as Asia/Baghdad, the local zone
+// when empty
+func (r *reader) location(key string) *time.Location {
+	value := r.v.GetString(key)
+	if value == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(value)
+	if err != nil {
+		r.invalid(key, "an IANA timezone such as Asia/Baghdad")
+		return time.Local
+	}
+	return loc
+}
+
+// positive notes a size, count or timeout of key that is zero or negative,
+// unless it was malformed to begin with
+func (r *reader) positive(key string, value int64) {
+	if value <= 0 && !r.malformed[key] {
+		r.addf("invalid %s %q, expected more than zero", settingName(key), r.v.GetString(key))
+	}
+}
+
+// url notes a URL setting that is set but is not an absolute URL with one
+// of schemes
+func (r *reader) url(key string, schemes ...string) {
+	value := r.v.GetString(key)
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" || !slices.Contains(schemes, u.Scheme) {
+		r.addf("invalid %s %q, expected a URL such as %s://host:port", settingName(key), value, schemes[0])
+	}
+}
+
+// validate checks the settings whose values parse but make no sense
+func (r *reader) validate(c *Config) {
+	if c.FaceAPI.Transport == "" || c.FaceAPI.Transport == "http" {
+		if c.FaceAPI.URL == "" {
+			r.addf("FACE_API_URL is required")
+		}
+		r.url("faceapi.url", "http", "https")
+	}
+	r.url("experiment.faceapi.url", "http", "https")
+	r.url("switchover.faceapi.url", "http", "https")
+	r.url("replication.primaryurl", "http", "https")
+	r.url("snapshots.s3.endpoint", "https", "http")
+	r.url("tracing.endpoint", "http", "https")
+	r.url("vault.addr", "https", "http")
+	r.url("siem.target", "tls", "tcp", "udp", "https", "http")
+	r.url("eventbus.target", "nats", "kafka")
+	r.url("bridge.url", "redis", "rediss", "nats")
+	r.url("building.target", "bacnet", "modbus")
+
+	r.positive("faceapi.timeout", int64(c.FaceAPI.Timeout))
+	r.positive("upload.maxuploadsize", c.Upload.MaxUploadSize)
+	r.positive("upload.maxmemory", c.Upload.MaxMemory)
+	r.positive("upload.maxwidth", int64(c.Upload.MaxWidth))
+	r.positive("upload.maxheight", int64(c.Upload.MaxHeight))
+	r.positive("upload.maxfiles", int64(c.Upload.MaxFiles))
+	if len(c.Upload.AllowedTypes) == 0 {
+		r.addf("UPLOAD_ALLOWED_TYPES is required")
+	}
+	for _, contentType := range c.Upload.AllowedTypes {
+		if !slices.Contains(imageTypes, contentType) {
+			r.addf("invalid UPLOAD_ALLOWED_TYPES entry %q, expected %s", contentType, strings.Join(imageTypes, ", "))
+		}
+	}
+	r.positive("attendance.streamclientbuffer", int64(c.Attendance.StreamClientBuffer))
+	r.positive("jobs.workers", int64(c.Jobs.Workers))
+	r.positive("jobs.queuesize", int64(c.Jobs.QueueSize))
+	r.positive("jobs.recognitionworkers", int64(c.Jobs.RecognitionWorkers))
+	r.positive("jobs.recognitionqueuesize", int64(c.Jobs.RecognitionQueueSize))
+	r.positive("database.writepoolsize", int64(c.Database.WritePoolSize))
+	r.positive("database.readpoolsize", int64(c.Database.ReadPoolSize))
+	r.positive("database.busytimeout", int64(c.Database.BusyTimeout))
+	r.positive("health.checktimeout", int64(c.Health.CheckTimeout))
+	r.positive("webhooks.timeout", int64(c.Webhooks.Timeout))
+	r.positive("webhooks.maxattempts", int64(c.Webhooks.MaxAttempts))
+	r.positive("webhooks.queuesize", int64(c.Webhooks.QueueSize))
+	r.positive("siem.queuesize", int64(c.SIEM.QueueSize))
+	r.positive("eventbus.queuesize", int64(c.EventBus.QueueSize))
+	r.positive("widgets.thumbnailsize", int64(c.Widgets.ThumbnailSize))
+}
+
+// imageTypes are the image types uploads may be limited to, those whose
+// dimensions can be checked
+var imageTypes = []string{"image/jpeg", "image/png", "image/webp"}
+
+// settingName names key the way it is documented, by its environment
+// variable
+func settingName(key string) string {
+	if env, ok := envNames[key]; ok {
+		return env
+	}
+	return key
+}
+
+// list reads a comma-separated setting, or a list from the config file
+func (r *reader) list(key string) []string {
+	var values []string
+	for _, value := range r.v.GetStringSlice(key) {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writing the profile triggers a reload, and the reload sees the profile's
+// new values over config.yaml
+func TestWatchProfile(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	t.Setenv("APP_ENV", "test")
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("config.yaml", "attendance:\n  cooldown: 1m\n")
+	write("config.test.yaml", "attendance:\n  cooldown: 2m\n")
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Attendance.Cooldown != 2*time.Minute {
+		t.Fatalf("cooldown = %s, want the profile's 2m", cfg.Attendance.Cooldown)
+	}
+
+	changed := make(chan struct{}, 1)
+	if err := Watch(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	write("config.test.yaml", "attendance:\n  cooldown: 3m\n")
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writing the profile did not trigger a reload")
+	}
+
+	cfg, err = Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Attendance.Cooldown != 3*time.Minute {
+		t.Errorf("cooldown = %s after reload, want 3m", cfg.Attendance.Cooldown)
+	}
+	if got := Effective().Files; len(got) != 2 {
+		t.Errorf("files = %v, want config.yaml and the profile", got)
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"attendance-api/internal/domain"
+)
+
+// effective is the configuration as last loaded, for Effective
+var effective atomic.Pointer[domain.EffectiveConfig]
+
+// Effective returns every setting as it was last loaded or reloaded and
+// where its value came from, with secrets and the passwords of URLs
+// redacted
+func Effective() domain.EffectiveConfig {
+	if loaded := effective.Load(); loaded != nil {
+		return *loaded
+	}
+	return domain.EffectiveConfig{}
+}
+
+func (r *reader) effective(files []string, profileKeys map[string]bool) *domain.EffectiveConfig {
+	keys := make([]string, 0, len(knownKeys))
+	for key := range knownKeys {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	loaded := &domain.EffectiveConfig{
+		LoadedAt: time.Now(),
+		Profile:  r.v.GetString("app.env"),
+		Files:    append([]string{}, files...),
+		Settings: make([]domain.ConfigSetting, 0, len(keys)),
+	}
+	for _, key := range keys {
+		setting := domain.ConfigSetting{Key: key, Env: envNames[key], Value: r.v.Get(key)}
+
+		secret, isSecret := r.secrets[key]
+		source := secret.source
+		switch {
+		case source != "":
+		case flagSet != nil && flagChanged(key):
+			source = "flag"
+		case setting.Env != "" && os.Getenv(setting.Env) != "":
+			source = "env"
+		case profileKeys[key]:
+			source = "profile"
+		case r.v.InConfig(key):
+			source = "file"
+		default:
+			source = "default"
+		}
+		setting.Source = source
+
+		if isSecret {
+			setting.Value, setting.Redacted = "", secret.set
+			if secret.set {
+				setting.Value = "REDACTED"
+			}
+		} else if value, ok := setting.Value.(string); ok && strings.Contains(value, "://") {
+			if u, err := url.Parse(value); err == nil && u.User != nil {
+				setting.Value = u.Redacted()
+				setting.Redacted = true
+			}
+		}
+		loaded.Settings = append(loaded.Settings, setting)
+	}
+	return loaded
+}
+
+func flagChanged(key string) bool {
+	for _, flag := range flags {
+		if flag.key == key {
+			return flagSet.Changed(flag.name)
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// secret reads a credential setting. Its environment variable wins, then
+// the file named by the variable with a _FILE suffix (a Docker or
+// Kubernetes secret mount), then Vault, then the config file.
+func (r *reader) secret(key string) string {
+	value, source := r.lookupSecret(key)
+	r.secrets[key] = secretSource{source: source, set: value != ""}
+	return value
+}
+
+func (r *reader) lookupSecret(key string) (value, source string) {
+	env := envNames[key]
+	if value := os.Getenv(env); value != "" {
+		return value, "env"
+	}
+	if path := os.Getenv(env + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			r.addf("failed to read %s_FILE: %v", env, err)
+			return "", "env_file"
+		}
+		return strings.TrimRight(string(data), "\r\n"), "env_file"
+	}
+	if value, ok := r.vault[env]; ok {
+		return value, "vault"
+	}
+	return r.v.GetString(key), ""
+}
+
+// secretSource is where a secret was read from, empty when from the config
+// file or a default like other settings
+type secretSource struct {
+	source string
+	set    bool
+}
+
+// readVault reads the secret at cfg.Path from a KV engine of either
+// version, whose fields are named after environment variables
+func readVault(cfg VaultConfig) (map[string]string, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("VAULT_SECRET_PATH is required with VAULT_ADDR")
+	}
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("VAULT_TOKEN or VAULT_TOKEN_FILE is required with VAULT_ADDR")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	endpoint := strings.TrimRight(cfg.Addr, "/") + "/v1/" + strings.TrimLeft(cfg.Path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAULT_ADDR %q: %w", cfg.Addr, err)
+	}
+	req.Header.Set("X-Vault-Token", cfg.Token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets from Vault: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read secrets from Vault: %s answered %s", cfg.Path, resp.Status)
+	}
+
+	// KV version 2 nests the fields in data.data, next to data.metadata
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode Vault secret %s: %w", cfg.Path, err)
+	}
+	fields := body.Data
+	if nested, ok := fields["data"]; ok && fields["metadata"] != nil {
+		fields = nil
+		if err := json.Unmarshal(nested, &fields); err != nil {
+			return nil, fmt.Errorf("failed to decode Vault secret %s: %w", cfg.Path, err)
+		}
+	}
+
+	secrets := make(map[string]string, len(fields))
+	for name, raw := range fields {
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("field %s of Vault secret %s is not a string", name, cfg.Path)
+		}
+		secrets[name] = value
+	}
+	return secrets, nil
+}
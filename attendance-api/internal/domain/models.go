@@ -1,6 +1,11 @@
 package domain
 
-import "time"
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+)
 
 // Face represents a known person in the system
 type Face struct {
@@ -34,9 +39,70 @@ type FaceLocation struct {
 type AttendanceRecord struct {
 	ID         string    `json:"id"`
 	Name       string    `json:"name"`
+	PersonID   string    `json:"person_id,omitempty"`   // set when the name belongs to a person
+	ExternalID string    `json:"external_id,omitempty"` // reference of the submission in the client's system
 	Confidence float64   `json:"confidence"`
 	Timestamp  time.Time `json:"timestamp"`
 	Status     string    `json:"status"` // "authorized" or "unauthorized"
+	DeviceID   string    `json:"device_id,omitempty"`
+	ClientCert string    `json:"client_cert,omitempty"` // CN of the client certificate the device presented
+	Sources    []string  `json:"sources,omitempty"`     // every device of the door that saw this recognition
+	EventType  string    `json:"event_type,omitempty"`  // "check_in" or "check_out"
+	Location   string    `json:"location,omitempty"`
+	Misplaced  bool      `json:"misplaced,omitempty"` // recognized outside the person's assigned locations
+	DoorID     string    `json:"door_id,omitempty"`
+
+	// Punctuality against the person's shift, set on the first check-in of
+	// the day and on check-outs
+	LatenessMinutes   *int `json:"lateness_minutes,omitempty"`
+	Late              bool `json:"late,omitempty"`
+	EarlyLeaveMinutes int  `json:"early_leave_minutes,omitempty"`
+	EarlyLeave        bool `json:"early_leave,omitempty"`
+
+	// ObserveOnly marks records from a device in soft-launch mode, whose
+	// door was not controlled by the decision
+	ObserveOnly bool `json:"observe_only,omitempty"`
+
+	// Tags are set by the tag rules when the record is saved, such as
+	// "late" or "after_hours"
+	Tags []string `json:"tags,omitempty"`
+
+	// Actor is who submitted the image; absent on records saved before
+	// submissions were attributed
+	Actor *Actor `json:"actor,omitempty"`
+}
+
+// AttendanceSubmission is a single image submitted for attendance,
+// together with where it came from
+type AttendanceSubmission struct {
+	ImageData []byte
+	Filename  string
+	DeviceID  string
+	Location  string
+
+	// DoorID is the door the device controls, whose access rules decide;
+	// without it the device's door from the door configuration is used
+	DoorID string
+
+	// ClientCert is the common name of the verified client certificate the
+	// submission was made with, if any
+	ClientCert string
+
+	// ExternalID is the client's own reference for the submission, such as
+	// an event number of the door controller. A reference can be recorded
+	// only once.
+	ExternalID string
+}
+
+// AttendanceChange is one insert, update or delete of an attendance row in
+// the change feed. Before and After are the row's columns as stored.
+type AttendanceChange struct {
+	Seq       int64           `json:"seq"`
+	Op        string          `json:"op"` // "insert", "update" or "delete"
+	RecordID  string          `json:"record_id"`
+	ChangedAt time.Time       `json:"changed_at"`
+	Before    json.RawMessage `json:"before"` // null for inserts
+	After     json.RawMessage `json:"after"`  // null for deletes
 }
 
 // AttendanceResponse represents the response sent to Arduino
@@ -47,10 +113,1694 @@ type AttendanceResponse struct {
 	Confidence float64 `json:"confidence,omitempty"`
 	Message    string  `json:"message"`
 	Action     string  `json:"action"` // "open_door" or "keep_closed"
+	EventType  string  `json:"event_type,omitempty"`
+	Duplicate  bool    `json:"duplicate,omitempty"` // within the cooldown window, not recorded
+	Misplaced  bool    `json:"misplaced,omitempty"`
+	Door       string  `json:"door,omitempty"` // the door whose access rules were applied
+
+	// Schedule is the door schedule in effect, if any
+	Schedule *DoorSchedule `json:"schedule,omitempty"`
+
+	// Emergency is the lockdown or unlock-all in force, if any; it
+	// overrides the door's schedule and access rules
+	Emergency *Emergency `json:"emergency,omitempty"`
+
+	// In soft-launch mode Action is the configured no-op and IntendedAction
+	// what would have been done
+	ObserveOnly    bool   `json:"observe_only,omitempty"`
+	IntendedAction string `json:"intended_action,omitempty"`
+
+	Faces []FaceOutcome `json:"faces,omitempty"` // every face detected in the frame
+
+	// ServerTime lets devices without NTP access set their clock
+	ServerTime time.Time `json:"server_time"`
+
+	// With response signing, Nonce echoes the device's nonce (a random one
+	// when it sent none) and Timestamp is ServerTime in Unix seconds, so a
+	// device can tell a replayed response from a fresh one
+	Nonce     string `json:"nonce,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+}
+
+// FaceOutcome is the decision taken for one face of a submitted frame
+type FaceOutcome struct {
+	Name       string  `json:"name"`
+	Confidence float64 `json:"confidence"`
+	Authorized bool    `json:"authorized"`
+	Message    string  `json:"message"`
+	EventType  string  `json:"event_type,omitempty"`
+	Duplicate  bool    `json:"duplicate,omitempty"`
+	Misplaced  bool    `json:"misplaced,omitempty"`
+}
+
+// Session event types
+const (
+	EventCheckIn  = "check_in"
+	EventCheckOut = "check_out"
+)
+
+// WorkSession is one check-in/check-out pair
+type WorkSession struct {
+	CheckIn  time.Time  `json:"check_in"`
+	CheckOut *time.Time `json:"check_out,omitempty"`
+}
+
+// WorkedHours summarizes the sessions of one person on one day
+type WorkedHours struct {
+	Name        string        `json:"name"`
+	Date        string        `json:"date"`
+	Sessions    []WorkSession `json:"sessions"`
+	WorkedHours float64       `json:"worked_hours"`
+	OpenSession bool          `json:"open_session"`
+}
+
+// RollingPoint is one person's attendance on one day with the share of
+// days present in the trailing windows, as percentages
+type RollingPoint struct {
+	Date              string  `json:"date"`
+	Workday           bool    `json:"workday"`
+	Present           bool    `json:"present"`
+	AttendanceRate7d  float64 `json:"attendance_rate_7d"`
+	AttendanceRate30d float64 `json:"attendance_rate_30d"`
+	LatePercent7d     float64 `json:"late_percent_7d"` // share of days present that started late
+	LatePercent30d    float64 `json:"late_percent_30d"`
+}
+
+// RollingSeries is the daily trend of a single person
+type RollingSeries struct {
+	Name   string         `json:"name"`
+	Points []RollingPoint `json:"points"`
+}
+
+// RollingAttendance holds the rolling attendance trends for a period
+type RollingAttendance struct {
+	From        string          `json:"from"`
+	To          string          `json:"to"`
+	Series      []RollingSeries `json:"series"`
+	GeneratedAt time.Time       `json:"generated_at"`
+}
+
+// Shift is the expected working time of a person on the given weekdays
+type Shift struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Start        string    `json:"start"`    // HH:MM, server local time
+	End          string    `json:"end"`      // HH:MM, before Start for overnight shifts
+	Weekdays     []int     `json:"weekdays"` // 0 = Sunday; empty means every day
+	GraceMinutes int       `json:"grace_minutes"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// WorksOn reports whether the shift applies on the given weekday
+func (s Shift) WorksOn(day time.Weekday) bool {
+	if len(s.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range s.Weekdays {
+		if time.Weekday(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+// PunctualitySummary aggregates lateness over check-ins evaluated against a shift
+type PunctualitySummary struct {
+	CheckIns           int     `json:"check_ins"`
+	OnTime             int     `json:"on_time"`
+	Late               int     `json:"late"`
+	LatePercent        float64 `json:"late_percent"`
+	AvgLatenessMinutes float64 `json:"avg_lateness_minutes"`
+	EarlyLeaves        int     `json:"early_leaves"`
+}
+
+// Holiday is a day off for everybody. Recurring holidays repeat on the same
+// month and day every year.
+type Holiday struct {
+	Date      string `json:"date"` // YYYY-MM-DD
+	Name      string `json:"name"`
+	Recurring bool   `json:"recurring"`
+}
+
+// CalendarDay describes whether people are expected at work on a day
+type CalendarDay struct {
+	Date    string `json:"date"`
+	Weekday string `json:"weekday"`
+	Workday bool   `json:"workday"`
+	Weekend bool   `json:"weekend,omitempty"`
+	Holiday string `json:"holiday,omitempty"`
+}
+
+// Person holds the local details of an enrolled person
+type Person struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"` // as recognized by the face service
+	FullName       string    `json:"full_name,omitempty"`
+	EmployeeNumber string    `json:"employee_number,omitempty"`
+	ExternalID     string    `json:"external_id,omitempty"` // ID in an HR or other external system
+	CardNumber     string    `json:"card_number,omitempty"`
+	Email          string    `json:"email,omitempty"`
+	Active         bool      `json:"active"`
+	Department     string    `json:"department,omitempty"`
+	Group          string    `json:"group,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// PersonUpdate holds the person fields to change; nil fields are kept
+type PersonUpdate struct {
+	FullName       *string `json:"full_name"`
+	EmployeeNumber *string `json:"employee_number"`
+	ExternalID     *string `json:"external_id"`
+	CardNumber     *string `json:"card_number"`
+	Email          *string `json:"email"`
+	Active         *bool   `json:"active"`
+	Department     *string `json:"department"`
+	Group          *string `json:"group"`
+}
+
+// PersonProfile brings together what is known about a recognized name for
+// the dashboard's profile page
+type PersonProfile struct {
+	Name       string            `json:"name"`
+	Person     *Person           `json:"person,omitempty"` // absent when the name has no person entry
+	Enrollment *FaceEnrollment   `json:"enrollment"`       // null when the face service could not be asked
+	Latest     *AttendanceRecord `json:"latest_attendance,omitempty"`
+	Stats      PersonStats       `json:"stats"`
+}
+
+// FaceEnrollment is what the face service holds of a person
+type FaceEnrollment struct {
+	Enrolled bool `json:"enrolled"`
+	Images   int  `json:"images"`
+}
+
+// PersonStats summarizes a person's attendance, all time and over the last
+// 30 days
+type PersonStats struct {
+	Total          int        `json:"total"`
+	Authorized     int        `json:"authorized"`
+	FirstSeen      *time.Time `json:"first_seen,omitempty"`
+	DaysPresent30d int        `json:"days_present_30d"`
+	Late30d        int        `json:"late_30d"`
+}
+
+// GroupFilter restricts queries to the members of a department and/or group
+type GroupFilter struct {
+	Department string
+	Group      string
+}
+
+// SourceFilter restricts records to those of a device and/or location, so
+// sites with several entrances can tell them apart
+type SourceFilter struct {
+	DeviceID string
+	Location string
+}
+
+// AttendanceQuery selects a page of attendance records, newest first. Zero
+// values do not filter.
+type AttendanceQuery struct {
+	GroupFilter
+	SourceFilter
+	Name          string
+	PersonID      string
+	Status        string
+	MinConfidence float64
+	Tag           string
+	From          time.Time
+	To            time.Time // exclusive
+	Limit         int
+	Offset        int
+	Cursor        string // next_cursor of the previous page; takes precedence over Offset
+}
+
+// PeriodStats counts the records since From, for the today and this_week
+// figures of the statistics
+type PeriodStats struct {
+	From         time.Time `json:"from"`
+	Total        int       `json:"total"`
+	Authorized   int       `json:"authorized"`
+	Unauthorized int       `json:"unauthorized"`
+	UniquePeople int       `json:"unique_people"`
+}
+
+// TagCount is the number of records carrying a tag
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// AttendancePage is one page of an attendance query
+type AttendancePage struct {
+	Records    []AttendanceRecord
+	Total      int    // records matching the filters across all pages
+	NextCursor string // empty on the last page
+}
+
+// IsEmpty reports whether the filter matches everybody
+func (f GroupFilter) IsEmpty() bool {
+	return f.Department == "" && f.Group == ""
+}
+
+func (f SourceFilter) IsEmpty() bool {
+	return f.DeviceID == "" && f.Location == ""
+}
+
+// GroupSummary is a department/group combination and its size
+type GroupSummary struct {
+	Department string `json:"department"`
+	Group      string `json:"group"`
+	Members    int    `json:"members"`
+}
+
+// PoolStats describes a database connection pool
+type PoolStats struct {
+	MaxOpen       int     `json:"max_open"`
+	Open          int     `json:"open"`
+	InUse         int     `json:"in_use"`
+	Idle          int     `json:"idle"`
+	WaitCount     int64   `json:"wait_count"`
+	WaitTotalMs   int64   `json:"wait_total_ms"`
+	WaitAverageMs float64 `json:"wait_average_ms"`
+}
+
+// AdminStatus is the state of a node at a glance, for the ops dashboard
+type AdminStatus struct {
+	Build     BuildInfo      `json:"build"`
+	StartedAt time.Time      `json:"started_at"`
+	Uptime    string         `json:"uptime"`
+	Database  DatabaseStatus `json:"database"`
+	FaceAPI   FaceAPIStatus  `json:"face_api"`
+	Streams   StreamStats    `json:"streams"`
+}
+
+// BuildInfo identifies the running binary. Revision and BuiltAt are only
+// known for binaries built from a git checkout.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Revision  string `json:"revision,omitempty"`
+	BuiltAt   string `json:"built_at,omitempty"` // time of the commit
+	Modified  bool   `json:"modified,omitempty"` // built with uncommitted changes
+}
+
+// DatabaseStatus is the size of the SQLite database and its tables
+type DatabaseStatus struct {
+	SizeBytes int64            `json:"size_bytes"`
+	FreeBytes int64            `json:"free_bytes"` // unused pages, reclaimed by VACUUM
+	WALBytes  int64            `json:"wal_bytes"`
+	Rows      map[string]int64 `json:"rows"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// EffectiveConfig is the configuration as the node last loaded it, with
+// secrets redacted
+type EffectiveConfig struct {
+	LoadedAt time.Time       `json:"loaded_at"`
+	Profile  string          `json:"profile,omitempty"` // APP_ENV
+	Files    []string        `json:"files"`             // config files read, in order
+	Settings []ConfigSetting `json:"settings"`
+}
+
+// ConfigSetting is a setting and where its value came from: "flag", "env",
+// "env_file" (a *_FILE variable), "vault", "profile", "file" or "default"
+type ConfigSetting struct {
+	Key      string      `json:"key"`
+	Env      string      `json:"env,omitempty"`
+	Value    interface{} `json:"value"`
+	Source   string      `json:"source"`
+	Redacted bool        `json:"redacted,omitempty"`
 }
 
-// SSEMessage represents a server-sent event message
+// FaceAPIStatus is whether the face service answers and how many people
+// are enrolled in it
+type FaceAPIStatus struct {
+	Reachable      bool   `json:"reachable"`
+	Status         string `json:"status,omitempty"` // as reported by the face service
+	EnrolledPeople int    `json:"enrolled_people"`
+	KnownFaces     int    `json:"known_faces,omitempty"`
+	Duration       string `json:"duration"`
+	Error          string `json:"error,omitempty"`
+}
+
+// FaceSwitchover describes a migration to another face service: the one
+// recognitions go to, the one enrollments are also written to, and how
+// copying the writes went
+type FaceSwitchover struct {
+	Active          string     `json:"active"`
+	Standby         string     `json:"standby,omitempty"` // empty without a migration
+	DualWrite       bool       `json:"dual_write"`
+	Mirrored        int64      `json:"mirrored"` // writes copied to the standby since startup
+	MirrorFailures  int64      `json:"mirror_failures"`
+	LastMirrorError string     `json:"last_mirror_error,omitempty"`
+	SwitchedAt      *time.Time `json:"switched_at,omitempty"`
+	SwitchedBy      string     `json:"switched_by,omitempty"`
+
+	Verification *EnrollmentComparison `json:"verification,omitempty"`
+}
+
+// EnrollmentComparison compares the people enrolled on two face services
+type EnrollmentComparison struct {
+	Match         bool                 `json:"match"`
+	ActivePeople  int                  `json:"active_people"`
+	StandbyPeople int                  `json:"standby_people"`
+	ActiveImages  int                  `json:"active_images"`
+	StandbyImages int                  `json:"standby_images"`
+	Mismatches    []EnrollmentMismatch `json:"mismatches"`
+	Truncated     bool                 `json:"truncated,omitempty"` // more mismatches than listed
+}
+
+// EnrollmentMismatch is a person with a different number of images on the
+// two face services; zero means the person is missing there
+type EnrollmentMismatch struct {
+	Name          string `json:"name"`
+	ActiveImages  int    `json:"active_images"`
+	StandbyImages int    `json:"standby_images"`
+}
+
+// LimiterStats describes the concurrency limit on calls to the face service
+type LimiterStats struct {
+	Enabled       bool    `json:"enabled"`
+	Limit         int     `json:"limit"`
+	InFlight      int     `json:"in_flight"`
+	Queued        int     `json:"queued"`
+	MaxQueued     int     `json:"max_queued"`  // 0 is unbounded
+	PeakQueued    int     `json:"peak_queued"` // deepest the queue has been
+	Acquired      int64   `json:"acquired"`
+	Rejected      int64   `json:"rejected"`  // the queue was full
+	TimedOut      int64   `json:"timed_out"` // waited longer than the queue timeout
+	WaitTotalMs   int64   `json:"wait_total_ms"`
+	WaitAverageMs float64 `json:"wait_average_ms"`
+	WaitMaxMs     int64   `json:"wait_max_ms"`
+	QueueTimeout  string  `json:"queue_timeout,omitempty"`
+}
+
+// FaceServiceHealth is what the face service reports about itself.
+// StartedAt is zero for services that do not report it.
+type FaceServiceHealth struct {
+	Status     string    `json:"status"`
+	KnownFaces int       `json:"known_faces"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// WarmupStatus describes whether the recognition path has been warmed up
+// and so whether the API is ready for traffic
+type WarmupStatus struct {
+	Ready     bool       `json:"ready"`
+	State     string     `json:"state"` // disabled, warming_up or ready
+	Warmups   int        `json:"warmups"`
+	WarmedAt  *time.Time `json:"warmed_at,omitempty"`
+	Duration  string     `json:"duration,omitempty"` // of the last warm-up
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// Histogram counts observations in buckets: Counts[i] of those up to
+// Bounds[i] and above the bound before it, and a last count of those above
+// every bound. Percentiles are estimated from the buckets.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []int64   `json:"counts"`
+	Count  int64     `json:"count"`
+	Sum    float64   `json:"sum"`
+	P50    float64   `json:"p50"`
+	P95    float64   `json:"p95"`
+	P99    float64   `json:"p99"`
+}
+
+// RecognitionMetrics describes the recognition pipeline since the API
+// started, to help tune ATTENDANCE_MIN_CONFIDENCE and the face service
+type RecognitionMetrics struct {
+	Since         time.Time `json:"since"`
+	MinConfidence float64   `json:"min_confidence"`
+
+	// Calls are the submissions sent to the face service, and their latency
+	// includes waiting for a slot under FACE_API_MAX_CONCURRENT
+	Calls          int64     `json:"calls"`
+	FaceAPILatency Histogram `json:"face_api_latency_ms"`
+	Timeouts       int64     `json:"timeouts"`
+	Busy           int64     `json:"busy"`   // turned away by the concurrency limit
+	Errors         int64     `json:"errors"` // other failed calls
+
+	// Faces in the images the face service answered for. Confidence is of
+	// the faces it matched to a person, before MinConfidence is applied.
+	NoFace        int64     `json:"no_face_detected"`
+	Matched       int64     `json:"matched"`
+	LowConfidence int64     `json:"low_confidence"` // matches rejected below MinConfidence
+	Unknown       int64     `json:"unknown"`        // faces the face service did not match
+	Confidence    Histogram `json:"match_confidence"`
+}
+
+// Outcomes of the checks of the liveness and readiness probes
+const (
+	CheckOK      = "ok"
+	CheckFailing = "failing"
+	CheckSkipped = "skipped" // cannot be checked, does not fail the probe
+)
+
+// DependencyCheck is the outcome of checking one dependency of the API
+type DependencyCheck struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ProbeResult answers a liveness or readiness probe. Status is "ok" unless
+// a check failed.
+type ProbeResult struct {
+	Status string                     `json:"status"`
+	Checks map[string]DependencyCheck `json:"checks"`
+}
+
+// ExperimentMatch is a person recognized in a submission under one
+// configuration
+type ExperimentMatch struct {
+	Name       string  `json:"name"`
+	Confidence float64 `json:"confidence"`
+}
+
+// ExperimentOutcome compares how the stable and the candidate configuration
+// judged one sampled submission
+type ExperimentOutcome struct {
+	ID         string            `json:"id"`
+	Experiment string            `json:"experiment"`
+	Timestamp  time.Time         `json:"timestamp"`
+	DeviceID   string            `json:"device_id,omitempty"`
+	Location   string            `json:"location,omitempty"`
+	Stable     []ExperimentMatch `json:"stable"`
+	Candidate  []ExperimentMatch `json:"candidate"`
+	Agree      bool              `json:"agree"`
+	Error      string            `json:"error,omitempty"` // the candidate failed, nothing to compare
+}
+
+// ExperimentReport sums up the outcomes of a canary experiment
+type ExperimentReport struct {
+	Experiment string    `json:"experiment"`
+	Active     bool      `json:"active"` // the experiment currently running
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Compared   int       `json:"compared"`
+	Agreed     int       `json:"agreed"`
+	Disagreed  int       `json:"disagreed"`
+	// StableOnly counts submissions where the stable configuration
+	// recognized someone the candidate did not, CandidateOnly the reverse.
+	// A submission can count in both.
+	StableOnly       int                 `json:"stable_only"`
+	CandidateOnly    int                 `json:"candidate_only"`
+	Errors           int                 `json:"errors"`
+	DisagreementRate float64             `json:"disagreement_rate"`
+	Disagreements    []ExperimentOutcome `json:"disagreements"` // most recent first
+}
+
+// Event stream types. Every type but stats_updated is also delivered to
+// webhooks and the event bus.
+const (
+	EventAttendance    = "attendance"
+	EventMisplaced     = "misplaced"
+	EventUnknownPerson = "unknown_person"
+	EventFaceAdded     = "face_added"
+	EventFaceRemoved   = "face_removed"
+	EventDeviceOffline = "device_offline"
+	EventDeviceOnline  = "device_online"
+	EventDoorCommand   = "door_command"
+	EventDeviceConfig  = "device_config_changed"
+	EventEmergency     = "emergency"
+	EventEmergencyEnd  = "emergency_ended"
+	EventRecognized    = "recognition_completed"
+	EventStatsUpdated  = "stats_updated"
+)
+
+// SSEMessage represents a server-sent event message. One payload is set,
+// depending on the event type.
 type SSEMessage struct {
-	Event string           `json:"event"`
-	Data  AttendanceRecord `json:"data"`
+	// ID increases with every broadcast event, so a reconnecting client can
+	// say which events it has seen. stats_updated events have none, as they
+	// are never replayed.
+	ID    uint64 `json:"id,omitempty"`
+	Event string `json:"event"`
+
+	Record    *AttendanceRecord      `json:"-"` // attendance, misplaced and unknown_person
+	Face      *FaceChange            `json:"-"` // face_added and face_removed
+	Device    *DeviceStatus          `json:"-"` // device_offline and device_online
+	Command   *DoorCommand           `json:"-"` // door_command
+	Config    *DeviceSettings        `json:"-"` // device_config_changed
+	Emergency *Emergency             `json:"-"` // emergency and emergency_ended
+	Job       *Job                   `json:"-"` // recognition_completed
+	Stats     map[string]interface{} `json:"-"` // stats_updated, as served by GET /attendance/stats
+}
+
+// Data returns the event's payload
+func (m SSEMessage) Data() interface{} {
+	switch {
+	case m.Record != nil:
+		return m.Record
+	case m.Face != nil:
+		return m.Face
+	case m.Device != nil:
+		return m.Device
+	case m.Command != nil:
+		return m.Command
+	case m.Config != nil:
+		return m.Config
+	case m.Emergency != nil:
+		return m.Emergency
+	case m.Job != nil:
+		return m.Job
+	default:
+		return m.Stats
+	}
+}
+
+// Subject is the name of the person the event is about; stats_updated,
+// device and door events are about no one
+func (m SSEMessage) Subject() string {
+	switch {
+	case m.Record != nil:
+		return m.Record.Name
+	case m.Face != nil:
+		return m.Face.Name
+	}
+	return ""
+}
+
+// FaceChange is the payload of face_added and face_removed events
+type FaceChange struct {
+	Name      string    `json:"name"`
+	Images    int       `json:"images"` // images added or removed
+	Timestamp time.Time `json:"timestamp"`
+	Actor     *Actor    `json:"actor,omitempty"`
+}
+
+// StreamStats describes the event stream fan-out. Delivered, Dropped and
+// SlowDisconnected count since the start, across all clients.
+type StreamStats struct {
+	Clients          int                 `json:"clients"`
+	MaxClients       int                 `json:"max_clients,omitempty"`
+	ClientBuffer     int                 `json:"client_buffer"`
+	SlowClient       string              `json:"slow_client_policy"`
+	FanOutQueued     int                 `json:"fan_out_queued"` // broadcast events not yet handed to the clients
+	Delivered        int64               `json:"delivered"`
+	Dropped          int64               `json:"dropped"`
+	SlowDisconnected int64               `json:"slow_disconnected"`
+	FanOutDropped    int64               `json:"fan_out_dropped"` // events no client got, the fan-out being too far behind
+	Streams          []StreamClientStats `json:"streams"`
+}
+
+// StreamClientStats describes one connected event stream client
+type StreamClientStats struct {
+	ID          string    `json:"id"`
+	Person      string    `json:"person,omitempty"`
+	ConnectedAt time.Time `json:"connected_at"`
+	Queued      int       `json:"queued"`
+	Sent        int64     `json:"sent"`
+	Dropped     int64     `json:"dropped"`
+}
+
+// StreamFilter selects the events a stream client receives. Empty fields
+// match every event.
+type StreamFilter struct {
+	// Person makes a personal stream, which only carries that person's
+	// events and hides who recorded them
+	Person string
+	Events []string // event types, e.g. "attendance" or "misplaced"
+	Name   string
+	Status string // "authorized" or "unauthorized"
+}
+
+// Matches reports whether an event passes the filter. Events about no one
+// only pass filters that do not name a person, and only records have a
+// status.
+func (f StreamFilter) Matches(msg SSEMessage) bool {
+	switch {
+	case len(f.Events) > 0 && !slices.Contains(f.Events, msg.Event):
+		return false
+	case f.Person != "" && f.Person != msg.Subject():
+		return false
+	case f.Name != "" && f.Name != msg.Subject():
+		return false
+	case f.Status != "" && (msg.Record == nil || f.Status != msg.Record.Status):
+		return false
+	}
+	return true
+}
+
+// API key scopes
+const (
+	ScopeAttendanceWrite = "attendance:write"
+	ScopeFacesAdmin      = "faces:admin"
+	ScopeReportsRead     = "reports:read"   // aggregate reports and totals
+	ScopeRecordsRead     = "records:read"   // raw attendance records
+	ScopeSnapshotsRead   = "snapshots:read" // captured images of unknown faces
+	ScopeKeysAdmin       = "keys:admin"
+	ScopeAttendanceAdmin = "attendance:admin"
+	ScopeReplication     = "replication"
+	ScopeAttendanceSelf  = "attendance:self" // the key's own person only
+)
+
+// AllScopes lists every scope an API key can be granted
+var AllScopes = []string{ScopeAttendanceWrite, ScopeFacesAdmin, ScopeReportsRead, ScopeRecordsRead, ScopeSnapshotsRead,
+	ScopeKeysAdmin, ScopeAttendanceAdmin, ScopeReplication, ScopeAttendanceSelf}
+
+// APIKey represents a provisioned API key. The secret itself is only
+// returned once, when the key is created.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Tenant     string     `json:"tenant,omitempty"`
+	Person     string     `json:"person,omitempty"` // the person an attendance:self key belongs to
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Device is a registered camera or door controller. It authenticates with
+// its own token, which is only returned when the device is registered or
+// the token is rotated; records it submits carry its ID.
+type Device struct {
+	ID          string     `json:"id"` // as sent in device_id, e.g. "front-door-cam"
+	Name        string     `json:"name"`
+	Location    string     `json:"location,omitempty"`
+	Tenant      string     `json:"tenant,omitempty"`
+	TokenPrefix string     `json:"token_prefix"`
+	Disabled    bool       `json:"disabled"`
+	LastSeenAt  *time.Time `json:"last_seen_at,omitempty"`
+	Offline     bool       `json:"offline"` // not heard from within DEVICE_OFFLINE_AFTER
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Device statuses
+const (
+	DeviceOnline  = "online"
+	DeviceOffline = "offline"
+)
+
+// DeviceStatus is the payload of device_offline and device_online events
+type DeviceStatus struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Location   string     `json:"location,omitempty"`
+	Status     string     `json:"status"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	Timestamp  time.Time  `json:"timestamp"`
+}
+
+// DeviceSettings is the configuration a device runs with, kept on the
+// server so it can be changed without reflashing the firmware. Settings
+// left unset keep the device's own default. It is also the payload of
+// device_config_changed events.
+type DeviceSettings struct {
+	Device            string     `json:"device"`
+	RelaySeconds      *int       `json:"relay_seconds,omitempty"`       // how long the relay holds the door open
+	Threshold         *float64   `json:"threshold,omitempty"`           // face detection score needed before a capture is sent
+	CaptureIntervalMS *int       `json:"capture_interval_ms,omitempty"` // pause between captures
+	Version           int        `json:"version"`                       // bumped on every change, 0 until first set
+	UpdatedAt         *time.Time `json:"updated_at,omitempty"`
+}
+
+// Commands a device can be sent through its queue
+const (
+	DeviceCommandOpen         = "open"          // open the door
+	DeviceCommandReboot       = "reboot"        // restart the device
+	DeviceCommandUpdateConfig = "update_config" // fetch the settings again
+)
+
+// DeviceCommands lists the commands a device can be sent
+var DeviceCommands = []string{DeviceCommandOpen, DeviceCommandReboot, DeviceCommandUpdateConfig}
+
+// Device command states. A command is pending until a device fetches it and
+// delivered until the device acknowledges it as done or failed; one never
+// acknowledged expires.
+const (
+	CommandPending   = "pending"
+	CommandDelivered = "delivered"
+	CommandDone      = "done"
+	CommandFailed    = "failed"
+	CommandExpired   = "expired"
+	CommandCancelled = "cancelled"
+)
+
+// DeviceCommand is a command queued for a device
+type DeviceCommand struct {
+	ID          string                 `json:"id"`
+	Device      string                 `json:"device"`
+	Command     string                 `json:"command"`
+	Params      map[string]interface{} `json:"params,omitempty"`
+	Status      string                 `json:"status"`
+	Attempts    int                    `json:"attempts"` // how often it was delivered
+	Result      string                 `json:"result,omitempty"`
+	Actor       *Actor                 `json:"actor,omitempty"`
+	CreatedAt   time.Time              `json:"created_at"`
+	ExpiresAt   time.Time              `json:"expires_at"`
+	DeliveredAt *time.Time             `json:"delivered_at,omitempty"`
+	AckedAt     *time.Time             `json:"acked_at,omitempty"`
+}
+
+// HasScope reports whether the key grants the given scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// User roles
+const (
+	RoleAdmin  = "admin"  // everything, including user and key administration
+	RoleViewer = "viewer" // dashboards: reports and attendance records
+	RoleDevice = "device" // submitting attendance
+)
+
+// RoleScopes lists the scopes each user role is granted by default;
+// AUTH_ROLES may redefine viewer and device and add roles
+var RoleScopes = map[string][]string{
+	RoleAdmin:  AllScopes,
+	RoleViewer: {ScopeReportsRead, ScopeRecordsRead},
+	RoleDevice: {ScopeAttendanceWrite},
+}
+
+// Role is a user role of the access policy with the scopes it grants
+type Role struct {
+	Name    string   `json:"name"`
+	Scopes  []string `json:"scopes"`
+	Builtin bool     `json:"builtin"`
+}
+
+// User is an account that signs in with a password and gets JWTs carrying
+// its role
+type User struct {
+	ID          string     `json:"id"`
+	Username    string     `json:"username"`
+	Role        string     `json:"role"`
+	Tenant      string     `json:"tenant,omitempty"`
+	Disabled    bool       `json:"disabled"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// TokenPair is issued at login and on refresh. The access token is a JWT
+// sent as a bearer token; the refresh token can be used once to get a new
+// pair.
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresIn        int       `json:"expires_in"` // seconds
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// WebAuthnCredential is a security key or passkey a user registered for
+// step-up authentication
+type WebAuthnCredential struct {
+	ID         string     `json:"id"` // base64url credential ID
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// StepUp proves a recent WebAuthn assertion. Its token is sent as the
+// X-Step-Up header of destructive requests until it expires.
+type StepUp struct {
+	Token     string    `json:"step_up_token"`
+	ExpiresIn int       `json:"expires_in"` // seconds
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Audit log actions
+const (
+	AuditExportRecords  = "export.records"  // raw attendance records
+	AuditExportReport   = "export.report"   // an aggregate report as a file
+	AuditExportSnapshot = "export.snapshot" // a captured image
+
+	AuditFaceUpload       = "face.upload"       // images enrolled for a person
+	AuditFaceDelete       = "face.delete"       // a person removed from the face service
+	AuditConfigChange     = "config.change"     // shifts, holidays, expected locations, API keys and users
+	AuditAttendanceManual = "attendance.manual" // records entered by hand rather than recognized
+	AuditDoorCommand      = "door.command"      // a door opened or closed remotely
+	AuditDeviceCommand    = "device.command"    // a command queued for a device
+	AuditEmergency        = "door.emergency"    // a lockdown or unlock-all started or lifted
+)
+
+// AuditEntry records who did what through the API, and from where
+type AuditEntry struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Actor     Actor     `json:"actor"`
+	IP        string    `json:"ip,omitempty"`
+	Action    string    `json:"action"`
+	Resource  string    `json:"resource"` // the path acted on
+	Summary   string    `json:"summary,omitempty"`
+	Rows      *int      `json:"rows,omitempty"` // rows handed out by an export
+}
+
+// DeviceClock is the clock skew observed for a device. Skews are the
+// device's time minus the server's when the request arrived, so they
+// include the network delay.
+type DeviceClock struct {
+	DeviceID  string    `json:"device_id"`
+	SkewMs    int64     `json:"skew_ms"`     // last observed
+	MaxSkewMs int64     `json:"max_skew_ms"` // furthest off observed, signed
+	Samples   int       `json:"samples"`
+	LastSeen  time.Time `json:"last_seen"`
+	OutOfSync bool      `json:"out_of_sync"` // last skew beyond DEVICE_CLOCK_MAX_SKEW
+}
+
+// Building signals that can be mapped to BMS points. Door signals are set
+// for a moment after each event; occupancy is the number of people checked
+// in and not yet out.
+const (
+	SignalDoorOpen   = "door_open"   // an authorized recognition opened a door
+	SignalDoorDenied = "door_denied" // a recognition was refused
+	SignalOccupancy  = "occupancy"
+)
+
+// BuildingPoint is a BMS register or object the bridge writes a signal to,
+// with the last value written
+type BuildingPoint struct {
+	Signal    string     `json:"signal"`
+	Device    string     `json:"device,omitempty"` // door signals of this device only
+	Address   string     `json:"address"`
+	Value     *float64   `json:"value,omitempty"`
+	WrittenAt *time.Time `json:"written_at,omitempty"`
+	Error     string     `json:"error,omitempty"` // of the last write, when it failed
+}
+
+// BuildingStatus describes the building bridge and its points
+type BuildingStatus struct {
+	Enabled   bool            `json:"enabled"`
+	Protocol  string          `json:"protocol,omitempty"`
+	Target    string          `json:"target,omitempty"`
+	Occupancy int             `json:"occupancy"`
+	Points    []BuildingPoint `json:"points"`
+}
+
+// Webhook event types are the event stream's, but for stats_updated;
+// unknown_person is an attendance event of a face nobody is enrolled as.
+const (
+	WebhookAttendance    = EventAttendance
+	WebhookMisplaced     = EventMisplaced
+	WebhookFaceAdded     = EventFaceAdded
+	WebhookFaceRemoved   = EventFaceRemoved
+	WebhookUnknownPerson = EventUnknownPerson
+	WebhookDeviceOffline = EventDeviceOffline
+	WebhookDeviceOnline  = EventDeviceOnline
+	WebhookDoorCommand   = EventDoorCommand
+	WebhookDeviceConfig  = EventDeviceConfig
+	WebhookEmergency     = EventEmergency
+	WebhookEmergencyEnd  = EventEmergencyEnd
+	WebhookRecognized    = EventRecognized
+	WebhookTest          = "test" // sent by the test-fire endpoint only
+)
+
+// WebhookEventTypes lists the event types a webhook can subscribe to
+var WebhookEventTypes = []string{WebhookAttendance, WebhookMisplaced, WebhookFaceAdded, WebhookFaceRemoved, WebhookUnknownPerson,
+	WebhookDeviceOffline, WebhookDeviceOnline, WebhookDoorCommand, WebhookDeviceConfig, WebhookEmergency, WebhookEmergencyEnd,
+	WebhookRecognized}
+
+// Webhook is an external endpoint that events are POSTed to, signed with
+// its secret
+type Webhook struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"` // empty receives every type
+	Description string    `json:"description,omitempty"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// WebhookEvent is the body POSTed to a webhook, and published to the event
+// bus. The ID stays the same across the attempts of a delivery, so receivers
+// can discard duplicates.
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending" // waiting for its next attempt
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed" // out of attempts
+)
+
+// WebhookDelivery is an event sent, or to be sent, to a webhook, with the
+// log of its attempts
+type WebhookDelivery struct {
+	ID          string           `json:"id"`
+	WebhookID   string           `json:"webhook_id"`
+	EventID     string           `json:"event_id"`
+	Event       string           `json:"event"`
+	Status      string           `json:"status"`
+	Attempts    int              `json:"attempts"`
+	Retries     int              `json:"retries"`
+	NextAttempt *time.Time       `json:"next_attempt,omitempty"`
+	CreatedAt   time.Time        `json:"created_at"`
+	DeliveredAt *time.Time       `json:"delivered_at,omitempty"`
+	Log         []WebhookAttempt `json:"log"`
+}
+
+// WebhookAttempt is one try at delivering an event. StatusCode is zero when
+// no response came back.
+type WebhookAttempt struct {
+	Attempt     int       `json:"attempt"`
+	AttemptedAt time.Time `json:"attempted_at"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	LatencyMs   int64     `json:"latency_ms"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// ClientUsage is the API usage of one client from one device, over a day
+// or a period. Clients are API keys and users; requests without a key are
+// told apart by their IP address.
+type ClientUsage struct {
+	Day           string         `json:"day,omitempty"` // set on daily rows
+	ClientType    string         `json:"client_type"`
+	ClientID      string         `json:"client_id"`
+	ClientName    string         `json:"client_name,omitempty"`
+	Device        string         `json:"device,omitempty"`
+	Requests      int64          `json:"requests"`
+	ClientErrors  int64          `json:"client_errors"` // answered 4xx
+	ServerErrors  int64          `json:"server_errors"` // answered 5xx
+	ErrorRate     float64        `json:"error_rate"`    // share of requests answered 4xx or 5xx
+	PeakPerMinute int64          `json:"peak_per_minute"`
+	LatencyMs     LatencySummary `json:"latency_ms"`
+	LastSeen      time.Time      `json:"last_seen"`
+}
+
+// LatencySummary describes the time to the first byte of the responses to
+// a client, in milliseconds. Percentiles are estimated from a histogram.
+type LatencySummary struct {
+	Avg float64 `json:"avg"`
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// AuditQuery filters the audit log; zero values match everything
+type AuditQuery struct {
+	Action  string
+	ActorID string
+	From    time.Time
+	To      time.Time // exclusive
+	Limit   int
+	Offset  int
+}
+
+// Actor types
+const (
+	ActorAPIKey    = "api_key"
+	ActorUser      = "user"
+	ActorDevice    = "device"    // a registered device presenting its token
+	ActorAnonymous = "anonymous" // no key, only possible with authentication disabled
+	ActorSystem    = "system"    // background work such as folder ingestion
+)
+
+// Actor identifies who or what initiated an operation. It is resolved once
+// per request and travels in the context to every record and log line.
+type Actor struct {
+	Type   string `json:"type"`
+	ID     string `json:"id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+	Device string `json:"device,omitempty"`
+
+	// Location is where a registered device is installed
+	Location string `json:"location,omitempty"`
+}
+
+// String formats the actor for log lines as type:id/tenant@device
+func (a Actor) String() string {
+	s := a.Type
+	if a.ID != "" {
+		s += ":" + a.ID
+	}
+	if a.Tenant != "" {
+		s += "/" + a.Tenant
+	}
+	if a.Device != "" {
+		s += "@" + a.Device
+	}
+	return s
+}
+
+type actorContextKey struct{}
+
+// WithActor returns a context carrying the actor
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the actor of the context. Work that did not
+// start from a request is attributed to the system.
+func ActorFromContext(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(actorContextKey{}).(Actor); ok {
+		return actor
+	}
+	return Actor{Type: ActorSystem}
+}
+
+type requestIDContextKey struct{}
+
+// WithRequestID returns a context carrying the ID of the request it serves
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestIDFromContext returns the ID of the request the context serves, or
+// "" outside a request
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// EnrollmentPlan describes what an enrollment would change on the face
+// service without applying it (dry run)
+type EnrollmentPlan struct {
+	Name            string                 `json:"name"`
+	PersonExists    bool                   `json:"person_exists"`
+	ExistingImages  int                    `json:"existing_images"`
+	ImagesReceived  int                    `json:"images_received"`
+	ImagesToAdd     int                    `json:"images_to_add"`
+	ImagesRejected  int                    `json:"images_rejected"`
+	ResultingImages int                    `json:"resulting_images"`
+	Images          []EnrollmentImageCheck `json:"images"`
+
+	// Suggestions are enrolled names that are probably the same person,
+	// listed when the name is new
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// EnrollmentImageCheck is the validation outcome of a single image
+type EnrollmentImageCheck struct {
+	Filename      string   `json:"filename"`
+	Size          int      `json:"size"`
+	FacesDetected int      `json:"faces_detected"`
+	MatchedName   string   `json:"matched_name,omitempty"`
+	Confidence    float64  `json:"confidence,omitempty"`
+	DuplicateOf   string   `json:"duplicate_of,omitempty"`
+	WouldAdd      bool     `json:"would_add"`
+	Errors        []string `json:"errors,omitempty"`
+	Warnings      []string `json:"warnings,omitempty"`
+
+	// Quality is null for images that could not be analyzed locally
+	Quality *PhotoQuality `json:"quality,omitempty"`
+}
+
+// PhotoQuality scores an enrollment photo from 0 to 100, with what to
+// change when taking it again. FaceRatio is only known when the photo was
+// run through recognition.
+type PhotoQuality struct {
+	Score      int      `json:"score"`
+	Brightness float64  `json:"brightness"` // mean luminance, 0-255
+	Sharpness  float64  `json:"sharpness"`  // variance of the Laplacian
+	FaceRatio  float64  `json:"face_ratio,omitempty"`
+	Guidance   []string `json:"guidance,omitempty"`
+}
+
+// EnrollmentResult is what the face service did with the images of an
+// enrollment. Images are listed in the order they were submitted.
+type EnrollmentResult struct {
+	Name   string            `json:"name"`
+	Added  int               `json:"images_added"`
+	Failed int               `json:"images_failed"`
+	Images []EnrollmentImage `json:"images"`
+}
+
+// Tally sets Added and Failed from the image outcomes
+func (r *EnrollmentResult) Tally() {
+	r.Added, r.Failed = 0, 0
+	for _, image := range r.Images {
+		if image.Added {
+			r.Added++
+		} else {
+			r.Failed++
+		}
+	}
+}
+
+// EnrollmentImage is the outcome of a single enrollment image
+type EnrollmentImage struct {
+	Filename string `json:"filename"`
+	Added    bool   `json:"added"`
+	StoredAs string `json:"stored_as,omitempty"` // file name on the face service
+	Error    string `json:"error,omitempty"`
+
+	Quality *PhotoQuality `json:"quality,omitempty"`
+}
+
+// What happens to the attendance history of a removed face
+const (
+	HistoryKeep      = "keep"
+	HistoryAnonymize = "anonymize"
+	HistoryDelete    = "delete"
+)
+
+// FaceRemoval is the outcome of removing a person from the face service
+type FaceRemoval struct {
+	Name             string   `json:"name"`
+	ImagesRemoved    int      `json:"images_removed"`
+	Images           []string `json:"images,omitempty"` // listed on dry runs only
+	History          string   `json:"history"`
+	RecordsAffected  int64    `json:"records_affected"`
+	AnonymizedAs     string   `json:"anonymized_as,omitempty"`
+	SnapshotsDeleted int      `json:"snapshots_deleted,omitempty"`
+}
+
+// PeopleMerge is the outcome of consolidating two identities of the same
+// person into one
+type PeopleMerge struct {
+	Source        string `json:"source"`
+	Target        string `json:"target"`
+	PersonID      string `json:"person_id,omitempty"`
+	ImagesMoved   int    `json:"images_moved"`
+	RecordsMoved  int64  `json:"records_moved"`
+	SessionsMoved int64  `json:"sessions_moved"`
+	ChangeID      string `json:"change_id"` // audit entry that can revert the merge
+}
+
+// ImageMove is an enrollment image moved from one person to another on the
+// face service, by stored file name
+type ImageMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// PersonSplit selects what moves from a person to a new identity: the listed
+// face images, and the attendance records listed or recorded in the period.
+// The sessions of days left without records of the person move with them.
+type PersonSplit struct {
+	Name    string // of the new identity
+	Images  []string
+	Records []string
+	From    time.Time
+	To      time.Time // exclusive
+}
+
+// Identity change types
+const (
+	IdentityMerge = "merge"
+	IdentitySplit = "split"
+)
+
+// IdentityChange is the audit entry of a merge or split of person
+// identities. What was moved is kept with it so the change can be reverted.
+type IdentityChange struct {
+	ID            string      `json:"id"`
+	Type          string      `json:"type"`
+	Source        string      `json:"source"`
+	Target        string      `json:"target"`
+	Images        []ImageMove `json:"images"`
+	RecordsMoved  int64       `json:"records_moved"`
+	SessionsMoved int64       `json:"sessions_moved"`
+	ChangedBy     string      `json:"changed_by"`
+	CreatedAt     time.Time   `json:"created_at"`
+	RevertedAt    *time.Time  `json:"reverted_at,omitempty"`
+	RevertedBy    string      `json:"reverted_by,omitempty"`
+}
+
+// Job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// JobRecognition is the type of the jobs of asynchronous attendance
+// requests, whose result is the AttendanceResponse
+const JobRecognition = "recognition"
+
+// Job is a unit of background work tracked through the job status API
+type Job struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Status     string          `json:"status"`
+	Done       int             `json:"done"`
+	Total      int             `json:"total"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+
+	// Owner is the actor that submitted the job; only it may read a
+	// recognition job without reports:read
+	Owner string `json:"-"`
+}
+
+// ImportMapping maps attendance fields to column headers of an import file
+type ImportMapping struct {
+	Name       string `json:"name"`
+	Timestamp  string `json:"timestamp"`
+	Status     string `json:"status,omitempty"`
+	Confidence string `json:"confidence,omitempty"`
+	DeviceID   string `json:"device_id,omitempty"`
+	ExternalID string `json:"external_id,omitempty"`
+}
+
+// ImportRowError reports why a row of an import file was rejected. Rows are
+// numbered as in the file, the header being row 1.
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// ImportResult is the outcome of a historical attendance import
+type ImportResult struct {
+	Rows       int              `json:"rows"`
+	Imported   int              `json:"imported"`
+	Duplicates int              `json:"duplicates"`
+	Rejected   int              `json:"rejected"`
+	Errors     []ImportRowError `json:"errors"`
+}
+
+// LocationAssignment lists the locations a person is expected at
+type LocationAssignment struct {
+	Name      string   `json:"name"`
+	Locations []string `json:"locations"`
+}
+
+// Door is an entrance with access rules of its own, optionally part of a
+// zone whose rules apply to all of its doors
+type Door struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Zone      string     `json:"zone,omitempty"`
+	Access    DoorAccess `json:"access"` // granted on the door itself
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Zone is a group of doors sharing access rules
+type Zone struct {
+	Name   string     `json:"name"`
+	Doors  []string   `json:"doors"`
+	Access DoorAccess `json:"access"`
+}
+
+// DoorAccess lists who may pass a door, or every door of a zone. A door
+// without grants on itself or its zone lets every authorized person pass.
+type DoorAccess struct {
+	People      []string `json:"people"`
+	Departments []string `json:"departments"`
+}
+
+// IsEmpty reports whether nobody is granted access
+func (a DoorAccess) IsEmpty() bool {
+	return len(a.People) == 0 && len(a.Departments) == 0
+}
+
+// Door commands sent to the devices of a door
+const (
+	DoorCommandOpen  = "open_door"
+	DoorCommandClose = "keep_closed"
+)
+
+// DoorCommand is the payload of door_command events: an operator opening or
+// closing a door remotely, e.g. to let in a courier nobody enrolled
+type DoorCommand struct {
+	ID        string    `json:"id"`
+	Door      string    `json:"door"`
+	Devices   []string  `json:"devices,omitempty"` // the door's devices in ATTENDANCE_DOORS
+	Command   string    `json:"command"`           // "open_door" or "keep_closed"
+	Seconds   int       `json:"seconds,omitempty"` // how long to hold the door open, the device's default when zero
+	Reason    string    `json:"reason,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Actor     *Actor    `json:"actor,omitempty"`
+}
+
+// Emergency modes, which override every door until lifted or expired
+const (
+	EmergencyLockdown  = "lockdown"   // every door stays closed, whoever is recognized
+	EmergencyUnlockAll = "unlock_all" // every door opens for anyone, e.g. to evacuate
+)
+
+// Emergency is a lockdown or unlock-all in force on every door, and the
+// payload of emergency and emergency_ended events
+type Emergency struct {
+	ID        string     `json:"id"`
+	Mode      string     `json:"mode"`
+	Reason    string     `json:"reason,omitempty"`
+	StartedAt time.Time  `json:"started_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"` // set once lifted or expired
+	Actor     *Actor     `json:"actor,omitempty"`
+}
+
+// Action is what every door does during the emergency
+func (e *Emergency) Action() string {
+	if e.Mode == EmergencyUnlockAll {
+		return DoorCommandOpen
+	}
+	return DoorCommandClose
+}
+
+// Door schedule modes, from the least to the most restrictive
+const (
+	DoorUnlocked = "unlocked" // the door opens for anyone
+	DoorFaceOnly = "face"     // the door opens for authorized faces
+	DoorLocked   = "locked"   // the door stays closed
+)
+
+// DoorSchedule puts a door in a mode during a window of the week, or on
+// holidays. Outside every window a door is face-only.
+type DoorSchedule struct {
+	ID        string    `json:"id"`
+	Door      string    `json:"door"`
+	Name      string    `json:"name"`
+	Mode      string    `json:"mode"`
+	Start     string    `json:"start"`    // HH:MM, server local time
+	End       string    `json:"end"`      // HH:MM, before Start to end the next day, equal to Start for the whole day
+	Weekdays  []int     `json:"weekdays"` // 0 = Sunday; empty means every day
+	Holidays  bool      `json:"holidays"` // on holidays instead of on the weekdays
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SecurityReport collects security-relevant attendance events in a period
+type SecurityReport struct {
+	From                  time.Time          `json:"from"`
+	To                    time.Time          `json:"to"`
+	UnauthorizedAttempts  int                `json:"unauthorized_attempts"`
+	MisplacedRecognitions int                `json:"misplaced_recognitions"`
+	ObserveOnlyEvents     int                `json:"observe_only_events"` // of the above, from soft-launch devices
+	Unauthorized          []AttendanceRecord `json:"unauthorized"`
+	Misplaced             []AttendanceRecord `json:"misplaced"`
+}
+
+// Security event types forwarded to a SIEM
+const (
+	SecurityUnauthorized = "unauthorized_attempt"  // a face was denied entry
+	SecurityMisplaced    = "misplaced_recognition" // recognized away from their assigned locations
+	SecurityAuthFailure  = "auth_failure"          // a request was refused for its API key
+	SecurityAdminAction  = "admin_action"          // a request changed configuration or data
+)
+
+// SecurityEventTypes lists every security event type
+var SecurityEventTypes = []string{SecurityUnauthorized, SecurityMisplaced, SecurityAuthFailure, SecurityAdminAction}
+
+// SecurityEvent is a security-relevant event as exported to a SIEM.
+// Attendance events carry the record's fields, request events the request's.
+type SecurityEvent struct {
+	Type      string    `json:"type"`
+	Severity  int       `json:"severity"` // 0-10, as in CEF
+	Timestamp time.Time `json:"timestamp"`
+	Message   string    `json:"message"`
+
+	RecordID   string  `json:"record_id,omitempty"`
+	Name       string  `json:"name,omitempty"`
+	PersonID   string  `json:"person_id,omitempty"`
+	Confidence float64 `json:"confidence,omitempty"`
+	DeviceID   string  `json:"device_id,omitempty"`
+	Location   string  `json:"location,omitempty"`
+
+	Actor    string `json:"actor,omitempty"`
+	SourceIP string `json:"source_ip,omitempty"`
+	Method   string `json:"method,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Status   int    `json:"status,omitempty"`
+}
+
+// AbsenceReport lists the enrolled people who were not recognized on a day
+type AbsenceReport struct {
+	Date     string   `json:"date"`
+	Workday  bool     `json:"workday"`
+	Holiday  string   `json:"holiday,omitempty"`
+	Source   string   `json:"source,omitempty"` // "face_api" or "people"
+	Expected int      `json:"expected"`
+	Present  int      `json:"present"`
+	Absent   []string `json:"absent"`
+	OffShift []string `json:"off_shift,omitempty"` // enrolled, but no shift on this weekday
+}
+
+// MonthlyReport is the attendance of every person over one month, day by
+// day, as exported for payroll
+type MonthlyReport struct {
+	Month  string        `json:"month"` // YYYY-MM
+	Days   []CalendarDay `json:"days"`
+	People []PersonMonth `json:"people"`
+}
+
+// PersonMonth is one person's month: a row per day and the totals
+type PersonMonth struct {
+	Name              string      `json:"name"`
+	FullName          string      `json:"full_name,omitempty"`
+	EmployeeNumber    string      `json:"employee_number,omitempty"`
+	Department        string      `json:"department,omitempty"`
+	Days              []PersonDay `json:"days"`
+	DaysPresent       int         `json:"days_present"`
+	WorkdaysAbsent    int         `json:"workdays_absent"` // up to today
+	LateDays          int         `json:"late_days"`
+	LateMinutes       int         `json:"late_minutes"`
+	EarlyLeaves       int         `json:"early_leaves"`
+	EarlyLeaveMinutes int         `json:"early_leave_minutes"`
+	WorkedHours       float64     `json:"worked_hours"`
+	Recognitions      int         `json:"recognitions"`
+}
+
+// PeriodReport sums up attendance over a period for printing: the totals,
+// a row per person and the security events
+type PeriodReport struct {
+	From        time.Time       `json:"from"`
+	To          time.Time       `json:"to"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Records     int             `json:"records"`
+	Authorized  int             `json:"authorized"`
+	People      []PersonPeriod  `json:"people"`
+	Security    *SecurityReport `json:"security"` // unauthorized and misplaced recognitions
+}
+
+// PersonPeriod is one person's attendance over the period of a PeriodReport
+type PersonPeriod struct {
+	Name         string    `json:"name"`
+	DaysPresent  int       `json:"days_present"`
+	Recognitions int       `json:"recognitions"`
+	LateDays     int       `json:"late_days"`
+	WorkedHours  float64   `json:"worked_hours"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+}
+
+// PersonDay is one person's attendance on one day of a MonthlyReport
+type PersonDay struct {
+	CalendarDay
+	FirstSeen         *time.Time `json:"first_seen,omitempty"`
+	LastSeen          *time.Time `json:"last_seen,omitempty"`
+	Recognitions      int        `json:"recognitions"`
+	LatenessMinutes   int        `json:"lateness_minutes"`
+	Late              bool       `json:"late"`
+	EarlyLeaveMinutes int        `json:"early_leave_minutes"`
+	EarlyLeave        bool       `json:"early_leave"`
+	WorkedHours       float64    `json:"worked_hours"`
+	OpenSession       bool       `json:"open_session"`
+}
+
+// IntegrityFinding is a single problem found by the integrity checker
+type IntegrityFinding struct {
+	Check      string `json:"check"`
+	Severity   string `json:"severity"` // "warning" or "error"
+	Message    string `json:"message"`
+	Repairable bool   `json:"repairable"`
+	Repaired   bool   `json:"repaired"`
+}
+
+// IntegrityCheck summarizes one check of an integrity run
+type IntegrityCheck struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"` // "ok", "problems" or "skipped"
+	Detail   string `json:"detail,omitempty"`
+	Findings int    `json:"findings"`
+}
+
+// IntegrityReport is the result of an integrity run
+type IntegrityReport struct {
+	StartedAt time.Time          `json:"started_at"`
+	Duration  string             `json:"duration"`
+	Repair    bool               `json:"repair"`
+	Repaired  int                `json:"repaired"`
+	Checks    []IntegrityCheck   `json:"checks"`
+	Findings  []IntegrityFinding `json:"findings"`
+}
+
+// Replication roles of a node
+const (
+	RoleStandalone = "standalone"
+	RoleActive     = "active"
+	RoleStandby    = "standby"
+)
+
+// ReplicationCursor marks how far a standby has replicated: the replication
+// log of the active node it follows and the last entry of it applied. While
+// the standby copies the replicated tables in full, Table and Key name the
+// last row copied.
+type ReplicationCursor struct {
+	Log   string `json:"log"`
+	Seq   int64  `json:"seq"`
+	Table string `json:"table,omitempty"`
+	Key   string `json:"key,omitempty"`
+}
+
+// ReplicatedTable carries rows of one table in the replication stream.
+// With Replace set the rows replace the table contents; Deleted lists the
+// ids of rows removed since the cursor.
+type ReplicatedTable struct {
+	Name    string          `json:"name"`
+	Replace bool            `json:"replace,omitempty"`
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+	Deleted []string        `json:"deleted,omitempty"`
+}
+
+// ReplicationMessage is one line of the replication stream
+type ReplicationMessage struct {
+	Type   string             `json:"type"` // "changes" or "heartbeat"
+	SentAt time.Time          `json:"sent_at"`
+	Tables []ReplicatedTable  `json:"tables,omitempty"`
+	Cursor *ReplicationCursor `json:"cursor,omitempty"`
+}
+
+// StandbyInfo describes a standby connected to the active node
+type StandbyInfo struct {
+	Remote      string            `json:"remote"`
+	ConnectedAt time.Time         `json:"connected_at"`
+	Cursor      ReplicationCursor `json:"cursor"`
+}
+
+// ReplicationStatus reports the replication state of a node
+type ReplicationStatus struct {
+	Role          string             `json:"role"`
+	Primary       string             `json:"primary,omitempty"` // standby: the active node it follows
+	Connected     bool               `json:"connected"`
+	LastMessageAt *time.Time         `json:"last_message_at,omitempty"`
+	LastError     string             `json:"last_error,omitempty"`
+	Cursor        *ReplicationCursor `json:"cursor,omitempty"`
+	Standbys      []StandbyInfo      `json:"standbys"`
+}
+
+// Review states of an unknown-person event
+const (
+	UnknownPending   = "pending"
+	UnknownEnrolled  = "enrolled"
+	UnknownDismissed = "dismissed"
+)
+
+// UnknownEvent is a captured recognition of an unknown face awaiting review
+type UnknownEvent struct {
+	ID           string     `json:"id"`
+	AttendanceID string     `json:"attendance_id"`
+	Timestamp    time.Time  `json:"timestamp"`
+	DeviceID     string     `json:"device_id,omitempty"`
+	Location     string     `json:"location,omitempty"`
+	Confidence   float64    `json:"confidence"`
+	HasImage     bool       `json:"has_image"`
+	HasCrop      bool       `json:"has_crop"`
+	Status       string     `json:"status"`
+	EnrolledName string     `json:"enrolled_name,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+	ReviewedBy   string     `json:"reviewed_by,omitempty"`
+
+	ImageKey string `json:"-"`
+	CropKey  string `json:"-"`
+}
+
+// Snapshot capture policies: which recognitions have their image stored
+const (
+	CaptureNever         = "never"
+	CaptureUnknown       = "unknown"        // unknown faces only, for the review queue
+	CaptureUnauthorized  = "unauthorized"   // every denied recognition
+	CaptureLowConfidence = "low_confidence" // unknown faces and weak matches
+	CaptureAlways        = "always"
+)
+
+var CapturePolicies = []string{CaptureNever, CaptureUnknown, CaptureUnauthorized, CaptureLowConfidence, CaptureAlways}
+
+// CapturePolicy is the capture policy in force. A location's policy takes
+// precedence over its tenant's, and both over the default.
+type CapturePolicy struct {
+	Default       string            `json:"default"`
+	Tenants       map[string]string `json:"tenants"`
+	Locations     map[string]string `json:"locations"`
+	LowConfidence float64           `json:"low_confidence"` // matches below it are weak
+}
+
+// RecordSnapshot is the stored image of a recognized face. Unknown faces
+// are kept as UnknownEvent instead.
+type RecordSnapshot struct {
+	AttendanceID string    `json:"attendance_id"`
+	Timestamp    time.Time `json:"timestamp"`
+	Name         string    `json:"name"`
+	Status       string    `json:"status"`
+	Confidence   float64   `json:"confidence"`
+	DeviceID     string    `json:"device_id,omitempty"`
+	Location     string    `json:"location,omitempty"`
+	Tenant       string    `json:"tenant,omitempty"`
+	Policy       string    `json:"policy"` // the policy it was captured under
+	HasImage     bool      `json:"has_image"`
+	HasCrop      bool      `json:"has_crop"`
+
+	ImageKey string `json:"-"`
+	CropKey  string `json:"-"`
+}
+
+// PrivacyReport shows which images are kept: the capture policy in force
+// and the snapshots stored between From and To
+type PrivacyReport struct {
+	From         time.Time          `json:"from"`
+	To           time.Time          `json:"to"`
+	Policy       CapturePolicy      `json:"policy"`
+	UnknownFaces int                `json:"unknown_faces"` // still holding an image
+	Recognitions int                `json:"recognitions"`
+	Locations    []LocationCaptures `json:"locations"`
+}
+
+// LocationCaptures counts the snapshots stored at one location
+type LocationCaptures struct {
+	Location     string `json:"location"`
+	Policy       string `json:"policy"` // in force now, without tenant overrides
+	UnknownFaces int    `json:"unknown_faces"`
+	Recognitions int    `json:"recognitions"`
+}
+
+// Widget alert types
+const (
+	WidgetAlertUnknownPerson   = EventUnknownPerson
+	WidgetAlertAccessDenied    = "access_denied" // a known face turned away
+	WidgetAlertMisplaced       = EventMisplaced
+	WidgetAlertFaceServiceDown = "face_service_down"
+)
+
+// WidgetPresent is the present count widget of lobby displays
+type WidgetPresent struct {
+	Date     string `json:"date"`
+	Present  int    `json:"present"`            // people recognized today
+	Enrolled int    `json:"enrolled,omitempty"` // active people in the registry
+	Late     int    `json:"late"`
+}
+
+// WidgetArrival is one of the latest arrivals on the arrivals widget
+type WidgetArrival struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"` // the full name when the person has one
+	Timestamp time.Time `json:"timestamp"`
+	Location  string    `json:"location,omitempty"`
+	Thumbnail string    `json:"thumbnail,omitempty"` // path of the face thumbnail, when a snapshot was kept
+}
+
+// WidgetAlert is one line of the alerts widget: the recognitions of one
+// type at one location within the alert window. Alerts name nobody, as
+// the displays hang in public areas.
+type WidgetAlert struct {
+	Type     string     `json:"type"`
+	Message  string     `json:"message"`
+	Location string     `json:"location,omitempty"`
+	Count    int        `json:"count"`
+	LastAt   *time.Time `json:"last_at,omitempty"` // unset for the state of the face service
 }
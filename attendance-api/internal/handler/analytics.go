@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+// maxRollingDays bounds the period of a single rolling analytics request
+const maxRollingDays = 366
+
+type AnalyticsHandler struct {
+	analytics *service.AnalyticsService
+	loc       *time.Location // zone of the site, whose today is the default end
+}
+
+func NewAnalyticsHandler(analytics *service.AnalyticsService, loc *time.Location) *AnalyticsHandler {
+	return &AnalyticsHandler{analytics: analytics, loc: loc}
+}
+
+// GetRolling handles GET /api/v1/analytics/rolling?from=&to=&name=&department=&group=
+func (h *AnalyticsHandler) GetRolling(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	to := time.Now().In(h.loc)
+	if v := query.Get("to"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			jsonError(w, "to must be in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+
+	from := to.AddDate(0, 0, -29)
+	if v := query.Get("from"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			jsonError(w, "from must be in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+
+	days := int(to.Sub(from).Hours()/24) + 1
+	if days < 1 || days > maxRollingDays {
+		jsonError(w, fmt.Sprintf("Period must cover between 1 and %d days", maxRollingDays), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.analytics.GetRollingAttendance(from.Format("2006-01-02"), to.Format("2006-01-02"), query.Get("name"), groupFilter(r))
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to compute rolling attendance", "error", err)
+		jsonError(w, "Failed to compute rolling attendance", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"rolling": result,
+	}, http.StatusOK)
+}
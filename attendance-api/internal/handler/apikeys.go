@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+type APIKeyHandler struct {
+	keys  *service.APIKeyService
+	audit *service.AuditService
+}
+
+func NewAPIKeyHandler(keys *service.APIKeyService, audit *service.AuditService) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys, audit: audit}
+}
+
+type apiKeyRequest struct {
+	Name      *string  `json:"name"`
+	Tenant    *string  `json:"tenant"`
+	Person    *string  `json:"person"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt *string  `json:"expires_at"` // RFC 3339; empty string clears the expiry
+}
+
+// APIKeys handles /api/v1/admin/apikeys (list and create)
+func (h *APIKeyHandler) APIKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		keys, err := h.keys.List()
+		if err != nil {
+			logging.From(r.Context()).Error("Failed to list api keys", "error", err)
+			jsonError(w, "Failed to list API keys", http.StatusInternalServerError)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"count":   len(keys),
+			"keys":    keys,
+		}, http.StatusOK)
+
+	case http.MethodPost:
+		var req apiKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		if req.Name == nil || *req.Name == "" {
+			jsonError(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+		if len(req.Scopes) == 0 {
+			jsonError(w, "At least one scope is required", http.StatusBadRequest)
+			return
+		}
+
+		expiresAt, err := parseExpiry(req.ExpiresAt)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if expiresAt != nil && expiresAt.IsZero() {
+			expiresAt = nil
+		}
+
+		var tenant, person string
+		if req.Tenant != nil {
+			tenant = *req.Tenant
+		}
+		if req.Person != nil {
+			person = *req.Person
+		}
+
+		key, secret, err := h.keys.Create(*req.Name, tenant, person, req.Scopes, expiresAt)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange,
+			fmt.Sprintf("created API key %s (%s) with scopes %s", key.ID, key.Name, strings.Join(key.Scopes, ", ")))
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"key":     key,
+			"secret":  secret,
+			"message": "Store the secret now, it will not be shown again",
+		}, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// APIKey handles /api/v1/admin/apikeys/{id} (get, update and revoke)
+func (h *APIKeyHandler) APIKey(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		key, err := h.keys.Get(id)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"key":     key,
+		}, http.StatusOK)
+
+	case http.MethodPatch:
+		var req apiKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		expiresAt, err := parseExpiry(req.ExpiresAt)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		key, err := h.keys.Update(id, req.Name, req.Tenant, req.Person, req.Scopes, expiresAt)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange,
+			fmt.Sprintf("updated API key %s (%s) with scopes %s", key.ID, key.Name, strings.Join(key.Scopes, ", ")))
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"key":     key,
+		}, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := h.keys.Revoke(id); err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, "revoked API key "+id)
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"message": "API key revoked",
+		}, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *APIKeyHandler) serviceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		jsonError(w, "API key not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidScope), errors.Is(err, service.ErrPersonRequired):
+		jsonError(w, err.Error(), http.StatusBadRequest)
+	default:
+		logging.From(r.Context()).Error("API key operation failed", "error", err)
+		jsonError(w, "API key operation failed", http.StatusInternalServerError)
+	}
+}
+
+// parseExpiry returns nil when no expiry was given and the zero time when
+// the caller asked for it to be cleared
+func parseExpiry(value *string) (*time.Time, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if *value == "" {
+		return &time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, *value)
+	if err != nil {
+		return nil, fmt.Errorf("expires_at must be an RFC 3339 timestamp")
+	}
+	return &t, nil
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"net/http"
+
+	"attendance-api/internal/service"
+)
+
+type BuildingHandler struct {
+	building *service.BuildingBridge
+}
+
+func NewBuildingHandler(building *service.BuildingBridge) *BuildingHandler {
+	return &BuildingHandler{building: building}
+}
+
+// Status handles GET /api/v1/admin/building, the points of the building
+// bridge with the values last written to them
+func (h *BuildingHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":  true,
+		"building": h.building.Status(),
+	}, http.StatusOK)
+}
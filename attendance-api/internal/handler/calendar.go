@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+// maxCalendarDays bounds the period of a single calendar request
+const maxCalendarDays = 366
+
+type CalendarHandler struct {
+	calendar *service.CalendarService
+	audit    *service.AuditService
+	loc      *time.Location // zone of the site, whose month is the default
+}
+
+func NewCalendarHandler(calendar *service.CalendarService, audit *service.AuditService, loc *time.Location) *CalendarHandler {
+	return &CalendarHandler{calendar: calendar, audit: audit, loc: loc}
+}
+
+// GetCalendar handles GET /api/v1/calendar?from=&to=
+func (h *CalendarHandler) GetCalendar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now().In(h.loc)
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if v := r.URL.Query().Get("from"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			jsonError(w, "from must be in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+
+	to := from.AddDate(0, 1, -1)
+	if v := r.URL.Query().Get("to"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			jsonError(w, "to must be in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+
+	days := int(to.Sub(from).Hours()/24) + 1
+	if days < 1 || days > maxCalendarDays {
+		jsonError(w, fmt.Sprintf("Period must cover between 1 and %d days", maxCalendarDays), http.StatusBadRequest)
+		return
+	}
+
+	calendar, err := h.calendar.GetCalendar(from, to)
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to build calendar", "error", err)
+		jsonError(w, "Failed to build calendar", http.StatusInternalServerError)
+		return
+	}
+
+	weekend := []string{}
+	for _, day := range h.calendar.Weekend() {
+		weekend = append(weekend, day.String())
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"weekend": weekend,
+		"days":    calendar,
+	}, http.StatusOK)
+}
+
+// Holidays handles /api/v1/calendar/holidays (list and add)
+func (h *CalendarHandler) Holidays(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		holidays, err := h.calendar.ListHolidays()
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success":  true,
+			"count":    len(holidays),
+			"holidays": holidays,
+		}, http.StatusOK)
+
+	case http.MethodPost:
+		var req domain.Holiday
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		holiday, err := h.calendar.SetHoliday(req)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, fmt.Sprintf("set holiday %s (%s)", holiday.Date, holiday.Name))
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"holiday": holiday,
+		}, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Holiday handles DELETE /api/v1/calendar/holidays/{date}
+func (h *CalendarHandler) Holiday(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := h.calendar.DeleteHoliday(r.PathValue("date")); err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+	auditChange(h.audit, r, domain.AuditConfigChange, "deleted holiday "+r.PathValue("date"))
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"message": "Holiday deleted",
+	}, http.StatusOK)
+}
+
+func (h *CalendarHandler) serviceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrHolidayNotFound):
+		jsonError(w, "Holiday not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidHoliday):
+		jsonError(w, err.Error(), http.StatusBadRequest)
+	default:
+		logging.From(r.Context()).Error("Calendar operation failed", "error", err)
+		jsonError(w, "Calendar operation failed", http.StatusInternalServerError)
+	}
+}
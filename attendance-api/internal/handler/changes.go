@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+type ChangeHandler struct {
+	feed *service.ChangeFeed
+}
+
+func NewChangeHandler(feed *service.ChangeFeed) *ChangeHandler {
+	return &ChangeHandler{feed: feed}
+}
+
+// Changes handles GET /api/v1/attendance/changes?after=&limit=, a page of the
+// attendance change feed. With follow=true the changes are streamed as
+// newline-delimited JSON as they happen instead.
+func (h *ChangeHandler) Changes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	var after int64
+	if v := query.Get("after"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || parsed < 0 {
+			jsonError(w, "after must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		after = parsed
+	}
+
+	limit := 500
+	if v := query.Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > 5000 {
+			jsonError(w, "limit must be between 1 and 5000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	if query.Get("follow") == "true" {
+		h.follow(w, r, after)
+		return
+	}
+
+	changes, latest, err := h.feed.Changes(after, limit)
+	if errors.Is(err, service.ErrChangesPruned) {
+		jsonResponse(w, map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+			"latest":  latest,
+		}, http.StatusGone)
+		return
+	}
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to list attendance changes", "error", err)
+		jsonError(w, "Failed to list attendance changes", http.StatusInternalServerError)
+		return
+	}
+
+	next := after
+	if len(changes) > 0 {
+		next = changes[len(changes)-1].Seq
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"count":   len(changes),
+		"changes": changes,
+		"next":    next,
+		"latest":  latest,
+	}, http.StatusOK)
+}
+
+func (h *ChangeHandler) follow(w http.ResponseWriter, r *http.Request, after int64) {
+	// Check before committing to a streaming response
+	if _, latest, err := h.feed.Changes(after, 1); errors.Is(err, service.ErrChangesPruned) {
+		jsonResponse(w, map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+			"latest":  latest,
+		}, http.StatusGone)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		jsonError(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	err := h.feed.Follow(r.Context(), after, func(change domain.AttendanceChange) error {
+		if err := encoder.Encode(change); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil && r.Context().Err() == nil {
+		logging.From(r.Context()).Error("Attendance change stream failed", "remote", r.RemoteAddr, "error", err)
+	}
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+type ClockHandler struct {
+	clock *service.ClockService
+}
+
+func NewClockHandler(clock *service.ClockService) *ClockHandler {
+	return &ClockHandler{clock: clock}
+}
+
+// Time handles GET /api/v1/time?device_time=&device_id=. Devices without
+// NTP access set their clock from server_time; those that send their own
+// time (or X-Device-Time) get back and have recorded how far off it is.
+func (h *ClockHandler) Time(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now()
+	response := map[string]interface{}{
+		"success":     true,
+		"server_time": now,
+		"unix_ms":     now.UnixMilli(),
+	}
+
+	value := r.URL.Query().Get("device_time")
+	if value == "" {
+		value = r.Header.Get("X-Device-Time")
+	}
+	if value != "" {
+		deviceTime, err := service.ParseDeviceTime(value)
+		if err != nil {
+			jsonError(w, "invalid device_time: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		skew := deviceTime.Sub(now).Milliseconds()
+		if device := deviceID(r, r.URL.Query().Get("device_id")); device != "" {
+			if skew, err = h.clock.Observe(device, deviceTime, now); err != nil {
+				logging.From(r.Context()).Error("Failed to record clock skew", "error", err)
+			}
+			response["device_id"] = device
+		}
+		response["skew_ms"] = skew
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	jsonResponse(w, response, http.StatusOK)
+}
+
+// Devices handles GET /api/v1/admin/devices/clocks, the skew observed for
+// each device that reported its time
+func (h *ClockHandler) Devices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	clocks, err := h.clock.Devices()
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to list device clocks", "error", err)
+		jsonError(w, "Failed to list device clocks", http.StatusInternalServerError)
+		return
+	}
+
+	outOfSync := 0
+	for _, clock := range clocks {
+		if clock.OutOfSync {
+			outOfSync++
+		}
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":     true,
+		"count":       len(clocks),
+		"out_of_sync": outOfSync,
+		"devices":     clocks,
+	}, http.StatusOK)
+}
+
+// deviceID is the registered device whose token a request carries, or else
+// the device it names, or else the X-Device-ID it was identified with
+func deviceID(r *http.Request, named string) string {
+	if actor := domain.ActorFromContext(r.Context()); actor.Type == domain.ActorDevice {
+		return actor.Device
+	}
+	if named != "" {
+		return named
+	}
+	return domain.ActorFromContext(r.Context()).Device
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"attendance-api/internal/domain"
+)
+
+// defaultCommandWait is how long a poll waits for a command without ?wait=
+const defaultCommandWait = 30 * time.Second
+
+// Commands handles /api/v1/devices/{id}/commands: GET lists the device's
+// commands, optionally ?status=, and POST queues one
+func (h *DeviceHandler) Commands(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		limit := 100
+		if v := r.URL.Query().Get("limit"); v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil || parsed < 1 || parsed > 1000 {
+				jsonError(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		commands, err := h.devices.Commands(id, r.URL.Query().Get("status"), limit)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success":  true,
+			"count":    len(commands),
+			"commands": commands,
+		}, http.StatusOK)
+
+	case http.MethodPost:
+		var req struct {
+			Command string                 `json:"command"`
+			Params  map[string]interface{} `json:"params"`
+			TTL     string                 `json:"ttl"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		var ttl time.Duration
+		if req.TTL != "" {
+			parsed, err := time.ParseDuration(req.TTL)
+			if err != nil {
+				jsonError(w, "ttl must be a duration such as 30m", http.StatusBadRequest)
+				return
+			}
+			ttl = parsed
+		}
+
+		cmd, err := h.devices.QueueCommand(r.Context(), id, req.Command, req.Params, ttl)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditDeviceCommand, fmt.Sprintf("queued %s for device %s", cmd.Command, cmd.Device))
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"command": cmd,
+		}, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Command handles /api/v1/devices/{id}/commands/{command}: GET returns the
+// command and DELETE cancels it unless the device acknowledged it already
+func (h *DeviceHandler) Command(w http.ResponseWriter, r *http.Request) {
+	id, commandID := r.PathValue("id"), r.PathValue("command")
+
+	switch r.Method {
+	case http.MethodGet:
+		cmd, err := h.devices.Command(id, commandID)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"command": cmd,
+		}, http.StatusOK)
+
+	case http.MethodDelete:
+		cmd, err := h.devices.CancelCommand(id, commandID)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditDeviceCommand, fmt.Sprintf("cancelled %s for device %s", cmd.Command, cmd.Device))
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"command": cmd,
+		}, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// PollCommands handles POST /api/v1/devices/{id}/commands/poll?wait=30s,
+// which a device long-polls for its commands. It answers as soon as a
+// command is due, or with none once the wait (at most a minute) is over.
+func (h *DeviceHandler) PollCommands(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.PathValue("id")
+	if actor := domain.ActorFromContext(r.Context()); actor.Type == domain.ActorDevice && actor.ID != id {
+		jsonError(w, "A device may only take its own commands", http.StatusForbidden)
+		return
+	}
+
+	wait := defaultCommandWait
+	if v := r.URL.Query().Get("wait"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed < 0 {
+			jsonError(w, "wait must be a duration such as 30s", http.StatusBadRequest)
+			return
+		}
+		wait = parsed
+	}
+
+	commands, err := h.devices.PollCommands(r.Context(), id, wait)
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":  true,
+		"count":    len(commands),
+		"commands": commands,
+	}, http.StatusOK)
+}
+
+// AckCommand handles POST /api/v1/devices/{id}/commands/{command}/ack, with
+// which a device reports a command done or, with "success": false, failed
+func (h *DeviceHandler) AckCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.PathValue("id")
+	if actor := domain.ActorFromContext(r.Context()); actor.Type == domain.ActorDevice && actor.ID != id {
+		jsonError(w, "A device may only acknowledge its own commands", http.StatusForbidden)
+		return
+	}
+
+	// Without a body the command was carried out
+	req := struct {
+		Success *bool  `json:"success"`
+		Result  string `json:"result"`
+	}{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	cmd, err := h.devices.AckCommand(id, r.PathValue("command"), req.Success == nil || *req.Success, req.Result)
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"command": cmd,
+	}, http.StatusOK)
+}
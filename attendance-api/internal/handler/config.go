@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"net/http"
+
+	"attendance-api/internal/config"
+)
+
+// GetConfig handles GET /api/v1/admin/config, every setting as the node
+// resolved it from flags, environment, files, Vault and defaults, and where
+// each came from. Secrets are redacted.
+func (h *Handler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"config":  config.Effective(),
+	}, http.StatusOK)
+}
@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"attendance-api/internal/client"
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/middleware"
+	"attendance-api/internal/service"
+)
+
+// Run with -update to rewrite the golden files after an intended change of
+// a response shape. Kiosk firmware in the field depends on these shapes, so
+// a change to a *.v1.0.json file is almost always a bug.
+var update = flag.Bool("update", false, "rewrite the golden files of the contract tests")
+
+// contractRecognizer recognizes the person named by the uploaded file name
+type contractRecognizer struct {
+	client.Recognizer
+}
+
+func (contractRecognizer) RecognizeFace(ctx context.Context, imageData []byte, filename string) (*domain.RecognitionResult, error) {
+	return &domain.RecognitionResult{
+		Success:       true,
+		FacesDetected: 1,
+		Faces: []domain.RecognizedFace{
+			{Name: strings.TrimSuffix(filename, ".jpg"), Confidence: 91.5},
+		},
+	}, nil
+}
+
+func (contractRecognizer) GetFaces(ctx context.Context) ([]domain.Face, error) {
+	return []domain.Face{{Name: "alice", Images: 3}, {Name: "bob", Images: 1}}, nil
+}
+
+// newTestServices opens a database of its own and builds the attendance
+// service on it around the recognizer
+func newTestServices(t *testing.T, recognizer client.Recognizer) (*service.AttendanceService, *service.AuditService) {
+	t.Helper()
+
+	dbPath := filepath.Join(t.TempDir(), "attendance.db")
+	dbCfg := config.DatabaseConfig{WritePoolSize: 1, ReadPoolSize: 2, BusyTimeout: 5 * time.Second}
+	db, err := service.OpenDatabase(dbPath, time.Local, dbCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	reads, err := service.OpenReadPool(dbPath, time.Local, dbCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reads.Close() })
+
+	calendar, err := service.NewCalendarService(db, config.CalendarConfig{Weekend: []string{"friday", "saturday"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := service.NewSnapshotService(db, reads, nil, nil, config.SnapshotConfig{Policy: domain.CaptureNever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit, err := service.NewAuditService(db, reads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The built-in tag rules depend on the day the test runs
+	attendance, err := service.NewAttendanceService(recognizer, db, reads, calendar, snapshots, nil, nil, nil, nil, nil, nil, config.AttendanceConfig{SessionMode: "toggle", TagRules: []string{"none"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { attendance.Close() })
+
+	return attendance, audit
+}
+
+func newContractServer(t *testing.T) http.Handler {
+	t.Helper()
+
+	recognizer := contractRecognizer{}
+	attendance, audit := newTestServices(t, recognizer)
+
+	cfg := &config.Config{
+		Upload:  config.UploadConfig{MaxUploadSize: 5 << 20, MaxMemory: 10 << 20},
+		FaceAPI: config.FaceAPIConfig{Timeout: 5 * time.Second},
+	}
+	h := NewHandler(recognizer, attendance, nil, nil, nil, audit, nil, cfg)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/attendance", h.RecordAttendance)
+	mux.HandleFunc("GET /api/v1/attendance/recent", h.GetRecentAttendance)
+	mux.HandleFunc("GET /api/v1/attendance/stats", h.GetAttendanceStats)
+	mux.HandleFunc("GET /api/v1/faces", h.ListFaces)
+
+	return middleware.NewCompat(config.ServerConfig{}).Translate(mux)
+}
+
+func imageUpload(t *testing.T, name string) (*bytes.Buffer, string) {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("image", name+".jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("jpeg"))
+	form.WriteField("device_id", "door-1")
+	form.WriteField("location", "main-entrance")
+	form.Close()
+	return &body, form.FormDataContentType()
+}
+
+// volatileFields change on every run and are replaced by their name
+var volatileFields = map[string]bool{
+	"id":          true,
+	"timestamp":   true,
+	"server_time": true,
+	"from":        true,
+}
+
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, fieldValue := range v {
+			if _, ok := fieldValue.(string); ok && volatileFields[key] {
+				v[key] = "<" + key + ">"
+				continue
+			}
+			v[key] = normalize(fieldValue)
+		}
+	case []interface{}:
+		for i, element := range v {
+			v[i] = normalize(element)
+		}
+	}
+	return value
+}
+
+// TestResponseContracts freezes the JSON shapes of the responses kiosks and
+// integrations rely on, as served today and as served to 1.0 firmware
+func TestResponseContracts(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		person string // uploaded for attendance
+	}{
+		{"record_authorized", http.MethodPost, "/api/v1/attendance", "alice"},
+		{"record_unknown", http.MethodPost, "/api/v1/attendance", "Unknown"},
+		{"recent", http.MethodGet, "/api/v1/attendance/recent?limit=2", ""},
+		{"stats", http.MethodGet, "/api/v1/attendance/stats", ""},
+		{"faces", http.MethodGet, "/api/v1/faces", ""},
+	}
+
+	for _, version := range []string{"", middleware.APIVersionLegacy} {
+		// The cases build on each other, on a database of their own
+		server := newContractServer(t)
+
+		for _, tc := range cases {
+			golden := tc.name + ".json"
+			if version != "" {
+				golden = tc.name + ".v" + version + ".json"
+			}
+
+			t.Run(golden, func(t *testing.T) {
+				var req *http.Request
+				if tc.person != "" {
+					body, contentType := imageUpload(t, tc.person)
+					req = httptest.NewRequest(tc.method, tc.path, body)
+					req.Header.Set("Content-Type", contentType)
+				} else {
+					req = httptest.NewRequest(tc.method, tc.path, nil)
+				}
+				if version != "" {
+					req.Header.Set("X-API-Version", version)
+				}
+
+				rec := httptest.NewRecorder()
+				server.ServeHTTP(rec, req)
+				if rec.Code != http.StatusOK {
+					t.Fatalf("status %d: %s", rec.Code, rec.Body)
+				}
+
+				var response interface{}
+				if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+					t.Fatalf("invalid JSON: %v", err)
+				}
+				var out bytes.Buffer
+				encoder := json.NewEncoder(&out)
+				encoder.SetEscapeHTML(false)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(normalize(response)); err != nil {
+					t.Fatal(err)
+				}
+				got := out.Bytes()
+
+				path := filepath.Join("testdata", "contract", golden)
+				if *update {
+					if err := os.WriteFile(path, got, 0644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+
+				want, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("missing golden file, run with -update: %v", err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("response shape changed from %s\n--- got\n%s--- want\n%s", path, got, want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"database/sql"
+	"net/http"
+
+	"attendance-api/internal/service"
+)
+
+type DatabaseHandler struct {
+	writes *sql.DB
+	reads  *sql.DB
+}
+
+func NewDatabaseHandler(writes, reads *sql.DB) *DatabaseHandler {
+	return &DatabaseHandler{writes: writes, reads: reads}
+}
+
+// GetStats handles GET /api/v1/admin/database and reports connection pool usage
+func (h *DatabaseHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"write":   service.PoolStats(h.writes),
+		"read":    service.PoolStats(h.reads),
+	}, http.StatusOK)
+}
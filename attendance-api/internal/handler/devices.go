@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+type DeviceHandler struct {
+	devices *service.DeviceService
+	audit   *service.AuditService
+}
+
+func NewDeviceHandler(devices *service.DeviceService, audit *service.AuditService) *DeviceHandler {
+	return &DeviceHandler{devices: devices, audit: audit}
+}
+
+type deviceRequest struct {
+	ID       string  `json:"id"`
+	Name     *string `json:"name"`
+	Location *string `json:"location"`
+	Tenant   *string `json:"tenant"`
+	Disabled *bool   `json:"disabled"`
+}
+
+// Devices handles /api/v1/devices (list and register)
+func (h *DeviceHandler) Devices(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		devices, err := h.devices.List()
+		if err != nil {
+			logging.From(r.Context()).Error("Failed to list devices", "error", err)
+			jsonError(w, "Failed to list devices", http.StatusInternalServerError)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"count":   len(devices),
+			"devices": devices,
+		}, http.StatusOK)
+
+	case http.MethodPost:
+		var req deviceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		var name, location, tenant string
+		if req.Name != nil {
+			name = *req.Name
+		}
+		if req.Location != nil {
+			location = *req.Location
+		}
+		if req.Tenant != nil {
+			tenant = *req.Tenant
+		}
+
+		device, token, err := h.devices.Create(req.ID, name, location, tenant)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, fmt.Sprintf("registered device %s (%s)", device.ID, device.Name))
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"device":  device,
+			"token":   token,
+			"message": "Store the token now, it will not be shown again",
+		}, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Device handles /api/v1/devices/{id} (get, update and delete)
+func (h *DeviceHandler) Device(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		device, err := h.devices.Get(id)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"device":  device,
+		}, http.StatusOK)
+
+	case http.MethodPatch:
+		var req deviceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		device, err := h.devices.Update(id, req.Name, req.Location, req.Tenant, req.Disabled)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+		summary := fmt.Sprintf("updated device %s (%s)", device.ID, device.Name)
+		if device.Disabled {
+			summary += ", disabled"
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, summary)
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"device":  device,
+		}, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := h.devices.Delete(id); err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, "deleted device "+id)
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"message": "Device deleted",
+		}, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// RotateToken handles POST /api/v1/devices/{id}/token, replacing the
+// device's token
+func (h *DeviceHandler) RotateToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	device, token, err := h.devices.RotateToken(r.PathValue("id"))
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+	auditChange(h.audit, r, domain.AuditConfigChange, fmt.Sprintf("rotated the token of device %s (%s)", device.ID, device.Name))
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"device":  device,
+		"token":   token,
+		"message": "Store the token now, it will not be shown again",
+	}, http.StatusOK)
+}
+
+// Heartbeat handles POST /api/v1/devices/{id}/heartbeat, which a device
+// sends to show it is alive between recognitions. A device token may only
+// send the heartbeat of its own device.
+func (h *DeviceHandler) Heartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.PathValue("id")
+	if actor := domain.ActorFromContext(r.Context()); actor.Type == domain.ActorDevice && actor.ID != id {
+		jsonError(w, "A device may only send its own heartbeat", http.StatusForbidden)
+		return
+	}
+
+	device, err := h.devices.Heartbeat(id)
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+
+	// A device that missed a device_config_changed event notices the new
+	// version here
+	settings, err := h.devices.Settings(id)
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":        true,
+		"device":         device,
+		"config_version": settings.Version,
+		"server_time":    time.Now(),
+	}, http.StatusOK)
+}
+
+// Config handles GET /api/v1/devices/{id}/config, which a device fetches
+// at startup and whenever its settings changed. Like heartbeats, a device
+// token may only fetch its own.
+func (h *DeviceHandler) Config(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if actor := domain.ActorFromContext(r.Context()); actor.Type == domain.ActorDevice && actor.ID != id {
+		jsonError(w, "A device may only fetch its own config", http.StatusForbidden)
+		return
+	}
+
+	settings, err := h.devices.Settings(id)
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"config":  settings,
+	}, http.StatusOK)
+}
+
+// SetConfig handles PUT /api/v1/devices/{id}/config, replacing the device's
+// settings. Settings left out go back to the device's own default.
+func (h *DeviceHandler) SetConfig(w http.ResponseWriter, r *http.Request) {
+	var req domain.DeviceSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.devices.SetSettings(r.PathValue("id"), req)
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+	auditChange(h.audit, r, domain.AuditConfigChange, fmt.Sprintf("changed the settings of device %s (version %d)", settings.Device, settings.Version))
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"config":  settings,
+	}, http.StatusOK)
+}
+
+func (h *DeviceHandler) serviceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrDeviceNotFound):
+		jsonError(w, "Device not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrDeviceExists):
+		jsonError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidDeviceID), errors.Is(err, service.ErrInvalidSettings), errors.Is(err, service.ErrInvalidCommand):
+		jsonError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrCommandNotFound):
+		jsonError(w, "Device command not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrCommandClosed):
+		jsonError(w, err.Error(), http.StatusConflict)
+	default:
+		logging.From(r.Context()).Error("Device operation failed", "error", err)
+		jsonError(w, "Device operation failed", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"attendance-api/api"
+
+	"gopkg.in/yaml.v3"
+)
+
+type DocsHandler struct {
+	spec []byte
+}
+
+// NewDocsHandler converts the embedded OpenAPI specification to JSON once,
+// so a broken specification stops the server at startup
+func NewDocsHandler() (*DocsHandler, error) {
+	var spec map[string]interface{}
+	if err := yaml.Unmarshal(api.OpenAPI, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI specification: %w", err)
+	}
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode OpenAPI specification: %w", err)
+	}
+
+	return &DocsHandler{spec: data}, nil
+}
+
+// OpenAPI handles GET /api/v1/openapi.json
+func (h *DocsHandler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(h.spec)
+}
+
+// Docs handles GET /docs, the Swagger UI for the specification
+func (h *DocsHandler) Docs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(api.DocsPage)
+}
@@ -0,0 +1,282 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+type doorRequest struct {
+	ID     string             `json:"id"`
+	Name   *string            `json:"name"`
+	Zone   *string            `json:"zone"`
+	Access *domain.DoorAccess `json:"access"`
+}
+
+// Doors handles /api/v1/doors (list and create)
+func (h *Handler) Doors(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		doors, err := h.attendanceService.ListDoors()
+		if err != nil {
+			logging.From(r.Context()).Error("Failed to list doors", "error", err)
+			jsonError(w, "Failed to list doors", http.StatusInternalServerError)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"count":   len(doors),
+			"doors":   doors,
+		}, http.StatusOK)
+
+	case http.MethodPost:
+		var req doorRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		door := domain.Door{ID: req.ID}
+		if req.Name != nil {
+			door.Name = *req.Name
+		}
+		if req.Zone != nil {
+			door.Zone = *req.Zone
+		}
+		if req.Access != nil {
+			door.Access = *req.Access
+		}
+
+		created, err := h.attendanceService.CreateDoor(door)
+		if err != nil {
+			doorError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, fmt.Sprintf("created door %s (%s)%s", created.ID, created.Name, accessSummary(created.Access)))
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"door":    created,
+		}, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Door handles /api/v1/doors/{id}: GET returns the door, PATCH changes its
+// name, zone or access and DELETE removes it
+func (h *Handler) Door(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		door, err := h.attendanceService.GetDoor(id)
+		if err != nil {
+			doorError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"door":    door,
+		}, http.StatusOK)
+
+	case http.MethodPatch:
+		var req doorRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		door, err := h.attendanceService.UpdateDoor(id, req.Name, req.Zone, req.Access)
+		if err != nil {
+			doorError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, fmt.Sprintf("updated door %s (%s)%s", door.ID, door.Name, accessSummary(door.Access)))
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"door":    door,
+		}, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := h.attendanceService.DeleteDoor(id); err != nil {
+			doorError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, "deleted door "+id)
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"message": "Door deleted",
+		}, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Zones handles GET /api/v1/zones
+func (h *Handler) Zones(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	zones, err := h.attendanceService.ListZones()
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to list zones", "error", err)
+		jsonError(w, "Failed to list zones", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"count":   len(zones),
+		"zones":   zones,
+	}, http.StatusOK)
+}
+
+// Zone handles /api/v1/zones/{name}: GET returns the zone's doors and
+// access, PUT replaces its access and DELETE clears it
+func (h *Handler) Zone(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	var access domain.DoorAccess
+
+	switch r.Method {
+	case http.MethodGet:
+		zone, err := h.attendanceService.GetZone(name)
+		if err != nil {
+			logging.From(r.Context()).Error("Failed to get zone", "error", err)
+			jsonError(w, "Failed to get zone", http.StatusInternalServerError)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"zone":    zone,
+		}, http.StatusOK)
+		return
+
+	case http.MethodPut:
+		if err := json.NewDecoder(r.Body).Decode(&access); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+	case http.MethodDelete:
+		// A zone without grants leaves its doors to their own rules
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	zone, err := h.attendanceService.SetZoneAccess(name, access)
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to set zone access", "error", err)
+		jsonError(w, "Failed to set zone access", http.StatusInternalServerError)
+		return
+	}
+	summary := fmt.Sprintf("cleared access to zone %s", name)
+	if !zone.Access.IsEmpty() {
+		summary = fmt.Sprintf("set access to zone %s%s", name, accessSummary(zone.Access))
+	}
+	auditChange(h.audit, r, domain.AuditConfigChange, summary)
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"zone":    zone,
+	}, http.StatusOK)
+}
+
+// OpenDoor handles POST /api/v1/doors/{id}/open, opening a door remotely
+func (h *Handler) OpenDoor(w http.ResponseWriter, r *http.Request) {
+	h.doorCommand(w, r, domain.DoorCommandOpen)
+}
+
+// CloseDoor handles POST /api/v1/doors/{id}/close, telling a door's devices
+// to keep it closed
+func (h *Handler) CloseDoor(w http.ResponseWriter, r *http.Request) {
+	h.doorCommand(w, r, domain.DoorCommandClose)
+}
+
+func (h *Handler) doorCommand(w http.ResponseWriter, r *http.Request, command string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The body is optional
+	var req struct {
+		Seconds int    `json:"seconds"`
+		Reason  string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	id := r.PathValue("id")
+	sent, err := h.attendanceService.CommandDoor(r.Context(), id, command, req.Seconds, req.Reason)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidDoorCommand) {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		doorError(w, r, err)
+		return
+	}
+
+	summary := fmt.Sprintf("sent %s to door %s", command, id)
+	if sent.Reason != "" {
+		summary += ": " + sent.Reason
+	}
+	auditChange(h.audit, r, domain.AuditDoorCommand, summary)
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"command": sent,
+	}, http.StatusOK)
+}
+
+// accessSummary describes access grants for the audit log
+func accessSummary(access domain.DoorAccess) string {
+	var parts []string
+	if len(access.People) > 0 {
+		parts = append(parts, "people "+strings.Join(access.People, ", "))
+	}
+	if len(access.Departments) > 0 {
+		parts = append(parts, "departments "+strings.Join(access.Departments, ", "))
+	}
+	if len(parts) == 0 {
+		return ", open to everyone"
+	}
+	return ", granted to " + strings.Join(parts, "; ")
+}
+
+func doorError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrDoorNotFound):
+		jsonError(w, "Door not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrDoorExists):
+		jsonError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidDoorID):
+		jsonError(w, err.Error(), http.StatusBadRequest)
+	default:
+		logging.From(r.Context()).Error("Door operation failed", "error", err)
+		jsonError(w, "Door operation failed", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+// Lockdown handles POST /api/v1/admin/lockdown, keeping every door closed
+// whoever is recognized
+func (h *Handler) Lockdown(w http.ResponseWriter, r *http.Request) {
+	h.startEmergency(w, r, domain.EmergencyLockdown)
+}
+
+// UnlockAll handles POST /api/v1/admin/unlock-all, opening every door for
+// anyone, e.g. to evacuate the building
+func (h *Handler) UnlockAll(w http.ResponseWriter, r *http.Request) {
+	h.startEmergency(w, r, domain.EmergencyUnlockAll)
+}
+
+func (h *Handler) startEmergency(w http.ResponseWriter, r *http.Request, mode string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The body is optional
+	var req struct {
+		Reason   string `json:"reason"`
+		Duration string `json:"duration"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var duration time.Duration
+	if req.Duration != "" {
+		parsed, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			jsonError(w, "duration must be a duration such as 30m", http.StatusBadRequest)
+			return
+		}
+		duration = parsed
+	}
+
+	emergency, err := h.attendanceService.StartEmergency(r.Context(), mode, req.Reason, duration)
+	if err != nil {
+		emergencyError(w, r, err)
+		return
+	}
+
+	summary := fmt.Sprintf("started %s until %s", mode, emergency.ExpiresAt.Format(time.RFC3339))
+	if emergency.Reason != "" {
+		summary += ": " + emergency.Reason
+	}
+	auditChange(h.audit, r, domain.AuditEmergency, summary)
+
+	jsonResponse(w, map[string]interface{}{
+		"success":   true,
+		"emergency": emergency,
+	}, http.StatusOK)
+}
+
+// Emergency handles /api/v1/admin/emergency: GET returns the lockdown or
+// unlock-all in force, if any, and DELETE lifts it
+func (h *Handler) Emergency(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		emergency, err := h.attendanceService.Emergency()
+		if err != nil {
+			emergencyError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success":   true,
+			"active":    emergency != nil,
+			"emergency": emergency,
+		}, http.StatusOK)
+
+	case http.MethodDelete:
+		emergency, err := h.attendanceService.EndEmergency()
+		if err != nil {
+			emergencyError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditEmergency, "lifted "+emergency.Mode)
+
+		jsonResponse(w, map[string]interface{}{
+			"success":   true,
+			"emergency": emergency,
+		}, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func emergencyError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrNoEmergency):
+		jsonError(w, "No emergency in force", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidEmergency):
+		jsonError(w, err.Error(), http.StatusBadRequest)
+	default:
+		logging.From(r.Context()).Error("Emergency operation failed", "error", err)
+		jsonError(w, "Emergency operation failed", http.StatusInternalServerError)
+	}
+}
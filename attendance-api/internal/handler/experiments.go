@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+type ExperimentHandler struct {
+	experiments *service.ExperimentService
+	loc         *time.Location // zone of the site, of from and to dates
+}
+
+func NewExperimentHandler(experiments *service.ExperimentService, loc *time.Location) *ExperimentHandler {
+	return &ExperimentHandler{experiments: experiments, loc: loc}
+}
+
+// Report handles GET /api/v1/admin/experiments?experiment=&from=&to=
+func (h *ExperimentHandler) Report(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, err := parseRange(r, 7*24*time.Hour, h.loc)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.experiments.Report(r.URL.Query().Get("experiment"), from, to)
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to build experiment report", "error", err)
+		jsonError(w, "Failed to build experiment report", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"report":  report,
+	}, http.StatusOK)
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+// ExportMonthXLSX handles GET /api/v1/attendance/export.xlsx?month=&department=&group=
+func (h *Handler) ExportMonthXLSX(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	loc := h.attendanceService.Location()
+	month := time.Now().In(loc)
+	if v := r.URL.Query().Get("month"); v != "" {
+		t, err := time.ParseInLocation("2006-01", v, loc)
+		if err != nil {
+			jsonError(w, "month must be YYYY-MM", http.StatusBadRequest)
+			return
+		}
+		month = t
+	}
+
+	report, err := h.attendanceService.GetMonthlyReport(month, groupFilter(r))
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to build monthly report", "error", err)
+		jsonError(w, "Failed to build monthly report", http.StatusInternalServerError)
+		return
+	}
+
+	// Built in memory first so a failure can still be reported as JSON
+	var buf bytes.Buffer
+	if err := service.WriteMonthlyXLSX(report, loc, &buf); err != nil {
+		logging.From(r.Context()).Error("Failed to write spreadsheet", "error", err)
+		jsonError(w, "Failed to write spreadsheet", http.StatusInternalServerError)
+		return
+	}
+
+	auditExport(h.audit, r, domain.AuditExportReport, len(report.People))
+
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"attendance-%s.xlsx\"", report.Month))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"net/http"
+
+	"attendance-api/internal/client"
+)
+
+type FaceServiceHandler struct {
+	limiter *client.ConcurrencyLimiter
+}
+
+func NewFaceServiceHandler(limiter *client.ConcurrencyLimiter) *FaceServiceHandler {
+	return &FaceServiceHandler{limiter: limiter}
+}
+
+// GetStats handles GET /api/v1/admin/face-service and reports how many calls
+// to the face service are in flight and queued, and how long they waited
+func (h *FaceServiceHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"limiter": h.limiter.Stats(),
+	}, http.StatusOK)
+}
@@ -0,0 +1,442 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/service"
+
+	"github.com/graphql-go/graphql"
+)
+
+// maxGraphQLLimit bounds the records of one attendance field, like the
+// limit of /api/v1/attendance/recent
+const maxGraphQLLimit = 1000
+
+// GraphQLHandler serves read-only queries over attendance, stats and people,
+// so a dashboard can fetch exactly the fields it needs in one request.
+// Fields carry the same names as in the REST responses.
+type GraphQLHandler struct {
+	attendance *service.AttendanceService
+	audit      *service.AuditService
+	permits    func(ctx context.Context, scope string) bool
+	schema     graphql.Schema
+}
+
+// exportedRowsKey holds the count of records a query returned, for the
+// audit log
+type exportedRowsKey struct{}
+
+// NewGraphQLHandler builds the schema. permits decides whether a request
+// may read raw attendance records.
+func NewGraphQLHandler(attendance *service.AttendanceService, audit *service.AuditService, permits func(ctx context.Context, scope string) bool) (*GraphQLHandler, error) {
+	h := &GraphQLHandler{attendance: attendance, audit: audit, permits: permits}
+
+	schema, err := h.buildSchema()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GraphQL schema: %w", err)
+	}
+	h.schema = schema
+
+	return h, nil
+}
+
+// Query handles /api/v1/graphql: POST with a JSON body of query, variables
+// and operationName, or GET with the same as query parameters
+func (h *GraphQLHandler) Query(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query         string                 `json:"query"`
+		Variables     map[string]interface{} `json:"variables"`
+		OperationName string                 `json:"operationName"`
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if v := query.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				jsonError(w, "variables must be a JSON object", http.StatusBadRequest)
+				return
+			}
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if req.Query == "" {
+		jsonError(w, "query is required", http.StatusBadRequest)
+		return
+	}
+
+	exported := 0
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        context.WithValue(r.Context(), exportedRowsKey{}, &exported),
+	})
+	if exported > 0 {
+		auditExport(h.audit, r, domain.AuditExportRecords, exported)
+	}
+
+	// Errors are reported in the result; only a query that could not run
+	// at all is a bad request
+	status := http.StatusOK
+	if result.Data == nil && result.HasErrors() {
+		status = http.StatusBadRequest
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+func (h *GraphQLHandler) buildSchema() (graphql.Schema, error) {
+	actorType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Actor",
+		Fields: graphql.Fields{
+			"type":   &graphql.Field{Type: graphql.String},
+			"id":     &graphql.Field{Type: graphql.String},
+			"name":   &graphql.Field{Type: graphql.String},
+			"tenant": &graphql.Field{Type: graphql.String},
+			"device": &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	// Records and people refer to each other, so their fields are added
+	// once both types exist
+	recordType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "AttendanceRecord",
+		Fields: graphql.Fields{
+			"id":                  &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"name":                &graphql.Field{Type: graphql.String},
+			"person_id":           &graphql.Field{Type: graphql.String},
+			"external_id":         &graphql.Field{Type: graphql.String},
+			"confidence":          &graphql.Field{Type: graphql.Float},
+			"timestamp":           &graphql.Field{Type: graphql.DateTime},
+			"status":              &graphql.Field{Type: graphql.String},
+			"device_id":           &graphql.Field{Type: graphql.String},
+			"client_cert":         &graphql.Field{Type: graphql.String},
+			"event_type":          &graphql.Field{Type: graphql.String},
+			"location":            &graphql.Field{Type: graphql.String},
+			"misplaced":           &graphql.Field{Type: graphql.Boolean},
+			"door_id":             &graphql.Field{Type: graphql.String},
+			"lateness_minutes":    &graphql.Field{Type: graphql.Int},
+			"late":                &graphql.Field{Type: graphql.Boolean},
+			"early_leave_minutes": &graphql.Field{Type: graphql.Int},
+			"early_leave":         &graphql.Field{Type: graphql.Boolean},
+			"observe_only":        &graphql.Field{Type: graphql.Boolean},
+			"tags":                &graphql.Field{Type: graphql.NewList(graphql.String)},
+			"actor":               &graphql.Field{Type: actorType},
+		},
+	})
+
+	pageType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "AttendancePage",
+		Description: "A page of attendance records, newest first",
+		Fields: graphql.Fields{
+			"total": &graphql.Field{Type: graphql.Int, Description: "Records matching the filters across all pages"},
+			"next_cursor": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Pass as after for the next page; null on the last page",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if page, ok := p.Source.(*domain.AttendancePage); ok && page.NextCursor != "" {
+						return page.NextCursor, nil
+					}
+					return nil, nil
+				},
+			},
+			"records": &graphql.Field{Type: graphql.NewList(recordType)},
+		},
+	})
+
+	personType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Person",
+		Fields: graphql.Fields{
+			"id":              &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"name":            &graphql.Field{Type: graphql.String},
+			"full_name":       &graphql.Field{Type: graphql.String},
+			"employee_number": &graphql.Field{Type: graphql.String},
+			"external_id":     &graphql.Field{Type: graphql.String},
+			"card_number":     &graphql.Field{Type: graphql.String},
+			"email":           &graphql.Field{Type: graphql.String},
+			"active":          &graphql.Field{Type: graphql.Boolean},
+			"department":      &graphql.Field{Type: graphql.String},
+			"group":           &graphql.Field{Type: graphql.String},
+			"created_at":      &graphql.Field{Type: graphql.DateTime},
+			"updated_at":      &graphql.Field{Type: graphql.DateTime},
+		},
+	})
+
+	recordType.AddFieldConfig("person", &graphql.Field{
+		Type:        personType,
+		Description: "The person the record belongs to; null for unknown faces",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			record, ok := p.Source.(domain.AttendanceRecord)
+			if !ok || record.PersonID == "" {
+				return nil, nil
+			}
+			person, err := h.attendance.GetPerson(record.PersonID)
+			if errors.Is(err, service.ErrPersonNotFound) {
+				return nil, nil
+			}
+			return person, err
+		},
+	})
+
+	personType.AddFieldConfig("attendance", &graphql.Field{
+		Type:        pageType,
+		Description: "Attendance records of the person",
+		Args:        attendanceArgs(false),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			q, err := attendanceQuery(p.Args, h.attendance.Location())
+			if err != nil {
+				return nil, err
+			}
+			q.PersonID = personID(p.Source)
+			if q.PersonID == "" {
+				return nil, nil
+			}
+			return h.records(p.Context, q)
+		},
+	})
+
+	punctualityType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Punctuality",
+		Fields: graphql.Fields{
+			"check_ins":            &graphql.Field{Type: graphql.Int},
+			"on_time":              &graphql.Field{Type: graphql.Int},
+			"late":                 &graphql.Field{Type: graphql.Int},
+			"late_percent":         &graphql.Field{Type: graphql.Float},
+			"avg_lateness_minutes": &graphql.Field{Type: graphql.Float},
+			"early_leaves":         &graphql.Field{Type: graphql.Int},
+		},
+	})
+
+	periodType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "PeriodStats",
+		Description: "Records since from",
+		Fields: graphql.Fields{
+			"from":          &graphql.Field{Type: graphql.DateTime},
+			"total":         &graphql.Field{Type: graphql.Int},
+			"authorized":    &graphql.Field{Type: graphql.Int},
+			"unauthorized":  &graphql.Field{Type: graphql.Int},
+			"unique_people": &graphql.Field{Type: graphql.Int},
+		},
+	})
+
+	statsType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "AttendanceStats",
+		Fields: graphql.Fields{
+			"total":         &graphql.Field{Type: graphql.Int},
+			"authorized":    &graphql.Field{Type: graphql.Int},
+			"unauthorized":  &graphql.Field{Type: graphql.Int},
+			"unique_people": &graphql.Field{Type: graphql.Int},
+			"observe_only":  &graphql.Field{Type: graphql.Int},
+			"members":       &graphql.Field{Type: graphql.Int, Description: "People in the department or group; null without a filter"},
+			"today":         &graphql.Field{Type: periodType},
+			"this_week":     &graphql.Field{Type: periodType, Description: "Since the first day after the weekend"},
+			"punctuality":   &graphql.Field{Type: punctualityType},
+		},
+	})
+
+	groupType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Group",
+		Fields: graphql.Fields{
+			"department": &graphql.Field{Type: graphql.String},
+			"group":      &graphql.Field{Type: graphql.String},
+			"members":    &graphql.Field{Type: graphql.Int},
+		},
+	})
+
+	groupArgs := graphql.FieldConfigArgument{
+		"department": &graphql.ArgumentConfig{Type: graphql.String},
+		"group":      &graphql.ArgumentConfig{Type: graphql.String},
+	}
+	statsArgs := graphql.FieldConfigArgument{
+		"department": &graphql.ArgumentConfig{Type: graphql.String},
+		"group":      &graphql.ArgumentConfig{Type: graphql.String},
+		"device_id":  &graphql.ArgumentConfig{Type: graphql.String},
+		"location":   &graphql.ArgumentConfig{Type: graphql.String},
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"attendance": &graphql.Field{
+				Type:        pageType,
+				Description: "Attendance records matching the filters, newest first",
+				Args:        attendanceArgs(true),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					q, err := attendanceQuery(p.Args, h.attendance.Location())
+					if err != nil {
+						return nil, err
+					}
+					return h.records(p.Context, q)
+				},
+			},
+			"stats": &graphql.Field{
+				Type:        statsType,
+				Description: "Attendance totals, optionally for a department or group and a device or location",
+				Args:        statsArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return h.attendance.GetAttendanceStats(groupArgsFilter(p.Args), sourceArgsFilter(p.Args))
+				},
+			},
+			"people": &graphql.Field{
+				Type:        graphql.NewList(personType),
+				Description: "People, optionally only the members of a department or group",
+				Args:        groupArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return h.attendance.ListPeople(groupArgsFilter(p.Args))
+				},
+			},
+			"person": &graphql.Field{
+				Type: personType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					person, err := h.attendance.GetPerson(p.Args["id"].(string))
+					if errors.Is(err, service.ErrPersonNotFound) {
+						return nil, nil
+					}
+					return person, err
+				},
+			},
+			"groups": &graphql.Field{
+				Type: graphql.NewList(groupType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return h.attendance.ListGroups()
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+// records resolves an attendance field. Raw records need the records:read
+// scope; the ones returned are counted for the audit log.
+func (h *GraphQLHandler) records(ctx context.Context, q domain.AttendanceQuery) (*domain.AttendancePage, error) {
+	if !h.permits(ctx, domain.ScopeRecordsRead) {
+		return nil, errors.New("API key lacks scope " + domain.ScopeRecordsRead)
+	}
+
+	page, err := h.attendance.GetRecentAttendance(q)
+	if err != nil {
+		return nil, err
+	}
+	if exported, ok := ctx.Value(exportedRowsKey{}).(*int); ok {
+		*exported += len(page.Records)
+	}
+	return page, nil
+}
+
+// attendanceArgs are the filters of an attendance field; the top-level field
+// also selects by person and group
+func attendanceArgs(topLevel bool) graphql.FieldConfigArgument {
+	args := graphql.FieldConfigArgument{
+		"status":         &graphql.ArgumentConfig{Type: graphql.String, Description: "authorized or unauthorized"},
+		"min_confidence": &graphql.ArgumentConfig{Type: graphql.Float},
+		"tag":            &graphql.ArgumentConfig{Type: graphql.String},
+		"from":           &graphql.ArgumentConfig{Type: graphql.String, Description: "YYYY-MM-DD or RFC 3339 timestamp"},
+		"to":             &graphql.ArgumentConfig{Type: graphql.String, Description: "YYYY-MM-DD (inclusive) or RFC 3339 timestamp (exclusive)"},
+		"limit":          &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 50},
+		"offset":         &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+		"after":          &graphql.ArgumentConfig{Type: graphql.String, Description: "next_cursor of the previous page"},
+		"device_id":      &graphql.ArgumentConfig{Type: graphql.String},
+		"location":       &graphql.ArgumentConfig{Type: graphql.String},
+	}
+	if topLevel {
+		args["name"] = &graphql.ArgumentConfig{Type: graphql.String}
+		args["person_id"] = &graphql.ArgumentConfig{Type: graphql.String}
+		args["department"] = &graphql.ArgumentConfig{Type: graphql.String}
+		args["group"] = &graphql.ArgumentConfig{Type: graphql.String}
+	}
+	return args
+}
+
+// attendanceQuery turns the arguments of an attendance field into a query,
+// validated like the query parameters of /api/v1/attendance/recent, with
+// dates in loc
+func attendanceQuery(args map[string]interface{}, loc *time.Location) (domain.AttendanceQuery, error) {
+	q := domain.AttendanceQuery{GroupFilter: groupArgsFilter(args), SourceFilter: sourceArgsFilter(args)}
+	q.Name, _ = args["name"].(string)
+	q.PersonID, _ = args["person_id"].(string)
+	q.Status, _ = args["status"].(string)
+	q.MinConfidence, _ = args["min_confidence"].(float64)
+	q.Tag, _ = args["tag"].(string)
+	q.Limit, _ = args["limit"].(int)
+	q.Offset, _ = args["offset"].(int)
+	q.Cursor, _ = args["after"].(string)
+
+	if q.Status != "" && q.Status != "authorized" && q.Status != "unauthorized" {
+		return q, fmt.Errorf("status must be authorized or unauthorized")
+	}
+	if q.Limit < 1 || q.Limit > maxGraphQLLimit {
+		return q, fmt.Errorf("limit must be between 1 and %d", maxGraphQLLimit)
+	}
+	if q.Offset < 0 {
+		return q, fmt.Errorf("offset must be a non-negative integer")
+	}
+
+	if v, _ := args["from"].(string); v != "" {
+		from, _, err := parseTimeParam(v, loc)
+		if err != nil {
+			return q, fmt.Errorf("invalid from: %w", err)
+		}
+		q.From = from
+	}
+	if v, _ := args["to"].(string); v != "" {
+		to, dateOnly, err := parseTimeParam(v, loc)
+		if err != nil {
+			return q, fmt.Errorf("invalid to: %w", err)
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		q.To = to
+	}
+
+	return q, nil
+}
+
+func groupArgsFilter(args map[string]interface{}) domain.GroupFilter {
+	var filter domain.GroupFilter
+	filter.Department, _ = args["department"].(string)
+	filter.Group, _ = args["group"].(string)
+	return filter
+}
+
+func sourceArgsFilter(args map[string]interface{}) domain.SourceFilter {
+	var filter domain.SourceFilter
+	filter.DeviceID, _ = args["device_id"].(string)
+	filter.Location, _ = args["location"].(string)
+	return filter
+}
+
+// personID returns the ID of a person resolved by a list or a lookup
+func personID(source interface{}) string {
+	switch person := source.(type) {
+	case domain.Person:
+		return person.ID
+	case *domain.Person:
+		return person.ID
+	}
+	return ""
+}
@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"attendance-api/internal/client"
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/pb/attendancev1"
+	"attendance-api/internal/service"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// GRPCScopes is the scope each method of the attendance.v1.Attendance
+// service requires, matching the HTTP routes they mirror
+var GRPCScopes = map[string]string{
+	attendancev1.Attendance_RecordAttendance_FullMethodName: domain.ScopeAttendanceWrite,
+	attendancev1.Attendance_ListFaces_FullMethodName:        domain.ScopeReportsRead,
+	attendancev1.Attendance_Watch_FullMethodName:            domain.ScopeRecordsRead,
+}
+
+// GRPCServer serves the attendance.v1.Attendance service (see
+// api/proto/attendance/v1/attendance.proto) for devices that would rather
+// not send multipart HTTP
+type GRPCServer struct {
+	attendancev1.UnimplementedAttendanceServer
+
+	faceClient        client.Recognizer
+	attendanceService *service.AttendanceService
+	replication       *service.ReplicationService
+	config            *config.Config
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func NewGRPCServer(faceClient client.Recognizer, attendanceService *service.AttendanceService, replication *service.ReplicationService, cfg *config.Config) *GRPCServer {
+	return &GRPCServer{
+		faceClient:        faceClient,
+		attendanceService: attendanceService,
+		replication:       replication,
+		config:            cfg,
+		closing:           make(chan struct{}),
+	}
+}
+
+// Close ends the open Watch streams so a graceful stop does not wait on them
+func (s *GRPCServer) Close() {
+	s.closeOnce.Do(func() { close(s.closing) })
+}
+
+// RecordAttendance is the gRPC flavour of POST /api/v1/attendance
+func (s *GRPCServer) RecordAttendance(ctx context.Context, req *attendancev1.RecordAttendanceRequest) (*attendancev1.RecordAttendanceResponse, error) {
+	if s.replication.IsStandby() {
+		return nil, status.Error(codes.Unavailable, "This node is a standby, send writes to the active node")
+	}
+	if len(req.GetImage()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Image is required")
+	}
+	if int64(len(req.GetImage())) > s.config.Upload.MaxUploadSize {
+		return nil, status.Error(codes.InvalidArgument, "Image exceeds the maximum upload size")
+	}
+	if err := service.CheckImage(req.GetImage(), s.config.Upload); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var clientCert string
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			clientCert = clientCertName(&info.State)
+		}
+	}
+	if s.config.Server.TLS.ClientCAFile != "" && clientCert == "" {
+		return nil, status.Error(codes.PermissionDenied, "A client certificate is required to record attendance")
+	}
+	actor := domain.ActorFromContext(ctx)
+	if s.config.Auth.RequireDeviceToken && actor.Type != domain.ActorDevice {
+		return nil, status.Error(codes.PermissionDenied, "A device token is required to record attendance")
+	}
+	device, location := req.GetDeviceId(), req.GetLocation()
+	if actor.Type == domain.ActorDevice {
+		device = actor.Device
+		if actor.Location != "" {
+			location = actor.Location
+		}
+	}
+
+	filename := req.GetFilename()
+	if filename == "" {
+		filename = "image.jpg"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.FaceAPI.Timeout)
+	defer cancel()
+
+	response, err := s.attendanceService.RecordAttendance(ctx, domain.AttendanceSubmission{
+		ImageData:  req.GetImage(),
+		Filename:   filename,
+		DeviceID:   device,
+		Location:   location,
+		ClientCert: clientCert,
+		ExternalID: req.GetExternalId(),
+	})
+	switch {
+	case errors.Is(err, service.ErrDuplicateReference):
+		return nil, status.Error(codes.AlreadyExists, "Submission already recorded")
+	case errors.Is(err, client.ErrFaceServiceBusy):
+		return nil, status.Error(codes.ResourceExhausted, "Face service busy, retry later")
+	case err != nil:
+		logging.From(ctx).Error("Failed to record attendance", "device", device, "error", err)
+		if response == nil {
+			return nil, status.Error(codes.Internal, "Failed to process attendance")
+		}
+	}
+
+	return attendanceResponseMessage(response), nil
+}
+
+// ListFaces is the gRPC flavour of GET /api/v1/faces
+func (s *GRPCServer) ListFaces(ctx context.Context, req *attendancev1.ListFacesRequest) (*attendancev1.ListFacesResponse, error) {
+	faces, err := s.faceClient.GetFaces(ctx)
+	if err != nil {
+		logging.From(ctx).Error("Failed to get faces", "error", err)
+		return nil, status.Error(codes.Internal, "Failed to get faces")
+	}
+
+	resp := &attendancev1.ListFacesResponse{Faces: make([]*attendancev1.Face, 0, len(faces))}
+	for _, face := range faces {
+		resp.Faces = append(resp.Faces, &attendancev1.Face{Name: face.Name, Images: int32(face.Images)})
+	}
+	return resp, nil
+}
+
+// Watch is the gRPC flavour of GET /api/v1/attendance/stream
+func (s *GRPCServer) Watch(req *attendancev1.WatchRequest, stream attendancev1.Attendance_WatchServer) error {
+	clientID, messageChan, err := s.attendanceService.Subscribe(domain.StreamFilter{Person: req.GetPerson()})
+	if errors.Is(err, service.ErrTooManyStreams) {
+		return status.Error(codes.ResourceExhausted, "Too many event stream clients")
+	}
+	defer s.attendanceService.Unsubscribe(clientID)
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.closing:
+			return status.Error(codes.Unavailable, "Server shutting down")
+		case msg, ok := <-messageChan:
+			if !ok {
+				return nil
+			}
+			// Face changes travel as a record of the person and device
+			// changes as one of the device; the stats have no place in the
+			// message
+			var record domain.AttendanceRecord
+			switch {
+			case msg.Record != nil:
+				record = *msg.Record
+			case msg.Face != nil:
+				record = domain.AttendanceRecord{Name: msg.Face.Name, Timestamp: msg.Face.Timestamp, Actor: msg.Face.Actor}
+			case msg.Device != nil:
+				record = domain.AttendanceRecord{DeviceID: msg.Device.ID, Location: msg.Device.Location, Timestamp: msg.Device.Timestamp}
+			case msg.Config != nil && msg.Config.UpdatedAt != nil:
+				record = domain.AttendanceRecord{DeviceID: msg.Config.Device, Timestamp: *msg.Config.UpdatedAt}
+			default:
+				continue
+			}
+			event := &attendancev1.AttendanceEvent{
+				Event:  msg.Event,
+				Record: attendanceRecordMessage(record),
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func attendanceResponseMessage(r *domain.AttendanceResponse) *attendancev1.RecordAttendanceResponse {
+	resp := &attendancev1.RecordAttendanceResponse{
+		Success:        r.Success,
+		Authorized:     r.Authorized,
+		Name:           r.Name,
+		Confidence:     r.Confidence,
+		Message:        r.Message,
+		Action:         r.Action,
+		EventType:      r.EventType,
+		Duplicate:      r.Duplicate,
+		Misplaced:      r.Misplaced,
+		ObserveOnly:    r.ObserveOnly,
+		IntendedAction: r.IntendedAction,
+		Faces:          make([]*attendancev1.FaceOutcome, 0, len(r.Faces)),
+	}
+	for _, face := range r.Faces {
+		resp.Faces = append(resp.Faces, &attendancev1.FaceOutcome{
+			Name:       face.Name,
+			Confidence: face.Confidence,
+			Authorized: face.Authorized,
+			Message:    face.Message,
+			EventType:  face.EventType,
+			Duplicate:  face.Duplicate,
+			Misplaced:  face.Misplaced,
+		})
+	}
+	return resp
+}
+
+func attendanceRecordMessage(r domain.AttendanceRecord) *attendancev1.AttendanceRecord {
+	record := &attendancev1.AttendanceRecord{
+		Id:                r.ID,
+		Name:              r.Name,
+		PersonId:          r.PersonID,
+		ExternalId:        r.ExternalID,
+		Confidence:        r.Confidence,
+		Timestamp:         timestamppb.New(r.Timestamp),
+		Status:            r.Status,
+		DeviceId:          r.DeviceID,
+		EventType:         r.EventType,
+		Location:          r.Location,
+		Misplaced:         r.Misplaced,
+		Late:              r.Late,
+		EarlyLeaveMinutes: int32(r.EarlyLeaveMinutes),
+		EarlyLeave:        r.EarlyLeave,
+		ObserveOnly:       r.ObserveOnly,
+	}
+	if r.LatenessMinutes != nil {
+		lateness := int32(*r.LatenessMinutes)
+		record.LatenessMinutes = &lateness
+	}
+	return record
+}
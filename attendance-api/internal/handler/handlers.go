@@ -3,24 +3,45 @@ package handler
 import (
 	"attendance-api/internal/client"
 	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
 	"attendance-api/internal/service"
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Handler struct {
-	faceClient        *client.FaceRecognitionClient
+	faceClient        client.Recognizer
 	attendanceService *service.AttendanceService
+	enrollment        *service.EnrollmentService
+	jobs              *service.JobManager
+	recognitions      *service.JobManager // asynchronous attendance requests
+	audit             *service.AuditService
+	clock             *service.ClockService
 	config            *config.Config
 }
 
-func NewHandler(faceClient *client.FaceRecognitionClient, attendanceService *service.AttendanceService, cfg *config.Config) *Handler {
+func NewHandler(faceClient client.Recognizer, attendanceService *service.AttendanceService, enrollment *service.EnrollmentService, jobs, recognitions *service.JobManager, audit *service.AuditService, clock *service.ClockService, cfg *config.Config) *Handler {
 	return &Handler{
 		faceClient:        faceClient,
 		attendanceService: attendanceService,
+		enrollment:        enrollment,
+		jobs:              jobs,
+		recognitions:      recognitions,
+		audit:             audit,
+		clock:             clock,
 		config:            cfg,
 	}
 }
@@ -31,18 +52,107 @@ func (h *Handler) ListFaces(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	query := r.URL.Query()
+
+	offset := 0
+	if v := query.Get("offset"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			jsonError(w, "offset must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		offset = parsed
+	}
+
+	// No limit returns every face, as before pagination was added
+	limit := -1
+	if v := query.Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			jsonError(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	if query.Get("format") == "ndjson" || strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		h.streamFaces(w, r, offset, limit)
+		return
+	}
+
 	faces, err := h.faceClient.GetFaces(r.Context())
 	if err != nil {
-		fmt.Printf("ERROR: Failed to get faces: %v\n", err)
-		h.jsonError(w, "Failed to get faces", http.StatusInternalServerError)
+		logging.From(r.Context()).Error("Failed to get faces", "error", err)
+		jsonError(w, "Failed to get faces", http.StatusInternalServerError)
 		return
 	}
 
-	h.jsonResponse(w, map[string]interface{}{
+	total := len(faces)
+	page := faces[min(offset, total):]
+	if limit >= 0 && limit < len(page) {
+		page = page[:limit]
+	}
+
+	response := map[string]interface{}{
 		"success": true,
-		"count":   len(faces),
-		"faces":   faces,
-	}, http.StatusOK)
+		"count":   len(page),
+		"total":   total,
+		"faces":   page,
+	}
+	if limit >= 0 {
+		response["offset"] = offset
+		response["limit"] = limit
+	}
+
+	jsonResponse(w, response, http.StatusOK)
+}
+
+// errPageComplete stops the face stream once the requested page is written
+var errPageComplete = errors.New("page complete")
+
+// streamFaces writes the face list as newline-delimited JSON, one person per
+// line, as it is read from the face service
+func (h *Handler) streamFaces(w http.ResponseWriter, r *http.Request, offset, limit int) {
+	flusher, _ := w.(http.Flusher)
+
+	index, written := 0, 0
+
+	err := h.faceClient.StreamFaces(r.Context(), func(face domain.Face) error {
+		index++
+		if index <= offset {
+			return nil
+		}
+		if limit >= 0 && written >= limit {
+			return errPageComplete
+		}
+
+		if written == 0 {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+		}
+		if err := json.NewEncoder(w).Encode(face); err != nil {
+			return err
+		}
+		written++
+
+		if flusher != nil && written%100 == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, errPageComplete) {
+		logging.From(r.Context()).Error("Failed to stream faces", "error", err)
+		if written == 0 {
+			jsonError(w, "Failed to get faces", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if written == 0 {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
 }
 
 func (h *Handler) UploadFaces(w http.ResponseWriter, r *http.Request) {
@@ -51,54 +161,70 @@ func (h *Handler) UploadFaces(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fmt.Printf("DEBUG: Starting face upload\n")
+	logger := logging.From(r.Context())
+	logger.Debug("Starting face upload")
 
 	if err := r.ParseMultipartForm(h.config.Upload.MaxMemory); err != nil {
-		fmt.Printf("ERROR: Failed to parse multipart form: %v\n", err)
-		h.jsonError(w, "Failed to parse form", http.StatusBadRequest)
+		logger.Warn("Failed to parse multipart form", "error", err)
+		jsonError(w, "Failed to parse form", http.StatusBadRequest)
 		return
 	}
 
-	name := r.FormValue("name")
+	name := service.NormalizeName(r.FormValue("name"))
 	if name == "" {
-		fmt.Printf("ERROR: Name is missing\n")
-		h.jsonError(w, "Name is required", http.StatusBadRequest)
+		logger.Warn("Face upload without a name")
+		jsonError(w, "Name is required", http.StatusBadRequest)
 		return
 	}
 
-	fmt.Printf("DEBUG: Name=%s\n", name)
+	logger = logger.With("person", name)
 
 	files := r.MultipartForm.File["images"]
 	if len(files) == 0 {
-		fmt.Printf("ERROR: No images in request\n")
-		h.jsonError(w, "At least one image is required", http.StatusBadRequest)
+		logger.Warn("Face upload without images")
+		jsonError(w, "At least one image is required", http.StatusBadRequest)
+		return
+	}
+	if maxFiles := h.config.Upload.MaxFiles; maxFiles > 0 && len(files) > maxFiles {
+		logger.Warn("Too many face images", "images", len(files))
+		jsonError(w, fmt.Sprintf("At most %d images can be uploaded at once", maxFiles), http.StatusBadRequest)
 		return
 	}
 
-	fmt.Printf("DEBUG: Received %d images\n", len(files))
+	logger.Debug("Received face images", "images", len(files))
+
+	// In dry-run mode every problem is reported per image instead of
+	// failing the request on the first one
+	dryRun := isDryRun(r)
 
 	var images [][]byte
 	var filenames []string
 
 	for _, fileHeader := range files {
-		if fileHeader.Size > h.config.Upload.MaxUploadSize {
-			fmt.Printf("ERROR: File %s too large: %d bytes\n", fileHeader.Filename, fileHeader.Size)
-			h.jsonError(w, fmt.Sprintf("File %s exceeds maximum size of 5MB", fileHeader.Filename), http.StatusBadRequest)
+		if fileHeader.Size > h.config.Upload.MaxUploadSize && !dryRun {
+			logger.Warn("Face image too large", "file", fileHeader.Filename, "bytes", fileHeader.Size)
+			jsonError(w, fmt.Sprintf("File %s exceeds maximum size of 5MB", fileHeader.Filename), http.StatusBadRequest)
 			return
 		}
 
 		file, err := fileHeader.Open()
 		if err != nil {
-			fmt.Printf("ERROR: Failed to open file %s: %v\n", fileHeader.Filename, err)
-			h.jsonError(w, "Failed to open file", http.StatusInternalServerError)
+			logger.Error("Failed to open face image", "file", fileHeader.Filename, "error", err)
+			jsonError(w, "Failed to open file", http.StatusInternalServerError)
 			return
 		}
 		defer file.Close()
 
 		data, err := io.ReadAll(file)
 		if err != nil {
-			fmt.Printf("ERROR: Failed to read file %s: %v\n", fileHeader.Filename, err)
-			h.jsonError(w, "Failed to read file", http.StatusInternalServerError)
+			logger.Error("Failed to read face image", "file", fileHeader.Filename, "error", err)
+			jsonError(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+
+		if err := service.CheckImage(data, h.config.Upload); err != nil && !dryRun {
+			logger.Warn("Face image rejected", "file", fileHeader.Filename, "error", err)
+			jsonError(w, fmt.Sprintf("File %s: %v", fileHeader.Filename, err), imageErrorStatus(err))
 			return
 		}
 
@@ -106,28 +232,185 @@ func (h *Handler) UploadFaces(w http.ResponseWriter, r *http.Request) {
 		filenames = append(filenames, fileHeader.Filename)
 	}
 
-	fmt.Printf("DEBUG: Calling face API to add face...\n")
+	if dryRun {
+		plan, err := h.enrollment.PlanEnrollment(r.Context(), name, images, filenames, h.config.Upload)
+		if err != nil {
+			logger.Error("Failed to plan enrollment", "error", err)
+			jsonError(w, fmt.Sprintf("Failed to plan enrollment: %v", err), http.StatusBadGateway)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"dry_run": true,
+			"plan":    plan,
+		}, http.StatusOK)
+		return
+	}
+
+	// A new name close to an enrolled one is most likely a second spelling
+	// of the same person; new_person=true confirms it is someone else
+	if r.FormValue("new_person") != "true" {
+		suggestions, err := h.enrollment.Collisions(r.Context(), name)
+		if err != nil {
+			logger.Error("Failed to check name collisions", "error", err)
+			jsonError(w, "Failed to check name", http.StatusBadGateway)
+			return
+		}
+		if len(suggestions) > 0 {
+			jsonResponse(w, map[string]interface{}{
+				"success":     false,
+				"error":       "Similar names are already enrolled; upload to one of them, or set new_person=true",
+				"name":        name,
+				"suggestions": suggestions,
+			}, http.StatusConflict)
+			return
+		}
+	}
+
+	logger.Debug("Calling face API to add face")
 
-	if err := h.faceClient.AddFace(r.Context(), name, images, filenames); err != nil {
-		fmt.Printf("ERROR: Failed to add face: %v\n", err)
-		h.jsonError(w, fmt.Sprintf("Failed to add face: %v", err), http.StatusInternalServerError)
+	result, err := h.enrollment.Enroll(r.Context(), name, images, filenames, h.config.Upload.MinQuality)
+	if err != nil {
+		logger.Error("Failed to add face", "error", err)
+		jsonError(w, fmt.Sprintf("Failed to add face: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	fmt.Printf("DEBUG: Successfully added face for %s\n", name)
+	if result.Added == 0 {
+		logger.Warn("All face images were rejected", "failed", result.Failed)
+		jsonResponse(w, map[string]interface{}{
+			"success":       false,
+			"error":         "None of the images could be added",
+			"name":          name,
+			"images_added":  0,
+			"images_failed": result.Failed,
+			"images":        result.Images,
+		}, http.StatusBadRequest)
+		return
+	}
+
+	logger.Info("Added face images", "added", result.Added, "images", len(images))
+	auditChange(h.audit, r, domain.AuditFaceUpload,
+		fmt.Sprintf("%s: %d image(s) added, %d failed", name, result.Added, result.Failed))
+	h.attendanceService.FaceAdded(r.Context(), name, result.Added)
 
 	// Trigger reload on face recognition API to sync all workers
 	if err := h.faceClient.ReloadFaces(r.Context()); err != nil {
-		fmt.Printf("WARNING: Failed to reload faces: %v\n", err)
+		logger.Warn("Failed to reload faces", "error", err)
 		// Don't fail the request, faces will be reloaded eventually
 	}
 
-	h.jsonResponse(w, map[string]interface{}{
-		"success":      true,
-		"message":      fmt.Sprintf("Successfully added %d image(s) for %s", len(images), name),
-		"name":         name,
-		"images_added": len(images),
-	}, http.StatusCreated)
+	// Some images rejected: report each one with 207 Multi-Status
+	status := http.StatusCreated
+	message := fmt.Sprintf("Successfully added %d image(s) for %s", result.Added, name)
+	if result.Failed > 0 {
+		status = http.StatusMultiStatus
+		message += fmt.Sprintf(" (%d failed)", result.Failed)
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":       true,
+		"message":       message,
+		"name":          name,
+		"images_added":  result.Added,
+		"images_failed": result.Failed,
+		"images":        result.Images,
+	}, status)
+}
+
+// ListFaceImages handles GET /api/v1/faces/{name}/images, the image files the
+// face service stores for a person
+func (h *Handler) ListFaceImages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("name")
+	files, err := h.faceClient.ListFaceImages(r.Context(), name)
+	switch {
+	case errors.Is(err, client.ErrFaceNotFound):
+		jsonError(w, "Face not found", http.StatusNotFound)
+		return
+	case errors.Is(err, client.ErrUnsupported):
+		jsonError(w, "The face backend does not support listing images", http.StatusNotImplemented)
+		return
+	case err != nil:
+		logging.From(r.Context()).Error("Failed to list face images", "person", name, "error", err)
+		jsonError(w, "Failed to list images", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"name":    name,
+		"count":   len(files),
+		"images":  files,
+	}, http.StatusOK)
+}
+
+// DeleteFace removes a person from the face service. ?history=anonymize or
+// ?history=delete also cleans up their attendance history, which is kept by
+// default. ?dry_run=true only reports what would be removed.
+func (h *Handler) DeleteFace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("name")
+	history := r.URL.Query().Get("history")
+	switch history {
+	case "":
+		history = domain.HistoryKeep
+	case domain.HistoryKeep, domain.HistoryAnonymize, domain.HistoryDelete:
+	default:
+		jsonError(w, "history must be keep, anonymize or delete", http.StatusBadRequest)
+		return
+	}
+
+	dryRun := isDryRun(r)
+
+	var removal *domain.FaceRemoval
+	var err error
+	if dryRun {
+		removal, err = h.attendanceService.PlanFaceRemoval(r.Context(), name, history)
+	} else {
+		removal, err = h.attendanceService.RemoveFace(r.Context(), name, history)
+	}
+	switch {
+	case errors.Is(err, client.ErrFaceNotFound):
+		jsonError(w, "Face not found", http.StatusNotFound)
+		return
+	case errors.Is(err, client.ErrUnsupported):
+		jsonError(w, "The face backend does not support removing faces", http.StatusNotImplemented)
+		return
+	case err != nil:
+		logging.From(r.Context()).Error("Failed to remove face", "person", name, "dry_run", dryRun, "error", err)
+		jsonError(w, "Failed to remove face", http.StatusInternalServerError)
+		return
+	}
+
+	if dryRun {
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"dry_run": true,
+			"removal": removal,
+		}, http.StatusOK)
+		return
+	}
+	auditChange(h.audit, r, domain.AuditFaceDelete, fmt.Sprintf("%s: history=%s", name, history))
+
+	// Trigger reload on face recognition API to sync all workers
+	if err := h.faceClient.ReloadFaces(r.Context()); err != nil {
+		logging.From(r.Context()).Warn("Failed to reload faces", "error", err)
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"removal": removal,
+	}, http.StatusOK)
 }
 
 func (h *Handler) RecordAttendance(w http.ResponseWriter, r *http.Request) {
@@ -136,43 +419,178 @@ func (h *Handler) RecordAttendance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	clientCert := clientCertName(r.TLS)
+	if h.config.Server.TLS.ClientCAFile != "" && clientCert == "" {
+		jsonError(w, "A client certificate is required to record attendance", http.StatusForbidden)
+		return
+	}
+	actor := domain.ActorFromContext(r.Context())
+	if h.config.Auth.RequireDeviceToken && actor.Type != domain.ActorDevice {
+		jsonError(w, "A device token is required to record attendance", http.StatusForbidden)
+		return
+	}
+
 	if err := r.ParseMultipartForm(h.config.Upload.MaxMemory); err != nil {
-		h.jsonError(w, "Failed to parse form", http.StatusBadRequest)
+		jsonError(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	nonce := r.FormValue("nonce")
+	if len(nonce) > maxNonceLength {
+		jsonError(w, fmt.Sprintf("nonce must be at most %d characters", maxNonceLength), http.StatusBadRequest)
 		return
 	}
 
 	file, fileHeader, err := r.FormFile("image")
 	if err != nil {
-		h.jsonError(w, "Image is required", http.StatusBadRequest)
+		jsonError(w, "Image is required", http.StatusBadRequest)
 		return
 	}
 	defer file.Close()
 
 	if fileHeader.Size > h.config.Upload.MaxUploadSize {
-		h.jsonError(w, "File exceeds maximum size of 5MB", http.StatusBadRequest)
+		jsonError(w, "File exceeds maximum size of 5MB", http.StatusBadRequest)
 		return
 	}
 
 	imageData, err := io.ReadAll(file)
 	if err != nil {
-		h.jsonError(w, "Failed to read image", http.StatusInternalServerError)
+		jsonError(w, "Failed to read image", http.StatusInternalServerError)
+		return
+	}
+	if err := service.CheckImage(imageData, h.config.Upload); err != nil {
+		jsonError(w, err.Error(), imageErrorStatus(err))
+		return
+	}
+
+	// Records of a registered device carry the ID its token belongs to and
+	// the location it was registered at, if any
+	device, location := deviceID(r, r.FormValue("device_id")), r.FormValue("location")
+	if actor.Type == domain.ActorDevice && actor.Location != "" {
+		location = actor.Location
+	}
+
+	// A device may send its clock with every submission; a bad value must
+	// not keep the door closed, so it is only logged
+	received := time.Now()
+	if value := r.FormValue("device_time"); value != "" {
+		if deviceTime, err := service.ParseDeviceTime(value); err != nil {
+			logging.From(r.Context()).Warn("Ignoring device_time", "device_time", value, "error", err)
+		} else if device != "" {
+			if _, err := h.clock.Observe(device, deviceTime, received); err != nil {
+				logging.From(r.Context()).Error("Failed to record clock skew", "error", err)
+			}
+		}
+	}
+
+	submission := domain.AttendanceSubmission{
+		ImageData:  imageData,
+		Filename:   fileHeader.Filename,
+		DeviceID:   device,
+		Location:   location,
+		DoorID:     r.FormValue("door_id"),
+		ClientCert: clientCert,
+		ExternalID: r.FormValue("external_id"),
+	}
+	if async, _ := strconv.ParseBool(r.URL.Query().Get("async")); async {
+		h.recordAttendanceAsync(w, r, submission, nonce)
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), h.config.FaceAPI.Timeout)
 	defer cancel()
 
-	response, err := h.attendanceService.RecordAttendance(ctx, imageData, fileHeader.Filename)
+	response, err := h.attendanceService.RecordAttendance(ctx, submission)
+	logger := logging.From(r.Context()).With("device", device)
+
+	statusCode := http.StatusOK
+	switch {
+	case errors.Is(err, service.ErrDuplicateReference):
+		logger.Warn("Submission already recorded", "error", err)
+		statusCode = http.StatusConflict
+	case errors.Is(err, client.ErrFaceServiceBusy):
+		// The device retries later; the door stays closed meanwhile
+		logger.Warn("Face service busy", "error", err)
+		w.Header().Set("Retry-After", "1")
+		statusCode = http.StatusServiceUnavailable
+	case err != nil:
+		logger.Error("Failed to record attendance", "error", err)
+	}
+	if response == nil {
+		jsonError(w, "Failed to process attendance", http.StatusInternalServerError)
+		return
+	}
+
+	response.ServerTime = time.Now()
+	secret := h.config.Attendance.SigningSecret
+	if secret == "" {
+		jsonResponse(w, response, statusCode)
+		return
+	}
+
+	stampResponse(response, nonce)
+	signedJSONResponse(w, response, secret, statusCode)
+}
+
+// recordAttendanceAsync queues a submission for the recognition workers and
+// answers 202 at once with the job. The decision is the job's result, read
+// with GET /api/v1/jobs/{id} or from the recognition_completed event; a
+// burst of requests waits in the queue instead of reaching the face service
+// together. With response signing the decision carries the nonce, and the
+// job is served signed to the device that submitted it.
+func (h *Handler) recordAttendanceAsync(w http.ResponseWriter, r *http.Request, sub domain.AttendanceSubmission, nonce string) {
+	// The job outlives the request, so the device is attributed explicitly
+	actor := domain.ActorFromContext(r.Context())
+	signed := h.config.Attendance.SigningSecret != ""
+
+	job, err := h.recognitions.Submit(domain.JobRecognition, jobOwner(actor), func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(domain.WithActor(ctx, actor), h.config.FaceAPI.Timeout)
+		defer cancel()
+
+		response, err := h.attendanceService.RecordAttendance(ctx, sub)
+		if response != nil {
+			response.ServerTime = time.Now()
+			if signed {
+				stampResponse(response, nonce)
+			}
+		}
+		return response, err
+	})
+	if errors.Is(err, service.ErrJobQueueFull) {
+		w.Header().Set("Retry-After", "1")
+		jsonError(w, "Too many recognitions queued, try again later", http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
-		fmt.Printf("Attendance error: %v\n", err)
+		logging.From(r.Context()).Error("Failed to queue recognition", "error", err)
+		jsonError(w, "Failed to queue recognition", http.StatusInternalServerError)
+		return
 	}
 
-	statusCode := http.StatusOK
-	if response != nil {
-		h.jsonResponse(w, response, statusCode)
-	} else {
-		h.jsonError(w, "Failed to process attendance", http.StatusInternalServerError)
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"job":     job,
+	}, http.StatusAccepted)
+}
+
+// maxNonceLength bounds the nonce a device may send with a recognition
+// request, which is echoed in the signed response
+const maxNonceLength = 64
+
+func randomNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// stampResponse adds the fields a signature covers to a decision: the
+// device's nonce, or a random one, and the server time in Unix seconds
+func stampResponse(response *domain.AttendanceResponse, nonce string) {
+	if nonce == "" {
+		nonce = randomNonce()
 	}
+	response.Nonce = nonce
+	response.Timestamp = response.ServerTime.Unix()
 }
 
 func (h *Handler) AttendanceStream(w http.ResponseWriter, r *http.Request) {
@@ -181,10 +599,49 @@ func (h *Handler) AttendanceStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A personal stream only carries one person's events, followed by their
+	// updated hours for today
+	query := r.URL.Query()
+	person := query.Get("person")
+
+	// A security display may only want some events, e.g. denied entries
+	filter := domain.StreamFilter{
+		Person: person,
+		Status: query.Get("status"),
+	}
+	if v := query.Get("event"); v != "" {
+		filter.Events = strings.Split(v, ",")
+	}
+	if v := query.Get("name"); v != "" {
+		filter.Name = service.NormalizeName(v)
+	}
+	if filter.Status != "" && filter.Status != "authorized" && filter.Status != "unauthorized" {
+		jsonError(w, "status must be authorized or unauthorized", http.StatusBadRequest)
+		return
+	}
+
+	// A reconnecting EventSource sends the ID of the last event it got;
+	// clients that cannot set headers may pass it as last_event_id
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get("last_event_id")
+	}
+	after, _ := strconv.ParseUint(lastEventID, 10, 64)
+
+	clientID, messageChan, missed, complete, err := h.attendanceService.SubscribeAfter(filter, after)
+	if errors.Is(err, service.ErrTooManyStreams) {
+		w.Header().Set("Retry-After", "30")
+		jsonError(w, "Too many event stream clients, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	defer h.attendanceService.Unsubscribe(clientID)
+
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
+	// nginx buffers responses by default, which holds events back
+	w.Header().Set("X-Accel-Buffering", "no")
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
@@ -192,61 +649,248 @@ func (h *Handler) AttendanceStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	clientID, messageChan := h.attendanceService.Subscribe()
-	defer h.attendanceService.Unsubscribe(clientID)
-
+	r = r.WithContext(logging.With(r.Context(), "client_id", clientID))
 	ctx := r.Context()
 
 	// Send initial connection success message
 	fmt.Fprintf(w, "event: connected\n")
 	fmt.Fprintf(w, "data: {\"message\":\"Connected to attendance stream\",\"client_id\":\"%s\"}\n\n", clientID)
+	if !complete {
+		// Clients should reload what they show from the REST endpoints
+		fmt.Fprintf(w, "event: replay_incomplete\n")
+		fmt.Fprintf(w, "data: {\"message\":\"Some events since %d are no longer available\"}\n\n", after)
+	}
+	for _, msg := range missed {
+		writeEvent(w, msg, person)
+	}
+	if person != "" {
+		h.writeTodaySummary(w, r, person)
+	}
 	flusher.Flush()
 
+	// Heartbeat comments keep proxies from closing an idle stream. A client
+	// that stopped reading shows up as a heartbeat that cannot be written
+	// within the interval, instead of lingering until the TCP timeout.
+	var heartbeat <-chan time.Time
+	interval := h.config.Server.SSEHeartbeat
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+	controller := http.NewResponseController(w)
+
 	for {
 		select {
 		case <-ctx.Done():
 			// Client disconnected
 			return
+		case <-heartbeat:
+			controller.SetWriteDeadline(time.Now().Add(interval))
+			fmt.Fprint(w, ": ping\n\n")
+			if err := controller.Flush(); err != nil {
+				logging.From(ctx).Warn("SSE client stopped responding", "error", err)
+				return
+			}
+			controller.SetWriteDeadline(time.Time{})
 		case msg, ok := <-messageChan:
 			if !ok {
 				// Channel closed
 				return
 			}
 
-			data, err := json.Marshal(msg.Data)
-			if err != nil {
-				continue
+			writeEvent(w, msg, person)
+			if person != "" && msg.Event == "attendance" {
+				h.writeTodaySummary(w, r, person)
 			}
-
-			fmt.Fprintf(w, "event: %s\n", msg.Event)
-			fmt.Fprintf(w, "data: %s\n\n", data)
 			flusher.Flush()
 		}
 	}
 }
 
+// GetStreamStats handles GET /api/v1/admin/streams and reports the
+// connected event stream clients, how full their queues are and the events
+// lost to slow clients
+func (h *Handler) GetStreamStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"streams": h.attendanceService.GetSSEStats(),
+	}, http.StatusOK)
+}
+
+// writeEvent sends a broadcast event with its ID, so the client can resume
+// after it
+func writeEvent(w http.ResponseWriter, msg domain.SSEMessage, person string) {
+	if person != "" {
+		// Personal streams do not reveal which key recorded the event
+		if msg.Record != nil {
+			record := *msg.Record
+			record.Actor = nil
+			msg.Record = &record
+		}
+		if msg.Face != nil {
+			face := *msg.Face
+			face.Actor = nil
+			msg.Face = &face
+		}
+	}
+
+	data, err := json.Marshal(msg.Data())
+	if err != nil {
+		return
+	}
+
+	if msg.ID != 0 {
+		fmt.Fprintf(w, "id: %d\n", msg.ID)
+	}
+	fmt.Fprintf(w, "event: %s\n", msg.Event)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
+// writeTodaySummary sends a person's sessions and hours worked today as a
+// summary event
+func (h *Handler) writeTodaySummary(w http.ResponseWriter, r *http.Request, person string) {
+	hours, err := h.attendanceService.GetWorkedHours(person, time.Now().In(h.attendanceService.Location()).Format("2006-01-02"))
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to get worked hours for stream", "error", err)
+		return
+	}
+
+	data, err := json.Marshal(hours)
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(w, "event: summary\n")
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
+// GetRecentAttendance handles GET /api/v1/attendance/recent?limit=&offset=&cursor=
+// &name=&person_id=&status=&min_confidence=&tag=&from=&to=&department=&group=
 func (h *Handler) GetRecentAttendance(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	query := r.URL.Query()
+
 	limit := 50
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+	if limitStr := query.Get("limit"); limitStr != "" {
 		if parsed, err := fmt.Sscanf(limitStr, "%d", &limit); err == nil && parsed == 1 {
 			if limit > 1000 {
 				limit = 1000
 			}
 		}
 	}
+	if limit < 1 {
+		limit = 1
+	}
+
+	q := domain.AttendanceQuery{
+		GroupFilter:  groupFilter(r),
+		SourceFilter: sourceFilter(r),
+		Name:         query.Get("name"),
+		PersonID:     query.Get("person_id"),
+		Status:       query.Get("status"),
+		Tag:          query.Get("tag"),
+		Limit:        limit,
+		Cursor:       query.Get("cursor"),
+	}
+
+	if q.Status != "" && q.Status != "authorized" && q.Status != "unauthorized" {
+		jsonError(w, "status must be authorized or unauthorized", http.StatusBadRequest)
+		return
+	}
+
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			jsonError(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		q.Offset = offset
+	}
+
+	if v := query.Get("min_confidence"); v != "" {
+		confidence, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			jsonError(w, "min_confidence must be a number", http.StatusBadRequest)
+			return
+		}
+		q.MinConfidence = confidence
+	}
+
+	if v := query.Get("from"); v != "" {
+		from, _, err := parseTimeParam(v, h.attendanceService.Location())
+		if err != nil {
+			jsonError(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		q.From = from
+	}
+	if v := query.Get("to"); v != "" {
+		to, dateOnly, err := parseTimeParam(v, h.attendanceService.Location())
+		if err != nil {
+			jsonError(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		q.To = to
+	}
+
+	page, err := h.attendanceService.GetRecentAttendance(q)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		jsonError(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to get attendance records", "error", err)
+		jsonError(w, "Failed to get attendance records", http.StatusInternalServerError)
+		return
+	}
+	auditExport(h.audit, r, domain.AuditExportRecords, len(page.Records))
+
+	response := map[string]interface{}{
+		"success": true,
+		"count":   len(page.Records),
+		"total":   page.Total,
+		"records": page.Records,
+	}
+	if page.NextCursor != "" {
+		response["next_cursor"] = page.NextCursor
+	}
+
+	jsonResponse(w, response, http.StatusOK)
+}
+
+// GetAttendanceByExternalID handles GET /api/v1/attendance/by-external/{id}
+func (h *Handler) GetAttendanceByExternalID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	records, err := h.attendanceService.GetRecentAttendance(limit)
+	records, err := h.attendanceService.GetAttendanceByExternalID(r.PathValue("id"))
 	if err != nil {
-		h.jsonError(w, "Failed to get attendance records", http.StatusInternalServerError)
+		logging.From(r.Context()).Error("Failed to get attendance by external id", "error", err)
+		jsonError(w, "Failed to get attendance", http.StatusInternalServerError)
 		return
 	}
+	if len(records) == 0 {
+		jsonError(w, "No attendance with this external ID", http.StatusNotFound)
+		return
+	}
+	auditExport(h.audit, r, domain.AuditExportRecords, len(records))
 
-	h.jsonResponse(w, map[string]interface{}{
+	jsonResponse(w, map[string]interface{}{
 		"success": true,
 		"count":   len(records),
 		"records": records,
@@ -259,27 +903,133 @@ func (h *Handler) GetAttendanceStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stats, err := h.attendanceService.GetAttendanceStats()
+	stats, err := h.attendanceService.GetAttendanceStats(groupFilter(r), sourceFilter(r))
 	if err != nil {
-		h.jsonError(w, "Failed to get statistics", http.StatusInternalServerError)
+		jsonError(w, "Failed to get statistics", http.StatusInternalServerError)
 		return
 	}
 
-	h.jsonResponse(w, map[string]interface{}{
+	jsonResponse(w, map[string]interface{}{
 		"success": true,
 		"stats":   stats,
 	}, http.StatusOK)
 }
 
-func (h *Handler) jsonResponse(w http.ResponseWriter, data interface{}, statusCode int) {
+// GetTagCounts handles GET /api/v1/attendance/tags?from=&to=, how many
+// records each tag rule has tagged
+func (h *Handler) GetTagCounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, err := parseRange(r, 30*24*time.Hour, h.attendanceService.Location())
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tags, err := h.attendanceService.TagCounts(from, to)
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to count tags", "error", err)
+		jsonError(w, "Failed to count tags", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"from":    from,
+		"to":      to,
+		"tags":    tags,
+		"rules":   h.attendanceService.TagRules(),
+	}, http.StatusOK)
+}
+
+func (h *Handler) GetWorkedHours(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		jsonError(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = time.Now().In(h.attendanceService.Location()).Format("2006-01-02")
+	} else if _, err := time.Parse("2006-01-02", date); err != nil {
+		jsonError(w, "Date must be in YYYY-MM-DD format", http.StatusBadRequest)
+		return
+	}
+
+	hours, err := h.attendanceService.GetWorkedHours(name, date)
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to get worked hours", "error", err)
+		jsonError(w, "Failed to get worked hours", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"hours":   hours,
+	}, http.StatusOK)
+}
+
+// isDryRun reports whether the request asked to only preview its changes
+func isDryRun(r *http.Request) bool {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	return dryRun
+}
+
+// clientCertName is the common name of the verified client certificate of a
+// TLS connection, or empty without one
+func clientCertName(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return ""
+	}
+	return state.VerifiedChains[0][0].Subject.CommonName
+}
+
+func jsonResponse(w http.ResponseWriter, data interface{}, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(data)
 }
 
-func (h *Handler) jsonError(w http.ResponseWriter, message string, statusCode int) {
-	h.jsonResponse(w, map[string]interface{}{
+// signedJSONResponse is jsonResponse with an X-Signature header carrying the
+// HMAC-SHA256 of the body, exactly as sent, under secret
+func signedJSONResponse(w http.ResponseWriter, data interface{}, secret string, statusCode int) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		jsonError(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	body = append(body, '\n')
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+func jsonError(w http.ResponseWriter, message string, statusCode int) {
+	jsonResponse(w, map[string]interface{}{
 		"success": false,
 		"error":   message,
 	}, statusCode)
 }
+
+// imageErrorStatus answers an image of a type that is not accepted with 415
+// and one too large with 400
+func imageErrorStatus(err error) int {
+	if errors.Is(err, service.ErrImageType) {
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusBadRequest
+}
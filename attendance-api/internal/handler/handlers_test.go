@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"attendance-api/internal/client"
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+)
+
+func TestDeleteFaceDryRun(t *testing.T) {
+	ctx := context.Background()
+	photo := []byte("alice-photo")
+
+	faces := client.NewFakeRecognizer()
+	if _, err := faces.AddFace(ctx, "alice", [][]byte{photo}, []string{"alice.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+	attendance, audit := newTestServices(t, faces)
+	cfg := &config.Config{
+		Upload:  config.UploadConfig{MaxUploadSize: 5 << 20, MaxMemory: 10 << 20},
+		FaceAPI: config.FaceAPIConfig{Timeout: 5 * time.Second},
+	}
+	h := NewHandler(faces, attendance, nil, nil, nil, audit, nil, cfg)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/attendance", h.RecordAttendance)
+	mux.HandleFunc("DELETE /api/v1/faces/{name}", h.DeleteFace)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("image", "door.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(photo)
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/attendance", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("recording attendance: status %d: %s", rec.Code, rec.Body)
+	}
+
+	// Run twice: the second run only sees the same counts when the first
+	// one left everything in place
+	for run := 1; run <= 2; run++ {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/faces/alice?history=delete&dry_run=true", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("run %d: status %d: %s", run, rec.Code, rec.Body)
+		}
+
+		var response struct {
+			DryRun  bool               `json:"dry_run"`
+			Removal domain.FaceRemoval `json:"removal"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if !response.DryRun {
+			t.Errorf("run %d: dry_run not reported", run)
+		}
+		if response.Removal.ImagesRemoved != 1 || len(response.Removal.Images) != 1 {
+			t.Errorf("run %d: %d image(s) %v would be removed, want 1", run, response.Removal.ImagesRemoved, response.Removal.Images)
+		}
+		if response.Removal.RecordsAffected != 1 {
+			t.Errorf("run %d: %d record(s) would be deleted, want 1", run, response.Removal.RecordsAffected)
+		}
+	}
+
+	images, err := faces.ListFaceImages(ctx, "alice")
+	if err != nil || len(images) != 1 {
+		t.Errorf("face service images after dry run: %v, %v", images, err)
+	}
+	page, err := attendance.GetRecentAttendance(domain.AttendanceQuery{Name: "alice", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 {
+		t.Errorf("%d record(s) of alice after dry run, want 1", page.Total)
+	}
+}
+
+// verifySignature checks a response the way a door controller does: the
+// HMAC over the body exactly as received, compared in constant time
+func verifySignature(secret string, body []byte, header string) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal([]byte(header), []byte("sha256="+hex.EncodeToString(mac.Sum(nil))))
+}
+
+func TestSignedJSONResponse(t *testing.T) {
+	const secret = "shared-secret"
+	rec := httptest.NewRecorder()
+	signedJSONResponse(rec, map[string]interface{}{"authorized": true, "action": "open_door"}, secret, http.StatusOK)
+
+	body := rec.Body.Bytes()
+	signature := rec.Header().Get("X-Signature")
+	if !verifySignature(secret, body, signature) {
+		t.Fatalf("signature %q does not match the body %q", signature, body)
+	}
+	// The same JSON without the trailing newline is not what was signed
+	if verifySignature(secret, bytes.TrimSuffix(body, []byte("\n")), signature) {
+		t.Error("signature matches a body other than the one written")
+	}
+	if verifySignature(secret, bytes.Replace(body, []byte("true"), []byte("false"), 1), signature) {
+		t.Error("signature matches a tampered body")
+	}
+	if verifySignature("other-secret", body, signature) {
+		t.Error("signature matches under another secret")
+	}
+}
+
+func TestSignedAttendance(t *testing.T) {
+	const secret = "shared-secret"
+	ctx := context.Background()
+	photo := []byte("alice-photo")
+
+	faces := client.NewFakeRecognizer()
+	if _, err := faces.AddFace(ctx, "alice", [][]byte{photo}, []string{"alice.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+	attendance, audit := newTestServices(t, faces)
+	cfg := &config.Config{
+		Upload:     config.UploadConfig{MaxUploadSize: 5 << 20, MaxMemory: 10 << 20},
+		FaceAPI:    config.FaceAPIConfig{Timeout: 5 * time.Second},
+		Attendance: config.AttendanceConfig{SigningSecret: secret},
+	}
+	h := NewHandler(faces, attendance, nil, nil, nil, audit, nil, cfg)
+
+	record := func(nonce string) (*httptest.ResponseRecorder, domain.AttendanceResponse) {
+		t.Helper()
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, err := form.CreateFormFile("image", "door.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(photo)
+		if nonce != "" {
+			form.WriteField("nonce", nonce)
+		}
+		form.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/attendance", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rec := httptest.NewRecorder()
+		h.RecordAttendance(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var decision domain.AttendanceResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &decision); err != nil {
+			t.Fatal(err)
+		}
+		return rec, decision
+	}
+
+	rec, decision := record("c0ffee")
+	if !verifySignature(secret, rec.Body.Bytes(), rec.Header().Get("X-Signature")) {
+		t.Fatal("signature does not match the body")
+	}
+	if decision.Nonce != "c0ffee" {
+		t.Errorf("nonce = %q, want the device's c0ffee", decision.Nonce)
+	}
+	if age := time.Since(time.Unix(decision.Timestamp, 0)); age < -time.Second || age > time.Minute {
+		t.Errorf("timestamp %d is %s old", decision.Timestamp, age)
+	}
+
+	tampered := bytes.Replace(rec.Body.Bytes(), []byte(`"name":"alice"`), []byte(`"name":"mallory"`), 1)
+	if bytes.Equal(tampered, rec.Body.Bytes()) {
+		t.Fatalf("no name to tamper with in %s", rec.Body)
+	}
+	if verifySignature(secret, tampered, rec.Header().Get("X-Signature")) {
+		t.Error("signature matches a tampered body")
+	}
+
+	// A recorded response replayed to a later request carries the nonce of
+	// the earlier one, which the controller no longer expects
+	if _, next := record("d00d"); next.Nonce == decision.Nonce {
+		t.Errorf("second request answered with the first one's nonce %q", next.Nonce)
+	}
+	// Without a nonce from the device every response gets a fresh one
+	_, first := record("")
+	_, second := record("")
+	if first.Nonce == "" || first.Nonce == second.Nonce {
+		t.Errorf("random nonces %q and %q, want two different ones", first.Nonce, second.Nonce)
+	}
+}
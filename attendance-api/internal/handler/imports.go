@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+// ImportAttendance handles POST /api/v1/attendance/import. The file is parsed
+// and its header checked synchronously; the rows are loaded by a background
+// job whose ID is returned.
+func (h *Handler) ImportAttendance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseMultipartForm(h.config.Upload.MaxMemory); err != nil {
+		jsonError(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		jsonError(w, "File is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	var mapping domain.ImportMapping
+	if err := json.Unmarshal([]byte(r.FormValue("mapping")), &mapping); err != nil {
+		jsonError(w, "Mapping must be a JSON object of field to column name", http.StatusBadRequest)
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		jsonError(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := service.ParseImportFile(fileHeader.Filename, data, r.FormValue("sheet"))
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(rows) == 0 {
+		jsonError(w, "File is empty", http.StatusBadRequest)
+		return
+	}
+
+	if err := service.ValidateImportHeader(rows[0], mapping); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	timestampFormat := r.FormValue("timestamp_format")
+
+	// The job outlives the request, so the importer is attributed explicitly
+	actor := domain.ActorFromContext(r.Context())
+
+	job, err := h.jobs.Submit("attendance_import", jobOwner(actor), func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+		return h.attendanceService.ImportRecords(domain.WithActor(ctx, actor), rows, mapping, timestampFormat, progress)
+	})
+	if errors.Is(err, service.ErrJobQueueFull) {
+		jsonError(w, "Too many jobs queued, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to queue import", "error", err)
+		jsonError(w, "Failed to queue import", http.StatusInternalServerError)
+		return
+	}
+	auditChange(h.audit, r, domain.AuditAttendanceManual,
+		fmt.Sprintf("import of %s: %d row(s), job %s", fileHeader.Filename, len(rows)-1, job.ID))
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"job":     job,
+		"rows":    len(rows) - 1,
+	}, http.StatusAccepted)
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+type IntegrityHandler struct {
+	checker *service.IntegrityChecker
+}
+
+func NewIntegrityHandler(checker *service.IntegrityChecker) *IntegrityHandler {
+	return &IntegrityHandler{checker: checker}
+}
+
+// Check handles /api/v1/admin/integrity: GET only reports problems, POST also
+// repairs the ones that are safe to repair
+func (h *IntegrityHandler) Check(w http.ResponseWriter, r *http.Request) {
+	var repair bool
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		repair = true
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report, err := h.checker.Run(r.Context(), repair)
+	if err != nil {
+		logging.From(r.Context()).Error("Integrity check failed", "error", err)
+		jsonError(w, "Integrity check failed", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"report":  report,
+	}, http.StatusOK)
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+type JobHandler struct {
+	jobs    *service.JobManager
+	permits func(ctx context.Context, scope string) bool
+	secret  string
+}
+
+// NewJobHandler serves the jobs of every pool, which share a table. permits
+// tells whether a request may use a scope; with a signing secret, recognition
+// jobs are served signed like synchronous decisions.
+func NewJobHandler(jobs *service.JobManager, permits func(ctx context.Context, scope string) bool, secret string) *JobHandler {
+	return &JobHandler{jobs: jobs, permits: permits, secret: secret}
+}
+
+// jobOwner identifies the actor submitting a job, wherever the request came
+// from
+func jobOwner(actor domain.Actor) string {
+	actor.Location = ""
+	return actor.String()
+}
+
+// ListJobs handles GET /api/v1/jobs
+func (h *JobHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 50
+	if parsed, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && parsed > 0 && parsed <= 500 {
+		limit = parsed
+	}
+
+	// Recognition results name who came through the door
+	var hidden []string
+	if !h.permits(r.Context(), domain.ScopeRecordsRead) {
+		hidden = append(hidden, domain.JobRecognition)
+	}
+
+	jobs, err := h.jobs.List(limit, hidden...)
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to list jobs", "error", err)
+		jsonError(w, "Failed to list jobs", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"count":   len(jobs),
+		"jobs":    jobs,
+	}, http.StatusOK)
+}
+
+// GetJob handles GET /api/v1/jobs/{id}. Devices may read the jobs of their
+// own asynchronous attendance requests, other recognition jobs need
+// records:read and the remaining jobs reports:read.
+func (h *JobHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, err := h.jobs.Get(r.PathValue("id"))
+	if err == nil && !h.mayRead(r.Context(), job) {
+		err = service.ErrJobNotFound
+	}
+	if errors.Is(err, service.ErrJobNotFound) {
+		jsonError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to get job", "error", err)
+		jsonError(w, "Failed to get job", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"job":     job,
+	}
+	if job.Type == domain.JobRecognition && h.secret != "" {
+		signedJSONResponse(w, response, h.secret, http.StatusOK)
+		return
+	}
+	jsonResponse(w, response, http.StatusOK)
+}
+
+// mayRead tells whether a request may see a job. Recognition jobs carry the
+// decision about a person, like attendance records.
+func (h *JobHandler) mayRead(ctx context.Context, job *domain.Job) bool {
+	if job.Type != domain.JobRecognition {
+		return h.permits(ctx, domain.ScopeReportsRead)
+	}
+	return h.permits(ctx, domain.ScopeRecordsRead) || job.Owner == jobOwner(domain.ActorFromContext(ctx))
+}
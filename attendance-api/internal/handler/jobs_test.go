@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"attendance-api/internal/client"
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/service"
+)
+
+func TestAsyncRecognitionJob(t *testing.T) {
+	const secret = "shared-secret"
+	ctx := context.Background()
+	photo := []byte("alice-photo")
+
+	faces := client.NewFakeRecognizer()
+	if _, err := faces.AddFace(ctx, "alice", [][]byte{photo}, []string{"alice.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+	attendance, audit := newTestServices(t, faces)
+
+	db, err := service.OpenDatabase(filepath.Join(t.TempDir(), "jobs.db"), time.Local, config.DatabaseConfig{WritePoolSize: 1, BusyTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	recognitions, err := service.NewJobManager(db, config.JobsConfig{Workers: 1, QueueSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(recognitions.Close)
+
+	cfg := &config.Config{
+		Upload:     config.UploadConfig{MaxUploadSize: 5 << 20, MaxMemory: 10 << 20},
+		FaceAPI:    config.FaceAPIConfig{Timeout: 5 * time.Second},
+		Attendance: config.AttendanceConfig{SigningSecret: secret},
+	}
+	h := NewHandler(faces, attendance, nil, nil, recognitions, audit, nil, cfg)
+	// Devices hold attendance:write only
+	jobs := NewJobHandler(recognitions, func(ctx context.Context, scope string) bool { return false }, secret)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/attendance", h.RecordAttendance)
+	mux.HandleFunc("GET /api/v1/jobs/{id}", jobs.GetJob)
+
+	asDevice := func(req *http.Request, device string) *http.Request {
+		actor := domain.Actor{Type: domain.ActorDevice, ID: device, Device: device}
+		return req.WithContext(domain.WithActor(req.Context(), actor))
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("image", "door.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(photo)
+	form.WriteField("nonce", "c0ffee")
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/attendance?async=true", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, asDevice(req, "door-1"))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("submitting: status %d: %s", rec.Code, rec.Body)
+	}
+	var submitted struct {
+		Job domain.Job `json:"job"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &submitted); err != nil {
+		t.Fatal(err)
+	}
+	path := "/api/v1/jobs/" + submitted.Job.ID
+
+	var job domain.Job
+	for deadline := time.Now().Add(5 * time.Second); job.Status != domain.JobCompleted; {
+		if time.Now().After(deadline) {
+			t.Fatalf("job still %s", job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, asDevice(httptest.NewRequest(http.MethodGet, path, nil), "door-1"))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("polling: status %d: %s", rec.Code, rec.Body)
+		}
+		var polled struct {
+			Job domain.Job `json:"job"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &polled); err != nil {
+			t.Fatal(err)
+		}
+		job = polled.Job
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(rec.Body.Bytes())
+	if got, want := rec.Header().Get("X-Signature"), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("X-Signature = %q, want %q", got, want)
+	}
+	var decision domain.AttendanceResponse
+	if err := json.Unmarshal(job.Result, &decision); err != nil {
+		t.Fatal(err)
+	}
+	if decision.Name != "alice" || decision.Nonce != "c0ffee" || decision.Timestamp == 0 {
+		t.Errorf("decision = %+v, want alice with the device's nonce and a timestamp", decision)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, asDevice(httptest.NewRequest(http.MethodGet, path, nil), "door-2"))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("another device reading the job: status %d, want 404", rec.Code)
+	}
+}
+
+// Recognition jobs name who was recognized, so reports:read alone neither
+// lists nor reads them
+func TestRecognitionJobScopes(t *testing.T) {
+	db, err := service.OpenDatabase(filepath.Join(t.TempDir(), "jobs.db"), time.Local, config.DatabaseConfig{WritePoolSize: 1, BusyTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	manager, err := service.NewJobManager(db, config.JobsConfig{Workers: 1, QueueSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(manager.Close)
+
+	noop := func(ctx context.Context, progress func(done, total int)) (interface{}, error) { return nil, nil }
+	recognition, err := manager.Submit(domain.JobRecognition, "device:door-1", noop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Submit("attendance_import", "key:admin", noop); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(path string, scopes ...string) *httptest.ResponseRecorder {
+		t.Helper()
+		jobs := NewJobHandler(manager, func(ctx context.Context, scope string) bool { return slices.Contains(scopes, scope) }, "")
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /api/v1/jobs", jobs.ListJobs)
+		mux.HandleFunc("GET /api/v1/jobs/{id}", jobs.GetJob)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	listed := func(scopes ...string) []string {
+		t.Helper()
+		var list struct {
+			Jobs []domain.Job `json:"jobs"`
+		}
+		if err := json.Unmarshal(serve("/api/v1/jobs", scopes...).Body.Bytes(), &list); err != nil {
+			t.Fatal(err)
+		}
+		var types []string
+		for _, job := range list.Jobs {
+			types = append(types, job.Type)
+		}
+		slices.Sort(types)
+		return types
+	}
+
+	if got := listed(domain.ScopeReportsRead); !slices.Equal(got, []string{"attendance_import"}) {
+		t.Errorf("listed with reports:read: %v, want the import only", got)
+	}
+	if got := listed(domain.ScopeReportsRead, domain.ScopeRecordsRead); !slices.Equal(got, []string{"attendance_import", domain.JobRecognition}) {
+		t.Errorf("listed with records:read: %v, want both jobs", got)
+	}
+
+	path := "/api/v1/jobs/" + recognition.ID
+	if code := serve(path, domain.ScopeReportsRead).Code; code != http.StatusNotFound {
+		t.Errorf("reading a recognition job with reports:read: status %d, want 404", code)
+	}
+	if code := serve(path, domain.ScopeRecordsRead).Code; code != http.StatusOK {
+		t.Errorf("reading a recognition job with records:read: status %d, want 200", code)
+	}
+}
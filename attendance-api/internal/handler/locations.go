@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+)
+
+// LocationAssignments handles GET /api/v1/assignments
+func (h *Handler) LocationAssignments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	assignments, err := h.attendanceService.ListLocationAssignments()
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to list location assignments", "error", err)
+		jsonError(w, "Failed to list location assignments", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":     true,
+		"count":       len(assignments),
+		"assignments": assignments,
+	}, http.StatusOK)
+}
+
+// LocationAssignment handles /api/v1/assignments/{name}: GET returns the
+// person's locations, PUT replaces them and DELETE removes them
+func (h *Handler) LocationAssignment(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	var locations []string
+
+	switch r.Method {
+	case http.MethodGet:
+		assignment, err := h.attendanceService.GetLocationAssignment(name)
+		if err != nil {
+			logging.From(r.Context()).Error("Failed to get location assignment", "error", err)
+			jsonError(w, "Failed to get location assignment", http.StatusInternalServerError)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success":    true,
+			"assignment": assignment,
+		}, http.StatusOK)
+		return
+
+	case http.MethodPut:
+		var req struct {
+			Locations []string `json:"locations"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		locations = req.Locations
+
+	case http.MethodDelete:
+		// An empty assignment allows the person everywhere
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	assignment, err := h.attendanceService.SetLocationAssignment(name, locations)
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to set location assignment", "error", err)
+		jsonError(w, "Failed to set location assignment", http.StatusInternalServerError)
+		return
+	}
+	summary := fmt.Sprintf("cleared expected locations of %s", name)
+	if len(locations) > 0 {
+		summary = fmt.Sprintf("set expected locations of %s: %s", name, strings.Join(locations, ", "))
+	}
+	auditChange(h.audit, r, domain.AuditConfigChange, summary)
+
+	jsonResponse(w, map[string]interface{}{
+		"success":    true,
+		"assignment": assignment,
+	}, http.StatusOK)
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"attendance-api/internal/domain"
+)
+
+// RecognitionMetrics handles GET /api/v1/admin/metrics: face service
+// latency, match confidence and why recognitions failed or were rejected
+func (h *Handler) RecognitionMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":     true,
+		"recognition": h.attendanceService.RecognitionMetrics(),
+	}, http.StatusOK)
+}
+
+// Metrics handles GET /metrics, the recognition metrics in the Prometheus
+// text format
+func (h *Handler) Metrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	m := h.attendanceService.RecognitionMetrics()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	writeHistogram(out, "attendance_face_api_latency_seconds",
+		"Time to get an answer from the face service, including waiting for a slot", m.FaceAPILatency, 1000)
+	writeMetric(out, "attendance_face_api_calls_total", "counter", "Submissions sent to the face service", "", m.Calls)
+	writeMetric(out, "attendance_face_api_failures_total", "counter", "Calls to the face service that failed, by cause", `cause="timeout"`, m.Timeouts)
+	writeSample(out, "attendance_face_api_failures_total", `cause="busy"`, m.Busy)
+	writeSample(out, "attendance_face_api_failures_total", `cause="error"`, m.Errors)
+	writeMetric(out, "attendance_no_face_detected_total", "counter", "Submissions in which the face service found no face", "", m.NoFace)
+	writeMetric(out, "attendance_faces_total", "counter", "Faces found by the face service, by outcome", `outcome="matched"`, m.Matched)
+	writeSample(out, "attendance_faces_total", `outcome="low_confidence"`, m.LowConfidence)
+	writeSample(out, "attendance_faces_total", `outcome="unknown"`, m.Unknown)
+	writeHistogram(out, "attendance_match_confidence",
+		"Confidence of the faces matched to a person, before ATTENDANCE_MIN_CONFIDENCE", m.Confidence, 1)
+	fmt.Fprintf(out, "# HELP attendance_min_confidence Matches below this confidence count as unknown faces\n")
+	fmt.Fprintf(out, "# TYPE attendance_min_confidence gauge\n")
+	fmt.Fprintf(out, "attendance_min_confidence %s\n", formatFloat(m.MinConfidence))
+}
+
+func writeMetric(out *bufio.Writer, name, kind, help, labels string, value int64) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	writeSample(out, name, labels, value)
+}
+
+func writeSample(out *bufio.Writer, name, labels string, value int64) {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	fmt.Fprintf(out, "%s %d\n", name, value)
+}
+
+// writeHistogram writes a histogram with cumulative buckets, its bounds and
+// sum divided by scale (e.g. milliseconds to seconds)
+func writeHistogram(out *bufio.Writer, name, help string, h domain.Histogram, scale float64) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	var cumulative int64
+	for i, bound := range h.Bounds {
+		cumulative += h.Counts[i]
+		fmt.Fprintf(out, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(bound/scale), cumulative)
+	}
+	fmt.Fprintf(out, "%s_bucket{le=\"+Inf\"} %d\n", name, h.Count)
+	fmt.Fprintf(out, "%s_sum %s\n", name, formatFloat(h.Sum/scale))
+	fmt.Fprintf(out, "%s_count %d\n", name, h.Count)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,470 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"attendance-api/internal/client"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+type personRequest struct {
+	domain.PersonUpdate
+	Name string `json:"name"`
+}
+
+// People handles /api/v1/people: GET lists (?department=&group=), POST creates
+func (h *Handler) People(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		people, err := h.attendanceService.ListPeople(groupFilter(r))
+		if err != nil {
+			logging.From(r.Context()).Error("Failed to list people", "error", err)
+			jsonError(w, "Failed to list people", http.StatusInternalServerError)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"count":   len(people),
+			"people":  people,
+		}, http.StatusOK)
+
+	case http.MethodPost:
+		var req personRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		person := domain.Person{Name: req.Name, Active: true}
+		if req.FullName != nil {
+			person.FullName = *req.FullName
+		}
+		if req.EmployeeNumber != nil {
+			person.EmployeeNumber = *req.EmployeeNumber
+		}
+		if req.ExternalID != nil {
+			person.ExternalID = *req.ExternalID
+		}
+		if req.CardNumber != nil {
+			person.CardNumber = *req.CardNumber
+		}
+		if req.Email != nil {
+			person.Email = *req.Email
+		}
+		if req.Active != nil {
+			person.Active = *req.Active
+		}
+		if req.Department != nil {
+			person.Department = *req.Department
+		}
+		if req.Group != nil {
+			person.Group = *req.Group
+		}
+
+		created, err := h.attendanceService.CreatePerson(person)
+		if err != nil {
+			h.personError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"person":  created,
+		}, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Person handles /api/v1/people/{id}: GET, PATCH and DELETE
+func (h *Handler) Person(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		person, err := h.attendanceService.GetPerson(id)
+		if err != nil {
+			h.personError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"person":  person,
+		}, http.StatusOK)
+
+	case http.MethodPatch:
+		var req personRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if req.Name != "" {
+			jsonError(w, "The name cannot be changed, it must match the face service", http.StatusBadRequest)
+			return
+		}
+
+		person, err := h.attendanceService.UpdatePerson(id, req.PersonUpdate)
+		if err != nil {
+			h.personError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"person":  person,
+		}, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := h.attendanceService.DeletePerson(id); err != nil {
+			h.personError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"message": "Person deleted",
+		}, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// PersonByReference handles GET /api/v1/people/by-external/{id}, looking a
+// person up by employee number, external ID or card number
+func (h *Handler) PersonByReference(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	person, err := h.attendanceService.GetPersonByReference(r.PathValue("id"))
+	if err != nil {
+		h.personError(w, r, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"person":  person,
+	}, http.StatusOK)
+}
+
+// MergePeople handles POST /api/v1/people/merge, consolidating the identity
+// named source into target
+func (h *Handler) MergePeople(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Source string `json:"source"`
+		Target string `json:"target"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	merge, err := h.attendanceService.MergePeople(r.Context(), req.Source, req.Target)
+	if errors.Is(err, client.ErrUnsupported) {
+		jsonError(w, "The face backend does not support merging faces", http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		h.personError(w, r, err)
+		return
+	}
+
+	// Trigger reload on face recognition API to sync all workers
+	if err := h.faceClient.ReloadFaces(r.Context()); err != nil {
+		logging.From(r.Context()).Warn("Failed to reload faces", "error", err)
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"merge":   merge,
+	}, http.StatusOK)
+}
+
+// MergePerson handles POST /api/v1/people/{id}/merge, merging the person into
+// the one whose ID is given as into
+func (h *Handler) MergePerson(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Into string `json:"into"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	merge, err := h.attendanceService.MergePerson(r.Context(), r.PathValue("id"), req.Into)
+	if err != nil {
+		h.identityError(w, r, err)
+		return
+	}
+
+	// Trigger reload on face recognition API to sync all workers
+	if err := h.faceClient.ReloadFaces(r.Context()); err != nil {
+		logging.From(r.Context()).Warn("Failed to reload faces", "error", err)
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"merge":   merge,
+	}, http.StatusOK)
+}
+
+// SplitPerson handles POST /api/v1/people/{id}/split, moving the chosen face
+// images and attendance records of the person to a new identity
+func (h *Handler) SplitPerson(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Name    string   `json:"name"`
+		Images  []string `json:"images"`
+		Records []string `json:"records"`
+		From    string   `json:"from"`
+		To      string   `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	split := domain.PersonSplit{Name: req.Name, Images: req.Images, Records: req.Records}
+	if req.From != "" {
+		from, _, err := parseTimeParam(req.From, h.attendanceService.Location())
+		if err != nil {
+			jsonError(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		split.From = from
+	}
+	if req.To != "" {
+		to, dateOnly, err := parseTimeParam(req.To, h.attendanceService.Location())
+		if err != nil {
+			jsonError(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		split.To = to
+	}
+
+	change, person, err := h.attendanceService.SplitPerson(r.Context(), r.PathValue("id"), split)
+	if err != nil {
+		h.identityError(w, r, err)
+		return
+	}
+
+	// Trigger reload on face recognition API to sync all workers
+	if err := h.faceClient.ReloadFaces(r.Context()); err != nil {
+		logging.From(r.Context()).Warn("Failed to reload faces", "error", err)
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"change":  change,
+		"person":  person,
+	}, http.StatusCreated)
+}
+
+// IdentityChanges handles GET /api/v1/people/changes, the audit log of merges
+// and splits
+func (h *Handler) IdentityChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 50
+	if parsed, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && parsed > 0 && parsed <= 500 {
+		limit = parsed
+	}
+
+	changes, err := h.attendanceService.ListIdentityChanges(limit)
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to list identity changes", "error", err)
+		jsonError(w, "Failed to list identity changes", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"count":   len(changes),
+		"changes": changes,
+	}, http.StatusOK)
+}
+
+// RevertIdentityChange handles POST /api/v1/people/changes/{id}/revert
+func (h *Handler) RevertIdentityChange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	change, err := h.attendanceService.RevertIdentityChange(r.Context(), r.PathValue("id"))
+	switch {
+	case errors.Is(err, service.ErrChangeNotFound):
+		jsonError(w, "Identity change not found", http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrChangeReverted):
+		jsonError(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		h.identityError(w, r, err)
+		return
+	}
+
+	// Trigger reload on face recognition API to sync all workers
+	if err := h.faceClient.ReloadFaces(r.Context()); err != nil {
+		logging.From(r.Context()).Warn("Failed to reload faces", "error", err)
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"change":  change,
+	}, http.StatusOK)
+}
+
+// identityError reports a failed merge, split or revert
+func (h *Handler) identityError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, client.ErrUnsupported) {
+		jsonError(w, "The face backend does not support moving face images", http.StatusNotImplemented)
+		return
+	}
+	h.personError(w, r, err)
+}
+
+func (h *Handler) personError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrPersonNotFound):
+		jsonError(w, "Person not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrPersonExists), errors.Is(err, service.ErrAmbiguousRef):
+		jsonError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidPerson):
+		jsonError(w, err.Error(), http.StatusBadRequest)
+	default:
+		logging.From(r.Context()).Error("Person operation failed", "error", err)
+		jsonError(w, "Person operation failed", http.StatusInternalServerError)
+	}
+}
+
+// Membership handles /api/v1/people/{name}/membership by recognized name: PUT
+// places the person in a department and group, DELETE removes them from both
+func (h *Handler) Membership(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	var req struct {
+		Department string `json:"department"`
+		Group      string `json:"group"`
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	person, err := h.attendanceService.SetMembership(name, req.Department, req.Group)
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to set membership", "error", err)
+		jsonError(w, "Failed to set membership", http.StatusInternalServerError)
+		return
+	}
+
+	if person == nil {
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"message": "Membership removed",
+		}, http.StatusOK)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"person":  person,
+	}, http.StatusOK)
+}
+
+// Profile handles GET /api/v1/people/by-name/{name}: everything the
+// dashboard's profile page shows about a recognized name in one response
+func (h *Handler) Profile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	profile, err := h.attendanceService.PersonProfile(r.Context(), r.PathValue("name"))
+	if err != nil {
+		h.personError(w, r, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"profile": profile,
+	}, http.StatusOK)
+}
+
+// Groups handles GET /api/v1/groups
+func (h *Handler) Groups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	groups, err := h.attendanceService.ListGroups()
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to list groups", "error", err)
+		jsonError(w, "Failed to list groups", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"count":   len(groups),
+		"groups":  groups,
+	}, http.StatusOK)
+}
+
+// groupFilter reads the department and group query parameters
+func groupFilter(r *http.Request) domain.GroupFilter {
+	return domain.GroupFilter{
+		Department: r.URL.Query().Get("department"),
+		Group:      r.URL.Query().Get("group"),
+	}
+}
+
+// sourceFilter reads the device_id and location query parameters
+func sourceFilter(r *http.Request) domain.SourceFilter {
+	return domain.SourceFilter{
+		DeviceID: r.URL.Query().Get("device_id"),
+		Location: r.URL.Query().Get("location"),
+	}
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+type ReplicationHandler struct {
+	replication *service.ReplicationService
+}
+
+func NewReplicationHandler(replication *service.ReplicationService) *ReplicationHandler {
+	return &ReplicationHandler{replication: replication}
+}
+
+// Stream handles GET /api/v1/replication/stream?log=&seq=&table=&key=, the
+// newline-delimited JSON change stream a standby follows
+func (h *ReplicationHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.replication.IsStandby() {
+		jsonError(w, "A standby does not serve the replication stream", http.StatusConflict)
+		return
+	}
+
+	query := r.URL.Query()
+	cursor := domain.ReplicationCursor{Log: query.Get("log"), Table: query.Get("table"), Key: query.Get("key")}
+	if v := query.Get("seq"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || parsed < 0 {
+			jsonError(w, "seq must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		cursor.Seq = parsed
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		jsonError(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	err := h.replication.Stream(r.Context(), r.RemoteAddr, cursor, func(msg domain.ReplicationMessage) error {
+		if err := encoder.Encode(msg); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil && r.Context().Err() == nil {
+		logging.From(r.Context()).Error("Replication stream failed", "remote", r.RemoteAddr, "error", err)
+	}
+}
+
+// Status handles GET /api/v1/admin/replication
+func (h *ReplicationHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status, err := h.replication.Status()
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to get replication status", "error", err)
+		jsonError(w, "Failed to get replication status", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":     true,
+		"replication": status,
+	}, http.StatusOK)
+}
+
+// Promote handles POST /api/v1/admin/replication/promote, turning a standby
+// into the active node
+func (h *ReplicationHandler) Promote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := h.replication.Promote(); err != nil {
+		if errors.Is(err, service.ErrNotStandby) {
+			jsonError(w, "Only a standby can be promoted", http.StatusConflict)
+			return
+		}
+		logging.From(r.Context()).Error("Failed to promote", "error", err)
+		jsonError(w, "Failed to promote", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"message": "Promoted to active",
+	}, http.StatusOK)
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+// GetSecurityReport handles GET /api/v1/reports/security?from=&to=
+func (h *Handler) GetSecurityReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, err := parseRange(r, 7*24*time.Hour, h.attendanceService.Location())
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.attendanceService.GetSecurityReport(from, to)
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to build security report", "error", err)
+		jsonError(w, "Failed to build security report", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"report":  report,
+	}, http.StatusOK)
+}
+
+// GetPDFReport handles GET /api/v1/reports/pdf?from=&to=
+func (h *Handler) GetPDFReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, err := parseRange(r, 7*24*time.Hour, h.attendanceService.Location())
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.attendanceService.GetPeriodReport(from, to)
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to build attendance report", "error", err)
+		jsonError(w, "Failed to build attendance report", http.StatusInternalServerError)
+		return
+	}
+
+	// Built in memory first so a failure can still be reported as JSON
+	var buf bytes.Buffer
+	if err := service.WritePeriodPDF(report, h.attendanceService.Location(), &buf); err != nil {
+		logging.From(r.Context()).Error("Failed to write PDF report", "error", err)
+		jsonError(w, "Failed to write PDF report", http.StatusInternalServerError)
+		return
+	}
+
+	auditExport(h.audit, r, domain.AuditExportReport, len(report.People))
+
+	// to is exclusive, so a whole last day is named by its own date
+	last := to.Add(-time.Nanosecond)
+	filename := fmt.Sprintf("attendance-%s-%s.pdf", from.Format("20060102"), last.Format("20060102"))
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+}
+
+// GetAbsenceReport handles GET /api/v1/reports/absent?date=&department=&group=
+func (h *Handler) GetAbsenceReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	loc := h.attendanceService.Location()
+	day := time.Now().In(loc)
+	if v := r.URL.Query().Get("date"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			jsonError(w, "date must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		day = t
+	}
+
+	report, err := h.attendanceService.GetAbsenceReport(r.Context(), day, groupFilter(r))
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to build absence report", "error", err)
+		jsonError(w, "Failed to build absence report", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"report":  report,
+	}, http.StatusOK)
+}
+
+// parseRange reads the from/to query parameters as RFC 3339 timestamps or
+// YYYY-MM-DD dates (a date as "to" includes that whole day). Missing values
+// default to the period of length def ending now. Dates are days in loc.
+func parseRange(r *http.Request, def time.Duration, loc *time.Location) (time.Time, time.Time, error) {
+	to := time.Now().In(loc)
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, dateOnly, err := parseTimeParam(v, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		to = t
+	}
+
+	from := to.Add(-def)
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, _, err := parseTimeParam(v, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+		}
+		from = t
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+
+	return from, to, nil
+}
+
+// parseTimeParam reads a YYYY-MM-DD date, the midnight starting that day in
+// loc, or an RFC 3339 timestamp, and reports which of the two it was
+func parseTimeParam(v string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", v, loc); err == nil {
+		return t, true, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("expected YYYY-MM-DD or RFC 3339 timestamp")
+	}
+	return t, false, nil
+}
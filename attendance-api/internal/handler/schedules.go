@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+// DoorSchedules handles /api/v1/schedules (list, optionally ?door=, and
+// create)
+func (h *Handler) DoorSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		schedules, err := h.attendanceService.ListDoorSchedules(r.URL.Query().Get("door"))
+		if err != nil {
+			h.scheduleError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success":   true,
+			"count":     len(schedules),
+			"schedules": schedules,
+		}, http.StatusOK)
+
+	case http.MethodPost:
+		var req domain.DoorSchedule
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		schedule, err := h.attendanceService.CreateDoorSchedule(req)
+		if err != nil {
+			h.scheduleError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, "created door schedule "+scheduleSummary(schedule))
+
+		jsonResponse(w, map[string]interface{}{
+			"success":  true,
+			"schedule": schedule,
+		}, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// DoorSchedule handles /api/v1/schedules/{id} (get, replace and delete)
+func (h *Handler) DoorSchedule(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		schedule, err := h.attendanceService.GetDoorSchedule(id)
+		if err != nil {
+			h.scheduleError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success":  true,
+			"schedule": schedule,
+		}, http.StatusOK)
+
+	case http.MethodPut:
+		var req domain.DoorSchedule
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		schedule, err := h.attendanceService.UpdateDoorSchedule(id, req)
+		if err != nil {
+			h.scheduleError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, "updated door schedule "+scheduleSummary(schedule))
+
+		jsonResponse(w, map[string]interface{}{
+			"success":  true,
+			"schedule": schedule,
+		}, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := h.attendanceService.DeleteDoorSchedule(id); err != nil {
+			h.scheduleError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, "deleted door schedule "+id)
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"message": "Door schedule deleted",
+		}, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// scheduleSummary describes a door schedule for the audit log
+func scheduleSummary(schedule *domain.DoorSchedule) string {
+	when := fmt.Sprintf("%s-%s", schedule.Start, schedule.End)
+	if schedule.Holidays {
+		when += " on holidays"
+	}
+	return fmt.Sprintf("%s of door %s: %s %s", schedule.Name, schedule.Door, schedule.Mode, when)
+}
+
+func (h *Handler) scheduleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrScheduleNotFound):
+		jsonError(w, "Door schedule not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidSchedule):
+		jsonError(w, err.Error(), http.StatusBadRequest)
+	default:
+		logging.From(r.Context()).Error("Door schedule operation failed", "error", err)
+		jsonError(w, "Door schedule operation failed", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+// Shifts handles /api/v1/shifts (list, optionally ?name=, and create)
+func (h *Handler) Shifts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		shifts, err := h.attendanceService.ListShifts(r.URL.Query().Get("name"))
+		if err != nil {
+			h.shiftError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"count":   len(shifts),
+			"shifts":  shifts,
+		}, http.StatusOK)
+
+	case http.MethodPost:
+		var req domain.Shift
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		shift, err := h.attendanceService.CreateShift(req)
+		if err != nil {
+			h.shiftError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange,
+			fmt.Sprintf("created shift %s (%s-%s)", shift.Name, shift.Start, shift.End))
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"shift":   shift,
+		}, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Shift handles /api/v1/shifts/{id} (get, replace and delete)
+func (h *Handler) Shift(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		shift, err := h.attendanceService.GetShift(id)
+		if err != nil {
+			h.shiftError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"shift":   shift,
+		}, http.StatusOK)
+
+	case http.MethodPut:
+		var req domain.Shift
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		shift, err := h.attendanceService.UpdateShift(id, req)
+		if err != nil {
+			h.shiftError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange,
+			fmt.Sprintf("updated shift %s (%s-%s)", shift.Name, shift.Start, shift.End))
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"shift":   shift,
+		}, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := h.attendanceService.DeleteShift(id); err != nil {
+			h.shiftError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, "deleted shift "+id)
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"message": "Shift deleted",
+		}, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) shiftError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrShiftNotFound):
+		jsonError(w, "Shift not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidShift):
+		jsonError(w, err.Error(), http.StatusBadRequest)
+	default:
+		logging.From(r.Context()).Error("Shift operation failed", "error", err)
+		jsonError(w, "Shift operation failed", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+type SnapshotHandler struct {
+	snapshots *service.SnapshotService
+	audit     *service.AuditService
+	loc       *time.Location // zone of the site, of from and to dates
+}
+
+func NewSnapshotHandler(snapshots *service.SnapshotService, audit *service.AuditService, loc *time.Location) *SnapshotHandler {
+	return &SnapshotHandler{snapshots: snapshots, audit: audit, loc: loc}
+}
+
+// ListSnapshots handles GET /api/v1/snapshots?name=&limit=
+func (h *SnapshotHandler) ListSnapshots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 50
+	if parsed, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && parsed > 0 && parsed <= 500 {
+		limit = parsed
+	}
+
+	snapshots, err := h.snapshots.List(r.URL.Query().Get("name"), limit)
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to list snapshots", "error", err)
+		jsonError(w, "Failed to list snapshots", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":   true,
+		"count":     len(snapshots),
+		"snapshots": snapshots,
+	}, http.StatusOK)
+}
+
+// Snapshot handles GET /api/v1/snapshots/{id}, the snapshot of a record
+func (h *SnapshotHandler) Snapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	snapshot, err := h.snapshots.Get(r.PathValue("id"))
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":  true,
+		"snapshot": snapshot,
+	}, http.StatusOK)
+}
+
+// Image handles GET /api/v1/snapshots/{id}/image, the submitted image
+func (h *SnapshotHandler) Image(w http.ResponseWriter, r *http.Request) {
+	h.serveSnapshot(w, r, false)
+}
+
+// Crop handles GET /api/v1/snapshots/{id}/crop, the cropped face
+func (h *SnapshotHandler) Crop(w http.ResponseWriter, r *http.Request) {
+	h.serveSnapshot(w, r, true)
+}
+
+func (h *SnapshotHandler) serveSnapshot(w http.ResponseWriter, r *http.Request, crop bool) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := h.snapshots.Snapshot(r.Context(), r.PathValue("id"), crop)
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+	auditExport(h.audit, r, domain.AuditExportSnapshot, 1)
+
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Write(data)
+}
+
+// PrivacyReport handles GET /api/v1/reports/privacy?from=&to=
+func (h *SnapshotHandler) PrivacyReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, err := parseRange(r, 30*24*time.Hour, h.loc)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.snapshots.PrivacyReport(from, to)
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to build privacy report", "error", err)
+		jsonError(w, "Failed to build privacy report", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"report":  report,
+	}, http.StatusOK)
+}
+
+func (h *SnapshotHandler) serviceError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, service.ErrSnapshotNotFound) {
+		jsonError(w, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+	logging.From(r.Context()).Error("Snapshot operation failed", "error", err)
+	jsonError(w, "Snapshot operation failed", http.StatusInternalServerError)
+}
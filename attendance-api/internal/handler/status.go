@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"net/http"
+
+	"attendance-api/internal/service"
+)
+
+type StatusHandler struct {
+	status *service.StatusService
+}
+
+func NewStatusHandler(status *service.StatusService) *StatusHandler {
+	return &StatusHandler{status: status}
+}
+
+// GetStatus handles GET /api/v1/admin/status, the state of the node at a
+// glance: build, uptime, database size, face service and event streams
+func (h *StatusHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"status":  h.status.Status(r.Context()),
+	}, http.StatusOK)
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+type SwitchoverHandler struct {
+	switchover *service.SwitchoverService
+	audit      *service.AuditService
+}
+
+func NewSwitchoverHandler(switchover *service.SwitchoverService, audit *service.AuditService) *SwitchoverHandler {
+	return &SwitchoverHandler{switchover: switchover, audit: audit}
+}
+
+// Status handles GET /api/v1/admin/face-service/switchover?verify=, which
+// face service recognitions go to and which one enrollments are also
+// written to. With verify=true the enrollments of both are compared.
+func (h *SwitchoverHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status, err := h.switchover.Status(r.Context(), r.URL.Query().Get("verify") == "true")
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to get face service switchover", "error", err)
+		jsonError(w, "Failed to compare the face services", http.StatusBadGateway)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":    true,
+		"switchover": status,
+	}, http.StatusOK)
+}
+
+// Cutover handles POST /api/v1/admin/face-service/switchover/cutover?force=,
+// switching recognitions to the other face service once both hold the same
+// enrollments, or regardless with force=true
+func (h *SwitchoverHandler) Cutover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status, err := h.switchover.Cutover(r.Context(), r.URL.Query().Get("force") == "true")
+	switch {
+	case errors.Is(err, service.ErrNoSwitchover):
+		jsonError(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, service.ErrEnrollmentMismatch):
+		jsonResponse(w, map[string]interface{}{
+			"success":      false,
+			"error":        "Enrollments differ between the face services; re-enroll the people listed or cut over with force=true",
+			"verification": status.Verification,
+		}, http.StatusConflict)
+		return
+	case err != nil:
+		logging.From(r.Context()).Error("Face service cutover failed", "error", err)
+		jsonError(w, "Failed to compare the face services", http.StatusBadGateway)
+		return
+	}
+	auditChange(h.audit, r, domain.AuditConfigChange,
+		fmt.Sprintf("cut face recognition over to %s from %s", status.Active, status.Standby))
+
+	jsonResponse(w, map[string]interface{}{
+		"success":    true,
+		"switchover": status,
+		"message":    fmt.Sprintf("Recognizing with %s", status.Active),
+	}, http.StatusOK)
+}
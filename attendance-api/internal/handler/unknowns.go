@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+type UnknownHandler struct {
+	unknowns   *service.UnknownService
+	attendance *service.AttendanceService
+	audit      *service.AuditService
+}
+
+func NewUnknownHandler(unknowns *service.UnknownService, attendance *service.AttendanceService, audit *service.AuditService) *UnknownHandler {
+	return &UnknownHandler{unknowns: unknowns, attendance: attendance, audit: audit}
+}
+
+// ListUnknowns handles GET /api/v1/unknowns?status=&limit=
+func (h *UnknownHandler) ListUnknowns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", domain.UnknownPending, domain.UnknownEnrolled, domain.UnknownDismissed:
+	default:
+		jsonError(w, "status must be pending, enrolled or dismissed", http.StatusBadRequest)
+		return
+	}
+
+	limit := 50
+	if parsed, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && parsed > 0 && parsed <= 500 {
+		limit = parsed
+	}
+
+	events, err := h.unknowns.List(status, limit)
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to list unknown events", "error", err)
+		jsonError(w, "Failed to list unknown events", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":  true,
+		"count":    len(events),
+		"unknowns": events,
+	}, http.StatusOK)
+}
+
+// Unknown handles /api/v1/unknowns/{id}: GET returns the event, DELETE
+// dismisses it and deletes its snapshots
+func (h *UnknownHandler) Unknown(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		event, err := h.unknowns.Get(id)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"unknown": event,
+		}, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := h.unknowns.Dismiss(r.Context(), id); err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"message": "Unknown event dismissed",
+		}, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Image handles GET /api/v1/unknowns/{id}/image, the submitted image
+func (h *UnknownHandler) Image(w http.ResponseWriter, r *http.Request) {
+	h.serveSnapshot(w, r, false)
+}
+
+// Crop handles GET /api/v1/unknowns/{id}/crop, the cropped face
+func (h *UnknownHandler) Crop(w http.ResponseWriter, r *http.Request) {
+	h.serveSnapshot(w, r, true)
+}
+
+func (h *UnknownHandler) serveSnapshot(w http.ResponseWriter, r *http.Request, crop bool) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := h.unknowns.Snapshot(r.Context(), r.PathValue("id"), crop)
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+	auditExport(h.audit, r, domain.AuditExportSnapshot, 1)
+
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Write(data)
+}
+
+// Enroll handles POST /api/v1/unknowns/{id}/enroll, adding the stored snapshot
+// to the face service as a new person
+func (h *UnknownHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	req.Name = service.NormalizeName(req.Name)
+	if req.Name == "" || req.Name == "unknown" {
+		jsonError(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	event, err := h.unknowns.Enroll(r.Context(), r.PathValue("id"), req.Name)
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+	auditChange(h.audit, r, domain.AuditFaceUpload, fmt.Sprintf("%s: enrolled from unknown event %s", req.Name, event.ID))
+	h.attendance.FaceAdded(r.Context(), req.Name, 1)
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"unknown": event,
+		"message": fmt.Sprintf("Enrolled as %s", req.Name),
+	}, http.StatusOK)
+}
+
+func (h *UnknownHandler) serviceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrUnknownNotFound):
+		jsonError(w, "Unknown event not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrSnapshotNotFound):
+		jsonError(w, "Snapshot not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrUnknownReviewed):
+		jsonError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrFaceRejected):
+		jsonError(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		logging.From(r.Context()).Error("Unknown event operation failed", "error", err)
+		jsonError(w, "Unknown event operation failed", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+// maxUsageDays bounds the period of a single usage request
+const maxUsageDays = 366
+
+type UsageHandler struct {
+	usage *service.UsageService
+	loc   *time.Location // zone of the site, whose today is the default end
+}
+
+func NewUsageHandler(usage *service.UsageService, loc *time.Location) *UsageHandler {
+	return &UsageHandler{usage: usage, loc: loc}
+}
+
+// Clients handles GET /api/v1/admin/usage/clients?from=&to=&daily=, the
+// request counts, error rates and latencies of each client and device over
+// the last 7 days by default
+func (h *UsageHandler) Clients(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	to := time.Now().In(h.loc)
+	if v := query.Get("to"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			jsonError(w, "to must be in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+
+	from := to.AddDate(0, 0, -6)
+	if v := query.Get("from"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			jsonError(w, "from must be in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+
+	days := int(to.Sub(from).Hours()/24) + 1
+	if days < 1 || days > maxUsageDays {
+		jsonError(w, fmt.Sprintf("Period must cover between 1 and %d days", maxUsageDays), http.StatusBadRequest)
+		return
+	}
+
+	fromDay, toDay := from.Format("2006-01-02"), to.Format("2006-01-02")
+	clients, err := h.usage.Clients(fromDay, toDay, query.Get("daily") == "true")
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to get client usage", "error", err)
+		jsonError(w, "Failed to get client usage", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":  true,
+		"from":     fromDay,
+		"to":       toDay,
+		"tracking": h.usage.Enabled(),
+		"count":    len(clients),
+		"clients":  clients,
+	}, http.StatusOK)
+}
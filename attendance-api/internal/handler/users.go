@@ -0,0 +1,287 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+type UserHandler struct {
+	users *service.UserService
+	audit *service.AuditService
+}
+
+func NewUserHandler(users *service.UserService, audit *service.AuditService) *UserHandler {
+	return &UserHandler{users: users, audit: audit}
+}
+
+type userRequest struct {
+	Username *string `json:"username"`
+	Password *string `json:"password"`
+	Role     *string `json:"role"`
+	Tenant   *string `json:"tenant"`
+	Disabled *bool   `json:"disabled"`
+}
+
+// changed lists the fields an update sets, without their values so no
+// password ends up in the audit log
+func (req userRequest) changed() string {
+	var fields []string
+	if req.Password != nil {
+		fields = append(fields, "password")
+	}
+	if req.Role != nil {
+		fields = append(fields, "role="+*req.Role)
+	}
+	if req.Tenant != nil {
+		fields = append(fields, "tenant="+*req.Tenant)
+	}
+	if req.Disabled != nil {
+		fields = append(fields, fmt.Sprintf("disabled=%t", *req.Disabled))
+	}
+	if len(fields) == 0 {
+		return "nothing"
+	}
+	return strings.Join(fields, ", ")
+}
+
+// Login handles POST /api/v1/auth/login {"username": "", "password": ""}
+func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	user, tokens, err := h.users.Login(req.Username, req.Password)
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+	logging.From(r.Context()).Info("User signed in", "username", user.Username, "role", user.Role)
+
+	h.tokenResponse(w, user, tokens)
+}
+
+// Refresh handles POST /api/v1/auth/refresh {"refresh_token": ""}
+func (h *UserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	user, tokens, err := h.users.Refresh(req.RefreshToken)
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+
+	h.tokenResponse(w, user, tokens)
+}
+
+// Logout handles POST /api/v1/auth/logout {"refresh_token": ""}
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.users.Logout(req.RefreshToken); err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"message": "Signed out",
+	}, http.StatusOK)
+}
+
+func (h *UserHandler) tokenResponse(w http.ResponseWriter, user *domain.User, tokens *domain.TokenPair) {
+	w.Header().Set("Cache-Control", "no-store")
+	jsonResponse(w, map[string]interface{}{
+		"success":            true,
+		"user":               user,
+		"access_token":       tokens.AccessToken,
+		"token_type":         tokens.TokenType,
+		"expires_in":         tokens.ExpiresIn,
+		"refresh_token":      tokens.RefreshToken,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
+	}, http.StatusOK)
+}
+
+// Users handles /api/v1/admin/users (list and create)
+func (h *UserHandler) Users(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		users, err := h.users.List()
+		if err != nil {
+			logging.From(r.Context()).Error("Failed to list users", "error", err)
+			jsonError(w, "Failed to list users", http.StatusInternalServerError)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"count":   len(users),
+			"users":   users,
+		}, http.StatusOK)
+
+	case http.MethodPost:
+		var req userRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		if req.Username == nil || strings.TrimSpace(*req.Username) == "" {
+			jsonError(w, "Username is required", http.StatusBadRequest)
+			return
+		}
+		if req.Password == nil || req.Role == nil {
+			jsonError(w, "Password and role are required", http.StatusBadRequest)
+			return
+		}
+
+		var tenant string
+		if req.Tenant != nil {
+			tenant = *req.Tenant
+		}
+
+		user, err := h.users.Create(strings.TrimSpace(*req.Username), *req.Password, *req.Role, tenant)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, fmt.Sprintf("created user %s with role %s", user.Username, user.Role))
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"user":    user,
+		}, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// User handles /api/v1/admin/users/{id} (get, update and delete)
+func (h *UserHandler) User(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		user, err := h.users.Get(id)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"user":    user,
+		}, http.StatusOK)
+
+	case http.MethodPatch:
+		var req userRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if req.Username != nil {
+			jsonError(w, "The username cannot be changed", http.StatusBadRequest)
+			return
+		}
+
+		user, err := h.users.Update(id, req.Password, req.Role, req.Tenant, req.Disabled)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, fmt.Sprintf("updated %s of user %s", req.changed(), user.Username))
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"user":    user,
+		}, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := h.users.Delete(id); err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, "deleted user "+id)
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"message": "User deleted",
+		}, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Roles handles GET /api/v1/admin/roles, the role policy users are
+// granted scopes by
+func (h *UserHandler) Roles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	roles := h.users.Roles()
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"count":   len(roles),
+		"roles":   roles,
+	}, http.StatusOK)
+}
+
+func (h *UserHandler) serviceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		jsonError(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrUserExists):
+		jsonError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidRole), errors.Is(err, service.ErrWeakPassword):
+		jsonError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrInvalidCredentials):
+		jsonError(w, "Invalid username or password", http.StatusUnauthorized)
+	case errors.Is(err, service.ErrInvalidToken):
+		jsonError(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+	default:
+		logging.From(r.Context()).Error("User operation failed", "error", err)
+		jsonError(w, "User operation failed", http.StatusInternalServerError)
+	}
+}
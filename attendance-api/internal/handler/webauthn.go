@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+// maxWebAuthnResponse bounds the authenticator responses read from clients
+const maxWebAuthnResponse = 64 << 10
+
+type WebAuthnHandler struct {
+	webAuthn *service.WebAuthnService
+	users    *service.UserService
+}
+
+func NewWebAuthnHandler(webAuthn *service.WebAuthnService, users *service.UserService) *WebAuthnHandler {
+	return &WebAuthnHandler{webAuthn: webAuthn, users: users}
+}
+
+// BeginRegistration handles POST /api/v1/auth/webauthn/register/begin. A
+// user who already has a security key must send X-Step-Up.
+func (h *WebAuthnHandler) BeginRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := h.signedInUser(w, r)
+	if !ok {
+		return
+	}
+
+	options, err := h.webAuthn.BeginRegistration(user, r.Header.Get("X-Step-Up"))
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"options": options,
+	}, http.StatusOK)
+}
+
+// FinishRegistration handles POST /api/v1/auth/webauthn/register/finish?name=
+// with the PublicKeyCredential returned by navigator.credentials.create
+func (h *WebAuthnHandler) FinishRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := h.signedInUser(w, r)
+	if !ok {
+		return
+	}
+
+	response, err := io.ReadAll(io.LimitReader(r.Body, maxWebAuthnResponse))
+	if err != nil {
+		jsonError(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	credential, err := h.webAuthn.FinishRegistration(user, r.URL.Query().Get("name"), response)
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":    true,
+		"credential": credential,
+	}, http.StatusCreated)
+}
+
+// Credentials handles GET /api/v1/auth/webauthn/credentials, the security
+// keys of the signed-in user
+func (h *WebAuthnHandler) Credentials(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := h.signedInUser(w, r)
+	if !ok {
+		return
+	}
+
+	credentials, err := h.webAuthn.Credentials(user.ID)
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":     true,
+		"count":       len(credentials),
+		"credentials": credentials,
+	}, http.StatusOK)
+}
+
+// Credential handles DELETE /api/v1/auth/webauthn/credentials/{id}, which
+// needs X-Step-Up
+func (h *WebAuthnHandler) Credential(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := h.signedInUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.webAuthn.DeleteCredential(user, r.PathValue("id"), r.Header.Get("X-Step-Up")); err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"message": "Security key removed",
+	}, http.StatusOK)
+}
+
+// BeginStepUp handles POST /api/v1/auth/webauthn/step-up/begin
+func (h *WebAuthnHandler) BeginStepUp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := h.signedInUser(w, r)
+	if !ok {
+		return
+	}
+
+	options, err := h.webAuthn.BeginStepUp(user)
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"options": options,
+	}, http.StatusOK)
+}
+
+// FinishStepUp handles POST /api/v1/auth/webauthn/step-up/finish with the
+// PublicKeyCredential returned by navigator.credentials.get
+func (h *WebAuthnHandler) FinishStepUp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := h.signedInUser(w, r)
+	if !ok {
+		return
+	}
+
+	response, err := io.ReadAll(io.LimitReader(r.Body, maxWebAuthnResponse))
+	if err != nil {
+		jsonError(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	stepUp, err := h.webAuthn.FinishStepUp(user, response)
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	jsonResponse(w, map[string]interface{}{
+		"success":       true,
+		"step_up_token": stepUp.Token,
+		"expires_in":    stepUp.ExpiresIn,
+		"expires_at":    stepUp.ExpiresAt,
+	}, http.StatusOK)
+}
+
+// signedInUser returns the user whose access token the request carries.
+// Security keys belong to users; API keys cannot have any.
+func (h *WebAuthnHandler) signedInUser(w http.ResponseWriter, r *http.Request) (*domain.User, bool) {
+	actor := domain.ActorFromContext(r.Context())
+	if actor.Type != domain.ActorUser {
+		jsonError(w, "Sign in as a user to use security keys", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	user, err := h.users.Get(actor.ID)
+	if err != nil {
+		h.serviceError(w, r, err)
+		return nil, false
+	}
+	return user, true
+}
+
+func (h *WebAuthnHandler) serviceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrWebAuthnDisabled):
+		jsonError(w, "WebAuthn is not configured", http.StatusNotImplemented)
+	case errors.Is(err, service.ErrStepUpRequired):
+		jsonResponse(w, map[string]interface{}{
+			"success":          false,
+			"error":            "Step-up authentication required",
+			"step_up_required": true,
+		}, http.StatusForbidden)
+	case errors.Is(err, service.ErrUserNotFound):
+		jsonError(w, "Sign in as a user to use security keys", http.StatusUnauthorized)
+	case errors.Is(err, service.ErrCredentialNotFound):
+		jsonError(w, "Security key not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrNoAuthenticators), errors.Is(err, service.ErrCeremonyExpired):
+		jsonError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrWebAuthnFailed):
+		jsonError(w, err.Error(), http.StatusUnauthorized)
+	default:
+		logging.From(r.Context()).Error("WebAuthn operation failed", "error", err)
+		jsonError(w, "WebAuthn operation failed", http.StatusInternalServerError)
+	}
+}
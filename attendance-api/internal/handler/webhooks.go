@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+type WebhookHandler struct {
+	webhooks *service.WebhookService
+	audit    *service.AuditService
+}
+
+func NewWebhookHandler(webhooks *service.WebhookService, audit *service.AuditService) *WebhookHandler {
+	return &WebhookHandler{webhooks: webhooks, audit: audit}
+}
+
+type webhookRequest struct {
+	URL         *string  `json:"url"`
+	Events      []string `json:"events"` // every event type when empty
+	Description *string  `json:"description"`
+	Secret      *string  `json:"secret"` // generated when not set, on creation only
+	Active      *bool    `json:"active"`
+}
+
+// Webhooks handles /api/v1/webhooks (list and register)
+func (h *WebhookHandler) Webhooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		hooks, err := h.webhooks.List()
+		if err != nil {
+			logging.From(r.Context()).Error("Failed to list webhooks", "error", err)
+			jsonError(w, "Failed to list webhooks", http.StatusInternalServerError)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success":  true,
+			"count":    len(hooks),
+			"webhooks": hooks,
+		}, http.StatusOK)
+
+	case http.MethodPost:
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		if req.URL == nil || *req.URL == "" {
+			jsonError(w, "URL is required", http.StatusBadRequest)
+			return
+		}
+
+		var description, secret string
+		if req.Description != nil {
+			description = *req.Description
+		}
+		if req.Secret != nil {
+			secret = *req.Secret
+		}
+
+		hook, secret, err := h.webhooks.Create(*req.URL, req.Events, description, secret)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, fmt.Sprintf("registered webhook %s (%s)", hook.ID, hook.URL))
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"webhook": hook,
+			"secret":  secret,
+			"message": "Store the secret now, it will not be shown again",
+		}, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Webhook handles /api/v1/webhooks/{id} (get, update and remove)
+func (h *WebhookHandler) Webhook(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		hook, err := h.webhooks.Get(id)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"webhook": hook,
+		}, http.StatusOK)
+
+	case http.MethodPatch:
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if req.Secret != nil {
+			jsonError(w, "The secret cannot be changed, register a new webhook instead", http.StatusBadRequest)
+			return
+		}
+
+		hook, err := h.webhooks.Update(id, req.URL, req.Events, req.Description, req.Active)
+		if err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, fmt.Sprintf("updated webhook %s (%s)", hook.ID, hook.URL))
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"webhook": hook,
+		}, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := h.webhooks.Delete(id); err != nil {
+			h.serviceError(w, r, err)
+			return
+		}
+		auditChange(h.audit, r, domain.AuditConfigChange, "removed webhook "+id)
+
+		jsonResponse(w, map[string]interface{}{
+			"success": true,
+			"message": "Webhook removed",
+		}, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Test handles POST /api/v1/admin/webhooks/{id}/test, sending a sample signed
+// event right away and answering with its delivery
+func (h *WebhookHandler) Test(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	delivery, err := h.webhooks.Test(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":   true,
+		"delivered": delivery.Status == domain.DeliveryDelivered,
+		"delivery":  delivery,
+	}, http.StatusOK)
+}
+
+// Deliveries handles GET /api/v1/admin/webhooks/{id}/deliveries?status=&limit=,
+// the latest deliveries to a webhook with their attempts
+func (h *WebhookHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	status := query.Get("status")
+	switch status {
+	case "", domain.DeliveryPending, domain.DeliveryDelivered, domain.DeliveryFailed:
+	default:
+		jsonError(w, "status must be pending, delivered or failed", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultDeliveryLimit
+	if v := query.Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxDeliveryLimit {
+			jsonError(w, fmt.Sprintf("limit must be between 1 and %d", maxDeliveryLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	deliveries, err := h.webhooks.Deliveries(r.PathValue("id"), status, limit)
+	if err != nil {
+		h.serviceError(w, r, err)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":    true,
+		"count":      len(deliveries),
+		"deliveries": deliveries,
+	}, http.StatusOK)
+}
+
+func (h *WebhookHandler) serviceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrWebhookNotFound):
+		jsonError(w, "Webhook not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidWebhookURL), errors.Is(err, service.ErrInvalidWebhookEvent):
+		jsonError(w, err.Error(), http.StatusBadRequest)
+	default:
+		logging.From(r.Context()).Error("Webhook operation failed", "error", err)
+		jsonError(w, "Webhook operation failed", http.StatusInternalServerError)
+	}
+}
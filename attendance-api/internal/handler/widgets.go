@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+// WidgetHandler serves the widgets of lobby displays. Payloads carry a
+// refresh_after hint in seconds, are cacheable for as long and have an ETag,
+// so displays polling an unchanged widget get 304 Not Modified.
+type WidgetHandler struct {
+	widgets *service.WidgetService
+}
+
+func NewWidgetHandler(widgets *service.WidgetService) *WidgetHandler {
+	return &WidgetHandler{widgets: widgets}
+}
+
+// Present handles GET /api/v1/widgets/present, the number of people
+// recognized today
+func (h *WidgetHandler) Present(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	present, err := h.widgets.Present()
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to build present widget", "error", err)
+		jsonError(w, "Failed to get the present count", http.StatusInternalServerError)
+		return
+	}
+
+	writeWidget(w, r, map[string]interface{}{
+		"success": true,
+		"present": present,
+	}, h.widgets.Refresh(service.WidgetPresent))
+}
+
+// Arrivals handles GET /api/v1/widgets/arrivals, today's latest arrivals
+// with the path of their face thumbnail
+func (h *WidgetHandler) Arrivals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	arrivals, err := h.widgets.Arrivals()
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to build arrivals widget", "error", err)
+		jsonError(w, "Failed to get the arrivals", http.StatusInternalServerError)
+		return
+	}
+
+	writeWidget(w, r, map[string]interface{}{
+		"success":  true,
+		"arrivals": arrivals,
+	}, h.widgets.Refresh(service.WidgetArrivals))
+}
+
+// Thumbnail handles GET /api/v1/widgets/arrivals/{id}/thumbnail, the face of
+// an arrival listed on the arrivals widget
+func (h *WidgetHandler) Thumbnail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := h.widgets.Thumbnail(r.Context(), r.PathValue("id"))
+	if errors.Is(err, service.ErrNoThumbnail) {
+		jsonError(w, "Thumbnail not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to build thumbnail", "error", err)
+		jsonError(w, "Failed to get the thumbnail", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Write(data)
+}
+
+// Alerts handles GET /api/v1/widgets/alerts, the recent unknown, turned away
+// and misplaced recognitions and whether face recognition is available
+func (h *WidgetHandler) Alerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	alerts, err := h.widgets.Alerts()
+	if err != nil {
+		logging.From(r.Context()).Error("Failed to build alerts widget", "error", err)
+		jsonError(w, "Failed to get the alerts", http.StatusInternalServerError)
+		return
+	}
+
+	writeWidget(w, r, map[string]interface{}{
+		"success": true,
+		"alerts":  alerts,
+	}, h.widgets.Refresh(service.WidgetAlerts))
+}
+
+// writeWidget answers with a widget payload and its refresh hint, or with
+// 304 Not Modified when the client already holds the same payload
+func writeWidget(w http.ResponseWriter, r *http.Request, data map[string]interface{}, refresh time.Duration) {
+	seconds := max(int(refresh.Seconds()), 1)
+	data["refresh_after"] = seconds
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		jsonError(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	body = append(body, '\n')
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", seconds))
+
+	for _, match := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if match = strings.TrimPrefix(strings.TrimSpace(match), "W/"); match == etag || match == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
@@ -0,0 +1,62 @@
+// Package logging sets up the structured logger and carries per-request
+// fields, such as the request ID, in contexts.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+
+	"attendance-api/internal/config"
+)
+
+type contextKey struct{}
+
+// Setup makes a logger for cfg, writing to stdout, the default. Lines of
+// the log package, such as those of libraries, go through it too.
+func Setup(cfg config.LogConfig) *slog.Logger {
+	logger := New(cfg, os.Stdout)
+	slog.SetDefault(logger)
+	return logger
+}
+
+// New makes a logger for cfg writing to w
+func New(cfg config.LogConfig, w io.Writer) *slog.Logger {
+	var level slog.Level
+	switch cfg.Level {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.Format == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// With returns a context whose logger adds args, key-value pairs as for
+// slog.Logger.With, to every line
+func With(ctx context.Context, args ...any) context.Context {
+	return context.WithValue(ctx, contextKey{}, From(ctx).With(args...))
+}
+
+// From returns the logger of a context, with the fields added by With, or
+// the default logger
+func From(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Component returns the default logger naming the part of the server that
+// logs, for background work outside any request
+func Component(name string) *slog.Logger {
+	return slog.Default().With("component", name)
+}
@@ -0,0 +1,331 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"attendance-api/internal/config"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+// allowlistPoll is how often the allowlist file is checked for changes
+const allowlistPoll = 5 * time.Second
+
+// IPAllowlist answers 403 to door-control and admin requests from clients
+// outside the ranges configured for them, so a leaked key is of no use
+// outside the camera VLAN or the office network. It also names the ranges
+// whose clients read the widgets without a key.
+type IPAllowlist struct {
+	file string
+
+	mu      sync.RWMutex
+	door    []netip.Prefix // nil leaves the routes open
+	admin   []netip.Prefix
+	widgets []netip.Prefix // nil requires a key everywhere
+	modTime time.Time
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// allowlistFile is the format of the allowlist file:
+//
+//	door:
+//	  - 10.20.0.0/16
+//	admin:
+//	  - 192.168.1.0/24
+//	  - 203.0.113.7
+//	widgets:
+//	  - 10.30.5.0/24
+type allowlistFile struct {
+	Door    []string `yaml:"door"`
+	Admin   []string `yaml:"admin"`
+	Widgets []string `yaml:"widgets"`
+}
+
+func NewIPAllowlist(cfg config.AllowlistConfig) (*IPAllowlist, error) {
+	a := &IPAllowlist{file: cfg.File, stop: make(chan struct{})}
+
+	if a.file != "" {
+		if err := a.reload(); err != nil {
+			return nil, err
+		}
+		go a.watch()
+		return a, nil
+	}
+
+	var err error
+	if a.door, err = parsePrefixes(cfg.Door); err != nil {
+		return nil, fmt.Errorf("IP_ALLOWLIST_DOOR: %w", err)
+	}
+	if a.admin, err = parsePrefixes(cfg.Admin); err != nil {
+		return nil, fmt.Errorf("IP_ALLOWLIST_ADMIN: %w", err)
+	}
+	if a.widgets, err = parsePrefixes(cfg.Widgets); err != nil {
+		return nil, fmt.Errorf("IP_ALLOWLIST_WIDGETS: %w", err)
+	}
+	return a, nil
+}
+
+// parsePrefixes parses CIDR ranges; a bare address is a range of its own
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR range %q", entry)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// Close stops watching the allowlist file
+func (a *IPAllowlist) Close() {
+	a.once.Do(func() { close(a.stop) })
+}
+
+// reload reads the allowlist file when it changed since it was last read.
+// A file that cannot be used leaves the lists as they were.
+func (a *IPAllowlist) reload() error {
+	info, err := os.Stat(a.file)
+	if err != nil {
+		return fmt.Errorf("failed to read allowlist: %w", err)
+	}
+
+	a.mu.RLock()
+	unchanged := info.ModTime().Equal(a.modTime)
+	a.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := os.ReadFile(a.file)
+	if err != nil {
+		return fmt.Errorf("failed to read allowlist: %w", err)
+	}
+	var lists allowlistFile
+	if err := yaml.Unmarshal(data, &lists); err != nil {
+		return fmt.Errorf("invalid allowlist %s: %w", a.file, err)
+	}
+	door, err := parsePrefixes(lists.Door)
+	if err != nil {
+		return fmt.Errorf("allowlist %s, door: %w", a.file, err)
+	}
+	admin, err := parsePrefixes(lists.Admin)
+	if err != nil {
+		return fmt.Errorf("allowlist %s, admin: %w", a.file, err)
+	}
+	widgets, err := parsePrefixes(lists.Widgets)
+	if err != nil {
+		return fmt.Errorf("allowlist %s, widgets: %w", a.file, err)
+	}
+
+	a.mu.Lock()
+	first := a.modTime.IsZero()
+	a.door, a.admin, a.widgets, a.modTime = door, admin, widgets, info.ModTime()
+	a.mu.Unlock()
+
+	if !first {
+		slog.Info("IP allowlist reloaded", "component", "allowlist", "file", a.file, "allowlist", a.String())
+	}
+	return nil
+}
+
+func (a *IPAllowlist) watch() {
+	ticker := time.NewTicker(allowlistPoll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+			if err := a.reload(); err != nil {
+				slog.Error("Failed to reload IP allowlist, keeping the previous ranges", "component", "allowlist", "error", err)
+			}
+		}
+	}
+}
+
+// String describes the ranges for the startup log
+func (a *IPAllowlist) String() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	describe := func(prefixes []netip.Prefix) string {
+		if prefixes == nil {
+			return "any"
+		}
+		ranges := make([]string, len(prefixes))
+		for i, prefix := range prefixes {
+			ranges[i] = prefix.String()
+		}
+		return strings.Join(ranges, ", ")
+	}
+	described := fmt.Sprintf("door from %s, admin from %s", describe(a.door), describe(a.admin))
+	if a.widgets != nil {
+		described += ", widgets without a key from " + describe(a.widgets)
+	}
+	return described
+}
+
+// Enabled reports whether any ranges are configured, or may become so when
+// the file changes
+func (a *IPAllowlist) Enabled() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.file != "" || a.door != nil || a.admin != nil || a.widgets != nil
+}
+
+// allows reports whether the client at host may use routes restricted to
+// prefixes
+func allows(prefixes []netip.Prefix, host string) bool {
+	if prefixes == nil {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpensWidgets reports whether the client of r is in the widget ranges and
+// may read the widgets without a key
+func (a *IPAllowlist) OpensWidgets(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	a.mu.RLock()
+	widgets := a.widgets
+	a.mu.RUnlock()
+	return widgets != nil && allows(widgets, host)
+}
+
+// Restrict answers 403 to door-control requests (IsDoorControl) and
+// admin requests (IsAdminAction and /api/v1/admin/) from clients outside
+// their ranges. It must run after the legacy paths are rewritten.
+func (a *IPAllowlist) Restrict(next http.Handler) http.Handler {
+	if !a.Enabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+
+		a.mu.RLock()
+		door, admin := a.door, a.admin
+		a.mu.RUnlock()
+
+		switch {
+		case IsDoorControl(r):
+			if !allows(door, host) {
+				writeError(w, "Door control is not allowed from this address", http.StatusForbidden)
+				return
+			}
+		case IsAdminAction(r) || strings.HasPrefix(r.URL.Path, "/api/v1/admin/"):
+			if !allows(admin, host) {
+				writeError(w, "Administration is not allowed from this address", http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UnaryRestrict is Restrict for gRPC calls: the door methods are limited to
+// the door ranges, answering PermissionDenied
+func (a *IPAllowlist) UnaryRestrict(doorMethods ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		door := false
+		for _, method := range doorMethods {
+			door = door || info.FullMethod == method
+		}
+		if !door {
+			return handler(ctx, req)
+		}
+
+		host := ""
+		if p, ok := peer.FromContext(ctx); ok {
+			host = p.Addr.String()
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+		}
+
+		a.mu.RLock()
+		allowed := allows(a.door, host)
+		a.mu.RUnlock()
+		if !allowed {
+			return nil, status.Error(codes.PermissionDenied, "door control is not allowed from this address")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// IsDoorControl reports whether a request comes from a door device:
+// recording attendance, sending a device heartbeat or taking and
+// acknowledging its queued commands
+func IsDoorControl(r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+	if r.URL.Path == "/api/v1/attendance" {
+		return true
+	}
+	rest, found := strings.CutPrefix(r.URL.Path, "/api/v1/devices/")
+	if !found {
+		return false
+	}
+	switch parts := strings.Split(rest, "/"); len(parts) {
+	case 2:
+		return parts[1] == "heartbeat"
+	case 3:
+		return parts[1] == "commands" && parts[2] == "poll"
+	case 4:
+		return parts[1] == "commands" && parts[3] == "ack"
+	}
+	return false
+}
+
+// IsAdminAction reports whether a request changes configuration or data,
+// other than by door devices or by signing in and out
+func IsAdminAction(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return strings.HasPrefix(r.URL.Path, "/api/v1/") && !strings.HasPrefix(r.URL.Path, "/api/v1/auth/") &&
+		!IsDoorControl(r) && r.URL.Path != "/api/v1/graphql"
+}
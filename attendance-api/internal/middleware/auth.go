@@ -0,0 +1,311 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/service"
+)
+
+type contextKey string
+
+const identityContextKey contextKey = "identity"
+
+// identity is the outcome of looking up the key or token a request
+// carries. A user's token is resolved to a key with the scopes of their
+// role, and a device's token to one with the scopes of the device role.
+type identity struct {
+	key *domain.APIKey
+	err error
+}
+
+// Auth enforces API key scopes on routes, for API keys, the access tokens
+// of signed-in users and the tokens of registered devices
+type Auth struct {
+	keys     *service.APIKeyService
+	users    *service.UserService
+	devices  *service.DeviceService
+	webAuthn *service.WebAuthnService
+	enabled  bool
+	adminKey string
+}
+
+func NewAuth(keys *service.APIKeyService, users *service.UserService, devices *service.DeviceService, webAuthn *service.WebAuthnService, cfg config.AuthConfig) *Auth {
+	return &Auth{
+		keys:     keys,
+		users:    users,
+		devices:  devices,
+		webAuthn: webAuthn,
+		enabled:  cfg.Enabled,
+		adminKey: cfg.AdminKey,
+	}
+}
+
+// Identify resolves the actor of every request, so handlers, services and
+// the access log can attribute what the request does. It never rejects a
+// request; that is left to Require on the routes that need a scope.
+func (a *Auth) Identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(a.identify(r)))
+	})
+}
+
+func (a *Auth) identify(r *http.Request) context.Context {
+	secret := extractAPIKey(r)
+	if r.Method == http.MethodOptions {
+		secret = ""
+	}
+	return a.identifyKey(r.Context(), secret, r.Header.Get("X-Device-ID"))
+}
+
+// identifyKey looks up the key a request or call carries and stores the
+// outcome and the actor in the context
+func (a *Auth) identifyKey(ctx context.Context, secret, device string) context.Context {
+	id := &identity{}
+	actor := domain.Actor{Type: domain.ActorAnonymous}
+
+	switch {
+	case service.IsAccessToken(secret):
+		var user *domain.User
+		user, id.err = a.users.Authenticate(secret)
+		if id.err == nil {
+			scopes, _ := a.users.Scopes(user.Role)
+			id.key = &domain.APIKey{
+				ID:     user.ID,
+				Name:   user.Username,
+				Tenant: user.Tenant,
+				Scopes: scopes,
+			}
+			actor = domain.Actor{
+				Type:   domain.ActorUser,
+				ID:     user.ID,
+				Name:   user.Username,
+				Tenant: user.Tenant,
+			}
+		}
+	case service.IsDeviceToken(secret):
+		var registered *domain.Device
+		registered, id.err = a.devices.Authenticate(secret)
+		if id.err == nil {
+			scopes, _ := a.users.Scopes(domain.RoleDevice)
+			id.key = &domain.APIKey{
+				ID:     registered.ID,
+				Name:   registered.Name,
+				Tenant: registered.Tenant,
+				Scopes: scopes,
+			}
+			actor = domain.Actor{
+				Type:     domain.ActorDevice,
+				ID:       registered.ID,
+				Name:     registered.Name,
+				Tenant:   registered.Tenant,
+				Location: registered.Location,
+			}
+			// The token names the device; X-Device-ID cannot change it
+			device = registered.ID
+		}
+	case secret != "":
+		id.key, id.err = a.authenticate(secret)
+		if id.err == nil {
+			actor = domain.Actor{
+				Type:   domain.ActorAPIKey,
+				ID:     id.key.ID,
+				Name:   id.key.Name,
+				Tenant: id.key.Tenant,
+			}
+		}
+	}
+	actor.Device = device
+
+	ctx = context.WithValue(ctx, identityContextKey, id)
+	return domain.WithActor(ctx, actor)
+}
+
+// Require wraps a handler so it only runs for requests carrying a valid key
+// with the given scope. When authentication is disabled every request passes.
+func (a *Auth) Require(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return a.require(func(key *domain.APIKey, r *http.Request) bool {
+		return key.HasScope(scope)
+	}, "API key lacks scope "+scope, next)
+}
+
+// RequireOrSelf is Require for data about one person: keys with the
+// attendance:self scope also pass when the person query parameter names the
+// person the key belongs to.
+func (a *Auth) RequireOrSelf(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return a.require(func(key *domain.APIKey, r *http.Request) bool {
+		if key.HasScope(scope) {
+			return true
+		}
+		person := r.URL.Query().Get("person")
+		return key.HasScope(domain.ScopeAttendanceSelf) && person != "" && person == key.Person
+	}, "API key lacks scope "+scope+" and is not bound to this person", next)
+}
+
+// RequireAny is Require for routes serving clients of several scopes, such
+// as the status of jobs, which devices poll for their asynchronous requests.
+// The handler narrows down what each scope may see.
+func (a *Auth) RequireAny(scopes []string, next http.HandlerFunc) http.HandlerFunc {
+	return a.require(func(key *domain.APIKey, r *http.Request) bool {
+		return slices.ContainsFunc(scopes, key.HasScope)
+	}, "API key lacks one of the scopes "+strings.Join(scopes, ", "), next)
+}
+
+// RequireUnless is Require for routes some clients may use without a key,
+// such as the widgets on lobby displays: requests open admits skip the check
+func (a *Auth) RequireUnless(open func(r *http.Request) bool, scope string, next http.HandlerFunc) http.HandlerFunc {
+	required := a.Require(scope, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if open(r) {
+			next(w, r)
+			return
+		}
+		required(w, r)
+	}
+}
+
+// RequireStepUp is Require for destructive actions: signed-in users must
+// also send the X-Step-Up token of a recent WebAuthn assertion with one of
+// their security keys. API keys belong to machines and are not asked to
+// step up, and without WebAuthn configured nobody is.
+func (a *Auth) RequireStepUp(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return a.Require(scope, func(w http.ResponseWriter, r *http.Request) {
+		actor := domain.ActorFromContext(r.Context())
+		if !a.enabled || r.Method == http.MethodOptions || actor.Type != domain.ActorUser {
+			next(w, r)
+			return
+		}
+
+		err := a.webAuthn.CheckStepUp(actor.ID, r.Header.Get("X-Step-Up"))
+		switch {
+		case err == nil:
+			next(w, r)
+		case errors.Is(err, service.ErrNoAuthenticators):
+			writeStepUpRequired(w, "Register a security key to perform this action")
+		case errors.Is(err, service.ErrStepUpRequired):
+			writeStepUpRequired(w, "Step-up authentication required")
+		default:
+			logging.From(r.Context()).Error("Step-up check failed", "error", err)
+			writeError(w, "Failed to authenticate", http.StatusInternalServerError)
+		}
+	})
+}
+
+// Permits reports whether the request in ctx may use scope, for checks
+// within a route such as single GraphQL fields. With authentication
+// disabled everything is permitted.
+func (a *Auth) Permits(ctx context.Context, scope string) bool {
+	if !a.enabled {
+		return true
+	}
+	id, ok := ctx.Value(identityContextKey).(*identity)
+	return ok && id.key != nil && id.key.HasScope(scope)
+}
+
+func (a *Auth) require(allowed func(key *domain.APIKey, r *http.Request) bool, denied string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := r.Context().Value(identityContextKey).(*identity)
+		if !ok {
+			r = r.WithContext(a.identify(r))
+			id = r.Context().Value(identityContextKey).(*identity)
+		}
+
+		if !a.enabled || r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+
+		if id.key == nil && id.err == nil {
+			writeError(w, "API key required", http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case errors.Is(id.err, service.ErrInvalidAPIKey):
+			writeError(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		case errors.Is(id.err, service.ErrInvalidToken):
+			writeError(w, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		case errors.Is(id.err, service.ErrInvalidDeviceToken):
+			writeError(w, "Invalid device token", http.StatusUnauthorized)
+			return
+		case id.err != nil:
+			logging.From(r.Context()).Error("API key lookup failed", "error", id.err)
+			writeError(w, "Failed to authenticate", http.StatusInternalServerError)
+			return
+		}
+
+		if !allowed(id.key, r) {
+			writeError(w, denied, http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (a *Auth) authenticate(secret string) (*domain.APIKey, error) {
+	// The bootstrap admin key from config is allowed everything so the first
+	// real keys can be provisioned
+	if a.adminKey != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(a.adminKey)) == 1 {
+		return &domain.APIKey{
+			ID:     "admin",
+			Name:   "bootstrap admin key",
+			Scopes: domain.AllScopes,
+		}, nil
+	}
+
+	return a.keys.Authenticate(secret)
+}
+
+// APIKeyFromContext returns the key that authenticated the request, if any.
+// For a signed-in user it is a key with the scopes of their role.
+func APIKeyFromContext(ctx context.Context) (*domain.APIKey, bool) {
+	id, ok := ctx.Value(identityContextKey).(*identity)
+	if !ok || id.key == nil {
+		return nil, false
+	}
+	return id.key, true
+}
+
+func extractAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	// EventSource cannot set headers, so SSE clients pass the key in the URL
+	return r.URL.Query().Get("api_key")
+}
+
+// writeStepUpRequired refuses a destructive action until the user steps up
+func writeStepUpRequired(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":          false,
+		"error":            message,
+		"step_up_required": true,
+	})
+}
+
+func writeError(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   message,
+	})
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/service"
+)
+
+// Destructive routes ask signed-in users for a step-up with their security
+// key, but not API keys, which belong to machines that have none
+func TestRequireStepUp(t *testing.T) {
+	db, err := service.OpenDatabase(filepath.Join(t.TempDir(), "attendance.db"), time.Local, config.DatabaseConfig{WritePoolSize: 1, BusyTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	authCfg := config.AuthConfig{
+		Enabled:         true,
+		JWTSecret:       "0123456789abcdef0123456789abcdef",
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}
+	keys, err := service.NewAPIKeyService(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := service.NewUserService(db, authCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := users.Create("alice", "correct-horse", domain.RoleAdmin, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, tokens, err := users.Login("alice", "correct-horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, apiKey, err := keys.Create("door sync", "", "", []string{domain.ScopeFacesAdmin}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remove := func(auth *Auth, key, stepUp string) int {
+		t.Helper()
+		route := auth.RequireStepUp(domain.ScopeFacesAdmin, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/faces/bob", nil)
+		req.Header.Set("X-API-Key", key)
+		if stepUp != "" {
+			req.Header.Set("X-Step-Up", stepUp)
+		}
+		rec := httptest.NewRecorder()
+		route(rec, req)
+		return rec.Code
+	}
+
+	webAuthn, err := service.NewWebAuthnService(db, config.WebAuthnConfig{RPID: "attendance.example.com", StepUpTTL: 5 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := NewAuth(keys, users, nil, webAuthn, authCfg)
+
+	if code := remove(auth, tokens.AccessToken, ""); code != http.StatusForbidden {
+		t.Errorf("user without a security key: status %d, want %d", code, http.StatusForbidden)
+	}
+	if _, err := db.Exec("INSERT INTO webauthn_credentials (id, user_id, name, credential, created_at) VALUES (?, ?, ?, ?, ?)",
+		"key-1", user.ID, "YubiKey", "{}", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if code := remove(auth, tokens.AccessToken, ""); code != http.StatusForbidden {
+		t.Errorf("user without a step-up: status %d, want %d", code, http.StatusForbidden)
+	}
+	if code := remove(auth, tokens.AccessToken, "forged-step-up"); code != http.StatusForbidden {
+		t.Errorf("user with an unknown step-up token: status %d, want %d", code, http.StatusForbidden)
+	}
+	if code := remove(auth, apiKey, ""); code != http.StatusNoContent {
+		t.Errorf("API key: status %d, want %d", code, http.StatusNoContent)
+	}
+
+	// Without WebAuthn configured there is nothing to step up with
+	disabled, err := service.NewWebAuthnService(db, config.WebAuthnConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := remove(NewAuth(keys, users, nil, disabled, authCfg), tokens.AccessToken, ""); code != http.StatusNoContent {
+		t.Errorf("user without WebAuthn configured: status %d, want %d", code, http.StatusNoContent)
+	}
+}
@@ -0,0 +1,304 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"attendance-api/internal/config"
+)
+
+// API versions a client may ask for with the X-API-Version header. Version
+// 1 is the current shape of the /api/v1 responses; 1.0 is the shape of the
+// first release, which kiosk firmware in the field still parses, often into
+// fixed-size buffers that the fields added since would overflow.
+const (
+	APIVersionCurrent = "1"
+	APIVersionLegacy  = "1.0"
+)
+
+// A shape is the set of fields a JSON object had in an API version. Fields
+// added since are dropped.
+type shape map[string]field
+
+type field struct {
+	// from is the current name of a field that has been renamed since
+	from string
+	// shape, when set, applies to the field's object, or to every element
+	// of its array
+	shape shape
+}
+
+var legacyRecordShape = shape{
+	"id":         {},
+	"name":       {},
+	"confidence": {},
+	"timestamp":  {},
+	"status":     {},
+}
+
+// legacyShapes are the 1.0 shapes of the responses kiosks use, by route
+var legacyShapes = map[string]shape{
+	"POST /api/v1/attendance": {
+		"success":    {},
+		"error":      {},
+		"authorized": {},
+		"name":       {},
+		"confidence": {},
+		"message":    {},
+		"action":     {},
+	},
+	"GET /api/v1/attendance/recent": {
+		"success": {},
+		"error":   {},
+		"count":   {},
+		"records": {shape: legacyRecordShape},
+	},
+	"GET /api/v1/attendance/stats": {
+		"success": {},
+		"error":   {},
+		"stats": {shape: shape{
+			"total":         {},
+			"authorized":    {},
+			"unauthorized":  {},
+			"unique_people": {},
+		}},
+	},
+	"GET /api/v1/faces": {
+		"success": {},
+		"error":   {},
+		"count":   {},
+		"faces":   {shape: shape{"name": {}, "images": {}}},
+	},
+}
+
+// legacyStreamRoute is the event stream; 1.0 clients only get the events of
+// the first release, with their 1.0 payloads
+const legacyStreamRoute = "GET /api/v1/attendance/stream"
+
+var legacyEvents = map[string]shape{
+	"connected":  nil,
+	"attendance": legacyRecordShape,
+}
+
+// Compat serves old kiosk firmware the response shapes it was built
+// against, so the API can keep adding and renaming fields. Clients choose
+// with X-API-Version; firmware that cannot send headers is recognized by
+// its User-Agent.
+type Compat struct {
+	userAgents []string
+}
+
+func NewCompat(cfg config.ServerConfig) *Compat {
+	return &Compat{userAgents: cfg.LegacyUserAgents}
+}
+
+// version returns the API version the request is answered in, or false
+// when it asked for one that does not exist
+func (c *Compat) version(r *http.Request) (string, bool) {
+	if v := r.Header.Get("X-API-Version"); v != "" {
+		return v, v == APIVersionCurrent || v == APIVersionLegacy
+	}
+
+	userAgent := r.UserAgent()
+	for _, prefix := range c.userAgents {
+		if strings.HasPrefix(userAgent, prefix) {
+			return APIVersionLegacy, true
+		}
+	}
+	return APIVersionCurrent, true
+}
+
+// Translate rewrites the responses of 1.0 clients to the 1.0 shapes. It must
+// run after the legacy paths are rewritten. Signed responses are left alone,
+// since the signature covers the body as sent; firmware that checks it is
+// newer than 1.0.
+func (c *Compat) Translate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version, ok := c.version(r)
+		if !ok {
+			message := fmt.Sprintf("Unsupported X-API-Version %q, expected %s or %s", version, APIVersionCurrent, APIVersionLegacy)
+			writeError(w, message, http.StatusBadRequest)
+			return
+		}
+		if version != APIVersionCurrent || r.Header.Get("X-API-Version") != "" {
+			w.Header().Set("X-API-Version", version)
+		}
+		if version == APIVersionCurrent {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := r.Method + " " + r.URL.Path
+		if route == legacyStreamRoute {
+			stream := &eventTranslator{ResponseWriter: w}
+			next.ServeHTTP(stream, r)
+			return
+		}
+
+		s, ok := legacyShapes[route]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buffered := &bufferedResponse{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(buffered, r)
+		buffered.finish(s)
+	})
+}
+
+// apply drops the fields of value that are not part of s and renames the
+// ones that are
+func (s shape) apply(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		for i, element := range v {
+			v[i] = s.apply(element)
+		}
+		return v
+	case map[string]interface{}:
+		shaped := make(map[string]interface{}, len(s))
+		for name, f := range s {
+			from := name
+			if f.from != "" {
+				from = f.from
+			}
+			fieldValue, ok := v[from]
+			if !ok {
+				continue
+			}
+			if f.shape != nil {
+				fieldValue = f.shape.apply(fieldValue)
+			}
+			shaped[name] = fieldValue
+		}
+		return shaped
+	default:
+		return value
+	}
+}
+
+func reshape(s shape, body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(s.apply(value)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// bufferedResponse holds a JSON response back until it is complete, so it
+// can be reshaped
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	b.status = code
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) finish(s shape) {
+	body := b.body.Bytes()
+	header := b.ResponseWriter.Header()
+	if strings.HasPrefix(header.Get("Content-Type"), "application/json") && header.Get("X-Signature") == "" {
+		if shaped, err := reshape(s, body); err == nil {
+			body = shaped
+		}
+	}
+
+	header.Del("Content-Length")
+	b.ResponseWriter.WriteHeader(b.status)
+	b.ResponseWriter.Write(body)
+}
+
+// eventTranslator reshapes server-sent events as they are written, and
+// drops events 1.0 clients do not know
+type eventTranslator struct {
+	http.ResponseWriter
+	pending []byte
+}
+
+func (e *eventTranslator) Write(p []byte) (int, error) {
+	e.pending = append(e.pending, p...)
+	for {
+		end := bytes.Index(e.pending, []byte("\n\n"))
+		if end < 0 {
+			return len(p), nil
+		}
+		frame := e.pending[:end+2]
+		if translated := translateEvent(frame); len(translated) > 0 {
+			if _, err := e.ResponseWriter.Write(translated); err != nil {
+				return 0, err
+			}
+		}
+		e.pending = e.pending[end+2:]
+	}
+}
+
+func (e *eventTranslator) Flush() {
+	if flusher, ok := e.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// FlushError and Unwrap keep http.ResponseController working on the stream
+func (e *eventTranslator) FlushError() error {
+	return http.NewResponseController(e.ResponseWriter).Flush()
+}
+
+func (e *eventTranslator) Unwrap() http.ResponseWriter {
+	return e.ResponseWriter
+}
+
+// translateEvent returns an event frame in its 1.0 shape, or nothing for
+// events that did not exist in 1.0. Comments, such as heartbeats, pass.
+func translateEvent(frame []byte) []byte {
+	lines := strings.Split(strings.TrimSuffix(string(frame), "\n\n"), "\n")
+	if strings.HasPrefix(lines[0], ":") {
+		return frame
+	}
+
+	event := "message"
+	for _, line := range lines {
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			event = name
+		}
+	}
+	s, known := legacyEvents[event]
+	if !known {
+		return nil
+	}
+	if s == nil {
+		return frame
+	}
+
+	for i, line := range lines {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		shaped, err := reshape(s, []byte(data))
+		if err != nil {
+			continue
+		}
+		lines[i] = "data: " + strings.TrimSuffix(string(shaped), "\n")
+	}
+	return []byte(strings.Join(lines, "\n") + "\n\n")
+}
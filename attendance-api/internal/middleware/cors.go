@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"attendance-api/internal/config"
+)
+
+// exposedHeaders are the response headers browsers may read: the API
+// versioning headers, the rate limit's Retry-After and the request ID
+const exposedHeaders = "Deprecation, Link, Sunset, Retry-After, X-Request-ID"
+
+// CORS answers preflight requests and grants configured browser origins
+// access to the API
+type CORS struct {
+	policy atomic.Pointer[corsPolicy]
+}
+
+// corsPolicy is the CORS configuration, parsed
+type corsPolicy struct {
+	anyOrigin   bool
+	origins     []string
+	subdomains  []originPattern
+	methods     string
+	headers     string
+	credentials bool
+}
+
+// originPattern matches "scheme://*.domain" origins
+type originPattern struct {
+	scheme string
+	suffix string // ".domain"
+}
+
+func NewCORS(cfg config.CORSConfig) (*CORS, error) {
+	policy, err := parseCORS(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c := &CORS{}
+	c.policy.Store(policy)
+	return c, nil
+}
+
+// Reconfigure replaces the policy for the requests still to come, or keeps
+// it when cfg is invalid
+func (c *CORS) Reconfigure(cfg config.CORSConfig) error {
+	policy, err := parseCORS(cfg)
+	if err != nil {
+		return err
+	}
+	c.policy.Store(policy)
+	return nil
+}
+
+func parseCORS(cfg config.CORSConfig) (*corsPolicy, error) {
+	c := &corsPolicy{
+		methods:     strings.Join(cfg.AllowedMethods, ", "),
+		headers:     strings.Join(cfg.AllowedHeaders, ", "),
+		credentials: cfg.AllowCredentials,
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			c.anyOrigin = true
+			continue
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			return nil, fmt.Errorf("invalid CORS origin %q, expected scheme://host[:port]", origin)
+		}
+		if rest, ok := strings.CutPrefix(u.Host, "*."); ok {
+			c.subdomains = append(c.subdomains, originPattern{scheme: u.Scheme, suffix: "." + strings.ToLower(rest)})
+			continue
+		}
+		c.origins = append(c.origins, strings.ToLower(origin))
+	}
+
+	// Browsers refuse credentials with a wildcard origin, and echoing any
+	// origin instead would hand every site the user's session
+	if c.anyOrigin && c.credentials {
+		return nil, fmt.Errorf("CORS credentials cannot be allowed for any origin, list the origins instead")
+	}
+	return c, nil
+}
+
+// Allowed reports whether a browser origin may call the API
+func (c *CORS) Allowed(origin string) bool {
+	return c.policy.Load().allowed(origin)
+}
+
+func (c *corsPolicy) allowed(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if slices.Contains(c.origins, origin) {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range c.subdomains {
+		if u.Scheme == pattern.scheme && strings.HasSuffix(u.Host, pattern.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle sets the CORS headers for allowed origins and answers their
+// preflight requests. Requests from other origins get no CORS headers, so
+// browsers block them; their preflights are refused.
+func (c *CORS) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := c.policy.Load()
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		// The answer depends on the origin unless every origin gets "*"
+		if !policy.anyOrigin || policy.credentials {
+			w.Header().Add("Vary", "Origin")
+		}
+
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !policy.allowed(origin) {
+			if preflight {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if policy.anyOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if policy.credentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+
+		if preflight {
+			w.Header().Set("Access-Control-Allow-Methods", policy.methods)
+			w.Header().Set("Access-Control-Allow-Headers", policy.headers)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// String describes the policy for the log
+func (c *CORS) String() string {
+	return c.policy.Load().String()
+}
+
+func (c *corsPolicy) String() string {
+	origins := slices.Clone(c.origins)
+	for _, pattern := range c.subdomains {
+		origins = append(origins, pattern.scheme+"://*"+pattern.suffix)
+	}
+	if c.anyOrigin {
+		origins = append(origins, "*")
+	}
+
+	policy := strings.Join(origins, ", ")
+	if policy == "" {
+		policy = "no origins"
+	}
+	if c.credentials {
+		policy += " with credentials"
+	}
+	return policy
+}
@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RateLimiter throttles requests with a token bucket per API key or
+// signed-in user, and per client IP for requests carrying neither, so one
+// flooding client cannot starve the face service for everyone else
+type RateLimiter struct {
+	rps   float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	last    time.Time
+	limited bool // rejected since it last had a token, to log only once
+}
+
+func NewRateLimiter(cfg config.RateLimitConfig) *RateLimiter {
+	burst := cfg.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rps:       cfg.RPS,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Enabled reports whether requests are limited at all
+func (l *RateLimiter) Enabled() bool {
+	return l.rps > 0
+}
+
+// Limit answers 429 with a Retry-After header to /api/ requests whose
+// bucket is empty. It must run after Identify, which resolves the key.
+func (l *RateLimiter) Limit(next http.Handler) http.Handler {
+	if !l.Enabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+
+		if ok, wait := l.allow(bucketKey(r.Context(), host), time.Now()); !ok {
+			w.Header().Set("Retry-After", retryAfter(wait))
+			writeError(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UnaryLimit is Limit for gRPC calls, answering ResourceExhausted with a
+// retry-after header. It must run after UnaryScopes, which resolves the key.
+func (l *RateLimiter) UnaryLimit() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !l.Enabled() {
+			return handler(ctx, req)
+		}
+
+		host := ""
+		if p, ok := peer.FromContext(ctx); ok {
+			host = p.Addr.String()
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+		}
+
+		if ok, wait := l.allow(bucketKey(ctx, host), time.Now()); !ok {
+			grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter(wait)))
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// bucketKey is the key, user or device of the request, or its client IP
+func bucketKey(ctx context.Context, host string) string {
+	actor := domain.ActorFromContext(ctx)
+	switch actor.Type {
+	case domain.ActorAPIKey, domain.ActorUser, domain.ActorDevice:
+		return actor.Type + ":" + actor.ID
+	default:
+		return "ip:" + host
+	}
+}
+
+// allow takes a token from the bucket of key. When it is empty it returns
+// false with the time until the next token.
+func (l *RateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rps)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.limited = false
+		return true, 0
+	}
+
+	if !b.limited {
+		b.limited = true
+		slog.Warn("Rate limit exceeded", "component", "ratelimit", "key", key, "rps", l.rps, "burst", l.burst)
+	}
+	return false, time.Duration((1 - b.tokens) / l.rps * float64(time.Second))
+}
+
+// sweep drops the buckets that have been idle long enough to be full again,
+// at most once a minute, so clients that went away are forgotten
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	refill := time.Duration(l.burst / l.rps * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > refill {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// retryAfter renders a wait as whole seconds, at least one
+func retryAfter(wait time.Duration) string {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
+}
+
+// String describes the limit for the startup log
+func (l *RateLimiter) String() string {
+	return fmt.Sprintf("%g requests/s, burst %g", l.rps, l.burst)
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"attendance-api/internal/domain"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDHeader carries the ID of a request, both ways
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the IDs callers may choose, which end up in
+// every log line of their request
+const maxRequestIDLength = 128
+
+// RequestID gives every request an ID, the X-Request-ID of the caller when
+// it sent a usable one. The ID is returned in the response, logged and sent
+// on to the face service, so a failed door open can be followed across both.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestID(r.Header.Get(RequestIDHeader))
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(domain.WithRequestID(r.Context(), id)))
+	})
+}
+
+// UnaryRequestID is RequestID for gRPC calls, using the x-request-id
+// metadata key
+func UnaryRequestID() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(callRequestID(ctx), req)
+	}
+}
+
+// StreamRequestID is UnaryRequestID for streaming methods
+func StreamRequestID() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &identifiedStream{ServerStream: ss, ctx: callRequestID(ss.Context())})
+	}
+}
+
+func callRequestID(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	id := requestID(firstValue(md, "x-request-id"))
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+	return domain.WithRequestID(ctx, id)
+}
+
+// requestID returns the ID a caller sent, or a new one when it sent none or
+// one that is too long or not printable ASCII
+func requestID(sent string) string {
+	if sent == "" || len(sent) > maxRequestIDLength {
+		return uuid.New().String()
+	}
+	for _, c := range sent {
+		if c < '!' || c > '~' {
+			return uuid.New().String()
+		}
+	}
+	return sent
+}
@@ -0,0 +1,114 @@
+// Package reporting sends errors to Sentry, or any service that speaks its
+// protocol, with the fields of the request they happened in, so a failing
+// face service or database is noticed without reading the logs.
+package reporting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"attendance-api/internal/config"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// maxTagLength is the longest value Sentry accepts as a tag; longer fields,
+// such as a panic's stack, are sent as extra data instead
+const maxTagLength = 200
+
+// Setup starts reporting to the project of cfg. Nothing is reported when no
+// DSN is configured.
+func Setup(cfg config.ErrorReportingConfig) error {
+	if cfg.DSN == "" {
+		return nil
+	}
+
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:              cfg.DSN,
+		Environment:      cfg.Environment,
+		SampleRate:       cfg.SampleRate,
+		AttachStacktrace: true,
+	})
+	if err != nil {
+		return fmt.Errorf("invalid SENTRY_DSN: %w", err)
+	}
+	return nil
+}
+
+// Flush waits up to timeout for queued events to be sent, before the
+// process exits
+func Flush(timeout time.Duration) {
+	sentry.Flush(timeout)
+}
+
+// Handler passes log records on to next and reports those at error level.
+// The fields of the logger, such as the request ID, actor and trace ID set
+// by logging.With, become tags of the event, and an error field its
+// exception.
+func Handler(next slog.Handler) slog.Handler {
+	return &handler{next: next}
+}
+
+type handler struct {
+	next  slog.Handler
+	attrs []slog.Attr
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= slog.LevelError && sentry.CurrentHub().Client() != nil {
+		report(record, h.attrs)
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handler{next: h.next.WithAttrs(attrs), attrs: append(slices.Clip(h.attrs), attrs...)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{next: h.next.WithGroup(name), attrs: h.attrs}
+}
+
+func report(record slog.Record, attrs []slog.Attr) {
+	var (
+		err   error
+		tags  = map[string]string{}
+		extra = map[string]interface{}{}
+	)
+	add := func(attr slog.Attr) bool {
+		if e, ok := attr.Value.Any().(error); ok && err == nil {
+			err = e
+			return true
+		}
+		value := attr.Value.String()
+		if len(value) > maxTagLength {
+			extra[attr.Key] = value
+		} else {
+			tags[attr.Key] = value
+		}
+		return true
+	}
+	for _, attr := range attrs {
+		add(attr)
+	}
+	record.Attrs(add)
+	if err == nil {
+		err = errors.New(record.Message)
+	}
+
+	hub := sentry.CurrentHub()
+	event := hub.Client().EventFromException(err, sentry.LevelError)
+	event.Message = record.Message
+	event.Timestamp = record.Time
+	event.Tags = tags
+	event.Extra = extra
+	hub.CaptureEvent(event)
+}
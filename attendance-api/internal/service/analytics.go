@@ -0,0 +1,206 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+)
+
+// Rolling windows reported by GetRollingAttendance, in days
+const (
+	shortWindow = 7
+	longWindow  = 30
+)
+
+// AnalyticsService computes trend figures for the HR dashboard. Results are
+// expensive to produce and change slowly, so they are cached for CacheTTL.
+type AnalyticsService struct {
+	db       *sql.DB
+	calendar *CalendarService
+	loc      *time.Location // zone of the site, in which days begin and end
+	cfg      config.AnalyticsConfig
+
+	cacheMu sync.Mutex
+	cache   map[string]analyticsCacheEntry
+}
+
+type analyticsCacheEntry struct {
+	result  *domain.RollingAttendance
+	expires time.Time
+}
+
+func NewAnalyticsService(db *sql.DB, calendar *CalendarService, loc *time.Location, cfg config.AnalyticsConfig) *AnalyticsService {
+	return &AnalyticsService{
+		db:       db,
+		calendar: calendar,
+		loc:      loc,
+		cfg:      cfg,
+		cache:    make(map[string]analyticsCacheEntry),
+	}
+}
+
+// GetRollingAttendance returns, for every person seen in the period, the
+// share of workdays present in the trailing 7 and 30 days, and the share of
+// those days that started late, for each day between from and to
+// (inclusive, YYYY-MM-DD). Weekends and holidays are left out of both sides
+// of the ratio. An empty name and filter include everybody.
+func (s *AnalyticsService) GetRollingAttendance(from, to, name string, filter domain.GroupFilter) (*domain.RollingAttendance, error) {
+	key := strings.Join([]string{"rolling", from, to, name, filter.Department, filter.Group}, "|")
+	if result := s.cached(key); result != nil {
+		return result, nil
+	}
+
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from date: %w", err)
+	}
+	end, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to date: %w", err)
+	}
+	// The first reported day needs a full long window behind it
+	gridStart := start.AddDate(0, 0, -(longWindow - 1)).Format("2006-01-02")
+	// and the records are those of its days in the zone of the site
+	since := time.Date(start.Year(), start.Month(), start.Day()-(longWindow-1), 0, 0, 0, 0, s.loc)
+	until := time.Date(end.Year(), end.Month(), end.Day()+1, 0, 0, 0, 0, s.loc)
+
+	where, whereArgs := groupClause(filter)
+
+	// Timestamps are stored in UTC, local_date gives the calendar day of the
+	// recognition in the zone of the site
+	query := `
+		WITH RECURSIVE days(day) AS (
+			SELECT ?
+			UNION ALL
+			SELECT date(day, '+1 day') FROM days WHERE day < ?
+		),
+		calendar AS (
+			SELECT day, ` + s.calendar.workdaySQL("day") + ` AS workday FROM days
+		),
+		present AS (
+			SELECT name, local_date(timestamp) AS day, MAX(late) AS late
+			FROM attendance
+			WHERE status = 'authorized'
+			  AND timestamp >= ? AND timestamp < ?
+			  AND (? = '' OR name = ?)
+			  AND ` + where + `
+			GROUP BY name, day
+		),
+		seen AS (
+			SELECT DISTINCT name FROM present
+		),
+		grid AS (
+			SELECT seen.name, calendar.day, calendar.workday,
+			       CASE WHEN present.name IS NULL THEN 0 ELSE 1 END AS present,
+			       COALESCE(present.late, 0) * calendar.workday AS late
+			FROM seen
+			CROSS JOIN calendar
+			LEFT JOIN present ON present.name = seen.name AND present.day = calendar.day
+		),
+		rolling AS (
+			SELECT name, day, workday, present,
+			       SUM(workday) OVER (PARTITION BY name ORDER BY day ROWS BETWEEN 6 PRECEDING AND CURRENT ROW) AS short_workdays,
+			       SUM(workday) OVER (PARTITION BY name ORDER BY day ROWS BETWEEN 29 PRECEDING AND CURRENT ROW) AS long_workdays,
+			       SUM(present * workday) OVER (PARTITION BY name ORDER BY day ROWS BETWEEN 6 PRECEDING AND CURRENT ROW) AS short_days,
+			       SUM(present * workday) OVER (PARTITION BY name ORDER BY day ROWS BETWEEN 29 PRECEDING AND CURRENT ROW) AS long_days,
+			       SUM(late) OVER (PARTITION BY name ORDER BY day ROWS BETWEEN 6 PRECEDING AND CURRENT ROW) AS short_late,
+			       SUM(late) OVER (PARTITION BY name ORDER BY day ROWS BETWEEN 29 PRECEDING AND CURRENT ROW) AS long_late
+			FROM grid
+		)
+		SELECT name, day, workday, present, short_workdays, long_workdays, short_days, long_days, short_late, long_late
+		FROM rolling
+		WHERE day >= ?
+		ORDER BY name, day
+	`
+
+	args := []interface{}{gridStart, to, since, until, name, name}
+	args = append(args, whereArgs...)
+	args = append(args, from)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rolling attendance: %w", err)
+	}
+	defer rows.Close()
+
+	result := &domain.RollingAttendance{
+		From:        from,
+		To:          to,
+		Series:      []domain.RollingSeries{},
+		GeneratedAt: time.Now().In(s.loc),
+	}
+
+	for rows.Next() {
+		var (
+			person                      string
+			point                       domain.RollingPoint
+			shortWorkdays, longWorkdays int
+			shortDays, longDays         int
+			shortLate, longLate         int
+		)
+		err := rows.Scan(&person, &point.Date, &point.Workday, &point.Present,
+			&shortWorkdays, &longWorkdays, &shortDays, &longDays, &shortLate, &longLate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan rolling attendance: %w", err)
+		}
+		point.AttendanceRate7d = rate(shortDays, shortWorkdays)
+		point.AttendanceRate30d = rate(longDays, longWorkdays)
+		point.LatePercent7d = rate(shortLate, shortDays)
+		point.LatePercent30d = rate(longLate, longDays)
+
+		if n := len(result.Series); n == 0 || result.Series[n-1].Name != person {
+			result.Series = append(result.Series, domain.RollingSeries{Name: person})
+		}
+		series := &result.Series[len(result.Series)-1]
+		series.Points = append(series.Points, point)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	s.store(key, result)
+	return result, nil
+}
+
+func (s *AnalyticsService) cached(key string) *domain.RollingAttendance {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	entry, ok := s.cache[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil
+	}
+	return entry.result
+}
+
+func (s *AnalyticsService) store(key string, result *domain.RollingAttendance) {
+	if s.cfg.CacheTTL <= 0 {
+		return
+	}
+
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	now := time.Now()
+	for k, entry := range s.cache {
+		if now.After(entry.expires) {
+			delete(s.cache, k)
+		}
+	}
+	s.cache[key] = analyticsCacheEntry{result: result, expires: now.Add(s.cfg.CacheTTL)}
+}
+
+// rate returns part/whole as a percentage rounded to two decimals
+func rate(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(whole)*10000) / 100
+}
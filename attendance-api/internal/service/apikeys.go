@@ -0,0 +1,356 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidAPIKey  = errors.New("invalid, expired or revoked api key")
+	ErrInvalidScope   = errors.New("unknown scope")
+	ErrPersonRequired = errors.New("the attendance:self scope needs a person")
+)
+
+// lastUsedGranularity limits how often last_used_at is written for a busy key
+const lastUsedGranularity = time.Minute
+
+// scopeVersion is the version of the scope set keys are created under.
+// Version 1 split raw records and snapshots off reports:read and
+// faces:admin.
+const scopeVersion = 1
+
+type APIKeyService struct {
+	db *sql.DB
+
+	logger *slog.Logger
+}
+
+func NewAPIKeyService(db *sql.DB) (*APIKeyService, error) {
+	service := &APIKeyService{db: db, logger: logging.Component("apikeys")}
+
+	if err := service.initSchema(); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	return service, nil
+}
+
+func (s *APIKeyService) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		prefix TEXT NOT NULL,
+		scopes TEXT NOT NULL,
+		expires_at DATETIME,
+		last_used_at DATETIME,
+		revoked_at DATETIME,
+		created_at DATETIME NOT NULL
+	);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+
+	if err := ensureColumn(s.db, "api_keys", "tenant", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := ensureColumn(s.db, "api_keys", "person", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := ensureColumn(s.db, "api_keys", "scope_version", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	return s.upgradeScopes()
+}
+
+// upgradeScopes keeps keys created before records:read and snapshots:read
+// existed working as before: reports:read keys may still read raw records
+// and faces:admin keys may still see snapshots until their scopes are
+// narrowed.
+func (s *APIKeyService) upgradeScopes() error {
+	rows, err := s.db.Query("SELECT id, scopes FROM api_keys WHERE scope_version < 1")
+	if err != nil {
+		return fmt.Errorf("failed to query api keys: %w", err)
+	}
+
+	upgraded := make(map[string]string)
+	for rows.Next() {
+		var id, scopes string
+		if err := rows.Scan(&id, &scopes); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan api key: %w", err)
+		}
+
+		list := strings.Split(scopes, ",")
+		if slices.Contains(list, domain.ScopeReportsRead) && !slices.Contains(list, domain.ScopeRecordsRead) {
+			list = append(list, domain.ScopeRecordsRead)
+		}
+		if slices.Contains(list, domain.ScopeFacesAdmin) && !slices.Contains(list, domain.ScopeSnapshotsRead) {
+			list = append(list, domain.ScopeSnapshotsRead)
+		}
+		upgraded[id] = strings.Join(list, ",")
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query api keys: %w", err)
+	}
+
+	for id, scopes := range upgraded {
+		if _, err := s.db.Exec("UPDATE api_keys SET scopes = ?, scope_version = ? WHERE id = ?", scopes, scopeVersion, id); err != nil {
+			return fmt.Errorf("failed to upgrade api key scopes: %w", err)
+		}
+	}
+	if len(upgraded) > 0 {
+		s.logger.Info("Carried existing keys over to the records:read and snapshots:read scopes", "keys", len(upgraded))
+	}
+	return nil
+}
+
+// Create provisions a new key and returns it together with the plaintext
+// secret, which is not stored and cannot be retrieved again. The tenant is
+// recorded on everything done with the key; the person is the only one an
+// attendance:self key may see.
+func (s *APIKeyService) Create(name, tenant, person string, scopes []string, expiresAt *time.Time) (*domain.APIKey, string, error) {
+	if err := validateScopes(scopes, person); err != nil {
+		return nil, "", err
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	secret := "ak_" + hex.EncodeToString(raw)
+
+	key := &domain.APIKey{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Prefix:    secret[:10],
+		Tenant:    tenant,
+		Person:    person,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	query := `
+		INSERT INTO api_keys (id, name, key_hash, prefix, tenant, person, scopes, scope_version, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := s.db.Exec(query, key.ID, key.Name, hashAPIKey(secret), key.Prefix, key.Tenant, key.Person,
+		strings.Join(key.Scopes, ","), scopeVersion, key.ExpiresAt, key.CreatedAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to insert api key: %w", err)
+	}
+
+	return key, secret, nil
+}
+
+func (s *APIKeyService) List() ([]domain.APIKey, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, prefix, tenant, person, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM api_keys
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []domain.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (s *APIKeyService) Get(id string) (*domain.APIKey, error) {
+	row := s.db.QueryRow(`
+		SELECT id, name, prefix, tenant, person, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM api_keys
+		WHERE id = ?
+	`, id)
+
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+// Update changes the name, tenant, person, scopes or expiry of a key. Nil
+// arguments are left untouched; an expiry pointing at the zero time clears it.
+func (s *APIKeyService) Update(id string, name, tenant, person *string, scopes []string, expiresAt *time.Time) (*domain.APIKey, error) {
+	key, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if name != nil {
+		key.Name = *name
+	}
+	if tenant != nil {
+		key.Tenant = *tenant
+	}
+	if person != nil {
+		key.Person = *person
+	}
+	if scopes != nil {
+		key.Scopes = scopes
+	}
+	if err := validateScopes(key.Scopes, key.Person); err != nil {
+		return nil, err
+	}
+	if expiresAt != nil {
+		if expiresAt.IsZero() {
+			key.ExpiresAt = nil
+		} else {
+			key.ExpiresAt = expiresAt
+		}
+	}
+
+	_, err = s.db.Exec("UPDATE api_keys SET name = ?, tenant = ?, person = ?, scopes = ?, expires_at = ? WHERE id = ?",
+		key.Name, key.Tenant, key.Person, strings.Join(key.Scopes, ","), key.ExpiresAt, key.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update api key: %w", err)
+	}
+
+	return key, nil
+}
+
+// Revoke disables a key immediately; subsequent requests using it fail
+func (s *APIKeyService) Revoke(id string) error {
+	result, err := s.db.Exec("UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := s.Get(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Authenticate resolves a plaintext key to an active API key and records
+// that it was used.
+func (s *APIKeyService) Authenticate(secret string) (*domain.APIKey, error) {
+	row := s.db.QueryRow(`
+		SELECT id, name, prefix, tenant, person, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM api_keys
+		WHERE key_hash = ?
+	`, hashAPIKey(secret))
+
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedGranularity {
+		if _, err := s.db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", now, key.ID); err != nil {
+			return nil, fmt.Errorf("failed to update last used: %w", err)
+		}
+		key.LastUsedAt = &now
+	}
+
+	return key, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row rowScanner) (*domain.APIKey, error) {
+	var (
+		key                            domain.APIKey
+		scopes                         string
+		expiresAt, lastUsed, revokedAt sql.NullTime
+	)
+
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.Tenant, &key.Person, &scopes, &expiresAt, &lastUsed, &revokedAt, &key.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan api key: %w", err)
+	}
+
+	key.Scopes = []string{}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsed.Valid {
+		key.LastUsedAt = &lastUsed.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+
+	return &key, nil
+}
+
+func validateScopes(scopes []string, person string) error {
+	for _, scope := range scopes {
+		if scope == domain.ScopeAttendanceSelf && person == "" {
+			return ErrPersonRequired
+		}
+
+		known := false
+		for _, s := range domain.AllScopes {
+			if scope == s {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+	return nil
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -3,71 +3,165 @@ package service
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"errors"
 	"fmt"
-	"log"
-	"os"
-	"path/filepath"
+	"log/slog"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"attendance-api/internal/client"
+	"attendance-api/internal/config"
 	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+	"attendance-api/internal/tracing"
 
 	"github.com/google/uuid"
-	_ "github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-type SSEClient struct {
-	id      string
-	channel chan domain.SSEMessage
-	active  bool
-}
+var (
+	ErrInvalidCursor      = errors.New("invalid page cursor")
+	ErrDuplicateReference = errors.New("external reference already recorded")
+	ErrTooManyStreams     = errors.New("too many event stream clients")
+)
+
+// Policies for event stream clients too slow to take their events
+const (
+	SlowClientDropNewest = "drop_newest"
+	SlowClientDropOldest = "drop_oldest"
+	SlowClientDisconnect = "disconnect"
+)
 
 type AttendanceService struct {
-	faceClient *client.FaceRecognitionClient
+	faceClient client.Recognizer
 	db         *sql.DB
+	reads      *sql.DB // read-only pool for report and query endpoints
+	calendar   *CalendarService
+	snapshots  *SnapshotService
+	experiment *ExperimentService
+	siem       *SIEMExporter
+	webhooks   *WebhookService
+	building   *BuildingBridge
+	bus        *EventBus
+	bridge     *StreamBridge
+	cfg        config.AttendanceConfig
+	thresholds atomic.Pointer[thresholds] // of cfg, changed by Reconfigure
+	newID      IDGenerator
 	mu         sync.RWMutex
 	clients    map[string]*SSEClient
-	ctx        context.Context
-	cancel     context.CancelFunc
+	events     eventRing // latest broadcast events, for replay
+	lastEvent  uint64    // ID of the latest broadcast event
+
+	// Broadcast events waiting for fanOut, and what reached the clients
+	fanOutQueue  chan domain.SSEMessage
+	streamTotals streamTotals
+
+	// Set by events that change the stats, until stats_updated is sent
+	statsChanged atomic.Bool
+
+	// Last recorded recognition per person, for the cooldown window
+	cooldownMu sync.Mutex
+	lastSeen   map[string]time.Time
+
+	// Door of each grouped device, and the last record per door and person
+	doors         map[string]string
+	doorsMu       sync.Mutex
+	doorSightings map[string]*doorSighting
+
+	tagRules []tagRule
+
+	metrics *recognitionMetrics
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	logger *slog.Logger
 }
 
-func NewAttendanceService(faceClient *client.FaceRecognitionClient, dbPath string) (*AttendanceService, error) {
-	// Ensure directory exists
-	dir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create directory: %w", err)
+func NewAttendanceService(faceClient client.Recognizer, db, reads *sql.DB, calendar *CalendarService, snapshots *SnapshotService, experiment *ExperimentService, siem *SIEMExporter, webhooks *WebhookService, building *BuildingBridge, bus *EventBus, bridge *StreamBridge, cfg config.AttendanceConfig) (*AttendanceService, error) {
+	newID, err := NewIDGenerator(cfg.IDFormat)
+	if err != nil {
+		return nil, err
 	}
 
-	// Open database
-	db, err := sql.Open("sqlite3", dbPath)
+	doors, err := parseDoors(cfg.Doors)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
-
-	// Test connection
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	tagRules, err := parseTagRules(cfg.TagRules)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.StreamSlowClient {
+	case "":
+		cfg.StreamSlowClient = SlowClientDropNewest
+	case SlowClientDropNewest, SlowClientDropOldest, SlowClientDisconnect:
+	default:
+		return nil, fmt.Errorf("unknown slow client policy %q, expected %s, %s or %s",
+			cfg.StreamSlowClient, SlowClientDropNewest, SlowClientDropOldest, SlowClientDisconnect)
+	}
+	if cfg.StreamClientBuffer <= 0 {
+		cfg.StreamClientBuffer = 10
+	}
+	if cfg.Timezone == nil {
+		cfg.Timezone = time.Local
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	service := &AttendanceService{
-		faceClient: faceClient,
-		db:         db,
-		clients:    make(map[string]*SSEClient),
-		ctx:        ctx,
-		cancel:     cancel,
+		logger:      logging.Component("attendance"),
+		faceClient:  faceClient,
+		db:          db,
+		reads:       reads,
+		calendar:    calendar,
+		snapshots:   snapshots,
+		experiment:  experiment,
+		siem:        siem,
+		webhooks:    webhooks,
+		building:    building,
+		bus:         bus,
+		bridge:      bridge,
+		cfg:         cfg,
+		newID:       newID,
+		clients:     make(map[string]*SSEClient),
+		fanOutQueue: make(chan domain.SSEMessage, fanOutQueueSize),
+		events:      eventRing{events: make([]domain.SSEMessage, max(cfg.StreamReplay, 0))},
+		lastSeen:    make(map[string]time.Time),
+		metrics:     newRecognitionMetrics(cfg.MinConfidence),
+		ctx:         ctx,
+		cancel:      cancel,
+
+		doors:         doors,
+		doorSightings: make(map[string]*doorSighting),
+
+		tagRules: tagRules,
+
+		// Event IDs continue from the start time, so they keep increasing
+		// across restarts and a client reconnecting to a restarted server
+		// is not mistaken for one that has seen everything
+		lastEvent: uint64(time.Now().UnixMilli()),
 	}
+	service.thresholds.Store(thresholdsOf(cfg))
 
 	// Initialize schema
 	if err := service.initSchema(); err != nil {
-		db.Close()
+		cancel()
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
 
 	// Start periodic cleanup of stale connections
 	go service.cleanupStaleConnections()
+	go service.fanOut()
+	if cfg.StreamStatsInterval > 0 {
+		go service.publishStats()
+	}
+	bridge.Start(service.relay)
 
 	return service, nil
 }
@@ -86,6 +180,17 @@ func (s *AttendanceService) initSchema() error {
 	CREATE INDEX IF NOT EXISTS idx_attendance_timestamp ON attendance(timestamp DESC);
 	CREATE INDEX IF NOT EXISTS idx_attendance_name ON attendance(name);
 	CREATE INDEX IF NOT EXISTS idx_attendance_status ON attendance(status);
+	CREATE INDEX IF NOT EXISTS idx_attendance_status_name ON attendance(status, name);
+	CREATE INDEX IF NOT EXISTS idx_attendance_timestamp_status ON attendance(timestamp, status, name);
+
+	CREATE TABLE IF NOT EXISTS ingested_files (
+		hash TEXT PRIMARY KEY,
+		filename TEXT NOT NULL,
+		device_id TEXT,
+		status TEXT NOT NULL,
+		error TEXT,
+		processed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
 	`
 
 	_, err := s.db.Exec(schema)
@@ -93,32 +198,192 @@ func (s *AttendanceService) initSchema() error {
 		return fmt.Errorf("failed to execute schema: %w", err)
 	}
 
+	for _, column := range attendanceColumns {
+		if err := ensureColumn(s.db, "attendance", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
+	// Multi-door sites look at the records of one device
+	_, err = s.db.Exec("CREATE INDEX IF NOT EXISTS idx_attendance_device ON attendance(device_id, timestamp)")
+	if err != nil {
+		return fmt.Errorf("failed to create device index: %w", err)
+	}
+
+	// A multi-face submission records every face under the same reference.
+	// Lookups repeat the index condition so SQLite can use it.
+	_, err = s.db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_attendance_external_id ON attendance(external_id, name) WHERE external_id != ''")
+	if err != nil {
+		return fmt.Errorf("failed to create external id index: %w", err)
+	}
+
+	if err := s.initLocationSchema(); err != nil {
+		return err
+	}
+
+	if err := s.initSessionSchema(); err != nil {
+		return err
+	}
+
+	if err := s.initShiftSchema(); err != nil {
+		return err
+	}
+
+	if err := s.initPeopleSchema(); err != nil {
+		return err
+	}
+
+	if err := s.initIdentitySchema(); err != nil {
+		return err
+	}
+
+	if err := s.initDoorSchema(); err != nil {
+		return err
+	}
+
+	if err := s.initScheduleSchema(); err != nil {
+		return err
+	}
+
+	if err := s.initEmergencySchema(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// attendanceColumns lists the attendance columns added after the initial
+// release, which older databases may lack
+var attendanceColumns = []struct{ name, definition string }{
+	{"device_id", "TEXT"},
+	{"event_type", "TEXT"},
+	{"location", "TEXT"},
+	{"lateness_minutes", "INTEGER"},
+	{"late", "INTEGER NOT NULL DEFAULT 0"},
+	{"early_leave_minutes", "INTEGER NOT NULL DEFAULT 0"},
+	{"early_leave", "INTEGER NOT NULL DEFAULT 0"},
+	{"observe_only", "INTEGER NOT NULL DEFAULT 0"},
+	{"misplaced", "INTEGER NOT NULL DEFAULT 0"},
+	{"actor_type", "TEXT NOT NULL DEFAULT ''"},
+	{"actor_id", "TEXT NOT NULL DEFAULT ''"},
+	{"actor_name", "TEXT NOT NULL DEFAULT ''"},
+	{"tenant", "TEXT NOT NULL DEFAULT ''"},
+	{"person_id", "TEXT NOT NULL DEFAULT ''"},
+	{"external_id", "TEXT NOT NULL DEFAULT ''"},
+	{"sources", "TEXT NOT NULL DEFAULT ''"},
+	{"tags", "TEXT NOT NULL DEFAULT ''"},
+	{"client_cert", "TEXT NOT NULL DEFAULT ''"},
+	{"door_id", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// ensureColumn adds a column to an existing table when it is missing, so
+// databases created by older versions keep working after an upgrade.
+func ensureColumn(db *sql.DB, table, column, definition string) error {
+	columns, err := tableColumns(db, table)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(columns, column) {
+		return nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+
+	return nil
+}
+
+// thresholds are the settings of the recognition path that can change
+// while the service runs
+type thresholds struct {
+	MinConfidence float64
+	Cooldown      time.Duration
+	SessionMinGap time.Duration
+	DoorWindow    time.Duration
+}
+
+func thresholdsOf(cfg config.AttendanceConfig) *thresholds {
+	return &thresholds{
+		MinConfidence: cfg.MinConfidence,
+		Cooldown:      cfg.Cooldown,
+		SessionMinGap: cfg.SessionMinGap,
+		DoorWindow:    cfg.DoorWindow,
+	}
+}
+
+// Location returns the zone of the site, in which days begin and end
+func (s *AttendanceService) Location() *time.Location {
+	return s.cfg.Timezone
+}
+
+// now is the current time in the zone of the site
+func (s *AttendanceService) now() time.Time {
+	return time.Now().In(s.cfg.Timezone)
+}
+
+// Reconfigure applies changed thresholds: the minimum confidence, the
+// cooldown, the minimum session gap and the door window, from the next
+// recognition on. The other attendance settings need a restart.
+func (s *AttendanceService) Reconfigure(cfg config.AttendanceConfig) {
+	next := thresholdsOf(cfg)
+	old := s.thresholds.Swap(next)
+	s.metrics.setMinConfidence(next.MinConfidence)
+	if *old != *next {
+		s.logger.Info("Thresholds changed", "min_confidence", next.MinConfidence, "cooldown", next.Cooldown,
+			"session_min_gap", next.SessionMinGap, "door_window", next.DoorWindow)
+	}
+}
+
 func (s *AttendanceService) Close() error {
 	// Cancel cleanup goroutine
 	s.cancel()
 
 	// Close all SSE connections
 	s.mu.Lock()
-	log.Printf("🛑 SSE: Closing %d active connections for shutdown", len(s.clients))
+	s.logger.Info("Closing SSE connections for shutdown", "clients", len(s.clients))
 	for clientID, client := range s.clients {
-		if client.active {
-			client.active = false
-			close(client.channel)
-			log.Printf("🛑 SSE: Closed client %s", clientID)
+		if client.active() {
+			client.stop()
+			s.logger.Debug("Closed SSE client", "client_id", clientID)
 		}
 		delete(s.clients, clientID)
 	}
 	s.mu.Unlock()
 
-	return s.db.Close()
+	return nil
 }
 
-func (s *AttendanceService) RecordAttendance(ctx context.Context, imageData []byte, filename string) (*domain.AttendanceResponse, error) {
-	result, err := s.faceClient.RecognizeFace(ctx, imageData, filename)
+func (s *AttendanceService) RecordAttendance(ctx context.Context, sub domain.AttendanceSubmission) (*domain.AttendanceResponse, error) {
+	ctx, span := tracing.Start(ctx, "AttendanceService.RecordAttendance", attribute.String("device", sub.DeviceID))
+	defer span.End()
+
+	if sub.ExternalID != "" {
+		var exists bool
+		err := s.db.QueryRow("SELECT EXISTS (SELECT 1 FROM attendance WHERE external_id = ? AND external_id != '')", sub.ExternalID).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up external reference: %w", err)
+		}
+		if exists {
+			return &domain.AttendanceResponse{
+				Success:    false,
+				Authorized: false,
+				Message:    "Submission already recorded",
+				Action:     "keep_closed",
+			}, ErrDuplicateReference
+		}
+	}
+
+	// Covers waiting for a slot at the face service as well as the call
+	recognizeCtx, recognizeSpan := tracing.Start(ctx, "face.Recognize", attribute.Int("image_bytes", len(sub.ImageData)))
+	start := time.Now()
+	result, err := s.faceClient.RecognizeFace(recognizeCtx, sub.ImageData, sub.Filename)
+	s.metrics.observeCall(time.Since(start), err)
+	tracing.Fail(recognizeSpan, err)
+	recognizeSpan.End()
 	if err != nil {
+		tracing.Fail(span, err)
 		return &domain.AttendanceResponse{
 			Success:    false,
 			Authorized: false,
@@ -127,89 +392,650 @@ func (s *AttendanceService) RecordAttendance(ctx context.Context, imageData []by
 		}, err
 	}
 
-	if result.FacesDetected == 0 {
-		return &domain.AttendanceResponse{
+	actor := domain.ActorFromContext(ctx)
+	if sub.DeviceID == "" {
+		sub.DeviceID = actor.Device
+	}
+	actor.Device = sub.DeviceID
+
+	s.experiment.Observe(sub, result)
+	s.metrics.observeResult(result)
+	span.SetAttributes(attribute.Int("faces", len(result.Faces)))
+
+	now := s.now()
+	door := s.doorFor(sub)
+	schedule, err := s.activeSchedule(door, now)
+	if err != nil {
+		// Without its schedule the door is face-only
+		s.logger.Error("Failed to evaluate door schedule", "error", err)
+	}
+	emergency, err := s.Emergency()
+	if err != nil {
+		// Without the emergency the door keeps to its own rules
+		s.logger.Error("Failed to check for an emergency", "error", err)
+	}
+
+	if result.FacesDetected == 0 || len(result.Faces) == 0 {
+		response := &domain.AttendanceResponse{
 			Success:    true,
 			Authorized: false,
 			Message:    "No face detected",
 			Action:     "keep_closed",
-		}, nil
+			Door:       door,
+			Schedule:   schedule,
+			Emergency:  emergency,
+		}
+		if schedule != nil && schedule.Mode == domain.DoorUnlocked {
+			response.Action = "open_door"
+		}
+		if emergency != nil {
+			response.Action = emergency.Action()
+		}
+		return response, nil
+	}
+
+	// Weak matches are treated as if the face service had not matched them
+	for i, face := range result.Faces {
+		if face.Name != "Unknown" && face.Confidence < s.thresholds.Load().MinConfidence {
+			result.Faces[i].Name = "Unknown"
+		}
+	}
+
+	response := &domain.AttendanceResponse{
+		Success:   true,
+		Action:    "keep_closed",
+		Door:      door,
+		Schedule:  schedule,
+		Emergency: emergency,
+		Faces:     make([]domain.FaceOutcome, 0, len(result.Faces)),
+	}
+
+	seen := make(map[string]bool)
+	for _, face := range result.Faces {
+		// The same person matched twice in one frame is a single recognition
+		if face.Name != "Unknown" {
+			if seen[face.Name] {
+				continue
+			}
+			seen[face.Name] = true
+		}
+
+		outcome := s.recordFace(ctx, face, sub, actor, schedule, emergency, now)
+		response.Faces = append(response.Faces, outcome)
+
+		if outcome.Authorized && !response.Authorized {
+			response.Authorized = true
+			response.Action = "open_door"
+		}
 	}
 
-	face := result.Faces[0]
+	// The top-level fields describe the first authorized face, or the first
+	// face when nobody is authorized, so single-face clients keep working
+	primary := response.Faces[0]
+	for _, outcome := range response.Faces {
+		if outcome.Authorized {
+			primary = outcome
+			break
+		}
+	}
+	response.Name = primary.Name
+	response.Confidence = primary.Confidence
+	response.Message = primary.Message
+	response.EventType = primary.EventType
+	response.Duplicate = primary.Duplicate
+	response.Misplaced = primary.Misplaced
+
+	if schedule != nil && schedule.Mode == domain.DoorUnlocked {
+		// The door is open to anyone; faces are still recorded
+		response.Action = "open_door"
+	}
+	if emergency != nil {
+		// The emergency decides for every door, whoever was recognized
+		response.Action = emergency.Action()
+	}
+
+	if s.isObserved(sub.DeviceID) {
+		response.ObserveOnly = true
+		response.IntendedAction = response.Action
+		response.Action = s.cfg.ObserveAction
+	}
+
+	return response, nil
+}
+
+// isObserved reports whether a device runs in soft-launch (observe-only) mode
+func (s *AttendanceService) isObserved(deviceID string) bool {
+	if deviceID == "" {
+		return false
+	}
+	for _, id := range s.cfg.ObserveDevices {
+		if id == deviceID {
+			return true
+		}
+	}
+	return false
+}
+
+// recordFace decides on a single detected face at a door in the mode of
+// schedule, or of the emergency in force, stores and broadcasts its
+// attendance record, attributed to actor, and returns the outcome
+func (s *AttendanceService) recordFace(ctx context.Context, face domain.RecognizedFace, sub domain.AttendanceSubmission, actor domain.Actor, schedule *domain.DoorSchedule, emergency *domain.Emergency, now time.Time) domain.FaceOutcome {
+	ctx, span := tracing.Start(ctx, "AttendanceService.recordFace", attribute.String("person", face.Name))
+	defer span.End()
+
 	authorized := face.Name != "Unknown"
 	status := "unauthorized"
-	action := "keep_closed"
 	message := "Unknown person"
 
-	fmt.Printf("DEBUG: Face name='%s', authorized=%v\n", face.Name, authorized)
+	logger := logging.From(ctx).With("person", face.Name)
+	logger.Debug("Deciding on face", "authorized", authorized)
+
+	outcome := domain.FaceOutcome{
+		Name:       face.Name,
+		Confidence: face.Confidence,
+	}
+
+	var err error
+	personID := ""
+	if authorized {
+		var active bool
+		personID, active, err = s.personFor(face.Name)
+		if err != nil {
+			s.logger.Error("Failed to look up person", "error", err)
+		}
+		if !active {
+			authorized = false
+			message = fmt.Sprintf("%s is inactive", face.Name)
+		}
+	}
+
+	misplaced := false
+	if authorized {
+		misplaced, err = s.isMisplaced(face.Name, sub.Location)
+		if err != nil {
+			s.logger.Error("Failed to check location assignment", "error", err)
+		}
+		if misplaced && s.cfg.MisplacedPolicy == "deny" {
+			authorized = false
+			message = fmt.Sprintf("%s is not assigned to this location", face.Name)
+		}
+	}
+
+	door := s.doorFor(sub)
+	if authorized && door != "" {
+		allowed, err := s.mayPass(face.Name, door)
+		if err != nil {
+			// The door stays closed when its rules cannot be read
+			s.logger.Error("Failed to check door access", "error", err)
+		}
+		if !allowed {
+			authorized = false
+			message = fmt.Sprintf("%s has no access to door %s", face.Name, door)
+		}
+	}
+	if authorized && schedule != nil && schedule.Mode == domain.DoorLocked {
+		authorized = false
+		message = fmt.Sprintf("Door %s is locked (%s)", door, schedule.Name)
+	}
+	if authorized && emergency != nil && emergency.Mode == domain.EmergencyLockdown {
+		authorized = false
+		message = "Lockdown in force"
+	}
 
 	if authorized {
 		status = "authorized"
-		action = "open_door"
 		message = fmt.Sprintf("Welcome, %s", face.Name)
 	}
 
+	// The cooldown goes first: a door only takes a recognition as its
+	// record once it is sure to be recorded
+	cameraDoor, grouped := s.doors[sub.DeviceID]
+	grouped = grouped && face.Name != "Unknown"
+	if authorized && s.inCooldown(face.Name, now) {
+		logger.Debug("Recognized again within cooldown, not recording")
+		if grouped {
+			s.sightAtDoor(cameraDoor, face.Name, sub.DeviceID, "", now)
+		}
+		outcome.Authorized = true
+		outcome.Message = message
+		outcome.Duplicate = true
+		return outcome
+	}
+
+	recordID := s.newID()
+	var sources []string
+	if grouped {
+		if !s.sightAtDoor(cameraDoor, face.Name, sub.DeviceID, recordID, now) {
+			outcome.Authorized = authorized
+			outcome.Message = message
+			outcome.Duplicate = true
+			return outcome
+		}
+		sources = []string{sub.DeviceID}
+	}
+
+	eventType := ""
+	if authorized {
+		eventType, err = s.trackSession(face.Name, now)
+		if err != nil {
+			s.logger.Error("Failed to track session", "error", err)
+		}
+		if eventType == domain.EventCheckOut {
+			message = fmt.Sprintf("Goodbye, %s", face.Name)
+		}
+	}
+
 	record := domain.AttendanceRecord{
-		ID:         uuid.New().String(),
+		ID:         recordID,
 		Name:       face.Name,
+		PersonID:   personID,
+		ExternalID: sub.ExternalID,
 		Confidence: face.Confidence,
-		Timestamp:  time.Now(),
+		Timestamp:  now,
 		Status:     status,
+		DeviceID:   sub.DeviceID,
+		ClientCert: sub.ClientCert,
+		Sources:    sources,
+		EventType:  eventType,
+		Location:   sub.Location,
+		Misplaced:  misplaced,
+		DoorID:     door,
+
+		ObserveOnly: s.isObserved(sub.DeviceID),
+		Actor:       recordActor(actor),
+	}
+
+	if err := s.applyShift(&record); err != nil {
+		s.logger.Error("Failed to evaluate shift", "error", err)
 	}
+	s.tagRecord(&record)
 
-	if err := s.saveRecord(record); err != nil {
-		fmt.Printf("❌ ERROR: Failed to save attendance record: %v\n", err)
+	if err := s.saveRecord(ctx, record); err != nil {
+		logger.Error("Failed to save attendance record", "error", err)
 	} else {
-		fmt.Printf("✅ Saved attendance record: ID=%s, Name=%s, Status=%s\n", record.ID, record.Name, record.Status)
+		logger.Info("Saved attendance record", "record", record.ID, "status", record.Status)
+
+		if policy, ok := s.snapshots.Captures(record); ok {
+			// Storing snapshots (possibly in S3) must not delay the door
+			go s.captureSnapshot(record, policy, sub.ImageData, face.Location)
+		}
 	}
 
+	_, broadcastSpan := tracing.Start(ctx, "AttendanceService.broadcast")
 	s.broadcast(domain.SSEMessage{
-		Event: "attendance",
-		Data:  record,
+		Event:  domain.EventAttendance,
+		Record: &record,
 	})
 
-	return &domain.AttendanceResponse{
-		Success:    true,
-		Authorized: authorized,
-		Name:       face.Name,
-		Confidence: face.Confidence,
+	if misplaced {
+		s.broadcast(domain.SSEMessage{
+			Event:  domain.EventMisplaced,
+			Record: &record,
+		})
+	}
+
+	if record.Name == "Unknown" {
+		s.broadcast(domain.SSEMessage{
+			Event:  domain.EventUnknownPerson,
+			Record: &record,
+		})
+	}
+	s.building.Emit(record)
+	broadcastSpan.End()
+
+	s.reportSecurityEvent(record, message)
+
+	outcome.Authorized = authorized
+	outcome.Message = message
+	outcome.EventType = eventType
+	outcome.Misplaced = misplaced
+	return outcome
+}
+
+// reportSecurityEvent forwards denied and misplaced recognitions to the SIEM
+func (s *AttendanceService) reportSecurityEvent(record domain.AttendanceRecord, message string) {
+	event := domain.SecurityEvent{
+		Timestamp:  record.Timestamp,
 		Message:    message,
-		Action:     action,
-	}, nil
+		RecordID:   record.ID,
+		Name:       record.Name,
+		PersonID:   record.PersonID,
+		Confidence: record.Confidence,
+		DeviceID:   record.DeviceID,
+		Location:   record.Location,
+	}
+	if record.Actor != nil {
+		event.Actor = record.Actor.String()
+	}
+
+	switch {
+	case record.Status == "unauthorized" && record.Name == "Unknown":
+		event.Type, event.Severity = domain.SecurityUnauthorized, 5
+	case record.Status == "unauthorized":
+		// A known face turned away: inactive, at the wrong location or
+		// without access to the door
+		event.Type, event.Severity = domain.SecurityUnauthorized, 7
+	case record.Misplaced:
+		event.Type, event.Severity = domain.SecurityMisplaced, 4
+		event.Message = fmt.Sprintf("%s is not assigned to this location", record.Name)
+	default:
+		return
+	}
+
+	s.siem.Emit(event)
+}
+
+// recordActor is the actor as stored on a record; the device and its
+// location are already kept in the record's own device_id and location
+func recordActor(actor domain.Actor) *domain.Actor {
+	actor.Device = ""
+	actor.Location = ""
+	return &actor
+}
+
+// captureSnapshot stores the image of a record as its capture policy asks
+func (s *AttendanceService) captureSnapshot(record domain.AttendanceRecord, policy string, imageData []byte, location domain.FaceLocation) {
+	if err := s.snapshots.Capture(record, policy, imageData, location); err != nil {
+		s.logger.Error("Failed to capture snapshot", "error", err)
+	}
 }
 
-func (s *AttendanceService) saveRecord(record domain.AttendanceRecord) error {
+// inCooldown reports whether the person was already recorded within the
+// cooldown window. Otherwise it starts a new window at now.
+func (s *AttendanceService) inCooldown(name string, now time.Time) bool {
+	cooldown := s.thresholds.Load().Cooldown
+	if cooldown <= 0 {
+		return false
+	}
+
+	s.cooldownMu.Lock()
+	defer s.cooldownMu.Unlock()
+
+	if last, ok := s.lastSeen[name]; ok && now.Sub(last) < cooldown {
+		return true
+	}
+
+	s.lastSeen[name] = now
+	return false
+}
+
+// doorSighting is the record a person's first recognition at a door
+// created, with the devices of that door that have seen them since
+type doorSighting struct {
+	recordID string
+	at       time.Time
+	sources  []string
+}
+
+// parseDoors maps every device of the "door=device|device" entries to
+// its door
+func parseDoors(entries []string) (map[string]string, error) {
+	doors := make(map[string]string)
+	for _, entry := range entries {
+		door, devices, ok := strings.Cut(entry, "=")
+		door = strings.TrimSpace(door)
+		if !ok || door == "" || strings.TrimSpace(devices) == "" {
+			return nil, fmt.Errorf("invalid door %q, expected door=device|device", entry)
+		}
+		for _, device := range strings.Split(devices, "|") {
+			device = strings.TrimSpace(device)
+			if device == "" {
+				continue
+			}
+			if other, ok := doors[device]; ok && other != door {
+				return nil, fmt.Errorf("device %s is grouped into both door %s and door %s", device, other, door)
+			}
+			doors[device] = door
+		}
+	}
+	return doors, nil
+}
+
+// sightAtDoor registers a recognition of name by a device of door. When
+// the person was already recorded at that door within the window it adds
+// the device to that record's sources and returns false, so no second
+// record is created; otherwise recordID becomes the door's record. An empty
+// recordID, for a recognition that is not recorded, only adds the device.
+func (s *AttendanceService) sightAtDoor(door, name, deviceID, recordID string, now time.Time) bool {
+	key := door + "\x00" + name
+
+	s.doorsMu.Lock()
+	sighting, ok := s.doorSightings[key]
+	if !ok || now.Sub(sighting.at) >= s.thresholds.Load().DoorWindow {
+		if recordID != "" {
+			s.doorSightings[key] = &doorSighting{recordID: recordID, at: now, sources: []string{deviceID}}
+		}
+		s.doorsMu.Unlock()
+		return true
+	}
+	if !slices.Contains(sighting.sources, deviceID) {
+		sighting.sources = append(sighting.sources, deviceID)
+	}
+	existing, sources := sighting.recordID, strings.Join(sighting.sources, ",")
+	s.doorsMu.Unlock()
+
+	s.logger.Info("Seen again at door, merged into record", "person", name, "device", deviceID, "door", door, "record", existing)
+	if _, err := s.db.Exec("UPDATE attendance SET sources = ? WHERE id = ?", sources, existing); err != nil {
+		s.logger.Error("Failed to add source to record", "record", existing, "error", err)
+	}
+	return false
+}
+
+// RemoveFace removes a person from the face service along with their
+// location assignments, then keeps, anonymizes or deletes their attendance
+// history and sessions. Anonymized records are renamed to a random
+// pseudonym, so they still count in totals but no longer identify anyone;
+// the stored snapshots of their records are deleted either way. The person
+// entry is kept; it is removed through the people API.
+func (s *AttendanceService) RemoveFace(ctx context.Context, name, history string) (*domain.FaceRemoval, error) {
+	images, err := s.faceClient.RemoveFace(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	removal := &domain.FaceRemoval{Name: name, ImagesRemoved: images, History: history}
+
+	// The snapshots are found through the records, so before those change
+	if history != domain.HistoryKeep {
+		if removal.SnapshotsDeleted, err = s.snapshots.DeletePerson(ctx, name); err != nil {
+			return nil, fmt.Errorf("failed to delete snapshots: %w", err)
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM person_locations WHERE name = ?", name); err != nil {
+		return nil, fmt.Errorf("failed to clear location assignments: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM door_grants WHERE subject_type = 'person' AND subject = ?", name); err != nil {
+		return nil, fmt.Errorf("failed to clear door grants: %w", err)
+	}
+
+	var result sql.Result
+	switch history {
+	case domain.HistoryAnonymize:
+		removal.AnonymizedAs = "anonymized-" + uuid.New().String()[:8]
+		result, err = tx.Exec("UPDATE attendance SET name = ?, person_id = '' WHERE name = ?", removal.AnonymizedAs, name)
+		if err == nil {
+			_, err = tx.Exec("UPDATE attendance_sessions SET name = ? WHERE name = ?", removal.AnonymizedAs, name)
+		}
+	case domain.HistoryDelete:
+		result, err = tx.Exec("DELETE FROM attendance WHERE name = ?", name)
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM attendance_sessions WHERE name = ?", name)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s attendance history: %w", history, err)
+	}
+	if result != nil {
+		removal.RecordsAffected, _ = result.RowsAffected()
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit face removal: %w", err)
+	}
+
+	s.cooldownMu.Lock()
+	delete(s.lastSeen, name)
+	s.cooldownMu.Unlock()
+
+	logging.From(ctx).Info("Removed face", "person", name, "images", images, "history", history, "records", removal.RecordsAffected)
+
+	s.broadcast(domain.SSEMessage{
+		Event: domain.EventFaceRemoved,
+		Face: &domain.FaceChange{
+			Name:      name,
+			Images:    images,
+			Timestamp: s.now(),
+			Actor:     recordActor(domain.ActorFromContext(ctx)),
+		},
+	})
+
+	return removal, nil
+}
+
+// PlanFaceRemoval reports what RemoveFace would do with the same arguments,
+// without changing anything: the images the face service holds for the
+// person and, unless the history is kept, the records and snapshots that
+// would be anonymized or deleted.
+func (s *AttendanceService) PlanFaceRemoval(ctx context.Context, name, history string) (*domain.FaceRemoval, error) {
+	images, err := s.faceClient.ListFaceImages(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	removal := &domain.FaceRemoval{Name: name, ImagesRemoved: len(images), Images: images, History: history}
+	if history == domain.HistoryKeep {
+		return removal, nil
+	}
+
+	if removal.SnapshotsDeleted, err = s.snapshots.CountPerson(ctx, name); err != nil {
+		return nil, err
+	}
+	if err := s.reads.QueryRowContext(ctx, "SELECT COUNT(*) FROM attendance WHERE name = ?", name).Scan(&removal.RecordsAffected); err != nil {
+		return nil, fmt.Errorf("failed to count attendance history: %w", err)
+	}
+
+	return removal, nil
+}
+
+// DeviceStatusChanged tells stream clients, webhooks and the event bus that
+// a registered device went offline or came back
+func (s *AttendanceService) DeviceStatusChanged(status domain.DeviceStatus) {
+	event := domain.EventDeviceOnline
+	if status.Status == domain.DeviceOffline {
+		event = domain.EventDeviceOffline
+	}
+	s.broadcast(domain.SSEMessage{Event: event, Device: &status})
+}
+
+// DeviceConfigChanged tells stream clients, webhooks and the event bus
+// that the settings of a device changed, so the device fetches them again
+func (s *AttendanceService) DeviceConfigChanged(settings domain.DeviceSettings) {
+	s.broadcast(domain.SSEMessage{Event: domain.EventDeviceConfig, Config: &settings})
+}
+
+// FaceAdded tells stream clients, webhooks and the event bus that images of
+// a person were enrolled
+func (s *AttendanceService) FaceAdded(ctx context.Context, name string, images int) {
+	s.broadcast(domain.SSEMessage{
+		Event: domain.EventFaceAdded,
+		Face: &domain.FaceChange{
+			Name:      name,
+			Images:    images,
+			Timestamp: s.now(),
+			Actor:     recordActor(domain.ActorFromContext(ctx)),
+		},
+	})
+}
+
+// RecognitionCompleted tells stream clients, webhooks and the event bus
+// that the recognition of an asynchronous attendance request finished, with
+// the decision as the result of the job
+func (s *AttendanceService) RecognitionCompleted(job domain.Job) {
+	s.broadcast(domain.SSEMessage{Event: domain.EventRecognized, Job: &job})
+}
+
+func (s *AttendanceService) saveRecord(ctx context.Context, record domain.AttendanceRecord) error {
+	_, span := tracing.Start(ctx, "INSERT attendance", semconv.DBSystemSqlite, semconv.DBOperationName("INSERT"))
+	defer span.End()
+
 	query := `
-		INSERT INTO attendance (id, name, confidence, timestamp, status)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO attendance (id, name, confidence, timestamp, status, device_id, event_type, location, misplaced,
+			lateness_minutes, late, early_leave_minutes, early_leave, observe_only,
+			actor_type, actor_id, actor_name, tenant, person_id, external_id, sources, tags, client_cert, door_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := s.db.Exec(query, record.ID, record.Name, record.Confidence, record.Timestamp, record.Status)
+	var actor domain.Actor
+	if record.Actor != nil {
+		actor = *record.Actor
+	}
+
+	_, err := s.db.Exec(query, record.ID, record.Name, record.Confidence, record.Timestamp, record.Status,
+		record.DeviceID, record.EventType, record.Location, record.Misplaced,
+		record.LatenessMinutes, record.Late, record.EarlyLeaveMinutes, record.EarlyLeave, record.ObserveOnly,
+		actor.Type, actor.ID, actor.Name, actor.Tenant, record.PersonID, record.ExternalID,
+		strings.Join(record.Sources, ","), strings.Join(record.Tags, ","), record.ClientCert, record.DoorID)
 	if err != nil {
+		tracing.Fail(span, err)
 		return fmt.Errorf("failed to insert record: %w", err)
 	}
 
 	return nil
 }
 
-func (s *AttendanceService) Subscribe() (string, chan domain.SSEMessage) {
+// Subscribe registers a client for the events broadcast from now on that
+// pass the filter
+func (s *AttendanceService) Subscribe(filter domain.StreamFilter) (string, chan domain.SSEMessage, error) {
+	clientID, ch, _, _, err := s.SubscribeAfter(filter, 0)
+	return clientID, ch, err
+}
+
+// SubscribeAfter registers a client that has seen the events up to the ID
+// lastEventID, and returns the kept events it missed since, to be sent
+// before the live ones. complete is false when some of them are no longer
+// kept. A lastEventID of zero replays nothing. With StreamMaxClients
+// clients connected it returns ErrTooManyStreams.
+func (s *AttendanceService) SubscribeAfter(filter domain.StreamFilter, lastEventID uint64) (clientID string, ch chan domain.SSEMessage, missed []domain.SSEMessage, complete bool, err error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	clientID := uuid.New().String()[:8] // Short ID for logging
-	ch := make(chan domain.SSEMessage, 10)
+	if s.cfg.StreamMaxClients > 0 && s.activeClients() >= s.cfg.StreamMaxClients {
+		s.logger.Warn("Turned an SSE client away", "clients", s.cfg.StreamMaxClients)
+		return "", nil, nil, false, ErrTooManyStreams
+	}
 
-	client := &SSEClient{
-		id:      clientID,
-		channel: ch,
-		active:  true,
+	// Taken under the lock broadcasts hold, so no event is both replayed
+	// and sent live, or neither: live events start after s.lastEvent
+	complete = true
+	if lastEventID != 0 && lastEventID < s.lastEvent {
+		missed, complete = s.events.after(lastEventID)
+		missed = slices.DeleteFunc(missed, func(msg domain.SSEMessage) bool {
+			return !filter.Matches(msg)
+		})
 	}
 
+	clientID = uuid.New().String()[:8] // Short ID for logging
+	client := newSSEClient(clientID, filter, s.lastEvent, s.cfg.StreamClientBuffer, &s.streamTotals, s.logger.With("client_id", clientID))
+	ch = client.channel
+
 	s.clients[clientID] = client
-	log.Printf("📡 SSE: Client %s connected (total: %d)", clientID, len(s.clients))
+	if filter.Person != "" {
+		s.logger.Info("SSE client connected", "client_id", clientID, "person", filter.Person, "clients", len(s.clients))
+	} else {
+		s.logger.Info("SSE client connected", "client_id", clientID, "clients", len(s.clients))
+	}
+	if lastEventID != 0 {
+		s.logger.Info("Replaying events to SSE client", "client_id", clientID, "events", len(missed), "after", lastEventID)
+	}
 
-	return clientID, ch
+	return clientID, ch, missed, complete, nil
 }
 
 func (s *AttendanceService) Unsubscribe(clientID string) {
@@ -217,60 +1043,181 @@ func (s *AttendanceService) Unsubscribe(clientID string) {
 	defer s.mu.Unlock()
 
 	if client, exists := s.clients[clientID]; exists {
-		client.active = false
-		close(client.channel)
+		client.stop()
 		delete(s.clients, clientID)
-		log.Printf("🔌 SSE: Client %s disconnected (remaining: %d)", clientID, len(s.clients))
+		s.logger.Info("SSE client disconnected", "client_id", clientID, "clients", len(s.clients))
 	} else {
-		log.Printf("⚠️ SSE: Attempted to unsubscribe unknown client %s", clientID)
+		s.logger.Warn("Attempted to unsubscribe unknown SSE client", "client_id", clientID)
 	}
 }
 
 func (s *AttendanceService) broadcast(msg domain.SSEMessage) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.stream(msg, false)
+}
 
-	successCount := 0
-	for clientID, client := range s.clients {
-		if !client.active {
-			continue
+// relay broadcasts an event another instance received through the stream
+// bridge. That instance has already sent its webhooks and bus messages.
+func (s *AttendanceService) relay(msg domain.SSEMessage) {
+	s.stream(msg, true)
+}
+
+func (s *AttendanceService) stream(msg domain.SSEMessage, relayed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch msg.Event {
+	case domain.EventStatsUpdated:
+		// A snapshot, superseded by the next one: not worth replaying
+	default:
+		s.lastEvent++
+		msg.ID = s.lastEvent
+		s.events.add(msg)
+		if !relayed {
+			s.webhooks.Emit(msg.Event, msg.Data())
+			s.bus.Emit(msg)
+			s.bridge.Publish(msg)
 		}
+	}
+	if msg.Event == domain.EventAttendance || msg.Event == domain.EventFaceRemoved {
+		s.statsChanged.Store(true)
+	}
+
+	select {
+	case s.fanOutQueue <- msg:
+	default:
+		// fanOut never blocks, so this takes a burst far beyond any door
+		s.streamTotals.fanOutDropped.Add(1)
+		s.logger.Warn("Fan-out queue full, dropped event for every stream", "event", msg.Event, "event_id", msg.ID)
+	}
+}
+
+// publishStats sends stats_updated events with the attendance stats after
+// they changed, at most once per interval and only while a stream client
+// wants them
+func (s *AttendanceService) publishStats() {
+	ticker := time.NewTicker(s.cfg.StreamStatsInterval)
+	defer ticker.Stop()
 
+	probe := domain.SSEMessage{Event: domain.EventStatsUpdated}
+	for {
 		select {
-		case client.channel <- msg:
-			successCount++
-		default:
-			// Channel full or blocked - client might be slow/dead
-			log.Printf("⚠️ SSE: Failed to send to client %s (channel full/blocked)", clientID)
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if !s.statsChanged.Load() || !s.wanted(probe) {
+				continue
+			}
+			s.statsChanged.Store(false)
+
+			stats, err := s.GetAttendanceStats(domain.GroupFilter{}, domain.SourceFilter{})
+			if err != nil {
+				s.logger.Warn("Failed to get stats for the stream", "error", err)
+				continue
+			}
+			s.broadcast(domain.SSEMessage{Event: domain.EventStatsUpdated, Stats: stats})
 		}
 	}
+}
 
-	if len(s.clients) > 0 {
-		log.Printf("📤 SSE: Broadcast to %d/%d clients", successCount, len(s.clients))
+// wanted reports whether a stream client's filter passes an event
+func (s *AttendanceService) wanted(msg domain.SSEMessage) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, client := range s.clients {
+		if client.wants(msg) {
+			return true
+		}
 	}
+	return false
 }
 
-func (s *AttendanceService) GetRecentAttendance(limit int) ([]domain.AttendanceRecord, error) {
-	query := `
-		SELECT id, name, confidence, timestamp, status
-		FROM attendance
-		ORDER BY timestamp DESC
-		LIMIT ?
-	`
+// eventRing keeps the latest broadcast events, overwriting the oldest once
+// it is full
+type eventRing struct {
+	events []domain.SSEMessage
+	next   int // where the next event goes
+	count  int
+}
+
+func (r *eventRing) add(msg domain.SSEMessage) {
+	if len(r.events) == 0 {
+		return
+	}
+	r.events[r.next] = msg
+	r.next = (r.next + 1) % len(r.events)
+	r.count = min(r.count+1, len(r.events))
+}
 
-	rows, err := s.db.Query(query, limit)
+// after returns the kept events with an ID above id, oldest first, and
+// whether they are all the events since id
+func (r *eventRing) after(id uint64) ([]domain.SSEMessage, bool) {
+	oldest := (r.next - r.count + len(r.events)) % max(len(r.events), 1)
+
+	var events []domain.SSEMessage
+	for i := 0; i < r.count; i++ {
+		msg := r.events[(oldest+i)%len(r.events)]
+		if msg.ID > id {
+			events = append(events, msg)
+		}
+	}
+	return events, r.count > 0 && r.events[oldest].ID <= id+1
+}
+
+// recordColumns is the column list matching scanRecord
+const recordColumns = `id, name, confidence, timestamp, status, COALESCE(device_id, ''),
+	COALESCE(event_type, ''), COALESCE(location, ''), COALESCE(misplaced, 0),
+	lateness_minutes, late, early_leave_minutes, early_leave, observe_only,
+	actor_type, actor_id, actor_name, tenant, person_id, external_id, sources, tags, client_cert, door_id`
+
+func scanRecord(row rowScanner) (*domain.AttendanceRecord, error) {
+	var (
+		record   domain.AttendanceRecord
+		lateness sql.NullInt64
+		actor    domain.Actor
+		sources  string
+		tags     string
+	)
+	err := row.Scan(&record.ID, &record.Name, &record.Confidence, &record.Timestamp, &record.Status,
+		&record.DeviceID, &record.EventType, &record.Location, &record.Misplaced,
+		&lateness, &record.Late, &record.EarlyLeaveMinutes, &record.EarlyLeave, &record.ObserveOnly,
+		&actor.Type, &actor.ID, &actor.Name, &actor.Tenant, &record.PersonID, &record.ExternalID, &sources, &tags,
+		&record.ClientCert, &record.DoorID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan record: %w", err)
+	}
+	if lateness.Valid {
+		minutes := int(lateness.Int64)
+		record.LatenessMinutes = &minutes
+	}
+	if actor.Type != "" {
+		record.Actor = &actor
+	}
+	if sources != "" {
+		record.Sources = strings.Split(sources, ",")
+	}
+	if tags != "" {
+		record.Tags = strings.Split(tags, ",")
+	}
+	return &record, nil
+}
+
+// queryRecords selects attendance records; clause holds everything after
+// the FROM (WHERE, ORDER BY, LIMIT)
+func (s *AttendanceService) queryRecords(clause string, args ...interface{}) ([]domain.AttendanceRecord, error) {
+	rows, err := s.reads.Query("SELECT "+recordColumns+" FROM attendance "+clause, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query records: %w", err)
 	}
 	defer rows.Close()
 
-	var records []domain.AttendanceRecord
+	records := []domain.AttendanceRecord{}
 	for rows.Next() {
-		var record domain.AttendanceRecord
-		if err := rows.Scan(&record.ID, &record.Name, &record.Confidence, &record.Timestamp, &record.Status); err != nil {
-			return nil, fmt.Errorf("failed to scan record: %w", err)
+		record, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
 		}
-		records = append(records, record)
+		records = append(records, *record)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -280,87 +1227,233 @@ func (s *AttendanceService) GetRecentAttendance(limit int) ([]domain.AttendanceR
 	return records, nil
 }
 
-func (s *AttendanceService) GetAttendanceByName(name string, limit int) ([]domain.AttendanceRecord, error) {
-	query := `
-		SELECT id, name, confidence, timestamp, status
-		FROM attendance
-		WHERE name = ?
-		ORDER BY timestamp DESC
-		LIMIT ?
-	`
+// GetRecentAttendance returns one page of the records matching the query,
+// newest first, with the number of matches across all pages. Pages are
+// addressed by offset or, stable while new records arrive, by the cursor
+// returned with the previous page.
+func (s *AttendanceService) GetRecentAttendance(q domain.AttendanceQuery) (*domain.AttendancePage, error) {
+	where, args := groupClause(q.GroupFilter)
+	source, sourceArgs := sourceClause(q.SourceFilter)
+	conditions := []string{where, source}
+	args = append(args, sourceArgs...)
+
+	if q.Name != "" {
+		conditions = append(conditions, "name = ?")
+		args = append(args, q.Name)
+	}
+	if q.PersonID != "" {
+		conditions = append(conditions, "person_id = ?")
+		args = append(args, q.PersonID)
+	}
+	if q.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, q.Status)
+	}
+	if q.MinConfidence > 0 {
+		conditions = append(conditions, "confidence >= ?")
+		args = append(args, q.MinConfidence)
+	}
+	if q.Tag != "" {
+		conditions = append(conditions, "instr(',' || tags || ',', ?) > 0")
+		args = append(args, ","+q.Tag+",")
+	}
+	if !q.From.IsZero() {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, q.From)
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, "timestamp < ?")
+		args = append(args, q.To)
+	}
 
-	rows, err := s.db.Query(query, name, limit)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query records: %w", err)
+	where = strings.Join(conditions, " AND ")
+	page := &domain.AttendancePage{}
+	if err := s.reads.QueryRow("SELECT COUNT(*) FROM attendance WHERE "+where, args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("failed to count records: %w", err)
 	}
-	defer rows.Close()
 
-	var records []domain.AttendanceRecord
-	for rows.Next() {
-		var record domain.AttendanceRecord
-		if err := rows.Scan(&record.ID, &record.Name, &record.Confidence, &record.Timestamp, &record.Status); err != nil {
-			return nil, fmt.Errorf("failed to scan record: %w", err)
+	offset := q.Offset
+	if q.Cursor != "" {
+		ts, id, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
 		}
-		records = append(records, record)
+		where += " AND (timestamp < ? OR (timestamp = ? AND id < ?))"
+		args = append(args, ts, ts, id)
+		offset = 0
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration error: %w", err)
+	// One extra row tells whether another page follows
+	records, err := s.queryRecords("WHERE "+where+" ORDER BY timestamp DESC, id DESC LIMIT ? OFFSET ?",
+		append(args, q.Limit+1, offset)...)
+	if err != nil {
+		return nil, err
 	}
 
-	return records, nil
+	if len(records) > q.Limit {
+		records = records[:q.Limit]
+		last := records[len(records)-1]
+		page.NextCursor = encodeCursor(last.Timestamp, last.ID)
+	}
+	page.Records = records
+
+	return page, nil
 }
 
-func (s *AttendanceService) GetAttendanceStats() (map[string]interface{}, error) {
-	stats := make(map[string]interface{})
+// encodeCursor makes an opaque page cursor from the last record of a page
+func encodeCursor(ts time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(ts.Format(time.RFC3339Nano) + "|" + id))
+}
 
-	// Total records
-	var total int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM attendance").Scan(&total)
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get total count: %w", err)
+		return time.Time{}, "", ErrInvalidCursor
 	}
-	stats["total"] = total
 
-	// Authorized vs Unauthorized
-	var authorized, unauthorized int
-	err = s.db.QueryRow("SELECT COUNT(*) FROM attendance WHERE status = 'authorized'").Scan(&authorized)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get authorized count: %w", err)
+	value, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, "", ErrInvalidCursor
 	}
-	err = s.db.QueryRow("SELECT COUNT(*) FROM attendance WHERE status = 'unauthorized'").Scan(&unauthorized)
+
+	ts, err := time.Parse(time.RFC3339Nano, value)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get unauthorized count: %w", err)
+		return time.Time{}, "", ErrInvalidCursor
 	}
-	stats["authorized"] = authorized
-	stats["unauthorized"] = unauthorized
+	return ts, id, nil
+}
+
+func (s *AttendanceService) GetAttendanceByName(name string, limit int) ([]domain.AttendanceRecord, error) {
+	return s.queryRecords("WHERE name = ? ORDER BY timestamp DESC LIMIT ?", name, limit)
+}
+
+// GetAttendanceByExternalID returns the records of a submission by the
+// client's reference; a multi-face submission has one per face
+func (s *AttendanceService) GetAttendanceByExternalID(externalID string) ([]domain.AttendanceRecord, error) {
+	return s.queryRecords("WHERE external_id = ? AND external_id != '' ORDER BY timestamp, name", externalID)
+}
 
-	// Unique people
-	var uniquePeople int
-	err = s.db.QueryRow("SELECT COUNT(DISTINCT name) FROM attendance WHERE status = 'authorized'").Scan(&uniquePeople)
+// GetAttendanceStats aggregates attendance, optionally only for the members
+// of a department or group and the records of a device or location.
+// Dashboards poll it, so every figure comes from a single pass over the
+// records.
+func (s *AttendanceService) GetAttendanceStats(filter domain.GroupFilter, source domain.SourceFilter) (map[string]interface{}, error) {
+	now := s.now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	week := s.calendar.WeekStart(now)
+
+	var (
+		total, authorized, unauthorized, uniquePeople, observeOnly int
+		todayStats, weekStats                                      domain.PeriodStats
+		punctuality                                                domain.PunctualitySummary
+		avgLateMin                                                 float64
+	)
+	// One pass over the records gives the all-time figures; the people are
+	// counted on the (status, name) index and this week's figures read
+	// through the timestamp index, in the same statement. With no records
+	// the join is empty and the week's columns are NULL rather than zero.
+	group, groupArgs := groupClause(filter)
+	sourceWhere, sourceArgs := sourceClause(source)
+	where := group + " AND " + sourceWhere
+	args := append(append([]interface{}{}, groupArgs...), sourceArgs...)
+	params := append(append([]interface{}{}, args...), today, today, today, week)
+	params = append(append(params, args...), args...)
+	err := s.reads.QueryRow(`
+		SELECT COUNT(*),
+		       COALESCE(SUM(status = 'authorized'), 0),
+		       COALESCE(SUM(status = 'unauthorized'), 0),
+		       (SELECT COUNT(DISTINCT name) FROM attendance WHERE status = 'authorized' AND `+where+`),
+		       COALESCE(SUM(observe_only), 0),
+		       COUNT(lateness_minutes), COALESCE(SUM(late), 0),
+		       COALESCE(AVG(lateness_minutes), 0), COALESCE(SUM(early_leave), 0),
+		       COALESCE(week.today_total, 0), COALESCE(week.today_authorized, 0), COALESCE(week.today_people, 0),
+		       COALESCE(week.total, 0), COALESCE(week.authorized, 0), COALESCE(week.people, 0)
+		FROM attendance, (
+			SELECT COALESCE(SUM(timestamp >= ?), 0) AS today_total,
+			       COALESCE(SUM(timestamp >= ? AND status = 'authorized'), 0) AS today_authorized,
+			       COUNT(DISTINCT CASE WHEN timestamp >= ? AND status = 'authorized' THEN name END) AS today_people,
+			       COUNT(*) AS total,
+			       COALESCE(SUM(status = 'authorized'), 0) AS authorized,
+			       COUNT(DISTINCT CASE WHEN status = 'authorized' THEN name END) AS people
+			FROM attendance
+			WHERE timestamp >= ? AND `+where+`
+		) AS week
+		WHERE `+where, params...).Scan(
+		&total, &authorized, &unauthorized, &uniquePeople, &observeOnly,
+		&punctuality.CheckIns, &punctuality.Late, &avgLateMin, &punctuality.EarlyLeaves,
+		&todayStats.Total, &todayStats.Authorized, &todayStats.UniquePeople,
+		&weekStats.Total, &weekStats.Authorized, &weekStats.UniquePeople)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get unique people: %w", err)
+		return nil, fmt.Errorf("failed to aggregate attendance: %w", err)
+	}
+
+	todayStats.From = today
+	todayStats.Unauthorized = todayStats.Total - todayStats.Authorized
+	weekStats.From = week
+	weekStats.Unauthorized = weekStats.Total - weekStats.Authorized
+	finishPunctuality(&punctuality, avgLateMin)
+
+	stats := map[string]interface{}{
+		"total":         total,
+		"authorized":    authorized,
+		"unauthorized":  unauthorized,
+		"unique_people": uniquePeople,
+		"observe_only":  observeOnly,
+		"today":         todayStats,
+		"this_week":     weekStats,
+		"punctuality":   &punctuality,
+	}
+
+	if !filter.IsEmpty() {
+		var members int
+		err = s.reads.QueryRow("SELECT COUNT(*) FROM people WHERE "+group, groupArgs...).Scan(&members)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get member count: %w", err)
+		}
+		stats["members"] = members
 	}
-	stats["unique_people"] = uniquePeople
 
 	return stats, nil
 }
 
-func (s *AttendanceService) GetSSEStats() map[string]interface{} {
+// GetSSEStats describes the event stream fan-out: the connected clients,
+// how full their queues are and the events they missed
+func (s *AttendanceService) GetSSEStats() domain.StreamStats {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	activeClients := 0
+	stats := domain.StreamStats{
+		Clients:          s.activeClients(),
+		MaxClients:       s.cfg.StreamMaxClients,
+		ClientBuffer:     s.cfg.StreamClientBuffer,
+		SlowClient:       s.cfg.StreamSlowClient,
+		FanOutQueued:     len(s.fanOutQueue),
+		Delivered:        s.streamTotals.delivered.Load(),
+		Dropped:          s.streamTotals.dropped.Load(),
+		SlowDisconnected: s.streamTotals.slowDisconnected.Load(),
+		FanOutDropped:    s.streamTotals.fanOutDropped.Load(),
+		Streams:          []domain.StreamClientStats{},
+	}
 	for _, client := range s.clients {
-		if client.active {
-			activeClients++
+		if client.active() {
+			stats.Streams = append(stats.Streams, client.stats())
 		}
 	}
+	slices.SortFunc(stats.Streams, func(a, b domain.StreamClientStats) int {
+		return a.ConnectedAt.Compare(b.ConnectedAt)
+	})
+	return stats
+}
 
-	return map[string]interface{}{
-		"total_clients":  len(s.clients),
-		"active_clients": activeClients,
+// activeClients counts the connected stream clients. The caller holds s.mu.
+func (s *AttendanceService) activeClients() int {
+	active := 0
+	for _, client := range s.clients {
+		if client.active() {
+			active++
+		}
 	}
+	return active
 }
 
 // Periodic cleanup of stale connections (called as goroutine)
@@ -371,7 +1464,7 @@ func (s *AttendanceService) cleanupStaleConnections() {
 	for {
 		select {
 		case <-s.ctx.Done():
-			log.Println("🛑 SSE: Cleanup goroutine stopped")
+			s.logger.Debug("SSE cleanup stopped")
 			return
 		case <-ticker.C:
 			s.mu.Lock()
@@ -379,15 +1472,15 @@ func (s *AttendanceService) cleanupStaleConnections() {
 
 			// Remove inactive clients
 			for clientID, client := range s.clients {
-				if !client.active {
+				if !client.active() {
 					delete(s.clients, clientID)
-					log.Printf("🧹 SSE: Cleaned up inactive client %s", clientID)
+					s.logger.Info("Cleaned up inactive SSE client", "client_id", clientID)
 				}
 			}
 
 			after := len(s.clients)
 			if before != after {
-				log.Printf("🧹 SSE: Cleanup removed %d stale clients (%d → %d)", before-after, before, after)
+				s.logger.Info("SSE cleanup removed stale clients", "removed", before-after, "clients", after)
 			}
 
 			s.mu.Unlock()
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"attendance-api/internal/client"
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+)
+
+func newTestAttendanceService(t *testing.T, faces client.Recognizer, cfg config.AttendanceConfig) *AttendanceService {
+	t.Helper()
+
+	dbPath := filepath.Join(t.TempDir(), "attendance.db")
+	dbCfg := config.DatabaseConfig{WritePoolSize: 1, ReadPoolSize: 2, BusyTimeout: 5 * time.Second}
+	db, err := OpenDatabase(dbPath, time.Local, dbCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	reads, err := OpenReadPool(dbPath, time.Local, dbCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reads.Close() })
+
+	calendar, err := NewCalendarService(db, config.CalendarConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := NewSnapshotService(db, reads, nil, nil, config.SnapshotConfig{Policy: domain.CaptureNever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The built-in tag rules depend on the day the test runs
+	cfg.TagRules = []string{"none"}
+	s, err := NewAttendanceService(faces, db, reads, calendar, snapshots, nil, nil, nil, nil, nil, nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// A recognition at a door that the cooldown drops must not become the
+// door's record: once the cooldown is over, the door's other camera records
+// the person instead of merging into a record that was never saved.
+func TestDoorSightingAfterCooldown(t *testing.T) {
+	ctx := context.Background()
+	photo := []byte("alice-photo")
+
+	faces := client.NewFakeRecognizer()
+	if _, err := faces.AddFace(ctx, "alice", [][]byte{photo}, []string{"alice.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestAttendanceService(t, faces, config.AttendanceConfig{
+		Cooldown:   100 * time.Millisecond,
+		Doors:      []string{"front=cam-a|cam-b"},
+		DoorWindow: time.Minute,
+	})
+
+	record := func(device string) domain.FaceOutcome {
+		t.Helper()
+		response, err := s.RecordAttendance(ctx, domain.AttendanceSubmission{ImageData: photo, Filename: "frame.jpg", DeviceID: device})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response.Faces[0]
+	}
+
+	if outcome := record("lobby"); outcome.Duplicate {
+		t.Fatal("first recognition not recorded")
+	}
+	if outcome := record("cam-a"); !outcome.Duplicate {
+		t.Fatal("recognition within the cooldown was recorded")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if outcome := record("cam-b"); outcome.Duplicate {
+		t.Error("recognition after the cooldown was taken as a duplicate")
+	}
+
+	page, err := s.GetRecentAttendance(domain.AttendanceQuery{Name: "alice", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 {
+		t.Errorf("%d record(s) of alice, want 2", page.Total)
+	}
+}
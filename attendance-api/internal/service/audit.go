@@ -0,0 +1,141 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"attendance-api/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// AuditService keeps the audit log: who did what through the API, from
+// where, and how many rows it handed out
+type AuditService struct {
+	db    *sql.DB
+	reads *sql.DB
+}
+
+func NewAuditService(db, reads *sql.DB) (*AuditService, error) {
+	service := &AuditService{db: db, reads: reads}
+
+	if err := service.initSchema(); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	return service, nil
+}
+
+func (s *AuditService) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id TEXT PRIMARY KEY,
+		timestamp DATETIME NOT NULL,
+		actor_type TEXT NOT NULL,
+		actor_id TEXT NOT NULL DEFAULT '',
+		actor_name TEXT NOT NULL DEFAULT '',
+		tenant TEXT NOT NULL DEFAULT '',
+		device TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		resource TEXT NOT NULL DEFAULT '',
+		summary TEXT NOT NULL DEFAULT '',
+		rows INTEGER
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_audit_log_timestamp ON audit_log(timestamp DESC);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action, timestamp DESC);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+	return nil
+}
+
+// Record appends an entry to the audit log, stamping it with an ID and,
+// unless set, the current time
+func (s *AuditService) Record(entry domain.AuditEntry) error {
+	entry.ID = uuid.New().String()
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO audit_log (id, timestamp, actor_type, actor_id, actor_name, tenant, device, ip, action, resource, summary, rows)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.ID, entry.Timestamp, entry.Actor.Type, entry.Actor.ID, entry.Actor.Name, entry.Actor.Tenant,
+		entry.Actor.Device, entry.IP, entry.Action, entry.Resource, entry.Summary, entry.Rows)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+	return nil
+}
+
+// List returns the entries matching the query, newest first, and how many
+// match in total
+func (s *AuditService) List(q domain.AuditQuery) ([]domain.AuditEntry, int, error) {
+	var conditions []string
+	var args []interface{}
+
+	if q.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, q.Action)
+	}
+	if q.ActorID != "" {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, q.ActorID)
+	}
+	if !q.From.IsZero() {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, q.From)
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, "timestamp < ?")
+		args = append(args, q.To)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := s.reads.QueryRow("SELECT COUNT(*) FROM audit_log"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	rows, err := s.reads.Query(`
+		SELECT id, timestamp, actor_type, actor_id, actor_name, tenant, device, ip, action, resource, summary, rows
+		FROM audit_log`+where+`
+		ORDER BY timestamp DESC, id
+		LIMIT ? OFFSET ?
+	`, append(args, q.Limit, q.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]domain.AuditEntry, 0)
+	for rows.Next() {
+		var entry domain.AuditEntry
+		var count sql.NullInt64
+		err := rows.Scan(&entry.ID, &entry.Timestamp, &entry.Actor.Type, &entry.Actor.ID, &entry.Actor.Name,
+			&entry.Actor.Tenant, &entry.Actor.Device, &entry.IP, &entry.Action, &entry.Resource, &entry.Summary, &count)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		if count.Valid {
+			n := int(count.Int64)
+			entry.Rows = &n
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("row iteration error: %w", err)
+	}
+	return entries, total, nil
+}
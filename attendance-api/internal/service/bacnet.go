@@ -0,0 +1,165 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"time"
+)
+
+// BACnet object types the building bridge can write the present value of
+var bacnetObjectTypes = map[string]uint32{
+	"analog-output": 1,
+	"analog-value":  2,
+	"binary-output": 4,
+	"binary-value":  5,
+}
+
+const (
+	bacnetWriteProperty = 15
+	bacnetPresentValue  = 85
+)
+
+// bacnetClient writes the present value of objects of a BACnet/IP device
+// with confirmed WriteProperty requests. It is not safe for concurrent use.
+type bacnetClient struct {
+	addr     string
+	priority int
+	timeout  time.Duration
+
+	conn     *net.UDPConn
+	invokeID byte
+}
+
+func newBACnetClient(addr string, priority int, timeout time.Duration) (*bacnetClient, error) {
+	if priority < 0 || priority > 16 {
+		return nil, fmt.Errorf("invalid BACnet priority %d, expected 1-16 or 0 for none", priority)
+	}
+	return &bacnetClient{addr: addr, priority: priority, timeout: timeout}, nil
+}
+
+// writeReal writes an analog object
+func (c *bacnetClient) writeReal(objectType, instance uint32, value float64) error {
+	encoded := make([]byte, 5)
+	encoded[0] = 0x44 // application tag 4 (REAL), length 4
+	binary.BigEndian.PutUint32(encoded[1:], math.Float32bits(float32(value)))
+	return c.writeProperty(objectType, instance, encoded)
+}
+
+// writeBinary writes a binary object, active or inactive
+func (c *bacnetClient) writeBinary(objectType, instance uint32, active bool) error {
+	encoded := []byte{0x91, 0} // application tag 9 (ENUMERATED), length 1
+	if active {
+		encoded[1] = 1
+	}
+	return c.writeProperty(objectType, instance, encoded)
+}
+
+func (c *bacnetClient) writeProperty(objectType, instance uint32, value []byte) error {
+	if c.conn == nil {
+		remote, err := net.ResolveUDPAddr("udp", c.addr)
+		if err != nil {
+			return err
+		}
+		conn, err := net.DialUDP("udp", nil, remote)
+		if err != nil {
+			return err
+		}
+		c.conn = conn
+	}
+	c.invokeID++
+
+	apdu := []byte{
+		0x00, // confirmed request, unsegmented
+		0x05, // accepts up to 1476 bytes
+		c.invokeID,
+		bacnetWriteProperty,
+		0x0C, 0, 0, 0, 0, // context tag 0: object identifier
+		0x19, bacnetPresentValue, // context tag 1: property
+		0x3E, // opening tag 3: value
+	}
+	binary.BigEndian.PutUint32(apdu[5:], objectType<<22|instance&0x3FFFFF)
+	apdu = append(apdu, value...)
+	apdu = append(apdu, 0x3F) // closing tag 3
+	if c.priority > 0 {
+		apdu = append(apdu, 0x49, byte(c.priority)) // context tag 4: priority
+	}
+
+	// BVLC original unicast, then an NPDU expecting a reply
+	packet := []byte{0x81, 0x0A, 0, 0, 0x01, 0x04}
+	packet = append(packet, apdu...)
+	binary.BigEndian.PutUint16(packet[2:], uint16(len(packet)))
+
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := c.conn.Write(packet); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		done, err := c.reply(buf[:n])
+		if done {
+			return err
+		}
+	}
+}
+
+// reply checks whether a packet answers the current request, and how
+func (c *bacnetClient) reply(packet []byte) (bool, error) {
+	if len(packet) < 6 || packet[0] != 0x81 || packet[4] != 0x01 {
+		return false, nil
+	}
+
+	// Skip the NPDU's optional destination and source addresses
+	control := packet[5]
+	if control&0x80 != 0 {
+		return false, nil // network layer message
+	}
+	i := 6
+	if control&0x20 != 0 && len(packet) > i+2 {
+		i += 3 + int(packet[i+2])
+	}
+	if control&0x08 != 0 && len(packet) > i+2 {
+		i += 3 + int(packet[i+2])
+	}
+	if control&0x20 != 0 {
+		i++ // hop count
+	}
+	if len(packet) < i+2 {
+		return false, nil
+	}
+
+	apdu := packet[i:]
+	if apdu[1] != c.invokeID {
+		return false, nil
+	}
+	switch apdu[0] >> 4 {
+	case 2: // simple ack
+		return true, nil
+	case 5:
+		if len(apdu) >= 7 {
+			return true, fmt.Errorf("BACnet error: class %d, code %d", apdu[4], apdu[6])
+		}
+		return true, errors.New("BACnet error")
+	case 6:
+		return true, fmt.Errorf("BACnet reject: reason %d", apdu[len(apdu)-1])
+	case 7:
+		return true, fmt.Errorf("BACnet abort: reason %d", apdu[len(apdu)-1])
+	}
+	return false, nil
+}
+
+func (c *bacnetClient) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeBACnetDevice answers each request packet with the packets respond
+// returns, handing the requests to the test
+func fakeBACnetDevice(t *testing.T, respond func(request []byte) [][]byte) (string, <-chan []byte) {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	requests := make(chan []byte, 16)
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, remote, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			request := append([]byte{}, buf[:n]...)
+			requests <- request
+			for _, reply := range respond(request) {
+				conn.WriteToUDP(reply, remote)
+			}
+		}
+	}()
+	return conn.LocalAddr().String(), requests
+}
+
+// bacnetReply wraps an APDU in a BVLC original unicast and an NPDU, with
+// the optional source address of a routed reply
+func bacnetReply(source []byte, apdu ...byte) []byte {
+	packet := []byte{0x81, 0x0A, 0, 0, 0x01, 0x00}
+	if source != nil {
+		packet[5] |= 0x08
+		packet = append(packet, 0x00, 0x02, byte(len(source))) // network 2
+		packet = append(packet, source...)
+	}
+	packet = append(packet, apdu...)
+	binary.BigEndian.PutUint16(packet[2:], uint16(len(packet)))
+	return packet
+}
+
+// WriteProperty requests carry the object, the present value and the
+// priority; acks complete them, routed or not, and error, reject and abort
+// PDUs fail them with their reason. Replies to another invoke ID are
+// ignored.
+func TestBACnetFrames(t *testing.T) {
+	addr, requests := fakeBACnetDevice(t, func(request []byte) [][]byte {
+		invokeID := request[8]
+		switch invokeID {
+		case 1:
+			stale := bacnetReply(nil, 0x20, invokeID-1, bacnetWriteProperty)
+			return [][]byte{stale, bacnetReply(nil, 0x20, invokeID, bacnetWriteProperty)}
+		case 2:
+			// Error class property (2), code write-access-denied (40)
+			return [][]byte{bacnetReply(nil, 0x50, invokeID, bacnetWriteProperty, 0x91, 2, 0x91, 40)}
+		case 3:
+			return [][]byte{bacnetReply(nil, 0x60, invokeID, 9)}
+		case 4:
+			return [][]byte{bacnetReply(nil, 0x70, invokeID, 4)}
+		default:
+			return [][]byte{bacnetReply([]byte{0x0A, 0x00, 0x00, 0x07}, 0x20, invokeID, bacnetWriteProperty)}
+		}
+	})
+
+	client, err := newBACnetClient(addr, 8, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := client.writeBinary(bacnetObjectTypes["binary-output"], 7, true); err != nil {
+		t.Fatalf("binary write: %v", err)
+	}
+	want := []byte{
+		0x81, 0x0A, 0x00, 0x17, // BVLC original unicast, 23 bytes
+		0x01, 0x04, // NPDU expecting a reply
+		0x00, 0x05, 0x01, 0x0F, // confirmed WriteProperty, invoke ID 1
+		0x0C, 0x01, 0x00, 0x00, 0x07, // binary-output 7
+		0x19, 0x55, // present-value
+		0x3E, 0x91, 0x01, 0x3F, // active
+		0x49, 0x08, // priority 8
+	}
+	if got := <-requests; !bytes.Equal(got, want) {
+		t.Errorf("binary write packet % X, want % X", got, want)
+	}
+
+	err = client.writeReal(bacnetObjectTypes["analog-value"], 3, 21.5)
+	want = []byte{
+		0x81, 0x0A, 0x00, 0x1A,
+		0x01, 0x04,
+		0x00, 0x05, 0x02, 0x0F,
+		0x0C, 0x00, 0x80, 0x00, 0x03, // analog-value 3
+		0x19, 0x55,
+		0x3E, 0x44, 0x41, 0xAC, 0x00, 0x00, 0x3F, // REAL 21.5
+		0x49, 0x08,
+	}
+	if got := <-requests; !bytes.Equal(got, want) {
+		t.Errorf("analog write packet % X, want % X", got, want)
+	}
+	if err == nil || err.Error() != "BACnet error: class 2, code 40" {
+		t.Errorf("error PDU: %v", err)
+	}
+
+	for _, expected := range []string{"BACnet reject: reason 9", "BACnet abort: reason 4"} {
+		if err := client.writeBinary(bacnetObjectTypes["binary-value"], 1, false); err == nil || err.Error() != expected {
+			t.Errorf("got %v, want %s", err, expected)
+		}
+		<-requests
+	}
+
+	if err := client.writeBinary(bacnetObjectTypes["binary-value"], 1, false); err != nil {
+		t.Errorf("routed ack: %v", err)
+	}
+	<-requests
+}
+
+// Without a priority the request ends with the value
+func TestBACnetWithoutPriority(t *testing.T) {
+	addr, requests := fakeBACnetDevice(t, func(request []byte) [][]byte {
+		return [][]byte{bacnetReply(nil, 0x20, request[8], bacnetWriteProperty)}
+	})
+
+	client, err := newBACnetClient(addr, 0, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := client.writeBinary(bacnetObjectTypes["binary-value"], 2, false); err != nil {
+		t.Fatal(err)
+	}
+	got := <-requests
+	if want := []byte{0x3E, 0x91, 0x00, 0x3F}; !bytes.HasSuffix(got, want) {
+		t.Errorf("packet % X does not end with the value % X", got, want)
+	}
+}
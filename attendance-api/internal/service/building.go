@@ -0,0 +1,394 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+)
+
+const (
+	// buildingQueueSize bounds the writes waiting for the BMS
+	buildingQueueSize = 256
+	// buildingDrainTimeout bounds the wait for door signals to be reset on
+	// shutdown
+	buildingDrainTimeout = 5 * time.Second
+)
+
+// buildingPoint is a configured point with its parsed address
+type buildingPoint struct {
+	domain.BuildingPoint
+	kind   string // Modbus "holding" or "coil", or a BACnet object type
+	number uint32 // register address or object instance
+	pulse  *time.Timer
+}
+
+// buildingWrite is a value to write to a point; a negative point asks for
+// the occupancy to be counted and written to every occupancy point
+type buildingWrite struct {
+	point int
+	value float64
+	force bool // write even when unchanged
+}
+
+// BuildingBridge writes door events and occupancy to a building management
+// system over Modbus TCP or BACnet/IP, so HVAC and lighting automation can
+// react to people arriving and leaving. Writes are queued and sent by a
+// single worker so an unreachable BMS never holds up a door; failed writes
+// are logged and made up for by the next change or the periodic sync.
+type BuildingBridge struct {
+	cfg    config.BuildingConfig
+	target *url.URL
+	reads  *sql.DB
+	loc    *time.Location // zone of the site, in which days begin and end
+
+	modbus *modbusClient
+	bacnet *bacnetClient
+
+	mu        sync.Mutex
+	points    []*buildingPoint
+	occupancy int
+
+	queue  chan buildingWrite
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	logger *slog.Logger
+}
+
+// NewBuildingBridge validates the configuration and starts the bridge. It
+// returns nil when no target is configured; a nil bridge ignores events.
+func NewBuildingBridge(reads *sql.DB, loc *time.Location, cfg config.BuildingConfig) (*BuildingBridge, error) {
+	if cfg.Target == "" {
+		return nil, nil
+	}
+
+	target, err := url.Parse(cfg.Target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid building target %q: %w", cfg.Target, err)
+	}
+
+	b := &BuildingBridge{
+		logger: logging.Component("building"),
+		cfg:    cfg,
+		target: target,
+		reads:  reads,
+		loc:    loc,
+		queue:  make(chan buildingWrite, buildingQueueSize),
+		done:   make(chan struct{}),
+	}
+
+	switch target.Scheme {
+	case "modbus":
+		if b.modbus, err = newModbusClient(hostPort(target, "502"), cfg.UnitID, cfg.Timeout); err != nil {
+			return nil, err
+		}
+	case "bacnet":
+		if b.bacnet, err = newBACnetClient(hostPort(target, "47808"), cfg.Priority, cfg.Timeout); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported building target %q, expected modbus:// or bacnet://", cfg.Target)
+	}
+
+	if len(cfg.Points) == 0 {
+		return nil, fmt.Errorf("BUILDING_POINTS is required with a building target")
+	}
+	for _, entry := range cfg.Points {
+		point, err := b.parsePoint(entry)
+		if err != nil {
+			return nil, err
+		}
+		b.points = append(b.points, point)
+	}
+
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	return b, nil
+}
+
+// Start starts writing to the BMS, beginning with the occupancy. It is
+// called once the attendance schema exists.
+func (b *BuildingBridge) Start() {
+	if b == nil {
+		return
+	}
+
+	go b.run()
+	b.logger.Info("Bridging points to the building management system", "points", len(b.points), "target", b.target.Scheme+"://"+b.target.Host)
+}
+
+func hostPort(target *url.URL, defaultPort string) string {
+	if target.Port() == "" {
+		return target.Hostname() + ":" + defaultPort
+	}
+	return target.Host
+}
+
+// parsePoint reads a "signal[@device]=address" mapping
+func (b *BuildingBridge) parsePoint(entry string) (*buildingPoint, error) {
+	signal, address, ok := strings.Cut(entry, "=")
+	signal, address = strings.TrimSpace(signal), strings.TrimSpace(address)
+	if !ok || address == "" {
+		return nil, fmt.Errorf("invalid building point %q, expected signal=address", entry)
+	}
+	signal, device, _ := strings.Cut(signal, "@")
+
+	switch signal {
+	case domain.SignalDoorOpen, domain.SignalDoorDenied:
+	case domain.SignalOccupancy:
+		if device != "" {
+			return nil, fmt.Errorf("invalid building point %q, occupancy is not counted per device", entry)
+		}
+	default:
+		return nil, fmt.Errorf("unknown building signal %q, expected door_open, door_denied or occupancy", signal)
+	}
+
+	point := &buildingPoint{BuildingPoint: domain.BuildingPoint{Signal: signal, Device: device, Address: address}}
+
+	kind, number, found := strings.Cut(address, ":")
+	if !found {
+		kind, number = "", address
+	}
+	n, err := strconv.ParseUint(number, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid building point address %q", address)
+	}
+	point.number = uint32(n)
+
+	if b.modbus != nil {
+		switch kind {
+		case "", "holding":
+			point.kind = "holding"
+		case "coil":
+			point.kind = "coil"
+		default:
+			return nil, fmt.Errorf("invalid Modbus address %q, expected holding:N or coil:N", address)
+		}
+		if n > 0xFFFF {
+			return nil, fmt.Errorf("invalid Modbus address %q, registers go up to 65535", address)
+		}
+		return point, nil
+	}
+
+	if _, known := bacnetObjectTypes[kind]; !known {
+		return nil, fmt.Errorf("invalid BACnet address %q, expected analog-value:N, analog-output:N, binary-value:N or binary-output:N", address)
+	}
+	if n > 0x3FFFFF {
+		return nil, fmt.Errorf("invalid BACnet address %q, instances go up to 4194303", address)
+	}
+	point.kind = kind
+	return point, nil
+}
+
+// Emit signals a door event for a saved record. Door signals are set for
+// the configured pulse; a recognition that may have changed the occupancy
+// has it counted again. It never blocks.
+func (b *BuildingBridge) Emit(record domain.AttendanceRecord) {
+	if b == nil {
+		return
+	}
+
+	signal := domain.SignalDoorDenied
+	if record.Status == "authorized" {
+		if record.ObserveOnly {
+			// The door was not controlled, but the person is in
+			b.enqueue(buildingWrite{point: -1})
+			return
+		}
+		signal = domain.SignalDoorOpen
+	}
+
+	b.mu.Lock()
+	for i, point := range b.points {
+		if point.Signal != signal || (point.Device != "" && point.Device != record.DeviceID) {
+			continue
+		}
+		b.enqueue(buildingWrite{point: i, value: 1, force: true})
+
+		// A later event restarts the pulse instead of cutting it short
+		if point.pulse != nil {
+			point.pulse.Stop()
+		}
+		point.pulse = time.AfterFunc(b.cfg.Pulse, func() {
+			b.enqueue(buildingWrite{point: i, value: 0, force: true})
+		})
+	}
+	b.mu.Unlock()
+
+	if signal == domain.SignalDoorOpen {
+		b.enqueue(buildingWrite{point: -1})
+	}
+}
+
+func (b *BuildingBridge) enqueue(write buildingWrite) {
+	select {
+	case b.queue <- write:
+	default:
+		b.logger.Warn("Queue full, dropped a write")
+	}
+}
+
+// Close stops the bridge, resetting door signals that are still set
+func (b *BuildingBridge) Close() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	for i, point := range b.points {
+		if point.pulse != nil && point.pulse.Stop() {
+			b.enqueue(buildingWrite{point: i, value: 0, force: true})
+		}
+	}
+	b.mu.Unlock()
+
+	b.cancel()
+	select {
+	case <-b.done:
+	case <-time.After(buildingDrainTimeout):
+		b.logger.Warn("BMS too slow, not resetting door signals")
+	}
+}
+
+func (b *BuildingBridge) run() {
+	defer close(b.done)
+	defer func() {
+		if b.modbus != nil {
+			b.modbus.Close()
+		}
+		if b.bacnet != nil {
+			b.bacnet.Close()
+		}
+	}()
+
+	var resync <-chan time.Time
+	if b.cfg.SyncInterval > 0 {
+		ticker := time.NewTicker(b.cfg.SyncInterval)
+		defer ticker.Stop()
+		resync = ticker.C
+	}
+
+	b.syncOccupancy(true)
+	for {
+		select {
+		case write := <-b.queue:
+			b.apply(write)
+		case <-resync:
+			b.syncOccupancy(true)
+		case <-b.ctx.Done():
+			// Reset the door signals still queued, then stop
+			for {
+				select {
+				case write := <-b.queue:
+					if write.point >= 0 {
+						b.apply(write)
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *BuildingBridge) apply(write buildingWrite) {
+	if write.point < 0 {
+		b.syncOccupancy(write.force)
+		return
+	}
+	b.write(write.point, write.value, write.force)
+}
+
+// syncOccupancy counts the people checked in and not yet out today and
+// writes the count to the occupancy points
+func (b *BuildingBridge) syncOccupancy(force bool) {
+	var occupancy int
+	err := b.reads.QueryRow(`
+		SELECT COUNT(*) FROM attendance_sessions
+		WHERE day = ? AND check_out IS NULL
+	`, time.Now().In(b.loc).Format(dayFormat)).Scan(&occupancy)
+	if err != nil {
+		b.logger.Warn("Failed to count occupancy", "error", err)
+		return
+	}
+
+	b.mu.Lock()
+	b.occupancy = occupancy
+	b.mu.Unlock()
+
+	for i, point := range b.points {
+		if point.Signal == domain.SignalOccupancy {
+			b.write(i, float64(occupancy), force)
+		}
+	}
+}
+
+// write sends a value to a point unless it already holds it, and records
+// the outcome
+func (b *BuildingBridge) write(i int, value float64, force bool) {
+	b.mu.Lock()
+	point := b.points[i]
+	unchanged := point.Value != nil && *point.Value == value && point.Error == ""
+	b.mu.Unlock()
+	if unchanged && !force {
+		return
+	}
+
+	var err error
+	switch point.kind {
+	case "holding":
+		err = b.modbus.writeRegister(uint16(point.number), uint16(min(max(value, 0), 0xFFFF)))
+	case "coil":
+		err = b.modbus.writeCoil(uint16(point.number), value > 0)
+	case "binary-value", "binary-output":
+		err = b.bacnet.writeBinary(bacnetObjectTypes[point.kind], point.number, value > 0)
+	default:
+		err = b.bacnet.writeReal(bacnetObjectTypes[point.kind], point.number, value)
+	}
+
+	now := time.Now()
+	b.mu.Lock()
+	point.Value = &value
+	point.WrittenAt = &now
+	point.Error = ""
+	if err != nil {
+		point.Error = err.Error()
+	}
+	b.mu.Unlock()
+
+	if err != nil {
+		b.logger.Warn("Failed to write point", "signal", point.Signal, "address", point.Address, "error", err)
+	}
+}
+
+// Status returns the bridge's points with the last values written
+func (b *BuildingBridge) Status() domain.BuildingStatus {
+	if b == nil {
+		return domain.BuildingStatus{Points: []domain.BuildingPoint{}}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := domain.BuildingStatus{
+		Enabled:   true,
+		Protocol:  b.target.Scheme,
+		Target:    b.target.Host,
+		Occupancy: b.occupancy,
+		Points:    make([]domain.BuildingPoint, 0, len(b.points)),
+	}
+	for _, point := range b.points {
+		status.Points = append(status.Points, point.BuildingPoint)
+	}
+	return status
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+)
+
+var (
+	ErrHolidayNotFound = errors.New("holiday not found")
+	ErrInvalidHoliday  = errors.New("invalid holiday")
+)
+
+// CalendarService knows which days are workdays: every day except the
+// configured weekend days and the holidays stored in the database.
+// Reports use it so that weekends and holidays do not count as absences.
+type CalendarService struct {
+	db      *sql.DB
+	weekend map[time.Weekday]bool
+}
+
+func NewCalendarService(db *sql.DB, cfg config.CalendarConfig) (*CalendarService, error) {
+	weekend := make(map[time.Weekday]bool)
+	for _, name := range cfg.Weekend {
+		day, err := parseWeekday(name)
+		if err != nil {
+			return nil, err
+		}
+		weekend[day] = true
+	}
+
+	service := &CalendarService{
+		db:      db,
+		weekend: weekend,
+	}
+
+	if err := service.initSchema(); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	return service, nil
+}
+
+func (s *CalendarService) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS holidays (
+		date TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		recurring INTEGER NOT NULL DEFAULT 0
+	);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+
+	return nil
+}
+
+// Weekend returns the configured weekend days
+func (s *CalendarService) Weekend() []time.Weekday {
+	days := []time.Weekday{}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if s.weekend[day] {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// GetCalendar lists the days between from and to (inclusive) with whether
+// each is a workday and, for holidays, the holiday name
+func (s *CalendarService) GetCalendar(from, to time.Time) ([]domain.CalendarDay, error) {
+	holidays, err := s.holidaysBetween(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	days := []domain.CalendarDay{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(dayFormat)
+		entry := domain.CalendarDay{
+			Date:    date,
+			Weekday: day.Weekday().String(),
+			Weekend: s.weekend[day.Weekday()],
+			Holiday: holidays[date],
+		}
+		entry.Workday = !entry.Weekend && entry.Holiday == ""
+		days = append(days, entry)
+	}
+
+	return days, nil
+}
+
+// IsWorkday reports whether people are expected at work on the given day
+func (s *CalendarService) IsWorkday(day time.Time) (bool, error) {
+	days, err := s.GetCalendar(day, day)
+	if err != nil {
+		return false, err
+	}
+	return days[0].Workday, nil
+}
+
+// WeekStart returns the midnight starting the week of t: the first day after
+// the weekend, or Monday when no weekend is configured
+func (s *CalendarService) WeekStart(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if len(s.weekend) == 0 || len(s.weekend) == 7 {
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	for !s.weekend[day.AddDate(0, 0, -1).Weekday()] || s.weekend[day.Weekday()] {
+		day = day.AddDate(0, 0, -1)
+	}
+	return day
+}
+
+// holidaysBetween maps each date between from and to that is a holiday to
+// its name, expanding recurring holidays to every year in the range
+func (s *CalendarService) holidaysBetween(from, to time.Time) (map[string]string, error) {
+	holidays, err := s.ListHolidays()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string)
+	for _, holiday := range holidays {
+		if !holiday.Recurring {
+			result[holiday.Date] = holiday.Name
+			continue
+		}
+		for year := from.Year(); year <= to.Year(); year++ {
+			result[strconv.Itoa(year)+holiday.Date[4:]] = holiday.Name
+		}
+	}
+
+	return result, nil
+}
+
+// ListHolidays returns every stored holiday
+func (s *CalendarService) ListHolidays() ([]domain.Holiday, error) {
+	rows, err := s.db.Query("SELECT date, name, recurring FROM holidays ORDER BY date")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query holidays: %w", err)
+	}
+	defer rows.Close()
+
+	holidays := []domain.Holiday{}
+	for rows.Next() {
+		var holiday domain.Holiday
+		if err := rows.Scan(&holiday.Date, &holiday.Name, &holiday.Recurring); err != nil {
+			return nil, fmt.Errorf("failed to scan holiday: %w", err)
+		}
+		holidays = append(holidays, holiday)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return holidays, nil
+}
+
+// SetHoliday adds a holiday, replacing any existing one on the same date
+func (s *CalendarService) SetHoliday(holiday domain.Holiday) (*domain.Holiday, error) {
+	if _, err := time.Parse(dayFormat, holiday.Date); err != nil {
+		return nil, fmt.Errorf("%w: date must be YYYY-MM-DD", ErrInvalidHoliday)
+	}
+	holiday.Name = strings.TrimSpace(holiday.Name)
+	if holiday.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidHoliday)
+	}
+
+	_, err := s.db.Exec("INSERT OR REPLACE INTO holidays (date, name, recurring) VALUES (?, ?, ?)",
+		holiday.Date, holiday.Name, holiday.Recurring)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert holiday: %w", err)
+	}
+
+	return &holiday, nil
+}
+
+func (s *CalendarService) DeleteHoliday(date string) error {
+	result, err := s.db.Exec("DELETE FROM holidays WHERE date = ?", date)
+	if err != nil {
+		return fmt.Errorf("failed to delete holiday: %w", err)
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrHolidayNotFound
+	}
+
+	return nil
+}
+
+// workdaySQL returns an SQL expression that is 1 when the YYYY-MM-DD value
+// in column is a workday and 0 otherwise
+func (s *CalendarService) workdaySQL(column string) string {
+	weekend := make([]string, 0, len(s.weekend))
+	for _, day := range s.Weekend() {
+		weekend = append(weekend, "'"+strconv.Itoa(int(day))+"'")
+	}
+
+	expr := "NOT EXISTS (SELECT 1 FROM holidays h WHERE h.date = " + column +
+		" OR (h.recurring = 1 AND substr(h.date, 5) = substr(" + column + ", 5)))"
+	if len(weekend) > 0 {
+		expr = "strftime('%w', " + column + ") NOT IN (" + strings.Join(weekend, ", ") + ") AND " + expr
+	}
+
+	return "(CASE WHEN " + expr + " THEN 1 ELSE 0 END)"
+}
+
+func parseWeekday(name string) (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(name, day.String()) || strings.EqualFold(name, day.String()[:3]) {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday %q", name)
+}
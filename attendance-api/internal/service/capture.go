@@ -0,0 +1,400 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+)
+
+// SnapshotService decides, by the capture policy, which recognitions have
+// their image stored. Unknown faces go to the review queue; the images of
+// recognized faces are kept with their attendance record.
+type SnapshotService struct {
+	db       *sql.DB
+	reads    *sql.DB
+	store    SnapshotStore
+	unknowns *UnknownService
+	policy   domain.CapturePolicy
+
+	logger *slog.Logger
+}
+
+func NewSnapshotService(db, reads *sql.DB, store SnapshotStore, unknowns *UnknownService, cfg config.SnapshotConfig) (*SnapshotService, error) {
+	policy := domain.CapturePolicy{
+		Default:       cfg.Policy,
+		LowConfidence: cfg.LowConfidence,
+	}
+	if !slices.Contains(domain.CapturePolicies, policy.Default) {
+		return nil, fmt.Errorf("unknown snapshot policy %q, expected one of %s", policy.Default, strings.Join(domain.CapturePolicies, ", "))
+	}
+
+	var err error
+	if policy.Tenants, err = parsePolicies(cfg.TenantPolicies, "tenant"); err != nil {
+		return nil, err
+	}
+	if policy.Locations, err = parsePolicies(cfg.LocationPolicies, "location"); err != nil {
+		return nil, err
+	}
+
+	service := &SnapshotService{
+		logger:   logging.Component("snapshots"),
+		db:       db,
+		reads:    reads,
+		store:    store,
+		unknowns: unknowns,
+		policy:   policy,
+	}
+
+	if err := service.initSchema(); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	return service, nil
+}
+
+// parsePolicies reads "name=policy" overrides
+func parsePolicies(entries []string, kind string) (map[string]string, error) {
+	policies := make(map[string]string)
+	for _, entry := range entries {
+		name, policy, ok := strings.Cut(entry, "=")
+		name, policy = strings.TrimSpace(name), strings.TrimSpace(policy)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid %s snapshot policy %q, expected %s=policy", kind, entry, kind)
+		}
+		if !slices.Contains(domain.CapturePolicies, policy) {
+			return nil, fmt.Errorf("unknown snapshot policy %q for %s %s", policy, kind, name)
+		}
+		policies[name] = policy
+	}
+	return policies, nil
+}
+
+func (s *SnapshotService) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS record_snapshots (
+		attendance_id TEXT PRIMARY KEY,
+		timestamp DATETIME NOT NULL,
+		policy TEXT NOT NULL,
+		image_key TEXT NOT NULL DEFAULT '',
+		crop_key TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_record_snapshots_timestamp ON record_snapshots(timestamp DESC);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+	return nil
+}
+
+// Policy returns the capture policy in force
+func (s *SnapshotService) Policy() domain.CapturePolicy {
+	return s.policy
+}
+
+// PolicyFor returns the policy applying at a location for a tenant
+func (s *SnapshotService) PolicyFor(tenant, location string) string {
+	if policy, ok := s.policy.Locations[location]; ok && location != "" {
+		return policy
+	}
+	if policy, ok := s.policy.Tenants[tenant]; ok && tenant != "" {
+		return policy
+	}
+	return s.policy.Default
+}
+
+// Captures reports whether the image of a record is to be stored, and under
+// which policy
+func (s *SnapshotService) Captures(record domain.AttendanceRecord) (string, bool) {
+	var tenant string
+	if record.Actor != nil {
+		tenant = record.Actor.Tenant
+	}
+	policy := s.PolicyFor(tenant, record.Location)
+	unknown := record.Name == "Unknown"
+
+	switch policy {
+	case domain.CaptureUnknown:
+		return policy, unknown
+	case domain.CaptureUnauthorized:
+		return policy, record.Status == "unauthorized"
+	case domain.CaptureLowConfidence:
+		return policy, unknown || record.Confidence < s.policy.LowConfidence
+	case domain.CaptureAlways:
+		return policy, true
+	default:
+		return policy, false
+	}
+}
+
+// Capture stores the image of a record captured under policy: an unknown
+// face is queued for review, any other face is kept with its record
+func (s *SnapshotService) Capture(record domain.AttendanceRecord, policy string, imageData []byte, location domain.FaceLocation) error {
+	if record.Name == "Unknown" {
+		event, err := s.unknowns.Capture(record, imageData, location)
+		if err != nil {
+			return fmt.Errorf("failed to capture unknown face: %w", err)
+		}
+		s.logger.Info("Captured unknown face", "unknown_id", event.ID, "crop", event.HasCrop)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), captureTimeout)
+	defer cancel()
+
+	prefix := "recognitions/" + record.Timestamp.Format("2006/01/02") + "/" + record.ID
+	contentType := http.DetectContentType(imageData)
+
+	imageKey := prefix + imageExtension(contentType)
+	if err := s.store.Put(ctx, imageKey, imageData, contentType); err != nil {
+		return fmt.Errorf("failed to store image: %w", err)
+	}
+
+	var cropKey string
+	if crop, err := cropFace(imageData, location); err == nil {
+		cropKey = prefix + "-face.jpg"
+		if err := s.store.Put(ctx, cropKey, crop, "image/jpeg"); err != nil {
+			return fmt.Errorf("failed to store face crop: %w", err)
+		}
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO record_snapshots (attendance_id, timestamp, policy, image_key, crop_key)
+		VALUES (?, ?, ?, ?, ?)
+	`, record.ID, record.Timestamp, policy, imageKey, cropKey)
+	if err != nil {
+		return fmt.Errorf("failed to insert record snapshot: %w", err)
+	}
+
+	s.logger.Info("Captured recognition", "record", record.ID, "person", record.Name, "policy", policy)
+	return nil
+}
+
+const recordSnapshotColumns = `s.attendance_id, s.timestamp, a.name, a.status, a.confidence, a.device_id,
+	a.location, a.tenant, s.policy, s.image_key, s.crop_key`
+
+// List returns the newest snapshots of recognized faces, optionally of one
+// person
+func (s *SnapshotService) List(name string, limit int) ([]domain.RecordSnapshot, error) {
+	rows, err := s.reads.Query(`
+		SELECT `+recordSnapshotColumns+`
+		FROM record_snapshots s
+		JOIN attendance a ON a.id = s.attendance_id
+		WHERE ? = '' OR a.name = ?
+		ORDER BY s.timestamp DESC
+		LIMIT ?
+	`, name, name, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query record snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	snapshots := []domain.RecordSnapshot{}
+	for rows.Next() {
+		snapshot, err := scanRecordSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return snapshots, nil
+}
+
+// Get returns the snapshot of an attendance record
+func (s *SnapshotService) Get(attendanceID string) (*domain.RecordSnapshot, error) {
+	snapshot, err := scanRecordSnapshot(s.db.QueryRow(`
+		SELECT `+recordSnapshotColumns+`
+		FROM record_snapshots s
+		JOIN attendance a ON a.id = s.attendance_id
+		WHERE s.attendance_id = ?
+	`, attendanceID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSnapshotNotFound
+	}
+	return snapshot, err
+}
+
+// Snapshot returns the stored full image of a record, or the face crop when
+// crop is set
+func (s *SnapshotService) Snapshot(ctx context.Context, attendanceID string, crop bool) ([]byte, error) {
+	snapshot, err := s.Get(attendanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	key := snapshot.ImageKey
+	if crop {
+		key = snapshot.CropKey
+	}
+	if key == "" {
+		return nil, ErrSnapshotNotFound
+	}
+
+	return s.store.Get(ctx, key)
+}
+
+// DeletePerson deletes the snapshots of a person's records, for when their
+// history is anonymized or deleted
+func (s *SnapshotService) DeletePerson(ctx context.Context, name string) (int, error) {
+	rows, err := s.db.Query(`
+		SELECT s.attendance_id, s.image_key, s.crop_key
+		FROM record_snapshots s
+		JOIN attendance a ON a.id = s.attendance_id
+		WHERE a.name = ?
+	`, name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query record snapshots: %w", err)
+	}
+
+	var ids, keys []string
+	for rows.Next() {
+		var id, imageKey, cropKey string
+		if err := rows.Scan(&id, &imageKey, &cropKey); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan record snapshot: %w", err)
+		}
+		ids = append(ids, id)
+		keys = append(keys, imageKey, cropKey)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := s.store.Delete(ctx, key); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, id := range ids {
+		if _, err := s.db.Exec("DELETE FROM record_snapshots WHERE attendance_id = ?", id); err != nil {
+			return 0, fmt.Errorf("failed to delete record snapshot: %w", err)
+		}
+	}
+
+	return len(ids), nil
+}
+
+// CountPerson counts the snapshots of a person's records, the ones
+// DeletePerson would delete
+func (s *SnapshotService) CountPerson(ctx context.Context, name string) (int, error) {
+	var count int
+	err := s.reads.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM record_snapshots s
+		JOIN attendance a ON a.id = s.attendance_id
+		WHERE a.name = ?
+	`, name).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count record snapshots: %w", err)
+	}
+	return count, nil
+}
+
+// PrivacyReport shows the capture policy in force and counts the images
+// stored between from and to, per location
+func (s *SnapshotService) PrivacyReport(from, to time.Time) (*domain.PrivacyReport, error) {
+	report := &domain.PrivacyReport{
+		From:      from,
+		To:        to,
+		Policy:    s.policy,
+		Locations: []domain.LocationCaptures{},
+	}
+
+	locations := make(map[string]*domain.LocationCaptures)
+	location := func(name string) *domain.LocationCaptures {
+		if captures, ok := locations[name]; ok {
+			return captures
+		}
+		captures := &domain.LocationCaptures{Location: name, Policy: s.PolicyFor("", name)}
+		locations[name] = captures
+		return captures
+	}
+
+	counts := []struct {
+		query string
+		add   func(captures *domain.LocationCaptures, n int)
+	}{
+		{`SELECT location, COUNT(*) FROM unknown_events
+			WHERE image_key != '' AND timestamp >= ? AND timestamp < ?
+			GROUP BY location`,
+			func(captures *domain.LocationCaptures, n int) { captures.UnknownFaces += n; report.UnknownFaces += n }},
+		{`SELECT a.location, COUNT(*) FROM record_snapshots s
+			JOIN attendance a ON a.id = s.attendance_id
+			WHERE s.timestamp >= ? AND s.timestamp < ?
+			GROUP BY a.location`,
+			func(captures *domain.LocationCaptures, n int) { captures.Recognitions += n; report.Recognitions += n }},
+	}
+	for _, count := range counts {
+		rows, err := s.reads.Query(count.query, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count snapshots: %w", err)
+		}
+		for rows.Next() {
+			var (
+				name string
+				n    int
+			)
+			if err := rows.Scan(&name, &n); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan snapshot count: %w", err)
+			}
+			count.add(location(name), n)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("row iteration error: %w", err)
+		}
+	}
+
+	// Locations with their own policy are listed even without snapshots
+	for name := range s.policy.Locations {
+		location(name)
+	}
+	for _, captures := range locations {
+		report.Locations = append(report.Locations, *captures)
+	}
+	slices.SortFunc(report.Locations, func(a, b domain.LocationCaptures) int {
+		return strings.Compare(a.Location, b.Location)
+	})
+
+	return report, nil
+}
+
+func scanRecordSnapshot(row rowScanner) (*domain.RecordSnapshot, error) {
+	var snapshot domain.RecordSnapshot
+
+	err := row.Scan(&snapshot.AttendanceID, &snapshot.Timestamp, &snapshot.Name, &snapshot.Status,
+		&snapshot.Confidence, &snapshot.DeviceID, &snapshot.Location, &snapshot.Tenant, &snapshot.Policy,
+		&snapshot.ImageKey, &snapshot.CropKey)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan record snapshot: %w", err)
+	}
+
+	snapshot.HasImage = snapshot.ImageKey != ""
+	snapshot.HasCrop = snapshot.CropKey != ""
+	return &snapshot, nil
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+)
+
+var ErrChangesPruned = errors.New("changes after this sequence number have been pruned")
+
+// changeTimeFormat sorts as text, so the retention can be applied with a
+// plain comparison
+const changeTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// ChangeFeed records every insert, update and delete of an attendance row,
+// with the row before and after, under a sequence number that only ever
+// grows, so downstream syncs such as a data warehouse can follow the table
+// instead of diffing exports. Triggers capture the changes, so imports,
+// merges, splits and history deletion are covered like new records.
+type ChangeFeed struct {
+	db        *sql.DB
+	reads     *sql.DB
+	retention atomic.Int64 // nanoseconds, zero keeps changes forever
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	logger *slog.Logger
+}
+
+// NewChangeFeed must run after the attendance schema is up to date, since
+// the triggers copy every column the attendance table has at startup
+func NewChangeFeed(db, reads *sql.DB, cfg config.ChangesConfig) (*ChangeFeed, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	feed := &ChangeFeed{db: db, reads: reads, ctx: ctx, cancel: cancel, logger: logging.Component("changes")}
+	feed.retention.Store(int64(cfg.Retention))
+
+	if err := feed.initSchema(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	go feed.pruneLoop()
+
+	return feed, nil
+}
+
+// Reconfigure applies a changed retention from the next hourly prune
+func (f *ChangeFeed) Reconfigure(cfg config.ChangesConfig) {
+	if old := time.Duration(f.retention.Swap(int64(cfg.Retention))); old != cfg.Retention {
+		f.logger.Info("Retention changed", "retention", cfg.Retention, "was", old)
+	}
+}
+
+func (f *ChangeFeed) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS attendance_changes (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		op TEXT NOT NULL,
+		record_id TEXT NOT NULL,
+		changed_at TEXT NOT NULL,
+		row_before TEXT,
+		row_after TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_attendance_changes_changed_at ON attendance_changes(changed_at);
+	`
+
+	if _, err := f.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+
+	columns, err := tableColumns(f.db, "attendance")
+	if err != nil {
+		return err
+	}
+
+	// The triggers are recreated on every start so columns added since are
+	// part of the row images
+	image := func(row string) string {
+		pairs := make([]string, len(columns))
+		for i, column := range columns {
+			pairs[i] = fmt.Sprintf(`'%s', %s."%s"`, column, row, column)
+		}
+		return "json_object(" + strings.Join(pairs, ", ") + ")"
+	}
+	now := `strftime('%Y-%m-%dT%H:%M:%fZ', 'now')`
+	triggers := []struct{ name, event, id, before, after string }{
+		{"attendance_changes_insert", "INSERT", "NEW.id", "NULL", image("NEW")},
+		{"attendance_changes_update", "UPDATE", "NEW.id", image("OLD"), image("NEW")},
+		{"attendance_changes_delete", "DELETE", "OLD.id", image("OLD"), "NULL"},
+	}
+
+	tx, err := f.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, trigger := range triggers {
+		if _, err := tx.Exec("DROP TRIGGER IF EXISTS " + trigger.name); err != nil {
+			return fmt.Errorf("failed to drop trigger %s: %w", trigger.name, err)
+		}
+		_, err := tx.Exec(fmt.Sprintf(`
+			CREATE TRIGGER %s AFTER %s ON attendance
+			BEGIN
+				INSERT INTO attendance_changes (op, record_id, changed_at, row_before, row_after)
+				VALUES ('%s', %s, %s, %s, %s);
+			END
+		`, trigger.name, trigger.event, strings.ToLower(trigger.event), trigger.id, now, trigger.before, trigger.after))
+		if err != nil {
+			return fmt.Errorf("failed to create trigger %s: %w", trigger.name, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Close stops pruning
+func (f *ChangeFeed) Close() {
+	f.cancel()
+}
+
+// Changes returns up to limit changes after the sequence number after, in
+// order, and the sequence number of the latest change. It returns
+// ErrChangesPruned when some of the changes a consumer at after has not
+// seen are gone, so it can resynchronize instead of silently missing them.
+func (f *ChangeFeed) Changes(after int64, limit int) ([]domain.AttendanceChange, int64, error) {
+	var oldest, last sql.NullInt64
+	err := f.reads.QueryRow(`
+		SELECT (SELECT MIN(seq) FROM attendance_changes),
+		       (SELECT seq FROM sqlite_sequence WHERE name = 'attendance_changes')
+	`).Scan(&oldest, &last)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query change range: %w", err)
+	}
+	if after < last.Int64 && (!oldest.Valid || after+1 < oldest.Int64) {
+		return nil, last.Int64, ErrChangesPruned
+	}
+
+	rows, err := f.reads.Query(`
+		SELECT seq, op, record_id, changed_at, row_before, row_after
+		FROM attendance_changes
+		WHERE seq > ?
+		ORDER BY seq
+		LIMIT ?
+	`, after, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []domain.AttendanceChange{}
+	for rows.Next() {
+		var (
+			change              domain.AttendanceChange
+			changedAt           string
+			rowBefore, rowAfter sql.NullString
+		)
+		if err := rows.Scan(&change.Seq, &change.Op, &change.RecordID, &changedAt, &rowBefore, &rowAfter); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan change: %w", err)
+		}
+		if change.ChangedAt, err = time.Parse(changeTimeFormat, changedAt); err != nil {
+			return nil, 0, fmt.Errorf("invalid time of change %d: %w", change.Seq, err)
+		}
+		if rowBefore.Valid {
+			change.Before = []byte(rowBefore.String)
+		}
+		if rowAfter.Valid {
+			change.After = []byte(rowAfter.String)
+		}
+		changes = append(changes, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	// Changes committed since the range was read may be part of the page
+	if len(changes) > 0 && changes[len(changes)-1].Seq > last.Int64 {
+		last.Int64 = changes[len(changes)-1].Seq
+	}
+	return changes, last.Int64, nil
+}
+
+// Follow sends the changes after the sequence number after as they happen,
+// until the context is cancelled or send fails
+func (f *ChangeFeed) Follow(ctx context.Context, after int64, send func(domain.AttendanceChange) error) error {
+	const batch = 500
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		changes, _, err := f.Changes(after, batch)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			if err := send(change); err != nil {
+				return err
+			}
+			after = change.Seq
+		}
+
+		// A full batch means more changes are waiting
+		if len(changes) == batch {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-f.ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// pruneLoop removes the changes older than the retention, hourly
+func (f *ChangeFeed) pruneLoop() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if retention := time.Duration(f.retention.Load()); retention > 0 {
+			cutoff := time.Now().Add(-retention).UTC().Format(changeTimeFormat)
+			result, err := f.db.Exec("DELETE FROM attendance_changes WHERE changed_at < ?", cutoff)
+			if err != nil {
+				f.logger.Error("Failed to prune changes", "error", err)
+			} else if n, _ := result.RowsAffected(); n > 0 {
+				f.logger.Info("Pruned changes", "changes", n, "retention", retention)
+			}
+		}
+
+		select {
+		case <-f.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
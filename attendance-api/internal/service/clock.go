@@ -0,0 +1,129 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+)
+
+// ClockService tracks the clock skew of devices that report their own time,
+// so kiosks without NTP access can be told to adjust and drifting clocks
+// show up before their timestamps cause trouble
+type ClockService struct {
+	db      *sql.DB
+	reads   *sql.DB
+	maxSkew time.Duration
+
+	logger *slog.Logger
+}
+
+func NewClockService(db, reads *sql.DB, cfg config.ClockConfig) (*ClockService, error) {
+	service := &ClockService{db: db, reads: reads, maxSkew: cfg.MaxSkew, logger: logging.Component("clock")}
+
+	if err := service.initSchema(); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	return service, nil
+}
+
+func (s *ClockService) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS device_clocks (
+		device_id TEXT PRIMARY KEY,
+		skew_ms INTEGER NOT NULL,
+		max_skew_ms INTEGER NOT NULL,
+		samples INTEGER NOT NULL,
+		last_seen DATETIME NOT NULL
+	);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+	return nil
+}
+
+// ParseDeviceTime reads the time a device sent, as an RFC 3339 timestamp
+// or Unix milliseconds for devices that cannot format dates
+func ParseDeviceTime(value string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected an RFC 3339 timestamp or Unix milliseconds")
+	}
+	return t, nil
+}
+
+// Observe records the skew between a device's time and the server's time
+// when its request arrived, and returns the skew in milliseconds
+func (s *ClockService) Observe(deviceID string, deviceTime, serverTime time.Time) (int64, error) {
+	skew := deviceTime.Sub(serverTime).Milliseconds()
+
+	// Only going out of sync is logged, not every poll of a drifting device
+	var previous sql.NullInt64
+	err := s.db.QueryRow("SELECT skew_ms FROM device_clocks WHERE device_id = ?", deviceID).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return skew, fmt.Errorf("failed to look up clock skew: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO device_clocks (device_id, skew_ms, max_skew_ms, samples, last_seen)
+		VALUES (?, ?, ?, 1, ?)
+		ON CONFLICT(device_id) DO UPDATE SET
+			skew_ms = excluded.skew_ms,
+			max_skew_ms = CASE WHEN abs(excluded.skew_ms) > abs(max_skew_ms) THEN excluded.skew_ms ELSE max_skew_ms END,
+			samples = samples + 1,
+			last_seen = excluded.last_seen
+	`, deviceID, skew, skew, serverTime)
+	if err != nil {
+		return skew, fmt.Errorf("failed to record clock skew: %w", err)
+	}
+
+	if s.outOfSync(skew) && (!previous.Valid || !s.outOfSync(previous.Int64)) {
+		s.logger.Warn("Device clock is off", "device", deviceID, "skew", time.Duration(skew)*time.Millisecond)
+	}
+	return skew, nil
+}
+
+// Devices lists the clocks of every device that reported its time, the
+// furthest off first
+func (s *ClockService) Devices() ([]domain.DeviceClock, error) {
+	rows, err := s.reads.Query(`
+		SELECT device_id, skew_ms, max_skew_ms, samples, last_seen
+		FROM device_clocks
+		ORDER BY abs(skew_ms) DESC, device_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device clocks: %w", err)
+	}
+	defer rows.Close()
+
+	clocks := make([]domain.DeviceClock, 0)
+	for rows.Next() {
+		var clock domain.DeviceClock
+		if err := rows.Scan(&clock.DeviceID, &clock.SkewMs, &clock.MaxSkewMs, &clock.Samples, &clock.LastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan device clock: %w", err)
+		}
+		clock.OutOfSync = s.outOfSync(clock.SkewMs)
+		clocks = append(clocks, clock)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return clocks, nil
+}
+
+func (s *ClockService) outOfSync(skewMs int64) bool {
+	return s.maxSkew > 0 && (time.Duration(skewMs)*time.Millisecond).Abs() > s.maxSkew
+}
@@ -0,0 +1,363 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"attendance-api/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrCommandNotFound = errors.New("device command not found")
+	ErrInvalidCommand  = errors.New("invalid device command")
+	ErrCommandClosed   = errors.New("device command is no longer open")
+)
+
+const (
+	// maxCommandTTL bounds how long a command may wait for its device
+	maxCommandTTL = 24 * time.Hour
+	// maxCommandWait bounds how long a device's poll waits for a command
+	maxCommandWait = 60 * time.Second
+	// commandRecheck is how often a waiting poll looks at the queue again,
+	// for commands queued by another instance sharing the database
+	commandRecheck = 2 * time.Second
+	// commandRetention is how long finished commands are kept
+	commandRetention = 7 * 24 * time.Hour
+)
+
+func (s *DeviceService) initCommandSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS device_commands (
+		id TEXT PRIMARY KEY,
+		device_id TEXT NOT NULL,
+		command TEXT NOT NULL,
+		params TEXT NOT NULL DEFAULT '{}',
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		result TEXT NOT NULL DEFAULT '',
+		actor_type TEXT NOT NULL DEFAULT '',
+		actor_id TEXT NOT NULL DEFAULT '',
+		actor_name TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL,
+		delivered_at DATETIME,
+		acked_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_device_commands_device ON device_commands(device_id, status, created_at);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute device command schema: %w", err)
+	}
+	return nil
+}
+
+const commandColumns = `id, device_id, command, params, status, attempts, result, actor_type, actor_id, actor_name,
+	created_at, expires_at, delivered_at, acked_at`
+
+// QueueCommand queues a command for a device. It waits for the device to
+// take it for up to ttl, DEVICE_COMMAND_TTL when zero.
+func (s *DeviceService) QueueCommand(ctx context.Context, device, command string, params map[string]interface{}, ttl time.Duration) (*domain.DeviceCommand, error) {
+	if !slices.Contains(domain.DeviceCommands, command) {
+		return nil, fmt.Errorf("%w: command must be open, reboot or update_config", ErrInvalidCommand)
+	}
+	if ttl < 0 || ttl > maxCommandTTL {
+		return nil, fmt.Errorf("%w: ttl must be at most %s", ErrInvalidCommand, maxCommandTTL)
+	}
+	if ttl == 0 {
+		ttl = s.cfg.CommandTTL
+	}
+	if _, err := s.Get(device); err != nil {
+		return nil, err
+	}
+
+	encoded := []byte("{}")
+	if len(params) > 0 {
+		var err error
+		if encoded, err = json.Marshal(params); err != nil {
+			return nil, fmt.Errorf("%w: params: %v", ErrInvalidCommand, err)
+		}
+	}
+
+	now := time.Now()
+	cmd := &domain.DeviceCommand{
+		ID:        uuid.New().String(),
+		Device:    device,
+		Command:   command,
+		Params:    params,
+		Status:    domain.CommandPending,
+		Actor:     recordActor(domain.ActorFromContext(ctx)),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO device_commands (id, device_id, command, params, status, actor_type, actor_id, actor_name, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, cmd.ID, cmd.Device, cmd.Command, string(encoded), cmd.Status, cmd.Actor.Type, cmd.Actor.ID, cmd.Actor.Name,
+		cmd.CreatedAt, cmd.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue device command: %w", err)
+	}
+
+	// Finished commands are only kept for a while
+	_, err = s.db.Exec("DELETE FROM device_commands WHERE status NOT IN (?, ?) AND created_at < ?",
+		domain.CommandPending, domain.CommandDelivered, now.Add(-commandRetention))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune device commands: %w", err)
+	}
+
+	s.wake(device)
+	return cmd, nil
+}
+
+// Commands returns the commands of a device, newest first, optionally only
+// those in one state
+func (s *DeviceService) Commands(device, status string, limit int) ([]domain.DeviceCommand, error) {
+	if _, err := s.Get(device); err != nil {
+		return nil, err
+	}
+	if err := s.expireCommands(device, time.Now()); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT `+commandColumns+`
+		FROM device_commands
+		WHERE device_id = ? AND (? = '' OR status = ?)
+		ORDER BY created_at DESC
+		LIMIT ?
+	`, device, status, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device commands: %w", err)
+	}
+	defer rows.Close()
+
+	commands := []domain.DeviceCommand{}
+	for rows.Next() {
+		cmd, err := scanCommand(rows)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, *cmd)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return commands, nil
+}
+
+// Command returns one command of a device
+func (s *DeviceService) Command(device, id string) (*domain.DeviceCommand, error) {
+	if err := s.expireCommands(device, time.Now()); err != nil {
+		return nil, err
+	}
+
+	cmd, err := scanCommand(s.db.QueryRow("SELECT "+commandColumns+" FROM device_commands WHERE id = ? AND device_id = ?", id, device))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCommandNotFound
+	}
+	return cmd, err
+}
+
+// PollCommands hands a device its due commands, waiting up to wait for one
+// to be queued when there are none. The commands count as delivered, and
+// those not acknowledged within DEVICE_COMMAND_RETRY are handed out again,
+// so a command survives the device dropping off before it could act.
+func (s *DeviceService) PollCommands(ctx context.Context, device string, wait time.Duration) ([]domain.DeviceCommand, error) {
+	if _, err := s.Get(device); err != nil {
+		return nil, err
+	}
+
+	deadline := time.NewTimer(min(wait, maxCommandWait))
+	defer deadline.Stop()
+	recheck := time.NewTicker(commandRecheck)
+	defer recheck.Stop()
+
+	for {
+		// Taken before looking, so a command queued meanwhile still wakes us
+		woken := s.waiter(device)
+
+		commands, err := s.claimCommands(device, time.Now())
+		if err != nil || len(commands) > 0 || wait <= 0 {
+			return commands, err
+		}
+
+		select {
+		case <-woken:
+		case <-recheck.C:
+		case <-deadline.C:
+			return commands, nil
+		case <-ctx.Done():
+			return commands, nil
+		case <-s.stop:
+			return commands, nil
+		}
+	}
+}
+
+// claimCommands marks the due commands of a device as delivered and
+// returns them, oldest first
+func (s *DeviceService) claimCommands(device string, now time.Time) ([]domain.DeviceCommand, error) {
+	if err := s.expireCommands(device, now); err != nil {
+		return nil, err
+	}
+
+	// Unacknowledged commands are due again once the retry interval passed
+	retry := now.Add(-s.cfg.CommandRetry)
+	due := "device_id = ? AND (status = ? OR (status = ? AND delivered_at <= ?))"
+
+	rows, err := s.db.Query("SELECT "+commandColumns+" FROM device_commands WHERE "+due+" ORDER BY created_at",
+		device, domain.CommandPending, domain.CommandDelivered, retry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due device commands: %w", err)
+	}
+
+	var candidates []*domain.DeviceCommand
+	for rows.Next() {
+		cmd, err := scanCommand(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, cmd)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	commands := []domain.DeviceCommand{}
+	for _, cmd := range candidates {
+		// Another poll of the device may have taken it meanwhile
+		result, err := s.db.Exec("UPDATE device_commands SET status = ?, delivered_at = ?, attempts = attempts + 1 WHERE id = ? AND "+due,
+			domain.CommandDelivered, now, cmd.ID, device, domain.CommandPending, domain.CommandDelivered, retry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to mark device command delivered: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+
+		cmd.Status = domain.CommandDelivered
+		cmd.DeliveredAt = &now
+		cmd.Attempts++
+		commands = append(commands, *cmd)
+	}
+	return commands, nil
+}
+
+// AckCommand records that a device carried out a command, or failed to.
+// Acknowledging it again the same way is not an error, so a device may
+// repeat an acknowledgement it is unsure arrived.
+func (s *DeviceService) AckCommand(device, id string, ok bool, result string) (*domain.DeviceCommand, error) {
+	status := domain.CommandDone
+	if !ok {
+		status = domain.CommandFailed
+	}
+	return s.closeCommand(device, id, status, result)
+}
+
+// CancelCommand withdraws a command the device has not acknowledged yet
+func (s *DeviceService) CancelCommand(device, id string) (*domain.DeviceCommand, error) {
+	return s.closeCommand(device, id, domain.CommandCancelled, "")
+}
+
+func (s *DeviceService) closeCommand(device, id, status, result string) (*domain.DeviceCommand, error) {
+	if err := s.expireCommands(device, time.Now()); err != nil {
+		return nil, err
+	}
+
+	_, err := s.db.Exec(`
+		UPDATE device_commands SET status = ?, result = ?, acked_at = ?
+		WHERE id = ? AND device_id = ? AND status IN (?, ?)
+	`, status, result, time.Now(), id, device, domain.CommandPending, domain.CommandDelivered)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update device command: %w", err)
+	}
+
+	cmd, err := s.Command(device, id)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.Status != status {
+		return nil, fmt.Errorf("%w: it is %s", ErrCommandClosed, cmd.Status)
+	}
+	return cmd, nil
+}
+
+// expireCommands marks the open commands of a device past their expiry
+func (s *DeviceService) expireCommands(device string, now time.Time) error {
+	_, err := s.db.Exec("UPDATE device_commands SET status = ? WHERE device_id = ? AND status IN (?, ?) AND expires_at <= ?",
+		domain.CommandExpired, device, domain.CommandPending, domain.CommandDelivered, now)
+	if err != nil {
+		return fmt.Errorf("failed to expire device commands: %w", err)
+	}
+	return nil
+}
+
+// waiter returns a channel closed when a command is queued for the device
+func (s *DeviceService) waiter(device string) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch, ok := s.waiters[device]
+	if !ok {
+		ch = make(chan struct{})
+		s.waiters[device] = ch
+	}
+	return ch
+}
+
+func (s *DeviceService) wake(device string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ch, ok := s.waiters[device]; ok {
+		close(ch)
+		delete(s.waiters, device)
+	}
+}
+
+func scanCommand(row rowScanner) (*domain.DeviceCommand, error) {
+	var (
+		cmd                     domain.DeviceCommand
+		params                  string
+		actor                   domain.Actor
+		delivered, acknowledged sql.NullTime
+	)
+
+	err := row.Scan(&cmd.ID, &cmd.Device, &cmd.Command, &params, &cmd.Status, &cmd.Attempts, &cmd.Result,
+		&actor.Type, &actor.ID, &actor.Name, &cmd.CreatedAt, &cmd.ExpiresAt, &delivered, &acknowledged)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan device command: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(params), &cmd.Params); err != nil {
+		return nil, fmt.Errorf("failed to decode device command params: %w", err)
+	}
+	if actor.Type != "" {
+		cmd.Actor = &actor
+	}
+	if delivered.Valid {
+		cmd.DeliveredAt = &delivered.Time
+	}
+	if acknowledged.Valid {
+		cmd.AckedAt = &acknowledged.Time
+	}
+
+	return &cmd, nil
+}
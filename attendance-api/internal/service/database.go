@@ -0,0 +1,232 @@
+package service
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// driverName is SQLite storing times in UTC, with the local_date function
+const driverName = "sqlite3-utc"
+
+func init() {
+	sql.Register(driverName, utcDriver{&sqlite3.SQLiteDriver{}})
+}
+
+// utcDriver stores every time.Time in UTC, whatever its location. Times are
+// stored as text with their UTC offset, and only compare and sort correctly
+// as text when the offset is the same, which the zone of the site does not
+// guarantee across daylight saving time or a change of
+// ATTENDANCE_TIMEZONE. Times are read in the zone of the _loc parameter,
+// which local_date uses too.
+type utcDriver struct {
+	*sqlite3.SQLiteDriver
+}
+
+func (d utcDriver) Open(dsn string) (driver.Conn, error) {
+	loc := time.UTC
+	if _, query, ok := strings.Cut(dsn, "?"); ok {
+		params, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid database parameters: %w", err)
+		}
+		if name := params.Get("_loc"); name != "" {
+			if loc, err = time.LoadLocation(name); err != nil {
+				return nil, fmt.Errorf("invalid database timezone: %w", err)
+			}
+		}
+	}
+
+	conn, err := d.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	sqliteConn := conn.(*sqlite3.SQLiteConn)
+	if err := sqliteConn.RegisterFunc("local_date", localDate(loc), true); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return utcConn{sqliteConn}, nil
+}
+
+type utcConn struct {
+	*sqlite3.SQLiteConn
+}
+
+// CheckNamedValue converts times to UTC and leaves the other arguments to
+// the default conversion
+func (utcConn) CheckNamedValue(arg *driver.NamedValue) error {
+	if t, ok := arg.Value.(time.Time); ok {
+		arg.Value = t.UTC()
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+// localDate returns the local_date SQL function: the YYYY-MM-DD day of a
+// stored time in loc, the zone of the site, for grouping and filtering by
+// day
+func localDate(loc *time.Location) func(value any) any {
+	return func(value any) any {
+		text, ok := value.(string)
+		if !ok {
+			return value
+		}
+		text = strings.TrimSuffix(text, "Z")
+		for _, format := range sqlite3.SQLiteTimestampFormats {
+			if t, err := time.ParseInLocation(format, text, time.UTC); err == nil {
+				return t.In(loc).Format(dayFormat)
+			}
+		}
+		return text[:min(len(text), len(dayFormat))]
+	}
+}
+
+// OpenDatabase opens the SQLite database shared by all services for writing,
+// creating its directory when needed. The database is switched to WAL mode
+// so the read pool can query it while a write is in progress. Times are
+// read in loc, the zone of the site.
+func OpenDatabase(dbPath string, loc *time.Location, cfg config.DatabaseConfig) (*sql.DB, error) {
+	// Ensure directory exists
+	dir := filepath.Dir(dbPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("_journal_mode", "WAL")
+	params.Set("_busy_timeout", fmt.Sprint(cfg.BusyTimeout.Milliseconds()))
+	params.Set("_txlock", "immediate")
+
+	db, err := openPool(dbPath, loc, params, max(cfg.WritePoolSize, 1))
+	if err != nil {
+		return nil, err
+	}
+	if err := storeInUTC(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// OpenReadPool opens read-only connections to a database already opened
+// with OpenDatabase, for report and query endpoints
+func OpenReadPool(dbPath string, loc *time.Location, cfg config.DatabaseConfig) (*sql.DB, error) {
+	params := url.Values{}
+	params.Set("mode", "ro")
+	params.Set("_busy_timeout", fmt.Sprint(cfg.BusyTimeout.Milliseconds()))
+
+	return openPool(dbPath, loc, params, max(cfg.ReadPoolSize, 1))
+}
+
+func openPool(dbPath string, loc *time.Location, params url.Values, size int) (*sql.DB, error) {
+	params.Set("_loc", loc.String())
+
+	db, err := sql.Open(driverName, "file:"+dbPath+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	db.SetMaxOpenConns(size)
+	db.SetMaxIdleConns(size)
+
+	// Test connection
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return db, nil
+}
+
+// utcVersion is the user_version of databases whose times are all in UTC
+const utcVersion = 1
+
+// storeInUTC converts the times older versions stored with the UTC offset
+// of the server to UTC, so they compare with the ones stored since. The
+// offsets are kept in the text of every DATETIME column, which SQLite can
+// convert; the fraction of a second is copied over as it is.
+func storeInUTC(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read database version: %w", err)
+	}
+	if version >= utcVersion {
+		return nil
+	}
+
+	rows, err := db.Query(`
+		SELECT m.name, c.name
+		FROM sqlite_master m, pragma_table_info(m.name) c
+		WHERE m.type = 'table' AND c.type = 'DATETIME'
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to list time columns: %w", err)
+	}
+	var columns [][2]string
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to list time columns: %w", err)
+		}
+		columns = append(columns, [2]string{table, column})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list time columns: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, c := range columns {
+		// "2006-01-02 15:04:05.999999999-07:00", the fraction being optional
+		_, err := tx.Exec(fmt.Sprintf(`
+			UPDATE %[1]s
+			SET %[2]s = strftime('%%Y-%%m-%%d %%H:%%M:%%S', %[2]s) || substr(%[2]s, 20, length(%[2]s) - 25) || '+00:00'
+			WHERE %[2]s GLOB '????-??-?? ??:??:??*[+-][0-9][0-9]:[0-9][0-9]' AND substr(%[2]s, -6) != '+00:00'
+		`, c[0], c[1]))
+		if err != nil {
+			return fmt.Errorf("failed to convert %s.%s to UTC: %w", c[0], c[1], err)
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", utcVersion)); err != nil {
+		return fmt.Errorf("failed to update database version: %w", err)
+	}
+	return tx.Commit()
+}
+
+// PoolStats reports the usage of a connection pool, including how long
+// callers waited for a free connection
+func PoolStats(db *sql.DB) domain.PoolStats {
+	stats := db.Stats()
+
+	avgWait := 0.0
+	if stats.WaitCount > 0 {
+		avgWait = float64(stats.WaitDuration.Microseconds()) / float64(stats.WaitCount) / 1000
+	}
+
+	return domain.PoolStats{
+		MaxOpen:       stats.MaxOpenConnections,
+		Open:          stats.OpenConnections,
+		InUse:         stats.InUse,
+		Idle:          stats.Idle,
+		WaitCount:     stats.WaitCount,
+		WaitTotalMs:   stats.WaitDuration.Milliseconds(),
+		WaitAverageMs: avgWait,
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"attendance-api/internal/config"
+)
+
+// The zone of the site is the one passed in, not the zone of the process:
+// times are stored in UTC, read back in the site zone, and local_date gives
+// the day there
+func TestSiteTimezone(t *testing.T) {
+	site, err := time.LoadLocation("Asia/Baghdad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "attendance.db"), site, config.DatabaseConfig{WritePoolSize: 1, BusyTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// 01:30 in Erbil is still the evening before in UTC
+	recognized := time.Date(2024, 1, 15, 22, 30, 0, 0, time.UTC)
+	if _, err := db.Exec("CREATE TABLE records (timestamp DATETIME)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO records (timestamp) VALUES (?)", recognized); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		stored, day string
+		timestamp   time.Time
+	)
+	if err := db.QueryRow("SELECT CAST(timestamp AS TEXT), timestamp, local_date(timestamp) FROM records").Scan(&stored, &timestamp, &day); err != nil {
+		t.Fatal(err)
+	}
+	if want := "2024-01-15 22:30:00"; stored[:len(want)] != want {
+		t.Errorf("stored %q, want UTC %q", stored, want)
+	}
+	if !timestamp.Equal(recognized) || timestamp.Location().String() != site.String() {
+		t.Errorf("read back %s, want %s", timestamp, recognized.In(site))
+	}
+	if day != "2024-01-16" {
+		t.Errorf("local_date = %s, want the day in Erbil, 2024-01-16", day)
+	}
+}
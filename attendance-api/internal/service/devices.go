@@ -0,0 +1,570 @@
+package service
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+)
+
+var (
+	ErrDeviceNotFound     = errors.New("device not found")
+	ErrDeviceExists       = errors.New("a device with this id is already registered")
+	ErrInvalidDeviceID    = errors.New("device id must be 1-64 letters, digits, dots, dashes or underscores")
+	ErrInvalidDeviceToken = errors.New("invalid device token or disabled device")
+	ErrInvalidSettings    = errors.New("invalid device settings")
+)
+
+// deviceTokenPrefix tells device tokens apart from API keys and user tokens
+const deviceTokenPrefix = "dt_"
+
+var deviceIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// deviceColumns is the column list matching scanDevice
+const deviceColumns = `id, name, location, tenant, token_prefix, disabled, last_seen_at, offline, created_at, updated_at`
+
+// DeviceService is the registry of cameras and door controllers. Each
+// device has a token of its own, stored hashed like API keys, so a device
+// can be disabled or have its token rotated without touching the others.
+//
+// Devices are seen through their requests and heartbeats. A monitor reports
+// an enabled device that goes silent for longer than the offline window,
+// and reports it again once it is back.
+//
+// The settings a device runs with, such as how long its relay holds the
+// door open, are kept here too; every change is announced so devices can
+// fetch them again. So is a queue of commands for each device, which the
+// device takes by polling and acknowledges once carried out.
+type DeviceService struct {
+	db  *sql.DB
+	cfg config.DeviceConfig
+
+	// waiters wakes the polls of a device when a command is queued for it
+	mu      sync.Mutex
+	waiters map[string]chan struct{}
+
+	notify        func(domain.DeviceStatus)
+	configChanged func(domain.DeviceSettings)
+	standby       func() bool
+	stop          chan struct{}
+	wg            sync.WaitGroup
+
+	logger *slog.Logger
+}
+
+func NewDeviceService(db *sql.DB, cfg config.DeviceConfig) (*DeviceService, error) {
+	service := &DeviceService{db: db, cfg: cfg, waiters: make(map[string]chan struct{}), stop: make(chan struct{}), logger: logging.Component("devices")}
+
+	if err := service.initSchema(); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	return service, nil
+}
+
+func (s *DeviceService) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS devices (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		location TEXT NOT NULL DEFAULT '',
+		tenant TEXT NOT NULL DEFAULT '',
+		token_hash TEXT NOT NULL UNIQUE,
+		token_prefix TEXT NOT NULL,
+		disabled INTEGER NOT NULL DEFAULT 0,
+		last_seen_at DATETIME,
+		offline INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS device_settings (
+		device_id TEXT PRIMARY KEY,
+		relay_seconds INTEGER,
+		threshold REAL,
+		capture_interval_ms INTEGER,
+		version INTEGER NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+	if err := ensureColumn(s.db, "devices", "offline", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	return s.initCommandSchema()
+}
+
+// Start runs the offline monitor, which hands every device going offline
+// or coming back to notify; changed settings are handed to configChanged.
+// Nothing is checked while standby reports the node as a standby, as the
+// active node reports its devices.
+func (s *DeviceService) Start(notify func(domain.DeviceStatus), configChanged func(domain.DeviceSettings), standby func() bool) {
+	s.notify = notify
+	s.configChanged = configChanged
+	s.standby = standby
+	if s.cfg.OfflineAfter <= 0 || s.cfg.CheckInterval <= 0 {
+		return
+	}
+
+	s.wg.Add(1)
+	go s.monitor()
+
+	s.logger.Info("Reporting silent devices", "offline_after", s.cfg.OfflineAfter)
+}
+
+func (s *DeviceService) Close() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *DeviceService) monitor() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if s.standby != nil && s.standby() {
+				continue
+			}
+			if err := s.checkOffline(time.Now()); err != nil {
+				s.logger.Warn("Offline check failed", "error", err)
+			}
+		}
+	}
+}
+
+// checkOffline marks the enabled devices not seen since the offline window
+// began as offline. Devices that were never seen are left alone: they have
+// not been installed yet.
+func (s *DeviceService) checkOffline(now time.Time) error {
+	cutoff := now.Add(-s.cfg.OfflineAfter)
+
+	rows, err := s.db.Query(`
+		SELECT `+deviceColumns+`
+		FROM devices
+		WHERE disabled = 0 AND offline = 0 AND last_seen_at IS NOT NULL AND last_seen_at < ?
+	`, cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to query silent devices: %w", err)
+	}
+
+	var silent []*domain.Device
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		silent = append(silent, device)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("row iteration error: %w", err)
+	}
+
+	for _, device := range silent {
+		// Another instance sharing the database may have got there first,
+		// or the device may have come back meanwhile
+		result, err := s.db.Exec("UPDATE devices SET offline = 1 WHERE id = ? AND offline = 0 AND last_seen_at < ?", device.ID, cutoff)
+		if err != nil {
+			return fmt.Errorf("failed to mark device offline: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+
+		s.logger.Warn("Device is offline", "device", device.ID, "name", device.Name, "last_seen_at", device.LastSeenAt)
+		s.report(device, domain.DeviceOffline, now)
+	}
+	return nil
+}
+
+// markOnline reports a device that was offline as back
+func (s *DeviceService) markOnline(device *domain.Device, now time.Time) error {
+	if !device.Offline {
+		return nil
+	}
+	device.Offline = false
+
+	result, err := s.db.Exec("UPDATE devices SET offline = 0 WHERE id = ? AND offline = 1", device.ID)
+	if err != nil {
+		return fmt.Errorf("failed to mark device online: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	s.logger.Info("Device is back online", "device", device.ID, "name", device.Name)
+	s.report(device, domain.DeviceOnline, now)
+	return nil
+}
+
+func (s *DeviceService) report(device *domain.Device, status string, now time.Time) {
+	if s.notify == nil {
+		return
+	}
+	s.notify(domain.DeviceStatus{
+		ID:         device.ID,
+		Name:       device.Name,
+		Location:   device.Location,
+		Status:     status,
+		LastSeenAt: device.LastSeenAt,
+		Timestamp:  now,
+	})
+}
+
+// Heartbeat records that a device is alive
+func (s *DeviceService) Heartbeat(id string) (*domain.Device, error) {
+	now := time.Now()
+	result, err := s.db.Exec("UPDATE devices SET last_seen_at = ? WHERE id = ?", now, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record heartbeat: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrDeviceNotFound
+	}
+
+	device, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.markOnline(device, now); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// IsDeviceToken reports whether a secret is a device token rather than an
+// API key or a user's access token
+func IsDeviceToken(secret string) bool {
+	return strings.HasPrefix(secret, deviceTokenPrefix)
+}
+
+// Create registers a device and returns it together with its plaintext
+// token, which is not stored and cannot be retrieved again. The ID is the
+// device_id its records carry, so a device already submitting under an ID
+// keeps its history when registered with it.
+func (s *DeviceService) Create(id, name, location, tenant string) (*domain.Device, string, error) {
+	if !deviceIDPattern.MatchString(id) {
+		return nil, "", ErrInvalidDeviceID
+	}
+	if name == "" {
+		name = id
+	}
+
+	token, err := newDeviceToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	device := &domain.Device{
+		ID:          id,
+		Name:        name,
+		Location:    location,
+		Tenant:      tenant,
+		TokenPrefix: token[:10],
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO devices (id, name, location, tenant, token_hash, token_prefix, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO NOTHING
+	`, device.ID, device.Name, device.Location, device.Tenant, hashAPIKey(token), device.TokenPrefix, device.CreatedAt, device.UpdatedAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to insert device: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, "", ErrDeviceExists
+	}
+
+	return device, token, nil
+}
+
+func (s *DeviceService) List() ([]domain.Device, error) {
+	rows, err := s.db.Query(`
+		SELECT ` + deviceColumns + `
+		FROM devices
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []domain.Device{}
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, *device)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return devices, nil
+}
+
+func (s *DeviceService) Get(id string) (*domain.Device, error) {
+	row := s.db.QueryRow(`
+		SELECT `+deviceColumns+`
+		FROM devices
+		WHERE id = ?
+	`, id)
+
+	device, err := scanDevice(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeviceNotFound
+	}
+	return device, err
+}
+
+// Update changes the name, location, tenant or disabled flag of a device.
+// Nil arguments are left untouched. A disabled device's token is refused.
+func (s *DeviceService) Update(id string, name, location, tenant *string, disabled *bool) (*domain.Device, error) {
+	device, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if name != nil && *name != "" {
+		device.Name = *name
+	}
+	if location != nil {
+		device.Location = *location
+	}
+	if tenant != nil {
+		device.Tenant = *tenant
+	}
+	if disabled != nil {
+		device.Disabled = *disabled
+	}
+	device.UpdatedAt = time.Now()
+
+	_, err = s.db.Exec("UPDATE devices SET name = ?, location = ?, tenant = ?, disabled = ?, updated_at = ? WHERE id = ?",
+		device.Name, device.Location, device.Tenant, device.Disabled, device.UpdatedAt, device.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update device: %w", err)
+	}
+
+	return device, nil
+}
+
+// RotateToken gives a device a new token; the old one is refused at once
+func (s *DeviceService) RotateToken(id string) (*domain.Device, string, error) {
+	token, err := newDeviceToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	result, err := s.db.Exec("UPDATE devices SET token_hash = ?, token_prefix = ?, updated_at = ? WHERE id = ?",
+		hashAPIKey(token), token[:10], time.Now(), id)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to rotate device token: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, "", ErrDeviceNotFound
+	}
+
+	device, err := s.Get(id)
+	if err != nil {
+		return nil, "", err
+	}
+	return device, token, nil
+}
+
+// Delete removes a device, its settings and its commands from the registry. Its records
+// keep their device_id.
+func (s *DeviceService) Delete(id string) error {
+	result, err := s.db.Exec("DELETE FROM devices WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete device: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrDeviceNotFound
+	}
+	if _, err := s.db.Exec("DELETE FROM device_settings WHERE device_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete device settings: %w", err)
+	}
+	if _, err := s.db.Exec("DELETE FROM device_commands WHERE device_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete device commands: %w", err)
+	}
+	return nil
+}
+
+// Settings returns the settings of a device; one that was never configured
+// has none set and version 0
+func (s *DeviceService) Settings(id string) (*domain.DeviceSettings, error) {
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+
+	settings := &domain.DeviceSettings{Device: id}
+	var (
+		relay, interval sql.NullInt64
+		threshold       sql.NullFloat64
+		updated         time.Time
+	)
+	err := s.db.QueryRow(`
+		SELECT relay_seconds, threshold, capture_interval_ms, version, updated_at
+		FROM device_settings
+		WHERE device_id = ?
+	`, id).Scan(&relay, &threshold, &interval, &settings.Version, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return settings, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device settings: %w", err)
+	}
+
+	if relay.Valid {
+		n := int(relay.Int64)
+		settings.RelaySeconds = &n
+	}
+	if threshold.Valid {
+		settings.Threshold = &threshold.Float64
+	}
+	if interval.Valid {
+		n := int(interval.Int64)
+		settings.CaptureIntervalMS = &n
+	}
+	settings.UpdatedAt = &updated
+
+	return settings, nil
+}
+
+// SetSettings replaces the settings of a device, bumps their version and
+// announces the change
+func (s *DeviceService) SetSettings(id string, settings domain.DeviceSettings) (*domain.DeviceSettings, error) {
+	if err := validateSettings(settings); err != nil {
+		return nil, err
+	}
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO device_settings (device_id, relay_seconds, threshold, capture_interval_ms, version, updated_at)
+		VALUES (?, ?, ?, ?, 1, ?)
+		ON CONFLICT (device_id) DO UPDATE SET
+			relay_seconds = excluded.relay_seconds,
+			threshold = excluded.threshold,
+			capture_interval_ms = excluded.capture_interval_ms,
+			version = device_settings.version + 1,
+			updated_at = excluded.updated_at
+	`, id, settings.RelaySeconds, settings.Threshold, settings.CaptureIntervalMS, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to save device settings: %w", err)
+	}
+
+	saved, err := s.Settings(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Device settings changed", "device", id, "version", saved.Version)
+	if s.configChanged != nil {
+		s.configChanged(*saved)
+	}
+	return saved, nil
+}
+
+func validateSettings(settings domain.DeviceSettings) error {
+	if v := settings.RelaySeconds; v != nil && (*v < 1 || *v > 300) {
+		return fmt.Errorf("%w: relay_seconds must be between 1 and 300", ErrInvalidSettings)
+	}
+	if v := settings.Threshold; v != nil && (*v < 0 || *v > 1) {
+		return fmt.Errorf("%w: threshold must be between 0 and 1", ErrInvalidSettings)
+	}
+	if v := settings.CaptureIntervalMS; v != nil && (*v < 50 || *v > 60000) {
+		return fmt.Errorf("%w: capture_interval_ms must be between 50 and 60000", ErrInvalidSettings)
+	}
+	return nil
+}
+
+// Authenticate resolves a plaintext token to an enabled device and records
+// that it was seen
+func (s *DeviceService) Authenticate(token string) (*domain.Device, error) {
+	row := s.db.QueryRow(`
+		SELECT `+deviceColumns+`
+		FROM devices
+		WHERE token_hash = ?
+	`, hashAPIKey(token))
+
+	device, err := scanDevice(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidDeviceToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if device.Disabled {
+		return nil, ErrInvalidDeviceToken
+	}
+
+	now := time.Now()
+	if device.LastSeenAt == nil || now.Sub(*device.LastSeenAt) > lastUsedGranularity {
+		if _, err := s.db.Exec("UPDATE devices SET last_seen_at = ? WHERE id = ?", now, device.ID); err != nil {
+			return nil, fmt.Errorf("failed to update last seen: %w", err)
+		}
+		device.LastSeenAt = &now
+	}
+	if err := s.markOnline(device, now); err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
+func scanDevice(row rowScanner) (*domain.Device, error) {
+	var (
+		device   domain.Device
+		lastSeen sql.NullTime
+	)
+
+	err := row.Scan(&device.ID, &device.Name, &device.Location, &device.Tenant, &device.TokenPrefix,
+		&device.Disabled, &lastSeen, &device.Offline, &device.CreatedAt, &device.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan device: %w", err)
+	}
+
+	if lastSeen.Valid {
+		device.LastSeenAt = &lastSeen.Time
+	}
+
+	return &device, nil
+}
+
+func newDeviceToken() (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate device token: %w", err)
+	}
+	return deviceTokenPrefix + hex.EncodeToString(raw), nil
+}
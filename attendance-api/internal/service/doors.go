@@ -0,0 +1,433 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrDoorNotFound  = errors.New("door not found")
+	ErrDoorExists    = errors.New("a door with this id already exists")
+	ErrInvalidDoorID = errors.New("door id must be 1-64 letters, digits, dots, dashes or underscores")
+
+	ErrInvalidDoorCommand = errors.New("seconds must be between 0 and 3600")
+)
+
+// Grant targets and subjects
+const (
+	grantDoor       = "door"
+	grantZone       = "zone"
+	grantPerson     = "person"
+	grantDepartment = "department"
+)
+
+var doorIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+func (s *AttendanceService) initDoorSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS doors (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		zone TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS door_grants (
+		target_type TEXT NOT NULL,
+		target TEXT NOT NULL,
+		subject_type TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		PRIMARY KEY (target_type, target, subject_type, subject)
+	);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute door schema: %w", err)
+	}
+
+	return nil
+}
+
+// doorFor is the door a submission is for: the one it names, or else the
+// door its device belongs to in the door configuration
+func (s *AttendanceService) doorFor(sub domain.AttendanceSubmission) string {
+	if sub.DoorID != "" {
+		return sub.DoorID
+	}
+	return s.doors[sub.DeviceID]
+}
+
+// mayPass reports whether a person may pass a door. Doors without grants on
+// themselves or their zone, including doors that were never set up, let
+// everyone pass; otherwise the person, or their department, needs a grant.
+func (s *AttendanceService) mayPass(name, door string) (bool, error) {
+	var department string
+	err := s.db.QueryRow("SELECT department FROM people WHERE name = ?", name).Scan(&department)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("failed to look up department: %w", err)
+	}
+
+	var grants, matches int
+	err = s.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(
+			(subject_type = ? AND subject = ?) OR (subject_type = ? AND subject = ? AND subject != '')
+		), 0)
+		FROM door_grants
+		WHERE (target_type = ? AND target = ?)
+			OR (target_type = ? AND target = (SELECT zone FROM doors WHERE id = ? AND zone != ''))
+	`, grantPerson, name, grantDepartment, department, grantDoor, door, grantZone, door).Scan(&grants, &matches)
+	if err != nil {
+		return false, fmt.Errorf("failed to query door grants: %w", err)
+	}
+
+	return grants == 0 || matches > 0, nil
+}
+
+// ListDoors returns every door with the access granted on it
+func (s *AttendanceService) ListDoors() ([]domain.Door, error) {
+	rows, err := s.db.Query("SELECT id, name, zone, created_at, updated_at FROM doors ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query doors: %w", err)
+	}
+
+	doors := []domain.Door{}
+	for rows.Next() {
+		var door domain.Door
+		if err := rows.Scan(&door.ID, &door.Name, &door.Zone, &door.CreatedAt, &door.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan door: %w", err)
+		}
+		doors = append(doors, door)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	for i := range doors {
+		if doors[i].Access, err = s.grantsOn(grantDoor, doors[i].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return doors, nil
+}
+
+func (s *AttendanceService) GetDoor(id string) (*domain.Door, error) {
+	var door domain.Door
+	err := s.db.QueryRow("SELECT id, name, zone, created_at, updated_at FROM doors WHERE id = ?", id).
+		Scan(&door.ID, &door.Name, &door.Zone, &door.CreatedAt, &door.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDoorNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query door: %w", err)
+	}
+
+	if door.Access, err = s.grantsOn(grantDoor, door.ID); err != nil {
+		return nil, err
+	}
+	return &door, nil
+}
+
+// CreateDoor sets up a door. Its ID is the door_id devices send, or a door
+// of the door configuration.
+func (s *AttendanceService) CreateDoor(door domain.Door) (*domain.Door, error) {
+	if !doorIDPattern.MatchString(door.ID) {
+		return nil, ErrInvalidDoorID
+	}
+	if door.Name == "" {
+		door.Name = door.ID
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec(`
+		INSERT INTO doors (id, name, zone, created_at, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO NOTHING
+	`, door.ID, door.Name, strings.TrimSpace(door.Zone), now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert door: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrDoorExists
+	}
+
+	if err := setGrants(tx, grantDoor, door.ID, door.Access); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit door: %w", err)
+	}
+
+	return s.GetDoor(door.ID)
+}
+
+// UpdateDoor changes the name, zone or access of a door. Nil arguments are
+// left untouched; access replaces what was granted on the door.
+func (s *AttendanceService) UpdateDoor(id string, name, zone *string, access *domain.DoorAccess) (*domain.Door, error) {
+	door, err := s.GetDoor(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if name != nil && *name != "" {
+		door.Name = *name
+	}
+	if zone != nil {
+		door.Zone = strings.TrimSpace(*zone)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE doors SET name = ?, zone = ?, updated_at = ? WHERE id = ?", door.Name, door.Zone, time.Now(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update door: %w", err)
+	}
+	if access != nil {
+		if err := setGrants(tx, grantDoor, id, *access); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit door: %w", err)
+	}
+
+	return s.GetDoor(id)
+}
+
+// DeleteDoor removes a door with the access granted on it and its
+// schedules. Its zone keeps its grants.
+func (s *AttendanceService) DeleteDoor(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM doors WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete door: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrDoorNotFound
+	}
+	if _, err := tx.Exec("DELETE FROM door_grants WHERE target_type = ? AND target = ?", grantDoor, id); err != nil {
+		return fmt.Errorf("failed to delete door grants: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM door_schedules WHERE door = ?", id); err != nil {
+		return fmt.Errorf("failed to delete door schedules: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit door deletion: %w", err)
+	}
+	return nil
+}
+
+// ListZones returns the zones named by doors or holding grants
+func (s *AttendanceService) ListZones() ([]domain.Zone, error) {
+	rows, err := s.db.Query(`
+		SELECT zone FROM doors WHERE zone != ''
+		UNION
+		SELECT target FROM door_grants WHERE target_type = ?
+		ORDER BY 1
+	`, grantZone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query zones: %w", err)
+	}
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan zone: %w", err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	zones := make([]domain.Zone, 0, len(names))
+	for _, name := range names {
+		zone, err := s.GetZone(name)
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, *zone)
+	}
+	return zones, nil
+}
+
+// GetZone returns the doors of a zone and the access granted on it
+func (s *AttendanceService) GetZone(name string) (*domain.Zone, error) {
+	zone := &domain.Zone{Name: name, Doors: []string{}}
+
+	rows, err := s.db.Query("SELECT id FROM doors WHERE zone = ? ORDER BY id", name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query zone doors: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan zone door: %w", err)
+		}
+		zone.Doors = append(zone.Doors, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	if zone.Access, err = s.grantsOn(grantZone, name); err != nil {
+		return nil, err
+	}
+	return zone, nil
+}
+
+// SetZoneAccess replaces the access granted on every door of a zone; empty
+// access clears it
+func (s *AttendanceService) SetZoneAccess(name string, access domain.DoorAccess) (*domain.Zone, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setGrants(tx, grantZone, name, access); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit zone access: %w", err)
+	}
+
+	return s.GetZone(name)
+}
+
+// CommandDoor tells the devices of a door to open it or keep it closed,
+// through the event stream, webhooks and the event bus. The door must be
+// set up or have devices in the door configuration.
+func (s *AttendanceService) CommandDoor(ctx context.Context, door, command string, seconds int, reason string) (*domain.DoorCommand, error) {
+	if seconds < 0 || seconds > 3600 {
+		return nil, ErrInvalidDoorCommand
+	}
+
+	var devices []string
+	for device, of := range s.doors {
+		if of == door {
+			devices = append(devices, device)
+		}
+	}
+	slices.Sort(devices)
+
+	if len(devices) == 0 {
+		if _, err := s.GetDoor(door); err != nil {
+			return nil, err
+		}
+	}
+
+	actor := domain.ActorFromContext(ctx)
+	cmd := &domain.DoorCommand{
+		ID:        uuid.New().String(),
+		Door:      door,
+		Devices:   devices,
+		Command:   command,
+		Seconds:   seconds,
+		Reason:    strings.TrimSpace(reason),
+		Timestamp: s.now(),
+		Actor:     recordActor(actor),
+	}
+
+	logging.From(ctx).Info("Door command sent", "door", door, "command", command)
+	s.broadcast(domain.SSEMessage{Event: domain.EventDoorCommand, Command: cmd})
+
+	return cmd, nil
+}
+
+// grantsOn returns the access granted on a door or zone
+func (s *AttendanceService) grantsOn(targetType, target string) (domain.DoorAccess, error) {
+	access := domain.DoorAccess{People: []string{}, Departments: []string{}}
+
+	rows, err := s.db.Query(`
+		SELECT subject_type, subject FROM door_grants
+		WHERE target_type = ? AND target = ?
+		ORDER BY subject
+	`, targetType, target)
+	if err != nil {
+		return access, fmt.Errorf("failed to query door grants: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var subjectType, subject string
+		if err := rows.Scan(&subjectType, &subject); err != nil {
+			return access, fmt.Errorf("failed to scan door grant: %w", err)
+		}
+		if subjectType == grantDepartment {
+			access.Departments = append(access.Departments, subject)
+		} else {
+			access.People = append(access.People, subject)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return access, fmt.Errorf("row iteration error: %w", err)
+	}
+	return access, nil
+}
+
+// setGrants replaces the access granted on a door or zone
+func setGrants(tx *sql.Tx, targetType, target string, access domain.DoorAccess) error {
+	if _, err := tx.Exec("DELETE FROM door_grants WHERE target_type = ? AND target = ?", targetType, target); err != nil {
+		return fmt.Errorf("failed to clear door grants: %w", err)
+	}
+
+	insert := func(subjectType string, subjects []string) error {
+		for _, subject := range subjects {
+			if subject = strings.TrimSpace(subject); subject == "" {
+				continue
+			}
+			_, err := tx.Exec(`
+				INSERT OR IGNORE INTO door_grants (target_type, target, subject_type, subject)
+				VALUES (?, ?, ?, ?)
+			`, targetType, target, subjectType, subject)
+			if err != nil {
+				return fmt.Errorf("failed to insert door grant: %w", err)
+			}
+		}
+		return nil
+	}
+
+	if err := insert(grantPerson, access.People); err != nil {
+		return err
+	}
+	return insert(grantDepartment, access.Departments)
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNoEmergency      = errors.New("no emergency in force")
+	ErrInvalidEmergency = errors.New("duration must be between 1m and 24h")
+)
+
+// Emergencies last an hour unless told otherwise, and always expire
+const (
+	defaultEmergencyTime = time.Hour
+	minEmergencyTime     = time.Minute
+	maxEmergencyTime     = 24 * time.Hour
+)
+
+func (s *AttendanceService) initEmergencySchema() error {
+	// At most one emergency is in force, held in the single row
+	schema := `
+	CREATE TABLE IF NOT EXISTS emergency (
+		slot INTEGER PRIMARY KEY CHECK (slot = 1),
+		id TEXT NOT NULL,
+		mode TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		actor_type TEXT NOT NULL DEFAULT '',
+		actor_id TEXT NOT NULL DEFAULT '',
+		actor_name TEXT NOT NULL DEFAULT '',
+		started_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL
+	);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute emergency schema: %w", err)
+	}
+	return nil
+}
+
+// StartEmergency puts every door in lockdown or unlocks them all, replacing
+// the emergency in force, until it is lifted or duration is over (an hour
+// when zero). Devices are told through the event stream, webhooks and the
+// event bus, and by the response to their next attendance submission.
+func (s *AttendanceService) StartEmergency(ctx context.Context, mode, reason string, duration time.Duration) (*domain.Emergency, error) {
+	if duration == 0 {
+		duration = defaultEmergencyTime
+	}
+	if duration < minEmergencyTime || duration > maxEmergencyTime {
+		return nil, ErrInvalidEmergency
+	}
+
+	now := time.Now()
+	emergency := &domain.Emergency{
+		ID:        uuid.New().String(),
+		Mode:      mode,
+		Reason:    strings.TrimSpace(reason),
+		StartedAt: now,
+		ExpiresAt: now.Add(duration),
+		Actor:     recordActor(domain.ActorFromContext(ctx)),
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO emergency (slot, id, mode, reason, actor_type, actor_id, actor_name, started_at, expires_at)
+		VALUES (1, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (slot) DO UPDATE SET
+			id = excluded.id, mode = excluded.mode, reason = excluded.reason,
+			actor_type = excluded.actor_type, actor_id = excluded.actor_id, actor_name = excluded.actor_name,
+			started_at = excluded.started_at, expires_at = excluded.expires_at
+	`, emergency.ID, emergency.Mode, emergency.Reason, emergency.Actor.Type, emergency.Actor.ID, emergency.Actor.Name,
+		emergency.StartedAt, emergency.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store emergency: %w", err)
+	}
+
+	logging.From(ctx).Warn("Emergency started", "mode", mode, "expires_at", emergency.ExpiresAt)
+	s.broadcast(domain.SSEMessage{Event: domain.EventEmergency, Emergency: emergency})
+
+	// Ends the emergency on time even when no device submits anything
+	time.AfterFunc(duration, func() {
+		if _, err := s.Emergency(); err != nil {
+			s.logger.Error("Failed to expire emergency", "error", err)
+		}
+	})
+
+	return emergency, nil
+}
+
+// Emergency returns the emergency in force, or nil. An expired emergency is
+// ended on the way.
+func (s *AttendanceService) Emergency() (*domain.Emergency, error) {
+	var (
+		emergency domain.Emergency
+		actor     domain.Actor
+	)
+	err := s.db.QueryRow(`
+		SELECT id, mode, reason, actor_type, actor_id, actor_name, started_at, expires_at
+		FROM emergency WHERE slot = 1
+	`).Scan(&emergency.ID, &emergency.Mode, &emergency.Reason, &actor.Type, &actor.ID, &actor.Name,
+		&emergency.StartedAt, &emergency.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query emergency: %w", err)
+	}
+	if actor.Type != "" {
+		emergency.Actor = &actor
+	}
+
+	if now := time.Now(); !now.Before(emergency.ExpiresAt) {
+		if err := s.endEmergency(&emergency, now); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return &emergency, nil
+}
+
+// EndEmergency lifts the emergency in force, returning the doors to their
+// schedules and access rules
+func (s *AttendanceService) EndEmergency() (*domain.Emergency, error) {
+	emergency, err := s.Emergency()
+	if err != nil {
+		return nil, err
+	}
+	if emergency == nil {
+		return nil, ErrNoEmergency
+	}
+
+	if err := s.endEmergency(emergency, time.Now()); err != nil {
+		return nil, err
+	}
+	return emergency, nil
+}
+
+// endEmergency removes an emergency and announces its end. Only the
+// instance that removes it announces it, should several notice at once.
+func (s *AttendanceService) endEmergency(emergency *domain.Emergency, now time.Time) error {
+	result, err := s.db.Exec("DELETE FROM emergency WHERE slot = 1 AND id = ?", emergency.ID)
+	if err != nil {
+		return fmt.Errorf("failed to end emergency: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	emergency.EndedAt = &now
+	s.logger.Warn("Emergency ended", "mode", emergency.Mode)
+	s.broadcast(domain.SSEMessage{Event: domain.EventEmergencyEnd, Emergency: emergency})
+	return nil
+}
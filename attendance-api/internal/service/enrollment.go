@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"attendance-api/internal/client"
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+)
+
+// EnrollmentService holds the face enrollment logic that goes beyond a plain
+// call to the face service
+type EnrollmentService struct {
+	faceClient client.Recognizer
+}
+
+func NewEnrollmentService(faceClient client.Recognizer) *EnrollmentService {
+	return &EnrollmentService{faceClient: faceClient}
+}
+
+// PlanEnrollment validates the images of an enrollment and reports what it
+// would change, without adding anything to the face service. Every image is
+// run through recognition so missing faces and images that already match a
+// different person are caught before they pollute the model, and scored for
+// quality with guidance on retaking it.
+func (s *EnrollmentService) PlanEnrollment(ctx context.Context, name string, images [][]byte, filenames []string, upload config.UploadConfig) (*domain.EnrollmentPlan, error) {
+	faces, err := s.faceClient.GetFaces(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get faces: %w", err)
+	}
+
+	plan := &domain.EnrollmentPlan{
+		Name:           name,
+		ImagesReceived: len(images),
+		Images:         make([]domain.EnrollmentImageCheck, 0, len(images)),
+	}
+
+	names := make([]string, 0, len(faces))
+	for _, face := range faces {
+		names = append(names, face.Name)
+		if face.Name == name {
+			plan.PersonExists = true
+			plan.ExistingImages = face.Images
+		}
+	}
+	if !plan.PersonExists {
+		plan.Suggestions = similarNames(name, names)
+	}
+
+	seen := make(map[[32]byte]string)
+
+	for i, data := range images {
+		check := domain.EnrollmentImageCheck{
+			Filename: filenames[i],
+			Size:     len(data),
+		}
+
+		if int64(len(data)) > upload.MaxUploadSize {
+			check.Errors = append(check.Errors, fmt.Sprintf("exceeds maximum size of %d bytes", upload.MaxUploadSize))
+		}
+		if err := CheckImage(data, upload); err != nil {
+			check.Errors = append(check.Errors, err.Error())
+		}
+
+		sum := sha256.Sum256(data)
+		if first, ok := seen[sum]; ok {
+			check.DuplicateOf = first
+			check.Errors = append(check.Errors, "identical to another image in this request")
+		} else {
+			seen[sum] = filenames[i]
+		}
+
+		if len(check.Errors) == 0 {
+			face := s.checkRecognition(ctx, name, data, filenames[i], &check)
+			check.Quality = assessPhoto(data, face)
+			if belowQuality(check.Quality, upload.MinQuality) {
+				check.Errors = append(check.Errors, qualityError(check.Quality, upload.MinQuality))
+			}
+		}
+
+		check.WouldAdd = len(check.Errors) == 0
+		if check.WouldAdd {
+			plan.ImagesToAdd++
+		} else {
+			plan.ImagesRejected++
+		}
+
+		plan.Images = append(plan.Images, check)
+	}
+
+	plan.ResultingImages = plan.ExistingImages + plan.ImagesToAdd
+
+	return plan, nil
+}
+
+// Enroll adds the images to the face service. Every image is scored for
+// quality first, with the face located by recognition; images scoring below
+// minQuality are held back and reported as failed, with the guidance on
+// retaking them. Images are listed in the order they were submitted.
+func (s *EnrollmentService) Enroll(ctx context.Context, name string, images [][]byte, filenames []string, minQuality int) (*domain.EnrollmentResult, error) {
+	qualities := make([]*domain.PhotoQuality, len(images))
+	var accepted [][]byte
+	var acceptedNames []string
+
+	for i, data := range images {
+		// Recognition only adds the face's size and pose to the score, an
+		// image it fails on is left to the face service
+		var face *domain.FaceLocation
+		if result, err := s.faceClient.RecognizeFace(ctx, data, filenames[i]); err == nil && len(result.Faces) > 0 {
+			face = &result.Faces[0].Location
+		}
+
+		qualities[i] = assessPhoto(data, face)
+		if !belowQuality(qualities[i], minQuality) {
+			accepted = append(accepted, data)
+			acceptedNames = append(acceptedNames, filenames[i])
+		}
+	}
+
+	var added []domain.EnrollmentImage
+	if len(accepted) > 0 {
+		result, err := s.faceClient.AddFace(ctx, name, accepted, acceptedNames)
+		if err != nil {
+			return nil, err
+		}
+		added = result.Images
+	}
+
+	result := &domain.EnrollmentResult{Name: name, Images: make([]domain.EnrollmentImage, 0, len(images))}
+	for i := range images {
+		image := domain.EnrollmentImage{Filename: filenames[i]}
+		if belowQuality(qualities[i], minQuality) {
+			image.Error = qualityError(qualities[i], minQuality)
+		} else if len(added) > 0 {
+			image, added = added[0], added[1:]
+		}
+		image.Quality = qualities[i]
+		result.Images = append(result.Images, image)
+	}
+	result.Tally()
+
+	if held := len(images) - len(accepted); held > 0 {
+		logging.From(ctx).Info("Held back low-quality images", "person", name, "images", held)
+	}
+
+	return result, nil
+}
+
+// belowQuality reports whether a photo scores below the minimum; photos that
+// could not be analyzed never do
+func belowQuality(quality *domain.PhotoQuality, minQuality int) bool {
+	return quality != nil && quality.Score < minQuality
+}
+
+func qualityError(quality *domain.PhotoQuality, minQuality int) string {
+	return fmt.Sprintf("photo quality %d is below the minimum of %d", quality.Score, minQuality)
+}
+
+// Collisions returns the enrolled names that are probably the same person
+// as a new name. Adding images to an enrolled name is no collision.
+func (s *EnrollmentService) Collisions(ctx context.Context, name string) ([]string, error) {
+	faces, err := s.faceClient.GetFaces(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get faces: %w", err)
+	}
+
+	names := make([]string, 0, len(faces))
+	for _, face := range faces {
+		if face.Name == name {
+			return nil, nil
+		}
+		names = append(names, face.Name)
+	}
+
+	return similarNames(name, names), nil
+}
+
+// checkRecognition returns the location of the face recognized in the
+// image, or nil when there is none
+func (s *EnrollmentService) checkRecognition(ctx context.Context, name string, data []byte, filename string, check *domain.EnrollmentImageCheck) *domain.FaceLocation {
+	result, err := s.faceClient.RecognizeFace(ctx, data, filename)
+	if err != nil {
+		check.Errors = append(check.Errors, fmt.Sprintf("face service could not process image: %v", err))
+		return nil
+	}
+
+	check.FacesDetected = result.FacesDetected
+
+	switch {
+	case result.FacesDetected == 0 || len(result.Faces) == 0:
+		check.Errors = append(check.Errors, "no face detected")
+		return nil
+	case result.FacesDetected > 1:
+		check.Warnings = append(check.Warnings, "multiple faces detected")
+	}
+
+	match := result.Faces[0]
+	if match.Name == "Unknown" {
+		return &match.Location
+	}
+
+	check.MatchedName = match.Name
+	check.Confidence = match.Confidence
+
+	if match.Name != name {
+		check.Warnings = append(check.Warnings,
+			fmt.Sprintf("already recognized as %s (%.1f%%)", match.Name, match.Confidence))
+	}
+	return &match.Location
+}
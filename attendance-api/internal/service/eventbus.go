@@ -0,0 +1,191 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+)
+
+const eventBusDrainTimeout = 5 * time.Second
+
+// EventPublisher sends messages to a message broker. Implementations are
+// only used by the event bus worker and need not be safe for concurrent use.
+type EventPublisher interface {
+	// Publish sends one message, returning once the broker has accepted it
+	Publish(topic, key string, headers map[string]string, value []byte) error
+	Close() error
+}
+
+// busEvent is an event waiting to be published
+type busEvent struct {
+	event domain.WebhookEvent
+	key   string
+}
+
+// EventBus publishes attendance events to NATS or Kafka so downstream
+// pipelines can consume them without polling the API. Messages carry the
+// same JSON body as webhooks. Events are queued and published by a single
+// worker so a slow or unreachable broker never holds up a request; when the
+// queue is full events are dropped and logged, and a failed publish is
+// retried once on a new connection.
+type EventBus struct {
+	cfg       config.EventBusConfig
+	target    *url.URL
+	events    map[string]bool // nil publishes every type
+	publisher EventPublisher
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan busEvent
+	done   chan struct{}
+
+	logger *slog.Logger
+}
+
+// NewEventBus validates the configuration and starts publishing. It returns
+// nil when no target is configured; a nil bus drops events.
+func NewEventBus(cfg config.EventBusConfig) (*EventBus, error) {
+	if cfg.Target == "" {
+		return nil, nil
+	}
+
+	target, err := url.Parse(cfg.Target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event bus target %q: %w", cfg.Target, err)
+	}
+	if cfg.Topic == "" {
+		return nil, fmt.Errorf("EVENT_BUS_TOPIC is required with an event bus target")
+	}
+
+	var events map[string]bool
+	if len(cfg.Events) > 0 {
+		events = make(map[string]bool)
+		for _, event := range cfg.Events {
+			if !slices.Contains(domain.WebhookEventTypes, event) {
+				return nil, fmt.Errorf("unknown event bus event type %q", event)
+			}
+			events[event] = true
+		}
+	}
+
+	var publisher EventPublisher
+	switch target.Scheme {
+	case "nats":
+		publisher = newNATSPublisher(target, cfg.Timeout)
+	case "kafka":
+		if publisher, err = newKafkaPublisher(target, cfg.Timeout); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported event bus target %q, expected nats:// or kafka://", cfg.Target)
+	}
+
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+
+	b := &EventBus{
+		logger:    logging.Component("eventbus"),
+		cfg:       cfg,
+		target:    target,
+		events:    events,
+		publisher: publisher,
+		queue:     make(chan busEvent, queueSize),
+		done:      make(chan struct{}),
+	}
+	go b.run()
+
+	b.logger.Info("Publishing events", "target", target.Scheme+"://"+target.Host, "topic", cfg.Topic)
+	return b, nil
+}
+
+// Emit queues an event for publishing. It never blocks.
+func (b *EventBus) Emit(msg domain.SSEMessage) {
+	if b == nil || (b.events != nil && !b.events[msg.Event]) {
+		return
+	}
+
+	// Keying by person keeps each person's events in order on Kafka
+	key := msg.Subject()
+	if msg.Record != nil && msg.Record.PersonID != "" {
+		key = msg.Record.PersonID
+	}
+	queued := busEvent{
+		event: domain.WebhookEvent{ID: uuid.New().String(), Event: msg.Event, CreatedAt: time.Now(), Data: msg.Data()},
+		key:   key,
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+
+	select {
+	case b.queue <- queued:
+	default:
+		b.logger.Warn("Queue full, dropped event", "event", msg.Event)
+	}
+}
+
+// Close publishes what is still queued, giving up after a few seconds
+func (b *EventBus) Close() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-b.done:
+	case <-time.After(eventBusDrainTimeout):
+		b.logger.Warn("Broker too slow, dropping queued events", "events", len(b.queue))
+	}
+}
+
+func (b *EventBus) run() {
+	defer close(b.done)
+	defer b.publisher.Close()
+
+	for queued := range b.queue {
+		if err := b.publish(queued); err != nil {
+			b.logger.Warn("Failed to publish event", "event", queued.event.Event, "event_id", queued.event.ID, "error", err)
+		}
+	}
+}
+
+func (b *EventBus) publish(queued busEvent) error {
+	body, err := json.Marshal(queued.event)
+	if err != nil {
+		return err
+	}
+
+	topic := b.cfg.Topic
+	if b.target.Scheme == "nats" {
+		topic += "." + queued.event.Event
+	}
+	headers := map[string]string{"event": queued.event.Event, "event-id": queued.event.ID}
+
+	if err := b.publisher.Publish(topic, queued.key, headers, body); err != nil {
+		// The connection may have gone stale since the last event
+		b.publisher.Close()
+		return b.publisher.Publish(topic, queued.key, headers, body)
+	}
+	return nil
+}
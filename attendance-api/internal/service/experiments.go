@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"attendance-api/internal/client"
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+
+	"github.com/google/uuid"
+)
+
+// experimentReportLimit caps the disagreements listed in a report
+const experimentReportLimit = 50
+
+// ExperimentService runs a canary experiment: for a sample of submissions it
+// judges the faces again under a candidate threshold, and with a candidate
+// face service, and records whether the outcome matches the stable one. It
+// never changes what the stable configuration decided.
+type ExperimentService struct {
+	candidate client.Recognizer // nil judges the stable face service's result
+	db        *sql.DB
+	reads     *sql.DB
+	cfg       config.ExperimentConfig
+	stableMin float64
+
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	logger *slog.Logger
+}
+
+func NewExperimentService(candidate client.Recognizer, db, reads *sql.DB, cfg config.ExperimentConfig, stableMin float64) (*ExperimentService, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	service := &ExperimentService{
+		logger:    logging.Component("experiment"),
+		candidate: candidate,
+		db:        db,
+		reads:     reads,
+		cfg:       cfg,
+		stableMin: stableMin,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+
+	if err := service.initSchema(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	if cfg.Percent > 0 {
+		provider := "the stable face service"
+		if candidate != nil {
+			provider = "a candidate face service"
+		}
+		service.logger.Info("Experiment running", "experiment", cfg.Name, "percent", cfg.Percent, "min_confidence", cfg.MinConfidence,
+			"stable_min_confidence", stableMin, "candidate", provider)
+	}
+
+	return service, nil
+}
+
+func (s *ExperimentService) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS experiment_outcomes (
+		id TEXT PRIMARY KEY,
+		experiment TEXT NOT NULL,
+		timestamp DATETIME NOT NULL,
+		device_id TEXT NOT NULL DEFAULT '',
+		location TEXT NOT NULL DEFAULT '',
+		stable TEXT NOT NULL,
+		candidate TEXT NOT NULL,
+		agree INTEGER NOT NULL,
+		stable_only INTEGER NOT NULL,
+		candidate_only INTEGER NOT NULL,
+		error TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_experiment_outcomes_experiment ON experiment_outcomes(experiment, timestamp DESC);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+	return nil
+}
+
+// Close waits for the comparisons in flight, cutting off calls to the
+// candidate face service
+func (s *ExperimentService) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Observe samples a submission into the experiment. stable is the face
+// service's result before the stable threshold was applied. The comparison
+// runs in the background so the submission is not slowed down.
+func (s *ExperimentService) Observe(sub domain.AttendanceSubmission, stable *domain.RecognitionResult) {
+	if s == nil || s.cfg.Percent <= 0 || rand.Float64()*100 >= s.cfg.Percent {
+		return
+	}
+
+	outcome := domain.ExperimentOutcome{
+		ID:         uuid.New().String(),
+		Experiment: s.cfg.Name,
+		Timestamp:  time.Now(),
+		DeviceID:   sub.DeviceID,
+		Location:   sub.Location,
+		Stable:     recognizedAbove(stable, s.stableMin),
+	}
+
+	// Without a candidate face service the result is judged again right
+	// away, before the stable threshold is applied to it
+	if s.candidate == nil {
+		outcome.Candidate = recognizedAbove(stable, s.cfg.MinConfidence)
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		if s.candidate != nil {
+			ctx, cancel := context.WithTimeout(s.ctx, s.cfg.FaceAPI.Timeout)
+			defer cancel()
+
+			result, err := s.candidate.RecognizeFace(ctx, sub.ImageData, sub.Filename)
+			if err != nil {
+				outcome.Error = err.Error()
+			} else {
+				outcome.Candidate = recognizedAbove(result, s.cfg.MinConfidence)
+			}
+		}
+
+		s.record(outcome)
+	}()
+}
+
+// recognizedAbove lists the people recognized in result with at least min
+// confidence, best match per person, by name
+func recognizedAbove(result *domain.RecognitionResult, min float64) []domain.ExperimentMatch {
+	best := make(map[string]float64)
+	for _, face := range result.Faces {
+		if face.Name == "Unknown" || face.Confidence < min {
+			continue
+		}
+		if confidence, ok := best[face.Name]; !ok || face.Confidence > confidence {
+			best[face.Name] = face.Confidence
+		}
+	}
+
+	matches := make([]domain.ExperimentMatch, 0, len(best))
+	for name, confidence := range best {
+		matches = append(matches, domain.ExperimentMatch{Name: name, Confidence: confidence})
+	}
+	slices.SortFunc(matches, func(a, b domain.ExperimentMatch) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return matches
+}
+
+// missingFrom reports whether a names someone b does not
+func missingFrom(a, b []domain.ExperimentMatch) bool {
+	for _, match := range a {
+		if !slices.ContainsFunc(b, func(other domain.ExperimentMatch) bool { return other.Name == match.Name }) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ExperimentService) record(outcome domain.ExperimentOutcome) {
+	var stableOnly, candidateOnly bool
+	if outcome.Error == "" {
+		stableOnly = missingFrom(outcome.Stable, outcome.Candidate)
+		candidateOnly = missingFrom(outcome.Candidate, outcome.Stable)
+		outcome.Agree = !stableOnly && !candidateOnly
+	}
+
+	switch {
+	case outcome.Error != "":
+		s.logger.Warn("Experiment candidate failed", "experiment", outcome.Experiment, "stable", matchList(outcome.Stable), "error", outcome.Error)
+	case outcome.Agree:
+		s.logger.Debug("Experiment agrees", "experiment", outcome.Experiment, "stable", matchList(outcome.Stable), "candidate", matchList(outcome.Candidate))
+	default:
+		s.logger.Info("Experiment disagrees", "experiment", outcome.Experiment, "stable", matchList(outcome.Stable), "candidate", matchList(outcome.Candidate))
+	}
+
+	stable, err := json.Marshal(outcome.Stable)
+	if err != nil {
+		s.logger.Error("Failed to encode outcome", "error", err)
+		return
+	}
+	candidate, err := json.Marshal(outcome.Candidate)
+	if err != nil {
+		s.logger.Error("Failed to encode outcome", "error", err)
+		return
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO experiment_outcomes (id, experiment, timestamp, device_id, location, stable, candidate, agree, stable_only, candidate_only, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, outcome.ID, outcome.Experiment, outcome.Timestamp, outcome.DeviceID, outcome.Location,
+		string(stable), string(candidate), outcome.Agree, stableOnly, candidateOnly, outcome.Error)
+	if err != nil {
+		s.logger.Error("Failed to store outcome", "error", err)
+	}
+}
+
+func matchList(matches []domain.ExperimentMatch) string {
+	parts := make([]string, 0, len(matches))
+	for _, match := range matches {
+		parts = append(parts, fmt.Sprintf("%s(%.1f)", match.Name, match.Confidence))
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// Report sums up the outcomes of an experiment between from and to. An
+// empty name reports the experiment currently configured.
+func (s *ExperimentService) Report(name string, from, to time.Time) (*domain.ExperimentReport, error) {
+	if name == "" {
+		name = s.cfg.Name
+	}
+
+	report := &domain.ExperimentReport{
+		Experiment:    name,
+		Active:        s.cfg.Percent > 0 && name == s.cfg.Name,
+		From:          from,
+		To:            to,
+		Disagreements: []domain.ExperimentOutcome{},
+	}
+
+	err := s.reads.QueryRow(`
+		SELECT
+			COALESCE(SUM(error = ''), 0),
+			COALESCE(SUM(error = '' AND agree = 1), 0),
+			COALESCE(SUM(stable_only = 1), 0),
+			COALESCE(SUM(candidate_only = 1), 0),
+			COALESCE(SUM(error != ''), 0)
+		FROM experiment_outcomes
+		WHERE experiment = ? AND timestamp >= ? AND timestamp < ?
+	`, name, from, to).Scan(&report.Compared, &report.Agreed, &report.StableOnly, &report.CandidateOnly, &report.Errors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count experiment outcomes: %w", err)
+	}
+	report.Disagreed = report.Compared - report.Agreed
+	if report.Compared > 0 {
+		report.DisagreementRate = float64(report.Disagreed) / float64(report.Compared)
+	}
+
+	rows, err := s.reads.Query(`
+		SELECT id, experiment, timestamp, device_id, location, stable, candidate
+		FROM experiment_outcomes
+		WHERE experiment = ? AND timestamp >= ? AND timestamp < ? AND error = '' AND agree = 0
+		ORDER BY timestamp DESC
+		LIMIT ?
+	`, name, from, to, experimentReportLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query disagreements: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var outcome domain.ExperimentOutcome
+		var stable, candidate string
+		if err := rows.Scan(&outcome.ID, &outcome.Experiment, &outcome.Timestamp, &outcome.DeviceID, &outcome.Location, &stable, &candidate); err != nil {
+			return nil, fmt.Errorf("failed to scan disagreement: %w", err)
+		}
+		if err := json.Unmarshal([]byte(stable), &outcome.Stable); err != nil {
+			return nil, fmt.Errorf("failed to decode disagreement: %w", err)
+		}
+		if err := json.Unmarshal([]byte(candidate), &outcome.Candidate); err != nil {
+			return nil, fmt.Errorf("failed to decode disagreement: %w", err)
+		}
+		report.Disagreements = append(report.Disagreements, outcome)
+	}
+
+	return report, rows.Err()
+}
@@ -0,0 +1,380 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"attendance-api/internal/domain"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// GetMonthlyReport breaks down the month starting at month (any time in it)
+// per person and day. Everyone active in the people table is listed, along
+// with anyone else recognized during the month.
+func (s *AttendanceService) GetMonthlyReport(month time.Time, filter domain.GroupFilter) (*domain.MonthlyReport, error) {
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, s.cfg.Timezone)
+	to := from.AddDate(0, 1, 0)
+
+	days, err := s.calendar.GetCalendar(from, to.AddDate(0, 0, -1))
+	if err != nil {
+		return nil, err
+	}
+
+	people, err := s.monthlyPeople(from, to, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*domain.PersonMonth, len(people))
+	for i := range people {
+		person := &people[i]
+		person.Days = make([]domain.PersonDay, len(days))
+		for j, day := range days {
+			person.Days[j].CalendarDay = day
+		}
+		byName[person.Name] = person
+	}
+
+	// Days are not always 24 hours long, so they are looked up by date
+	indexOf := make(map[string]int, len(days))
+	for i, day := range days {
+		indexOf[day.Date] = i
+	}
+
+	if err := s.addMonthlyRecords(byName, indexOf, from, to, filter); err != nil {
+		return nil, err
+	}
+	if err := s.addMonthlySessions(byName, indexOf, from, to); err != nil {
+		return nil, err
+	}
+
+	today := s.now().Format(dayFormat)
+	for i := range people {
+		person := &people[i]
+		for j := range person.Days {
+			day := &person.Days[j]
+			day.WorkedHours = math.Round(day.WorkedHours*100) / 100
+
+			if day.Recognitions > 0 {
+				person.DaysPresent++
+			} else if day.Workday && day.Date <= today {
+				person.WorkdaysAbsent++
+			}
+			if day.Late {
+				person.LateDays++
+				person.LateMinutes += day.LatenessMinutes
+			}
+			if day.EarlyLeave {
+				person.EarlyLeaves++
+				person.EarlyLeaveMinutes += day.EarlyLeaveMinutes
+			}
+			person.WorkedHours += day.WorkedHours
+			person.Recognitions += day.Recognitions
+		}
+		person.WorkedHours = math.Round(person.WorkedHours*100) / 100
+	}
+
+	return &domain.MonthlyReport{
+		Month:  from.Format("2006-01"),
+		Days:   days,
+		People: people,
+	}, nil
+}
+
+// monthlyPeople lists the people a monthly report covers, by name
+func (s *AttendanceService) monthlyPeople(from, to time.Time, filter domain.GroupFilter) ([]domain.PersonMonth, error) {
+	where, groupArgs := groupClause(filter)
+	args := append(append(slices.Clone(groupArgs), from, to), groupArgs...)
+
+	rows, err := s.reads.Query(`
+		SELECT name, full_name, employee_number, department
+		FROM people
+		WHERE active = 1 AND `+where+`
+		UNION
+		SELECT DISTINCT name, '', '', ''
+		FROM attendance
+		WHERE status = 'authorized' AND timestamp >= ? AND timestamp < ?
+			AND name NOT IN (SELECT name FROM people) AND `+where+`
+		ORDER BY name
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query people: %w", err)
+	}
+	defer rows.Close()
+
+	people := []domain.PersonMonth{}
+	for rows.Next() {
+		var person domain.PersonMonth
+		if err := rows.Scan(&person.Name, &person.FullName, &person.EmployeeNumber, &person.Department); err != nil {
+			return nil, fmt.Errorf("failed to scan person: %w", err)
+		}
+		people = append(people, person)
+	}
+	return people, rows.Err()
+}
+
+// addMonthlyRecords counts the authorized recognitions of the month into
+// the days of each person
+func (s *AttendanceService) addMonthlyRecords(people map[string]*domain.PersonMonth, indexOf map[string]int, from, to time.Time, filter domain.GroupFilter) error {
+	where, args := groupClause(filter)
+	rows, err := s.reads.Query(`
+		SELECT name, timestamp, COALESCE(event_type, ''), late, COALESCE(lateness_minutes, 0), early_leave, early_leave_minutes
+		FROM attendance
+		WHERE status = 'authorized' AND timestamp >= ? AND timestamp < ? AND `+where+`
+		ORDER BY timestamp ASC
+	`, append([]interface{}{from, to}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to query records: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			name, eventType   string
+			ts                time.Time
+			late, earlyLeave  bool
+			lateness, leaving int
+		)
+		if err := rows.Scan(&name, &ts, &eventType, &late, &lateness, &earlyLeave, &leaving); err != nil {
+			return fmt.Errorf("failed to scan record: %w", err)
+		}
+
+		person, ok := people[name]
+		if !ok {
+			continue
+		}
+		i, ok := indexOf[ts.In(s.cfg.Timezone).Format(dayFormat)]
+		if !ok {
+			continue
+		}
+		day := &person.Days[i]
+
+		if day.FirstSeen == nil {
+			day.FirstSeen = &ts
+		}
+		day.LastSeen = &ts
+		day.Recognitions++
+		if late && !day.Late {
+			day.Late = true
+			day.LatenessMinutes = lateness
+		}
+		// Only the last check-out of the day counts for leaving early
+		if eventType == domain.EventCheckOut {
+			day.EarlyLeave = earlyLeave
+			day.EarlyLeaveMinutes = 0
+			if earlyLeave {
+				day.EarlyLeaveMinutes = leaving
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// addMonthlySessions adds up the hours worked in the closed sessions of the
+// month
+func (s *AttendanceService) addMonthlySessions(people map[string]*domain.PersonMonth, indexOf map[string]int, from, to time.Time) error {
+	rows, err := s.reads.Query(`
+		SELECT name, day, check_in, check_out
+		FROM attendance_sessions
+		WHERE day >= ? AND day < ?
+	`, from.Format(dayFormat), to.Format(dayFormat))
+	if err != nil {
+		return fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			name, date string
+			checkIn    time.Time
+			checkOut   sql.NullTime
+		)
+		if err := rows.Scan(&name, &date, &checkIn, &checkOut); err != nil {
+			return fmt.Errorf("failed to scan session: %w", err)
+		}
+
+		person, ok := people[name]
+		if !ok {
+			continue
+		}
+		i, ok := indexOf[date]
+		if !ok {
+			continue
+		}
+
+		if checkOut.Valid {
+			person.Days[i].WorkedHours += checkOut.Time.Sub(checkIn).Hours()
+		} else {
+			person.Days[i].OpenSession = true
+		}
+	}
+	return rows.Err()
+}
+
+// WriteMonthlyXLSX writes a monthly report as a spreadsheet: a summary sheet
+// with everyone's totals, then one sheet per person with a row per day
+func WriteMonthlyXLSX(report *domain.MonthlyReport, loc *time.Location, w io.Writer) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	bold, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return fmt.Errorf("failed to create style: %w", err)
+	}
+
+	const summary = "Summary"
+	if err := f.SetSheetName(f.GetSheetName(0), summary); err != nil {
+		return fmt.Errorf("failed to name summary sheet: %w", err)
+	}
+
+	header := []interface{}{"Name", "Full name", "Employee number", "Department", "Days present",
+		"Workdays absent", "Late days", "Late minutes", "Early leaves", "Early leave minutes",
+		"Worked hours", "Recognitions", "Sheet"}
+	if err := writeSheetHeader(f, summary, header, bold); err != nil {
+		return err
+	}
+
+	used := map[string]bool{strings.ToLower(summary): true}
+	for i, person := range report.People {
+		sheet := uniqueSheetName(person.Name, used)
+
+		row := []interface{}{person.Name, person.FullName, person.EmployeeNumber, person.Department,
+			person.DaysPresent, person.WorkdaysAbsent, person.LateDays, person.LateMinutes,
+			person.EarlyLeaves, person.EarlyLeaveMinutes, person.WorkedHours, person.Recognitions, sheet}
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		if err := f.SetSheetRow(summary, cell, &row); err != nil {
+			return fmt.Errorf("failed to write summary: %w", err)
+		}
+		link, _ := excelize.CoordinatesToCellName(len(row), i+2)
+		if err := f.SetCellHyperLink(summary, link, fmt.Sprintf("'%s'!A1", sheet), "Location"); err != nil {
+			return fmt.Errorf("failed to link sheet: %w", err)
+		}
+
+		if err := writePersonSheet(f, sheet, report.Month, person, loc, bold); err != nil {
+			return err
+		}
+	}
+	if err := f.SetColWidth(summary, "A", "M", 16); err != nil {
+		return fmt.Errorf("failed to size columns: %w", err)
+	}
+
+	if _, err := f.WriteTo(w); err != nil {
+		return fmt.Errorf("failed to write spreadsheet: %w", err)
+	}
+	return nil
+}
+
+func writePersonSheet(f *excelize.File, sheet, month string, person domain.PersonMonth, loc *time.Location, bold int) error {
+	if _, err := f.NewSheet(sheet); err != nil {
+		return fmt.Errorf("failed to add sheet for %s: %w", person.Name, err)
+	}
+
+	title := person.Name
+	if person.FullName != "" {
+		title = person.FullName + " (" + person.Name + ")"
+	}
+	if err := f.SetCellValue(sheet, "A1", title+", "+month); err != nil {
+		return fmt.Errorf("failed to write sheet for %s: %w", person.Name, err)
+	}
+	if err := f.SetCellStyle(sheet, "A1", "A1", bold); err != nil {
+		return fmt.Errorf("failed to style sheet for %s: %w", person.Name, err)
+	}
+
+	header := []interface{}{"Date", "Weekday", "Day", "First seen", "Last seen", "Worked hours",
+		"Late minutes", "Early leave minutes", "Recognitions"}
+	cell := "A3"
+	if err := f.SetSheetRow(sheet, cell, &header); err != nil {
+		return fmt.Errorf("failed to write sheet for %s: %w", person.Name, err)
+	}
+	if err := f.SetCellStyle(sheet, "A3", "I3", bold); err != nil {
+		return fmt.Errorf("failed to style sheet for %s: %w", person.Name, err)
+	}
+
+	for i, day := range person.Days {
+		kind := "Workday"
+		switch {
+		case day.Holiday != "":
+			kind = day.Holiday
+		case day.Weekend:
+			kind = "Weekend"
+		}
+
+		row := []interface{}{day.Date, day.Weekday, kind, clockTime(day.FirstSeen, loc), clockTime(day.LastSeen, loc),
+			day.WorkedHours, day.LatenessMinutes, day.EarlyLeaveMinutes, day.Recognitions}
+		cell, _ := excelize.CoordinatesToCellName(1, i+4)
+		if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+			return fmt.Errorf("failed to write sheet for %s: %w", person.Name, err)
+		}
+	}
+
+	totals := []interface{}{"Total", "", fmt.Sprintf("%d days present", person.DaysPresent), "", "",
+		person.WorkedHours, person.LateMinutes, person.EarlyLeaveMinutes, person.Recognitions}
+	cell, _ = excelize.CoordinatesToCellName(1, len(person.Days)+4)
+	if err := f.SetSheetRow(sheet, cell, &totals); err != nil {
+		return fmt.Errorf("failed to write sheet for %s: %w", person.Name, err)
+	}
+	end, _ := excelize.CoordinatesToCellName(len(totals), len(person.Days)+4)
+	if err := f.SetCellStyle(sheet, cell, end, bold); err != nil {
+		return fmt.Errorf("failed to style sheet for %s: %w", person.Name, err)
+	}
+
+	if err := f.SetColWidth(sheet, "A", "I", 14); err != nil {
+		return fmt.Errorf("failed to size columns: %w", err)
+	}
+	return nil
+}
+
+func writeSheetHeader(f *excelize.File, sheet string, header []interface{}, style int) error {
+	if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	end, _ := excelize.CoordinatesToCellName(len(header), 1)
+	if err := f.SetCellStyle(sheet, "A1", end, style); err != nil {
+		return fmt.Errorf("failed to style header: %w", err)
+	}
+	return nil
+}
+
+func clockTime(ts *time.Time, loc *time.Location) string {
+	if ts == nil {
+		return ""
+	}
+	return ts.In(loc).Format("15:04")
+}
+
+// uniqueSheetName turns a person's name into a sheet name Excel accepts (at
+// most 31 characters, none of :\/?*[]) that is not yet in used
+func uniqueSheetName(name string, used map[string]bool) string {
+	base := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:\/?*[]`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	base = strings.Trim(base, "'")
+	if base == "" {
+		base = "Person"
+	}
+
+	sheet := truncateRunes(base, 31)
+	for n := 2; used[strings.ToLower(sheet)]; n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		sheet = truncateRunes(base, 31-len(suffix)) + suffix
+	}
+	used[strings.ToLower(sheet)] = true
+	return sheet
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"attendance-api/internal/domain"
+)
+
+// fanOutQueueSize bounds the events waiting to be fanned out to the stream
+// clients
+const fanOutQueueSize = 1024
+
+// SSEClient is a connected event stream client. Events reach it through its
+// own sender goroutine, which moves them from a bounded queue to the channel
+// the stream handler writes from, so a client that reads slowly only ever
+// holds up itself.
+type SSEClient struct {
+	id          string
+	filter      domain.StreamFilter
+	after       uint64 // events up to this ID were replayed or came before the client
+	connectedAt time.Time
+
+	queue   chan domain.SSEMessage
+	channel chan domain.SSEMessage // closed once the client is stopped
+	done    chan struct{}
+	once    sync.Once
+
+	sent    atomic.Int64
+	dropped atomic.Int64 // events lost to the slow client policy
+	totals  *streamTotals
+
+	logger *slog.Logger
+}
+
+// streamTotals counts across all stream clients, including those gone
+type streamTotals struct {
+	delivered        atomic.Int64
+	dropped          atomic.Int64
+	slowDisconnected atomic.Int64
+	fanOutDropped    atomic.Int64
+}
+
+func newSSEClient(id string, filter domain.StreamFilter, after uint64, buffer int, totals *streamTotals, logger *slog.Logger) *SSEClient {
+	client := &SSEClient{
+		id:          id,
+		filter:      filter,
+		after:       after,
+		connectedAt: time.Now(),
+		queue:       make(chan domain.SSEMessage, buffer),
+		channel:     make(chan domain.SSEMessage),
+		done:        make(chan struct{}),
+		totals:      totals,
+		logger:      logger,
+	}
+	go client.run()
+	return client
+}
+
+// run hands queued events to the stream handler until the client is stopped
+func (c *SSEClient) run() {
+	defer close(c.channel)
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.queue:
+			select {
+			case c.channel <- msg:
+				c.sent.Add(1)
+				c.totals.delivered.Add(1)
+			case <-c.done:
+				return
+			}
+		}
+	}
+}
+
+// stop ends the client's stream; its channel is closed once the sender has
+// finished
+func (c *SSEClient) stop() {
+	c.once.Do(func() { close(c.done) })
+}
+
+func (c *SSEClient) active() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// wants reports whether the client should get an event: it passes the
+// filter and was neither replayed nor broadcast before the client connected
+func (c *SSEClient) wants(msg domain.SSEMessage) bool {
+	return c.active() && (msg.ID == 0 || msg.ID > c.after) && c.filter.Matches(msg)
+}
+
+// enqueue queues an event for the client, applying the slow client policy
+// when its queue is full. It reports whether the event was queued.
+func (c *SSEClient) enqueue(msg domain.SSEMessage, policy string) bool {
+	select {
+	case c.queue <- msg:
+		return true
+	default:
+	}
+
+	switch policy {
+	case SlowClientDisconnect:
+		// The stream ends and the client reconnects with Last-Event-ID,
+		// catching up from the replay buffer
+		c.stop()
+		c.totals.slowDisconnected.Add(1)
+		c.logger.Warn("Disconnected slow SSE client", "queue", cap(c.queue))
+		return false
+
+	case SlowClientDropOldest:
+		select {
+		case old := <-c.queue:
+			c.dropped.Add(1)
+			c.totals.dropped.Add(1)
+			c.logger.Warn("SSE client too slow, dropped its oldest event", "event_id", old.ID, "dropped", c.dropped.Load())
+		default:
+			// The sender caught up in the meantime
+		}
+		select {
+		case c.queue <- msg:
+			return true
+		default:
+			return false
+		}
+
+	default:
+		c.dropped.Add(1)
+		c.totals.dropped.Add(1)
+		c.logger.Warn("SSE client too slow, dropped event", "event", msg.Event, "event_id", msg.ID, "dropped", c.dropped.Load())
+		return false
+	}
+}
+
+func (c *SSEClient) stats() domain.StreamClientStats {
+	return domain.StreamClientStats{
+		ID:          c.id,
+		Person:      c.filter.Person,
+		ConnectedAt: c.connectedAt,
+		Queued:      len(c.queue),
+		Sent:        c.sent.Load(),
+		Dropped:     c.dropped.Load(),
+	}
+}
+
+// fanOut hands broadcast events to the queues of the stream clients that
+// want them. It runs on its own, so recording attendance only ever waits
+// for an event to be queued here, however many clients are connected.
+func (s *AttendanceService) fanOut() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case msg := <-s.fanOutQueue:
+			s.mu.RLock()
+			successCount, targeted := 0, 0
+			for _, client := range s.clients {
+				if !client.wants(msg) {
+					continue
+				}
+				targeted++
+				if client.enqueue(msg, s.cfg.StreamSlowClient) {
+					successCount++
+				}
+			}
+			s.mu.RUnlock()
+
+			if targeted > 0 {
+				s.logger.Debug("SSE broadcast", "event", msg.Event, "delivered", successCount, "clients", targeted)
+			}
+		}
+	}
+}
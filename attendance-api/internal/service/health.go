@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"attendance-api/internal/client"
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+)
+
+// HealthService answers the liveness and readiness probes of orchestrators
+// such as Kubernetes. A live process is restarted only when it is wedged;
+// a node that is not ready is merely taken out of the load balancer, so
+// readiness checks everything a recognition needs.
+type HealthService struct {
+	db         *sql.DB
+	recognizer client.Recognizer
+	warmup     *WarmupService
+	dirs       []string // written to by the API
+	cfg        config.HealthConfig
+	startedAt  time.Time
+}
+
+func NewHealthService(db *sql.DB, recognizer client.Recognizer, warmup *WarmupService, dirs []string, cfg config.HealthConfig) *HealthService {
+	return &HealthService{
+		db:         db,
+		recognizer: recognizer,
+		warmup:     warmup,
+		dirs:       dirs,
+		cfg:        cfg,
+		startedAt:  time.Now(),
+	}
+}
+
+// Live reports that the process is up. It checks nothing else, so a face
+// service or disk outage does not get every node restarted at once.
+func (s *HealthService) Live() domain.ProbeResult {
+	return probeResult(map[string]domain.DependencyCheck{
+		"process": {
+			Status:   domain.CheckOK,
+			Duration: "0s",
+			Detail:   fmt.Sprintf("up %s, %d goroutines", time.Since(s.startedAt).Round(time.Second), runtime.NumGoroutine()),
+		},
+	})
+}
+
+// Ready checks, at the same time, that the database answers, the face
+// service is reachable, the data directories are writable and the
+// recognition path has been warmed up
+func (s *HealthService) Ready(ctx context.Context) domain.ProbeResult {
+	checks := map[string]func(context.Context) (string, error){
+		"database": s.checkDatabase,
+		"face_api": s.checkFaceAPI,
+		"disk":     s.checkDisk,
+		"warmup":   s.checkWarmup,
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]domain.DependencyCheck, len(checks))
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := runCheck(ctx, s.cfg.CheckTimeout, check)
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return probeResult(results)
+}
+
+// errSkipped marks a dependency that cannot be checked
+var errSkipped = errors.New("skipped")
+
+func runCheck(ctx context.Context, timeout time.Duration, check func(context.Context) (string, error)) domain.DependencyCheck {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	detail, err := check(ctx)
+	result := domain.DependencyCheck{
+		Status:   domain.CheckOK,
+		Duration: time.Since(start).Round(time.Millisecond).String(),
+		Detail:   detail,
+	}
+	switch {
+	case errors.Is(err, errSkipped):
+		result.Status = domain.CheckSkipped
+	case err != nil:
+		result.Status = domain.CheckFailing
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func probeResult(checks map[string]domain.DependencyCheck) domain.ProbeResult {
+	status := domain.CheckOK
+	for _, check := range checks {
+		if check.Status == domain.CheckFailing {
+			status = domain.CheckFailing
+		}
+	}
+	return domain.ProbeResult{Status: status, Checks: checks}
+}
+
+func (s *HealthService) checkDatabase(ctx context.Context) (string, error) {
+	var one int
+	if err := s.db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		return "", fmt.Errorf("database does not answer: %w", err)
+	}
+	return "", nil
+}
+
+func (s *HealthService) checkFaceAPI(ctx context.Context) (string, error) {
+	health, err := s.recognizer.Health(ctx)
+	if errors.Is(err, client.ErrUnsupported) {
+		return "the face backend has no health check", errSkipped
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s, %d known faces", health.Status, health.KnownFaces), nil
+}
+
+// checkDisk creates and removes a file in each data directory, which fails
+// on a full or read-only volume
+func (s *HealthService) checkDisk(ctx context.Context) (string, error) {
+	for _, dir := range s.dirs {
+		file, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return "", fmt.Errorf("%s is not writable: %w", dir, err)
+		}
+		_, err = file.Write([]byte("ok"))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		os.Remove(file.Name())
+		if err != nil {
+			return "", fmt.Errorf("%s is not writable: %w", dir, err)
+		}
+	}
+	return fmt.Sprintf("%d directories writable", len(s.dirs)), nil
+}
+
+func (s *HealthService) checkWarmup(ctx context.Context) (string, error) {
+	status := s.warmup.Status()
+	if status.State == WarmupDisabled {
+		return "warm-up is disabled", errSkipped
+	}
+	if !status.Ready {
+		if status.LastError != "" {
+			return status.State, errors.New(status.LastError)
+		}
+		return status.State, errors.New("the recognition path is still warming up")
+	}
+	return status.State, nil
+}
@@ -0,0 +1,576 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"attendance-api/internal/client"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+)
+
+var (
+	ErrChangeNotFound = errors.New("identity change not found")
+	ErrChangeReverted = errors.New("the identity change was already reverted")
+)
+
+// identityUndo is what reverting an identity change needs to put back. It
+// is stored as JSON with the audit entry.
+type identityUndo struct {
+	// Records are the moved attendance IDs by the person ID they had
+	Records  map[string][]string `json:"records,omitempty"`
+	Sessions []string            `json:"sessions,omitempty"`
+
+	// A merge deletes the source person when the target has one, and
+	// renames it otherwise; a split creates the target person
+	Person        *domain.Person `json:"person,omitempty"`
+	PersonRenamed bool           `json:"person_renamed,omitempty"`
+	PersonCreated string         `json:"person_created,omitempty"`
+
+	// Locations are the source's assignments, AddedLocations the ones the
+	// target gained from them
+	Locations      []string `json:"locations,omitempty"`
+	AddedLocations []string `json:"added_locations,omitempty"`
+
+	// Grants are the source's door access grants as "target_type:target",
+	// AddedGrants the ones the target gained from them
+	Grants      []string `json:"door_grants,omitempty"`
+	AddedGrants []string `json:"added_door_grants,omitempty"`
+
+	APIKeys  []string `json:"api_keys,omitempty"`
+	Unknowns []string `json:"unknowns,omitempty"`
+}
+
+func (s *AttendanceService) initIdentitySchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS identity_changes (
+		id TEXT PRIMARY KEY,
+		type TEXT NOT NULL,
+		source TEXT NOT NULL,
+		target TEXT NOT NULL,
+		images TEXT NOT NULL,
+		records_moved INTEGER NOT NULL DEFAULT 0,
+		sessions_moved INTEGER NOT NULL DEFAULT 0,
+		undo TEXT NOT NULL,
+		changed_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		reverted_at DATETIME,
+		reverted_by TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_identity_changes_created_at ON identity_changes(created_at DESC);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute identity change schema: %w", err)
+	}
+
+	return nil
+}
+
+// recordIdentityChange writes the audit entry of a merge or split as part of
+// its transaction
+func (s *AttendanceService) recordIdentityChange(ctx context.Context, tx *sql.Tx, change *domain.IdentityChange, undo identityUndo) error {
+	change.ID = s.newID()
+	change.ChangedBy = domain.ActorFromContext(ctx).String()
+	change.CreatedAt = time.Now()
+	if change.Images == nil {
+		change.Images = []domain.ImageMove{}
+	}
+
+	images, err := json.Marshal(change.Images)
+	if err != nil {
+		return fmt.Errorf("failed to encode moved images: %w", err)
+	}
+	undoData, err := json.Marshal(undo)
+	if err != nil {
+		return fmt.Errorf("failed to encode undo data: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO identity_changes (id, type, source, target, images, records_moved, sessions_moved, undo, changed_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, change.ID, change.Type, change.Source, change.Target, string(images), change.RecordsMoved, change.SessionsMoved,
+		string(undoData), change.ChangedBy, change.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record identity change: %w", err)
+	}
+
+	return nil
+}
+
+const identityChangeColumns = `id, type, source, target, images, records_moved, sessions_moved, undo,
+	changed_by, created_at, reverted_at, reverted_by`
+
+func scanIdentityChange(row rowScanner) (*domain.IdentityChange, *identityUndo, error) {
+	var (
+		change     domain.IdentityChange
+		images     string
+		undoData   string
+		revertedAt sql.NullTime
+	)
+	err := row.Scan(&change.ID, &change.Type, &change.Source, &change.Target, &images, &change.RecordsMoved,
+		&change.SessionsMoved, &undoData, &change.ChangedBy, &change.CreatedAt, &revertedAt, &change.RevertedBy)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("failed to scan identity change: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(images), &change.Images); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode moved images: %w", err)
+	}
+	var undo identityUndo
+	if err := json.Unmarshal([]byte(undoData), &undo); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode undo data: %w", err)
+	}
+	if revertedAt.Valid {
+		change.RevertedAt = &revertedAt.Time
+	}
+
+	return &change, &undo, nil
+}
+
+// ListIdentityChanges returns the most recent merges and splits, newest first
+func (s *AttendanceService) ListIdentityChanges(limit int) ([]domain.IdentityChange, error) {
+	rows, err := s.reads.Query(`
+		SELECT `+identityChangeColumns+`
+		FROM identity_changes
+		ORDER BY created_at DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query identity changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []domain.IdentityChange{}
+	for rows.Next() {
+		change, _, err := scanIdentityChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, *change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return changes, nil
+}
+
+// collectMergeUndo notes the rows of source a merge into target is about to
+// change
+func (s *AttendanceService) collectMergeUndo(tx *sql.Tx, source, target string, undo *identityUndo) error {
+	rows, err := tx.Query("SELECT id, person_id FROM attendance WHERE name = ?", source)
+	if err != nil {
+		return fmt.Errorf("failed to query attendance: %w", err)
+	}
+	for rows.Next() {
+		var recordID, personID string
+		if err := rows.Scan(&recordID, &personID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan attendance: %w", err)
+		}
+		undo.Records[personID] = append(undo.Records[personID], recordID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("row iteration error: %w", err)
+	}
+
+	lists := []struct {
+		into  *[]string
+		query string
+		args  []interface{}
+	}{
+		{&undo.Sessions, "SELECT id FROM attendance_sessions WHERE name = ?", []interface{}{source}},
+		{&undo.Locations, "SELECT location FROM person_locations WHERE name = ?", []interface{}{source}},
+		{&undo.AddedLocations, "SELECT location FROM person_locations WHERE name = ? AND location NOT IN (SELECT location FROM person_locations WHERE name = ?)", []interface{}{source, target}},
+		{&undo.Grants, "SELECT target_type || ':' || target FROM door_grants WHERE subject_type = 'person' AND subject = ?", []interface{}{source}},
+		{&undo.AddedGrants, "SELECT target_type || ':' || target FROM door_grants WHERE subject_type = 'person' AND subject = ? AND target_type || ':' || target NOT IN (SELECT target_type || ':' || target FROM door_grants WHERE subject_type = 'person' AND subject = ?)", []interface{}{source, target}},
+		{&undo.APIKeys, "SELECT id FROM api_keys WHERE person = ?", []interface{}{source}},
+		{&undo.Unknowns, "SELECT id FROM unknown_events WHERE enrolled_name = ?", []interface{}{source}},
+	}
+	for _, list := range lists {
+		values, err := queryStrings(tx, list.query, list.args...)
+		if err != nil {
+			return err
+		}
+		*list.into = values
+	}
+
+	return nil
+}
+
+// MergePerson merges the person with ID id into the person with ID intoID,
+// as MergePeople does by name
+func (s *AttendanceService) MergePerson(ctx context.Context, id, intoID string) (*domain.PeopleMerge, error) {
+	source, err := s.GetPerson(id)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.GetPerson(intoID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.MergePeople(ctx, source.Name, target.Name)
+}
+
+// SplitPerson moves part of a person's face images and attendance history to
+// a new identity, for when two people were enrolled as one. The new
+// identity gets a person entry of its own.
+func (s *AttendanceService) SplitPerson(ctx context.Context, id string, split domain.PersonSplit) (*domain.IdentityChange, *domain.Person, error) {
+	source, err := s.GetPerson(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	split.Name = NormalizeName(split.Name)
+	if split.Name == "" || split.Name == "unknown" || split.Name == source.Name {
+		return nil, nil, fmt.Errorf("%w: the new identity needs a name of its own", ErrInvalidPerson)
+	}
+	byPeriod := !split.From.IsZero() || !split.To.IsZero()
+	if len(split.Images) == 0 && len(split.Records) == 0 && !byPeriod {
+		return nil, nil, fmt.Errorf("%w: choose the images or attendance records to split off", ErrInvalidPerson)
+	}
+
+	// The new identity must not be known to the face service yet, or the
+	// images would be merged into someone else
+	faces, err := s.faceClient.GetFaces(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get faces: %w", err)
+	}
+	for _, face := range faces {
+		if face.Name == split.Name {
+			return nil, nil, ErrPersonExists
+		}
+	}
+
+	// Records are chosen before anything moves, so a bad selection changes nothing
+	undo := identityUndo{Records: map[string][]string{}}
+	conditions := []string{}
+	args := []interface{}{source.Name}
+	if len(split.Records) > 0 {
+		conditions = append(conditions, "id IN (?"+strings.Repeat(", ?", len(split.Records)-1)+")")
+		for _, record := range split.Records {
+			args = append(args, record)
+		}
+	}
+	if byPeriod {
+		to := split.To
+		if to.IsZero() {
+			to = time.Now().Add(time.Second)
+		}
+		conditions = append(conditions, "(timestamp >= ? AND timestamp < ?)")
+		args = append(args, split.From, to)
+	}
+
+	moved := make(map[string]bool)
+	days := make(map[string]bool)
+	if len(conditions) > 0 {
+		rows, err := s.db.Query("SELECT id, person_id, timestamp FROM attendance WHERE name = ? AND ("+strings.Join(conditions, " OR ")+")", args...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to query attendance: %w", err)
+		}
+		for rows.Next() {
+			var (
+				recordID, personID string
+				timestamp          time.Time
+			)
+			if err := rows.Scan(&recordID, &personID, &timestamp); err != nil {
+				rows.Close()
+				return nil, nil, fmt.Errorf("failed to scan attendance: %w", err)
+			}
+			undo.Records[personID] = append(undo.Records[personID], recordID)
+			moved[recordID] = true
+			days[timestamp.In(s.cfg.Timezone).Format(dayFormat)] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, nil, fmt.Errorf("row iteration error: %w", err)
+		}
+	}
+
+	for _, record := range split.Records {
+		if !moved[record] {
+			return nil, nil, fmt.Errorf("%w: attendance record %s is not of %s", ErrInvalidPerson, record, source.Name)
+		}
+	}
+	if len(split.Images) == 0 && len(moved) == 0 {
+		return nil, nil, fmt.Errorf("%w: no attendance records of %s in the period", ErrInvalidPerson, source.Name)
+	}
+
+	var images []domain.ImageMove
+	if len(split.Images) > 0 {
+		stored, err := s.faceClient.ListFaceImages(ctx, source.Name)
+		if err != nil && !errors.Is(err, client.ErrFaceNotFound) {
+			return nil, nil, err
+		}
+		known := make(map[string]bool, len(stored))
+		for _, file := range stored {
+			known[file] = true
+		}
+		for _, file := range split.Images {
+			if !known[file] {
+				return nil, nil, fmt.Errorf("%w: %s is not an image of %s", ErrInvalidPerson, file, source.Name)
+			}
+		}
+
+		images, err = s.faceClient.MergeFaces(ctx, source.Name, split.Name, split.Images)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	person := &domain.Person{ID: s.newID(), Name: split.Name, Active: true, CreatedAt: now, UpdatedAt: now}
+	_, err = tx.Exec("INSERT INTO people (id, name, created_at, updated_at) VALUES (?, ?, ?, ?)",
+		person.ID, person.Name, person.CreatedAt, person.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, nil, ErrPersonExists
+		}
+		return nil, nil, fmt.Errorf("failed to insert person: %w", err)
+	}
+
+	undo.PersonCreated = person.ID
+	change := &domain.IdentityChange{Type: domain.IdentitySplit, Source: source.Name, Target: split.Name, Images: images}
+
+	for _, ids := range undo.Records {
+		if err := execEach(tx, "UPDATE attendance SET name = ?, person_id = ? WHERE id = ?", ids, split.Name, person.ID); err != nil {
+			return nil, nil, fmt.Errorf("failed to move attendance: %w", err)
+		}
+	}
+	change.RecordsMoved = int64(len(moved))
+
+	// A day's sessions follow its records once none of the source are left
+	sortedDays := make([]string, 0, len(days))
+	for day := range days {
+		sortedDays = append(sortedDays, day)
+	}
+	sort.Strings(sortedDays)
+	for _, day := range sortedDays {
+		start, err := time.ParseInLocation(dayFormat, day, s.cfg.Timezone)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse day: %w", err)
+		}
+
+		var remaining int
+		err = tx.QueryRow("SELECT COUNT(*) FROM attendance WHERE name = ? AND timestamp >= ? AND timestamp < ?",
+			source.Name, start, start.AddDate(0, 0, 1)).Scan(&remaining)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to count attendance: %w", err)
+		}
+		if remaining > 0 {
+			continue
+		}
+
+		sessions, err := queryStrings(tx, "SELECT id FROM attendance_sessions WHERE name = ? AND day = ?", source.Name, day)
+		if err != nil {
+			return nil, nil, err
+		}
+		undo.Sessions = append(undo.Sessions, sessions...)
+	}
+	if err := execEach(tx, "UPDATE attendance_sessions SET name = ? WHERE id = ?", undo.Sessions, split.Name); err != nil {
+		return nil, nil, fmt.Errorf("failed to move sessions: %w", err)
+	}
+	change.SessionsMoved = int64(len(undo.Sessions))
+
+	if err := s.recordIdentityChange(ctx, tx, change, undo); err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit split: %w", err)
+	}
+
+	s.cooldownMu.Lock()
+	delete(s.lastSeen, source.Name)
+	s.cooldownMu.Unlock()
+
+	logging.From(ctx).Info("Split person", "source", source.Name, "target", split.Name, "images", len(images), "records", change.RecordsMoved)
+
+	return change, person, nil
+}
+
+// RevertIdentityChange undoes a merge or split. The face images and the
+// records that were moved go back; images removed since are skipped and
+// attendance recorded after the change stays where it is.
+func (s *AttendanceService) RevertIdentityChange(ctx context.Context, id string) (*domain.IdentityChange, error) {
+	change, undo, err := scanIdentityChange(s.db.QueryRow("SELECT "+identityChangeColumns+" FROM identity_changes WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrChangeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if change.RevertedAt != nil {
+		return nil, ErrChangeReverted
+	}
+
+	if len(change.Images) > 0 {
+		stored, err := s.faceClient.ListFaceImages(ctx, change.Target)
+		if err != nil && !errors.Is(err, client.ErrFaceNotFound) {
+			return nil, err
+		}
+		present := make(map[string]bool, len(stored))
+		for _, file := range stored {
+			present[file] = true
+		}
+
+		files := []string{}
+		for _, image := range change.Images {
+			if present[image.To] {
+				files = append(files, image.To)
+			}
+		}
+		if len(files) > 0 {
+			if _, err := s.faceClient.MergeFaces(ctx, change.Target, change.Source, files); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	switch {
+	case undo.Person != nil:
+		p := undo.Person
+		_, err = tx.Exec(`
+			INSERT INTO people (id, name, full_name, employee_number, external_id, card_number, email, active,
+				department, group_name, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, p.ID, p.Name, p.FullName, p.EmployeeNumber, p.ExternalID, p.CardNumber, p.Email, p.Active,
+			p.Department, p.Group, p.CreatedAt, now)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return nil, ErrPersonExists
+			}
+			return nil, fmt.Errorf("failed to restore person: %w", err)
+		}
+	case undo.PersonRenamed:
+		_, err = tx.Exec("UPDATE people SET name = ?, updated_at = ? WHERE name = ?", change.Source, now, change.Target)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return nil, ErrPersonExists
+			}
+			return nil, fmt.Errorf("failed to rename person: %w", err)
+		}
+	}
+	if undo.PersonCreated != "" {
+		if _, err := tx.Exec("DELETE FROM people WHERE id = ?", undo.PersonCreated); err != nil {
+			return nil, fmt.Errorf("failed to delete person: %w", err)
+		}
+	}
+
+	for personID, ids := range undo.Records {
+		if err := execEach(tx, "UPDATE attendance SET name = ?, person_id = ? WHERE id = ?", ids, change.Source, personID); err != nil {
+			return nil, fmt.Errorf("failed to restore attendance: %w", err)
+		}
+	}
+
+	restores := []struct {
+		statement string
+		values    []string
+		args      []interface{}
+	}{
+		{"UPDATE attendance_sessions SET name = ? WHERE id = ?", undo.Sessions, []interface{}{change.Source}},
+		{"DELETE FROM person_locations WHERE name = ? AND location = ?", undo.AddedLocations, []interface{}{change.Target}},
+		{"INSERT OR IGNORE INTO person_locations (name, location) VALUES (?, ?)", undo.Locations, []interface{}{change.Source}},
+		{"DELETE FROM door_grants WHERE subject_type = 'person' AND subject = ?1 AND target_type || ':' || target = ?2", undo.AddedGrants, []interface{}{change.Target}},
+		{"INSERT OR IGNORE INTO door_grants (target_type, target, subject_type, subject) VALUES (substr(?2, 1, instr(?2, ':') - 1), substr(?2, instr(?2, ':') + 1), 'person', ?1)", undo.Grants, []interface{}{change.Source}},
+		{"UPDATE api_keys SET person = ? WHERE id = ?", undo.APIKeys, []interface{}{change.Source}},
+		{"UPDATE unknown_events SET enrolled_name = ? WHERE id = ?", undo.Unknowns, []interface{}{change.Source}},
+	}
+	for _, restore := range restores {
+		if err := execEach(tx, restore.statement, restore.values, restore.args...); err != nil {
+			return nil, fmt.Errorf("failed to revert %s: %w", change.ID, err)
+		}
+	}
+
+	change.RevertedAt = &now
+	change.RevertedBy = domain.ActorFromContext(ctx).String()
+	_, err = tx.Exec("UPDATE identity_changes SET reverted_at = ?, reverted_by = ? WHERE id = ?", now, change.RevertedBy, change.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark change reverted: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit revert: %w", err)
+	}
+
+	s.cooldownMu.Lock()
+	delete(s.lastSeen, change.Target)
+	s.cooldownMu.Unlock()
+
+	logging.From(ctx).Info("Reverted identity change", "type", change.Type, "source", change.Source, "target", change.Target)
+
+	return change, nil
+}
+
+// queryStrings returns the single string column of a query's rows
+func queryStrings(tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query: %w", err)
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, fmt.Errorf("failed to scan: %w", err)
+		}
+		values = append(values, value)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return values, nil
+}
+
+// execEach runs statement once for every value, passed after args
+func execEach(tx *sql.Tx, statement string, values []string, args ...interface{}) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(statement)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, value := range values {
+		if _, err := stmt.Exec(append(args[:len(args):len(args)], value)...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
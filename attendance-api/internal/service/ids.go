@@ -0,0 +1,26 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// IDGenerator creates the IDs of new attendance records, sessions and people
+type IDGenerator func() string
+
+// NewIDGenerator returns the generator for an ID format: "uuid" (random, the
+// default) or "uuidv7", which starts with the creation time so IDs sort in
+// the order they were created
+func NewIDGenerator(format string) (IDGenerator, error) {
+	switch format {
+	case "", "uuid":
+		return uuid.NewString, nil
+	case "uuidv7":
+		return func() string {
+			return uuid.Must(uuid.NewV7()).String()
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown id format %q", format)
+	}
+}
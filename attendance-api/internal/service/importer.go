@@ -0,0 +1,267 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"attendance-api/internal/domain"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// importBatchSize is the number of rows inserted per transaction
+const importBatchSize = 500
+
+// importTimestampLayouts are tried in order when no format is given
+var importTimestampLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"01/02/2006 15:04:05",
+	"01/02/2006 15:04",
+}
+
+// ParseImportFile reads the rows of a CSV or XLSX file. For spreadsheets the
+// given sheet is used, or the first one when empty.
+func ParseImportFile(filename string, data []byte, sheet string) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		reader := csv.NewReader(bytes.NewReader(data))
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+
+		rows, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+		return rows, nil
+
+	case ".xlsx":
+		f, err := excelize.OpenReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open spreadsheet: %w", err)
+		}
+		defer f.Close()
+
+		if sheet == "" {
+			sheet = f.GetSheetName(0)
+		}
+
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sheet %q: %w", sheet, err)
+		}
+		return rows, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported file type %q, expected .csv or .xlsx", filepath.Ext(filename))
+	}
+}
+
+// ValidateImportHeader checks that every mapped column exists in the header
+// row before a job is queued, so mapping mistakes fail fast
+func ValidateImportHeader(header []string, mapping domain.ImportMapping) error {
+	if mapping.Name == "" || mapping.Timestamp == "" {
+		return fmt.Errorf("mapping must specify the name and timestamp columns")
+	}
+
+	_, err := importColumns(header, mapping)
+	return err
+}
+
+// ImportRecords loads historical attendance rows. The first row must be the
+// header. Rows are validated individually; a bad row is reported and
+// skipped without aborting the import. Re-importing the same file does not
+// create duplicates.
+func (s *AttendanceService) ImportRecords(ctx context.Context, rows [][]string, mapping domain.ImportMapping, timestampFormat string, progress func(done, total int)) (*domain.ImportResult, error) {
+	result := &domain.ImportResult{Errors: []domain.ImportRowError{}}
+	if len(rows) < 2 {
+		return result, nil
+	}
+
+	cols, err := importColumns(rows[0], mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	data := rows[1:]
+	result.Rows = len(data)
+	actor := recordActor(domain.ActorFromContext(ctx))
+
+	for start := 0; start < len(data); start += importBatchSize {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		end := start + importBatchSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		if err := s.importBatch(data[start:end], start+2, cols, timestampFormat, actor, result); err != nil {
+			return result, err
+		}
+
+		progress(end, len(data))
+	}
+
+	return result, nil
+}
+
+func (s *AttendanceService) importBatch(rows [][]string, firstRow int, cols map[string]int, timestampFormat string, actor *domain.Actor, result *domain.ImportResult) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT OR IGNORE INTO attendance (id, name, confidence, timestamp, status, device_id,
+			actor_type, actor_id, actor_name, tenant, external_id, person_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE((SELECT id FROM people WHERE name = ?), ''))
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for i, row := range rows {
+		record, err := parseImportRow(row, cols, timestampFormat, s.cfg.Timezone)
+		if err != nil {
+			result.Rejected++
+			result.Errors = append(result.Errors, domain.ImportRowError{Row: firstRow + i, Error: err.Error()})
+			continue
+		}
+
+		res, err := stmt.Exec(record.ID, record.Name, record.Confidence, record.Timestamp, record.Status, record.DeviceID,
+			actor.Type, actor.ID, actor.Name, actor.Tenant, record.ExternalID, record.Name)
+		if err != nil {
+			return fmt.Errorf("failed to insert row %d: %w", firstRow+i, err)
+		}
+
+		if n, _ := res.RowsAffected(); n == 0 {
+			result.Duplicates++
+		} else {
+			result.Imported++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit batch: %w", err)
+	}
+
+	return nil
+}
+
+func importColumns(header []string, mapping domain.ImportMapping) (map[string]int, error) {
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		index[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+
+	cols := make(map[string]int)
+	fields := map[string]string{
+		"name":        mapping.Name,
+		"timestamp":   mapping.Timestamp,
+		"status":      mapping.Status,
+		"confidence":  mapping.Confidence,
+		"device_id":   mapping.DeviceID,
+		"external_id": mapping.ExternalID,
+	}
+
+	for field, column := range fields {
+		if column == "" {
+			continue
+		}
+		i, ok := index[strings.ToLower(strings.TrimSpace(column))]
+		if !ok {
+			return nil, fmt.Errorf("column %q mapped to %s not found in header", column, field)
+		}
+		cols[field] = i
+	}
+
+	return cols, nil
+}
+
+func parseImportRow(row []string, cols map[string]int, timestampFormat string, loc *time.Location) (*domain.AttendanceRecord, error) {
+	value := func(field string) string {
+		i, ok := cols[field]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	record := &domain.AttendanceRecord{
+		Name:       value("name"),
+		Status:     "authorized",
+		DeviceID:   value("device_id"),
+		ExternalID: value("external_id"),
+	}
+
+	if record.Name == "" {
+		return nil, fmt.Errorf("name is empty")
+	}
+
+	ts, err := parseImportTimestamp(value("timestamp"), timestampFormat, loc)
+	if err != nil {
+		return nil, err
+	}
+	record.Timestamp = ts
+
+	if status := strings.ToLower(value("status")); status != "" {
+		if status != "authorized" && status != "unauthorized" {
+			return nil, fmt.Errorf("status %q must be authorized or unauthorized", status)
+		}
+		record.Status = status
+	}
+
+	if confidence := value("confidence"); confidence != "" {
+		c, err := strconv.ParseFloat(confidence, 64)
+		if err != nil || c < 0 || c > 100 {
+			return nil, fmt.Errorf("confidence %q must be a number between 0 and 100", confidence)
+		}
+		record.Confidence = c
+	}
+
+	// Deterministic IDs make re-imports idempotent
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		record.Name, record.Timestamp.UTC().Format(time.RFC3339Nano), record.Status, record.DeviceID,
+	}, "|")))
+	record.ID = "import-" + hex.EncodeToString(sum[:16])
+
+	return record, nil
+}
+
+// parseImportTimestamp reads a timestamp of an import, in loc unless it has
+// its own offset
+func parseImportTimestamp(value, format string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("timestamp is empty")
+	}
+
+	if format != "" {
+		ts, err := time.ParseInLocation(format, value, loc)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("timestamp %q does not match format %q", value, format)
+		}
+		return ts, nil
+	}
+
+	for _, layout := range importTimestampLayouts {
+		if ts, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return ts, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", value)
+}
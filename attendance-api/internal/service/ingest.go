@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+)
+
+// imageExtensions lists the file types picked up by the folder watcher
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".bmp":  true,
+	".webp": true,
+}
+
+// FolderWatcher ingests snapshots that legacy cameras drop into a directory
+// (usually the chroot of an FTP/SFTP server) as attendance submissions.
+//
+// Images placed in a subfolder are attributed to the device named after that
+// subfolder, e.g. incoming/front-door/img001.jpg is submitted as device
+// "front-door". Handled files are moved to the processed or failed folder,
+// keeping the same relative path, and their content hash is remembered so a
+// camera re-uploading the same snapshot does not create a second record.
+type FolderWatcher struct {
+	attendance *AttendanceService
+	cfg        config.IngestConfig
+
+	logger *slog.Logger
+}
+
+func NewFolderWatcher(attendance *AttendanceService, cfg config.IngestConfig) (*FolderWatcher, error) {
+	for _, dir := range []string{cfg.Dir, cfg.ProcessedDir, cfg.FailedDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+
+	return &FolderWatcher{
+		logger:     logging.Component("ingest"),
+		attendance: attendance,
+		cfg:        cfg,
+	}, nil
+}
+
+// Run polls the watched directory until the context is cancelled
+func (w *FolderWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+
+	w.logger.Info("Watching folder", "dir", w.cfg.Dir, "interval", w.cfg.PollInterval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Folder watcher stopped")
+			return
+		case <-ticker.C:
+			if err := w.scan(ctx); err != nil {
+				w.logger.Error("Scan failed", "error", err)
+			}
+		}
+	}
+}
+
+func (w *FolderWatcher) scan(ctx context.Context) error {
+	skip := map[string]bool{}
+	for _, dir := range []string{w.cfg.ProcessedDir, w.cfg.FailedDir} {
+		if abs, err := filepath.Abs(dir); err == nil {
+			skip[abs] = true
+		}
+	}
+
+	return filepath.WalkDir(w.cfg.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if d.IsDir() {
+			if abs, err := filepath.Abs(path); err == nil && skip[abs] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !imageExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		// Uploads may still be in progress; wait until the file stops changing
+		if time.Since(info.ModTime()) < w.cfg.SettleTime {
+			return nil
+		}
+
+		rel, err := filepath.Rel(w.cfg.Dir, path)
+		if err != nil {
+			return nil
+		}
+
+		w.process(ctx, path, rel)
+		return nil
+	})
+}
+
+func (w *FolderWatcher) process(ctx context.Context, path, rel string) {
+	deviceID := ""
+	if dir := filepath.Dir(rel); dir != "." {
+		deviceID = strings.SplitN(filepath.ToSlash(dir), "/", 2)[0]
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		w.logger.Error("Failed to read file", "file", rel, "error", err)
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	seen, err := w.alreadyProcessed(hash)
+	if err != nil {
+		w.logger.Error("Failed to check file", "file", rel, "error", err)
+		return
+	}
+	if seen {
+		w.logger.Info("Skipping duplicate", "file", rel)
+		w.move(path, rel, w.cfg.ProcessedDir)
+		return
+	}
+
+	ctx = domain.WithActor(ctx, domain.Actor{Type: domain.ActorSystem, ID: "ingest", Device: deviceID})
+	response, err := w.attendance.RecordAttendance(ctx, domain.AttendanceSubmission{
+		ImageData: data,
+		Filename:  filepath.Base(path),
+		DeviceID:  deviceID,
+	})
+
+	status := "processed"
+	errMsg := ""
+	if err != nil {
+		status = "failed"
+		errMsg = err.Error()
+	} else if response != nil && !response.Success {
+		status = "failed"
+		errMsg = response.Message
+	}
+
+	if err := w.remember(hash, rel, deviceID, status, errMsg); err != nil {
+		w.logger.Error("Failed to record file", "file", rel, "error", err)
+	}
+
+	if status == "failed" {
+		w.logger.Error("File failed", "file", rel, "error", errMsg)
+		w.move(path, rel, w.cfg.FailedDir)
+		return
+	}
+
+	w.logger.Info("File processed", "file", rel, "device", deviceID)
+	w.move(path, rel, w.cfg.ProcessedDir)
+}
+
+func (w *FolderWatcher) alreadyProcessed(hash string) (bool, error) {
+	var status string
+	err := w.attendance.db.QueryRow("SELECT status FROM ingested_files WHERE hash = ?", hash).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to query ingested file: %w", err)
+	}
+
+	// Failed files may be dropped again once the problem is fixed
+	return status == "processed", nil
+}
+
+func (w *FolderWatcher) remember(hash, filename, deviceID, status, errMsg string) error {
+	query := `
+		INSERT OR REPLACE INTO ingested_files (hash, filename, device_id, status, error, processed_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := w.attendance.db.Exec(query, hash, filename, deviceID, status, errMsg, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to insert ingested file: %w", err)
+	}
+
+	return nil
+}
+
+// move relocates a handled file below target, keeping its relative path and
+// never overwriting an earlier file with the same name
+func (w *FolderWatcher) move(path, rel, target string) {
+	dest := filepath.Join(target, rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		w.logger.Error("Failed to create folder", "dir", filepath.Dir(dest), "error", err)
+		return
+	}
+
+	if _, err := os.Stat(dest); err == nil {
+		ext := filepath.Ext(dest)
+		dest = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(dest, ext), time.Now().UnixNano(), ext)
+	}
+
+	if err := os.Rename(path, dest); err == nil {
+		return
+	}
+
+	// Rename fails across filesystems (e.g. separate Docker volumes)
+	if err := copyFile(path, dest); err != nil {
+		w.logger.Error("Failed to move file", "file", rel, "error", err)
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		w.logger.Warn("Failed to remove file after copy", "file", rel, "error", err)
+	}
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
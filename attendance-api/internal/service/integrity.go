@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+)
+
+// expectedTables lists every table created by the services at startup
+var expectedTables = []string{
+	"attendance", "ingested_files", "attendance_sessions", "person_locations",
+	"shifts", "people", "holidays", "api_keys", "jobs", "replication_state",
+	"unknown_events", "identity_changes", "experiment_outcomes", "audit_log",
+	"record_snapshots", "users", "refresh_tokens", "webauthn_credentials",
+	"device_clocks", "attendance_changes", "doors", "door_grants", "door_schedules",
+	"devices", "device_settings", "device_commands", "emergency",
+}
+
+// IntegrityChecker looks for inconsistencies between the database, the
+// ingest folders and the schema this version expects. Each check reports
+// its findings; with repair enabled, findings that can be fixed without
+// losing data are fixed in place.
+type IntegrityChecker struct {
+	db     *sql.DB
+	ingest config.IngestConfig
+}
+
+func NewIntegrityChecker(db *sql.DB, ingest config.IngestConfig) *IntegrityChecker {
+	return &IntegrityChecker{db: db, ingest: ingest}
+}
+
+// integrityCheck returns the findings of one check, or a reason when the
+// check does not apply to this installation
+type integrityCheck func(ctx context.Context, repair bool) (findings []domain.IntegrityFinding, skipped string, err error)
+
+// Run performs every check and collects the results
+func (c *IntegrityChecker) Run(ctx context.Context, repair bool) (*domain.IntegrityReport, error) {
+	report := &domain.IntegrityReport{
+		StartedAt: time.Now(),
+		Repair:    repair,
+		Checks:    []domain.IntegrityCheck{},
+		Findings:  []domain.IntegrityFinding{},
+	}
+
+	checks := []struct {
+		name string
+		run  integrityCheck
+	}{
+		{"schema", c.checkSchema},
+		{"snapshots", c.checkSnapshots},
+		{"devices", c.checkDevices},
+		{"hash_chain", c.checkHashChain},
+	}
+
+	for _, check := range checks {
+		findings, skipped, err := check.run(ctx, repair)
+		if err != nil {
+			return nil, fmt.Errorf("%s check failed: %w", check.name, err)
+		}
+
+		result := domain.IntegrityCheck{Name: check.name, Status: "ok", Findings: len(findings)}
+		switch {
+		case skipped != "":
+			result.Status = "skipped"
+			result.Detail = skipped
+		case len(findings) > 0:
+			result.Status = "problems"
+		}
+
+		report.Checks = append(report.Checks, result)
+		for _, finding := range findings {
+			finding.Check = check.name
+			if finding.Repaired {
+				report.Repaired++
+			}
+			report.Findings = append(report.Findings, finding)
+		}
+	}
+
+	report.Duration = time.Since(report.StartedAt).Round(time.Millisecond).String()
+	return report, nil
+}
+
+// checkSchema runs SQLite's own consistency check and compares the tables
+// and attendance columns against the ones this version creates. Missing
+// attendance columns are added on repair.
+func (c *IntegrityChecker) checkSchema(ctx context.Context, repair bool) ([]domain.IntegrityFinding, string, error) {
+	findings := []domain.IntegrityFinding{}
+
+	rows, err := c.db.QueryContext(ctx, "PRAGMA quick_check")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to run quick_check: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return nil, "", fmt.Errorf("failed to scan quick_check: %w", err)
+		}
+		if result != "ok" {
+			findings = append(findings, domain.IntegrityFinding{
+				Severity: "error",
+				Message:  "database corruption: " + result,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("row iteration error: %w", err)
+	}
+	rows.Close()
+
+	for _, table := range expectedTables {
+		var name string
+		err := c.db.QueryRowContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&name)
+		if errors.Is(err, sql.ErrNoRows) {
+			findings = append(findings, domain.IntegrityFinding{
+				Severity: "error",
+				Message:  fmt.Sprintf("table %s is missing; restart the service to recreate it", table),
+			})
+			continue
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to look up table %s: %w", table, err)
+		}
+	}
+
+	columns, err := tableColumns(c.db, "attendance")
+	if err != nil {
+		return nil, "", err
+	}
+	if len(columns) == 0 {
+		// Reported above as a missing table
+		return findings, "", nil
+	}
+
+	for _, column := range attendanceColumns {
+		if slices.Contains(columns, column.name) {
+			continue
+		}
+
+		finding := domain.IntegrityFinding{
+			Severity:   "error",
+			Message:    fmt.Sprintf("column attendance.%s is missing", column.name),
+			Repairable: true,
+		}
+		if repair {
+			if err := ensureColumn(c.db, "attendance", column.name, column.definition); err != nil {
+				finding.Message += ": " + err.Error()
+			} else {
+				finding.Repaired = true
+			}
+		}
+		findings = append(findings, finding)
+	}
+
+	return findings, "", nil
+}
+
+// checkSnapshots looks for images in the processed and failed ingest
+// folders that the folder watcher has no record of, e.g. files copied there
+// by hand or left behind by a restored backup. They are only reported, since
+// whether they were ever recognized is unknown.
+func (c *IntegrityChecker) checkSnapshots(ctx context.Context, repair bool) ([]domain.IntegrityFinding, string, error) {
+	if !c.ingest.Enabled {
+		return nil, "folder ingestion is disabled", nil
+	}
+
+	findings := []domain.IntegrityFinding{}
+	for _, dir := range []string{c.ingest.ProcessedDir, c.ingest.FailedDir} {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if d.IsDir() || !imageExtensions[strings.ToLower(filepath.Ext(path))] {
+				return nil
+			}
+
+			hash, err := hashFile(path)
+			if err != nil {
+				return err
+			}
+
+			var status string
+			err = c.db.QueryRowContext(ctx, "SELECT status FROM ingested_files WHERE hash = ?", hash).Scan(&status)
+			if errors.Is(err, sql.ErrNoRows) {
+				findings = append(findings, domain.IntegrityFinding{
+					Severity: "warning",
+					Message:  fmt.Sprintf("orphaned snapshot %s has no ingestion record", path),
+				})
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to scan %s: %w", dir, err)
+		}
+	}
+
+	return findings, "", nil
+}
+
+// checkDevices is meant to find records from devices that are not
+// registered. Devices are not registered yet, any device ID is accepted.
+func (c *IntegrityChecker) checkDevices(ctx context.Context, repair bool) ([]domain.IntegrityFinding, string, error) {
+	return nil, "no device registry", nil
+}
+
+// checkHashChain is meant to verify the links of hash-chained tables. No
+// table is hash-chained yet.
+func (c *IntegrityChecker) checkHashChain(ctx context.Context, repair bool) ([]domain.IntegrityFinding, string, error) {
+	return nil, "no hash-chained tables", nil
+}
+
+// querier is a database or a transaction
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// tableColumns returns the column names of a table in order, or none when
+// the table does not exist
+func tableColumns(db querier, table string) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns := []string{}
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return nil, fmt.Errorf("failed to scan column info: %w", err)
+		}
+		columns = append(columns, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return columns, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrJobNotFound  = errors.New("job not found")
+	ErrJobQueueFull = errors.New("job queue is full")
+)
+
+// JobFunc does the work of a job. It reports progress through the callback
+// and returns a JSON-serializable result.
+type JobFunc func(ctx context.Context, progress func(done, total int)) (interface{}, error)
+
+type queuedJob struct {
+	id  string
+	run JobFunc
+}
+
+// JobManager runs background jobs on a bounded worker pool and keeps their
+// status in SQLite so it can be polled through the API
+type JobManager struct {
+	db        *sql.DB
+	queue     chan queuedJob
+	retention atomic.Int64 // nanoseconds, zero keeps finished jobs forever
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+
+	// onFinish is told about every job that ran, once it completed or failed
+	onFinish func(domain.Job)
+
+	logger *slog.Logger
+}
+
+func NewJobManager(db *sql.DB, cfg config.JobsConfig) (*JobManager, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	m := &JobManager{
+		logger: logging.Component("jobs"),
+		db:     db,
+		queue:  make(chan queuedJob, cfg.QueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	m.retention.Store(int64(cfg.Retention))
+
+	if err := m.initSchema(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	// Jobs live in memory only; anything unfinished was lost with the
+	// previous process
+	_, err := db.Exec(`
+		UPDATE jobs SET status = ?, error = 'interrupted by server restart', finished_at = ?
+		WHERE status IN (?, ?)
+	`, domain.JobFailed, time.Now(), domain.JobQueued, domain.JobRunning)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to fail interrupted jobs: %w", err)
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+	m.wg.Add(1)
+	go m.pruneLoop()
+
+	return m, nil
+}
+
+// Reconfigure applies a changed retention from the next hourly prune
+func (m *JobManager) Reconfigure(cfg config.JobsConfig) {
+	if old := time.Duration(m.retention.Swap(int64(cfg.Retention))); old != cfg.Retention {
+		m.logger.Info("Retention changed", "retention", cfg.Retention, "was", old)
+	}
+}
+
+func (m *JobManager) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		type TEXT NOT NULL,
+		status TEXT NOT NULL,
+		done INTEGER NOT NULL DEFAULT 0,
+		total INTEGER NOT NULL DEFAULT 0,
+		result TEXT,
+		error TEXT,
+		created_at DATETIME NOT NULL,
+		started_at DATETIME,
+		finished_at DATETIME,
+		owner TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_jobs_created_at ON jobs(created_at DESC);
+	CREATE INDEX IF NOT EXISTS idx_jobs_finished_at ON jobs(finished_at);
+	`
+
+	if _, err := m.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+
+	// Jobs of earlier versions have no owner
+	return ensureColumn(m.db, "jobs", "owner", "TEXT NOT NULL DEFAULT ''")
+}
+
+// OnFinish sets a function told about every job that ran, with its result,
+// once it completed or failed. It must be set before jobs are submitted.
+func (m *JobManager) OnFinish(fn func(domain.Job)) {
+	m.onFinish = fn
+}
+
+// Close stops accepting work and waits for running jobs to notice
+func (m *JobManager) Close() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// Submit queues a job on behalf of owner, the actor submitting it, and
+// returns immediately
+func (m *JobManager) Submit(jobType, owner string, run JobFunc) (*domain.Job, error) {
+	job := &domain.Job{
+		ID:        uuid.New().String(),
+		Type:      jobType,
+		Status:    domain.JobQueued,
+		CreatedAt: time.Now(),
+		Owner:     owner,
+	}
+
+	_, err := m.db.Exec("INSERT INTO jobs (id, type, status, created_at, owner) VALUES (?, ?, ?, ?, ?)",
+		job.ID, job.Type, job.Status, job.CreatedAt, job.Owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert job: %w", err)
+	}
+
+	select {
+	case m.queue <- queuedJob{id: job.ID, run: run}:
+		return job, nil
+	default:
+		m.finish(job.ID, nil, ErrJobQueueFull)
+		return nil, ErrJobQueueFull
+	}
+}
+
+func (m *JobManager) Get(id string) (*domain.Job, error) {
+	row := m.db.QueryRow(`
+		SELECT id, type, status, done, total, result, error, created_at, started_at, finished_at, owner
+		FROM jobs
+		WHERE id = ?
+	`, id)
+
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	return job, err
+}
+
+// List returns the most recent jobs, without their results, leaving out
+// jobs of the hidden types
+func (m *JobManager) List(limit int, hidden ...string) ([]domain.Job, error) {
+	query := `
+		SELECT id, type, status, done, total, NULL, error, created_at, started_at, finished_at, owner
+		FROM jobs
+	`
+	args := []interface{}{}
+	if len(hidden) > 0 {
+		query += " WHERE type NOT IN (?" + strings.Repeat(", ?", len(hidden)-1) + ")"
+		for _, jobType := range hidden {
+			args = append(args, jobType)
+		}
+	}
+	query += " ORDER BY created_at DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := m.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []domain.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return jobs, nil
+}
+
+func (m *JobManager) worker() {
+	defer m.wg.Done()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case job := <-m.queue:
+			m.execute(job)
+		}
+	}
+}
+
+func (m *JobManager) execute(job queuedJob) {
+	if _, err := m.db.Exec("UPDATE jobs SET status = ?, started_at = ? WHERE id = ?",
+		domain.JobRunning, time.Now(), job.id); err != nil {
+		m.logger.Error("Failed to start job", "job", job.id, "error", err)
+	}
+
+	progress := func(done, total int) {
+		if _, err := m.db.Exec("UPDATE jobs SET done = ?, total = ? WHERE id = ?", done, total, job.id); err != nil {
+			m.logger.Warn("Failed to update job progress", "job", job.id, "error", err)
+		}
+	}
+
+	result, err := func() (result interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("job panicked: %v", r)
+			}
+		}()
+		return job.run(m.ctx, progress)
+	}()
+
+	m.finish(job.id, result, err)
+
+	if m.onFinish != nil {
+		finished, err := m.Get(job.id)
+		if err != nil {
+			m.logger.Error("Failed to read finished job", "job", job.id, "error", err)
+			return
+		}
+		m.onFinish(*finished)
+	}
+}
+
+func (m *JobManager) finish(id string, result interface{}, jobErr error) {
+	status := domain.JobCompleted
+	errMsg := ""
+	if jobErr != nil {
+		status = domain.JobFailed
+		errMsg = jobErr.Error()
+		m.logger.Error("Job failed", "job", id, "error", jobErr)
+	}
+
+	var resultJSON []byte
+	if result != nil {
+		var err error
+		if resultJSON, err = json.Marshal(result); err != nil {
+			m.logger.Error("Failed to encode job result", "job", id, "error", err)
+		}
+	}
+
+	_, err := m.db.Exec("UPDATE jobs SET status = ?, result = ?, error = ?, finished_at = ? WHERE id = ?",
+		status, nullString(string(resultJSON)), nullString(errMsg), time.Now(), id)
+	if err != nil {
+		m.logger.Error("Failed to finish job", "job", id, "error", err)
+	}
+}
+
+// pruneLoop removes the jobs finished longer than the retention ago, hourly
+func (m *JobManager) pruneLoop() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if m.retention.Load() > 0 {
+			m.prune()
+		}
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *JobManager) prune() {
+	retention := time.Duration(m.retention.Load())
+	result, err := m.db.Exec("DELETE FROM jobs WHERE finished_at < ?", time.Now().Add(-retention))
+	if err != nil {
+		m.logger.Error("Failed to prune jobs", "error", err)
+	} else if n, _ := result.RowsAffected(); n > 0 {
+		m.logger.Info("Pruned jobs", "jobs", n, "retention", retention)
+	}
+}
+
+func scanJob(row rowScanner) (*domain.Job, error) {
+	var (
+		job                   domain.Job
+		result, errMsg        sql.NullString
+		startedAt, finishedAt sql.NullTime
+	)
+
+	err := row.Scan(&job.ID, &job.Type, &job.Status, &job.Done, &job.Total, &result, &errMsg,
+		&job.CreatedAt, &startedAt, &finishedAt, &job.Owner)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan job: %w", err)
+	}
+
+	if result.Valid {
+		job.Result = json.RawMessage(result.String)
+	}
+	job.Error = errMsg.String
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+
+	return &job, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
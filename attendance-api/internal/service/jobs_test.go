@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"attendance-api/internal/config"
+)
+
+// Jobs finished longer than the retention ago are pruned, jobs still
+// running and recently finished ones are kept
+func TestJobRetention(t *testing.T) {
+	db := newTestDB(t)
+	m, err := NewJobManager(db, config.JobsConfig{Workers: 1, QueueSize: 3, Retention: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+
+	noop := func(ctx context.Context, progress func(done, total int)) (interface{}, error) { return nil, nil }
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	running, err := m.Submit("attendance_import", "", func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := m.Submit("recognition", "", noop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recent, err := m.Submit("recognition", "", noop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The queue holds the finished jobs until the running one is done, so
+	// finish them by hand
+	m.finish(old.ID, nil, nil)
+	m.finish(recent.ID, nil, nil)
+	if _, err := db.Exec("UPDATE jobs SET finished_at = ? WHERE id = ?", time.Now().Add(-2*time.Hour), old.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	m.prune()
+
+	if _, err := m.Get(old.ID); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("job finished 2h ago: %v, want %v", err, ErrJobNotFound)
+	}
+	for _, job := range []string{running.ID, recent.ID} {
+		if _, err := m.Get(job); err != nil {
+			t.Errorf("job %s: %v, want it kept", job, err)
+		}
+	}
+}
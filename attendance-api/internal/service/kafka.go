@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// kafkaPublisher produces to Kafka through kafka-go, one record per request,
+// acknowledged by all in-sync replicas. Partitions are chosen by the key's
+// murmur2 hash like the Java client's default partitioner, so other
+// producers keyed the same way land on the same partitions. It is not safe
+// for concurrent use.
+type kafkaPublisher struct {
+	brokers   []string
+	transport *kafka.Transport
+	timeout   time.Duration
+
+	writer *kafka.Writer // created on first use and again after Close
+}
+
+// newKafkaPublisher produces to kafka://[user:pass@]host:9092[,host:9092].
+// The sasl query parameter picks the mechanism for the credentials, plain
+// (the default), scram-sha-256 or scram-sha-512, and tls=true connects over
+// TLS.
+func newKafkaPublisher(target *url.URL, timeout time.Duration) (*kafkaPublisher, error) {
+	brokers := strings.Split(target.Host, ",")
+	for i, broker := range brokers {
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			brokers[i] = net.JoinHostPort(broker, "9092")
+		}
+	}
+
+	transport := &kafka.Transport{ClientID: "attendance-api", DialTimeout: timeout}
+	query := target.Query()
+	if v := query.Get("tls"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Kafka tls option %q", v)
+		}
+		if enabled {
+			transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+	}
+
+	mechanism := query.Get("sasl")
+	if target.User != nil {
+		user := target.User.Username()
+		pass, _ := target.User.Password()
+
+		var err error
+		if transport.SASL, err = kafkaSASL(mechanism, user, pass); err != nil {
+			return nil, err
+		}
+	} else if mechanism != "" {
+		return nil, fmt.Errorf("Kafka SASL %s needs credentials in the URL", mechanism)
+	}
+
+	return &kafkaPublisher{brokers: brokers, transport: transport, timeout: timeout}, nil
+}
+
+func kafkaSASL(mechanism, user, pass string) (sasl.Mechanism, error) {
+	switch strings.ToLower(mechanism) {
+	case "", "plain":
+		return plain.Mechanism{Username: user, Password: pass}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, user, pass)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, user, pass)
+	default:
+		return nil, fmt.Errorf("unsupported Kafka SASL mechanism %q, expected plain, scram-sha-256 or scram-sha-512", mechanism)
+	}
+}
+
+func (p *kafkaPublisher) Publish(topic, key string, headers map[string]string, value []byte) error {
+	if p.writer == nil {
+		p.writer = &kafka.Writer{
+			Addr:                   kafka.TCP(p.brokers...),
+			Balancer:               &kafka.Murmur2Balancer{},
+			RequiredAcks:           kafka.RequireAll,
+			BatchSize:              1,
+			WriteTimeout:           p.timeout,
+			ReadTimeout:            p.timeout,
+			MaxAttempts:            1, // the event bus retries on its own
+			AllowAutoTopicCreation: true,
+			Transport:              p.transport,
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msg := kafka.Message{Topic: topic, Key: []byte(key), Value: value}
+	for _, name := range names {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: name, Value: []byte(headers[name])})
+	}
+
+	// Brokers wait up to the timeout for the replicas, so allow for it
+	ctx, cancel := context.WithTimeout(context.Background(), 2*p.timeout)
+	defer cancel()
+	return p.writer.WriteMessages(ctx, msg)
+}
+
+func (p *kafkaPublisher) Close() error {
+	if p.writer == nil {
+		return nil
+	}
+	err := p.writer.Close()
+	p.writer = nil
+	p.transport.CloseIdleConnections()
+	return err
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"attendance-api/internal/domain"
+)
+
+func (s *AttendanceService) initLocationSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS person_locations (
+		name TEXT NOT NULL,
+		location TEXT NOT NULL,
+		PRIMARY KEY (name, location)
+	);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute location schema: %w", err)
+	}
+
+	return nil
+}
+
+// isMisplaced reports whether a person with location assignments was seen
+// somewhere else. People without assignments, and submissions that do not
+// say where they come from, are never misplaced.
+func (s *AttendanceService) isMisplaced(name, location string) (bool, error) {
+	if location == "" {
+		return false, nil
+	}
+
+	var assigned, matches int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(location = ?), 0)
+		FROM person_locations
+		WHERE name = ?
+	`, location, name).Scan(&assigned, &matches)
+	if err != nil {
+		return false, fmt.Errorf("failed to query location assignments: %w", err)
+	}
+
+	return assigned > 0 && matches == 0, nil
+}
+
+// ListLocationAssignments returns every person with assigned locations
+func (s *AttendanceService) ListLocationAssignments() ([]domain.LocationAssignment, error) {
+	rows, err := s.db.Query("SELECT name, location FROM person_locations ORDER BY name, location")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query location assignments: %w", err)
+	}
+	defer rows.Close()
+
+	assignments := []domain.LocationAssignment{}
+	for rows.Next() {
+		var name, location string
+		if err := rows.Scan(&name, &location); err != nil {
+			return nil, fmt.Errorf("failed to scan location assignment: %w", err)
+		}
+
+		if n := len(assignments); n > 0 && assignments[n-1].Name == name {
+			assignments[n-1].Locations = append(assignments[n-1].Locations, location)
+		} else {
+			assignments = append(assignments, domain.LocationAssignment{Name: name, Locations: []string{location}})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return assignments, nil
+}
+
+// GetLocationAssignment returns the locations assigned to a person
+func (s *AttendanceService) GetLocationAssignment(name string) (*domain.LocationAssignment, error) {
+	rows, err := s.db.Query("SELECT location FROM person_locations WHERE name = ? ORDER BY location", name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query location assignments: %w", err)
+	}
+	defer rows.Close()
+
+	assignment := &domain.LocationAssignment{Name: name, Locations: []string{}}
+	for rows.Next() {
+		var location string
+		if err := rows.Scan(&location); err != nil {
+			return nil, fmt.Errorf("failed to scan location assignment: %w", err)
+		}
+		assignment.Locations = append(assignment.Locations, location)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return assignment, nil
+}
+
+// SetLocationAssignment replaces the locations assigned to a person. An
+// empty list removes the assignment, allowing the person everywhere.
+func (s *AttendanceService) SetLocationAssignment(name string, locations []string) (*domain.LocationAssignment, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM person_locations WHERE name = ?", name); err != nil {
+		return nil, fmt.Errorf("failed to clear location assignments: %w", err)
+	}
+
+	for _, location := range locations {
+		location = strings.TrimSpace(location)
+		if location == "" {
+			continue
+		}
+		if _, err := tx.Exec("INSERT OR IGNORE INTO person_locations (name, location) VALUES (?, ?)", name, location); err != nil {
+			return nil, fmt.Errorf("failed to insert location assignment: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit location assignments: %w", err)
+	}
+
+	return s.GetLocationAssignment(name)
+}
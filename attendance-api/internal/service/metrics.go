@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"attendance-api/internal/client"
+	"attendance-api/internal/domain"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// confidenceBounds are the upper bounds of the match confidence histogram
+// buckets, finer where thresholds are usually set
+var confidenceBounds = []float64{10, 20, 30, 40, 50, 55, 60, 65, 70, 75, 80, 85, 90, 95, 100}
+
+// histogram counts observations in the buckets of bounds
+type histogram struct {
+	bounds  []float64
+	buckets []int64
+	count   int64
+	sum     float64
+	largest float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, buckets: make([]int64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	h.buckets[bucket(h.bounds, v)]++
+	h.count++
+	h.sum += v
+	h.largest = max(h.largest, v)
+}
+
+func (h *histogram) snapshot() domain.Histogram {
+	return domain.Histogram{
+		Bounds: h.bounds,
+		Counts: append([]int64(nil), h.buckets...),
+		Count:  h.count,
+		Sum:    round1(h.sum),
+		P50:    percentile(h.buckets, h.bounds, 0.50, h.largest),
+		P95:    percentile(h.buckets, h.bounds, 0.95, h.largest),
+		P99:    percentile(h.buckets, h.bounds, 0.99, h.largest),
+	}
+}
+
+// recognitionMetrics counts what becomes of submissions sent to the face
+// service. It is kept in memory and starts over with the process, as
+// scrapers expect of counters.
+type recognitionMetrics struct {
+	mu         sync.Mutex
+	counts     domain.RecognitionMetrics // without the histograms
+	latency    *histogram                // milliseconds
+	confidence *histogram
+}
+
+func newRecognitionMetrics(minConfidence float64) *recognitionMetrics {
+	return &recognitionMetrics{
+		counts:     domain.RecognitionMetrics{Since: time.Now(), MinConfidence: minConfidence},
+		latency:    newHistogram(latencyBounds),
+		confidence: newHistogram(confidenceBounds),
+	}
+}
+
+// observeCall counts a call to the face service and why it failed
+func (m *recognitionMetrics) observeCall(took time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.counts.Calls++
+	m.latency.observe(float64(took.Microseconds()) / 1000)
+	switch {
+	case err == nil:
+	case errors.Is(err, client.ErrFaceServiceBusy):
+		m.counts.Busy++
+	case isTimeout(err):
+		m.counts.Timeouts++
+	default:
+		m.counts.Errors++
+	}
+}
+
+// observeResult counts the faces the face service found, before weak
+// matches are turned into unknown faces
+func (m *recognitionMetrics) observeResult(result *domain.RecognitionResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if result.FacesDetected == 0 || len(result.Faces) == 0 {
+		m.counts.NoFace++
+		return
+	}
+	for _, face := range result.Faces {
+		switch {
+		case face.Name == "Unknown":
+			m.counts.Unknown++
+			continue
+		case face.Confidence < m.counts.MinConfidence:
+			m.counts.LowConfidence++
+		default:
+			m.counts.Matched++
+		}
+		m.confidence.observe(face.Confidence)
+	}
+}
+
+// setMinConfidence moves the line between matched and low confidence faces
+// for the results still to come
+func (m *recognitionMetrics) setMinConfidence(minConfidence float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.counts.MinConfidence = minConfidence
+}
+
+func (m *recognitionMetrics) snapshot() domain.RecognitionMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	metrics := m.counts
+	metrics.FaceAPILatency = m.latency.snapshot()
+	metrics.Confidence = m.confidence.snapshot()
+	return metrics
+}
+
+// isTimeout reports whether a call to the face service ran out of time,
+// over HTTP or gRPC
+func isTimeout(err error) bool {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return true
+	}
+	return status.Code(errors.Unwrap(err)) == codes.DeadlineExceeded
+}
+
+// RecognitionMetrics reports face service latency, match confidence and
+// why recognitions failed or were rejected, since the API started
+func (s *AttendanceService) RecognitionMetrics() domain.RecognitionMetrics {
+	return s.metrics.snapshot()
+}
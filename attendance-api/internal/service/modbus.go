@@ -0,0 +1,129 @@
+package service
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Modbus function codes used by the building bridge
+const (
+	modbusWriteCoil     = 0x05
+	modbusWriteRegister = 0x06
+)
+
+var modbusExceptions = map[byte]string{
+	0x01: "illegal function",
+	0x02: "illegal data address",
+	0x03: "illegal data value",
+	0x04: "server device failure",
+	0x06: "server device busy",
+	0x0A: "gateway path unavailable",
+	0x0B: "gateway target device failed to respond",
+}
+
+// modbusClient writes coils and holding registers of a Modbus TCP device. The
+// connection is dialed on first use and again after a failed request. It is
+// not safe for concurrent use.
+type modbusClient struct {
+	addr    string
+	unit    byte
+	timeout time.Duration
+
+	conn net.Conn
+	txID uint16
+}
+
+func newModbusClient(addr string, unit int, timeout time.Duration) (*modbusClient, error) {
+	if unit < 0 || unit > 255 {
+		return nil, fmt.Errorf("invalid Modbus unit identifier %d, expected 0-255", unit)
+	}
+	return &modbusClient{addr: addr, unit: byte(unit), timeout: timeout}, nil
+}
+
+func (c *modbusClient) writeCoil(address uint16, on bool) error {
+	value := uint16(0x0000)
+	if on {
+		value = 0xFF00
+	}
+	return c.request(modbusWriteCoil, address, value)
+}
+
+func (c *modbusClient) writeRegister(address, value uint16) error {
+	return c.request(modbusWriteRegister, address, value)
+}
+
+// request sends a single write and checks the device's echo of it
+func (c *modbusClient) request(function byte, address, value uint16) error {
+	if c.conn == nil {
+		conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+		if err != nil {
+			return err
+		}
+		c.conn = conn
+	}
+
+	err := c.exchange(function, address, value)
+	if err != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	return err
+}
+
+func (c *modbusClient) exchange(function byte, address, value uint16) error {
+	c.txID++
+
+	// MBAP header (transaction, protocol, length, unit) and the PDU
+	frame := make([]byte, 12)
+	binary.BigEndian.PutUint16(frame[0:], c.txID)
+	binary.BigEndian.PutUint16(frame[4:], 6)
+	frame[6] = c.unit
+	frame[7] = function
+	binary.BigEndian.PutUint16(frame[8:], address)
+	binary.BigEndian.PutUint16(frame[10:], value)
+
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := c.conn.Write(frame); err != nil {
+		return err
+	}
+
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint16(header[4:])
+	if length < 2 || length > 254 {
+		return fmt.Errorf("invalid Modbus response length %d", length)
+	}
+	pdu := make([]byte, length-1)
+	if _, err := io.ReadFull(c.conn, pdu); err != nil {
+		return err
+	}
+
+	if binary.BigEndian.Uint16(header[0:]) != c.txID {
+		return fmt.Errorf("Modbus response to another request")
+	}
+	if pdu[0] == function|0x80 {
+		reason, ok := modbusExceptions[pdu[1]]
+		if !ok {
+			reason = fmt.Sprintf("code %d", pdu[1])
+		}
+		return fmt.Errorf("Modbus exception: %s", reason)
+	}
+	if pdu[0] != function {
+		return fmt.Errorf("unexpected Modbus function %d in response", pdu[0])
+	}
+	return nil
+}
+
+func (c *modbusClient) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
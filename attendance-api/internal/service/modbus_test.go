@@ -0,0 +1,136 @@
+package service
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeModbusDevice accepts Modbus TCP connections and answers each request
+// frame with respond, handing the frames to the test
+func fakeModbusDevice(t *testing.T, respond func(frame []byte) []byte) (string, <-chan []byte) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	frames := make(chan []byte, 16)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					frame := make([]byte, 12)
+					if _, err := io.ReadFull(conn, frame); err != nil {
+						return
+					}
+					frames <- frame
+					if _, err := conn.Write(respond(frame)); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), frames
+}
+
+// Writes go out as single MBAP frames; the echo completes them and an
+// exception response fails them with its reason
+func TestModbusFrames(t *testing.T) {
+	addr, frames := fakeModbusDevice(t, func(frame []byte) []byte {
+		switch frame[7] {
+		case modbusWriteRegister:
+			// Exception responses set the top bit of the function code
+			reply := append([]byte{}, frame[:9]...)
+			reply[5] = 3
+			reply[7] |= 0x80
+			reply[8] = frame[11] // the register value picks the exception
+			return reply
+		default:
+			return frame
+		}
+	})
+
+	client, err := newModbusClient(addr, 17, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := client.writeCoil(0x0010, true); err != nil {
+		t.Fatalf("coil write: %v", err)
+	}
+	want := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 17, 0x05, 0x00, 0x10, 0xFF, 0x00}
+	if got := <-frames; !bytes.Equal(got, want) {
+		t.Errorf("coil write frame % X, want % X", got, want)
+	}
+
+	if err := client.writeCoil(0x0011, false); err != nil {
+		t.Fatalf("coil write: %v", err)
+	}
+	want = []byte{0x00, 0x02, 0x00, 0x00, 0x00, 0x06, 17, 0x05, 0x00, 0x11, 0x00, 0x00}
+	if got := <-frames; !bytes.Equal(got, want) {
+		t.Errorf("coil release frame % X, want % X", got, want)
+	}
+
+	err = client.writeRegister(0x0020, 0x0002)
+	want = []byte{0x00, 0x03, 0x00, 0x00, 0x00, 0x06, 17, 0x06, 0x00, 0x20, 0x00, 0x02}
+	if got := <-frames; !bytes.Equal(got, want) {
+		t.Errorf("register write frame % X, want % X", got, want)
+	}
+	if err == nil || err.Error() != "Modbus exception: illegal data address" {
+		t.Errorf("exception response: %v", err)
+	}
+
+	// A failed request drops the connection; the next one dials again
+	if err := client.writeRegister(0x0020, 0x0019); err == nil || err.Error() != "Modbus exception: code 25" {
+		t.Errorf("unknown exception code: %v", err)
+	}
+	<-frames
+}
+
+// Replies to another transaction or of another function are not taken as
+// the echo of the write
+func TestModbusUnexpectedResponse(t *testing.T) {
+	cases := map[string]func(frame []byte) []byte{
+		"another transaction": func(frame []byte) []byte {
+			reply := append([]byte{}, frame...)
+			reply[1]++
+			return reply
+		},
+		"another function": func(frame []byte) []byte {
+			reply := append([]byte{}, frame...)
+			reply[7] = modbusWriteRegister
+			return reply
+		},
+		"invalid length": func(frame []byte) []byte {
+			reply := append([]byte{}, frame...)
+			reply[5] = 1
+			return reply
+		},
+	}
+	for name, respond := range cases {
+		addr, _ := fakeModbusDevice(t, respond)
+		client, err := newModbusClient(addr, 1, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := client.writeCoil(1, true); err == nil {
+			t.Errorf("%s: write succeeded", name)
+		}
+		if client.conn != nil {
+			t.Errorf("%s: connection kept after a failed request", name)
+		}
+		client.Close()
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NormalizeName turns a person's name into the form the face service keeps
+// it under: lower case, with runs of spaces and underscores joined into a
+// single underscore, so "John  Smith" and "john_smith" are one person.
+// Characters other than letters, digits, '-' and '.' are dropped.
+func NormalizeName(name string) string {
+	var b strings.Builder
+	separator := false
+
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case unicode.IsSpace(r) || r == '_':
+			separator = true
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.':
+			if separator && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			separator = false
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// similarNames returns the names that are probably the same person as name:
+// equal once separators are ignored ("johnsmith", "john-smith"), or a typo
+// away ("jon_smith"). Longer names tolerate more edits.
+func similarNames(name string, names []string) []string {
+	key := compactName(name)
+
+	maxEdits := 0
+	switch n := len([]rune(key)); {
+	case n > 8:
+		maxEdits = 2
+	case n > 4:
+		maxEdits = 1
+	}
+
+	similar := []string{}
+	for _, other := range names {
+		if other == name {
+			continue
+		}
+		otherKey := compactName(other)
+		if otherKey == key || editDistance(key, otherKey) <= maxEdits {
+			similar = append(similar, other)
+		}
+	}
+
+	return similar
+}
+
+// compactName keeps only the letters and digits of a name
+func compactName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// editDistance is the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsConnect dials nats://[user:pass@]host:port, or with
+// nats://token@host:port a server expecting a token. TLS is used when the
+// server requires it. Reconnecting is left to the callers, which retry on a
+// connection of their own.
+func natsConnect(target *url.URL, timeout time.Duration, options ...nats.Option) (*nats.Conn, error) {
+	server := url.URL{Scheme: "nats", Host: hostPort(target, "4222")}
+	options = append([]nats.Option{
+		nats.Name("attendance-api"),
+		nats.Timeout(timeout),
+		nats.NoReconnect(),
+	}, options...)
+	if target.User != nil {
+		if pass, ok := target.User.Password(); ok {
+			options = append(options, nats.UserInfo(target.User.Username(), pass))
+		} else {
+			options = append(options, nats.Token(target.User.Username()))
+		}
+	}
+	return nats.Connect(server.String(), options...)
+}
+
+// natsPublisher publishes to a NATS server through nats.go. Each publish is
+// flushed with a round trip, so the server's answer confirms it was
+// accepted. The connection is dialed on first use and again after Close.
+type natsPublisher struct {
+	target  *url.URL
+	timeout time.Duration
+
+	conn *nats.Conn
+}
+
+func newNATSPublisher(target *url.URL, timeout time.Duration) *natsPublisher {
+	return &natsPublisher{target: target, timeout: timeout}
+}
+
+func (p *natsPublisher) Publish(subject, _ string, headers map[string]string, value []byte) error {
+	if p.conn == nil {
+		conn, err := natsConnect(p.target, p.timeout)
+		if err != nil {
+			return err
+		}
+		p.conn = conn
+	}
+
+	msg := &nats.Msg{Subject: subject, Data: value}
+	if p.conn.HeadersSupported() && len(headers) > 0 {
+		names := make([]string, 0, len(headers))
+		for name := range headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		msg.Header = nats.Header{}
+		for _, name := range names {
+			msg.Header.Set(name, headers[name])
+		}
+	}
+
+	if err := p.conn.PublishMsg(msg); err != nil {
+		p.Close()
+		return err
+	}
+	if err := p.conn.FlushTimeout(p.timeout); err != nil {
+		p.Close()
+		return err
+	}
+	// A rejected publish is reported asynchronously, before the flush returns
+	if err := p.conn.LastError(); err != nil {
+		p.Close()
+		return err
+	}
+	return nil
+}
+
+func (p *natsPublisher) Close() error {
+	if p.conn == nil {
+		return nil
+	}
+	p.conn.Close()
+	p.conn = nil
+	return nil
+}
+
+// natsBridge carries bridge messages over NATS core pub/sub, publishing and
+// subscribing on connections of their own
+type natsBridge struct {
+	target  *url.URL
+	subject string
+	timeout time.Duration
+
+	pub *natsPublisher
+}
+
+func newNATSBridge(target *url.URL, subject string, timeout time.Duration) *natsBridge {
+	return &natsBridge{target: target, subject: subject, timeout: timeout, pub: newNATSPublisher(target, timeout)}
+}
+
+func (n *natsBridge) Publish(payload []byte) error {
+	return n.pub.Publish(n.subject, "", nil, payload)
+}
+
+func (n *natsBridge) Receive(stop <-chan struct{}, handle func(payload []byte)) error {
+	failed := make(chan error, 1)
+	fail := func(err error) {
+		if err == nil {
+			err = errors.New("NATS connection closed")
+		}
+		select {
+		case failed <- err:
+		default:
+		}
+	}
+
+	// Unanswered keepalive pings close the connection, like a lost one
+	conn, err := natsConnect(n.target, n.timeout,
+		nats.PingInterval(bridgeKeepalive),
+		nats.MaxPingsOutstanding(1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) { fail(err) }),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			// Messages dropped while handle falls behind only miss a relay
+			if !errors.Is(err, nats.ErrSlowConsumer) {
+				fail(fmt.Errorf("NATS: %w", err))
+			}
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	messages := make(chan *nats.Msg, bridgeQueueSize)
+	if _, err := conn.ChanSubscribe(n.subject, messages); err != nil {
+		return err
+	}
+	if err := conn.FlushTimeout(n.timeout); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case err := <-failed:
+			return err
+		case msg := <-messages:
+			handle(msg.Data)
+		}
+	}
+}
+
+func (n *natsBridge) Close() error {
+	return n.pub.Close()
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"attendance-api/internal/domain"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// pdfAttemptLimit caps the unauthorized attempts printed in a PDF report;
+// the totals still count all of them
+const pdfAttemptLimit = 200
+
+// GetPeriodReport sums up the attendance between from and to: the totals,
+// each person recognized, and the security report of the period
+func (s *AttendanceService) GetPeriodReport(from, to time.Time) (*domain.PeriodReport, error) {
+	report := &domain.PeriodReport{
+		From:        from,
+		To:          to,
+		GeneratedAt: s.now(),
+		People:      []domain.PersonPeriod{},
+	}
+
+	err := s.reads.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(status = 'authorized'), 0)
+		FROM attendance
+		WHERE timestamp >= ? AND timestamp < ?
+	`, from, to).Scan(&report.Records, &report.Authorized)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count records: %w", err)
+	}
+
+	people, err := s.periodPeople(from, to)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.addPeriodSessions(people, from, to); err != nil {
+		return nil, err
+	}
+	for _, person := range people {
+		person.WorkedHours = math.Round(person.WorkedHours*100) / 100
+		report.People = append(report.People, *person)
+	}
+	slices.SortFunc(report.People, func(a, b domain.PersonPeriod) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	report.Security, err = s.GetSecurityReport(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// periodPeople counts the authorized recognitions of everyone recognized
+// between from and to
+func (s *AttendanceService) periodPeople(from, to time.Time) (map[string]*domain.PersonPeriod, error) {
+	rows, err := s.reads.Query(`
+		SELECT name, timestamp, late
+		FROM attendance
+		WHERE status = 'authorized' AND timestamp >= ? AND timestamp < ?
+		ORDER BY timestamp ASC
+	`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query records: %w", err)
+	}
+	defer rows.Close()
+
+	people := make(map[string]*domain.PersonPeriod)
+	days := make(map[string]map[string]bool) // days present per person
+	for rows.Next() {
+		var (
+			name string
+			ts   time.Time
+			late bool
+		)
+		if err := rows.Scan(&name, &ts, &late); err != nil {
+			return nil, fmt.Errorf("failed to scan record: %w", err)
+		}
+
+		person, ok := people[name]
+		if !ok {
+			person = &domain.PersonPeriod{Name: name, FirstSeen: ts}
+			people[name] = person
+			days[name] = make(map[string]bool)
+		}
+		person.LastSeen = ts
+		person.Recognitions++
+		if late {
+			person.LateDays++
+		}
+
+		day := ts.In(s.cfg.Timezone).Format(dayFormat)
+		if !days[name][day] {
+			days[name][day] = true
+			person.DaysPresent++
+		}
+	}
+	return people, rows.Err()
+}
+
+// addPeriodSessions adds up the hours worked in the closed sessions that
+// started between from and to
+func (s *AttendanceService) addPeriodSessions(people map[string]*domain.PersonPeriod, from, to time.Time) error {
+	rows, err := s.reads.Query(`
+		SELECT name, check_in, check_out
+		FROM attendance_sessions
+		WHERE check_in >= ? AND check_in < ? AND check_out IS NOT NULL
+	`, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			name     string
+			checkIn  time.Time
+			checkOut sql.NullTime
+		)
+		if err := rows.Scan(&name, &checkIn, &checkOut); err != nil {
+			return fmt.Errorf("failed to scan session: %w", err)
+		}
+		if person, ok := people[name]; ok && checkOut.Valid {
+			person.WorkedHours += checkOut.Time.Sub(checkIn).Hours()
+		}
+	}
+	return rows.Err()
+}
+
+// pdfColumn is a column of a PDF table
+type pdfColumn struct {
+	title string
+	width float64 // mm
+	align string
+}
+
+// WritePeriodPDF writes a period report as a printable A4 document: the
+// totals, a table of the people recognized and the unauthorized attempts,
+// with times in loc. The built-in fonts only cover Latin-1; other
+// characters print as "?".
+func WritePeriodPDF(report *domain.PeriodReport, loc *time.Location, w io.Writer) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetTitle("Attendance report", true)
+	pdf.SetCreator("attendance-api", true)
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.CellFormat(0, 10, fmt.Sprintf("Generated %s - page %d/{nb}",
+			pdfTime(report.GeneratedAt, loc), pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(0, 10, "Attendance report", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(0, 6, fmt.Sprintf("%s to %s", pdfTime(report.From, loc), pdfTime(report.To, loc)), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	security := report.Security
+	pdfHeading(pdf, "Totals")
+	totals := [][2]string{
+		{"Records", fmt.Sprint(report.Records)},
+		{"Authorized recognitions", fmt.Sprint(report.Authorized)},
+		{"Unauthorized attempts", fmt.Sprint(security.UnauthorizedAttempts)},
+		{"Misplaced recognitions", fmt.Sprint(security.MisplacedRecognitions)},
+		{"People present", fmt.Sprint(len(report.People))},
+	}
+	pdf.SetFont("Helvetica", "", 10)
+	for _, total := range totals {
+		pdf.CellFormat(60, 6, total[0], "", 0, "L", false, 0, "")
+		pdf.CellFormat(30, 6, total[1], "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	pdfHeading(pdf, "Attendance per person")
+	people := make([][]string, 0, len(report.People))
+	for _, person := range report.People {
+		people = append(people, []string{
+			tr(person.Name),
+			fmt.Sprint(person.DaysPresent),
+			fmt.Sprint(person.Recognitions),
+			fmt.Sprint(person.LateDays),
+			fmt.Sprintf("%.2f", person.WorkedHours),
+			pdfTime(person.FirstSeen, loc),
+			pdfTime(person.LastSeen, loc),
+		})
+	}
+	pdfTable(pdf, []pdfColumn{
+		{"Name", 40, "L"},
+		{"Days", 14, "R"},
+		{"Recognitions", 24, "R"},
+		{"Late days", 18, "R"},
+		{"Worked hours", 24, "R"},
+		{"First seen", 28, "L"},
+		{"Last seen", 28, "L"},
+	}, people, "Nobody was recognized in this period.")
+	pdf.Ln(4)
+
+	pdfHeading(pdf, "Unauthorized attempts")
+	attempts := make([][]string, 0, len(security.Unauthorized))
+	for i, record := range security.Unauthorized {
+		if i == pdfAttemptLimit {
+			break
+		}
+		attempts = append(attempts, []string{
+			pdfTime(record.Timestamp, loc),
+			tr(record.Name),
+			fmt.Sprintf("%.1f", record.Confidence),
+			tr(record.DeviceID),
+			tr(record.Location),
+		})
+	}
+	pdfTable(pdf, []pdfColumn{
+		{"Time", 32, "L"},
+		{"Name", 40, "L"},
+		{"Confidence", 22, "R"},
+		{"Device", 42, "L"},
+		{"Location", 40, "L"},
+	}, attempts, "No unauthorized attempts in this period.")
+	if security.UnauthorizedAttempts > len(attempts) {
+		pdf.SetFont("Helvetica", "I", 9)
+		pdf.CellFormat(0, 6, fmt.Sprintf("The %d most recent of %d attempts are listed.",
+			len(attempts), security.UnauthorizedAttempts), "", 1, "L", false, 0, "")
+	}
+
+	if err := pdf.Output(w); err != nil {
+		return fmt.Errorf("failed to write PDF: %w", err)
+	}
+	return nil
+}
+
+func pdfHeading(pdf *fpdf.Fpdf, title string) {
+	pdf.SetFont("Helvetica", "B", 12)
+	pdf.CellFormat(0, 8, title, "", 1, "L", false, 0, "")
+}
+
+// pdfTable prints rows under a header that is repeated on every page the
+// table runs onto
+func pdfTable(pdf *fpdf.Fpdf, columns []pdfColumn, rows [][]string, empty string) {
+	if len(rows) == 0 {
+		pdf.SetFont("Helvetica", "I", 10)
+		pdf.CellFormat(0, 6, empty, "", 1, "L", false, 0, "")
+		return
+	}
+
+	const rowHeight = 6
+	header := func() {
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.SetFillColor(230, 230, 230)
+		for _, column := range columns {
+			pdf.CellFormat(column.width, rowHeight, column.title, "1", 0, column.align, true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Helvetica", "", 9)
+	}
+
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	header()
+	for _, row := range rows {
+		if pdf.GetY()+rowHeight > pageHeight-bottom {
+			pdf.AddPage()
+			header()
+		}
+		for i, column := range columns {
+			pdf.CellFormat(column.width, rowHeight, pdfFit(pdf, row[i], column.width-2), "1", 0, column.align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+}
+
+// pdfFit shortens text to the width of a cell
+func pdfFit(pdf *fpdf.Fpdf, text string, width float64) string {
+	if pdf.GetStringWidth(text) <= width {
+		return text
+	}
+	for len(text) > 0 && pdf.GetStringWidth(text+"...") > width {
+		text = text[:len(text)-1]
+	}
+	return text + "..."
+}
+
+func pdfTime(ts time.Time, loc *time.Location) string {
+	if ts.IsZero() {
+		return ""
+	}
+	return ts.In(loc).Format("2006-01-02 15:04")
+}
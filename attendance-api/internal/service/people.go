@@ -0,0 +1,675 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"attendance-api/internal/client"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	ErrPersonNotFound = errors.New("person not found")
+	ErrPersonExists   = errors.New("a person with this name, employee number, external ID or card number already exists")
+	ErrInvalidPerson  = errors.New("invalid person")
+	ErrAmbiguousRef   = errors.New("the reference matches more than one person")
+)
+
+func (s *AttendanceService) initPeopleSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS people (
+		name TEXT PRIMARY KEY,
+		department TEXT NOT NULL DEFAULT '',
+		group_name TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_people_department ON people(department, group_name);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute people schema: %w", err)
+	}
+
+	// The profile columns came after department membership; the name stays
+	// the key the face service knows the person by
+	for _, column := range []struct{ name, definition string }{
+		{"id", "TEXT NOT NULL DEFAULT ''"},
+		{"full_name", "TEXT NOT NULL DEFAULT ''"},
+		{"employee_number", "TEXT NOT NULL DEFAULT ''"},
+		{"email", "TEXT NOT NULL DEFAULT ''"},
+		{"active", "INTEGER NOT NULL DEFAULT 1"},
+		{"external_id", "TEXT NOT NULL DEFAULT ''"},
+		{"card_number", "TEXT NOT NULL DEFAULT ''"},
+	} {
+		if err := ensureColumn(s.db, "people", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
+	if err := s.assignPersonIDs(); err != nil {
+		return err
+	}
+
+	indexes := `
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_people_id ON people(id);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_people_employee_number ON people(employee_number) WHERE employee_number != '';
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_people_external_id ON people(external_id) WHERE external_id != '';
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_people_card_number ON people(card_number) WHERE card_number != '';
+	CREATE INDEX IF NOT EXISTS idx_attendance_person_id ON attendance(person_id);
+	`
+	if _, err := s.db.Exec(indexes); err != nil {
+		return fmt.Errorf("failed to create people indexes: %w", err)
+	}
+
+	return nil
+}
+
+// assignPersonIDs gives people created before IDs existed one, and links
+// their attendance records to it
+func (s *AttendanceService) assignPersonIDs() error {
+	rows, err := s.db.Query("SELECT name FROM people WHERE id = ''")
+	if err != nil {
+		return fmt.Errorf("failed to query people without id: %w", err)
+	}
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan person: %w", err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("row iteration error: %w", err)
+	}
+
+	for _, name := range names {
+		id := s.newID()
+		if _, err := s.db.Exec("UPDATE people SET id = ? WHERE name = ?", id, name); err != nil {
+			return fmt.Errorf("failed to assign person id: %w", err)
+		}
+		if err := s.linkAttendance(id, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// inactiveNames returns the names of the people marked inactive
+func (s *AttendanceService) inactiveNames() (map[string]bool, error) {
+	rows, err := s.reads.Query("SELECT name FROM people WHERE active = 0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query inactive people: %w", err)
+	}
+	defer rows.Close()
+
+	names := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan person: %w", err)
+		}
+		names[name] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return names, nil
+}
+
+// linkAttendance points the unlinked attendance records of a name at a person
+func (s *AttendanceService) linkAttendance(id, name string) error {
+	if _, err := s.db.Exec("UPDATE attendance SET person_id = ? WHERE name = ? AND person_id = ''", id, name); err != nil {
+		return fmt.Errorf("failed to link attendance: %w", err)
+	}
+	return nil
+}
+
+// personFor returns the ID and active flag of the person a recognized name
+// belongs to. Names without a person are active and have no ID.
+func (s *AttendanceService) personFor(name string) (string, bool, error) {
+	var (
+		id     string
+		active bool
+	)
+	err := s.db.QueryRow("SELECT id, active FROM people WHERE name = ?", name).Scan(&id, &active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", true, nil
+	}
+	if err != nil {
+		return "", true, fmt.Errorf("failed to look up person: %w", err)
+	}
+	return id, active, nil
+}
+
+// groupClause returns an SQL condition on the name column that keeps only
+// members of the filtered department and group, or an always-true
+// condition when the filter is empty
+func groupClause(filter domain.GroupFilter) (string, []interface{}) {
+	if filter.IsEmpty() {
+		return "1 = 1", nil
+	}
+
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.Department != "" {
+		conditions = append(conditions, "department = ?")
+		args = append(args, filter.Department)
+	}
+	if filter.Group != "" {
+		conditions = append(conditions, "group_name = ?")
+		args = append(args, filter.Group)
+	}
+
+	return "name IN (SELECT name FROM people WHERE " + strings.Join(conditions, " AND ") + ")", args
+}
+
+// sourceClause returns an SQL condition on the attendance records of the
+// filtered device and location, or an always-true condition when the filter
+// is empty
+func sourceClause(filter domain.SourceFilter) (string, []interface{}) {
+	if filter.IsEmpty() {
+		return "1 = 1", nil
+	}
+
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.DeviceID != "" {
+		conditions = append(conditions, "device_id = ?")
+		args = append(args, filter.DeviceID)
+	}
+	if filter.Location != "" {
+		conditions = append(conditions, "location = ?")
+		args = append(args, filter.Location)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+const personColumns = `id, name, full_name, employee_number, external_id, card_number, email, active,
+	department, group_name, created_at, updated_at`
+
+func scanPerson(row rowScanner) (*domain.Person, error) {
+	var person domain.Person
+	err := row.Scan(&person.ID, &person.Name, &person.FullName, &person.EmployeeNumber, &person.ExternalID,
+		&person.CardNumber, &person.Email, &person.Active, &person.Department, &person.Group, &person.CreatedAt, &person.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan person: %w", err)
+	}
+	return &person, nil
+}
+
+// ListPeople returns the people, optionally only the members of a
+// department or group
+func (s *AttendanceService) ListPeople(filter domain.GroupFilter) ([]domain.Person, error) {
+	where, args := groupClause(filter)
+
+	rows, err := s.reads.Query(`
+		SELECT `+personColumns+`
+		FROM people
+		WHERE `+where+`
+		ORDER BY department, group_name, name
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query people: %w", err)
+	}
+	defer rows.Close()
+
+	people := []domain.Person{}
+	for rows.Next() {
+		person, err := scanPerson(rows)
+		if err != nil {
+			return nil, err
+		}
+		people = append(people, *person)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return people, nil
+}
+
+// GetPerson returns a person by ID
+func (s *AttendanceService) GetPerson(id string) (*domain.Person, error) {
+	person, err := scanPerson(s.db.QueryRow("SELECT "+personColumns+" FROM people WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPersonNotFound
+	}
+	return person, err
+}
+
+// PersonProfile combines a name's person entry, face service enrollment,
+// latest attendance and statistics. The face service is asked last and
+// only for the list of faces, which may be cached; when it cannot be
+// reached the profile is returned without enrollment. A name that is
+// neither a person, enrolled nor in the attendance is ErrPersonNotFound.
+func (s *AttendanceService) PersonProfile(ctx context.Context, name string) (*domain.PersonProfile, error) {
+	profile := &domain.PersonProfile{Name: NormalizeName(name)}
+	if profile.Name == "" {
+		return nil, ErrPersonNotFound
+	}
+
+	person, err := scanPerson(s.reads.QueryRow("SELECT "+personColumns+" FROM people WHERE name = ?", profile.Name))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return nil, err
+	default:
+		profile.Person = person
+	}
+
+	latest, err := s.GetAttendanceByName(profile.Name, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(latest) > 0 {
+		profile.Latest = &latest[0]
+	}
+
+	since := s.now().AddDate(0, 0, -30).Format("2006-01-02")
+	err = s.reads.QueryRow(`
+		SELECT COUNT(*),
+		       COALESCE(SUM(status = 'authorized'), 0),
+		       COUNT(DISTINCT CASE WHEN status = 'authorized' AND local_date(timestamp) >= ? THEN local_date(timestamp) END),
+		       COALESCE(SUM(late AND local_date(timestamp) >= ?), 0)
+		FROM attendance
+		WHERE name = ?
+	`, since, since, profile.Name).Scan(&profile.Stats.Total, &profile.Stats.Authorized,
+		&profile.Stats.DaysPresent30d, &profile.Stats.Late30d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate attendance: %w", err)
+	}
+
+	if profile.Stats.Total > 0 {
+		var first time.Time
+		err := s.reads.QueryRow("SELECT timestamp FROM attendance WHERE name = ? ORDER BY timestamp LIMIT 1", profile.Name).Scan(&first)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query first record: %w", err)
+		}
+		profile.Stats.FirstSeen = &first
+	}
+
+	faces, err := s.faceClient.GetFaces(ctx)
+	if err != nil {
+		logging.From(ctx).Warn("Showing profile without enrollment, face service unavailable", "person", profile.Name, "error", err)
+	} else {
+		profile.Enrollment = &domain.FaceEnrollment{}
+		for _, face := range faces {
+			if face.Name == profile.Name {
+				profile.Enrollment = &domain.FaceEnrollment{Enrolled: true, Images: face.Images}
+				break
+			}
+		}
+	}
+
+	enrolled := profile.Enrollment != nil && profile.Enrollment.Enrolled
+	if profile.Person == nil && profile.Stats.Total == 0 && !enrolled {
+		return nil, ErrPersonNotFound
+	}
+
+	return profile, nil
+}
+
+// GetPersonByReference returns the person whose employee number, external ID
+// or card number is ref. Each is unique on its own, but the same value may
+// be one person's card number and another's employee number, which is
+// reported as ErrAmbiguousRef.
+func (s *AttendanceService) GetPersonByReference(ref string) (*domain.Person, error) {
+	rows, err := s.reads.Query(`
+		SELECT `+personColumns+`
+		FROM people
+		WHERE (employee_number = ? AND employee_number != '')
+			OR (external_id = ? AND external_id != '')
+			OR (card_number = ? AND card_number != '')
+		LIMIT 2
+	`, ref, ref, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query people: %w", err)
+	}
+	defer rows.Close()
+
+	people := []domain.Person{}
+	for rows.Next() {
+		person, err := scanPerson(rows)
+		if err != nil {
+			return nil, err
+		}
+		people = append(people, *person)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	switch len(people) {
+	case 0:
+		return nil, ErrPersonNotFound
+	case 1:
+		return &people[0], nil
+	default:
+		return nil, ErrAmbiguousRef
+	}
+}
+
+// CreatePerson adds a person under the name the face service recognizes
+// them by, and links the attendance already recorded for that name
+func (s *AttendanceService) CreatePerson(person domain.Person) (*domain.Person, error) {
+	person.Name = NormalizeName(person.Name)
+	if person.Name == "" || person.Name == "unknown" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidPerson)
+	}
+
+	now := time.Now()
+	person.ID = s.newID()
+	person.CreatedAt = now
+	person.UpdatedAt = now
+
+	_, err := s.db.Exec(`
+		INSERT INTO people (id, name, full_name, employee_number, external_id, card_number, email, active,
+			department, group_name, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, person.ID, person.Name, person.FullName, person.EmployeeNumber, person.ExternalID, person.CardNumber,
+		person.Email, person.Active,
+		person.Department, person.Group, person.CreatedAt, person.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrPersonExists
+		}
+		return nil, fmt.Errorf("failed to insert person: %w", err)
+	}
+
+	if err := s.linkAttendance(person.ID, person.Name); err != nil {
+		return nil, err
+	}
+
+	return &person, nil
+}
+
+// UpdatePerson changes the profile of a person. The name cannot change, as
+// it has to match the face service.
+func (s *AttendanceService) UpdatePerson(id string, update domain.PersonUpdate) (*domain.Person, error) {
+	person, err := s.GetPerson(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.FullName != nil {
+		person.FullName = *update.FullName
+	}
+	if update.EmployeeNumber != nil {
+		person.EmployeeNumber = *update.EmployeeNumber
+	}
+	if update.ExternalID != nil {
+		person.ExternalID = *update.ExternalID
+	}
+	if update.CardNumber != nil {
+		person.CardNumber = *update.CardNumber
+	}
+	if update.Email != nil {
+		person.Email = *update.Email
+	}
+	if update.Active != nil {
+		person.Active = *update.Active
+	}
+	if update.Department != nil {
+		person.Department = strings.TrimSpace(*update.Department)
+	}
+	if update.Group != nil {
+		person.Group = strings.TrimSpace(*update.Group)
+	}
+	person.UpdatedAt = time.Now()
+
+	_, err = s.db.Exec(`
+		UPDATE people
+		SET full_name = ?, employee_number = ?, external_id = ?, card_number = ?, email = ?, active = ?,
+			department = ?, group_name = ?, updated_at = ?
+		WHERE id = ?
+	`, person.FullName, person.EmployeeNumber, person.ExternalID, person.CardNumber, person.Email, person.Active,
+		person.Department, person.Group, person.UpdatedAt, id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrPersonExists
+		}
+		return nil, fmt.Errorf("failed to update person: %w", err)
+	}
+
+	return person, nil
+}
+
+// DeletePerson removes a person's profile. Their attendance records keep
+// the person ID.
+func (s *AttendanceService) DeletePerson(id string) error {
+	result, err := s.db.Exec("DELETE FROM people WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete person: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrPersonNotFound
+	}
+	return nil
+}
+
+// SetMembership places a person in a department and group, creating the
+// person when the name is new. Clearing both returns nil.
+func (s *AttendanceService) SetMembership(name, department, group string) (*domain.Person, error) {
+	name = NormalizeName(name)
+	department = strings.TrimSpace(department)
+	group = strings.TrimSpace(group)
+
+	now := time.Now()
+	id := s.newID()
+	_, err := s.db.Exec(`
+		INSERT INTO people (id, name, department, group_name, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			department = excluded.department,
+			group_name = excluded.group_name,
+			updated_at = excluded.updated_at
+	`, id, name, department, group, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert person: %w", err)
+	}
+
+	person, err := scanPerson(s.db.QueryRow("SELECT "+personColumns+" FROM people WHERE name = ?", name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read person: %w", err)
+	}
+
+	// A new person
+	if person.ID == id {
+		if err := s.linkAttendance(id, name); err != nil {
+			return nil, err
+		}
+	}
+
+	if department == "" && group == "" {
+		return nil, nil
+	}
+
+	return person, nil
+}
+
+// MergePeople consolidates two identities of the same person, e.g. one
+// enrolled as "jon_smith" and one as "john_smith", into target: the face
+// images of source are moved to target, and its attendance records,
+// sessions, location assignments and personal API keys are renamed. When
+// only source has a person entry it is renamed too; when both have one the
+// entry of source is deleted. The merge is recorded as an identity change
+// that RevertIdentityChange can undo.
+func (s *AttendanceService) MergePeople(ctx context.Context, source, target string) (*domain.PeopleMerge, error) {
+	source, target = NormalizeName(source), NormalizeName(target)
+	if source == "" || target == "" || source == target {
+		return nil, fmt.Errorf("%w: source and target must be two different names", ErrInvalidPerson)
+	}
+
+	merge := &domain.PeopleMerge{Source: source, Target: target}
+
+	// A source without face images may still have attendance history
+	images, err := s.faceClient.MergeFaces(ctx, source, target, nil)
+	if err != nil && !errors.Is(err, client.ErrFaceNotFound) {
+		return nil, err
+	}
+	merge.ImagesMoved = len(images)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var targetExists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM people WHERE name = ?)", target).Scan(&targetExists); err != nil {
+		return nil, fmt.Errorf("failed to look up person: %w", err)
+	}
+
+	// What the merge changes is kept so that it can be reverted
+	undo := identityUndo{Records: map[string][]string{}}
+	sourcePerson, err := scanPerson(tx.QueryRow("SELECT "+personColumns+" FROM people WHERE name = ?", source))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if sourcePerson != nil {
+		if targetExists {
+			undo.Person = sourcePerson
+		} else {
+			undo.PersonRenamed = true
+		}
+	}
+	if err := s.collectMergeUndo(tx, source, target, &undo); err != nil {
+		return nil, err
+	}
+
+	var result sql.Result
+	if targetExists {
+		result, err = tx.Exec("DELETE FROM people WHERE name = ?", source)
+	} else {
+		result, err = tx.Exec("UPDATE people SET name = ?, updated_at = ? WHERE name = ?", target, time.Now(), source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge person: %w", err)
+	}
+	sourcePeople, _ := result.RowsAffected()
+
+	err = tx.QueryRow("SELECT id FROM people WHERE name = ?", target).Scan(&merge.PersonID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to look up person: %w", err)
+	}
+
+	result, err = tx.Exec("UPDATE attendance SET name = ?, person_id = ? WHERE name = ?", target, merge.PersonID, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge attendance: %w", err)
+	}
+	merge.RecordsMoved, _ = result.RowsAffected()
+
+	result, err = tx.Exec("UPDATE attendance_sessions SET name = ? WHERE name = ?", target, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge sessions: %w", err)
+	}
+	merge.SessionsMoved, _ = result.RowsAffected()
+
+	if len(images) == 0 && sourcePeople == 0 && merge.RecordsMoved == 0 {
+		return nil, ErrPersonNotFound
+	}
+
+	// Location assignments and door grants are combined; the others are
+	// renamed
+	statements := []string{
+		"INSERT OR IGNORE INTO person_locations (name, location) SELECT ?, location FROM person_locations WHERE name = ?",
+		"INSERT OR IGNORE INTO door_grants (target_type, target, subject_type, subject) SELECT target_type, target, subject_type, ? FROM door_grants WHERE subject_type = 'person' AND subject = ?",
+		"UPDATE api_keys SET person = ? WHERE person = ?",
+		"UPDATE unknown_events SET enrolled_name = ? WHERE enrolled_name = ?",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, target, source); err != nil {
+			return nil, fmt.Errorf("failed to merge %s into %s: %w", source, target, err)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM person_locations WHERE name = ?", source); err != nil {
+		return nil, fmt.Errorf("failed to clear location assignments: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM door_grants WHERE subject_type = 'person' AND subject = ?", source); err != nil {
+		return nil, fmt.Errorf("failed to clear door grants: %w", err)
+	}
+
+	change := &domain.IdentityChange{
+		Type:          domain.IdentityMerge,
+		Source:        source,
+		Target:        target,
+		Images:        images,
+		RecordsMoved:  merge.RecordsMoved,
+		SessionsMoved: merge.SessionsMoved,
+	}
+	if err := s.recordIdentityChange(ctx, tx, change, undo); err != nil {
+		return nil, err
+	}
+	merge.ChangeID = change.ID
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit merge: %w", err)
+	}
+
+	s.cooldownMu.Lock()
+	delete(s.lastSeen, source)
+	s.cooldownMu.Unlock()
+
+	logging.From(ctx).Info("Merged people", "source", source, "target", target, "images", merge.ImagesMoved, "records", merge.RecordsMoved)
+
+	return merge, nil
+}
+
+// ListGroups returns every department/group combination with its member count
+func (s *AttendanceService) ListGroups() ([]domain.GroupSummary, error) {
+	rows, err := s.reads.Query(`
+		SELECT department, group_name, COUNT(*)
+		FROM people
+		WHERE department != '' OR group_name != ''
+		GROUP BY department, group_name
+		ORDER BY department, group_name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []domain.GroupSummary{}
+	for rows.Next() {
+		var group domain.GroupSummary
+		if err := rows.Scan(&group.Department, &group.Group, &group.Members); err != nil {
+			return nil, fmt.Errorf("failed to scan group: %w", err)
+		}
+		groups = append(groups, group)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return groups, nil
+}
+
+// isUniqueViolation reports whether an insert or update failed on a unique
+// index or primary key
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+
+	"attendance-api/internal/domain"
+)
+
+// Photo quality thresholds. Sharpness is measured on the image scaled down
+// to qualityWidth, so it does not depend on the camera's resolution.
+const (
+	qualityWidth = 320
+
+	minBrightness  = 70  // mean luminance, 0-255
+	maxBrightness  = 190 // above it the face washes out
+	minSharpness   = 40  // variance of the Laplacian
+	minResolution  = 240 // shorter side, in pixels
+	minFaceRatio   = 0.2 // face height / image height
+	maxFaceRatio   = 0.8
+	maxFaceOffset  = 0.25 // face center from image center, share of the width
+	minFaceAspect  = 0.6  // face box width / height; narrower means turned away
+	backlightRatio = 0.6  // face brightness / image brightness
+)
+
+// assessPhoto scores an enrollment photo with a local image analysis, before
+// it reaches the face service. With the face's location, from a recognition
+// of the photo, the face size, pose and lighting are judged as well; the
+// pose is estimated from the face box, as the face service reports no
+// landmarks. It returns nil for images that cannot be decoded here (only
+// JPEG, PNG and WebP can), leaving them to the face service.
+func assessPhoto(data []byte, face *domain.FaceLocation) *domain.PhotoQuality {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+
+	bounds := img.Bounds()
+	gray, width, height := luminanceGrid(img)
+
+	quality := &domain.PhotoQuality{Score: 100}
+	penalize := func(points int, guidance string) {
+		quality.Score = max(quality.Score-points, 0)
+		quality.Guidance = append(quality.Guidance, guidance)
+	}
+
+	quality.Brightness = round1(mean(gray))
+	quality.Sharpness = round1(laplacianVariance(gray, width, height))
+
+	switch {
+	case quality.Brightness < minBrightness:
+		penalize(30, "Too dark: turn on the lights or face a window")
+	case quality.Brightness > maxBrightness:
+		penalize(30, "Too bright: avoid direct sunlight and the camera flash")
+	}
+	if quality.Sharpness < minSharpness {
+		penalize(35, "Blurry: hold the camera still and tap the face to focus")
+	}
+	if min(bounds.Dx(), bounds.Dy()) < minResolution {
+		penalize(20, "Resolution too low: use the rear camera or a higher resolution")
+	}
+
+	if face == nil || face.Right <= face.Left || face.Bottom <= face.Top {
+		return quality
+	}
+
+	faceWidth := float64(face.Right - face.Left)
+	faceHeight := float64(face.Bottom - face.Top)
+	quality.FaceRatio = round2(faceHeight / float64(bounds.Dy()))
+	switch {
+	case quality.FaceRatio < minFaceRatio:
+		penalize(25, "Face too small: move closer to the camera")
+	case quality.FaceRatio > maxFaceRatio:
+		penalize(15, "Face too large: move back so the whole head is in the frame")
+	}
+
+	center := float64(face.Left) + faceWidth/2 - float64(bounds.Min.X)
+	if math.Abs(center/float64(bounds.Dx())-0.5) > maxFaceOffset {
+		penalize(10, "Face off-center: center the face in the frame")
+	}
+	if faceWidth/faceHeight < minFaceAspect {
+		penalize(20, "Head turned: look straight into the camera")
+	}
+
+	// A face much darker than its surroundings is lit from behind
+	scale := float64(bounds.Dx()) / float64(width)
+	faceBrightness := mean(cropGrid(gray, width, height,
+		int(float64(face.Left-bounds.Min.X)/scale), int(float64(face.Top-bounds.Min.Y)/scale),
+		int(float64(face.Right-bounds.Min.X)/scale), int(float64(face.Bottom-bounds.Min.Y)/scale)))
+	if faceBrightness > 0 && faceBrightness < quality.Brightness*backlightRatio {
+		penalize(20, "Backlit: do not stand in front of a window or lamp")
+	}
+
+	return quality
+}
+
+// luminanceGrid samples the image's luminance into a grid at most
+// qualityWidth wide, row by row
+func luminanceGrid(img image.Image) ([]float64, int, int) {
+	bounds := img.Bounds()
+	width := min(bounds.Dx(), qualityWidth)
+	scale := float64(bounds.Dx()) / float64(width)
+	height := max(int(float64(bounds.Dy())/scale), 1)
+
+	gray := make([]float64, 0, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := img.At(bounds.Min.X+int(float64(x)*scale), bounds.Min.Y+int(float64(y)*scale))
+			gray = append(gray, float64(color.GrayModel.Convert(c).(color.Gray).Y))
+		}
+	}
+	return gray, width, height
+}
+
+// cropGrid returns the part of a grid inside the rectangle
+func cropGrid(gray []float64, width, height, left, top, right, bottom int) []float64 {
+	left, top = max(left, 0), max(top, 0)
+	right, bottom = min(right, width), min(bottom, height)
+
+	var part []float64
+	for y := top; y < bottom; y++ {
+		part = append(part, gray[y*width+left:y*width+right]...)
+	}
+	return part
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// laplacianVariance measures sharpness: edges give the Laplacian large
+// values, so a blurred image has a low variance
+func laplacianVariance(gray []float64, width, height int) float64 {
+	var laplacian []float64
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			i := y*width + x
+			laplacian = append(laplacian, 4*gray[i]-gray[i-1]-gray[i+1]-gray[i-width]-gray[i+width])
+		}
+	}
+
+	m := mean(laplacian)
+	variance := 0.0
+	for _, v := range laplacian {
+		variance += (v - m) * (v - m)
+	}
+	return variance / float64(max(len(laplacian), 1))
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
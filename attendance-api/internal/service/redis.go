@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisOptions connects to redis://[user:password@]host:port, or over TLS to
+// rediss://. A user name without a password is taken as the password, which
+// is all Redis before 6 knows.
+func redisOptions(target *url.URL, timeout time.Duration) *redis.Options {
+	options := &redis.Options{
+		Addr:         hostPort(target, "6379"),
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+		PoolSize:     1,
+		MaxRetries:   -1, // the bridge retries on its own
+	}
+	if target.Scheme == "rediss" {
+		options.TLSConfig = &tls.Config{ServerName: target.Hostname(), MinVersion: tls.VersionTLS12}
+	}
+	if target.User != nil {
+		if pass, ok := target.User.Password(); ok {
+			options.Username, options.Password = target.User.Username(), pass
+		} else {
+			options.Password = target.User.Username()
+		}
+	}
+	return options
+}
+
+// redisBridge carries bridge messages over Redis pub/sub through go-redis,
+// publishing on one connection and subscribing on another, as a subscribed
+// connection takes no other commands
+type redisBridge struct {
+	options *redis.Options
+	channel string
+	timeout time.Duration
+
+	pub *redis.Client // created on first use and again after Close
+}
+
+func newRedisBridge(target *url.URL, channel string, timeout time.Duration) *redisBridge {
+	return &redisBridge{options: redisOptions(target, timeout), channel: channel, timeout: timeout}
+}
+
+func (r *redisBridge) Publish(payload []byte) error {
+	if r.pub == nil {
+		r.pub = redis.NewClient(r.options)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	if err := r.pub.Publish(ctx, r.channel, payload).Err(); err != nil {
+		r.Close()
+		return err
+	}
+	return nil
+}
+
+func (r *redisBridge) Receive(stop <-chan struct{}, handle func(payload []byte)) error {
+	client := redis.NewClient(r.options)
+	defer client.Close()
+
+	ctx := context.Background()
+	sub := client.Subscribe(ctx, r.channel)
+	defer sub.Close()
+
+	// Closing the subscription ends the read below
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			sub.Close()
+		case <-done:
+		}
+	}()
+
+	pinged := false
+	for {
+		msg, err := sub.ReceiveTimeout(ctx, bridgeKeepalive)
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			// A quiet channel is pinged; a dead connection leaves the ping
+			// unanswered too
+			if pinged {
+				return err
+			}
+			if err := sub.Ping(ctx); err != nil {
+				return err
+			}
+			pinged = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		pinged = false
+
+		if msg, ok := msg.(*redis.Message); ok {
+			handle([]byte(msg.Payload))
+		}
+		// Subscription confirmations and pongs need no answer
+	}
+}
+
+func (r *redisBridge) Close() error {
+	if r.pub == nil {
+		return nil
+	}
+	err := r.pub.Close()
+	r.pub = nil
+	return err
+}
@@ -0,0 +1,837 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotStandby = errors.New("node is not a standby")
+	ErrStandby    = errors.New("node is a standby")
+)
+
+// replicatedMetadata lists the tables a standby receives in full whenever
+// they change on the active node. They are small, unlike the tables in
+// replicatedRows. Accounts, their refresh tokens and security keys, and
+// webhooks come along so sign-ins and deliveries carry on after a failover.
+var replicatedMetadata = []string{"people", "person_locations", "shifts", "holidays", "api_keys", "devices", "device_settings", "doors", "door_grants", "door_schedules", "emergency",
+	"users", "refresh_tokens", "webauthn_credentials", "webhooks"}
+
+// replicatedRows lists the tables a standby follows row by row. Triggers
+// note the id of every row inserted, updated or deleted in the replication
+// log, and the stream sends those rows as they are now, or their deletion,
+// so merges, splits, reverts and history erasure reach the standby too.
+//
+// Unknown-face events and record snapshots are left out: their images are
+// kept in the snapshot store of each node, which the stream does not carry.
+// So are device commands, which a promoted node must not deliver long after
+// they were queued, such as a door opening.
+var replicatedRows = []string{"attendance", "attendance_sessions", "audit_log", "identity_changes"}
+
+const (
+	// replicationBatchSize caps the rows and log entries sent in one message
+	replicationBatchSize = 500
+
+	// replicationLogRetention is how long the replication log is kept. A
+	// standby further behind copies the replicated tables in full again.
+	replicationLogRetention = 7 * 24 * time.Hour
+
+	// replicationRetry is the pause before a standby reconnects
+	replicationRetry = 5 * time.Second
+)
+
+// ReplicationService keeps a standby node in sync with the active node of a
+// pair. The active node serves a stream of changes (the rows changed since
+// the standby's cursor in the replication log, and snapshots of the metadata
+// tables) that the standby applies to its own database. A standby rejects writes until it is
+// promoted, so devices configured with both endpoints fail over to it only
+// once an operator has made it active.
+type ReplicationService struct {
+	db     *sql.DB
+	reads  *sql.DB
+	cfg    config.ReplicationConfig
+	client *http.Client
+
+	mu          sync.RWMutex
+	role        string
+	logID       string             // tells the replication log of this node from others
+	stopFollow  context.CancelFunc // stops the standby's follow loop
+	connected   bool
+	lastMessage time.Time
+	lastError   string
+	standbys    map[string]*domain.StandbyInfo // connected standbys by remote address
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// onPromote is told when this node becomes the active one
+	onPromote func()
+
+	logger *slog.Logger
+}
+
+func NewReplicationService(db, reads *sql.DB, cfg config.ReplicationConfig) (*ReplicationService, error) {
+	switch cfg.Role {
+	case domain.RoleStandalone, domain.RoleActive:
+	case domain.RoleStandby:
+		if cfg.PrimaryURL == "" {
+			return nil, fmt.Errorf("a standby needs the URL of the active node")
+		}
+	default:
+		return nil, fmt.Errorf("unknown replication role %q", cfg.Role)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	service := &ReplicationService{
+		logger:   logging.Component("replication"),
+		db:       db,
+		reads:    reads,
+		cfg:      cfg,
+		client:   &http.Client{}, // no timeout, the stream stays open
+		role:     cfg.Role,
+		standbys: make(map[string]*domain.StandbyInfo),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+
+	if err := service.initSchema(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	go service.pruneLoop()
+
+	return service, nil
+}
+
+// initSchema must run after the schemas of the replicatedRows tables, whose
+// triggers fill the replication log
+func (s *ReplicationService) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS replication_state (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS replication_log (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		table_name TEXT NOT NULL,
+		row_id TEXT NOT NULL,
+		logged_at TEXT NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_replication_log_logged_at ON replication_log(logged_at);
+
+	-- Cursors of earlier versions counted attendance rowids, which missed
+	-- updates and deletes; without them the standby copies everything again
+	DELETE FROM replication_state WHERE key IN ('attendance', 'sessions');
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+
+	if _, err := s.db.Exec("INSERT OR IGNORE INTO replication_state (key, value) VALUES ('log_id', ?)", uuid.New().String()); err != nil {
+		return fmt.Errorf("failed to create replication log id: %w", err)
+	}
+	if err := s.db.QueryRow("SELECT value FROM replication_state WHERE key = 'log_id'").Scan(&s.logID); err != nil {
+		return fmt.Errorf("failed to read replication log id: %w", err)
+	}
+
+	for _, table := range replicatedRows {
+		columns, err := tableColumns(s.db, table)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(columns, "id") {
+			return fmt.Errorf("replicated table %s does not exist or has no id column", table)
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := `strftime('%Y-%m-%dT%H:%M:%fZ', 'now')`
+	for _, table := range replicatedRows {
+		entry := func(id string) string {
+			return fmt.Sprintf("INSERT INTO replication_log (table_name, row_id, logged_at) SELECT '%s', %s, %s", table, id, now)
+		}
+		triggers := []struct{ name, event, body string }{
+			{table + "_replication_insert", "INSERT", entry("NEW.id") + ";"},
+			// A changed id deletes the row under the old one
+			{table + "_replication_update", "UPDATE", entry("NEW.id") + "; " + entry("OLD.id") + " WHERE OLD.id IS NOT NEW.id;"},
+			{table + "_replication_delete", "DELETE", entry("OLD.id") + ";"},
+		}
+
+		for _, trigger := range triggers {
+			if _, err := tx.Exec("DROP TRIGGER IF EXISTS " + trigger.name); err != nil {
+				return fmt.Errorf("failed to drop trigger %s: %w", trigger.name, err)
+			}
+			_, err := tx.Exec(fmt.Sprintf(`
+				CREATE TRIGGER %s AFTER %s ON %s
+				BEGIN
+					%s
+				END
+			`, trigger.name, trigger.event, table, trigger.body))
+			if err != nil {
+				return fmt.Errorf("failed to create trigger %s: %w", trigger.name, err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Start begins following the active node when this node is a standby
+func (s *ReplicationService) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.role != domain.RoleStandby {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.stopFollow = cancel
+	go s.follow(ctx)
+}
+
+// Close stops following the active node and ends the streams served to
+// standbys
+func (s *ReplicationService) Close() {
+	s.cancel()
+}
+
+func (s *ReplicationService) Role() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.role
+}
+
+// IsStandby reports whether the node currently rejects writes
+func (s *ReplicationService) IsStandby() bool {
+	return s.Role() == domain.RoleStandby
+}
+
+// Promote turns a standby into the active node: it stops following the old
+// active node and starts accepting writes. The old active node must not come
+// back as active, or both nodes would record attendance independently.
+func (s *ReplicationService) Promote() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.role != domain.RoleStandby {
+		return ErrNotStandby
+	}
+
+	// Standbys that followed the old active node have a cursor into its log,
+	// not this one, so they copy everything from this node first. A new log
+	// id tells them apart even when this database began as a copy.
+	logID := uuid.New().String()
+	if _, err := s.db.Exec("UPDATE replication_state SET value = ? WHERE key = 'log_id'", logID); err != nil {
+		return fmt.Errorf("failed to renew replication log id: %w", err)
+	}
+	s.logID = logID
+
+	if s.stopFollow != nil {
+		s.stopFollow()
+		s.stopFollow = nil
+	}
+	s.role = domain.RoleActive
+	s.connected = false
+
+	s.logger.Warn("Promoted to active, no longer following", "primary", s.cfg.PrimaryURL)
+	if s.onPromote != nil {
+		s.onPromote()
+	}
+	return nil
+}
+
+// OnPromote sets a function told when a standby is promoted, to pick up
+// what it replicated. It must be set before the service is started.
+func (s *ReplicationService) OnPromote(fn func()) {
+	s.onPromote = fn
+}
+
+func (s *ReplicationService) Status() (*domain.ReplicationStatus, error) {
+	s.mu.RLock()
+	status := &domain.ReplicationStatus{
+		Role:      s.role,
+		Connected: s.connected,
+		LastError: s.lastError,
+		Standbys:  []domain.StandbyInfo{},
+	}
+	if s.role == domain.RoleStandby {
+		status.Primary = s.cfg.PrimaryURL
+	}
+	if !s.lastMessage.IsZero() {
+		lastMessage := s.lastMessage
+		status.LastMessageAt = &lastMessage
+	}
+	for _, standby := range s.standbys {
+		status.Standbys = append(status.Standbys, *standby)
+	}
+	s.mu.RUnlock()
+
+	if status.Role == domain.RoleStandby {
+		cursor, err := s.loadCursor()
+		if err != nil {
+			return nil, err
+		}
+		status.Cursor = cursor
+	}
+
+	return status, nil
+}
+
+// Stream sends the changes after cursor to a standby until the context is
+// cancelled or send fails. Heartbeats are sent while nothing changes so the
+// standby can tell a quiet node from a dead connection.
+func (s *ReplicationService) Stream(ctx context.Context, remote string, cursor domain.ReplicationCursor, send func(domain.ReplicationMessage) error) error {
+	if s.IsStandby() {
+		return ErrStandby
+	}
+
+	s.mu.Lock()
+	s.standbys[remote] = &domain.StandbyInfo{Remote: remote, ConnectedAt: time.Now(), Cursor: cursor}
+	s.mu.Unlock()
+	s.logger.Info("Standby connected", "standby", remote)
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.standbys, remote)
+		s.mu.Unlock()
+		s.logger.Info("Standby disconnected", "standby", remote)
+	}()
+
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	fingerprint := ""
+	lastSent := time.Now()
+	for {
+		msg, more, err := s.changesSince(&cursor, &fingerprint)
+		if err != nil {
+			return err
+		}
+
+		if len(msg.Tables) > 0 {
+			if err := send(msg); err != nil {
+				return err
+			}
+			lastSent = time.Now()
+
+			s.mu.Lock()
+			if standby, ok := s.standbys[remote]; ok {
+				standby.Cursor = cursor
+			}
+			s.mu.Unlock()
+		} else if time.Since(lastSent) >= s.cfg.Heartbeat {
+			if err := send(domain.ReplicationMessage{Type: "heartbeat", SentAt: time.Now()}); err != nil {
+				return err
+			}
+			lastSent = time.Now()
+		}
+
+		// A full batch means more records are waiting; send them right away
+		if more {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// changesSince collects the next rows to send after cursor and, when their
+// contents changed since fingerprint, the metadata tables. Both are advanced
+// to what the message contains. A cursor into another log, or into entries
+// already pruned, starts a full copy of the replicated tables. more reports
+// that further rows are waiting.
+func (s *ReplicationService) changesSince(cursor *domain.ReplicationCursor, fingerprint *string) (domain.ReplicationMessage, bool, error) {
+	msg := domain.ReplicationMessage{Type: "changes", SentAt: time.Now()}
+	next := *cursor
+
+	s.mu.RLock()
+	logID := s.logID
+	s.mu.RUnlock()
+
+	var oldest, last sql.NullInt64
+	err := s.reads.QueryRow(`
+		SELECT (SELECT MIN(seq) FROM replication_log),
+			(SELECT seq FROM sqlite_sequence WHERE name = 'replication_log')
+	`).Scan(&oldest, &last)
+	if err != nil {
+		return msg, false, fmt.Errorf("failed to read replication log: %w", err)
+	}
+
+	// Entries after the cursor are gone when the log starts past the next one
+	pruned := next.Seq < last.Int64 && (!oldest.Valid || oldest.Int64 > next.Seq+1)
+	if next.Log != logID || pruned || (next.Table != "" && !slices.Contains(replicatedRows, next.Table)) {
+		next = domain.ReplicationCursor{Log: logID, Seq: last.Int64, Table: replicatedRows[0]}
+	}
+
+	more := false
+	if next.Table != "" {
+		rows, err := s.copyBatch(&next)
+		if err != nil {
+			return msg, false, err
+		}
+		msg.Tables = append(msg.Tables, *rows)
+		more = true
+	} else {
+		rows, full, err := s.logBatch(&next)
+		if err != nil {
+			return msg, false, err
+		}
+		msg.Tables = append(msg.Tables, rows...)
+		more = full
+	}
+
+	metadata := []domain.ReplicatedTable{}
+	for _, table := range replicatedMetadata {
+		snapshot, err := dumpTable(s.reads, table, "")
+		if err != nil {
+			return msg, false, err
+		}
+		snapshot.Replace = true
+		metadata = append(metadata, *snapshot)
+	}
+
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return msg, false, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	sum := sha256.Sum256(encoded)
+	if current := hex.EncodeToString(sum[:]); current != *fingerprint {
+		msg.Tables = append(msg.Tables, metadata...)
+		*fingerprint = current
+	}
+
+	*cursor = next
+	msg.Cursor = &next
+	return msg, more, nil
+}
+
+// copyBatch reads the next rows of the table a full copy has reached and
+// moves the cursor past them, on to the next table once one is done. The
+// first batch of a table replaces what the standby has.
+func (s *ReplicationService) copyBatch(cursor *domain.ReplicationCursor) (*domain.ReplicatedTable, error) {
+	rows, err := dumpTable(s.reads, cursor.Table, "WHERE id > ? ORDER BY id LIMIT ?", cursor.Key, replicationBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	rows.Replace = cursor.Key == ""
+
+	if len(rows.Rows) == replicationBatchSize {
+		id := slices.Index(rows.Columns, "id")
+		cursor.Key = fmt.Sprint(rows.Rows[len(rows.Rows)-1][id])
+		return rows, nil
+	}
+
+	cursor.Key = ""
+	if i := slices.Index(replicatedRows, cursor.Table); i+1 < len(replicatedRows) {
+		cursor.Table = replicatedRows[i+1]
+	} else {
+		cursor.Table = ""
+	}
+	return rows, nil
+}
+
+// logBatch reads the next entries of the replication log and returns the
+// rows they name as they were at the last one; rows no longer there are sent
+// as deleted. full reports a full batch of entries.
+func (s *ReplicationService) logBatch(cursor *domain.ReplicationCursor) ([]domain.ReplicatedTable, bool, error) {
+	// One read transaction sees the log and the rows at the same point, so
+	// the standby never holds a mix of rows that break a unique index
+	tx, err := s.reads.Begin()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	entries, err := tx.Query("SELECT seq, table_name, row_id FROM replication_log WHERE seq > ? ORDER BY seq LIMIT ?", cursor.Seq, replicationBatchSize)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query replication log: %w", err)
+	}
+	defer entries.Close()
+
+	changed := make(map[string][]string)
+	count := 0
+	for entries.Next() {
+		var (
+			seq       int64
+			table, id string
+		)
+		if err := entries.Scan(&seq, &table, &id); err != nil {
+			return nil, false, fmt.Errorf("failed to scan replication log: %w", err)
+		}
+		count++
+		cursor.Seq = seq
+		if !slices.Contains(changed[table], id) {
+			changed[table] = append(changed[table], id)
+		}
+	}
+	if err := entries.Err(); err != nil {
+		return nil, false, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	tables := []domain.ReplicatedTable{}
+	for _, table := range replicatedRows {
+		ids := changed[table]
+		if len(ids) == 0 {
+			continue
+		}
+		args := make([]interface{}, len(ids))
+		for i, id := range ids {
+			args[i] = id
+		}
+		rows, err := dumpTable(tx, table, "WHERE id IN (?"+strings.Repeat(", ?", len(ids)-1)+")", args...)
+		if err != nil {
+			return nil, false, err
+		}
+
+		found := make(map[string]bool)
+		column := slices.Index(rows.Columns, "id")
+		for _, row := range rows.Rows {
+			found[fmt.Sprint(row[column])] = true
+		}
+		for _, id := range ids {
+			if !found[id] {
+				rows.Deleted = append(rows.Deleted, id)
+			}
+		}
+		tables = append(tables, *rows)
+	}
+
+	return tables, count == replicationBatchSize, nil
+}
+
+// pruneLoop removes the replication log entries older than its retention,
+// hourly
+func (s *ReplicationService) pruneLoop() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		cutoff := time.Now().Add(-replicationLogRetention).UTC().Format(changeTimeFormat)
+		result, err := s.db.Exec("DELETE FROM replication_log WHERE logged_at < ?", cutoff)
+		if err != nil {
+			s.logger.Error("Failed to prune replication log", "error", err)
+		} else if n, _ := result.RowsAffected(); n > 0 {
+			s.logger.Info("Pruned replication log", "entries", n, "retention", replicationLogRetention)
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dumpTable reads the rows of a table matching clause. Columns are read as
+// their stored values (the unary plus drops the declared type), so
+// timestamps travel in exactly the format they are stored in.
+func dumpTable(db querier, table, clause string, args ...interface{}) (*domain.ReplicatedTable, error) {
+	columns, err := tableColumns(db, table)
+	if err != nil {
+		return nil, err
+	}
+
+	selects := make([]string, len(columns))
+	for i, column := range columns {
+		selects[i] = fmt.Sprintf(`+"%s"`, column)
+	}
+
+	rows, err := db.Query("SELECT "+strings.Join(selects, ", ")+" FROM "+table+" "+clause, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	result := &domain.ReplicatedTable{Name: table, Columns: columns, Rows: [][]interface{}{}}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", table, err)
+		}
+		for i, value := range values {
+			if b, ok := value.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return result, nil
+}
+
+// follow keeps a standby connected to the active node until the context is
+// cancelled, reconnecting after failures
+func (s *ReplicationService) follow(ctx context.Context) {
+	s.logger.Info("Following active node", "primary", s.cfg.PrimaryURL)
+
+	for {
+		err := s.pull(ctx)
+		if ctx.Err() != nil {
+			s.logger.Info("Stopped following the active node")
+			return
+		}
+
+		s.mu.Lock()
+		s.connected = false
+		if err != nil {
+			s.lastError = err.Error()
+		}
+		s.mu.Unlock()
+		s.logger.Error("Connection to active node lost", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(replicationRetry):
+		}
+	}
+}
+
+// pull reads the replication stream from the active node and applies each
+// message. It returns when the stream ends or goes silent for three
+// heartbeat intervals.
+func (s *ReplicationService) pull(ctx context.Context) error {
+	cursor, err := s.loadCursor()
+	if err != nil {
+		return err
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watchdog := time.AfterFunc(3*s.cfg.Heartbeat, cancel)
+	defer watchdog.Stop()
+
+	query := url.Values{}
+	query.Set("log", cursor.Log)
+	query.Set("seq", strconv.FormatInt(cursor.Seq, 10))
+	if cursor.Table != "" {
+		query.Set("table", cursor.Table)
+		query.Set("key", cursor.Key)
+	}
+
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet,
+		strings.TrimRight(s.cfg.PrimaryURL, "/")+"/api/v1/replication/stream?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if s.cfg.APIKey != "" {
+		req.Header.Set("X-API-Key", s.cfg.APIKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("active node returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	s.mu.Lock()
+	s.connected = true
+	s.lastError = ""
+	s.mu.Unlock()
+	s.logger.Info("Connected to active node", "seq", cursor.Seq, "copying", cursor.Table)
+
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	for {
+		var msg domain.ReplicationMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("stream closed by active node")
+			}
+			return fmt.Errorf("failed to read stream: %w", err)
+		}
+		watchdog.Reset(3 * s.cfg.Heartbeat)
+
+		if msg.Type == "changes" {
+			if err := s.apply(msg); err != nil {
+				return err
+			}
+		}
+
+		s.mu.Lock()
+		s.lastMessage = time.Now()
+		s.mu.Unlock()
+	}
+}
+
+// apply writes a changes message and the new cursor in one transaction.
+// Columns the local schema does not have are dropped, so a standby running
+// an older version keeps what it can store.
+func (s *ReplicationService) apply(msg domain.ReplicationMessage) error {
+	// Look up the local columns first: the writer pool may have a single
+	// connection, which the transaction below holds
+	local := make(map[string][]string)
+	for _, table := range msg.Tables {
+		if !slices.Contains(replicatedRows, table.Name) && !slices.Contains(replicatedMetadata, table.Name) {
+			return fmt.Errorf("unexpected table %q in replication stream", table.Name)
+		}
+		columns, err := tableColumns(s.db, table.Name)
+		if err != nil {
+			return err
+		}
+		local[table.Name] = columns
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range msg.Tables {
+		if table.Replace {
+			if _, err := tx.Exec("DELETE FROM " + table.Name); err != nil {
+				return fmt.Errorf("failed to clear %s: %w", table.Name, err)
+			}
+		}
+		for _, id := range table.Deleted {
+			if _, err := tx.Exec("DELETE FROM "+table.Name+" WHERE id = ?", id); err != nil {
+				return fmt.Errorf("failed to delete %s row: %w", table.Name, err)
+			}
+		}
+
+		keep := []int{}
+		names := []string{}
+		updates := []string{}
+		for i, column := range table.Columns {
+			if slices.Contains(local[table.Name], column) {
+				keep = append(keep, i)
+				names = append(names, `"`+column+`"`)
+				if column != "id" {
+					updates = append(updates, fmt.Sprintf(`"%[1]s" = excluded."%[1]s"`, column))
+				}
+			}
+		}
+		if len(keep) == 0 || len(table.Rows) == 0 {
+			continue
+		}
+
+		// Rows followed through the log are updated in place, so the change
+		// feed of the standby sees an update rather than a new record. A row
+		// in the way of another unique index is out of date and replaced; its
+		// current state follows from the log. Metadata snapshots replace
+		// their rows outright.
+		query := fmt.Sprintf("INSERT OR REPLACE INTO %s (%s) VALUES (%s)", table.Name,
+			strings.Join(names, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(keep)), ", "))
+		if slices.Contains(replicatedRows, table.Name) && len(updates) > 0 {
+			query += " ON CONFLICT(id) DO UPDATE SET " + strings.Join(updates, ", ")
+		}
+		stmt, err := tx.Prepare(query)
+		if err != nil {
+			return fmt.Errorf("failed to prepare %s insert: %w", table.Name, err)
+		}
+
+		for _, row := range table.Rows {
+			values := make([]interface{}, len(keep))
+			for i, index := range keep {
+				if index < len(row) {
+					values[i] = row[index]
+				}
+			}
+			if _, err := stmt.Exec(values...); err != nil {
+				stmt.Close()
+				return fmt.Errorf("failed to apply %s row: %w", table.Name, err)
+			}
+		}
+		stmt.Close()
+	}
+
+	if msg.Cursor != nil {
+		_, err := tx.Exec(`
+			INSERT OR REPLACE INTO replication_state (key, value)
+			VALUES ('cursor_log', ?), ('cursor_seq', ?), ('cursor_table', ?), ('cursor_key', ?)
+		`, msg.Cursor.Log, strconv.FormatInt(msg.Cursor.Seq, 10), msg.Cursor.Table, msg.Cursor.Key)
+		if err != nil {
+			return fmt.Errorf("failed to save cursor: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit replicated changes: %w", err)
+	}
+
+	return nil
+}
+
+// loadCursor returns how far this node has replicated
+func (s *ReplicationService) loadCursor() (*domain.ReplicationCursor, error) {
+	rows, err := s.reads.Query("SELECT key, value FROM replication_state")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query replication state: %w", err)
+	}
+	defer rows.Close()
+
+	cursor := &domain.ReplicationCursor{}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan replication state: %w", err)
+		}
+		switch key {
+		case "cursor_log":
+			cursor.Log = value
+		case "cursor_seq":
+			cursor.Seq, _ = strconv.ParseInt(value, 10, 64)
+		case "cursor_table":
+			cursor.Table = value
+		case "cursor_key":
+			cursor.Key = value
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return cursor, nil
+}
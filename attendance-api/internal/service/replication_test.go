@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"attendance-api/internal/client"
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+)
+
+// newTestReplicationNode opens a node with the replicated tables and a
+// replication service in the given role, which is not started
+func newTestReplicationNode(t *testing.T, faces client.Recognizer, role string) (*AttendanceService, *ReplicationService) {
+	t.Helper()
+
+	s := newTestAttendanceService(t, faces, config.AttendanceConfig{})
+	if _, err := NewAuditService(s.db, s.reads); err != nil {
+		t.Fatal(err)
+	}
+	// Metadata tables of services the test does not start
+	for _, table := range replicatedMetadata {
+		if _, err := s.db.Exec("CREATE TABLE IF NOT EXISTS " + table + " (id TEXT PRIMARY KEY)"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := NewReplicationService(s.db, s.reads, config.ReplicationConfig{
+		Role: role, PrimaryURL: "http://active.invalid", Interval: time.Second, Heartbeat: time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Close)
+	return s, r
+}
+
+// replicate applies the stream of the active node to the standby until it
+// has caught up, as the standby's follow loop would
+func replicate(t *testing.T, active, standby *ReplicationService) {
+	t.Helper()
+
+	cursor, err := standby.loadCursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := ""
+	for {
+		msg, more, err := active.changesSince(cursor, &fingerprint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := standby.apply(msg); err != nil {
+			t.Fatal(err)
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+// assertReplicated compares the rows of the replicated tables on both nodes
+func assertReplicated(t *testing.T, active, standby *AttendanceService) {
+	t.Helper()
+
+	for _, table := range replicatedRows {
+		want, err := dumpTable(active.reads, table, "ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := dumpTable(standby.reads, table, "ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got.Rows, want.Rows) {
+			t.Errorf("%s: standby has %d rows, active node %d, or they differ", table, len(got.Rows), len(want.Rows))
+		}
+	}
+}
+
+// Inserts, updates and deletes of any replicated row reach the standby, in
+// batches larger than one message, including a row stored under the rowid
+// of one deleted before
+func TestReplicationFollowsChanges(t *testing.T) {
+	active, activeReplication := newTestReplicationNode(t, nil, domain.RoleActive)
+	standby, standbyReplication := newTestReplicationNode(t, nil, domain.RoleStandby)
+
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if _, err := active.db.Exec(query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert := func(id, name string) {
+		t.Helper()
+		exec("INSERT INTO attendance (id, name, confidence, timestamp, status) VALUES (?, ?, ?, ?, ?)",
+			id, name, 90.0, time.Now(), "authorized")
+	}
+
+	for i := 0; i < 2*replicationBatchSize+20; i++ {
+		insert(fmt.Sprintf("r%04d", i), "alice")
+	}
+	exec("INSERT INTO attendance_sessions (id, name, day, check_in, last_event) VALUES (?, ?, ?, ?, ?)",
+		"s1", "alice", "2024-01-15", time.Now(), time.Now())
+	replicate(t, activeReplication, standbyReplication)
+	assertReplicated(t, active, standby)
+
+	exec("UPDATE attendance SET name = ? WHERE id = ?", "bob", "r0001")
+	exec("UPDATE attendance SET id = ? WHERE id = ?", "r9999", "r0002")
+	exec("DELETE FROM attendance WHERE id = ?", "r0003")
+	exec("UPDATE attendance_sessions SET check_out = ? WHERE id = ?", time.Now(), "s1")
+	// Without AUTOINCREMENT the new row takes the rowid of the deleted last one
+	exec("DELETE FROM attendance WHERE id = ?", fmt.Sprintf("r%04d", 2*replicationBatchSize+19))
+	insert("r5000", "carol")
+	replicate(t, activeReplication, standbyReplication)
+	assertReplicated(t, active, standby)
+
+	var name string
+	if err := standby.db.QueryRow("SELECT name FROM attendance WHERE id = 'r0001'").Scan(&name); err != nil || name != "bob" {
+		t.Errorf("updated record on the standby: name %q, error %v, want bob", name, err)
+	}
+}
+
+// A standby whose cursor points into pruned entries, or into the log of
+// another node, copies the replicated tables in full, dropping rows the
+// active node no longer has
+func TestReplicationCopiesInFull(t *testing.T) {
+	active, activeReplication := newTestReplicationNode(t, nil, domain.RoleActive)
+	standby, standbyReplication := newTestReplicationNode(t, nil, domain.RoleStandby)
+
+	insert := func(db *AttendanceService, id string) {
+		t.Helper()
+		if _, err := db.db.Exec("INSERT INTO attendance (id, name, confidence, timestamp, status) VALUES (?, ?, ?, ?, ?)",
+			id, "alice", 90.0, time.Now(), "authorized"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	insert(active, "r1")
+	replicate(t, activeReplication, standbyReplication)
+
+	insert(active, "r2")
+	insert(active, "r3")
+	if _, err := active.db.Exec("DELETE FROM replication_log WHERE seq < (SELECT MAX(seq) FROM replication_log)"); err != nil {
+		t.Fatal(err)
+	}
+	insert(standby, "stray")
+	replicate(t, activeReplication, standbyReplication)
+	assertReplicated(t, active, standby)
+
+	// A standby of the old active node follows a promoted one from scratch
+	follower, followerReplication := newTestReplicationNode(t, nil, domain.RoleStandby)
+	replicate(t, activeReplication, followerReplication)
+	insert(follower, "stray")
+	if err := standbyReplication.Promote(); err != nil {
+		t.Fatal(err)
+	}
+	insert(standby, "r4")
+	replicate(t, standbyReplication, followerReplication)
+	assertReplicated(t, standby, follower)
+}
+
+// Removing a face with its history deleted or anonymized erases the records
+// and sessions on the standby too
+func TestReplicationErasesRemovedFaces(t *testing.T) {
+	ctx := context.Background()
+	faces := client.NewFakeRecognizer()
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := faces.AddFace(ctx, name, [][]byte{[]byte(name + "-photo")}, []string{name + ".jpg"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	active, activeReplication := newTestReplicationNode(t, faces, domain.RoleActive)
+	standby, standbyReplication := newTestReplicationNode(t, nil, domain.RoleStandby)
+
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := active.RecordAttendance(ctx, domain.AttendanceSubmission{ImageData: []byte(name + "-photo"), Filename: "frame.jpg"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	replicate(t, activeReplication, standbyReplication)
+
+	count := func(table, name string) int {
+		t.Helper()
+		var n int
+		if err := standby.reads.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE name = ?", name).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	for _, name := range []string{"alice", "bob"} {
+		if count("attendance", name) != 1 || count("attendance_sessions", name) != 1 {
+			t.Fatalf("standby lacks the record or session of %s before the removal", name)
+		}
+	}
+
+	if _, err := active.RemoveFace(ctx, "alice", domain.HistoryDelete); err != nil {
+		t.Fatal(err)
+	}
+	removal, err := active.RemoveFace(ctx, "bob", domain.HistoryAnonymize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicate(t, activeReplication, standbyReplication)
+	assertReplicated(t, active, standby)
+
+	for _, table := range []string{"attendance", "attendance_sessions"} {
+		if n := count(table, "alice"); n != 0 {
+			t.Errorf("standby keeps %d %s rows of alice after deleting the history", n, table)
+		}
+		if n := count(table, "bob"); n != 0 {
+			t.Errorf("standby keeps %d %s rows under the name of bob after anonymizing the history", n, table)
+		}
+		if n := count(table, removal.AnonymizedAs); n != 1 {
+			t.Errorf("standby has %d %s rows under %s, want the anonymized one", n, table, removal.AnonymizedAs)
+		}
+	}
+}
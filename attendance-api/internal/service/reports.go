@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"attendance-api/internal/domain"
+)
+
+// securityReportLimit caps the number of records listed per category
+const securityReportLimit = 1000
+
+// GetSecurityReport collects unauthorized attempts and misplaced
+// recognitions between from and to. Events from devices in soft-launch mode
+// are included and counted separately, since no door acted on them.
+func (s *AttendanceService) GetSecurityReport(from, to time.Time) (*domain.SecurityReport, error) {
+	report := &domain.SecurityReport{From: from, To: to}
+
+	err := s.reads.QueryRow(`
+		SELECT
+			COALESCE(SUM(status = 'unauthorized'), 0),
+			COALESCE(SUM(misplaced = 1), 0),
+			COALESCE(SUM(observe_only = 1 AND (status = 'unauthorized' OR misplaced = 1)), 0)
+		FROM attendance
+		WHERE timestamp >= ? AND timestamp < ?
+	`, from, to).Scan(&report.UnauthorizedAttempts, &report.MisplacedRecognitions, &report.ObserveOnlyEvents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count security events: %w", err)
+	}
+
+	report.Unauthorized, err = s.queryRecords(`
+		WHERE status = 'unauthorized' AND timestamp >= ? AND timestamp < ?
+		ORDER BY timestamp DESC
+		LIMIT ?
+	`, from, to, securityReportLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Misplaced, err = s.queryRecords(`
+		WHERE misplaced = 1 AND timestamp >= ? AND timestamp < ?
+		ORDER BY timestamp DESC
+		LIMIT ?
+	`, from, to, securityReportLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// GetAbsenceReport lists who of the enrolled people was never recognized on
+// day. Enrollment comes from the face API, or from the local people table when
+// filtering by department or group or when the face API is unreachable.
+// Non-workdays report nobody absent, and people whose shifts do not cover the
+// weekday are listed separately instead of as absent.
+func (s *AttendanceService) GetAbsenceReport(ctx context.Context, day time.Time, filter domain.GroupFilter) (*domain.AbsenceReport, error) {
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, s.cfg.Timezone)
+
+	days, err := s.calendar.GetCalendar(day, day)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &domain.AbsenceReport{
+		Date:    days[0].Date,
+		Workday: days[0].Workday,
+		Holiday: days[0].Holiday,
+		Absent:  []string{},
+	}
+	if !report.Workday {
+		return report, nil
+	}
+
+	enrolled, source, err := s.enrolledNames(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	report.Source = source
+
+	present, err := s.presentNames(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	shifts, err := s.ListShifts("")
+	if err != nil {
+		return nil, err
+	}
+	scheduled := make(map[string]bool) // name -> has a shift on this weekday
+	for _, shift := range shifts {
+		scheduled[shift.Name] = scheduled[shift.Name] || shift.WorksOn(day.Weekday())
+	}
+
+	for _, name := range enrolled {
+		if works, hasShifts := scheduled[name]; hasShifts && !works {
+			report.OffShift = append(report.OffShift, name)
+			continue
+		}
+
+		report.Expected++
+		if present[name] {
+			report.Present++
+		} else {
+			report.Absent = append(report.Absent, name)
+		}
+	}
+
+	return report, nil
+}
+
+// enrolledNames returns the sorted names of the enrolled people who are
+// active, and where they were taken from
+func (s *AttendanceService) enrolledNames(ctx context.Context, filter domain.GroupFilter) ([]string, string, error) {
+	names := []string{}
+
+	if filter.IsEmpty() {
+		faces, err := s.faceClient.GetFaces(ctx)
+		if err == nil {
+			inactive, err := s.inactiveNames()
+			if err != nil {
+				return nil, "", err
+			}
+			for _, face := range faces {
+				if !inactive[face.Name] {
+					names = append(names, face.Name)
+				}
+			}
+			sort.Strings(names)
+			return names, "face_api", nil
+		}
+		s.logger.Warn("Face API unavailable, using the people table", "error", err)
+	}
+
+	people, err := s.ListPeople(filter)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, person := range people {
+		if person.Active {
+			names = append(names, person.Name)
+		}
+	}
+	sort.Strings(names)
+
+	return names, "people", nil
+}
+
+// presentNames returns the people with an authorized recognition between
+// from and to
+func (s *AttendanceService) presentNames(from, to time.Time) (map[string]bool, error) {
+	rows, err := s.reads.Query(`
+		SELECT DISTINCT name
+		FROM attendance
+		WHERE status = 'authorized' AND timestamp >= ? AND timestamp < ?
+	`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query present people: %w", err)
+	}
+	defer rows.Close()
+
+	present := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan name: %w", err)
+		}
+		present[name] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return present, nil
+}
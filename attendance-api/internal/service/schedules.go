@@ -0,0 +1,274 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"attendance-api/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrScheduleNotFound = errors.New("door schedule not found")
+	ErrInvalidSchedule  = errors.New("invalid door schedule")
+)
+
+// modeRank orders the door modes by how restrictive they are
+var modeRank = map[string]int{
+	domain.DoorUnlocked: 0,
+	domain.DoorFaceOnly: 1,
+	domain.DoorLocked:   2,
+}
+
+func (s *AttendanceService) initScheduleSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS door_schedules (
+		id TEXT PRIMARY KEY,
+		door TEXT NOT NULL,
+		name TEXT NOT NULL,
+		mode TEXT NOT NULL,
+		start_time TEXT NOT NULL,
+		end_time TEXT NOT NULL,
+		weekdays TEXT NOT NULL,
+		holidays INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_door_schedules_door ON door_schedules(door);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute door schedule schema: %w", err)
+	}
+
+	return nil
+}
+
+const scheduleColumns = "id, door, name, mode, start_time, end_time, weekdays, holidays, created_at"
+
+// ListDoorSchedules returns all door schedules, or only those of one door
+// when door is set
+func (s *AttendanceService) ListDoorSchedules(door string) ([]domain.DoorSchedule, error) {
+	rows, err := s.db.Query(`
+		SELECT `+scheduleColumns+`
+		FROM door_schedules
+		WHERE ? = '' OR door = ?
+		ORDER BY door, holidays DESC, start_time
+	`, door, door)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query door schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := []domain.DoorSchedule{}
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *schedule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return schedules, nil
+}
+
+func (s *AttendanceService) GetDoorSchedule(id string) (*domain.DoorSchedule, error) {
+	schedule, err := scanSchedule(s.db.QueryRow("SELECT "+scheduleColumns+" FROM door_schedules WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrScheduleNotFound
+	}
+	return schedule, err
+}
+
+func (s *AttendanceService) CreateDoorSchedule(schedule domain.DoorSchedule) (*domain.DoorSchedule, error) {
+	if err := validateSchedule(&schedule); err != nil {
+		return nil, err
+	}
+
+	schedule.ID = uuid.New().String()
+	schedule.CreatedAt = time.Now()
+
+	_, err := s.db.Exec(`
+		INSERT INTO door_schedules (id, door, name, mode, start_time, end_time, weekdays, holidays, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, schedule.ID, schedule.Door, schedule.Name, schedule.Mode, schedule.Start, schedule.End,
+		joinWeekdays(schedule.Weekdays), schedule.Holidays, schedule.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert door schedule: %w", err)
+	}
+
+	return &schedule, nil
+}
+
+// UpdateDoorSchedule replaces every field of an existing door schedule
+func (s *AttendanceService) UpdateDoorSchedule(id string, schedule domain.DoorSchedule) (*domain.DoorSchedule, error) {
+	existing, err := s.GetDoorSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSchedule(&schedule); err != nil {
+		return nil, err
+	}
+
+	schedule.ID = existing.ID
+	schedule.CreatedAt = existing.CreatedAt
+
+	_, err = s.db.Exec(`
+		UPDATE door_schedules SET door = ?, name = ?, mode = ?, start_time = ?, end_time = ?, weekdays = ?, holidays = ?
+		WHERE id = ?
+	`, schedule.Door, schedule.Name, schedule.Mode, schedule.Start, schedule.End,
+		joinWeekdays(schedule.Weekdays), schedule.Holidays, schedule.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update door schedule: %w", err)
+	}
+
+	return &schedule, nil
+}
+
+func (s *AttendanceService) DeleteDoorSchedule(id string) error {
+	result, err := s.db.Exec("DELETE FROM door_schedules WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete door schedule: %w", err)
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrScheduleNotFound
+	}
+
+	return nil
+}
+
+// activeSchedule returns the schedule of a door in effect at t, nil when
+// the door is face-only. Where windows overlap the most restrictive mode
+// wins, so a holiday rule keeping the door locked overrides the weekday
+// rule that would unlock it.
+func (s *AttendanceService) activeSchedule(door string, t time.Time) (*domain.DoorSchedule, error) {
+	if door == "" {
+		return nil, nil
+	}
+
+	schedules, err := s.ListDoorSchedules(door)
+	if err != nil || len(schedules) == 0 {
+		return nil, err
+	}
+
+	// An overnight window may have started the day before
+	days, err := s.calendar.GetCalendar(t.AddDate(0, 0, -1), t)
+	if err != nil {
+		return nil, err
+	}
+	holiday := func(day time.Time) bool {
+		for _, d := range days {
+			if d.Date == day.Format(dayFormat) {
+				return d.Holiday != ""
+			}
+		}
+		return false
+	}
+
+	var active *domain.DoorSchedule
+	for i, schedule := range schedules {
+		if !scheduleActive(schedule, t, holiday) {
+			continue
+		}
+		if active == nil || modeRank[schedule.Mode] > modeRank[active.Mode] {
+			active = &schedules[i]
+		}
+	}
+	return active, nil
+}
+
+// scheduleActive reports whether t falls within the schedule's window
+func scheduleActive(schedule domain.DoorSchedule, t time.Time, holiday func(time.Time) bool) bool {
+	appliesOn := func(day time.Time) bool {
+		if schedule.Holidays {
+			return holiday(day)
+		}
+		return domain.Shift{Weekdays: schedule.Weekdays}.WorksOn(day.Weekday())
+	}
+
+	start, end := atClock(t, schedule.Start), atClock(t, schedule.End)
+	switch {
+	case start.Equal(end):
+		return appliesOn(t)
+	case start.Before(end):
+		return !t.Before(start) && t.Before(end) && appliesOn(t)
+	case !t.Before(start):
+		return appliesOn(t)
+	case t.Before(end):
+		return appliesOn(t.AddDate(0, 0, -1))
+	}
+	return false
+}
+
+func scanSchedule(row rowScanner) (*domain.DoorSchedule, error) {
+	var schedule domain.DoorSchedule
+	var weekdays string
+
+	err := row.Scan(&schedule.ID, &schedule.Door, &schedule.Name, &schedule.Mode, &schedule.Start, &schedule.End,
+		&weekdays, &schedule.Holidays, &schedule.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan door schedule: %w", err)
+	}
+
+	schedule.Weekdays = []int{}
+	for _, day := range strings.Split(weekdays, ",") {
+		if n, err := strconv.Atoi(day); err == nil {
+			schedule.Weekdays = append(schedule.Weekdays, n)
+		}
+	}
+
+	return &schedule, nil
+}
+
+func validateSchedule(schedule *domain.DoorSchedule) error {
+	if !doorIDPattern.MatchString(schedule.Door) {
+		return fmt.Errorf("%w: door must be a door id", ErrInvalidSchedule)
+	}
+	if _, ok := modeRank[schedule.Mode]; !ok {
+		return fmt.Errorf("%w: mode must be unlocked, face or locked", ErrInvalidSchedule)
+	}
+	schedule.Name = strings.TrimSpace(schedule.Name)
+	if schedule.Name == "" {
+		schedule.Name = schedule.Mode
+	}
+
+	// Without a window the schedule holds all day
+	if schedule.Start == "" && schedule.End == "" {
+		schedule.Start, schedule.End = "00:00", "00:00"
+	}
+	if _, err := time.Parse(clockFormat, schedule.Start); err != nil {
+		return fmt.Errorf("%w: start must be HH:MM", ErrInvalidSchedule)
+	}
+	if _, err := time.Parse(clockFormat, schedule.End); err != nil {
+		return fmt.Errorf("%w: end must be HH:MM", ErrInvalidSchedule)
+	}
+
+	if schedule.Weekdays == nil {
+		schedule.Weekdays = []int{}
+	}
+	for _, day := range schedule.Weekdays {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("%w: weekdays must be between 0 (Sunday) and 6 (Saturday)", ErrInvalidSchedule)
+		}
+	}
+	if schedule.Holidays && len(schedule.Weekdays) > 0 {
+		return fmt.Errorf("%w: a holiday schedule has no weekdays", ErrInvalidSchedule)
+	}
+	sort.Ints(schedule.Weekdays)
+
+	return nil
+}
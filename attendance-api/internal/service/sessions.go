@@ -0,0 +1,150 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"attendance-api/internal/domain"
+)
+
+const dayFormat = "2006-01-02"
+
+func (s *AttendanceService) initSessionSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS attendance_sessions (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		day TEXT NOT NULL,
+		check_in DATETIME NOT NULL,
+		check_out DATETIME,
+		last_event DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_sessions_name_day ON attendance_sessions(name, day);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute session schema: %w", err)
+	}
+
+	return nil
+}
+
+// trackSession applies the configured session rule to a recognition of an
+// authorized person and returns the resulting event type, or "" when the
+// recognition does not change the session (too close to the previous one).
+func (s *AttendanceService) trackSession(name string, ts time.Time) (string, error) {
+	day := ts.Format(dayFormat)
+
+	var (
+		id        string
+		checkOut  sql.NullTime
+		lastEvent time.Time
+	)
+	err := s.db.QueryRow(`
+		SELECT id, check_out, last_event
+		FROM attendance_sessions
+		WHERE name = ? AND day = ?
+		ORDER BY check_in DESC
+		LIMIT 1
+	`, name, day).Scan(&id, &checkOut, &lastEvent)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		// First recognition of the day
+		return domain.EventCheckIn, s.openSession(name, day, ts)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query session: %w", err)
+	}
+
+	if ts.Sub(lastEvent) < s.thresholds.Load().SessionMinGap {
+		return "", nil
+	}
+
+	switch s.cfg.SessionMode {
+	case "gap":
+		// One session per day, the latest sighting is the check-out
+		if err := s.closeSession(id, ts); err != nil {
+			return "", err
+		}
+		return domain.EventCheckOut, nil
+	default:
+		if checkOut.Valid {
+			return domain.EventCheckIn, s.openSession(name, day, ts)
+		}
+		if err := s.closeSession(id, ts); err != nil {
+			return "", err
+		}
+		return domain.EventCheckOut, nil
+	}
+}
+
+func (s *AttendanceService) openSession(name, day string, ts time.Time) error {
+	_, err := s.db.Exec(`
+		INSERT INTO attendance_sessions (id, name, day, check_in, last_event)
+		VALUES (?, ?, ?, ?, ?)
+	`, s.newID(), name, day, ts, ts)
+	if err != nil {
+		return fmt.Errorf("failed to open session: %w", err)
+	}
+	return nil
+}
+
+func (s *AttendanceService) closeSession(id string, ts time.Time) error {
+	_, err := s.db.Exec("UPDATE attendance_sessions SET check_out = ?, last_event = ? WHERE id = ?", ts, ts, id)
+	if err != nil {
+		return fmt.Errorf("failed to close session: %w", err)
+	}
+	return nil
+}
+
+// GetWorkedHours returns the sessions of a person on a day (YYYY-MM-DD) and
+// the hours worked in the closed ones
+func (s *AttendanceService) GetWorkedHours(name, day string) (*domain.WorkedHours, error) {
+	rows, err := s.reads.Query(`
+		SELECT check_in, check_out
+		FROM attendance_sessions
+		WHERE name = ? AND day = ?
+		ORDER BY check_in ASC
+	`, name, day)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	result := &domain.WorkedHours{
+		Name:     name,
+		Date:     day,
+		Sessions: []domain.WorkSession{},
+	}
+
+	var worked time.Duration
+	for rows.Next() {
+		var (
+			session  domain.WorkSession
+			checkOut sql.NullTime
+		)
+		if err := rows.Scan(&session.CheckIn, &checkOut); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+
+		if checkOut.Valid {
+			session.CheckOut = &checkOut.Time
+			worked += checkOut.Time.Sub(session.CheckIn)
+		} else {
+			result.OpenSession = true
+		}
+		result.Sessions = append(result.Sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	result.WorkedHours = math.Round(worked.Hours()*100) / 100
+
+	return result, nil
+}
@@ -0,0 +1,312 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"attendance-api/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrShiftNotFound = errors.New("shift not found")
+	ErrInvalidShift  = errors.New("invalid shift")
+)
+
+const clockFormat = "15:04"
+
+func (s *AttendanceService) initShiftSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS shifts (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		start_time TEXT NOT NULL,
+		end_time TEXT NOT NULL,
+		weekdays TEXT NOT NULL,
+		grace_minutes INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_shifts_name ON shifts(name);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute shift schema: %w", err)
+	}
+
+	return nil
+}
+
+const shiftColumns = "id, name, start_time, end_time, weekdays, grace_minutes, created_at"
+
+// ListShifts returns all shifts, or only those of one person when name is set
+func (s *AttendanceService) ListShifts(name string) ([]domain.Shift, error) {
+	rows, err := s.db.Query(`
+		SELECT `+shiftColumns+`
+		FROM shifts
+		WHERE ? = '' OR name = ?
+		ORDER BY name, start_time
+	`, name, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shifts: %w", err)
+	}
+	defer rows.Close()
+
+	shifts := []domain.Shift{}
+	for rows.Next() {
+		shift, err := scanShift(rows)
+		if err != nil {
+			return nil, err
+		}
+		shifts = append(shifts, *shift)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return shifts, nil
+}
+
+func (s *AttendanceService) GetShift(id string) (*domain.Shift, error) {
+	shift, err := scanShift(s.db.QueryRow("SELECT "+shiftColumns+" FROM shifts WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrShiftNotFound
+	}
+	return shift, err
+}
+
+func (s *AttendanceService) CreateShift(shift domain.Shift) (*domain.Shift, error) {
+	if err := validateShift(&shift); err != nil {
+		return nil, err
+	}
+
+	shift.ID = uuid.New().String()
+	shift.CreatedAt = time.Now()
+
+	_, err := s.db.Exec(`
+		INSERT INTO shifts (id, name, start_time, end_time, weekdays, grace_minutes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, shift.ID, shift.Name, shift.Start, shift.End, joinWeekdays(shift.Weekdays), shift.GraceMinutes, shift.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert shift: %w", err)
+	}
+
+	return &shift, nil
+}
+
+// UpdateShift replaces every field of an existing shift
+func (s *AttendanceService) UpdateShift(id string, shift domain.Shift) (*domain.Shift, error) {
+	existing, err := s.GetShift(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateShift(&shift); err != nil {
+		return nil, err
+	}
+
+	shift.ID = existing.ID
+	shift.CreatedAt = existing.CreatedAt
+
+	_, err = s.db.Exec(`
+		UPDATE shifts SET name = ?, start_time = ?, end_time = ?, weekdays = ?, grace_minutes = ?
+		WHERE id = ?
+	`, shift.Name, shift.Start, shift.End, joinWeekdays(shift.Weekdays), shift.GraceMinutes, shift.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update shift: %w", err)
+	}
+
+	return &shift, nil
+}
+
+func (s *AttendanceService) DeleteShift(id string) error {
+	result, err := s.db.Exec("DELETE FROM shifts WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete shift: %w", err)
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrShiftNotFound
+	}
+
+	return nil
+}
+
+// applyShift fills in the punctuality fields of a session event. The first
+// check-in of the day is compared against the start of the person's shift,
+// a check-out against its end. People without a shift that day are left
+// untouched.
+func (s *AttendanceService) applyShift(record *domain.AttendanceRecord) error {
+	ts := record.Timestamp
+
+	switch record.EventType {
+	case domain.EventCheckIn:
+		var sessions int
+		err := s.db.QueryRow("SELECT COUNT(*) FROM attendance_sessions WHERE name = ? AND day = ?",
+			record.Name, ts.Format(dayFormat)).Scan(&sessions)
+		if err != nil {
+			return fmt.Errorf("failed to count sessions: %w", err)
+		}
+		if sessions > 1 {
+			return nil
+		}
+
+		shift, start, _, err := s.shiftOn(record.Name, ts)
+		if err != nil || shift == nil {
+			return err
+		}
+
+		lateness := 0
+		if ts.After(start) {
+			lateness = int(ts.Sub(start).Minutes())
+		}
+		record.LatenessMinutes = &lateness
+		record.Late = lateness > shift.GraceMinutes
+
+	case domain.EventCheckOut:
+		shift, start, end, err := s.shiftOn(record.Name, ts)
+		if err != nil {
+			return err
+		}
+		if shift == nil || ts.Before(start) {
+			// Possibly leaving an overnight shift that started the day before
+			shift, _, end, err = s.shiftOn(record.Name, ts.AddDate(0, 0, -1))
+			if err != nil || shift == nil {
+				return err
+			}
+		}
+
+		if ts.Before(end) {
+			record.EarlyLeaveMinutes = int(end.Sub(ts).Minutes())
+			record.EarlyLeave = record.EarlyLeaveMinutes > shift.GraceMinutes
+		}
+	}
+
+	return nil
+}
+
+// shiftOn returns the person's shift on the day of ts together with its
+// start and end on that day, or nil when they have none
+func (s *AttendanceService) shiftOn(name string, ts time.Time) (*domain.Shift, time.Time, time.Time, error) {
+	shifts, err := s.ListShifts(name)
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, err
+	}
+
+	for i := range shifts {
+		shift := &shifts[i]
+		if !shift.WorksOn(ts.Weekday()) {
+			continue
+		}
+
+		start := atClock(ts, shift.Start)
+		end := atClock(ts, shift.End)
+		if !end.After(start) {
+			// Overnight shift
+			end = end.AddDate(0, 0, 1)
+		}
+		return shift, start, end, nil
+	}
+
+	return nil, time.Time{}, time.Time{}, nil
+}
+
+// GetPunctuality summarizes lateness over every check-in evaluated against
+// a shift, optionally only for the members of a department or group
+func (s *AttendanceService) GetPunctuality(filter domain.GroupFilter) (*domain.PunctualitySummary, error) {
+	var (
+		summary    domain.PunctualitySummary
+		avgLateMin float64
+	)
+	where, args := groupClause(filter)
+	err := s.reads.QueryRow(`
+		SELECT COUNT(lateness_minutes), COALESCE(SUM(late), 0),
+		       COALESCE(AVG(lateness_minutes), 0), COALESCE(SUM(early_leave), 0)
+		FROM attendance
+		WHERE `+where, args...).Scan(&summary.CheckIns, &summary.Late, &avgLateMin, &summary.EarlyLeaves)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query punctuality: %w", err)
+	}
+
+	finishPunctuality(&summary, avgLateMin)
+	return &summary, nil
+}
+
+// finishPunctuality derives the rates of a summary from its counts
+func finishPunctuality(summary *domain.PunctualitySummary, avgLateMin float64) {
+	summary.OnTime = summary.CheckIns - summary.Late
+	summary.LatePercent = rate(summary.Late, summary.CheckIns)
+	summary.AvgLatenessMinutes = math.Round(avgLateMin*10) / 10
+}
+
+func scanShift(row rowScanner) (*domain.Shift, error) {
+	var (
+		shift    domain.Shift
+		weekdays string
+	)
+	err := row.Scan(&shift.ID, &shift.Name, &shift.Start, &shift.End, &weekdays, &shift.GraceMinutes, &shift.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan shift: %w", err)
+	}
+
+	shift.Weekdays = []int{}
+	for _, day := range strings.Split(weekdays, ",") {
+		if n, err := strconv.Atoi(day); err == nil {
+			shift.Weekdays = append(shift.Weekdays, n)
+		}
+	}
+
+	return &shift, nil
+}
+
+func validateShift(shift *domain.Shift) error {
+	shift.Name = strings.TrimSpace(shift.Name)
+	if shift.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidShift)
+	}
+	if _, err := time.Parse(clockFormat, shift.Start); err != nil {
+		return fmt.Errorf("%w: start must be HH:MM", ErrInvalidShift)
+	}
+	if _, err := time.Parse(clockFormat, shift.End); err != nil {
+		return fmt.Errorf("%w: end must be HH:MM", ErrInvalidShift)
+	}
+	if shift.GraceMinutes < 0 {
+		return fmt.Errorf("%w: grace_minutes cannot be negative", ErrInvalidShift)
+	}
+
+	if shift.Weekdays == nil {
+		shift.Weekdays = []int{}
+	}
+	for _, day := range shift.Weekdays {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("%w: weekdays must be between 0 (Sunday) and 6 (Saturday)", ErrInvalidShift)
+		}
+	}
+	sort.Ints(shift.Weekdays)
+
+	return nil
+}
+
+func joinWeekdays(weekdays []int) string {
+	parts := make([]string, len(weekdays))
+	for i, day := range weekdays {
+		parts[i] = strconv.Itoa(day)
+	}
+	return strings.Join(parts, ",")
+}
+
+// atClock returns the given HH:MM wall-clock time on the day of ts
+func atClock(ts time.Time, clock string) time.Time {
+	t, _ := time.Parse(clockFormat, clock)
+	return time.Date(ts.Year(), ts.Month(), ts.Day(), t.Hour(), t.Minute(), 0, 0, ts.Location())
+}
@@ -0,0 +1,432 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+)
+
+const (
+	siemDialTimeout  = 5 * time.Second
+	siemSendTimeout  = 10 * time.Second
+	siemDrainTimeout = 5 * time.Second
+
+	// syslogFacility is authpriv, where security messages belong
+	syslogFacility = 10
+)
+
+// securityEventNames are the CEF event names of each event type
+var securityEventNames = map[string]string{
+	domain.SecurityUnauthorized: "Unauthorized attendance attempt",
+	domain.SecurityMisplaced:    "Recognized at an unassigned location",
+	domain.SecurityAuthFailure:  "API authentication failure",
+	domain.SecurityAdminAction:  "Administrative action",
+}
+
+// cefKeys maps event fields to CEF extension keys. Custom keys (cs1, cn1,
+// cfp1, ...) are labelled with the field name.
+var cefKeys = map[string]string{
+	"timestamp":  "rt",
+	"message":    "msg",
+	"record_id":  "externalId",
+	"name":       "duser",
+	"person_id":  "duid",
+	"confidence": "cfp1",
+	"device_id":  "dvchost",
+	"location":   "cs1",
+	"actor":      "suser",
+	"source_ip":  "src",
+	"method":     "requestMethod",
+	"path":       "request",
+	"status":     "cn1",
+}
+
+var cefCustomKey = regexp.MustCompile(`^(cs[1-6]|cn[1-3]|cfp[1-4])$`)
+
+// securityField is one field of an event, in export order
+type securityField struct {
+	name  string
+	value interface{}
+}
+
+// SIEMExporter forwards security events to a SIEM, over syslog or HTTPS, as
+// CEF or JSON. Events are queued and sent by a single worker so a slow or
+// unreachable collector never holds up a request; when the queue is full
+// events are dropped and logged.
+type SIEMExporter struct {
+	cfg    config.SIEMConfig
+	target *url.URL
+	events map[string]bool   // nil exports every type
+	fields map[string]string // field renames, "-" drops the field
+	host   string
+
+	httpClient *http.Client
+	conn       net.Conn // syslog connection, dialed on first use
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan domain.SecurityEvent
+	done   chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	logger *slog.Logger
+}
+
+// NewSIEMExporter validates the configuration and starts the exporter. It
+// returns nil when no target is configured; a nil exporter drops events.
+func NewSIEMExporter(cfg config.SIEMConfig) (*SIEMExporter, error) {
+	if cfg.Target == "" {
+		return nil, nil
+	}
+
+	target, err := url.Parse(cfg.Target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SIEM target %q: %w", cfg.Target, err)
+	}
+	switch target.Scheme {
+	case "udp", "tcp", "tls":
+		if target.Port() == "" {
+			return nil, fmt.Errorf("SIEM target %q needs a port", cfg.Target)
+		}
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported SIEM target %q, expected udp://, tcp://, tls:// or https://", cfg.Target)
+	}
+
+	if cfg.Format != "cef" && cfg.Format != "json" {
+		return nil, fmt.Errorf("unsupported SIEM format %q, expected cef or json", cfg.Format)
+	}
+
+	var events map[string]bool
+	if len(cfg.Events) > 0 {
+		events = make(map[string]bool)
+		for _, event := range cfg.Events {
+			if !slices.Contains(domain.SecurityEventTypes, event) {
+				return nil, fmt.Errorf("unknown SIEM event type %q", event)
+			}
+			events[event] = true
+		}
+	}
+
+	fields := make(map[string]string)
+	for _, entry := range cfg.FieldMap {
+		field, key, ok := strings.Cut(entry, "=")
+		field, key = strings.TrimSpace(field), strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid SIEM field mapping %q, expected field=key", entry)
+		}
+		if _, known := cefKeys[field]; !known && field != "type" && field != "severity" {
+			return nil, fmt.Errorf("unknown SIEM event field %q", field)
+		}
+		fields[field] = key
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "-"
+	}
+
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &SIEMExporter{
+		logger:     logging.Component("siem"),
+		cfg:        cfg,
+		target:     target,
+		events:     events,
+		fields:     fields,
+		host:       host,
+		httpClient: &http.Client{Timeout: siemSendTimeout},
+		queue:      make(chan domain.SecurityEvent, queueSize),
+		done:       make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	go e.run()
+
+	e.logger.Info("Exporting security events", "target", target.Scheme+"://"+target.Host, "format", cfg.Format)
+	return e, nil
+}
+
+// Emit queues an event for export. It never blocks.
+func (e *SIEMExporter) Emit(event domain.SecurityEvent) {
+	if e == nil || (e.events != nil && !e.events[event.Type]) {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return
+	}
+
+	select {
+	case e.queue <- event:
+	default:
+		e.logger.Warn("Queue full, dropped event", "event", event.Type)
+	}
+}
+
+// Close sends what is still queued, giving up after a few seconds
+func (e *SIEMExporter) Close() {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	e.mu.Unlock()
+
+	select {
+	case <-e.done:
+	case <-time.After(siemDrainTimeout):
+		e.logger.Warn("Collector too slow, dropping queued events", "events", len(e.queue))
+		e.cancel()
+		<-e.done
+	}
+	e.cancel()
+}
+
+func (e *SIEMExporter) run() {
+	defer close(e.done)
+	defer func() {
+		if e.conn != nil {
+			e.conn.Close()
+		}
+	}()
+
+	for event := range e.queue {
+		if e.ctx.Err() != nil {
+			continue
+		}
+		if err := e.send(event); err != nil {
+			e.logger.Warn("Failed to export event", "event", event.Type, "error", err)
+		}
+	}
+}
+
+func (e *SIEMExporter) send(event domain.SecurityEvent) error {
+	var payload []byte
+	if e.cfg.Format == "json" {
+		var err error
+		if payload, err = e.formatJSON(event); err != nil {
+			return err
+		}
+	} else {
+		payload = []byte(e.formatCEF(event))
+	}
+
+	if e.target.Scheme == "http" || e.target.Scheme == "https" {
+		return e.post(payload)
+	}
+	return e.writeSyslog(event, payload)
+}
+
+// post sends one event to an HTTPS collector
+func (e *SIEMExporter) post(payload []byte) error {
+	req, err := http.NewRequestWithContext(e.ctx, http.MethodPost, e.target.String(), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if e.cfg.Format == "json" {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "text/plain")
+	}
+	if e.cfg.Authorization != "" {
+		req.Header.Set("Authorization", e.cfg.Authorization)
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// writeSyslog sends one event as an RFC 5424 message. Over TCP and TLS the
+// message is octet-counted (RFC 6587) and a broken connection is dialed
+// again once.
+func (e *SIEMExporter) writeSyslog(event domain.SecurityEvent, payload []byte) error {
+	msg := fmt.Sprintf("<%d>1 %s %s attendance-api - %s - %s",
+		syslogFacility*8+syslogSeverity(event.Severity),
+		event.Timestamp.UTC().Format(time.RFC3339Nano), e.host, event.Type, payload)
+	if e.target.Scheme != "udp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if e.conn == nil {
+			if e.conn, err = e.dial(); err != nil {
+				return err
+			}
+		}
+
+		e.conn.SetWriteDeadline(time.Now().Add(siemSendTimeout))
+		if _, err = e.conn.Write([]byte(msg)); err == nil {
+			return nil
+		}
+		e.conn.Close()
+		e.conn = nil
+	}
+	return err
+}
+
+func (e *SIEMExporter) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: siemDialTimeout}
+	if e.target.Scheme == "tls" {
+		return tls.DialWithDialer(dialer, "tcp", e.target.Host, &tls.Config{ServerName: e.target.Hostname()})
+	}
+	return dialer.DialContext(e.ctx, e.target.Scheme, e.target.Host)
+}
+
+// syslogSeverity maps a CEF severity (0-10) to a syslog severity
+func syslogSeverity(severity int) int {
+	switch {
+	case severity >= 9:
+		return 2 // critical
+	case severity >= 7:
+		return 3 // error
+	case severity >= 4:
+		return 4 // warning
+	default:
+		return 6 // informational
+	}
+}
+
+// securityFields lists the fields an event carries, leaving out empty ones
+func securityFields(event domain.SecurityEvent) []securityField {
+	fields := []securityField{
+		{"timestamp", event.Timestamp},
+		{"message", event.Message},
+		{"record_id", event.RecordID},
+		{"name", event.Name},
+		{"person_id", event.PersonID},
+		{"confidence", event.Confidence},
+		{"device_id", event.DeviceID},
+		{"location", event.Location},
+		{"actor", event.Actor},
+		{"source_ip", event.SourceIP},
+		{"method", event.Method},
+		{"path", event.Path},
+		{"status", event.Status},
+	}
+
+	return slices.DeleteFunc(fields, func(f securityField) bool {
+		switch value := f.value.(type) {
+		case string:
+			return value == ""
+		case int:
+			return value == 0
+		case float64:
+			// Only attendance events have a confidence, even a zero one
+			return value == 0 && event.RecordID == ""
+		}
+		return false
+	})
+}
+
+// key is the name a field is exported under, or "" when it is dropped
+func (e *SIEMExporter) key(field, fallback string) string {
+	key, ok := e.fields[field]
+	if !ok {
+		return fallback
+	}
+	if key == "-" {
+		return ""
+	}
+	return key
+}
+
+func (e *SIEMExporter) formatJSON(event domain.SecurityEvent) ([]byte, error) {
+	doc := make(map[string]interface{})
+	if key := e.key("type", "type"); key != "" {
+		doc[key] = event.Type
+	}
+	if key := e.key("severity", "severity"); key != "" {
+		doc[key] = event.Severity
+	}
+	for _, f := range securityFields(event) {
+		if key := e.key(f.name, f.name); key != "" {
+			doc[key] = f.value
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// formatCEF formats an event as a CEF record. The event type is the
+// signature ID; its fields go into the extension.
+func (e *SIEMExporter) formatCEF(event domain.SecurityEvent) string {
+	name := securityEventNames[event.Type]
+	if name == "" {
+		name = event.Type
+	}
+
+	var ext []string
+	for _, f := range securityFields(event) {
+		key := e.key(f.name, cefKeys[f.name])
+		if key == "" {
+			continue
+		}
+
+		var value string
+		switch v := f.value.(type) {
+		case time.Time:
+			value = strconv.FormatInt(v.UnixMilli(), 10)
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			value = fmt.Sprint(v)
+		}
+
+		ext = append(ext, key+"="+cefExtensionEscape(value))
+		if cefCustomKey.MatchString(key) {
+			ext = append(ext, key+"Label="+f.name)
+		}
+	}
+
+	return fmt.Sprintf("CEF:0|attendance-api|attendance-api|1.0|%s|%s|%d|%s",
+		cefHeaderEscape(event.Type), cefHeaderEscape(name), event.Severity, strings.Join(ext, " "))
+}
+
+var (
+	cefHeaderReplacer    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtensionReplacer = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+func cefHeaderEscape(s string) string    { return cefHeaderReplacer.Replace(s) }
+func cefExtensionEscape(s string) string { return cefExtensionReplacer.Replace(s) }
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+)
+
+// statsRecords is about three months of traffic at a busy site
+const statsRecords = 50000
+
+func newStatsBenchService(b *testing.B) *AttendanceService {
+	b.Helper()
+
+	dbPath := filepath.Join(b.TempDir(), "attendance.db")
+	dbCfg := config.DatabaseConfig{WritePoolSize: 1, ReadPoolSize: 4, BusyTimeout: 5 * time.Second}
+	db, err := OpenDatabase(dbPath, time.Local, dbCfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+	reads, err := OpenReadPool(dbPath, time.Local, dbCfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { reads.Close() })
+
+	calendar, err := NewCalendarService(db, config.CalendarConfig{Weekend: []string{"friday", "saturday"}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	s, err := NewAttendanceService(nil, db, reads, calendar, nil, nil, nil, nil, nil, nil, nil, config.AttendanceConfig{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { s.Close() })
+
+	tx, err := db.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	insert, err := tx.Prepare(`INSERT INTO attendance (id, name, confidence, timestamp, status, observe_only, late, lateness_minutes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	now := time.Now()
+	for i := 0; i < statsRecords; i++ {
+		name, status := fmt.Sprintf("person_%d", i%200), "authorized"
+		if i%10 == 0 {
+			name, status = "Unknown", "unauthorized"
+		}
+		timestamp := now.Add(-time.Duration(i) * 3 * time.Minute)
+		if _, err := insert.Exec(fmt.Sprint(i), name, 90.0, timestamp, status, i%50 == 0, i%7 == 0, i%13); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+
+	return s
+}
+
+// With no records at all, or none this week, the figures are zero rather
+// than NULL
+func TestGetAttendanceStatsWithoutRecords(t *testing.T) {
+	s := newTestAttendanceService(t, nil, config.AttendanceConfig{})
+
+	stats := func() map[string]interface{} {
+		t.Helper()
+		stats, err := s.GetAttendanceStats(domain.GroupFilter{}, domain.SourceFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stats
+	}
+	period := func(stats map[string]interface{}, key string) domain.PeriodStats {
+		t.Helper()
+		p, ok := stats[key].(domain.PeriodStats)
+		if !ok {
+			t.Fatalf("%s = %#v, want period stats", key, stats[key])
+		}
+		return p
+	}
+
+	empty := stats()
+	for _, key := range []string{"total", "authorized", "unauthorized", "unique_people", "observe_only"} {
+		if empty[key] != 0 {
+			t.Errorf("empty database: %s = %v, want 0", key, empty[key])
+		}
+	}
+	for _, key := range []string{"today", "this_week"} {
+		if p := period(empty, key); p.Total != 0 || p.Authorized != 0 || p.UniquePeople != 0 {
+			t.Errorf("empty database: %s = %+v, want zeros", key, p)
+		}
+	}
+
+	if _, err := s.db.Exec("INSERT INTO attendance (id, name, confidence, timestamp, status) VALUES (?, ?, ?, ?, ?)",
+		"1", "alice", 90.0, time.Now().AddDate(0, 0, -30), "authorized"); err != nil {
+		t.Fatal(err)
+	}
+	quiet := stats()
+	if quiet["total"] != 1 || quiet["authorized"] != 1 || quiet["unique_people"] != 1 {
+		t.Errorf("record of last month: total %v, authorized %v, people %v, want 1 each",
+			quiet["total"], quiet["authorized"], quiet["unique_people"])
+	}
+	for _, key := range []string{"today", "this_week"} {
+		if p := period(quiet, key); p.Total != 0 || p.Authorized != 0 || p.Unauthorized != 0 || p.UniquePeople != 0 {
+			t.Errorf("week without records: %s = %+v, want zeros", key, p)
+		}
+	}
+}
+
+func BenchmarkGetAttendanceStats(b *testing.B) {
+	s := newStatsBenchService(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.GetAttendanceStats(domain.GroupFilter{}, domain.SourceFilter{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkGetAttendanceStatsSeparateQueries measures the statistics as they
+// were computed before the single aggregation: one query per figure, on the
+// indexes there were then
+func BenchmarkGetAttendanceStatsSeparateQueries(b *testing.B) {
+	s := newStatsBenchService(b)
+	for _, index := range []string{"idx_attendance_status_name", "idx_attendance_timestamp_status"} {
+		if _, err := s.db.Exec("DROP INDEX " + index); err != nil {
+			b.Fatal(err)
+		}
+	}
+	queries := []string{
+		"SELECT COUNT(*) FROM attendance WHERE 1 = 1",
+		"SELECT COUNT(*) FROM attendance WHERE status = 'authorized' AND 1 = 1",
+		"SELECT COUNT(*) FROM attendance WHERE status = 'unauthorized' AND 1 = 1",
+		"SELECT COUNT(DISTINCT name) FROM attendance WHERE status = 'authorized' AND 1 = 1",
+		"SELECT COUNT(*) FROM attendance WHERE observe_only = 1 AND 1 = 1",
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, query := range queries {
+			var n int
+			if err := s.reads.QueryRow(query).Scan(&n); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if _, err := s.GetPunctuality(domain.GroupFilter{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"attendance-api/internal/client"
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+)
+
+// statusTables are the tables whose rows the status counts, those that grow
+// with use
+var statusTables = []string{
+	"attendance",
+	"attendance_sessions",
+	"people",
+	"unknown_events",
+	"record_snapshots",
+	"devices",
+	"audit_log",
+	"jobs",
+}
+
+// StatusService gathers the state of the node for the ops dashboard, which
+// would otherwise poll half a dozen endpoints
+type StatusService struct {
+	db         *sql.DB
+	recognizer client.Recognizer
+	attendance *AttendanceService
+	dbPath     string
+	cfg        config.HealthConfig
+	startedAt  time.Time
+}
+
+func NewStatusService(db *sql.DB, recognizer client.Recognizer, attendance *AttendanceService, dbPath string, cfg config.HealthConfig) *StatusService {
+	return &StatusService{
+		db:         db,
+		recognizer: recognizer,
+		attendance: attendance,
+		dbPath:     dbPath,
+		cfg:        cfg,
+		startedAt:  time.Now(),
+	}
+}
+
+// Status reports the build, uptime, database size, face service and event
+// streams. A database or face service that fails to answer is reported in
+// the status rather than failing it.
+func (s *StatusService) Status(ctx context.Context) domain.AdminStatus {
+	return domain.AdminStatus{
+		Build:     buildInfo(),
+		StartedAt: s.startedAt,
+		Uptime:    time.Since(s.startedAt).Round(time.Second).String(),
+		Database:  s.databaseStatus(ctx),
+		FaceAPI:   s.faceAPIStatus(ctx),
+		Streams:   s.attendance.GetSSEStats(),
+	}
+}
+
+func (s *StatusService) databaseStatus(ctx context.Context) domain.DatabaseStatus {
+	status := domain.DatabaseStatus{Rows: make(map[string]int64, len(statusTables))}
+
+	var pageSize, pages, free int64
+	err := s.db.QueryRowContext(ctx, "SELECT page_size, page_count, freelist_count FROM pragma_page_size, pragma_page_count, pragma_freelist_count").
+		Scan(&pageSize, &pages, &free)
+	if err != nil {
+		status.Error = fmt.Sprintf("failed to read database size: %v", err)
+		return status
+	}
+	status.SizeBytes = pageSize * pages
+	status.FreeBytes = pageSize * free
+	if info, err := os.Stat(s.dbPath + "-wal"); err == nil {
+		status.WALBytes = info.Size()
+	}
+
+	for _, table := range statusTables {
+		var rows int64
+		if err := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&rows); err != nil {
+			status.Error = fmt.Sprintf("failed to count %s: %v", table, err)
+			return status
+		}
+		status.Rows[table] = rows
+	}
+	return status
+}
+
+// faceAPIStatus lists the enrolled people, which shows the face service
+// answers over either protocol, and asks for its health where it has one
+func (s *StatusService) faceAPIStatus(ctx context.Context) domain.FaceAPIStatus {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.CheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	var status domain.FaceAPIStatus
+	err := s.recognizer.StreamFaces(ctx, func(domain.Face) error {
+		status.EnrolledPeople++
+		return nil
+	})
+	if err == nil {
+		status.Reachable = true
+		var health *domain.FaceServiceHealth
+		health, err = s.recognizer.Health(ctx)
+		if health != nil {
+			status.Status = health.Status
+			status.KnownFaces = health.KnownFaces
+		}
+		if errors.Is(err, client.ErrUnsupported) {
+			err = nil
+		}
+	}
+	status.Duration = time.Since(start).Round(time.Millisecond).String()
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
+
+func buildInfo() domain.BuildInfo {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return domain.BuildInfo{Version: "unknown"}
+	}
+
+	build := domain.BuildInfo{Version: info.Main.Version, GoVersion: info.GoVersion}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Revision = setting.Value
+		case "vcs.time":
+			build.BuiltAt = setting.Value
+		case "vcs.modified":
+			build.Modified = setting.Value == "true"
+		}
+	}
+	return build
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+)
+
+const (
+	bridgeQueueSize  = 1024
+	bridgeKeepalive  = 30 * time.Second
+	bridgeMaxBackoff = 30 * time.Second
+)
+
+// bridgeTransport carries bridge messages through a broker. Publish is only
+// called by the bridge's publisher and Receive by its receiver, so each may
+// keep a connection of its own.
+type bridgeTransport interface {
+	// Publish sends one message to the other instances
+	Publish(payload []byte) error
+	// Receive subscribes and hands each message to handle until stop is
+	// closed or the connection fails
+	Receive(stop <-chan struct{}, handle func(payload []byte)) error
+	// Close drops the publishing connection; the next Publish dials again
+	Close() error
+}
+
+// bridgeMessage is an event as it travels between instances
+type bridgeMessage struct {
+	Origin    string                   `json:"origin"`
+	Event     string                   `json:"event"`
+	Record    *domain.AttendanceRecord `json:"record,omitempty"`
+	Face      *domain.FaceChange       `json:"face,omitempty"`
+	Device    *domain.DeviceStatus     `json:"device,omitempty"`
+	Command   *domain.DoorCommand      `json:"command,omitempty"`
+	Config    *domain.DeviceSettings   `json:"config,omitempty"`
+	Emergency *domain.Emergency        `json:"emergency,omitempty"`
+	Job       *domain.Job              `json:"job,omitempty"`
+}
+
+// StreamBridge shares stream events between API instances behind a load
+// balancer through Redis pub/sub or NATS, so a client streaming from one
+// instance also sees what the others record. Every instance publishes its
+// own events and relays those of the others to its stream clients under
+// IDs of its own; webhooks and the event bus are left to the instance the
+// event happened on. Like the event bus, events are queued and published by
+// a single worker, and the subscription is re-established with backoff when
+// the broker goes away.
+type StreamBridge struct {
+	cfg       config.StreamBridgeConfig
+	target    *url.URL
+	origin    string // tells this instance's own messages apart
+	transport bridgeTransport
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan []byte
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	logger *slog.Logger
+}
+
+// NewStreamBridge validates the configuration. It returns nil when no URL is
+// configured; a nil bridge keeps events on the instance.
+func NewStreamBridge(cfg config.StreamBridgeConfig) (*StreamBridge, error) {
+	if cfg.URL == "" {
+		return nil, nil
+	}
+
+	target, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stream bridge URL: %w", err)
+	}
+	if cfg.Channel == "" {
+		return nil, fmt.Errorf("SSE_BRIDGE_CHANNEL is required with a stream bridge URL")
+	}
+
+	var transport bridgeTransport
+	switch target.Scheme {
+	case "redis", "rediss":
+		transport = newRedisBridge(target, cfg.Channel, cfg.Timeout)
+	case "nats":
+		transport = newNATSBridge(target, cfg.Channel, cfg.Timeout)
+	default:
+		return nil, fmt.Errorf("unsupported stream bridge URL scheme %q, expected redis://, rediss:// or nats://", target.Scheme)
+	}
+
+	return &StreamBridge{
+		logger:    logging.Component("bridge"),
+		cfg:       cfg,
+		target:    target,
+		origin:    uuid.New().String(),
+		transport: transport,
+		queue:     make(chan []byte, bridgeQueueSize),
+		stop:      make(chan struct{}),
+	}, nil
+}
+
+// Start publishes this instance's events and relays those of the others to
+// deliver
+func (b *StreamBridge) Start(deliver func(domain.SSEMessage)) {
+	if b == nil {
+		return
+	}
+
+	b.wg.Add(2)
+	go b.publish()
+	go b.receive(deliver)
+
+	b.logger.Info("Sharing events", "target", b.target.Scheme+"://"+b.target.Host, "channel", b.cfg.Channel)
+}
+
+// Publish queues an event of this instance for the others. It never blocks.
+func (b *StreamBridge) Publish(msg domain.SSEMessage) {
+	if b == nil || msg.Event == domain.EventStatsUpdated {
+		// Every instance derives its own stats from the shared database
+		return
+	}
+
+	payload, err := json.Marshal(bridgeMessage{Origin: b.origin, Event: msg.Event, Record: msg.Record, Face: msg.Face, Device: msg.Device, Command: msg.Command, Config: msg.Config, Emergency: msg.Emergency, Job: msg.Job})
+	if err != nil {
+		b.logger.Warn("Failed to encode event", "event", msg.Event, "error", err)
+		return
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+
+	select {
+	case b.queue <- payload:
+	default:
+		b.logger.Warn("Queue full, dropped event", "event", msg.Event)
+	}
+}
+
+// Close stops publishing and relaying. Events still queued are dropped; the
+// other instances' clients catch up from the database.
+func (b *StreamBridge) Close() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.stop)
+	}
+	b.mu.Unlock()
+
+	b.wg.Wait()
+	b.transport.Close()
+}
+
+func (b *StreamBridge) publish() {
+	defer b.wg.Done()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case payload := <-b.queue:
+			if err := b.transport.Publish(payload); err != nil {
+				// The connection may have gone stale since the last event
+				b.transport.Close()
+				if err := b.transport.Publish(payload); err != nil {
+					b.logger.Warn("Failed to publish event", "error", err)
+				}
+			}
+		}
+	}
+}
+
+// receive keeps a subscription open, backing off between attempts while the
+// broker is unreachable
+func (b *StreamBridge) receive(deliver func(domain.SSEMessage)) {
+	defer b.wg.Done()
+
+	backoff := time.Second
+	for {
+		started := time.Now()
+		err := b.transport.Receive(b.stop, func(payload []byte) {
+			b.relay(payload, deliver)
+		})
+
+		select {
+		case <-b.stop:
+			return
+		default:
+		}
+
+		if time.Since(started) > bridgeMaxBackoff {
+			// The subscription held for a while, so this is a fresh outage
+			backoff = time.Second
+		}
+		b.logger.Warn("Subscription lost, retrying", "backoff", backoff, "error", err)
+
+		select {
+		case <-b.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, bridgeMaxBackoff)
+	}
+}
+
+func (b *StreamBridge) relay(payload []byte, deliver func(domain.SSEMessage)) {
+	var msg bridgeMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		b.logger.Warn("Ignoring malformed message", "error", err)
+		return
+	}
+	if msg.Origin == b.origin || msg.Event == "" {
+		return
+	}
+	deliver(domain.SSEMessage{Event: msg.Event, Record: msg.Record, Face: msg.Face, Device: msg.Device, Command: msg.Command, Config: msg.Config, Emergency: msg.Emergency, Job: msg.Job})
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"attendance-api/internal/client"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+)
+
+var (
+	ErrNoSwitchover       = errors.New("no face service to switch to, set FACE_API_NEXT_URL or FACE_API_NEXT_GRPC_ADDR")
+	ErrEnrollmentMismatch = errors.New("enrollments differ between the face services")
+)
+
+// maxEnrollmentMismatches bounds the mismatches listed by a comparison
+const maxEnrollmentMismatches = 100
+
+// SwitchoverService cuts recognitions over to a new face service once it
+// holds the same enrollments as the current one. The face service switched
+// to is remembered, so a restart keeps using it until the configuration is
+// updated.
+type SwitchoverService struct {
+	recognizer *client.SwitchingRecognizer
+	db         *sql.DB
+
+	cutoverMu sync.Mutex // one cutover at a time
+
+	logger *slog.Logger
+}
+
+func NewSwitchoverService(recognizer *client.SwitchingRecognizer, db *sql.DB) (*SwitchoverService, error) {
+	service := &SwitchoverService{recognizer: recognizer, db: db, logger: logging.Component("switchover")}
+
+	if err := service.initSchema(); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	if err := service.restore(); err != nil {
+		return nil, err
+	}
+
+	return service, nil
+}
+
+func (s *SwitchoverService) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS face_switchover (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		active TEXT NOT NULL,
+		switched_at DATETIME NOT NULL,
+		switched_by TEXT NOT NULL DEFAULT ''
+	);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+	return nil
+}
+
+// restore switches to the standby face service when it is the one the last
+// cutover switched to
+func (s *SwitchoverService) restore() error {
+	var active string
+	err := s.db.QueryRow("SELECT active FROM face_switchover WHERE id = 1").Scan(&active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load face switchover: %w", err)
+	}
+
+	_, activeName, standby, standbyName := s.recognizer.Targets()
+	if standby != nil && active == standbyName {
+		if err := s.recognizer.Switch(); err != nil {
+			return err
+		}
+		s.logger.Info("Recognizing with the backend switched to before the restart", "recognizing", standbyName, "enrolling", activeName)
+	}
+	return nil
+}
+
+// Status describes the migration, comparing the enrollments of both face
+// services when compare is set
+func (s *SwitchoverService) Status(ctx context.Context, compare bool) (*domain.FaceSwitchover, error) {
+	_, activeName, standby, standbyName := s.recognizer.Targets()
+	mirrored, failures, lastError := s.recognizer.MirrorStats()
+
+	status := &domain.FaceSwitchover{
+		Active:          activeName,
+		Standby:         standbyName,
+		DualWrite:       standby != nil,
+		Mirrored:        mirrored,
+		MirrorFailures:  failures,
+		LastMirrorError: lastError,
+	}
+
+	var (
+		switchedAt time.Time
+		switchedBy string
+	)
+	err := s.db.QueryRow("SELECT switched_at, switched_by FROM face_switchover WHERE id = 1").Scan(&switchedAt, &switchedBy)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to load face switchover: %w", err)
+	}
+	if err == nil {
+		status.SwitchedAt = &switchedAt
+		status.SwitchedBy = switchedBy
+	}
+
+	if compare && standby != nil {
+		comparison, err := s.Compare(ctx)
+		if err != nil {
+			return nil, err
+		}
+		status.Verification = comparison
+	}
+	return status, nil
+}
+
+// Compare reads the people enrolled on both face services, bypassing the
+// list caches, and reports those whose image counts differ
+func (s *SwitchoverService) Compare(ctx context.Context) (*domain.EnrollmentComparison, error) {
+	active, activeName, standby, standbyName := s.recognizer.Targets()
+	if standby == nil {
+		return nil, ErrNoSwitchover
+	}
+
+	activeFaces, err := enrolledImages(ctx, active)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list faces on %s: %w", activeName, err)
+	}
+	standbyFaces, err := enrolledImages(ctx, standby)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list faces on %s: %w", standbyName, err)
+	}
+
+	comparison := &domain.EnrollmentComparison{
+		ActivePeople:  len(activeFaces),
+		StandbyPeople: len(standbyFaces),
+		Mismatches:    []domain.EnrollmentMismatch{},
+	}
+	names := make([]string, 0, len(activeFaces))
+	for name, images := range activeFaces {
+		comparison.ActiveImages += images
+		names = append(names, name)
+	}
+	for name, images := range standbyFaces {
+		comparison.StandbyImages += images
+		if _, ok := activeFaces[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if activeFaces[name] == standbyFaces[name] {
+			continue
+		}
+		if len(comparison.Mismatches) == maxEnrollmentMismatches {
+			comparison.Truncated = true
+			break
+		}
+		comparison.Mismatches = append(comparison.Mismatches, domain.EnrollmentMismatch{
+			Name:          name,
+			ActiveImages:  activeFaces[name],
+			StandbyImages: standbyFaces[name],
+		})
+	}
+	comparison.Match = len(comparison.Mismatches) == 0
+	return comparison, nil
+}
+
+// enrolledImages maps each person enrolled on a face service to their
+// number of images
+func enrolledImages(ctx context.Context, recognizer client.Recognizer) (map[string]int, error) {
+	if cache, ok := recognizer.(interface{ Invalidate() }); ok {
+		cache.Invalidate()
+	}
+
+	faces := make(map[string]int)
+	err := recognizer.StreamFaces(ctx, func(face domain.Face) error {
+		faces[face.Name] += face.Images
+		return nil
+	})
+	return faces, err
+}
+
+// Cutover switches recognitions to the standby face service, after checking
+// that both hold the same enrollments unless force is set. The old face
+// service becomes the standby and keeps receiving enrollments, so cutting
+// over again switches back.
+func (s *SwitchoverService) Cutover(ctx context.Context, force bool) (*domain.FaceSwitchover, error) {
+	s.cutoverMu.Lock()
+	defer s.cutoverMu.Unlock()
+
+	comparison, err := s.Compare(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !comparison.Match && !force {
+		return &domain.FaceSwitchover{Verification: comparison}, ErrEnrollmentMismatch
+	}
+
+	if err := s.recognizer.Switch(); err != nil {
+		return nil, err
+	}
+	_, activeName, _, standbyName := s.recognizer.Targets()
+
+	actor := domain.ActorFromContext(ctx).String()
+	_, err = s.db.Exec(`
+		INSERT INTO face_switchover (id, active, switched_at, switched_by) VALUES (1, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET active = excluded.active, switched_at = excluded.switched_at, switched_by = excluded.switched_by
+	`, activeName, time.Now(), actor)
+	if err != nil {
+		// Recognitions already use the new face service; only a restart
+		// would go back to the old one
+		s.logger.Warn("Failed to remember the cutover", "error", err)
+	}
+
+	logging.From(ctx).Warn("Switched recognition over", "recognizing", activeName, "previous", standbyName,
+		"mismatches", len(comparison.Mismatches))
+
+	status, err := s.Status(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	status.Verification = comparison
+	return status, nil
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"attendance-api/internal/domain"
+)
+
+// defaultTagRules apply when ATTENDANCE_TAG_RULES is not set
+var defaultTagRules = []string{
+	"late:late",
+	"early_leave:early_leave",
+	"weekend_entry:status=authorized;day=weekend",
+	"holiday_entry:status=authorized;day=holiday",
+	"after_hours:status=authorized;time<07:00",
+	"after_hours:status=authorized;time>=19:00",
+	"first_day:status=authorized;first_seen",
+}
+
+var tagName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// tagRule tags a record when all of its conditions hold. Several rules may
+// share a tag, which is then set when any of them matches.
+type tagRule struct {
+	tag        string
+	source     string // the rule as configured
+	conditions []tagCondition
+}
+
+// tagCondition reports whether a condition holds for a record
+type tagCondition func(record *domain.AttendanceRecord, facts *tagFacts) (bool, error)
+
+// tagFacts looks up what some conditions need beyond the record itself,
+// at most once per record
+type tagFacts struct {
+	s         *AttendanceService
+	day       *domain.CalendarDay
+	firstSeen *bool
+}
+
+// parseTagRules parses "tag:condition;condition" entries. Without entries
+// the default rules apply; "none" disables tagging.
+func parseTagRules(entries []string) ([]tagRule, error) {
+	if len(entries) == 0 {
+		entries = defaultTagRules
+	}
+	if len(entries) == 1 && entries[0] == "none" {
+		return nil, nil
+	}
+
+	rules := make([]tagRule, 0, len(entries))
+	for _, entry := range entries {
+		tag, conditions, ok := strings.Cut(entry, ":")
+		tag = strings.TrimSpace(tag)
+		if !ok || !tagName.MatchString(tag) || strings.TrimSpace(conditions) == "" {
+			return nil, fmt.Errorf("invalid tag rule %q, expected tag:condition;condition", entry)
+		}
+
+		rule := tagRule{tag: tag, source: entry}
+		for _, text := range strings.Split(conditions, ";") {
+			condition, err := parseTagCondition(strings.TrimSpace(text))
+			if err != nil {
+				return nil, fmt.Errorf("tag rule %q: %w", entry, err)
+			}
+			rule.conditions = append(rule.conditions, condition)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parseTagCondition parses one condition: a flag such as "late", a
+// comparison such as "time>=19:00" or "status=authorized|unauthorized", or
+// either negated with a leading "!"
+func parseTagCondition(text string) (tagCondition, error) {
+	if negated, ok := strings.CutPrefix(text, "!"); ok {
+		condition, err := parseTagCondition(negated)
+		if err != nil {
+			return nil, err
+		}
+		return func(record *domain.AttendanceRecord, facts *tagFacts) (bool, error) {
+			holds, err := condition(record, facts)
+			return !holds, err
+		}, nil
+	}
+
+	switch text {
+	case "late":
+		return recordFlag(func(r *domain.AttendanceRecord) bool { return r.Late }), nil
+	case "early_leave":
+		return recordFlag(func(r *domain.AttendanceRecord) bool { return r.EarlyLeave }), nil
+	case "misplaced":
+		return recordFlag(func(r *domain.AttendanceRecord) bool { return r.Misplaced }), nil
+	case "observe_only":
+		return recordFlag(func(r *domain.AttendanceRecord) bool { return r.ObserveOnly }), nil
+	case "unknown":
+		return recordFlag(func(r *domain.AttendanceRecord) bool { return r.Name == "Unknown" }), nil
+	case "first_seen":
+		return func(record *domain.AttendanceRecord, facts *tagFacts) (bool, error) {
+			return facts.isFirstSeen(record)
+		}, nil
+	}
+
+	for _, op := range []string{">=", "<=", "=", "<", ">"} {
+		if field, value, ok := strings.Cut(text, op); ok {
+			return parseComparison(strings.TrimSpace(field), op, strings.TrimSpace(value))
+		}
+	}
+	return nil, fmt.Errorf("unknown condition %q", text)
+}
+
+func parseComparison(field, op, value string) (tagCondition, error) {
+	switch field {
+	case "time":
+		clock, err := time.Parse("15:04", value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time %q, expected HH:MM", value)
+		}
+		minute := clock.Hour()*60 + clock.Minute()
+		return recordFlag(func(r *domain.AttendanceRecord) bool {
+			return compare(float64(r.Timestamp.Hour()*60+r.Timestamp.Minute()), op, float64(minute))
+		}), nil
+
+	case "confidence":
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid confidence %q", value)
+		}
+		return recordFlag(func(r *domain.AttendanceRecord) bool {
+			return compare(r.Confidence, op, threshold)
+		}), nil
+	}
+
+	if op != "=" {
+		return nil, fmt.Errorf("%s only supports =", field)
+	}
+	values := strings.Split(value, "|")
+
+	switch field {
+	case "status":
+		return recordFlag(func(r *domain.AttendanceRecord) bool { return slices.Contains(values, r.Status) }), nil
+	case "event":
+		return recordFlag(func(r *domain.AttendanceRecord) bool { return slices.Contains(values, r.EventType) }), nil
+	case "location":
+		return recordFlag(func(r *domain.AttendanceRecord) bool { return slices.Contains(values, r.Location) }), nil
+	case "device":
+		return recordFlag(func(r *domain.AttendanceRecord) bool { return slices.Contains(values, r.DeviceID) }), nil
+
+	case "weekday":
+		for _, v := range values {
+			if _, ok := weekdays[v]; !ok {
+				return nil, fmt.Errorf("unknown weekday %q", v)
+			}
+		}
+		return recordFlag(func(r *domain.AttendanceRecord) bool {
+			return slices.Contains(values, strings.ToLower(r.Timestamp.Weekday().String()))
+		}), nil
+
+	case "day":
+		for _, v := range values {
+			if v != "weekend" && v != "holiday" && v != "workday" {
+				return nil, fmt.Errorf("day must be weekend, holiday or workday, not %q", v)
+			}
+		}
+		return func(record *domain.AttendanceRecord, facts *tagFacts) (bool, error) {
+			day, err := facts.calendarDay(record)
+			if err != nil {
+				return false, err
+			}
+			return (slices.Contains(values, "weekend") && day.Weekend) ||
+				(slices.Contains(values, "holiday") && day.Holiday != "") ||
+				(slices.Contains(values, "workday") && day.Workday), nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown field %q", field)
+}
+
+// weekdays are the names accepted by weekday conditions
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+func recordFlag(holds func(r *domain.AttendanceRecord) bool) tagCondition {
+	return func(record *domain.AttendanceRecord, _ *tagFacts) (bool, error) {
+		return holds(record), nil
+	}
+}
+
+func compare(a float64, op string, b float64) bool {
+	switch op {
+	case ">=":
+		return a >= b
+	case "<=":
+		return a <= b
+	case "<":
+		return a < b
+	case ">":
+		return a > b
+	default:
+		return a == b
+	}
+}
+
+func (f *tagFacts) calendarDay(record *domain.AttendanceRecord) (*domain.CalendarDay, error) {
+	if f.day == nil {
+		days, err := f.s.calendar.GetCalendar(record.Timestamp, record.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		f.day = &days[0]
+	}
+	return f.day, nil
+}
+
+// isFirstSeen reports whether a known person has no authorized record yet
+func (f *tagFacts) isFirstSeen(record *domain.AttendanceRecord) (bool, error) {
+	if record.Name == "Unknown" {
+		return false, nil
+	}
+	if f.firstSeen == nil {
+		var seen bool
+		err := f.s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM attendance WHERE name = ? AND status = 'authorized')",
+			record.Name).Scan(&seen)
+		if err != nil {
+			return false, fmt.Errorf("failed to look up earlier records: %w", err)
+		}
+		first := !seen
+		f.firstSeen = &first
+	}
+	return *f.firstSeen, nil
+}
+
+// tagRecord sets the tags of the rules that match a record about to be
+// saved. A rule that cannot be evaluated is logged and skipped.
+func (s *AttendanceService) tagRecord(record *domain.AttendanceRecord) {
+	facts := &tagFacts{s: s}
+	for _, rule := range s.tagRules {
+		if slices.Contains(record.Tags, rule.tag) {
+			continue
+		}
+
+		matched := true
+		for _, condition := range rule.conditions {
+			holds, err := condition(record, facts)
+			if err != nil {
+				s.logger.Error("Failed to evaluate tag rule", "rule", rule.source, "record", record.ID, "error", err)
+			}
+			if err != nil || !holds {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			record.Tags = append(record.Tags, rule.tag)
+		}
+	}
+}
+
+// TagRules lists the tag rules in effect, as configured
+func (s *AttendanceService) TagRules() []string {
+	rules := make([]string, 0, len(s.tagRules))
+	for _, rule := range s.tagRules {
+		rules = append(rules, rule.source)
+	}
+	return rules
+}
+
+// TagCounts counts the records of each tag between from and to, most
+// frequent first
+func (s *AttendanceService) TagCounts(from, to time.Time) ([]domain.TagCount, error) {
+	rows, err := s.reads.Query("SELECT tags FROM attendance WHERE tags != '' AND timestamp >= ? AND timestamp < ?", from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var tags string
+		if err := rows.Scan(&tags); err != nil {
+			return nil, fmt.Errorf("failed to scan tags: %w", err)
+		}
+		for _, tag := range strings.Split(tags, ",") {
+			counts[tag]++
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	result := make([]domain.TagCount, 0, len(counts))
+	for tag, count := range counts {
+		result = append(result, domain.TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Tag < result[j].Tag
+	})
+	return result, nil
+}
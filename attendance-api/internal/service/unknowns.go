@@ -0,0 +1,340 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+	"time"
+
+	"attendance-api/internal/client"
+	"attendance-api/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnknownNotFound = errors.New("unknown event not found")
+	ErrUnknownReviewed = errors.New("unknown event was already reviewed")
+	ErrFaceRejected    = errors.New("face service rejected the image")
+)
+
+// cropMargin widens the face box on every side, as a fraction of its size,
+// so the crop keeps enough context to be enrolled
+const cropMargin = 0.25
+
+// captureTimeout bounds storing the snapshots of one unknown face
+const captureTimeout = 30 * time.Second
+
+// UnknownService keeps the snapshots of unknown faces in a review queue from
+// which they can be enrolled as a new person or dismissed
+type UnknownService struct {
+	faceClient client.Recognizer
+	db         *sql.DB
+	reads      *sql.DB
+	store      SnapshotStore
+}
+
+func NewUnknownService(faceClient client.Recognizer, db, reads *sql.DB, store SnapshotStore) (*UnknownService, error) {
+	service := &UnknownService{
+		faceClient: faceClient,
+		db:         db,
+		reads:      reads,
+		store:      store,
+	}
+
+	if err := service.initSchema(); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	return service, nil
+}
+
+func (s *UnknownService) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS unknown_events (
+		id TEXT PRIMARY KEY,
+		attendance_id TEXT NOT NULL,
+		timestamp DATETIME NOT NULL,
+		device_id TEXT NOT NULL DEFAULT '',
+		location TEXT NOT NULL DEFAULT '',
+		confidence REAL NOT NULL,
+		image_key TEXT NOT NULL DEFAULT '',
+		crop_key TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL,
+		enrolled_name TEXT NOT NULL DEFAULT '',
+		reviewed_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_unknown_events_status ON unknown_events(status, timestamp DESC);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+
+	return ensureColumn(s.db, "unknown_events", "reviewed_by", "TEXT NOT NULL DEFAULT ''")
+}
+
+// Capture stores the submitted image and the crop of the face at location
+// and queues them for review. The crop is skipped when the image format
+// cannot be decoded.
+func (s *UnknownService) Capture(record domain.AttendanceRecord, imageData []byte, location domain.FaceLocation) (*domain.UnknownEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), captureTimeout)
+	defer cancel()
+
+	event := &domain.UnknownEvent{
+		ID:           uuid.New().String(),
+		AttendanceID: record.ID,
+		Timestamp:    record.Timestamp,
+		DeviceID:     record.DeviceID,
+		Location:     record.Location,
+		Confidence:   record.Confidence,
+		Status:       domain.UnknownPending,
+	}
+
+	prefix := "unknowns/" + record.Timestamp.Format("2006/01/02") + "/" + event.ID
+	contentType := http.DetectContentType(imageData)
+
+	event.ImageKey = prefix + imageExtension(contentType)
+	if err := s.store.Put(ctx, event.ImageKey, imageData, contentType); err != nil {
+		return nil, fmt.Errorf("failed to store image: %w", err)
+	}
+	event.HasImage = true
+
+	if crop, err := cropFace(imageData, location); err == nil {
+		event.CropKey = prefix + "-face.jpg"
+		if err := s.store.Put(ctx, event.CropKey, crop, "image/jpeg"); err != nil {
+			return nil, fmt.Errorf("failed to store face crop: %w", err)
+		}
+		event.HasCrop = true
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO unknown_events (id, attendance_id, timestamp, device_id, location, confidence, image_key, crop_key, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, event.ID, event.AttendanceID, event.Timestamp, event.DeviceID, event.Location, event.Confidence,
+		event.ImageKey, event.CropKey, event.Status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert unknown event: %w", err)
+	}
+
+	return event, nil
+}
+
+const unknownColumns = `id, attendance_id, timestamp, device_id, location, confidence,
+	image_key, crop_key, status, enrolled_name, reviewed_at, reviewed_by`
+
+// List returns the newest unknown events, optionally only those in one
+// review state
+func (s *UnknownService) List(status string, limit int) ([]domain.UnknownEvent, error) {
+	rows, err := s.reads.Query(`
+		SELECT `+unknownColumns+`
+		FROM unknown_events
+		WHERE ? = '' OR status = ?
+		ORDER BY timestamp DESC
+		LIMIT ?
+	`, status, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unknown events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []domain.UnknownEvent{}
+	for rows.Next() {
+		event, err := scanUnknown(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return events, nil
+}
+
+func (s *UnknownService) Get(id string) (*domain.UnknownEvent, error) {
+	event, err := scanUnknown(s.db.QueryRow("SELECT "+unknownColumns+" FROM unknown_events WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnknownNotFound
+	}
+	return event, err
+}
+
+// Snapshot returns the stored full image, or the face crop when crop is set
+func (s *UnknownService) Snapshot(ctx context.Context, id string, crop bool) ([]byte, error) {
+	event, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	key := event.ImageKey
+	if crop {
+		key = event.CropKey
+	}
+	if key == "" {
+		return nil, ErrSnapshotNotFound
+	}
+
+	return s.store.Get(ctx, key)
+}
+
+// Enroll adds the stored snapshot to the face service as the given person
+// and closes the event. The face crop is preferred, so a frame with several
+// faces does not enroll the wrong one.
+func (s *UnknownService) Enroll(ctx context.Context, id, name string) (*domain.UnknownEvent, error) {
+	event, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if event.Status != domain.UnknownPending {
+		return nil, ErrUnknownReviewed
+	}
+
+	key := event.CropKey
+	if key == "" {
+		key = event.ImageKey
+	}
+	if key == "" {
+		return nil, ErrSnapshotNotFound
+	}
+
+	data, err := s.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := event.ID + imageExtension(http.DetectContentType(data))
+	result, err := s.faceClient.AddFace(ctx, name, [][]byte{data}, []string{filename})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add face: %w", err)
+	}
+	if result.Added == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrFaceRejected, result.Images[0].Error)
+	}
+
+	now := time.Now()
+	reviewer := domain.ActorFromContext(ctx).String()
+	_, err = s.db.Exec("UPDATE unknown_events SET status = ?, enrolled_name = ?, reviewed_at = ?, reviewed_by = ? WHERE id = ?",
+		domain.UnknownEnrolled, name, now, reviewer, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update unknown event: %w", err)
+	}
+
+	event.Status = domain.UnknownEnrolled
+	event.EnrolledName = name
+	event.ReviewedAt = &now
+	event.ReviewedBy = reviewer
+	return event, nil
+}
+
+// Dismiss closes an event without enrolling it and deletes its snapshots
+func (s *UnknownService) Dismiss(ctx context.Context, id string) error {
+	event, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if event.Status != domain.UnknownPending {
+		return ErrUnknownReviewed
+	}
+
+	for _, key := range []string{event.ImageKey, event.CropKey} {
+		if key == "" {
+			continue
+		}
+		if err := s.store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	_, err = s.db.Exec("UPDATE unknown_events SET status = ?, image_key = '', crop_key = '', reviewed_at = ?, reviewed_by = ? WHERE id = ?",
+		domain.UnknownDismissed, time.Now(), domain.ActorFromContext(ctx).String(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update unknown event: %w", err)
+	}
+
+	return nil
+}
+
+func scanUnknown(row rowScanner) (*domain.UnknownEvent, error) {
+	var (
+		event      domain.UnknownEvent
+		reviewedAt sql.NullTime
+	)
+
+	err := row.Scan(&event.ID, &event.AttendanceID, &event.Timestamp, &event.DeviceID, &event.Location,
+		&event.Confidence, &event.ImageKey, &event.CropKey, &event.Status, &event.EnrolledName, &reviewedAt,
+		&event.ReviewedBy)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan unknown event: %w", err)
+	}
+
+	event.HasImage = event.ImageKey != ""
+	event.HasCrop = event.CropKey != ""
+	if reviewedAt.Valid {
+		event.ReviewedAt = &reviewedAt.Time
+	}
+
+	return &event, nil
+}
+
+// cropFace cuts the face at location, plus a margin, out of a JPEG or PNG
+// image and encodes it as JPEG
+func cropFace(imageData []byte, location domain.FaceLocation) ([]byte, error) {
+	if location.Right <= location.Left || location.Bottom <= location.Top {
+		return nil, fmt.Errorf("no face location")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(imageData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	marginX := int(float64(location.Right-location.Left) * cropMargin)
+	marginY := int(float64(location.Bottom-location.Top) * cropMargin)
+	box := image.Rect(location.Left-marginX, location.Top-marginY, location.Right+marginX, location.Bottom+marginY).
+		Intersect(img.Bounds())
+	if box.Empty() {
+		return nil, fmt.Errorf("face location outside the image")
+	}
+
+	sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return nil, fmt.Errorf("image type cannot be cropped")
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, sub.SubImage(box), &jpeg.Options{Quality: 90}); err != nil {
+		return nil, fmt.Errorf("failed to encode crop: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// imageExtension maps a detected content type to a file extension
+func imageExtension(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/bmp":
+		return ".bmp"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ".bin"
+	}
+}
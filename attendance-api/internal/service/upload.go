@@ -0,0 +1,43 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"slices"
+	"strings"
+
+	"attendance-api/internal/config"
+
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrImageType       = errors.New("unsupported image type")
+	ErrImageDimensions = errors.New("image too large")
+)
+
+// CheckImage enforces the upload constraints on an image before it is sent
+// to the face service: its type, told by its content rather than the name
+// or the declared type, and its width and height. Size is checked by the
+// caller, before the image is read. Zero values leave a constraint out.
+func CheckImage(data []byte, cfg config.UploadConfig) error {
+	contentType := http.DetectContentType(data)
+	if len(cfg.AllowedTypes) > 0 && !slices.Contains(cfg.AllowedTypes, contentType) {
+		return fmt.Errorf("%w %s, expected %s", ErrImageType, contentType, strings.Join(cfg.AllowedTypes, ", "))
+	}
+
+	if cfg.MaxWidth == 0 && cfg.MaxHeight == 0 {
+		return nil
+	}
+	dims, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %s that cannot be decoded: %v", ErrImageType, contentType, err)
+	}
+	if (cfg.MaxWidth > 0 && dims.Width > cfg.MaxWidth) || (cfg.MaxHeight > 0 && dims.Height > cfg.MaxHeight) {
+		return fmt.Errorf("%w: %dx%d pixels, at most %dx%d are accepted", ErrImageDimensions, dims.Width, dims.Height, cfg.MaxWidth, cfg.MaxHeight)
+	}
+	return nil
+}
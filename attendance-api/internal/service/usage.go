@@ -0,0 +1,460 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+)
+
+// latencyBounds are the upper bounds, in milliseconds, of the latency
+// histogram buckets; a last bucket holds the slower requests
+var latencyBounds = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000}
+
+// usageKey is a client on a device on a day, a row of the rollups
+type usageKey struct {
+	day        string
+	clientType string
+	clientID   string
+	device     string
+}
+
+// usageCounts are the requests of a client counted since the last flush
+type usageCounts struct {
+	name         string
+	requests     int64
+	clientErrors int64
+	serverErrors int64
+	totalMs      float64
+	maxMs        float64
+	peak         int64 // requests in the busiest minute
+	buckets      []int64
+	lastSeen     time.Time
+}
+
+// minuteCount counts a client's requests in the current minute. It outlives
+// the flushes, which fall in the middle of minutes.
+type minuteCount struct {
+	minute int64
+	count  int64
+}
+
+// UsageService keeps per-client API usage statistics (request counts, error
+// rates and latencies) in daily rollups, so a misconfigured kiosk retrying
+// in a tight loop stands out. Requests are counted in memory and added to
+// the rollups in batches, keeping the database out of the request path.
+type UsageService struct {
+	db            *sql.DB
+	reads         *sql.DB
+	loc           *time.Location // zone of the site, in which days begin and end
+	flushInterval time.Duration
+	retention     atomic.Int64 // nanoseconds, zero keeps rollups forever
+	ctx           context.Context
+	cancel        context.CancelFunc
+	done          chan struct{}
+
+	mu      sync.Mutex
+	pending map[usageKey]*usageCounts
+	minutes map[usageKey]*minuteCount
+	flushMu sync.Mutex // one flush at a time
+
+	logger *slog.Logger
+}
+
+func NewUsageService(db, reads *sql.DB, loc *time.Location, cfg config.UsageConfig) (*UsageService, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	service := &UsageService{
+		logger:        logging.Component("usage"),
+		db:            db,
+		reads:         reads,
+		loc:           loc,
+		flushInterval: cfg.FlushInterval,
+		ctx:           ctx,
+		cancel:        cancel,
+		done:          make(chan struct{}),
+		pending:       make(map[usageKey]*usageCounts),
+		minutes:       make(map[usageKey]*minuteCount),
+	}
+	service.retention.Store(int64(cfg.Retention))
+
+	if err := service.initSchema(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	if service.Enabled() {
+		go service.run()
+	} else {
+		close(service.done)
+	}
+
+	return service, nil
+}
+
+// Reconfigure applies a changed retention from the next hourly prune
+func (s *UsageService) Reconfigure(cfg config.UsageConfig) {
+	if old := time.Duration(s.retention.Swap(int64(cfg.Retention))); old != cfg.Retention {
+		s.logger.Info("Retention changed", "retention", cfg.Retention, "was", old)
+	}
+}
+
+func (s *UsageService) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS client_usage (
+		day TEXT NOT NULL,
+		client_type TEXT NOT NULL,
+		client_id TEXT NOT NULL,
+		device TEXT NOT NULL,
+		client_name TEXT NOT NULL DEFAULT '',
+		requests INTEGER NOT NULL,
+		client_errors INTEGER NOT NULL,
+		server_errors INTEGER NOT NULL,
+		total_ms REAL NOT NULL,
+		max_ms REAL NOT NULL,
+		peak_per_minute INTEGER NOT NULL,
+		latency_buckets TEXT NOT NULL,
+		last_seen DATETIME NOT NULL,
+		PRIMARY KEY (day, client_type, client_id, device)
+	);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+	return nil
+}
+
+// Enabled reports whether requests are counted
+func (s *UsageService) Enabled() bool {
+	return s.flushInterval > 0
+}
+
+// Close stops counting and adds what was counted to the rollups
+func (s *UsageService) Close() {
+	s.cancel()
+	<-s.done
+}
+
+// Record counts a request of the client, answered with status after
+// latency. Requests without a key are counted by the client's IP address.
+func (s *UsageService) Record(client domain.Actor, ip string, status int, latency time.Duration) {
+	if !s.Enabled() {
+		return
+	}
+
+	now := time.Now().In(s.loc)
+	key := usageKey{
+		day:        now.Format("2006-01-02"),
+		clientType: client.Type,
+		clientID:   client.ID,
+		device:     client.Device,
+	}
+	if key.clientID == "" {
+		key.clientID = ip
+	}
+	ms := float64(latency.Microseconds()) / 1000
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts, ok := s.pending[key]
+	if !ok {
+		counts = &usageCounts{buckets: make([]int64, len(latencyBounds)+1)}
+		s.pending[key] = counts
+	}
+	counts.name = client.Name
+	counts.requests++
+	switch {
+	case status >= 500:
+		counts.serverErrors++
+	case status >= 400:
+		counts.clientErrors++
+	}
+	counts.totalMs += ms
+	counts.maxMs = max(counts.maxMs, ms)
+	counts.buckets[bucket(latencyBounds, ms)]++
+	counts.lastSeen = now
+
+	minute := now.Unix() / 60
+	current, ok := s.minutes[key]
+	if !ok || current.minute != minute {
+		current = &minuteCount{minute: minute}
+		s.minutes[key] = current
+	}
+	current.count++
+	counts.peak = max(counts.peak, current.count)
+}
+
+// bucket returns the histogram bucket of v: the first whose upper bound is
+// at least v, or the last one past all bounds
+func bucket(bounds []float64, v float64) int {
+	for i, bound := range bounds {
+		if v <= bound {
+			return i
+		}
+	}
+	return len(bounds)
+}
+
+func (s *UsageService) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			if err := s.Flush(); err != nil {
+				s.logger.Error("Failed to flush usage", "error", err)
+			}
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				s.logger.Error("Failed to flush usage", "error", err)
+			}
+			if s.retention.Load() > 0 && time.Since(lastPrune) >= time.Hour {
+				s.prune()
+				lastPrune = time.Now()
+			}
+		}
+	}
+}
+
+// Flush adds the requests counted since the last flush to the rollups
+func (s *UsageService) Flush() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[usageKey]*usageCounts)
+	minute := time.Now().Unix() / 60
+	for key, current := range s.minutes {
+		if current.minute < minute {
+			delete(s.minutes, key)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for key, counts := range pending {
+		// The histogram is merged here, the sums in the upsert
+		var stored string
+		err := tx.QueryRow(`
+			SELECT latency_buckets FROM client_usage
+			WHERE day = ? AND client_type = ? AND client_id = ? AND device = ?
+		`, key.day, key.clientType, key.clientID, key.device).Scan(&stored)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to read usage: %w", err)
+		}
+		buckets := mergeBuckets(counts.buckets, stored)
+		data, err := json.Marshal(buckets)
+		if err != nil {
+			return fmt.Errorf("failed to encode latency histogram: %w", err)
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO client_usage (day, client_type, client_id, device, client_name, requests,
+				client_errors, server_errors, total_ms, max_ms, peak_per_minute, latency_buckets, last_seen)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(day, client_type, client_id, device) DO UPDATE SET
+				client_name = excluded.client_name,
+				requests = requests + excluded.requests,
+				client_errors = client_errors + excluded.client_errors,
+				server_errors = server_errors + excluded.server_errors,
+				total_ms = total_ms + excluded.total_ms,
+				max_ms = MAX(max_ms, excluded.max_ms),
+				peak_per_minute = MAX(peak_per_minute, excluded.peak_per_minute),
+				latency_buckets = excluded.latency_buckets,
+				last_seen = excluded.last_seen
+		`, key.day, key.clientType, key.clientID, key.device, counts.name, counts.requests,
+			counts.clientErrors, counts.serverErrors, counts.totalMs, counts.maxMs, counts.peak, string(data), counts.lastSeen)
+		if err != nil {
+			return fmt.Errorf("failed to record usage: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit usage: %w", err)
+	}
+	return nil
+}
+
+// mergeBuckets adds a stored histogram to counted ones; a histogram that
+// cannot be read is left out
+func mergeBuckets(buckets []int64, stored string) []int64 {
+	merged := slices.Clone(buckets)
+	var previous []int64
+	if stored != "" && json.Unmarshal([]byte(stored), &previous) == nil {
+		for i := range min(len(previous), len(merged)) {
+			merged[i] += previous[i]
+		}
+	}
+	return merged
+}
+
+func (s *UsageService) prune() {
+	retention := time.Duration(s.retention.Load())
+	cutoff := time.Now().In(s.loc).Add(-retention).Format("2006-01-02")
+	result, err := s.db.Exec("DELETE FROM client_usage WHERE day < ?", cutoff)
+	if err != nil {
+		s.logger.Error("Failed to prune rollups", "error", err)
+	} else if n, _ := result.RowsAffected(); n > 0 {
+		s.logger.Info("Pruned rollups", "rollups", n, "retention", retention)
+	}
+}
+
+// Clients returns the usage of every client and device between two days
+// (YYYY-MM-DD, inclusive), the busiest first. With daily set there is a
+// row per day, otherwise the days are added up.
+func (s *UsageService) Clients(from, to string, daily bool) ([]domain.ClientUsage, error) {
+	// Include what was counted since the last flush
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.reads.Query(`
+		SELECT day, client_type, client_id, device, client_name, requests, client_errors,
+			server_errors, total_ms, max_ms, peak_per_minute, latency_buckets, last_seen
+		FROM client_usage
+		WHERE day >= ? AND day <= ?
+		ORDER BY day
+	`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	defer rows.Close()
+
+	type total struct {
+		usage   domain.ClientUsage
+		totalMs float64
+		buckets []int64
+	}
+	totals := make(map[usageKey]*total)
+	var order []usageKey
+
+	for rows.Next() {
+		var (
+			row     domain.ClientUsage
+			totalMs float64
+			stored  string
+		)
+		err := rows.Scan(&row.Day, &row.ClientType, &row.ClientID, &row.Device, &row.ClientName, &row.Requests,
+			&row.ClientErrors, &row.ServerErrors, &totalMs, &row.LatencyMs.Max, &row.PeakPerMinute, &stored, &row.LastSeen)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+
+		key := usageKey{clientType: row.ClientType, clientID: row.ClientID, device: row.Device}
+		if daily {
+			key.day = row.Day
+		} else {
+			row.Day = ""
+		}
+
+		t, ok := totals[key]
+		if !ok {
+			t = &total{usage: row, buckets: make([]int64, len(latencyBounds)+1)}
+			t.usage.Requests, t.usage.ClientErrors, t.usage.ServerErrors = 0, 0, 0
+			totals[key] = t
+			order = append(order, key)
+		}
+		t.usage.ClientName = row.ClientName // the latest
+		t.usage.Requests += row.Requests
+		t.usage.ClientErrors += row.ClientErrors
+		t.usage.ServerErrors += row.ServerErrors
+		t.usage.PeakPerMinute = max(t.usage.PeakPerMinute, row.PeakPerMinute)
+		t.usage.LatencyMs.Max = max(t.usage.LatencyMs.Max, row.LatencyMs.Max)
+		if row.LastSeen.After(t.usage.LastSeen) {
+			t.usage.LastSeen = row.LastSeen
+		}
+		t.totalMs += totalMs
+		t.buckets = mergeBuckets(t.buckets, stored)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	usage := make([]domain.ClientUsage, 0, len(order))
+	for _, key := range order {
+		t := totals[key]
+		if t.usage.Requests > 0 {
+			t.usage.ErrorRate = round4(float64(t.usage.ClientErrors+t.usage.ServerErrors) / float64(t.usage.Requests))
+			t.usage.LatencyMs.Avg = round1(t.totalMs / float64(t.usage.Requests))
+		}
+		t.usage.LatencyMs.P50 = percentile(t.buckets, latencyBounds, 0.50, t.usage.LatencyMs.Max)
+		t.usage.LatencyMs.P95 = percentile(t.buckets, latencyBounds, 0.95, t.usage.LatencyMs.Max)
+		t.usage.LatencyMs.P99 = percentile(t.buckets, latencyBounds, 0.99, t.usage.LatencyMs.Max)
+		t.usage.LatencyMs.Max = round1(t.usage.LatencyMs.Max)
+		usage = append(usage, t.usage)
+	}
+
+	slices.SortStableFunc(usage, func(a, b domain.ClientUsage) int {
+		if a.Day != b.Day {
+			return cmp.Compare(b.Day, a.Day) // the latest day first
+		}
+		return cmp.Compare(b.Requests, a.Requests)
+	})
+
+	return usage, nil
+}
+
+// percentile estimates a percentile from a histogram with the upper bounds
+// bounds, interpolating within its bucket. It never exceeds the largest
+// value observed.
+func percentile(buckets []int64, bounds []float64, p float64, largest float64) float64 {
+	var count int64
+	for _, n := range buckets {
+		count += n
+	}
+	if count == 0 {
+		return 0
+	}
+
+	rank := p * float64(count)
+	var seen int64
+	for i, n := range buckets {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = bounds[i-1]
+		}
+		upper := largest
+		if i < len(bounds) {
+			upper = min(bounds[i], largest)
+		}
+		fraction := (rank - float64(seen)) / float64(n)
+		return round1(math.Max(lower+(upper-lower)*fraction, 0))
+	}
+	return round1(largest)
+}
+
+func round4(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
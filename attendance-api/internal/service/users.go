@@ -0,0 +1,565 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUserExists         = errors.New("username is already taken")
+	ErrInvalidRole        = errors.New("unknown role")
+	ErrWeakPassword       = errors.New("password must be 8 to 72 characters long")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+)
+
+// tokenIssuer is the iss claim of the access tokens
+const tokenIssuer = "attendance-api"
+
+// jwtHeader is the encoded header of every access token: HMAC-SHA256
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// UserService keeps user accounts and issues their tokens: short-lived JWT
+// access tokens with the user's role, and refresh tokens that are stored
+// hashed and rotated on every use
+type UserService struct {
+	db         *sql.DB
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	roles      map[string][]string // role policy: scopes of each role
+
+	dummyHash []byte // compared against for unknown users, to take as long
+
+	logger *slog.Logger
+}
+
+// accessClaims are the claims of an access token
+type accessClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	Tenant    string `json:"tenant,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func NewUserService(db *sql.DB, cfg config.AuthConfig) (*UserService, error) {
+	secret := []byte(cfg.JWTSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate JWT secret: %w", err)
+		}
+		logging.Component("users").Warn("JWT_SECRET is not set, signed-in users must sign in again after a restart")
+	} else if len(secret) < 32 {
+		return nil, fmt.Errorf("JWT_SECRET must be at least 32 bytes")
+	}
+
+	roles, err := parseRoles(cfg.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte(uuid.New().String()), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	service := &UserService{
+		logger:     logging.Component("users"),
+		db:         db,
+		secret:     secret,
+		accessTTL:  cfg.AccessTokenTTL,
+		refreshTTL: cfg.RefreshTokenTTL,
+		roles:      roles,
+		dummyHash:  dummyHash,
+	}
+
+	if err := service.initSchema(); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	return service, nil
+}
+
+// parseRoles builds the role policy from the built-in roles and the
+// "role=scope|scope" entries that redefine them or add roles
+func parseRoles(entries []string) (map[string][]string, error) {
+	roles := make(map[string][]string, len(domain.RoleScopes))
+	for role, scopes := range domain.RoleScopes {
+		roles[role] = scopes
+	}
+
+	for _, entry := range entries {
+		role, list, ok := strings.Cut(entry, "=")
+		role = strings.TrimSpace(role)
+		if !ok || role == "" {
+			return nil, fmt.Errorf("invalid role %q, expected role=scope|scope", entry)
+		}
+		if role == domain.RoleAdmin {
+			return nil, fmt.Errorf("the admin role has every scope and cannot be redefined")
+		}
+
+		scopes := []string{}
+		for _, scope := range strings.Split(list, "|") {
+			scope = strings.TrimSpace(scope)
+			if scope == "" {
+				continue
+			}
+			if !slices.Contains(domain.AllScopes, scope) {
+				return nil, fmt.Errorf("unknown scope %q for role %s", scope, role)
+			}
+			scopes = append(scopes, scope)
+		}
+		roles[role] = scopes
+	}
+	return roles, nil
+}
+
+// Scopes returns the scopes the policy grants a role
+func (s *UserService) Scopes(role string) ([]string, bool) {
+	scopes, ok := s.roles[role]
+	return scopes, ok
+}
+
+// Roles lists the role policy by name
+func (s *UserService) Roles() []domain.Role {
+	roles := make([]domain.Role, 0, len(s.roles))
+	for name, scopes := range s.roles {
+		_, builtin := domain.RoleScopes[name]
+		roles = append(roles, domain.Role{Name: name, Scopes: scopes, Builtin: builtin})
+	}
+	slices.SortFunc(roles, func(a, b domain.Role) int { return strings.Compare(a.Name, b.Name) })
+	return roles
+}
+
+func (s *UserService) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS users (
+		id TEXT PRIMARY KEY,
+		username TEXT NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		role TEXT NOT NULL,
+		tenant TEXT NOT NULL DEFAULT '',
+		disabled BOOLEAN NOT NULL DEFAULT 0,
+		last_login_at DATETIME,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens(user_id);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+	return nil
+}
+
+// Create adds a user account
+func (s *UserService) Create(username, password, role, tenant string) (*domain.User, error) {
+	if _, ok := s.roles[role]; !ok {
+		return nil, ErrInvalidRole
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &domain.User{
+		ID:        uuid.New().String(),
+		Username:  username,
+		Role:      role,
+		Tenant:    tenant,
+		CreatedAt: time.Now(),
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO users (id, username, password_hash, role, tenant, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, user.ID, user.Username, hash, user.Role, user.Tenant, user.CreatedAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return nil, ErrUserExists
+		}
+		return nil, fmt.Errorf("failed to insert user: %w", err)
+	}
+
+	return user, nil
+}
+
+const userColumns = `id, username, role, tenant, disabled, last_login_at, created_at`
+
+func (s *UserService) List() ([]domain.User, error) {
+	rows, err := s.db.Query("SELECT " + userColumns + " FROM users ORDER BY username")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []domain.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return users, nil
+}
+
+func (s *UserService) Get(id string) (*domain.User, error) {
+	user, err := scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
+
+// Update changes the password, role, tenant or disabled state of a user.
+// Nil arguments are left untouched. A new password or disabling the user
+// signs them out everywhere; a new role applies from the next refresh.
+func (s *UserService) Update(id string, password, role, tenant *string, disabled *bool) (*domain.User, error) {
+	user, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if role != nil {
+		if _, ok := s.roles[*role]; !ok {
+			return nil, ErrInvalidRole
+		}
+		user.Role = *role
+	}
+	if tenant != nil {
+		user.Tenant = *tenant
+	}
+	if disabled != nil {
+		user.Disabled = *disabled
+	}
+
+	var hash string
+	if password != nil {
+		if hash, err = hashPassword(*password); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE users SET role = ?, tenant = ?, disabled = ?, password_hash = COALESCE(NULLIF(?, ''), password_hash)
+		WHERE id = ?
+	`, user.Role, user.Tenant, user.Disabled, hash, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if password != nil || user.Disabled {
+		if err := s.revokeAll(user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// Delete removes a user and their refresh tokens
+func (s *UserService) Delete(id string) error {
+	result, err := s.db.Exec("DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+
+	if _, err := s.db.Exec("DELETE FROM refresh_tokens WHERE user_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete refresh tokens: %w", err)
+	}
+	if _, err := s.db.Exec("DELETE FROM webauthn_credentials WHERE user_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete security keys: %w", err)
+	}
+	return nil
+}
+
+// Login checks a username and password and issues a token pair
+func (s *UserService) Login(username, password string) (*domain.User, *domain.TokenPair, error) {
+	var hash string
+	row := s.db.QueryRow("SELECT "+userColumns+", password_hash FROM users WHERE username = ?", username)
+	user, err := scanUser(row, &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Compare anyway, so unknown usernames cannot be told apart by timing
+		bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		return nil, nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil || user.Disabled {
+		return nil, nil, ErrInvalidCredentials
+	}
+	if _, ok := s.roles[user.Role]; !ok {
+		s.logger.Warn("User has a role AUTH_ROLES no longer defines", "username", user.Username, "role", user.Role)
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	now := time.Now()
+	if _, err := s.db.Exec("UPDATE users SET last_login_at = ? WHERE id = ?", now, user.ID); err != nil {
+		return nil, nil, fmt.Errorf("failed to update last login: %w", err)
+	}
+	user.LastLoginAt = &now
+
+	tokens, err := s.issue(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+// Refresh exchanges a refresh token for a new pair. Each refresh token works
+// once; presenting one that was already exchanged revokes every token of
+// its user, as it was probably stolen.
+func (s *UserService) Refresh(refreshToken string) (*domain.User, *domain.TokenPair, error) {
+	var (
+		id, userID string
+		expiresAt  time.Time
+		revokedAt  sql.NullTime
+	)
+	err := s.db.QueryRow("SELECT id, user_id, expires_at, revoked_at FROM refresh_tokens WHERE token_hash = ?",
+		hashToken(refreshToken)).Scan(&id, &userID, &expiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query refresh token: %w", err)
+	}
+
+	if revokedAt.Valid {
+		s.logger.Warn("Refresh token used again, signing the user out everywhere", "user", userID)
+		if err := s.revokeAll(userID); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidToken
+	}
+	if time.Now().After(expiresAt) {
+		return nil, nil, ErrInvalidToken
+	}
+
+	user, err := s.Get(userID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, ok := s.roles[user.Role]; user.Disabled || !ok {
+		return nil, nil, ErrInvalidToken
+	}
+
+	if _, err := s.db.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE id = ?", time.Now(), id); err != nil {
+		return nil, nil, fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+
+	tokens, err := s.issue(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+// Logout revokes a refresh token. The access tokens already issued stay
+// valid until they expire.
+func (s *UserService) Logout(refreshToken string) error {
+	_, err := s.db.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE token_hash = ? AND revoked_at IS NULL",
+		time.Now(), hashToken(refreshToken))
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	return nil
+}
+
+// Authenticate verifies an access token and returns its user with the role
+// the token was issued with. Disabled and deleted users are refused at once.
+func (s *UserService) Authenticate(token string) (*domain.User, error) {
+	claims, err := s.verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.Get(claims.Subject)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrInvalidToken
+	}
+
+	user.Role = claims.Role
+	user.Tenant = claims.Tenant
+	return user, nil
+}
+
+// issue signs an access token for the user and stores a new refresh token
+func (s *UserService) issue(user *domain.User) (*domain.TokenPair, error) {
+	now := time.Now()
+	claims, err := json.Marshal(accessClaims{
+		Issuer:    tokenIssuer,
+		Subject:   user.ID,
+		Name:      user.Username,
+		Role:      user.Role,
+		Tenant:    user.Tenant,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.accessTTL).Unix(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode claims: %w", err)
+	}
+	payload := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	refreshToken := "rt_" + hex.EncodeToString(raw)
+	refreshExpiresAt := now.Add(s.refreshTTL)
+
+	_, err = s.db.Exec(`
+		INSERT INTO refresh_tokens (id, user_id, token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, uuid.New().String(), user.ID, hashToken(refreshToken), refreshExpiresAt, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+
+	return &domain.TokenPair{
+		AccessToken:      payload + "." + s.sign(payload),
+		TokenType:        "Bearer",
+		ExpiresIn:        int(s.accessTTL.Seconds()),
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// verify checks the signature, issuer and expiry of an access token
+func (s *UserService) verify(token string) (*accessClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, ErrInvalidToken
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(s.sign(payload))) {
+		return nil, ErrInvalidToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims accessClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Issuer != tokenIssuer || time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrInvalidToken
+	}
+	if _, ok := s.roles[claims.Role]; !ok {
+		return nil, ErrInvalidToken
+	}
+
+	return &claims, nil
+}
+
+func (s *UserService) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// revokeAll signs a user out everywhere
+func (s *UserService) revokeAll(userID string) error {
+	_, err := s.db.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		time.Now(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// IsAccessToken tells a JWT apart from an API key
+func IsAccessToken(secret string) bool {
+	return strings.HasPrefix(secret, jwtHeader+".")
+}
+
+func scanUser(row rowScanner, extra ...interface{}) (*domain.User, error) {
+	var (
+		user      domain.User
+		lastLogin sql.NullTime
+	)
+
+	dest := append([]interface{}{&user.ID, &user.Username, &user.Role, &user.Tenant, &user.Disabled,
+		&lastLogin, &user.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan user: %w", err)
+	}
+
+	if lastLogin.Valid {
+		user.LastLoginAt = &lastLogin.Time
+	}
+	return &user, nil
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < 8 || len(password) > 72 {
+		return "", ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"attendance-api/internal/config"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "attendance.db"), time.Local, config.DatabaseConfig{WritePoolSize: 1, BusyTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newTestUserService(t *testing.T, db *sql.DB, cfg config.AuthConfig) *UserService {
+	t.Helper()
+
+	if cfg.JWTSecret == "" {
+		cfg.JWTSecret = "0123456789abcdef0123456789abcdef"
+	}
+	s, err := NewUserService(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Create("alice", "correct-horse", "admin", ""); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Every refresh token works once. Presenting one again signs the user out
+// everywhere, including the token it was exchanged for.
+func TestRefreshRotation(t *testing.T) {
+	s := newTestUserService(t, newTestDB(t), config.AuthConfig{AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour})
+
+	_, first, err := s.Login("alice", "correct-horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(first.AccessToken); err != nil {
+		t.Fatalf("fresh access token refused: %v", err)
+	}
+
+	_, second, err := s.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+
+	if _, _, err := s.Refresh(first.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("exchanged refresh token: %v, want %v", err, ErrInvalidToken)
+	}
+	if _, _, err := s.Refresh(second.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("refresh token after a reuse: %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestExpiredTokens(t *testing.T) {
+	s := newTestUserService(t, newTestDB(t), config.AuthConfig{AccessTokenTTL: time.Second, RefreshTokenTTL: 50 * time.Millisecond})
+
+	_, tokens, err := s.Login("alice", "correct-horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+
+	if _, _, err := s.Refresh(tokens.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expired refresh token: %v, want %v", err, ErrInvalidToken)
+	}
+	if _, err := s.Authenticate(tokens.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expired access token: %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+// Access tokens signed under another JWT secret, or changed after signing,
+// are refused
+func TestForeignAccessToken(t *testing.T) {
+	db := newTestDB(t)
+	cfg := config.AuthConfig{AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour}
+	s := newTestUserService(t, db, cfg)
+
+	_, tokens, err := s.Login("alice", "correct-horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.JWTSecret = "fedcba9876543210fedcba9876543210"
+	rotated, err := NewUserService(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rotated.Authenticate(tokens.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token of another secret: %v, want %v", err, ErrInvalidToken)
+	}
+
+	tampered := []byte(tokens.AccessToken)
+	tampered[len(jwtHeader)+5] ^= 1
+	if _, err := s.Authenticate(string(tampered)); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("tampered token: %v, want %v", err, ErrInvalidToken)
+	}
+}
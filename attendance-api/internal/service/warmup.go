@@ -0,0 +1,206 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"log/slog"
+	"sync"
+	"time"
+
+	"attendance-api/internal/client"
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+)
+
+// Warm-up states reported by WarmupService
+const (
+	WarmupDisabled  = "disabled"
+	WarmupWarmingUp = "warming_up"
+	WarmupReady     = "ready"
+)
+
+// WarmupService sends a synthetic image through the recognition path so the
+// face service has loaded its model before the first real submission, and
+// reports the API ready only once that succeeded. With monitoring enabled it
+// polls the face service and warms it up again after it restarts.
+type WarmupService struct {
+	recognizer client.Recognizer
+	cfg        config.WarmupConfig
+	image      []byte
+
+	mu        sync.RWMutex
+	status    domain.WarmupStatus
+	startedAt time.Time // as reported by the face service when last warmed up
+	down      bool      // the last health check failed
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	logger *slog.Logger
+}
+
+func NewWarmupService(recognizer client.Recognizer, cfg config.WarmupConfig) (*WarmupService, error) {
+	img, err := warmupImage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create warm-up image: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &WarmupService{
+		logger:     logging.Component("warmup"),
+		recognizer: recognizer,
+		cfg:        cfg,
+		image:      img,
+		status:     domain.WarmupStatus{State: WarmupWarmingUp},
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	if !cfg.Enabled {
+		s.status = domain.WarmupStatus{Ready: true, State: WarmupDisabled}
+	}
+	return s, nil
+}
+
+// warmupImage is a plain grey JPEG: enough to run detection end to end,
+// with no face in it to match
+func warmupImage() ([]byte, error) {
+	img := image.NewGray(image.Rect(0, 0, 160, 160))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: color.Gray{Y: 128}}, image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Start warms up in the background and then, if configured, keeps watching
+// for face service restarts
+func (s *WarmupService) Start() {
+	if !s.cfg.Enabled {
+		return
+	}
+
+	go func() {
+		if !s.warmUp() {
+			return
+		}
+		if s.cfg.MonitorInterval > 0 {
+			s.monitor()
+		}
+	}()
+}
+
+// Close stops warming up and monitoring
+func (s *WarmupService) Close() {
+	s.cancel()
+}
+
+// Status reports the warm-up state; the API is ready when Ready is set
+func (s *WarmupService) Status() domain.WarmupStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status
+}
+
+// warmUp retries the synthetic recognition until it succeeds. It returns
+// false when the service was closed first.
+func (s *WarmupService) warmUp() bool {
+	s.mu.Lock()
+	s.status.Ready = false
+	s.status.State = WarmupWarmingUp
+	s.mu.Unlock()
+
+	for {
+		start := time.Now()
+		_, err := s.recognizer.RecognizeFace(s.ctx, s.image, "warmup.jpg")
+		if err == nil {
+			s.warmed(time.Since(start))
+			return true
+		}
+		if s.ctx.Err() != nil {
+			return false
+		}
+
+		s.logger.Warn("Recognition failed, retrying", "retry_in", s.cfg.RetryInterval, "error", err)
+		s.mu.Lock()
+		s.status.LastError = err.Error()
+		s.mu.Unlock()
+
+		select {
+		case <-time.After(s.cfg.RetryInterval):
+		case <-s.ctx.Done():
+			return false
+		}
+	}
+}
+
+func (s *WarmupService) warmed(took time.Duration) {
+	now := time.Now()
+
+	s.mu.Lock()
+	s.status.Ready = true
+	s.status.State = WarmupReady
+	s.status.Warmups++
+	s.status.WarmedAt = &now
+	s.status.Duration = took.Round(time.Millisecond).String()
+	s.status.LastError = ""
+	s.mu.Unlock()
+
+	s.logger.Info("Recognition path ready", "took", took.Round(time.Millisecond))
+
+	// Remember which face service process was warmed up
+	if health, err := s.recognizer.Health(s.ctx); err == nil {
+		s.mu.Lock()
+		s.startedAt = health.StartedAt
+		s.down = false
+		s.mu.Unlock()
+	}
+}
+
+// monitor polls the face service and warms it up again when it restarted:
+// it reports a different start time, or answers again after failing to
+func (s *WarmupService) monitor() {
+	ticker := time.NewTicker(s.cfg.MonitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+
+		health, err := s.recognizer.Health(s.ctx)
+		if errors.Is(err, client.ErrUnsupported) {
+			s.logger.Warn("Face backend has no health check, not watching for restarts")
+			return
+		}
+
+		s.mu.Lock()
+		if err != nil {
+			if !s.down && s.ctx.Err() == nil {
+				s.logger.Warn("Face service unreachable", "error", err)
+			}
+			s.down = true
+			s.mu.Unlock()
+			continue
+		}
+		restarted := s.down || !health.StartedAt.Equal(s.startedAt)
+		s.mu.Unlock()
+
+		if restarted {
+			s.logger.Info("Face service restarted, warming up again")
+			if !s.warmUp() {
+				return
+			}
+		}
+	}
+}
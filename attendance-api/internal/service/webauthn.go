@@ -0,0 +1,442 @@
+package service
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var (
+	ErrWebAuthnDisabled   = errors.New("WebAuthn is not configured")
+	ErrStepUpRequired     = errors.New("step-up authentication required")
+	ErrNoAuthenticators   = errors.New("no security key is registered for this user")
+	ErrCeremonyExpired    = errors.New("no pending WebAuthn ceremony, begin again")
+	ErrCredentialNotFound = errors.New("security key not found")
+	ErrWebAuthnFailed     = errors.New("WebAuthn verification failed")
+)
+
+// WebAuthn ceremony kinds
+const (
+	ceremonyRegister = "register"
+	ceremonyStepUp   = "step-up"
+)
+
+// WebAuthnService keeps the security keys and passkeys users register and
+// checks the assertions that step up their session before destructive
+// actions. Pending ceremonies and step-ups are kept in memory, so they
+// must complete on the instance they began on.
+type WebAuthnService struct {
+	db        *sql.DB
+	webAuthn  *webauthn.WebAuthn // nil when WebAuthn is not configured
+	stepUpTTL time.Duration
+
+	mu         sync.Mutex
+	ceremonies map[string]*webauthn.SessionData // by kind and user ID
+	stepUps    map[string]stepUp                // by token hash
+
+	logger *slog.Logger
+}
+
+type stepUp struct {
+	userID    string
+	expiresAt time.Time
+}
+
+// webAuthnUser presents a user and their credentials to the library
+type webAuthnUser struct {
+	user        *domain.User
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte                         { return []byte(u.user.ID) }
+func (u *webAuthnUser) WebAuthnName() string                       { return u.user.Username }
+func (u *webAuthnUser) WebAuthnDisplayName() string                { return u.user.Username }
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+func NewWebAuthnService(db *sql.DB, cfg config.WebAuthnConfig) (*WebAuthnService, error) {
+	service := &WebAuthnService{
+		logger:     logging.Component("webauthn"),
+		db:         db,
+		stepUpTTL:  cfg.StepUpTTL,
+		ceremonies: make(map[string]*webauthn.SessionData),
+		stepUps:    make(map[string]stepUp),
+	}
+
+	if cfg.RPID != "" {
+		origins := cfg.Origins
+		if len(origins) == 0 {
+			origins = []string{"https://" + cfg.RPID}
+		}
+
+		webAuthn, err := webauthn.New(&webauthn.Config{
+			RPID:          cfg.RPID,
+			RPDisplayName: cfg.RPName,
+			RPOrigins:     origins,
+			Timeouts: webauthn.TimeoutsConfig{
+				Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: 2 * time.Minute, TimeoutUVD: 2 * time.Minute},
+				Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: 5 * time.Minute, TimeoutUVD: 5 * time.Minute},
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid WebAuthn configuration: %w", err)
+		}
+		service.webAuthn = webAuthn
+	}
+
+	if err := service.initSchema(); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	return service, nil
+}
+
+func (s *WebAuthnService) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS webauthn_credentials (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		credential TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		last_used_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user ON webauthn_credentials(user_id);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+	return nil
+}
+
+// Enabled reports whether WebAuthn is configured, and so whether step-up
+// is required
+func (s *WebAuthnService) Enabled() bool {
+	return s.webAuthn != nil
+}
+
+// Credentials lists the security keys of a user
+func (s *WebAuthnService) Credentials(userID string) ([]domain.WebAuthnCredential, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, created_at, last_used_at FROM webauthn_credentials
+		WHERE user_id = ? ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query security keys: %w", err)
+	}
+	defer rows.Close()
+
+	credentials := []domain.WebAuthnCredential{}
+	for rows.Next() {
+		var (
+			credential domain.WebAuthnCredential
+			lastUsed   sql.NullTime
+		)
+		if err := rows.Scan(&credential.ID, &credential.Name, &credential.CreatedAt, &lastUsed); err != nil {
+			return nil, fmt.Errorf("failed to scan security key: %w", err)
+		}
+		if lastUsed.Valid {
+			credential.LastUsedAt = &lastUsed.Time
+		}
+		credentials = append(credentials, credential)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return credentials, nil
+}
+
+// BeginRegistration starts registering a security key for a user. Adding a
+// key to a user who already has one needs a step-up with an existing key,
+// so a stolen password alone cannot add one.
+func (s *WebAuthnService) BeginRegistration(user *domain.User, stepUpToken string) (*protocol.CredentialCreation, error) {
+	if !s.Enabled() {
+		return nil, ErrWebAuthnDisabled
+	}
+
+	wu, err := s.loadUser(user)
+	if err != nil {
+		return nil, err
+	}
+	if len(wu.credentials) > 0 && !s.hasStepUp(user.ID, stepUpToken) {
+		return nil, ErrStepUpRequired
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(wu.credentials))
+	for _, credential := range wu.credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, session, err := s.webAuthn.BeginRegistration(wu,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementDiscouraged))
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin registration: %w", err)
+	}
+
+	s.putCeremony(ceremonyRegister, user.ID, session)
+	return creation, nil
+}
+
+// FinishRegistration verifies the authenticator's response to the pending
+// registration and stores the new key under name
+func (s *WebAuthnService) FinishRegistration(user *domain.User, name string, response []byte) (*domain.WebAuthnCredential, error) {
+	if !s.Enabled() {
+		return nil, ErrWebAuthnDisabled
+	}
+
+	session := s.takeCeremony(ceremonyRegister, user.ID)
+	if session == nil {
+		return nil, ErrCeremonyExpired
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrWebAuthnFailed, protocolDetails(err))
+	}
+
+	wu, err := s.loadUser(user)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := s.webAuthn.CreateCredential(wu, *session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrWebAuthnFailed, protocolDetails(err))
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode security key: %w", err)
+	}
+
+	if name == "" {
+		name = "Security key"
+	}
+	stored := &domain.WebAuthnCredential{
+		ID:        base64.RawURLEncoding.EncodeToString(credential.ID),
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO webauthn_credentials (id, user_id, name, credential, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, stored.ID, user.ID, stored.Name, string(data), stored.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert security key: %w", err)
+	}
+
+	s.logger.Info("Security key registered", "username", user.Username, "key", stored.Name)
+	return stored, nil
+}
+
+// DeleteCredential removes a security key of a user, which needs a step-up
+func (s *WebAuthnService) DeleteCredential(user *domain.User, id, stepUpToken string) error {
+	if !s.hasStepUp(user.ID, stepUpToken) {
+		return ErrStepUpRequired
+	}
+
+	result, err := s.db.Exec("DELETE FROM webauthn_credentials WHERE id = ? AND user_id = ?", id, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to delete security key: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrCredentialNotFound
+	}
+
+	s.logger.Info("Security key removed", "username", user.Username, "key", id)
+	return nil
+}
+
+// BeginStepUp starts an assertion with one of the user's security keys
+func (s *WebAuthnService) BeginStepUp(user *domain.User) (*protocol.CredentialAssertion, error) {
+	if !s.Enabled() {
+		return nil, ErrWebAuthnDisabled
+	}
+
+	wu, err := s.loadUser(user)
+	if err != nil {
+		return nil, err
+	}
+	if len(wu.credentials) == 0 {
+		return nil, ErrNoAuthenticators
+	}
+
+	assertion, session, err := s.webAuthn.BeginLogin(wu, webauthn.WithUserVerification(protocol.VerificationPreferred))
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin step-up: %w", err)
+	}
+
+	s.putCeremony(ceremonyStepUp, user.ID, session)
+	return assertion, nil
+}
+
+// FinishStepUp verifies the assertion of the pending step-up and issues a
+// step-up token for the user
+func (s *WebAuthnService) FinishStepUp(user *domain.User, response []byte) (*domain.StepUp, error) {
+	if !s.Enabled() {
+		return nil, ErrWebAuthnDisabled
+	}
+
+	session := s.takeCeremony(ceremonyStepUp, user.ID)
+	if session == nil {
+		return nil, ErrCeremonyExpired
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrWebAuthnFailed, protocolDetails(err))
+	}
+
+	wu, err := s.loadUser(user)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := s.webAuthn.ValidateLogin(wu, *session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrWebAuthnFailed, protocolDetails(err))
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(credential.ID)
+	if credential.Authenticator.CloneWarning {
+		s.logger.Warn("Security key signature counter went backwards, it may be cloned", "username", user.Username, "key", id)
+		return nil, fmt.Errorf("%w: the security key may be cloned", ErrWebAuthnFailed)
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode security key: %w", err)
+	}
+	now := time.Now()
+	_, err = s.db.Exec("UPDATE webauthn_credentials SET credential = ?, last_used_at = ? WHERE id = ? AND user_id = ?",
+		string(data), now, id, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update security key: %w", err)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate step-up token: %w", err)
+	}
+	token := "su_" + hex.EncodeToString(raw)
+	expiresAt := now.Add(s.stepUpTTL)
+
+	s.mu.Lock()
+	for hash, existing := range s.stepUps {
+		if now.After(existing.expiresAt) {
+			delete(s.stepUps, hash)
+		}
+	}
+	s.stepUps[hashToken(token)] = stepUp{userID: user.ID, expiresAt: expiresAt}
+	s.mu.Unlock()
+
+	s.logger.Info("Stepped up", "username", user.Username, "expires_at", expiresAt)
+	return &domain.StepUp{
+		Token:     token,
+		ExpiresIn: int(s.stepUpTTL.Seconds()),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// CheckStepUp decides whether a user may run a destructive action: it
+// returns nil for a valid step-up token of theirs, ErrNoAuthenticators when
+// they have no key to step up with and ErrStepUpRequired otherwise. With
+// WebAuthn not configured every user passes.
+func (s *WebAuthnService) CheckStepUp(userID, token string) error {
+	if !s.Enabled() || s.hasStepUp(userID, token) {
+		return nil
+	}
+
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM webauthn_credentials WHERE user_id = ?", userID).Scan(&count); err != nil {
+		return fmt.Errorf("failed to count security keys: %w", err)
+	}
+	if count == 0 {
+		return ErrNoAuthenticators
+	}
+	return ErrStepUpRequired
+}
+
+func (s *WebAuthnService) hasStepUp(userID, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.stepUps[hashToken(token)]
+	return ok && existing.userID == userID && time.Now().Before(existing.expiresAt)
+}
+
+// loadUser reads the stored credentials of a user
+func (s *WebAuthnService) loadUser(user *domain.User) (*webAuthnUser, error) {
+	rows, err := s.db.Query("SELECT credential FROM webauthn_credentials WHERE user_id = ?", user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query security keys: %w", err)
+	}
+	defer rows.Close()
+
+	wu := &webAuthnUser{user: user}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to scan security key: %w", err)
+		}
+		var credential webauthn.Credential
+		if err := json.Unmarshal([]byte(data), &credential); err != nil {
+			return nil, fmt.Errorf("failed to decode security key: %w", err)
+		}
+		wu.credentials = append(wu.credentials, credential)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return wu, nil
+}
+
+func (s *WebAuthnService) putCeremony(kind, userID string, session *webauthn.SessionData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ceremonies[kind+":"+userID] = session
+}
+
+// takeCeremony returns the pending ceremony once, so a response cannot be
+// replayed
+func (s *WebAuthnService) takeCeremony(kind, userID string) *webauthn.SessionData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := kind + ":" + userID
+	session := s.ceremonies[key]
+	delete(s.ceremonies, key)
+	return session
+}
+
+// protocolDetails is the reason a WebAuthn response was rejected
+func protocolDetails(err error) string {
+	var perr *protocol.Error
+	if errors.As(err, &perr) && perr.Details != "" {
+		return perr.Details
+	}
+	return err.Error()
+}
@@ -0,0 +1,849 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+	"attendance-api/internal/logging"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrWebhookNotFound     = errors.New("webhook not found")
+	ErrInvalidWebhookURL   = errors.New("url must be an absolute http or https URL")
+	ErrInvalidWebhookEvent = errors.New("unknown webhook event type")
+)
+
+const (
+	// webhookPoll is how often due deliveries are looked for when no new
+	// event wakes the sender up
+	webhookPoll = time.Second
+	// webhookBatch bounds the deliveries sent at once
+	webhookBatch = 20
+	// maxWebhookBackoff caps the wait between two attempts
+	maxWebhookBackoff = time.Hour
+)
+
+// webhookTarget is what sending to a webhook takes, cached in memory so
+// emitting events needs no query
+type webhookTarget struct {
+	domain.Webhook
+	secret string
+}
+
+// queuedEvent is an event waiting to be stored as deliveries
+type queuedEvent struct {
+	event domain.WebhookEvent
+	hooks []string
+}
+
+// WebhookService POSTs attendance and unknown-person events to the webhooks
+// registered by external systems, signed with each webhook's secret. Events
+// are stored as deliveries before they are sent, so failed deliveries are
+// retried with exponential backoff, across restarts too, and every attempt
+// is logged for debugging the receivers.
+type WebhookService struct {
+	db         *sql.DB
+	reads      *sql.DB
+	cfg        config.WebhookConfig
+	httpClient *http.Client
+	retention  atomic.Int64 // nanoseconds of cfg.Retention, which Reconfigure changes
+
+	mu      sync.RWMutex
+	targets []webhookTarget
+
+	queue  chan queuedEvent
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	logger *slog.Logger
+}
+
+func NewWebhookService(db, reads *sql.DB, cfg config.WebhookConfig) (*WebhookService, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	service := &WebhookService{
+		logger:     logging.Component("webhooks"),
+		db:         db,
+		reads:      reads,
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: cfg.Timeout},
+		queue:      make(chan queuedEvent, max(cfg.QueueSize, 1)),
+		wake:       make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	service.retention.Store(int64(cfg.Retention))
+
+	if err := service.initSchema(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	if err := service.loadTargets(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	service.wg.Add(2)
+	go service.store()
+	go service.send()
+
+	return service, nil
+}
+
+// Reconfigure applies a changed delivery log retention from the next
+// hourly prune
+func (s *WebhookService) Reconfigure(cfg config.WebhookConfig) {
+	if old := time.Duration(s.retention.Swap(int64(cfg.Retention))); old != cfg.Retention {
+		s.logger.Info("Retention changed", "retention", cfg.Retention, "was", old)
+	}
+}
+
+func (s *WebhookService) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id TEXT PRIMARY KEY,
+		url TEXT NOT NULL,
+		events TEXT NOT NULL DEFAULT '',
+		secret TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		active INTEGER NOT NULL DEFAULT 1,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id TEXT PRIMARY KEY,
+		webhook_id TEXT NOT NULL,
+		event_id TEXT NOT NULL,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt DATETIME,
+		created_at DATETIME NOT NULL,
+		delivered_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at);
+
+	CREATE TABLE IF NOT EXISTS webhook_attempts (
+		delivery_id TEXT NOT NULL,
+		attempt INTEGER NOT NULL,
+		attempted_at DATETIME NOT NULL,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		latency_ms INTEGER NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (delivery_id, attempt)
+	);
+	`
+
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+	return nil
+}
+
+// Close stops sending. Queued events are still stored, to be sent after a
+// restart, as are deliveries waiting for a retry.
+func (s *WebhookService) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Reload reads the registered webhooks again, for when they changed under
+// the service, as on a standby that replicated them and was promoted
+func (s *WebhookService) Reload() error {
+	return s.loadTargets()
+}
+
+func (s *WebhookService) loadTargets() error {
+	rows, err := s.db.Query(`
+		SELECT id, url, events, description, active, created_at, secret
+		FROM webhooks
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var targets []webhookTarget
+	for rows.Next() {
+		var target webhookTarget
+		hook, err := scanWebhook(rows, &target.secret)
+		if err != nil {
+			return err
+		}
+		target.Webhook = *hook
+		targets = append(targets, target)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("row iteration error: %w", err)
+	}
+
+	s.mu.Lock()
+	s.targets = targets
+	s.mu.Unlock()
+	return nil
+}
+
+func scanWebhook(row rowScanner, extra ...interface{}) (*domain.Webhook, error) {
+	var (
+		hook   domain.Webhook
+		events string
+	)
+	dest := append([]interface{}{&hook.ID, &hook.URL, &events, &hook.Description, &hook.Active, &hook.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	hook.Events = splitList(events)
+	return &hook, nil
+}
+
+func splitList(value string) []string {
+	items := []string{}
+	if value != "" {
+		items = strings.Split(value, ",")
+	}
+	return items
+}
+
+func validateWebhook(rawURL string, events []string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+	for _, event := range events {
+		if !slices.Contains(domain.WebhookEventTypes, event) {
+			return fmt.Errorf("%w %q", ErrInvalidWebhookEvent, event)
+		}
+	}
+	return nil
+}
+
+// Create registers a webhook for the event types, every type when there are
+// none. Without a secret one is generated; it is returned only here.
+func (s *WebhookService) Create(rawURL string, events []string, description, secret string) (*domain.Webhook, string, error) {
+	if err := validateWebhook(rawURL, events); err != nil {
+		return nil, "", err
+	}
+
+	if secret == "" {
+		raw := make([]byte, 24)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, "", fmt.Errorf("failed to generate secret: %w", err)
+		}
+		secret = "whsec_" + hex.EncodeToString(raw)
+	}
+
+	hook := &domain.Webhook{
+		ID:          uuid.New().String(),
+		URL:         rawURL,
+		Events:      append([]string{}, events...),
+		Description: description,
+		Active:      true,
+		CreatedAt:   time.Now(),
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO webhooks (id, url, events, secret, description, active, created_at)
+		VALUES (?, ?, ?, ?, ?, 1, ?)
+	`, hook.ID, hook.URL, strings.Join(hook.Events, ","), secret, hook.Description, hook.CreatedAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to insert webhook: %w", err)
+	}
+
+	if err := s.loadTargets(); err != nil {
+		return nil, "", err
+	}
+	s.logger.Info("Webhook registered", "url", hook.URL, "events", describeEvents(hook.Events))
+	return hook, secret, nil
+}
+
+func describeEvents(events []string) string {
+	if len(events) == 0 {
+		return "every event"
+	}
+	return strings.Join(events, ", ")
+}
+
+func (s *WebhookService) List() ([]domain.Webhook, error) {
+	rows, err := s.reads.Query(`
+		SELECT id, url, events, description, active, created_at
+		FROM webhooks
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	hooks := make([]domain.Webhook, 0)
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		hooks = append(hooks, *hook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return hooks, nil
+}
+
+func (s *WebhookService) Get(id string) (*domain.Webhook, error) {
+	row := s.db.QueryRow(`
+		SELECT id, url, events, description, active, created_at
+		FROM webhooks
+		WHERE id = ?
+	`, id)
+
+	hook, err := scanWebhook(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	return hook, nil
+}
+
+// Update changes the URL, event types, description or state of a webhook.
+// Nil arguments are left untouched. Pausing a webhook stops new deliveries;
+// pending ones are still retried.
+func (s *WebhookService) Update(id string, rawURL *string, events []string, description *string, active *bool) (*domain.Webhook, error) {
+	hook, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if rawURL != nil {
+		hook.URL = *rawURL
+	}
+	if events != nil {
+		hook.Events = events
+	}
+	if description != nil {
+		hook.Description = *description
+	}
+	if active != nil {
+		hook.Active = *active
+	}
+	if err := validateWebhook(hook.URL, hook.Events); err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec("UPDATE webhooks SET url = ?, events = ?, description = ?, active = ? WHERE id = ?",
+		hook.URL, strings.Join(hook.Events, ","), hook.Description, hook.Active, hook.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update webhook: %w", err)
+	}
+
+	if err := s.loadTargets(); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+// Delete removes a webhook with its deliveries, sent or not
+func (s *WebhookService) Delete(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrWebhookNotFound
+	}
+	_, err = tx.Exec(`
+		DELETE FROM webhook_attempts
+		WHERE delivery_id IN (SELECT id FROM webhook_deliveries WHERE webhook_id = ?)
+	`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook attempts: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete webhook deliveries: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+
+	return s.loadTargets()
+}
+
+// Emit queues an event for the active webhooks subscribed to its type. It
+// never blocks; when the queue is full the event is dropped and logged.
+func (s *WebhookService) Emit(event string, data interface{}) {
+	if s == nil {
+		return
+	}
+
+	var hooks []string
+	s.mu.RLock()
+	for _, target := range s.targets {
+		if target.Active && (len(target.Events) == 0 || slices.Contains(target.Events, event)) {
+			hooks = append(hooks, target.ID)
+		}
+	}
+	s.mu.RUnlock()
+	if len(hooks) == 0 {
+		return
+	}
+
+	queued := queuedEvent{
+		event: domain.WebhookEvent{ID: uuid.New().String(), Event: event, CreatedAt: time.Now(), Data: data},
+		hooks: hooks,
+	}
+	select {
+	case s.queue <- queued:
+	default:
+		s.logger.Warn("Queue full, dropped event", "event", event)
+	}
+}
+
+// store turns queued events into deliveries, one per webhook
+func (s *WebhookService) store() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case queued := <-s.queue:
+			s.storeEvent(queued)
+		case <-s.ctx.Done():
+			// What was emitted before shutting down is sent after a restart
+			for {
+				select {
+				case queued := <-s.queue:
+					s.storeEvent(queued)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *WebhookService) storeEvent(queued queuedEvent) {
+	payload, err := json.Marshal(queued.event)
+	if err != nil {
+		s.logger.Error("Failed to encode event", "event", queued.event.Event, "error", err)
+		return
+	}
+
+	for _, hookID := range queued.hooks {
+		_, err := s.db.Exec(`
+			INSERT INTO webhook_deliveries (id, webhook_id, event_id, event, payload, status, attempts, next_attempt, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, 0, ?, ?)
+		`, uuid.New().String(), hookID, queued.event.ID, queued.event.Event, string(payload),
+			domain.DeliveryPending, queued.event.CreatedAt, queued.event.CreatedAt)
+		if err != nil {
+			s.logger.Error("Failed to store delivery", "event", queued.event.Event, "error", err)
+		}
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dueDelivery is a delivery whose next attempt is due
+type dueDelivery struct {
+	id       string
+	payload  []byte
+	event    string
+	attempts int
+	target   webhookTarget
+}
+
+// send delivers what is due, whenever events are stored and at least every
+// webhookPoll, and prunes the delivery log every hour
+func (s *WebhookService) send() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(webhookPoll)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+
+		due, err := s.dueDeliveries()
+		if err != nil {
+			s.logger.Error("Failed to load due deliveries", "error", err)
+			continue
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range due {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.attempt(delivery)
+			}()
+		}
+		wg.Wait()
+
+		if s.retention.Load() > 0 && time.Since(lastPrune) >= time.Hour {
+			s.prune()
+			lastPrune = time.Now()
+		}
+	}
+}
+
+func (s *WebhookService) dueDeliveries() ([]dueDelivery, error) {
+	rows, err := s.db.Query(`
+		SELECT id, webhook_id, event, payload, attempts
+		FROM webhook_deliveries
+		WHERE status = ? AND next_attempt <= ?
+		ORDER BY next_attempt
+		LIMIT ?
+	`, domain.DeliveryPending, time.Now(), webhookBatch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	s.mu.RLock()
+	targets := make(map[string]webhookTarget, len(s.targets))
+	for _, target := range s.targets {
+		targets[target.ID] = target
+	}
+	s.mu.RUnlock()
+
+	var due []dueDelivery
+	for rows.Next() {
+		var (
+			delivery dueDelivery
+			hookID   string
+			payload  string
+		)
+		if err := rows.Scan(&delivery.id, &hookID, &delivery.event, &payload, &delivery.attempts); err != nil {
+			return nil, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		target, ok := targets[hookID]
+		if !ok {
+			continue // removed meanwhile
+		}
+		delivery.payload = []byte(payload)
+		delivery.target = target
+		due = append(due, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return due, nil
+}
+
+// attempt sends a delivery once, logs the attempt and schedules the next
+// one when it failed and attempts are left
+func (s *WebhookService) attempt(delivery dueDelivery) {
+	number := delivery.attempts + 1
+	attempt := s.post(s.ctx, delivery.target, delivery.id, delivery.event, number, delivery.payload)
+
+	status := domain.DeliveryPending
+	var next, delivered *time.Time
+	switch {
+	case attempt.Error == "":
+		status = domain.DeliveryDelivered
+		delivered = &attempt.AttemptedAt
+	case number >= s.cfg.MaxAttempts:
+		status = domain.DeliveryFailed
+		s.logger.Error("Giving up on delivery", "event", delivery.event, "url", delivery.target.URL,
+			"attempts", number, "error", attempt.Error)
+	default:
+		at := time.Now().Add(s.backoff(number))
+		next = &at
+	}
+
+	if err := s.logAttempt(delivery.id, attempt, status, next, delivered); err != nil {
+		s.logger.Error("Failed to log attempt", "error", err)
+	}
+}
+
+// backoff is the wait after the given failed attempt
+func (s *WebhookService) backoff(attempt int) time.Duration {
+	wait := s.cfg.RetryBackoff
+	for i := 1; i < attempt && wait < maxWebhookBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxWebhookBackoff)
+}
+
+// post sends a signed event to a webhook. Only a 2xx answer counts as
+// delivered.
+func (s *WebhookService) post(ctx context.Context, target webhookTarget, deliveryID, event string, number int, payload []byte) domain.WebhookAttempt {
+	attempt := domain.WebhookAttempt{Attempt: number, AttemptedAt: time.Now()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.URL, bytes.NewReader(payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "attendance-api-webhooks")
+	req.Header.Set("X-Webhook-Event", event)
+	req.Header.Set("X-Webhook-Delivery", deliveryID)
+	req.Header.Set("X-Webhook-Attempt", fmt.Sprint(number))
+	req.Header.Set("X-Signature", SignWebhook(target.secret, payload))
+
+	resp, err := s.httpClient.Do(req)
+	attempt.LatencyMs = time.Since(attempt.AttemptedAt).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return attempt
+}
+
+// SignWebhook returns the X-Signature header of a webhook body: the hex
+// HMAC-SHA256 of the body with the webhook's secret
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *WebhookService) logAttempt(deliveryID string, attempt domain.WebhookAttempt, status string, next, delivered *time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO webhook_attempts (delivery_id, attempt, attempted_at, status_code, latency_ms, error)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, deliveryID, attempt.Attempt, attempt.AttemptedAt, attempt.StatusCode, attempt.LatencyMs, attempt.Error)
+	if err != nil {
+		return fmt.Errorf("failed to log delivery attempt: %w", err)
+	}
+	_, err = tx.Exec(`
+		UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt = ?, delivered_at = ?
+		WHERE id = ?
+	`, status, attempt.Attempt, next, delivered, deliveryID)
+	if err != nil {
+		return fmt.Errorf("failed to update delivery: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit delivery attempt: %w", err)
+	}
+	return nil
+}
+
+func (s *WebhookService) prune() {
+	retention := time.Duration(s.retention.Load())
+	cutoff := time.Now().Add(-retention)
+
+	_, err := s.db.Exec(`
+		DELETE FROM webhook_attempts WHERE delivery_id IN (
+			SELECT id FROM webhook_deliveries WHERE status != ? AND created_at < ?
+		)
+	`, domain.DeliveryPending, cutoff)
+	if err != nil {
+		s.logger.Error("Failed to prune delivery log", "error", err)
+		return
+	}
+	result, err := s.db.Exec("DELETE FROM webhook_deliveries WHERE status != ? AND created_at < ?", domain.DeliveryPending, cutoff)
+	if err != nil {
+		s.logger.Error("Failed to prune delivery log", "error", err)
+	} else if n, _ := result.RowsAffected(); n > 0 {
+		s.logger.Info("Pruned deliveries", "deliveries", n, "retention", retention)
+	}
+}
+
+// sampleRecord is the data of test events
+var sampleRecord = domain.AttendanceRecord{
+	ID:         "00000000-0000-0000-0000-000000000000",
+	Name:       "john_doe",
+	Confidence: 95.23,
+	Status:     "authorized",
+	EventType:  "check_in",
+	DeviceID:   "door-1",
+	Location:   "main-entrance",
+}
+
+// Test sends a sample signed event to a webhook right away, whatever the
+// event types and state of the webhook, and returns its delivery. The test
+// is not retried but is logged like other deliveries.
+func (s *WebhookService) Test(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+	var target webhookTarget
+	row := s.db.QueryRow(`
+		SELECT id, url, events, description, active, created_at, secret
+		FROM webhooks
+		WHERE id = ?
+	`, id)
+	hook, err := scanWebhook(row, &target.secret)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	target.Webhook = *hook
+
+	record := sampleRecord
+	record.Timestamp = time.Now()
+	event := domain.WebhookEvent{ID: uuid.New().String(), Event: domain.WebhookTest, CreatedAt: record.Timestamp, Data: record}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode test event: %w", err)
+	}
+
+	delivery := domain.WebhookDelivery{
+		ID:        uuid.New().String(),
+		WebhookID: id,
+		EventID:   event.ID,
+		Event:     event.Event,
+		Status:    domain.DeliveryPending,
+		CreatedAt: event.CreatedAt,
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO webhook_deliveries (id, webhook_id, event_id, event, payload, status, attempts, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, 0, ?)
+	`, delivery.ID, id, delivery.EventID, delivery.Event, string(payload), domain.DeliveryPending, delivery.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store test delivery: %w", err)
+	}
+
+	attempt := s.post(ctx, target, delivery.ID, delivery.Event, 1, payload)
+	delivery.Status = domain.DeliveryFailed
+	if attempt.Error == "" {
+		delivery.Status = domain.DeliveryDelivered
+		delivery.DeliveredAt = &attempt.AttemptedAt
+	}
+	if err := s.logAttempt(delivery.ID, attempt, delivery.Status, nil, delivery.DeliveredAt); err != nil {
+		return nil, err
+	}
+
+	delivery.Attempts = 1
+	delivery.Log = []domain.WebhookAttempt{attempt}
+	return &delivery, nil
+}
+
+// Deliveries returns the latest deliveries to a webhook, newest first, with
+// their attempts; status, when set, limits them to that state
+func (s *WebhookService) Deliveries(id, status string, limit int) ([]domain.WebhookDelivery, error) {
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.reads.Query(`
+		SELECT id, webhook_id, event_id, event, status, attempts, next_attempt, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE webhook_id = ? AND (? = '' OR status = ?)
+		ORDER BY created_at DESC
+		LIMIT ?
+	`, id, status, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]domain.WebhookDelivery, 0)
+	index := make(map[string]int)
+	for rows.Next() {
+		var (
+			delivery  domain.WebhookDelivery
+			next      sql.NullTime
+			delivered sql.NullTime
+		)
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.Event, &delivery.Status,
+			&delivery.Attempts, &next, &delivery.CreatedAt, &delivered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		if next.Valid && delivery.Status == domain.DeliveryPending {
+			delivery.NextAttempt = &next.Time
+		}
+		if delivered.Valid {
+			delivery.DeliveredAt = &delivered.Time
+		}
+		delivery.Retries = max(delivery.Attempts-1, 0)
+		delivery.Log = []domain.WebhookAttempt{}
+		index[delivery.ID] = len(deliveries)
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	if len(deliveries) == 0 {
+		return deliveries, nil
+	}
+
+	attempts, err := s.reads.Query(`
+		SELECT a.delivery_id, a.attempt, a.attempted_at, a.status_code, a.latency_ms, a.error
+		FROM webhook_attempts a
+		JOIN (
+			SELECT id FROM webhook_deliveries
+			WHERE webhook_id = ? AND (? = '' OR status = ?)
+			ORDER BY created_at DESC
+			LIMIT ?
+		) d ON d.id = a.delivery_id
+		ORDER BY a.delivery_id, a.attempt
+	`, id, status, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query delivery attempts: %w", err)
+	}
+	defer attempts.Close()
+
+	for attempts.Next() {
+		var (
+			deliveryID string
+			attempt    domain.WebhookAttempt
+		)
+		err := attempts.Scan(&deliveryID, &attempt.Attempt, &attempt.AttemptedAt, &attempt.StatusCode, &attempt.LatencyMs, &attempt.Error)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan delivery attempt: %w", err)
+		}
+		if i, ok := index[deliveryID]; ok {
+			deliveries[i].Log = append(deliveries[i].Log, attempt)
+		}
+	}
+	if err := attempts.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return deliveries, nil
+}
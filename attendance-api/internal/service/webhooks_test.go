@@ -0,0 +1,108 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+)
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"event":"attendance"}`)
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write(body)
+	if got, want := SignWebhook("whsec_test", body), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("SignWebhook = %q, want %q", got, want)
+	}
+	if SignWebhook("whsec_other", body) == SignWebhook("whsec_test", body) {
+		t.Error("signature does not depend on the secret")
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	s := &WebhookService{cfg: config.WebhookConfig{RetryBackoff: 30 * time.Second}}
+	for attempt, want := range map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		3:  2 * time.Minute,
+		20: maxWebhookBackoff,
+	} {
+		if got := s.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+// A delivery the receiver refuses is retried, signed every time, until it
+// is accepted
+func TestWebhookRetry(t *testing.T) {
+	const secret = "whsec_test"
+
+	var (
+		mu       sync.Mutex
+		attempts []string
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, r.Header.Get("X-Webhook-Attempt"))
+		if r.Header.Get("X-Signature") != SignWebhook(secret, body) {
+			t.Errorf("attempt %s: signature does not match the body", r.Header.Get("X-Webhook-Attempt"))
+		}
+		if len(attempts) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(receiver.Close)
+
+	db := newTestDB(t)
+	s, err := NewWebhookService(db, db, config.WebhookConfig{
+		Timeout:      time.Second,
+		MaxAttempts:  5,
+		RetryBackoff: time.Millisecond,
+		QueueSize:    10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	hook, _, err := s.Create(receiver.URL, []string{domain.EventAttendance}, "test", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Emit(domain.EventAttendance, sampleRecord)
+
+	var delivery domain.WebhookDelivery
+	for deadline := time.Now().Add(10 * time.Second); delivery.Status != domain.DeliveryDelivered; {
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery still %q", delivery.Status)
+		}
+		time.Sleep(50 * time.Millisecond)
+		deliveries, err := s.Deliveries(hook.ID, "", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) == 1 {
+			delivery = deliveries[0]
+		}
+	}
+
+	if delivery.Attempts != 3 || len(delivery.Log) != 3 {
+		t.Errorf("delivered after %d attempt(s) with %d logged, want 3", delivery.Attempts, len(delivery.Log))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attempts) != 3 || attempts[0] != "1" || attempts[2] != "3" {
+		t.Errorf("receiver saw attempts %v, want 1, 2 and 3", attempts)
+	}
+}
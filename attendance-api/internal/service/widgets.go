@@ -0,0 +1,259 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"slices"
+	"time"
+
+	"attendance-api/internal/config"
+	"attendance-api/internal/domain"
+)
+
+var ErrNoThumbnail = errors.New("no thumbnail for this record")
+
+// Widgets of the lobby displays
+const (
+	WidgetPresent  = "present"
+	WidgetArrivals = "arrivals"
+	WidgetAlerts   = "alerts"
+)
+
+// maxWidgetAlertRecords bounds the records read for the alerts widget
+const maxWidgetAlertRecords = 1000
+
+// WidgetService builds the small payloads shown on lobby displays: today's
+// present count, the latest arrivals and current alerts. Payloads only hold
+// what a display in a public area may show.
+type WidgetService struct {
+	reads     *sql.DB
+	snapshots *SnapshotService
+	warmup    *WarmupService
+	loc       *time.Location // zone of the site, in which days begin and end
+	cfg       config.WidgetsConfig
+}
+
+func NewWidgetService(reads *sql.DB, snapshots *SnapshotService, warmup *WarmupService, loc *time.Location, cfg config.WidgetsConfig) *WidgetService {
+	if cfg.Arrivals <= 0 {
+		cfg.Arrivals = 5
+	}
+	if cfg.ThumbnailSize <= 0 {
+		cfg.ThumbnailSize = 96
+	}
+	if cfg.Refresh <= 0 {
+		cfg.Refresh = 30 * time.Second
+	}
+	return &WidgetService{reads: reads, snapshots: snapshots, warmup: warmup, loc: loc, cfg: cfg}
+}
+
+// Refresh is how often displays should fetch a widget again. Alerts are
+// refreshed twice as often as the others.
+func (s *WidgetService) Refresh(widget string) time.Duration {
+	if widget == WidgetAlerts {
+		return s.cfg.Refresh / 2
+	}
+	return s.cfg.Refresh
+}
+
+// Present counts the people recognized today against the active people
+func (s *WidgetService) Present() (*domain.WidgetPresent, error) {
+	now := time.Now().In(s.loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, s.loc)
+
+	present := &domain.WidgetPresent{Date: today.Format(dayFormat)}
+	err := s.reads.QueryRow(`
+		SELECT COUNT(DISTINCT name), COUNT(DISTINCT CASE WHEN late = 1 THEN name END)
+		FROM attendance
+		WHERE timestamp >= ? AND status = 'authorized' AND observe_only = 0
+	`, today).Scan(&present.Present, &present.Late)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count present people: %w", err)
+	}
+
+	err = s.reads.QueryRow("SELECT COUNT(*) FROM people WHERE active = 1").Scan(&present.Enrolled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count people: %w", err)
+	}
+
+	return present, nil
+}
+
+// Arrivals returns today's latest arrivals, newest first, under their full
+// names when the people registry has them
+func (s *WidgetService) Arrivals() ([]domain.WidgetArrival, error) {
+	now := time.Now().In(s.loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, s.loc)
+
+	rows, err := s.reads.Query(`
+		SELECT a.id, a.name, COALESCE(p.full_name, ''), a.timestamp, COALESCE(a.location, ''), COALESCE(rs.crop_key, '')
+		FROM attendance a
+		LEFT JOIN people p ON p.name = a.name
+		LEFT JOIN record_snapshots rs ON rs.attendance_id = a.id
+		WHERE a.timestamp >= ? AND a.status = 'authorized' AND a.observe_only = 0 AND a.event_type = ?
+		ORDER BY a.timestamp DESC
+		LIMIT ?
+	`, today, domain.EventCheckIn, s.cfg.Arrivals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query arrivals: %w", err)
+	}
+	defer rows.Close()
+
+	arrivals := []domain.WidgetArrival{}
+	for rows.Next() {
+		var (
+			arrival           domain.WidgetArrival
+			fullName, cropKey string
+		)
+		if err := rows.Scan(&arrival.ID, &arrival.Name, &fullName, &arrival.Timestamp, &arrival.Location, &cropKey); err != nil {
+			return nil, fmt.Errorf("failed to scan arrival: %w", err)
+		}
+		if fullName != "" {
+			arrival.Name = fullName
+		}
+		if cropKey != "" {
+			arrival.Thumbnail = "/api/v1/widgets/arrivals/" + arrival.ID + "/thumbnail"
+		}
+		arrivals = append(arrivals, arrival)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return arrivals, nil
+}
+
+// Thumbnail returns the face of an arrival, scaled down for the arrivals
+// widget. Only the arrivals currently listed have one, so displays cannot
+// be used to page through older snapshots.
+func (s *WidgetService) Thumbnail(ctx context.Context, attendanceID string) ([]byte, error) {
+	arrivals, err := s.Arrivals()
+	if err != nil {
+		return nil, err
+	}
+	listed := slices.ContainsFunc(arrivals, func(arrival domain.WidgetArrival) bool {
+		return arrival.ID == attendanceID && arrival.Thumbnail != ""
+	})
+	if !listed {
+		return nil, ErrNoThumbnail
+	}
+
+	crop, err := s.snapshots.Snapshot(ctx, attendanceID, true)
+	if errors.Is(err, ErrSnapshotNotFound) {
+		return nil, ErrNoThumbnail
+	}
+	if err != nil {
+		return nil, err
+	}
+	return thumbnail(crop, s.cfg.ThumbnailSize)
+}
+
+// Alerts groups the turned away and misplaced recognitions within the alert
+// window by type and location, most recent first, after an alert for a face
+// service that is not ready
+func (s *WidgetService) Alerts() ([]domain.WidgetAlert, error) {
+	alerts := []domain.WidgetAlert{}
+	if status := s.warmup.Status(); !status.Ready {
+		alerts = append(alerts, domain.WidgetAlert{
+			Type:    domain.WidgetAlertFaceServiceDown,
+			Message: "Face recognition is unavailable",
+			Count:   1,
+		})
+	}
+
+	rows, err := s.reads.Query(`
+		SELECT name, status, misplaced, COALESCE(location, ''), timestamp
+		FROM attendance
+		WHERE timestamp >= ? AND (status = 'unauthorized' OR misplaced = 1)
+		ORDER BY timestamp DESC
+		LIMIT ?
+	`, time.Now().Add(-s.cfg.AlertWindow), maxWidgetAlertRecords)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alerts: %w", err)
+	}
+	defer rows.Close()
+
+	indexOf := make(map[[2]string]int)
+	for rows.Next() {
+		var (
+			name, status, location string
+			misplaced              bool
+			timestamp              time.Time
+		)
+		if err := rows.Scan(&name, &status, &misplaced, &location, &timestamp); err != nil {
+			return nil, fmt.Errorf("failed to scan alert: %w", err)
+		}
+
+		alert := domain.WidgetAlert{Location: location}
+		switch {
+		case status == "unauthorized" && name == "Unknown":
+			alert.Type, alert.Message = domain.WidgetAlertUnknownPerson, "Unknown person"
+		case status == "unauthorized":
+			alert.Type, alert.Message = domain.WidgetAlertAccessDenied, "Access denied"
+		case misplaced:
+			alert.Type, alert.Message = domain.WidgetAlertMisplaced, "Recognized outside assigned location"
+		}
+
+		key := [2]string{alert.Type, location}
+		if i, ok := indexOf[key]; ok {
+			alerts[i].Count++
+			continue
+		}
+		alert.Count, alert.LastAt = 1, &timestamp
+		indexOf[key] = len(alerts)
+		alerts = append(alerts, alert)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return alerts, nil
+}
+
+// thumbnail scales a JPEG or PNG image down so its longer side is at most
+// size pixels, averaging the pixels each thumbnail pixel covers, and encodes
+// it as JPEG
+func thumbnail(imageData []byte, size int) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(imageData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if longer := max(width, height); longer > size {
+		width, height = max(width*size/longer, 1), max(height*size/longer, 1)
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(bounds.Min.Y+(y+1)*bounds.Dy()/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(bounds.Min.X+(x+1)*bounds.Dx()/width, x0+1)
+
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, _ := img.At(sx, sy).RGBA()
+					r, g, b, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), n+1
+				}
+			}
+			thumb.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: 0xffff})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
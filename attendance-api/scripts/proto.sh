@@ -0,0 +1,15 @@
+#!/bin/bash
+# Regenerate Go code from the protobuf definitions in api/proto
+# Requires protoc, protoc-gen-go and protoc-gen-go-grpc on PATH
+
+set -e
+
+cd "$(dirname "$0")/.."
+
+for proto in $(find api/proto -name '*.proto'); do
+  protoc -I api/proto \
+    --go_out=. --go_opt=module=attendance-api \
+    --go-grpc_out=. --go-grpc_opt=module=attendance-api \
+    "${proto#api/proto/}"
+  echo "✓ Generated $proto"
+done
@@ -22,23 +22,23 @@ echo ""
 
 # 2. Check initial stats
 echo "2. Initial Statistics..."
-curl -s "$BASE_URL/api/attendance/stats" | jq '.'
+curl -s "$BASE_URL/api/v1/attendance/stats" | jq '.'
 echo ""
 
 # 3. List faces
 echo "3. List Known Faces..."
-curl -s "$BASE_URL/api/faces" | jq '.'
+curl -s "$BASE_URL/api/v1/faces" | jq '.'
 echo ""
 
 # 4. Get recent attendance (should be empty initially)
 echo "4. Recent Attendance Records..."
-curl -s "$BASE_URL/api/attendance/recent?limit=5" | jq '.'
+curl -s "$BASE_URL/api/v1/attendance/recent?limit=5" | jq '.'
 echo ""
 
 # 5. Test attendance recording with image
 if [ -f "$1" ]; then
     echo "5. Recording Attendance with image: $1"
-    RESULT=$(curl -s -X POST -F "image=@$1" "$BASE_URL/api/attendance")
+    RESULT=$(curl -s -X POST -F "image=@$1" "$BASE_URL/api/v1/attendance")
     echo "$RESULT" | jq '.'
     
     AUTHORIZED=$(echo "$RESULT" | jq -r '.authorized')
@@ -53,12 +53,12 @@ if [ -f "$1" ]; then
     
     # 6. Check stats after recording
     echo "6. Statistics After Recording..."
-    curl -s "$BASE_URL/api/attendance/stats" | jq '.'
+    curl -s "$BASE_URL/api/v1/attendance/stats" | jq '.'
     echo ""
     
     # 7. Get recent records again
     echo "7. Recent Records (should show new entry)..."
-    curl -s "$BASE_URL/api/attendance/recent?limit=5" | jq '.'
+    curl -s "$BASE_URL/api/v1/attendance/recent?limit=5" | jq '.'
     echo ""
 else
     echo "5. Skipping attendance recording test (no image provided)"
@@ -15,13 +15,13 @@ echo ""
 
 # List faces from Face Recognition API
 echo "2. List Known Faces..."
-curl -s "$BASE_URL/api/faces" | jq '.'
+curl -s "$BASE_URL/api/v1/faces" | jq '.'
 echo ""
 
 # Test attendance recording (need an image)
 if [ -f "$1" ]; then
     echo "3. Testing Attendance Recording with: $1"
-    curl -s -X POST -F "image=@$1" "$BASE_URL/api/attendance" | jq '.'
+    curl -s -X POST -F "image=@$1" "$BASE_URL/api/v1/attendance" | jq '.'
     echo ""
 else
     echo "3. Skipping attendance test (no image provided)"
@@ -31,7 +31,7 @@ fi
 
 # Test SSE stream (run for 5 seconds)
 echo "4. Testing SSE Stream (5 seconds)..."
-timeout 5 curl -N "$BASE_URL/api/attendance/stream" || echo "SSE stream test completed"
+timeout 5 curl -N "$BASE_URL/api/v1/attendance/stream" || echo "SSE stream test completed"
 echo ""
 
 echo "======================================"
@@ -9,13 +9,17 @@ from werkzeug.utils import secure_filename
 import os
 import sys
 import tempfile
+from datetime import datetime, timezone
 from pathlib import Path
 
 # Import from same package
-from .face_recognizer import FaceRecognizer
+from .face_recognizer import FaceRecognizer, person_of
 
 app = Flask(__name__)
 
+# Reported by /health so clients can tell the service restarted
+STARTED_AT = datetime.now(timezone.utc).isoformat()
+
 # Configuration
 ALLOWED_EXTENSIONS = {'png', 'jpg', 'jpeg', 'bmp'}
 MAX_FILE_SIZE = 16 * 1024 * 1024  # 16MB
@@ -44,7 +48,8 @@ def health():
         "status": "ok",
         "service": "Face Recognition API",
         "known_faces": len(set(recognizer.known_face_names)),
-        "total_encodings": len(recognizer.known_face_encodings)
+        "total_encodings": len(recognizer.known_face_encodings),
+        "started_at": STARTED_AT
     })
 
 
@@ -292,6 +297,7 @@ def add_face():
             shutil.move(temp_path, filepath)
             
             added_images.append({
+                "file": file.filename,
                 "filename": filename,
                 "path": str(filepath)
             })
@@ -337,6 +343,155 @@ def add_face():
     return jsonify(response), 201
 
 
+@app.route('/faces/<name>', methods=['DELETE'])
+def remove_face(name):
+    """
+    Remove a person and all of their images from the known faces database.
+
+    Returns: JSON with the removed image files
+    """
+    name = name.strip().replace(' ', '_').lower()
+
+    known_faces_dir = Path("known_faces")
+    removed = []
+
+    if known_faces_dir.exists():
+        for image_path in known_faces_dir.iterdir():
+            if person_of(image_path.name) == name:
+                image_path.unlink()
+                removed.append(image_path.name)
+
+    if not removed:
+        return jsonify({
+            "success": False,
+            "error": "Face not found",
+            "message": f"No images found for {name}"
+        }), 404
+
+    # Clear cache to force reload
+    cache_file = "face_encodings.pkl"
+    if os.path.exists(cache_file):
+        os.remove(cache_file)
+
+    recognizer.load_known_faces(force_reload=True)
+
+    return jsonify({
+        "success": True,
+        "message": f"Removed {len(removed)} image(s) of {name}",
+        "name": name,
+        "images_removed": len(removed),
+        "files": sorted(removed)
+    }), 200
+
+
+@app.route('/faces/<name>/images', methods=['GET'])
+def list_face_images(name):
+    """
+    List the stored image files of a person, e.g. to choose the images to
+    split off into another person.
+
+    Returns: JSON with the image file names
+    """
+    name = name.strip().replace(' ', '_').lower()
+
+    known_faces_dir = Path("known_faces")
+    known_faces_dir.mkdir(exist_ok=True)
+
+    files = []
+    for image_path in sorted(known_faces_dir.iterdir()):
+        if image_path.suffix.lower() not in {'.jpg', '.jpeg', '.png', '.bmp'}:
+            continue
+        if person_of(image_path.name) == name:
+            files.append(image_path.name)
+
+    if not files:
+        return jsonify({
+            "success": False,
+            "error": "Face not found",
+            "message": f"No images found for {name}"
+        }), 404
+
+    return jsonify({
+        "success": True,
+        "name": name,
+        "images": len(files),
+        "files": files
+    }), 200
+
+
+@app.route('/faces/merge', methods=['POST'])
+def merge_faces():
+    """
+    Move every image of one person to another, e.g. after the same person
+    was enrolled under two spellings of their name. With "files" only the
+    listed images of source are moved, which splits off a new person.
+
+    Expects JSON: {"source": "jon_smith", "target": "john_smith", "files": ["jon_smith_2.jpg"]}
+
+    Returns: JSON with the moved image files
+    """
+    data = request.get_json(silent=True) or {}
+    source = str(data.get('source', '')).strip().replace(' ', '_').lower()
+    target = str(data.get('target', '')).strip().replace(' ', '_').lower()
+    files = data.get('files') or []
+
+    if not source or not target or source == target:
+        return jsonify({
+            "success": False,
+            "error": "Invalid merge",
+            "message": "Please provide different 'source' and 'target' names"
+        }), 400
+
+    known_faces_dir = Path("known_faces")
+    known_faces_dir.mkdir(exist_ok=True)
+
+    images = [p for p in known_faces_dir.iterdir() if p.suffix.lower() in {'.jpg', '.jpeg', '.png', '.bmp'}]
+    source_images = sorted(p for p in images if person_of(p.name) == source)
+    if not source_images:
+        return jsonify({
+            "success": False,
+            "error": "Face not found",
+            "message": f"No images found for {source}"
+        }), 404
+
+    if files:
+        unknown = sorted(set(files) - {p.name for p in source_images})
+        if unknown:
+            return jsonify({
+                "success": False,
+                "error": "Invalid merge",
+                "message": f"Not images of {source}: {', '.join(unknown)}"
+            }), 400
+        source_images = [p for p in source_images if p.name in files]
+
+    number = len([p for p in images if person_of(p.name) == target]) + 1
+    moved = []
+    for image_path in source_images:
+        filename = f"{target}_{number}{image_path.suffix.lower()}"
+        while (known_faces_dir / filename).exists():
+            number += 1
+            filename = f"{target}_{number}{image_path.suffix.lower()}"
+        image_path.rename(known_faces_dir / filename)
+        moved.append({"from": image_path.name, "to": filename})
+        number += 1
+
+    # Clear cache to force reload
+    cache_file = "face_encodings.pkl"
+    if os.path.exists(cache_file):
+        os.remove(cache_file)
+
+    recognizer.load_known_faces(force_reload=True)
+
+    return jsonify({
+        "success": True,
+        "message": f"Moved {len(moved)} image(s) of {source} to {target}",
+        "source": source,
+        "target": target,
+        "images_moved": len(moved),
+        "files": moved
+    }), 200
+
+
 @app.route('/faces/reload', methods=['POST'])
 def reload_faces():
     """
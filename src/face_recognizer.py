@@ -13,6 +13,17 @@ from pathlib import Path
 from typing import List, Tuple, Dict, Optional
 
 
+def person_of(filename) -> str:
+    """
+    Name of the person an image file belongs to: images are named after
+    the person with an optional number, e.g. "john_doe_1.jpg" -> "john_doe".
+    """
+    name = Path(filename).stem
+    parts = name.split('_')
+    if len(parts) > 1 and parts[-1].isdigit():
+        return '_'.join(parts[:-1])
+    return name
+
 class FaceRecognizer:
     """
     A simple and accurate face recognition system.
@@ -85,13 +96,7 @@ class FaceRecognizer:
             if len(encodings) > 1:
                 print(f"  ⚠️  Multiple faces found in {image_path.name}, using first face")
             
-            # Extract person's name (handles formats like "john_doe_1.jpg" -> "john_doe")
-            # Remove trailing numbers and underscores: john_doe_1 -> john_doe
-            name = image_path.stem
-            # Split by underscore and check if last part is a number
-            parts = name.split('_')
-            if len(parts) > 1 and parts[-1].isdigit():
-                name = '_'.join(parts[:-1])  # Remove the number suffix
+            name = person_of(image_path.name)
             
             self.known_face_encodings.append(encodings[0])
             self.known_face_names.append(name)